@@ -0,0 +1,218 @@
+// Package bench implements the benchmark mode (--repeat and --concurrency)
+// that sends the same request many times and collects statistics.
+package bench
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ameshkov/gocurl/internal/client"
+	"github.com/ameshkov/gocurl/internal/config"
+	"github.com/ameshkov/gocurl/internal/output"
+)
+
+// Stats is the result of the benchmark.
+type Stats struct {
+	// Requests is the total number of requests that were sent.
+	Requests int `json:"requests"`
+
+	// Succeeded is the number of requests that received a response.
+	Succeeded int `json:"succeeded"`
+
+	// Failed is the number of requests that failed.
+	Failed int `json:"failed"`
+
+	// StatusCodes is the number of responses per HTTP status code.
+	StatusCodes map[int]int `json:"status_codes"`
+
+	// Errors is the number of failed requests per error message.
+	Errors map[string]int `json:"errors"`
+
+	// Duration is the total duration of the benchmark.
+	Duration time.Duration `json:"duration_ns"`
+
+	// BytesReceived is the total size of the received response bodies.
+	BytesReceived int64 `json:"bytes_received"`
+
+	// RequestsPerSecond is the number of processed requests per second.
+	RequestsPerSecond float64 `json:"requests_per_second"`
+
+	// BytesPerSecond is the download throughput.
+	BytesPerSecond float64 `json:"bytes_per_second"`
+
+	// Latency contains the requests latency percentiles.
+	Latency *Latency `json:"latency"`
+
+	// Err is the error of the last failed request or nil if all requests
+	// succeeded.
+	Err error `json:"-"`
+}
+
+// Latency contains the requests latency statistics.  Latency is measured from
+// the moment the request is sent until the response body is fully read.
+type Latency struct {
+	Min  time.Duration `json:"min_ns"`
+	Mean time.Duration `json:"mean_ns"`
+	P50  time.Duration `json:"p50_ns"`
+	P90  time.Duration `json:"p90_ns"`
+	P99  time.Duration `json:"p99_ns"`
+	Max  time.Duration `json:"max_ns"`
+}
+
+// Run sends cfg.Repeat requests using cfg.Concurrency workers and returns the
+// collected statistics.  The same transport is used for all the requests.
+func Run(cfg *config.Config, transport client.Transport, out *output.Output) (s *Stats) {
+	out.Debug("Sending %d requests using %d workers", cfg.Repeat, cfg.Concurrency)
+
+	jobs := make(chan struct{}, cfg.Repeat)
+	for i := 0; i < cfg.Repeat; i++ {
+		jobs <- struct{}{}
+	}
+	close(jobs)
+
+	results := make(chan *client.ProbeResult, cfg.Repeat)
+	wg := &sync.WaitGroup{}
+
+	start := time.Now()
+	for i := 0; i < cfg.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for range jobs {
+				results <- client.Probe(cfg, transport)
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(results)
+
+	return newStats(results, time.Since(start))
+}
+
+// newStats calculates the benchmark statistics from the requests results.
+func newStats(results <-chan *client.ProbeResult, duration time.Duration) (s *Stats) {
+	s = &Stats{
+		StatusCodes: map[int]int{},
+		Errors:      map[string]int{},
+		Duration:    duration,
+	}
+
+	var latencies []time.Duration
+	var total time.Duration
+	for r := range results {
+		s.Requests++
+		s.BytesReceived += r.BodySize
+
+		if r.Err != nil {
+			s.Failed++
+			s.Errors[r.Err.Error()]++
+			s.Err = r.Err
+
+			continue
+		}
+
+		s.Succeeded++
+		s.StatusCodes[r.Response.StatusCode]++
+		latencies = append(latencies, r.Duration)
+		total += r.Duration
+	}
+
+	if duration > 0 {
+		s.RequestsPerSecond = float64(s.Requests) / duration.Seconds()
+		s.BytesPerSecond = float64(s.BytesReceived) / duration.Seconds()
+	}
+
+	if len(latencies) > 0 {
+		slices.Sort(latencies)
+		s.Latency = &Latency{
+			Min:  latencies[0],
+			Mean: total / time.Duration(len(latencies)),
+			P50:  percentile(latencies, 50),
+			P90:  percentile(latencies, 90),
+			P99:  percentile(latencies, 99),
+			Max:  latencies[len(latencies)-1],
+		}
+	}
+
+	return s
+}
+
+// percentile returns the p-th percentile of the sorted slice of durations.
+func percentile(sorted []time.Duration, p int) (d time.Duration) {
+	idx := (len(sorted)*p+99)/100 - 1
+
+	return sorted[max(idx, 0)]
+}
+
+// Write writes the statistics to out either in the text or in the JSON
+// format.
+func (s *Stats) Write(out *output.Output, outputJSON bool) {
+	if outputJSON {
+		b, err := json.MarshalIndent(s, "", "  ")
+		if err != nil {
+			panic(err)
+		}
+
+		out.WriteRaw(b)
+
+		return
+	}
+
+	out.WriteRaw([]byte(s.String()))
+}
+
+// String implements the fmt.Stringer interface for *Stats.
+func (s *Stats) String() (str string) {
+	b := &strings.Builder{}
+
+	_, _ = fmt.Fprintf(b, "Requests:      %d\n", s.Requests)
+	_, _ = fmt.Fprintf(b, "Succeeded:     %d\n", s.Succeeded)
+	_, _ = fmt.Fprintf(b, "Failed:        %d\n", s.Failed)
+	_, _ = fmt.Fprintf(b, "Duration:      %s\n", s.Duration)
+	_, _ = fmt.Fprintf(b, "Requests/sec:  %.2f\n", s.RequestsPerSecond)
+	_, _ = fmt.Fprintf(b, "Received:      %d bytes (%.2f bytes/sec)\n", s.BytesReceived, s.BytesPerSecond)
+
+	if s.Latency != nil {
+		_, _ = fmt.Fprintf(b, "\nLatency:\n")
+		_, _ = fmt.Fprintf(b, "  min:  %s\n", s.Latency.Min)
+		_, _ = fmt.Fprintf(b, "  mean: %s\n", s.Latency.Mean)
+		_, _ = fmt.Fprintf(b, "  p50:  %s\n", s.Latency.P50)
+		_, _ = fmt.Fprintf(b, "  p90:  %s\n", s.Latency.P90)
+		_, _ = fmt.Fprintf(b, "  p99:  %s\n", s.Latency.P99)
+		_, _ = fmt.Fprintf(b, "  max:  %s\n", s.Latency.Max)
+	}
+
+	if len(s.StatusCodes) > 0 {
+		_, _ = fmt.Fprintf(b, "\nStatus codes:\n")
+		codes := make([]int, 0, len(s.StatusCodes))
+		for code := range s.StatusCodes {
+			codes = append(codes, code)
+		}
+		slices.Sort(codes)
+
+		for _, code := range codes {
+			_, _ = fmt.Fprintf(b, "  %d: %d\n", code, s.StatusCodes[code])
+		}
+	}
+
+	if len(s.Errors) > 0 {
+		_, _ = fmt.Fprintf(b, "\nErrors:\n")
+		msgs := make([]string, 0, len(s.Errors))
+		for msg := range s.Errors {
+			msgs = append(msgs, msg)
+		}
+		slices.Sort(msgs)
+
+		for _, msg := range msgs {
+			_, _ = fmt.Fprintf(b, "  %d: %s\n", s.Errors[msg], msg)
+		}
+	}
+
+	return b.String()
+}
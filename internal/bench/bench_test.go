@@ -0,0 +1,47 @@
+package bench_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/ameshkov/gocurl/internal/bench"
+	"github.com/ameshkov/gocurl/internal/client"
+	"github.com/ameshkov/gocurl/internal/config"
+	"github.com/ameshkov/gocurl/internal/output"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("test"))
+	}))
+	t.Cleanup(srv.Close)
+
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	out, err := output.NewOutput("", false)
+	require.NoError(t, err)
+
+	cfg := &config.Config{
+		RequestURL:  u,
+		Repeat:      10,
+		Concurrency: 3,
+	}
+
+	transport, err := client.NewTransport(cfg, out)
+	require.NoError(t, err)
+
+	s := bench.Run(cfg, transport, out)
+	require.Equal(t, 10, s.Requests)
+	require.Equal(t, 10, s.Succeeded)
+	require.Equal(t, 0, s.Failed)
+	require.NoError(t, s.Err)
+	require.Equal(t, map[int]int{http.StatusOK: 10}, s.StatusCodes)
+	require.Equal(t, int64(40), s.BytesReceived)
+	require.NotNil(t, s.Latency)
+	require.LessOrEqual(t, s.Latency.Min, s.Latency.P50)
+	require.LessOrEqual(t, s.Latency.P50, s.Latency.Max)
+}
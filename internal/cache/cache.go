@@ -0,0 +1,339 @@
+// Package cache implements a private HTTP cache that keeps the responses in a
+// directory so that they are reused by subsequent gocurl invocations, see
+// --cache-dir and RFC 9111.
+package cache
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/ameshkov/gocurl/internal/output"
+)
+
+// cacheName is the name of the cache in the Cache-Status header.
+const cacheName = "gocurl"
+
+// Transport is an http.RoundTripper that serves fresh responses from the
+// cache, revalidates stale ones, and stores the received responses.  Every
+// response it returns has the Cache-Status header (RFC 9211) that describes
+// how the cache handled the request.
+type Transport struct {
+	base http.RoundTripper
+	out  *output.Output
+	dir  string
+}
+
+// type check
+var _ http.RoundTripper = (*Transport)(nil)
+
+// NewTransport creates a new *Transport that stores the responses in dir and
+// uses base to send the requests.  dir is created if it does not exist.
+func NewTransport(base http.RoundTripper, dir string, out *output.Output) (t *Transport, err error) {
+	err = os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("creating cache directory: %w", err)
+	}
+
+	return &Transport{
+		base: base,
+		out:  out,
+		dir:  dir,
+	}, nil
+}
+
+// RoundTrip implements the http.RoundTripper interface for *Transport.
+func (t *Transport) RoundTrip(r *http.Request) (resp *http.Response, err error) {
+	path := entryPath(t.dir, r.URL.String())
+
+	if r.Method != http.MethodGet {
+		resp, err = t.base.RoundTrip(r)
+		if err != nil {
+			return nil, err
+		}
+
+		// Unsafe methods invalidate the stored response, see RFC 9111,
+		// section 4.4.
+		if !isSafeMethod(r.Method) && resp.StatusCode < http.StatusBadRequest {
+			t.remove(path)
+		}
+
+		return t.withStatus(resp, "fwd=method"), nil
+	}
+
+	reqCC := parseCacheControl(r.Header)
+	if reqCC.has("no-store") || isConditional(r) {
+		resp, err = t.base.RoundTrip(r)
+		if err != nil {
+			return nil, err
+		}
+
+		return t.withStatus(resp, "fwd=bypass"), nil
+	}
+
+	e, body, size, err := readEntry(path)
+	if err != nil {
+		t.out.Debug("Ignoring invalid cache entry: %v", err)
+	}
+
+	fwd := "uri-miss"
+	if e != nil {
+		now := time.Now()
+		age := currentAge(e, now)
+		ttl := freshnessLifetime(e.StatusCode, e.Header) - age
+
+		switch {
+		case !e.matches(r):
+			fwd = "vary-miss"
+		case reqCC.has("no-cache") || (len(reqCC) == 0 && r.Header.Get("Pragma") == "no-cache"):
+			fwd = "request"
+		case ttl <= 0 || parseCacheControl(e.Header).has("no-cache") || exceedsMaxAge(reqCC, age):
+			fwd = "stale"
+		default:
+			resp = e.response(r, body, size)
+			resp.Header.Set("Age", strconv.FormatInt(int64(age/time.Second), 10))
+
+			return t.withStatus(resp, fmt.Sprintf("hit; ttl=%d", ttl/time.Second)), nil
+		}
+
+		if fwd == "vary-miss" {
+			_ = body.Close()
+			e = nil
+		}
+	}
+
+	return t.forward(r, path, e, body, fwd)
+}
+
+// forward sends r to the server.  e is the stored response that needs to be
+// revalidated, body is its body.  They are nil if there is no suitable stored
+// response.  fwd is the reason why the request is forwarded, see RFC 9211.
+func (t *Transport) forward(
+	r *http.Request,
+	path string,
+	e *entry,
+	body io.ReadCloser,
+	fwd string,
+) (resp *http.Response, err error) {
+	if e != nil {
+		defer func() { _ = body.Close() }()
+	}
+
+	outReq := r
+	if e != nil {
+		outReq = withValidators(r, e)
+	}
+
+	requestTime := time.Now()
+	resp, err = t.base.RoundTrip(outReq)
+	if err != nil {
+		return nil, err
+	}
+
+	responseTime := time.Now()
+	status := fmt.Sprintf("fwd=%s; fwd-status=%d", fwd, resp.StatusCode)
+
+	if e != nil && outReq != r && resp.StatusCode == http.StatusNotModified {
+		_ = resp.Body.Close()
+
+		return t.revalidated(r, path, e, body, resp, requestTime, responseTime, status)
+	}
+
+	if !storable(r, resp) {
+		t.remove(path)
+
+		return t.withStatus(resp, status), nil
+	}
+
+	f, err := createEntryFile(t.dir, newEntry(r, resp, requestTime, responseTime))
+	if err != nil {
+		t.out.Debug("Failed to store the response in the cache: %v", err)
+
+		return t.withStatus(resp, status), nil
+	}
+
+	resp.Body = &storingBody{
+		ReadCloser: resp.Body,
+		out:        t.out,
+		f:          f,
+		path:       path,
+	}
+
+	return t.withStatus(resp, status+"; stored"), nil
+}
+
+// revalidated updates the stored response e after the server responded with
+// 304 Not Modified and returns the stored response.
+func (t *Transport) revalidated(
+	r *http.Request,
+	path string,
+	e *entry,
+	body io.Reader,
+	notModified *http.Response,
+	requestTime time.Time,
+	responseTime time.Time,
+	status string,
+) (resp *http.Response, err error) {
+	// Update the stored header fields, see RFC 9111, section 3.2.
+	for name, values := range notModified.Header {
+		if name != "Content-Length" {
+			e.Header[name] = values
+		}
+	}
+
+	e.RequestTime, e.ResponseTime = requestTime, responseTime
+
+	// The body is copied into the new entry file and then read from it since
+	// the old one is replaced.
+	f, err := createEntryFile(t.dir, e)
+	if err == nil {
+		_, err = io.Copy(f, body)
+		if err == nil {
+			err = commitEntryFile(f, path)
+		} else {
+			discardEntryFile(f)
+		}
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("updating cache entry: %w", err)
+	}
+
+	e, newBody, size, err := readEntry(path)
+	if err != nil || e == nil {
+		return nil, fmt.Errorf("reading updated cache entry: %w", err)
+	}
+
+	return t.withStatus(e.response(r, newBody, size), status), nil
+}
+
+// withStatus sets the Cache-Status header of resp to the specified status
+// parameters and returns resp.
+func (t *Transport) withStatus(resp *http.Response, params string) (res *http.Response) {
+	v := cacheName + "; " + params
+	t.out.Debug("Cache status for %s: %s", resp.Request.URL, v)
+	resp.Header.Set("Cache-Status", v)
+
+	return resp
+}
+
+// remove removes the stored response at path if there is one.
+func (t *Transport) remove(path string) {
+	err := os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		t.out.Debug("Failed to remove cache entry: %v", err)
+	}
+}
+
+// withValidators returns a copy of r with the conditional headers that allow
+// validating the stored response e.  If e has no validators, r is returned.
+func withValidators(r *http.Request, e *entry) (res *http.Request) {
+	etag, lastModified := e.Header.Get("ETag"), e.Header.Get("Last-Modified")
+	if etag == "" && lastModified == "" {
+		return r
+	}
+
+	res = r.Clone(r.Context())
+	if etag != "" {
+		res.Header.Set("If-None-Match", etag)
+	}
+
+	if lastModified != "" {
+		res.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	return res
+}
+
+// isSafeMethod returns true if the method is safe, see RFC 9110, section
+// 9.2.1.
+func isSafeMethod(method string) (ok bool) {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	default:
+		return false
+	}
+}
+
+// isConditional returns true if r already has the conditional or range
+// headers, in this case the cache is bypassed.
+func isConditional(r *http.Request) (ok bool) {
+	for _, name := range []string{
+		"If-Match",
+		"If-None-Match",
+		"If-Modified-Since",
+		"If-Unmodified-Since",
+		"If-Range",
+		"Range",
+	} {
+		if r.Header.Get(name) != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// exceedsMaxAge returns true if age is larger than the max-age directive of
+// the request.
+func exceedsMaxAge(reqCC cacheControl, age time.Duration) (ok bool) {
+	maxAge, ok := reqCC.seconds("max-age")
+
+	return ok && age > maxAge
+}
+
+// storingBody is the response body that is written to the cache entry file
+// while it is read.  The entry is only stored when the body is read
+// completely.
+type storingBody struct {
+	io.ReadCloser
+
+	out  *output.Output
+	f    *os.File
+	path string
+}
+
+// Read implements the io.Reader interface for *storingBody.
+func (b *storingBody) Read(p []byte) (n int, err error) {
+	n, err = b.ReadCloser.Read(p)
+	if b.f == nil {
+		return n, err
+	}
+
+	if n > 0 {
+		_, wErr := b.f.Write(p[:n])
+		if wErr != nil {
+			b.out.Debug("Failed to store the response in the cache: %v", wErr)
+			discardEntryFile(b.f)
+			b.f = nil
+
+			return n, err
+		}
+	}
+
+	if err == io.EOF {
+		cErr := commitEntryFile(b.f, b.path)
+		if cErr != nil {
+			b.out.Debug("Failed to store the response in the cache: %v", cErr)
+		}
+
+		b.f = nil
+	}
+
+	return n, err
+}
+
+// Close implements the io.Closer interface for *storingBody.
+func (b *storingBody) Close() (err error) {
+	if b.f != nil {
+		// The body was not read completely, don't store a partial response.
+		discardEntryFile(b.f)
+		b.f = nil
+	}
+
+	return b.ReadCloser.Close()
+}
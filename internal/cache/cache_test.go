@@ -0,0 +1,79 @@
+package cache_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ameshkov/gocurl/internal/cache"
+	"github.com/ameshkov/gocurl/internal/output"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransport_RoundTrip(t *testing.T) {
+	var requests, notModified atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+
+		w.Header().Set("ETag", `"v1"`)
+		if r.URL.Path == "/fresh" {
+			w.Header().Set("Cache-Control", "max-age=60")
+		} else {
+			w.Header().Set("Cache-Control", "no-cache")
+		}
+
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+
+			return
+		}
+
+		_, _ = io.WriteString(w, "body of "+r.URL.Path)
+	}))
+	t.Cleanup(srv.Close)
+
+	out, err := output.NewOutput("", false)
+	require.NoError(t, err)
+
+	tr, err := cache.NewTransport(http.DefaultTransport, t.TempDir(), out)
+	require.NoError(t, err)
+
+	roundTrip := func(method, path string) (status, body string) {
+		req, reqErr := http.NewRequest(method, srv.URL+path, nil)
+		require.NoError(t, reqErr)
+
+		resp, reqErr := tr.RoundTrip(req)
+		require.NoError(t, reqErr)
+		defer func() { _ = resp.Body.Close() }()
+
+		b, reqErr := io.ReadAll(resp.Body)
+		require.NoError(t, reqErr)
+
+		return resp.Header.Get("Cache-Status"), string(b)
+	}
+
+	status, body := roundTrip(http.MethodGet, "/fresh")
+	require.Equal(t, "gocurl; fwd=uri-miss; fwd-status=200; stored", status)
+	require.Equal(t, "body of /fresh", body)
+
+	status, body = roundTrip(http.MethodGet, "/fresh")
+	require.Contains(t, status, "gocurl; hit; ttl=")
+	require.Equal(t, "body of /fresh", body)
+	require.EqualValues(t, 1, requests.Load())
+
+	_, _ = roundTrip(http.MethodGet, "/revalidate")
+	status, body = roundTrip(http.MethodGet, "/revalidate")
+	require.Equal(t, "gocurl; fwd=stale; fwd-status=304", status)
+	require.Equal(t, "body of /revalidate", body)
+	require.EqualValues(t, 1, notModified.Load())
+
+	// Unsafe methods invalidate the stored response.
+	status, _ = roundTrip(http.MethodPost, "/fresh")
+	require.Equal(t, "gocurl; fwd=method", status)
+
+	status, _ = roundTrip(http.MethodGet, "/fresh")
+	require.Equal(t, "gocurl; fwd=uri-miss; fwd-status=200; stored", status)
+}
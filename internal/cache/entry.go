@@ -0,0 +1,223 @@
+package cache
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// entry is the stored response.  The file of the entry contains the entry
+// encoded as a single line of JSON followed by the response body.
+type entry struct {
+	// URL is the request URL.
+	URL string `json:"url"`
+
+	// Proto is the protocol of the response, e.g. "HTTP/2.0".
+	Proto string `json:"proto"`
+
+	// Status is the status line of the response, e.g. "200 OK".
+	Status string `json:"status"`
+
+	// StatusCode is the status code of the response.
+	StatusCode int `json:"status_code"`
+
+	// Header is the response header.
+	Header http.Header `json:"header"`
+
+	// Vary is the values of the request headers nominated by the Vary
+	// response header.
+	Vary map[string][]string `json:"vary,omitempty"`
+
+	// RequestTime is the time when the request was sent.
+	RequestTime time.Time `json:"request_time"`
+
+	// ResponseTime is the time when the response was received.
+	ResponseTime time.Time `json:"response_time"`
+}
+
+// newEntry creates an entry for resp to the request r.
+func newEntry(r *http.Request, resp *http.Response, requestTime, responseTime time.Time) (e *entry) {
+	e = &entry{
+		URL:          r.URL.String(),
+		Proto:        resp.Proto,
+		Status:       resp.Status,
+		StatusCode:   resp.StatusCode,
+		Header:       resp.Header.Clone(),
+		RequestTime:  requestTime,
+		ResponseTime: responseTime,
+	}
+
+	for _, name := range varyNames(resp.Header) {
+		if e.Vary == nil {
+			e.Vary = map[string][]string{}
+		}
+
+		e.Vary[name] = r.Header.Values(name)
+	}
+
+	return e
+}
+
+// matches returns true if the request headers nominated by Vary match the
+// ones of r, see RFC 9111, section 4.1.
+func (e *entry) matches(r *http.Request) (ok bool) {
+	for _, name := range varyNames(e.Header) {
+		if !slices.Equal(e.Vary[name], r.Header.Values(name)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// response creates a response from the entry with the specified body.
+func (e *entry) response(r *http.Request, body io.ReadCloser, size int64) (resp *http.Response) {
+	resp = &http.Response{
+		Status:        e.Status,
+		StatusCode:    e.StatusCode,
+		Proto:         e.Proto,
+		Header:        e.Header.Clone(),
+		Body:          body,
+		ContentLength: size,
+		Request:       r,
+	}
+
+	resp.ProtoMajor, resp.ProtoMinor, _ = http.ParseHTTPVersion(e.Proto)
+
+	return resp
+}
+
+// varyNames returns the canonical names of the headers listed in the Vary
+// header.
+func varyNames(h http.Header) (names []string) {
+	for _, v := range h.Values("Vary") {
+		for _, name := range splitList(v) {
+			names = append(names, http.CanonicalHeaderKey(name))
+		}
+	}
+
+	return names
+}
+
+// entryPath returns the path to the file of the entry for the URL u.
+func entryPath(dir, u string) (path string) {
+	sum := sha256.Sum256([]byte(u))
+
+	return filepath.Join(dir, hex.EncodeToString(sum[:]))
+}
+
+// readEntry opens the entry file at path.  body is positioned at the start
+// of the response body and size is its size.  If there is no entry, e is nil
+// and err is nil.
+func readEntry(path string) (e *entry, body *os.File, size int64, err error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil, 0, nil
+	} else if err != nil {
+		return nil, nil, 0, err
+	}
+
+	e, offset, err := decodeEntry(f)
+	if err != nil {
+		_ = f.Close()
+
+		return nil, nil, 0, fmt.Errorf("reading cache entry %s: %w", path, err)
+	}
+
+	fi, err := f.Stat()
+	if err == nil {
+		_, err = f.Seek(offset, io.SeekStart)
+	}
+
+	if err != nil {
+		_ = f.Close()
+
+		return nil, nil, 0, err
+	}
+
+	return e, f, fi.Size() - offset, nil
+}
+
+// decodeEntry decodes the entry from the first line of r.  offset is the
+// size of that line.
+func decodeEntry(r io.Reader) (e *entry, offset int64, err error) {
+	line, err := bufio.NewReader(r).ReadBytes('\n')
+	if err != nil {
+		return nil, 0, err
+	}
+
+	e = &entry{}
+	err = json.Unmarshal(line, e)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return e, int64(len(line)), nil
+}
+
+// createEntryFile creates a temporary file in dir and writes e to it.  The
+// body must be written after that and then the file must be committed with
+// commitEntryFile.
+func createEntryFile(dir string, e *entry) (f *os.File, err error) {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err = os.CreateTemp(dir, "tmp-")
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = f.Write(append(b, '\n'))
+	if err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// commitEntryFile closes f and moves it to path.
+func commitEntryFile(f *os.File, path string) (err error) {
+	err = f.Close()
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+
+	if err != nil {
+		_ = os.Remove(f.Name())
+	}
+
+	return err
+}
+
+// discardEntryFile closes and removes f.
+func discardEntryFile(f *os.File) {
+	_ = f.Close()
+	_ = os.Remove(f.Name())
+}
+
+// splitList splits a comma-separated header value and trims the elements.
+// Empty elements are skipped.
+func splitList(v string) (elems []string) {
+	for _, e := range strings.Split(v, ",") {
+		e = strings.TrimSpace(e)
+		if e != "" {
+			elems = append(elems, e)
+		}
+	}
+
+	return elems
+}
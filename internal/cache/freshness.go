@@ -0,0 +1,148 @@
+package cache
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cacheControl is the parsed Cache-Control header, directive names are in
+// lower case.  Directives without a value have an empty value.
+type cacheControl map[string]string
+
+// parseCacheControl parses the Cache-Control header fields of h.
+func parseCacheControl(h http.Header) (cc cacheControl) {
+	cc = cacheControl{}
+	for _, v := range h.Values("Cache-Control") {
+		for _, d := range strings.Split(v, ",") {
+			name, val, _ := strings.Cut(strings.TrimSpace(d), "=")
+			if name == "" {
+				continue
+			}
+
+			cc[strings.ToLower(name)] = strings.Trim(val, `"`)
+		}
+	}
+
+	return cc
+}
+
+// has returns true if the directive is present.
+func (cc cacheControl) has(name string) (ok bool) {
+	_, ok = cc[name]
+
+	return ok
+}
+
+// seconds returns the value of the delta-seconds directive.  ok is false if
+// the directive is absent or its value is invalid.
+func (cc cacheControl) seconds(name string) (d time.Duration, ok bool) {
+	v, ok := cc[name]
+	if !ok {
+		return 0, false
+	}
+
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+
+	return time.Duration(n) * time.Second, true
+}
+
+// heuristicStatuses are the status codes that are heuristically cacheable,
+// see RFC 9110, section 15.1.
+var heuristicStatuses = map[int]struct{}{
+	http.StatusOK:                   {},
+	http.StatusNonAuthoritativeInfo: {},
+	http.StatusNoContent:            {},
+	http.StatusMultipleChoices:      {},
+	http.StatusMovedPermanently:     {},
+	http.StatusPermanentRedirect:    {},
+	http.StatusNotFound:             {},
+	http.StatusMethodNotAllowed:     {},
+	http.StatusGone:                 {},
+	http.StatusRequestURITooLong:    {},
+	http.StatusNotImplemented:       {},
+}
+
+// heuristicFraction is the fraction of the time passed since Last-Modified
+// that is used as the heuristic freshness lifetime, see RFC 9111, section
+// 4.2.2.
+const heuristicFraction = 10
+
+// storable returns true if the response to a GET request can be stored in a
+// private cache, see RFC 9111, section 3.
+func storable(req *http.Request, resp *http.Response) (ok bool) {
+	if parseCacheControl(req.Header).has("no-store") {
+		return false
+	}
+
+	cc := parseCacheControl(resp.Header)
+	if cc.has("no-store") || resp.Header.Get("Vary") == "*" {
+		return false
+	}
+
+	if _, ok = heuristicStatuses[resp.StatusCode]; ok {
+		return true
+	}
+
+	_, ok = cc.seconds("max-age")
+
+	return ok || cc.has("public") || resp.Header.Get("Expires") != ""
+}
+
+// freshnessLifetime returns the freshness lifetime of the response with
+// header h, see RFC 9111, section 4.2.1.
+func freshnessLifetime(status int, h http.Header) (lifetime time.Duration) {
+	cc := parseCacheControl(h)
+	if maxAge, ok := cc.seconds("max-age"); ok {
+		return maxAge
+	}
+
+	date, err := http.ParseTime(h.Get("Date"))
+	if err != nil {
+		return 0
+	}
+
+	if v := h.Get("Expires"); v != "" {
+		// Invalid Expires values mean that the response is already expired.
+		expires, expErr := http.ParseTime(v)
+		if expErr != nil || expires.Before(date) {
+			return 0
+		}
+
+		return expires.Sub(date)
+	}
+
+	if _, ok := heuristicStatuses[status]; !ok {
+		return 0
+	}
+
+	lastModified, err := http.ParseTime(h.Get("Last-Modified"))
+	if err != nil || lastModified.After(date) {
+		return 0
+	}
+
+	return date.Sub(lastModified) / heuristicFraction
+}
+
+// currentAge returns the current age of the stored response, see RFC 9111,
+// section 4.2.3.
+func currentAge(e *entry, now time.Time) (age time.Duration) {
+	var apparentAge time.Duration
+	if date, err := http.ParseTime(e.Header.Get("Date")); err == nil {
+		apparentAge = max(0, e.ResponseTime.Sub(date))
+	}
+
+	var ageValue time.Duration
+	if n, err := strconv.ParseInt(e.Header.Get("Age"), 10, 64); err == nil && n > 0 {
+		ageValue = time.Duration(n) * time.Second
+	}
+
+	responseDelay := e.ResponseTime.Sub(e.RequestTime)
+	correctedInitialAge := max(apparentAge, ageValue+responseDelay)
+
+	return correctedInitialAge + now.Sub(e.ResponseTime)
+}
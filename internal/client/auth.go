@@ -0,0 +1,268 @@
+package client
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/ameshkov/gocurl/internal/client/auth"
+	"github.com/ameshkov/gocurl/internal/config"
+	"github.com/ameshkov/gocurl/internal/output"
+)
+
+// maxAuthBodyDrain is the maximum number of bytes of the 401 response body
+// that are read so that the connection could be reused.
+const maxAuthBodyDrain = 64 << 10
+
+// authTransport is a Transport that answers the authentication challenges of
+// the server, see --digest, --ntlm, --negotiate and --anyauth.  The request is
+// re-sent with its body replayed.
+type authTransport struct {
+	Transport
+
+	out *output.Output
+
+	// user are the credentials from --user or the URL.  They are always set
+	// for Digest, NTLM and --anyauth.
+	user *url.Userinfo
+
+	// scheme is the authentication scheme, see config.Config.AuthScheme.
+	scheme string
+}
+
+// type check
+var _ Transport = (*authTransport)(nil)
+
+// newAuthTransport wraps base so that it authenticates with the scheme
+// configured by cfg.
+func newAuthTransport(base Transport, cfg *config.Config, out *output.Output) (t *authTransport) {
+	return &authTransport{
+		Transport: base,
+		out:       out,
+		user:      cfg.User,
+		scheme:    cfg.AuthScheme,
+	}
+}
+
+// noCredentialsKey is the context key of the requests that must not be sent
+// with the credentials, e.g. redirects to other origins.
+type noCredentialsKey struct{}
+
+// withoutCredentials returns ctx that marks the request as the one that must
+// not be sent with the credentials.
+func withoutCredentials(ctx context.Context) (res context.Context) {
+	return context.WithValue(ctx, noCredentialsKey{}, true)
+}
+
+// RoundTrip implements the http.RoundTripper interface for *authTransport.
+func (t *authTransport) RoundTrip(r *http.Request) (resp *http.Response, err error) {
+	resp, err = t.Transport.RoundTrip(r)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	if r.Header.Get("Authorization") != "" || r.Context().Value(noCredentialsKey{}) != nil {
+		return resp, nil
+	}
+
+	switch t.scheme {
+	case "anyauth":
+		return t.anyAuth(r, resp)
+	case "negotiate":
+		return t.negotiate(r, resp)
+	case "ntlm":
+		return t.ntlm(r, resp)
+	default:
+		return t.digest(r, resp)
+	}
+}
+
+// anyAuth answers the strongest of the challenges of resp to r that can be
+// answered.  Like in curl, Negotiate is preferred to Digest, Digest to NTLM and
+// NTLM to Basic.
+func (t *authTransport) anyAuth(r *http.Request, resp *http.Response) (res *http.Response, err error) {
+	// Every method returns resp as is if it cannot answer the challenge.
+	answers := []func(r *http.Request, resp *http.Response) (res *http.Response, err error){
+		t.negotiate,
+		t.digest,
+	}
+
+	// The NTLM handshake needs a persistent connection, which multiplexed
+	// HTTP/2 and HTTP/3 streams don't provide.
+	if resp.ProtoMajor == 1 {
+		answers = append(answers, t.ntlm)
+	}
+
+	for _, answer := range answers {
+		res, err = answer(r, resp)
+		if err != nil || res != resp {
+			return res, err
+		}
+	}
+
+	if !auth.HasBasic(resp.Header.Values("WWW-Authenticate")) {
+		return resp, nil
+	}
+
+	drainBody(resp)
+
+	t.out.Debug("Answering the Basic challenge")
+
+	password, _ := t.user.Password()
+	credentials := base64.StdEncoding.EncodeToString([]byte(t.user.Username() + ":" + password))
+
+	return t.resend(r, "Basic "+credentials)
+}
+
+// negotiate answers the Negotiate challenge of resp to r with the Kerberos
+// ticket for the host of r.  The credentials from --user are not used.
+func (t *authTransport) negotiate(r *http.Request, resp *http.Response) (res *http.Response, err error) {
+	if !auth.HasNegotiate(resp.Header.Values("WWW-Authenticate")) {
+		return resp, nil
+	}
+
+	authorization, err := auth.Negotiate(r.URL.Hostname())
+	if err != nil {
+		t.out.Debug("Cannot answer the Negotiate challenge: %v", err)
+
+		return resp, nil
+	}
+
+	drainBody(resp)
+
+	t.out.Debug("Answering the Negotiate challenge for HTTP/%s", r.URL.Hostname())
+
+	return t.resend(r, authorization)
+}
+
+// digest answers the Digest challenge of resp to r.
+func (t *authTransport) digest(r *http.Request, resp *http.Response) (res *http.Response, err error) {
+	d, ok, err := auth.ParseDigest(resp.Header.Values("WWW-Authenticate"))
+	if !ok {
+		return resp, nil
+	} else if err != nil {
+		t.out.Debug("Cannot answer the authentication challenge: %v", err)
+
+		return resp, nil
+	}
+
+	drainBody(resp)
+
+	var body []byte
+	if d.QOP == "auth-int" {
+		body, err = readReplayBody(r)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	password, _ := t.user.Password()
+	authorization, err := d.Authorize(r.Method, r.URL.RequestURI(), t.user.Username(), password, body)
+	if err != nil {
+		return nil, fmt.Errorf("digest authentication: %w", err)
+	}
+
+	t.out.Debug("Answering the Digest challenge of realm %q", d.Realm)
+
+	return t.resend(r, authorization)
+}
+
+// ntlm performs the NTLM handshake for r that got resp.  The negotiate and
+// the authenticate messages must be sent over the same connection, this is
+// why NTLM requires HTTP/1.1 where the idle connection is reused.
+func (t *authTransport) ntlm(r *http.Request, resp *http.Response) (res *http.Response, err error) {
+	_, ok, err := auth.ParseNTLM(resp.Header.Values("WWW-Authenticate"))
+	if !ok || err != nil {
+		return resp, nil
+	}
+
+	drainBody(resp)
+
+	t.out.Debug("Starting the NTLM handshake")
+
+	resp, err = t.resend(r, auth.NTLMNegotiate())
+	if err != nil {
+		return nil, err
+	}
+
+	challenge, ok, err := auth.ParseNTLM(resp.Header.Values("WWW-Authenticate"))
+	if err != nil {
+		t.out.Debug("Cannot answer the NTLM challenge: %v", err)
+
+		return resp, nil
+	} else if resp.StatusCode != http.StatusUnauthorized || !ok || len(challenge) == 0 {
+		return resp, nil
+	}
+
+	conn := ResponseConn(resp)
+	drainBody(resp)
+
+	password, _ := t.user.Password()
+	authorization, err := auth.NTLMAuthenticate(challenge, t.user.Username(), password)
+	if err != nil {
+		return nil, fmt.Errorf("ntlm authentication: %w", err)
+	}
+
+	resp, err = t.resend(r, authorization)
+	if err == nil && ResponseConn(resp) != conn {
+		t.out.Debug("NTLM handshake was continued on a new connection, the server closed the previous one")
+	}
+
+	return resp, err
+}
+
+// resend sends the replayed r with the specified Authorization header.
+func (t *authTransport) resend(r *http.Request, authorization string) (resp *http.Response, err error) {
+	r, err = replayRequest(r)
+	if err != nil {
+		return nil, err
+	}
+
+	r.Header.Set("Authorization", authorization)
+
+	return t.Transport.RoundTrip(r)
+}
+
+// drainBody reads the rest of the body of the challenge response and closes
+// it so that the connection can be reused.
+func drainBody(resp *http.Response) {
+	_, _ = io.CopyN(io.Discard, resp.Body, maxAuthBodyDrain)
+	_ = resp.Body.Close()
+}
+
+// replayRequest returns the copy of r with its body replayed so that it can be
+// re-sent.
+func replayRequest(r *http.Request) (next *http.Request, err error) {
+	next = r.Clone(r.Context())
+	next.Header = r.Header.Clone()
+
+	switch {
+	case r.GetBody != nil:
+		next.Body, err = r.GetBody()
+		if err != nil {
+			return nil, fmt.Errorf("re-sending request body: %w", err)
+		}
+	case r.Body != nil && r.Body != http.NoBody:
+		return nil, fmt.Errorf("cannot re-send a request body that cannot be replayed")
+	}
+
+	return next, nil
+}
+
+// readReplayBody returns the body of r as it was sent.
+func readReplayBody(r *http.Request) (body []byte, err error) {
+	if r.GetBody == nil {
+		return nil, nil
+	}
+
+	rc, err := r.GetBody()
+	if err != nil {
+		return nil, fmt.Errorf("reading request body: %w", err)
+	}
+	defer func() { _ = rc.Close() }()
+
+	return io.ReadAll(rc)
+}
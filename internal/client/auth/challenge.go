@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"strings"
+)
+
+// challengeParams parses the auth-params of the challenge with scheme from the
+// WWW-Authenticate header value v, see RFC 9110, section 11.6.1.  The names
+// of the parameters are lowercased.  ok is false if v has no such challenge.
+func challengeParams(v, scheme string) (params map[string]string, ok bool) {
+	for {
+		v = strings.TrimLeft(v, " \t,")
+		if v == "" {
+			return nil, false
+		}
+
+		var name string
+		name, v, _ = strings.Cut(v, " ")
+		if strings.EqualFold(name, scheme) {
+			return parseParams(v), true
+		}
+
+		// Skip the parameters of the other scheme.  The next challenge starts
+		// after a comma with a token that is not followed by "=".
+		v = skipParams(v)
+	}
+}
+
+// parseParams parses the comma-separated list of name=value pairs from s
+// until the end of s or the start of the next challenge.
+func parseParams(s string) (params map[string]string) {
+	params = map[string]string{}
+	for {
+		s = strings.TrimLeft(s, " \t,")
+
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 || strings.ContainsAny(s[:eq], " \t,") {
+			return params
+		}
+
+		name := strings.ToLower(strings.TrimSpace(s[:eq]))
+		s = strings.TrimLeft(s[eq+1:], " \t")
+
+		var value string
+		value, s = readValue(s)
+		params[name] = value
+	}
+}
+
+// skipParams returns s without the leading parameters of a challenge.
+func skipParams(s string) (rest string) {
+	for {
+		s = strings.TrimLeft(s, " \t,")
+
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 || strings.ContainsAny(s[:eq], " \t,") {
+			// Either the token68 or the next challenge.
+			if end := strings.IndexByte(s, ','); end >= 0 && !strings.Contains(s[:end], " ") {
+				return s[end+1:]
+			}
+
+			return s
+		}
+
+		_, s = readValue(strings.TrimLeft(s[eq+1:], " \t"))
+	}
+}
+
+// readValue reads the token or the quoted string from the start of s.
+func readValue(s string) (value, rest string) {
+	if !strings.HasPrefix(s, `"`) {
+		end := strings.IndexByte(s, ',')
+		if end < 0 {
+			return strings.TrimSpace(s), ""
+		}
+
+		return strings.TrimSpace(s[:end]), s[end+1:]
+	}
+
+	b := &strings.Builder{}
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				b.WriteByte(s[i])
+			}
+		case '"':
+			return b.String(), s[i+1:]
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String(), ""
+}
+
+// HasBasic returns true if the WWW-Authenticate header values offer the Basic
+// scheme, see RFC 7617.
+func HasBasic(values []string) (ok bool) {
+	for _, v := range values {
+		if _, ok = challengeParams(v, "Basic"); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// schemeData returns the data that follows scheme in the WWW-Authenticate
+// header values, e.g. the token68 of NTLM and Negotiate.  ok is false if
+// there is no challenge with scheme.
+func schemeData(values []string, scheme string) (data string, ok bool) {
+	for _, v := range values {
+		name, rest, _ := strings.Cut(strings.TrimSpace(v), " ")
+		if strings.EqualFold(name, scheme) {
+			return strings.TrimSpace(rest), true
+		}
+	}
+
+	return "", false
+}
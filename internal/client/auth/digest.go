@@ -0,0 +1,180 @@
+// Package auth implements the HTTP authentication schemes that require
+// answering the challenge of the server, see --digest, --ntlm and
+// --negotiate.
+package auth
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"strings"
+)
+
+// Digest is the Digest authentication challenge, see RFC 7616.
+type Digest struct {
+	// Realm is the protection space of the server.
+	Realm string
+
+	// Nonce is the server-specified nonce.
+	Nonce string
+
+	// Opaque is the string that must be returned unchanged.
+	Opaque string
+
+	// Algorithm is the hash algorithm, e.g. "MD5" or "SHA-256-sess".
+	Algorithm string
+
+	// QOP is the selected quality of protection, "auth", "auth-int", or
+	// empty for the legacy RFC 2069 digest.
+	QOP string
+}
+
+// ParseDigest parses the Digest challenge from the WWW-Authenticate header
+// values.  ok is false if there is no Digest challenge.
+func ParseDigest(values []string) (d *Digest, ok bool, err error) {
+	for _, v := range values {
+		params, found := challengeParams(v, "Digest")
+		if !found {
+			continue
+		}
+
+		d = &Digest{
+			Realm:     params["realm"],
+			Nonce:     params["nonce"],
+			Opaque:    params["opaque"],
+			Algorithm: params["algorithm"],
+		}
+
+		if d.Nonce == "" {
+			return nil, true, fmt.Errorf("digest challenge without nonce")
+		}
+
+		if d.Algorithm == "" {
+			d.Algorithm = "MD5"
+		}
+
+		if _, err = d.hash(); err != nil {
+			return nil, true, err
+		}
+
+		if qop, hasQOP := params["qop"]; hasQOP {
+			d.QOP, err = selectQOP(qop)
+			if err != nil {
+				return nil, true, err
+			}
+		}
+
+		return d, true, nil
+	}
+
+	return nil, false, nil
+}
+
+// selectQOP selects the quality of protection from the comma-separated list
+// offered by the server.  "auth" is preferred.
+func selectQOP(offered string) (qop string, err error) {
+	for _, q := range strings.Split(offered, ",") {
+		switch q = strings.TrimSpace(q); q {
+		case "auth":
+			return q, nil
+		case "auth-int":
+			qop = q
+		}
+	}
+
+	if qop == "" {
+		return "", fmt.Errorf("unsupported digest qop %q", offered)
+	}
+
+	return qop, nil
+}
+
+// Authorize returns the value of the Authorization header for the request
+// with method to uri (the request target, i.e. the path with the query).  body
+// is only used for the "auth-int" quality of protection.
+func (d *Digest) Authorize(method, uri, user, password string, body []byte) (authorization string, err error) {
+	b := make([]byte, 16)
+	_, err = rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("generating cnonce: %w", err)
+	}
+
+	return d.authorize(method, uri, user, password, body, hex.EncodeToString(b))
+}
+
+// authorize is like Authorize but uses the specified client nonce.
+func (d *Digest) authorize(method, uri, user, password string, body []byte, cnonce string) (authorization string, err error) {
+	newHash, err := d.hash()
+	if err != nil {
+		return "", err
+	}
+
+	h := func(parts ...string) (s string) {
+		hh := newHash()
+		_, _ = hh.Write([]byte(strings.Join(parts, ":")))
+
+		return hex.EncodeToString(hh.Sum(nil))
+	}
+
+	// The nonce is only used once so the count is always 1.
+	const nc = "00000001"
+
+	ha1 := h(user, d.Realm, password)
+	if strings.HasSuffix(strings.ToLower(d.Algorithm), "-sess") {
+		ha1 = h(ha1, d.Nonce, cnonce)
+	}
+
+	ha2 := h(method, uri)
+	if d.QOP == "auth-int" {
+		ha2 = h(method, uri, h(string(body)))
+	}
+
+	var response string
+	if d.QOP == "" {
+		response = h(ha1, d.Nonce, ha2)
+	} else {
+		response = h(ha1, d.Nonce, nc, cnonce, d.QOP, ha2)
+	}
+
+	sb := &strings.Builder{}
+	_, _ = fmt.Fprintf(
+		sb,
+		`Digest username=%s, realm=%s, nonce=%s, uri=%s, algorithm=%s, response="%s"`,
+		quote(user),
+		quote(d.Realm),
+		quote(d.Nonce),
+		quote(uri),
+		d.Algorithm,
+		response,
+	)
+
+	if d.QOP != "" {
+		_, _ = fmt.Fprintf(sb, `, qop=%s, nc=%s, cnonce="%s"`, d.QOP, nc, cnonce)
+	}
+
+	if d.Opaque != "" {
+		_, _ = fmt.Fprintf(sb, ", opaque=%s", quote(d.Opaque))
+	}
+
+	return sb.String(), nil
+}
+
+// hash returns the constructor of the hash of d.Algorithm.
+func (d *Digest) hash() (newHash func() (h hash.Hash), err error) {
+	switch strings.ToUpper(strings.TrimSuffix(strings.ToLower(d.Algorithm), "-sess")) {
+	case "MD5":
+		return md5.New, nil
+	case "SHA-256":
+		return sha256.New, nil
+	default:
+		return nil, fmt.Errorf("unsupported digest algorithm %q", d.Algorithm)
+	}
+}
+
+// quote returns s as a quoted string, see RFC 9110, section 5.6.4.
+func quote(s string) (q string) {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
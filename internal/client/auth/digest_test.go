@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDigest_authorize(t *testing.T) {
+	// The example from RFC 2617, section 3.5, with another challenge before
+	// the Digest one.
+	d, ok, err := ParseDigest([]string{
+		`Basic realm="basic, realm", Digest realm="testrealm@host.com", ` +
+			`qop="auth,auth-int", nonce="dcd98b7102dd2f0e8b11d0f600bfb0c093", ` +
+			`opaque="5ccc069c403ebaf9f0171e9517f40e41"`,
+	})
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "testrealm@host.com", d.Realm)
+	require.Equal(t, "auth", d.QOP)
+	require.Equal(t, "MD5", d.Algorithm)
+
+	authorization, err := d.authorize("GET", "/dir/index.html", "Mufasa", "Circle Of Life", nil, "0a4f113b")
+	require.NoError(t, err)
+	require.Equal(
+		t,
+		`Digest username="Mufasa", realm="testrealm@host.com", `+
+			`nonce="dcd98b7102dd2f0e8b11d0f600bfb0c093", uri="/dir/index.html", `+
+			`algorithm=MD5, response="6629fae49393a05397450978507c4ef1", `+
+			`qop=auth, nc=00000001, cnonce="0a4f113b", `+
+			`opaque="5ccc069c403ebaf9f0171e9517f40e41"`,
+		authorization,
+	)
+
+	_, ok, err = ParseDigest([]string{`Basic realm="test"`})
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	_, ok, err = ParseDigest([]string{`Digest realm="test", nonce="n", algorithm=SHA-512`})
+	require.Error(t, err)
+	require.True(t, ok)
+}
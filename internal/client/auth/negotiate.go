@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+
+	krbclient "github.com/jcmturner/gokrb5/v8/client"
+	krbconfig "github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+)
+
+// HasNegotiate returns true if the WWW-Authenticate header values offer the
+// Negotiate scheme, see RFC 4559.
+func HasNegotiate(values []string) (ok bool) {
+	_, ok = schemeData(values, "Negotiate")
+
+	return ok
+}
+
+// Negotiate returns the value of the Authorization header with the SPNEGO
+// token for the HTTP service on host.  The service ticket is acquired with the
+// ticket-granting ticket from the system credential cache, so kinit must be
+// run first.
+func Negotiate(host string) (authorization string, err error) {
+	krbCfg, err := krbconfig.Load(krb5ConfPath())
+	if err != nil {
+		return "", fmt.Errorf("loading kerberos configuration: %w", err)
+	}
+
+	ccachePath, err := krb5CCachePath()
+	if err != nil {
+		return "", err
+	}
+
+	ccache, err := credentials.LoadCCache(ccachePath)
+	if err != nil {
+		return "", fmt.Errorf("loading kerberos credential cache: %w", err)
+	}
+
+	cl, err := krbclient.NewFromCCache(ccache, krbCfg)
+	if err != nil {
+		return "", fmt.Errorf("creating kerberos client: %w", err)
+	}
+	defer cl.Destroy()
+
+	token, err := spnego.SPNEGOClient(cl, "HTTP/"+host).InitSecContext()
+	if err != nil {
+		return "", fmt.Errorf("acquiring service ticket: %w", err)
+	}
+
+	b, err := token.Marshal()
+	if err != nil {
+		return "", fmt.Errorf("encoding spnego token: %w", err)
+	}
+
+	return "Negotiate " + base64.StdEncoding.EncodeToString(b), nil
+}
+
+// krb5ConfPath returns the path of the Kerberos configuration file.
+func krb5ConfPath() (p string) {
+	if p = os.Getenv("KRB5_CONFIG"); p != "" {
+		return p
+	}
+
+	return "/etc/krb5.conf"
+}
+
+// krb5CCachePath returns the path of the Kerberos credential cache file.  Only
+// the FILE credential cache type is supported.
+func krb5CCachePath() (p string, err error) {
+	name := os.Getenv("KRB5CCNAME")
+	if name == "" {
+		return fmt.Sprintf("/tmp/krb5cc_%d", os.Getuid()), nil
+	}
+
+	typ, p, found := strings.Cut(name, ":")
+	if !found {
+		return name, nil
+	} else if typ != "FILE" {
+		return "", fmt.Errorf("unsupported kerberos credential cache type %q", typ)
+	}
+
+	return p, nil
+}
@@ -0,0 +1,31 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiate(t *testing.T) {
+	require.True(t, HasNegotiate([]string{`Basic realm="test"`, "Negotiate"}))
+	require.False(t, HasNegotiate([]string{"NTLM"}))
+
+	dir := t.TempDir()
+	krb5Conf := filepath.Join(dir, "krb5.conf")
+	err := os.WriteFile(krb5Conf, []byte("[libdefaults]\n  default_realm = EXAMPLE.ORG\n"), 0o600)
+	require.NoError(t, err)
+
+	t.Setenv("KRB5_CONFIG", krb5Conf)
+	t.Setenv("KRB5CCNAME", "FILE:"+filepath.Join(dir, "ccache"))
+
+	// There is no ticket without kinit.
+	_, err = Negotiate("example.org")
+	require.ErrorContains(t, err, "credential cache")
+
+	t.Setenv("KRB5CCNAME", "KEYRING:persistent:1000")
+
+	_, err = Negotiate("example.org")
+	require.ErrorContains(t, err, "unsupported kerberos credential cache type")
+}
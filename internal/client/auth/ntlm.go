@@ -0,0 +1,229 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"golang.org/x/crypto/md4"
+)
+
+// ntlmSignature is the signature every NTLM message starts with.
+const ntlmSignature = "NTLMSSP\x00"
+
+// NTLM message types, see MS-NLMP, section 2.2.1.
+const (
+	ntlmNegotiate    uint32 = 1
+	ntlmChallenge    uint32 = 2
+	ntlmAuthenticate uint32 = 3
+)
+
+// NTLM negotiate flags, see MS-NLMP, section 2.2.2.5.
+const (
+	ntlmFlagUnicode            uint32 = 0x00000001
+	ntlmFlagOEM                uint32 = 0x00000002
+	ntlmFlagRequestTarget      uint32 = 0x00000004
+	ntlmFlagNTLM               uint32 = 0x00000200
+	ntlmFlagAlwaysSign         uint32 = 0x00008000
+	ntlmFlagExtendedSessionSec uint32 = 0x00080000
+)
+
+// ntlmNegotiateFlags are the flags of the negotiate message.
+const ntlmNegotiateFlags = ntlmFlagUnicode |
+	ntlmFlagOEM |
+	ntlmFlagRequestTarget |
+	ntlmFlagNTLM |
+	ntlmFlagAlwaysSign |
+	ntlmFlagExtendedSessionSec
+
+// ntlmAvTimestamp is the AvId of the server timestamp in the target info, see
+// MS-NLMP, section 2.2.2.1.
+const ntlmAvTimestamp = 7
+
+// ntlmAuthenticateHeaderLen is the length of the fixed part of the
+// authenticate message without the version and the MIC.
+const ntlmAuthenticateHeaderLen = 64
+
+// filetimeEpochDiff is the number of 100-nanosecond intervals between
+// January 1, 1601, the Windows FILETIME epoch, and the Unix epoch.
+const filetimeEpochDiff = 116444736000000000
+
+// NTLMNegotiate returns the value of the Authorization header with the NTLM
+// negotiate message that starts the handshake.
+func NTLMNegotiate() (authorization string) {
+	msg := make([]byte, 32)
+	copy(msg, ntlmSignature)
+	binary.LittleEndian.PutUint32(msg[8:], ntlmNegotiate)
+	binary.LittleEndian.PutUint32(msg[12:], ntlmNegotiateFlags)
+
+	return "NTLM " + base64.StdEncoding.EncodeToString(msg)
+}
+
+// ParseNTLM returns the NTLM challenge message from the WWW-Authenticate
+// header values.  ok is false if the server doesn't offer NTLM.  challenge is
+// empty if the server offers NTLM but hasn't sent the challenge yet.
+func ParseNTLM(values []string) (challenge []byte, ok bool, err error) {
+	data, ok := schemeData(values, "NTLM")
+	if !ok || data == "" {
+		return nil, ok, nil
+	}
+
+	challenge, err = base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, true, fmt.Errorf("decoding ntlm challenge: %w", err)
+	}
+
+	return challenge, true, nil
+}
+
+// NTLMAuthenticate returns the value of the Authorization header with the
+// NTLMv2 authenticate message that answers challenge.  user may contain the
+// domain, i.e. "DOMAIN\user".
+func NTLMAuthenticate(challenge []byte, user, password string) (authorization string, err error) {
+	serverChallenge, targetInfo, err := parseNTLMChallenge(challenge)
+	if err != nil {
+		return "", err
+	}
+
+	domain, user, found := strings.Cut(user, `\`)
+	if !found {
+		domain, user = "", domain
+	}
+
+	clientChallenge := make([]byte, 8)
+	_, err = rand.Read(clientChallenge)
+	if err != nil {
+		return "", fmt.Errorf("generating client challenge: %w", err)
+	}
+
+	timestamp, hasTimestamp := ntlmTimestamp(targetInfo)
+	if !hasTimestamp {
+		timestamp = uint64(time.Now().UnixNano()/100 + filetimeEpochDiff)
+	}
+
+	nt, lm := ntlmV2Response(user, domain, password, serverChallenge, clientChallenge, timestamp, targetInfo)
+	if hasTimestamp {
+		// The LMv2 response must not be sent when the server provides the
+		// timestamp, see MS-NLMP, section 3.1.5.1.2.
+		lm = make([]byte, 24)
+	}
+
+	fields := [][]byte{lm, nt, utf16LE(domain), utf16LE(user), nil, nil}
+
+	msg := make([]byte, ntlmAuthenticateHeaderLen)
+	copy(msg, ntlmSignature)
+	binary.LittleEndian.PutUint32(msg[8:], ntlmAuthenticate)
+
+	for i, f := range fields {
+		putSecurityBuffer(msg[12+8*i:], len(f), len(msg))
+		msg = append(msg, f...)
+	}
+
+	binary.LittleEndian.PutUint32(msg[60:], ntlmNegotiateFlags&^ntlmFlagOEM)
+
+	return "NTLM " + base64.StdEncoding.EncodeToString(msg), nil
+}
+
+// parseNTLMChallenge returns the server challenge and the target info from the
+// NTLM challenge message, see MS-NLMP, section 2.2.1.2.
+func parseNTLMChallenge(msg []byte) (serverChallenge, targetInfo []byte, err error) {
+	if len(msg) < 48 || !bytes.HasPrefix(msg, []byte(ntlmSignature)) {
+		return nil, nil, fmt.Errorf("invalid ntlm challenge message")
+	}
+
+	if t := binary.LittleEndian.Uint32(msg[8:]); t != ntlmChallenge {
+		return nil, nil, fmt.Errorf("unexpected ntlm message type %d", t)
+	}
+
+	l := int(binary.LittleEndian.Uint16(msg[40:]))
+	off := int(binary.LittleEndian.Uint32(msg[44:]))
+	if off+l > len(msg) {
+		return nil, nil, fmt.Errorf("invalid ntlm target info")
+	}
+
+	return msg[24:32], msg[off : off+l], nil
+}
+
+// ntlmTimestamp returns the server timestamp from the target info.
+func ntlmTimestamp(targetInfo []byte) (ts uint64, ok bool) {
+	for len(targetInfo) >= 4 {
+		id := binary.LittleEndian.Uint16(targetInfo)
+		l := int(binary.LittleEndian.Uint16(targetInfo[2:]))
+		if len(targetInfo) < 4+l {
+			return 0, false
+		}
+
+		if id == ntlmAvTimestamp && l == 8 {
+			return binary.LittleEndian.Uint64(targetInfo[4:]), true
+		}
+
+		targetInfo = targetInfo[4+l:]
+	}
+
+	return 0, false
+}
+
+// ntlmV2Response computes the NTLMv2 and LMv2 responses, see MS-NLMP, section
+// 3.3.2.
+func ntlmV2Response(
+	user string,
+	domain string,
+	password string,
+	serverChallenge []byte,
+	clientChallenge []byte,
+	timestamp uint64,
+	targetInfo []byte,
+) (nt, lm []byte) {
+	// MD4 is deprecated, but the NT hash is defined with it.
+	h := md4.New()
+	_, _ = h.Write(utf16LE(password))
+	ntHash := h.Sum(nil)
+
+	key := hmacMD5(ntHash, utf16LE(strings.ToUpper(user)+domain))
+
+	blob := []byte{1, 1, 0, 0, 0, 0, 0, 0}
+	blob = binary.LittleEndian.AppendUint64(blob, timestamp)
+	blob = append(blob, clientChallenge...)
+	blob = append(blob, 0, 0, 0, 0)
+	blob = append(blob, targetInfo...)
+	blob = append(blob, 0, 0, 0, 0)
+
+	proof := hmacMD5(key, serverChallenge, blob)
+	lm = append(hmacMD5(key, serverChallenge, clientChallenge), clientChallenge...)
+
+	return append(proof, blob...), lm
+}
+
+// hmacMD5 returns the HMAC-MD5 of the concatenated data.
+func hmacMD5(key []byte, data ...[]byte) (sum []byte) {
+	h := hmac.New(md5.New, key)
+	for _, d := range data {
+		_, _ = h.Write(d)
+	}
+
+	return h.Sum(nil)
+}
+
+// utf16LE encodes s as UTF-16LE.
+func utf16LE(s string) (b []byte) {
+	for _, c := range utf16.Encode([]rune(s)) {
+		b = binary.LittleEndian.AppendUint16(b, c)
+	}
+
+	return b
+}
+
+// putSecurityBuffer writes the security buffer with the field of length l at
+// offset off to b.
+func putSecurityBuffer(b []byte, l, off int) {
+	binary.LittleEndian.PutUint16(b, uint16(l))
+	binary.LittleEndian.PutUint16(b[2:], uint16(l))
+	binary.LittleEndian.PutUint32(b[4:], uint32(off))
+}
@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNTLMV2Response(t *testing.T) {
+	// The example from MS-NLMP, section 4.2.4.
+	serverChallenge, _ := hex.DecodeString("0123456789abcdef")
+	clientChallenge, _ := hex.DecodeString("aaaaaaaaaaaaaaaa")
+	targetInfo, _ := hex.DecodeString(
+		"02000c0044006f006d00610069006e00" +
+			"01000c0053006500720076006500720000000000",
+	)
+
+	nt, lm := ntlmV2Response("User", "Domain", "Password", serverChallenge, clientChallenge, 0, targetInfo)
+	require.Equal(t, "68cd0ab851e51c96aabc927bebef6a1c", hex.EncodeToString(nt[:16]))
+	require.Equal(t, "86c35097ac9cec102554764a57cccc19aaaaaaaaaaaaaaaa", hex.EncodeToString(lm))
+}
+
+func TestNTLMAuthenticate(t *testing.T) {
+	challenge, ok, err := ParseNTLM([]string{`Basic realm="test"`, "NTLM"})
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Empty(t, challenge)
+
+	// The challenge message from MS-NLMP, section 4.2.4.3, with a zero
+	// version.
+	msg, _ := hex.DecodeString(
+		"4e544c4d53535000020000000c000c0038000000338a82e2" +
+			"0123456789abcdef00000000000000002400240044000000" +
+			"0000000000000000530065007200760065007200" +
+			"02000c0044006f006d00610069006e0001000c005300650072007600650072000000000000000000",
+	)
+
+	challenge, ok, err = ParseNTLM([]string{"NTLM " + base64.StdEncoding.EncodeToString(msg)})
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	authorization, err := NTLMAuthenticate(challenge, `Domain\User`, "Password")
+	require.NoError(t, err)
+
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(authorization, "NTLM "))
+	require.NoError(t, err)
+	require.Contains(t, string(data), string(utf16LE("Domain")))
+	require.Contains(t, string(data), string(utf16LE("User")))
+
+	_, err = NTLMAuthenticate([]byte("invalid"), "User", "Password")
+	require.Error(t, err)
+}
@@ -0,0 +1,41 @@
+package client
+
+import (
+	"net/http"
+
+	"github.com/ameshkov/gocurl/internal/cache"
+	"github.com/ameshkov/gocurl/internal/output"
+)
+
+// cacheTransport is a Transport that uses the local HTTP cache for http and
+// https URLs, see --cache-dir.
+type cacheTransport struct {
+	Transport
+
+	cache *cache.Transport
+}
+
+// type check
+var _ Transport = (*cacheTransport)(nil)
+
+// newCacheTransport wraps base with the HTTP cache stored in dir.
+func newCacheTransport(base Transport, dir string, out *output.Output) (rt Transport, err error) {
+	c, err := cache.NewTransport(base, dir, out)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cacheTransport{
+		Transport: base,
+		cache:     c,
+	}, nil
+}
+
+// RoundTrip implements the http.RoundTripper interface for *cacheTransport.
+func (t *cacheTransport) RoundTrip(r *http.Request) (resp *http.Response, err error) {
+	if r.URL.Scheme != "http" && r.URL.Scheme != "https" {
+		return t.Transport.RoundTrip(r)
+	}
+
+	return t.cache.RoundTrip(r)
+}
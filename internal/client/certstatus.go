@@ -0,0 +1,55 @@
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// ErrCertStatus is returned when --cert-status is used and the server didn't
+// staple a valid OCSP response with the good status.
+var ErrCertStatus = errors.New("invalid certificate status")
+
+// verifyCertStatus is a function for tls.Config.VerifyConnection that checks
+// the OCSP response stapled by the server, see --cert-status.  The signature
+// of the response is checked when the issuer of the server certificate is
+// known, i.e. it is either in the chain or the certificate is a trusted
+// self-signed one.
+func verifyCertStatus(cs tls.ConnectionState) (err error) {
+	if len(cs.PeerCertificates) == 0 {
+		return fmt.Errorf("%w: no server certificate", ErrCertStatus)
+	}
+
+	if len(cs.OCSPResponse) == 0 {
+		return fmt.Errorf("%w: no stapled ocsp response", ErrCertStatus)
+	}
+
+	chain := cs.PeerCertificates
+	if len(cs.VerifiedChains) > 0 {
+		chain = cs.VerifiedChains[0]
+	}
+
+	var issuer *x509.Certificate
+	if len(chain) > 1 {
+		issuer = chain[1]
+	} else if len(cs.VerifiedChains) > 0 {
+		issuer = chain[0]
+	}
+
+	resp, err := ocsp.ParseResponseForCert(cs.OCSPResponse, chain[0], issuer)
+	if err != nil {
+		return fmt.Errorf("%w: parsing ocsp response: %w", ErrCertStatus, err)
+	}
+
+	switch resp.Status {
+	case ocsp.Good:
+		return nil
+	case ocsp.Revoked:
+		return fmt.Errorf("%w: certificate revoked at %s", ErrCertStatus, resp.RevokedAt)
+	default:
+		return fmt.Errorf("%w: certificate status unknown", ErrCertStatus)
+	}
+}
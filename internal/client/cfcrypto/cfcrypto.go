@@ -66,11 +66,26 @@ func Handshake(
 
 	// Copying the original tls config fields to ECH-enabled one.
 	conf := &ctls.Config{
-		ServerName:         tlsConfig.ServerName,
-		MinVersion:         tlsConfig.MinVersion,
-		MaxVersion:         tlsConfig.MaxVersion,
-		InsecureSkipVerify: tlsConfig.InsecureSkipVerify,
-		NextProtos:         tlsConfig.NextProtos,
+		ServerName:            tlsConfig.ServerName,
+		MinVersion:            tlsConfig.MinVersion,
+		MaxVersion:            tlsConfig.MaxVersion,
+		InsecureSkipVerify:    tlsConfig.InsecureSkipVerify,
+		RootCAs:               tlsConfig.RootCAs,
+		VerifyPeerCertificate: tlsConfig.VerifyPeerCertificate,
+		NextProtos:            tlsConfig.NextProtos,
+	}
+
+	if verify := tlsConfig.VerifyConnection; verify != nil {
+		conf.VerifyConnection = func(cs ctls.ConnectionState) (err error) {
+			return verify(toConnectionState(cs))
+		}
+	}
+
+	for _, cert := range tlsConfig.Certificates {
+		conf.Certificates = append(conf.Certificates, ctls.Certificate{
+			Certificate: cert.Certificate,
+			PrivateKey:  cert.PrivateKey,
+		})
 	}
 
 	// In the case of regular http.Transport it can handle h2 upgrade with the
@@ -30,8 +30,12 @@ var _ tlsConnectionStater = (*connWrapper)(nil)
 
 // ConnectionState implements the tlsConnectionStater for *connWrapper.
 func (c *connWrapper) ConnectionState() (state tls.ConnectionState) {
-	innerState := c.baseConn.ConnectionState()
+	return toConnectionState(c.baseConn.ConnectionState())
+}
 
+// toConnectionState converts the connection state of Cloudflare's fork of
+// crypto/tls to the standard one.
+func toConnectionState(innerState ctls.ConnectionState) (state tls.ConnectionState) {
 	state.Version = innerState.Version
 	state.NegotiatedProtocol = innerState.NegotiatedProtocol
 	state.ServerName = innerState.ServerName
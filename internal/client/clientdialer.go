@@ -3,21 +3,34 @@ package client
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"net"
+	"net/url"
+	"os"
+	"time"
 
 	"github.com/ameshkov/gocurl/internal/client/cfcrypto"
 	"github.com/ameshkov/gocurl/internal/client/connectto"
 	"github.com/ameshkov/gocurl/internal/client/dialer"
+	"github.com/ameshkov/gocurl/internal/client/httpmangle"
+	"github.com/ameshkov/gocurl/internal/client/jitter"
 	"github.com/ameshkov/gocurl/internal/client/proxy"
+	"github.com/ameshkov/gocurl/internal/client/quicshape"
 	"github.com/ameshkov/gocurl/internal/client/splittls"
 	"github.com/ameshkov/gocurl/internal/client/websocket"
 	"github.com/ameshkov/gocurl/internal/config"
 	"github.com/ameshkov/gocurl/internal/output"
 	"github.com/ameshkov/gocurl/internal/resolve"
 	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
 )
 
+// ErrHandshakeTimeout is returned when the TLS or QUIC handshake takes longer
+// than allowed by --tls-handshake-timeout.
+var ErrHandshakeTimeout = errors.New("tls handshake timeout")
+
 // clientDialer is a structure that implements additional logic on top of the
 // regular dial depending on the configuration. It can dial over a proxy,
 // apply --connect-to logic or split TLS client hello when required.
@@ -28,11 +41,12 @@ type clientDialer struct {
 	resolver  *resolve.Resolver
 	dial      dialer.DialFunc
 
-	// conn is the last established connection via the dialer.  It can be a TLS
-	// connection if DialTLSContext was used.
-	//
-	// TODO(ameshkov): handle QUIC connections.
-	conn net.Conn
+	// direct is the base dialer that establishes the connections.
+	direct *dialer.Direct
+
+	// proxy is the dialer that establishes the connections through the
+	// proxies.  It is nil if no proxy is used.
+	proxy *proxy.FailoverDialer
 }
 
 // newDialer creates a new instance of the clientDialer.
@@ -42,7 +56,44 @@ func newDialer(cfg *config.Config, out *output.Output) (d *clientDialer, err err
 		return nil, err
 	}
 
-	dial, err := createDialFunc(resolver, cfg, out)
+	direct, err := createDirect(resolver, cfg, out)
+	if err != nil {
+		return nil, err
+	}
+
+	var proxyDialer *proxy.FailoverDialer
+	if cfg.ProxyURL != nil {
+		proxyURLs := append([]*url.URL{cfg.ProxyURL}, cfg.ProxyFallbackURLs...)
+		proxyConf := &proxy.Config{
+			User:       cfg.ProxyUser,
+			AuthScheme: cfg.ProxyAuthScheme,
+			TLSConfig:  createProxyTLSConfig(cfg),
+		}
+
+		forward := direct.Dial
+		if cfg.PreproxyURL != nil {
+			var pre *proxy.Dialer
+			pre, err = proxy.NewProxyDialer(cfg.PreproxyURL, &proxy.Config{}, direct, out)
+			if err != nil {
+				return nil, err
+			}
+
+			forward = pre.Dial
+		}
+
+		proxyDialer, err = proxy.NewFailoverDialer(
+			proxyURLs,
+			proxyConf,
+			forward,
+			cfg.ProxyFallbackDirect,
+			out,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	dial, err := createDialFunc(direct, proxyDialer, cfg, out)
 	if err != nil {
 		return nil, err
 	}
@@ -53,11 +104,13 @@ func newDialer(cfg *config.Config, out *output.Output) (d *clientDialer, err err
 		tlsConfig: createTLSConfig(cfg, out),
 		resolver:  resolver,
 		dial:      dial,
+		direct:    direct,
+		proxy:     proxyDialer,
 	}, nil
 }
 
 // DialTLSContext establishes a new TLS connection to the specified address.
-func (d *clientDialer) DialTLSContext(_ context.Context, network, addr string) (c net.Conn, err error) {
+func (d *clientDialer) DialTLSContext(ctx context.Context, network, addr string) (c net.Conn, err error) {
 	d.out.Debug("Connecting to %s over TLS", addr)
 
 	conn, err := d.dial(network, addr)
@@ -65,23 +118,89 @@ func (d *clientDialer) DialTLSContext(_ context.Context, network, addr string) (
 		return nil, err
 	}
 
+	d.connected(ctx, conn)
+
+	conn, err = d.handshake(conn, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	appConnected(ctx)
+
+	return conn, nil
+}
+
+// connected records the name lookup and connect phases of conn to the timings
+// attached to ctx, if any.
+func (d *clientDialer) connected(ctx context.Context, conn net.Conn) {
+	t := output.TimingsFromContext(ctx)
+	if t == nil {
+		return
+	}
+
+	t.Done(output.PhaseConnect, time.Now())
+	if at, ok := d.direct.ResolvedAt(conn); ok {
+		t.Done(output.PhaseNameLookup, at)
+	}
+}
+
+// appConnected records the end of the TLS or QUIC handshake to the timings
+// attached to ctx, if any.
+func appConnected(ctx context.Context) {
+	if t := output.TimingsFromContext(ctx); t != nil {
+		t.Done(output.PhaseAppConnect, time.Now())
+	}
+}
+
+// handshake performs the TLS handshake over conn that is established to addr.
+func (d *clientDialer) handshake(conn net.Conn, addr string) (tlsConn net.Conn, err error) {
+	tlsConfig := d.tlsConfigFor(addr)
+
+	timeout := d.cfg.TLSHandshakeTimeout
+	if timeout > 0 {
+		err = conn.SetDeadline(time.Now().Add(timeout))
+		if err != nil {
+			return nil, fmt.Errorf("setting handshake deadline: %w", err)
+		}
+	}
+
 	_, postQuantum := d.cfg.Experiments[config.ExpPostQuantum]
 	if d.cfg.ECH || postQuantum {
-		d.conn, err = d.handshakeCTLS(conn)
+		tlsConn, err = d.handshakeCTLS(conn, tlsConfig)
 	} else {
-		d.conn, err = d.handshakeTLS(conn)
+		tlsConn, err = d.handshakeTLS(conn, tlsConfig)
+	}
+
+	if err != nil {
+		if timeout > 0 && errors.Is(err, os.ErrDeadlineExceeded) {
+			return nil, fmt.Errorf("%w after %s with %s", ErrHandshakeTimeout, timeout, addr)
+		}
+
+		return nil, err
 	}
 
-	return d.conn, err
+	if timeout > 0 {
+		err = conn.SetDeadline(time.Time{})
+		if err != nil {
+			return nil, fmt.Errorf("resetting handshake deadline: %w", err)
+		}
+	}
+
+	return tlsConn, nil
 }
 
 // DialContext implements proxy.ContextDialer for *clientDialer.
-func (d *clientDialer) DialContext(_ context.Context, network, addr string) (c net.Conn, err error) {
+func (d *clientDialer) DialContext(ctx context.Context, network, addr string) (c net.Conn, err error) {
 	d.out.Debug("Connecting to %s", addr)
 
-	d.conn, err = d.dial(network, addr)
+	conn, err := d.dial(network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	d.connected(ctx, conn)
 
-	return d.conn, err
+	return conn, nil
 }
 
 // DialQUIC establishes a new QUIC connection and is supposed to be used by
@@ -97,22 +216,185 @@ func (d *clientDialer) DialQUIC(
 		return nil, err
 	}
 
+	d.connected(ctx, conn)
+
+	c, err = d.handshakeQUIC(ctx, conn, addr, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	appConnected(ctx)
+
+	return c, nil
+}
+
+// handshakeQUIC establishes a QUIC connection over the UDP "connection" conn
+// that is established to addr.
+func (d *clientDialer) handshakeQUIC(
+	ctx context.Context,
+	conn net.Conn,
+	addr string,
+	cfg *quic.Config,
+) (c quic.EarlyConnection, err error) {
 	uConn, ok := conn.(net.PacketConn)
 	if !ok {
 		return nil, fmt.Errorf("dialer returned not a PacketConn for %s", addr)
 	}
 
+	if d.cfg.QUICSplit > 0 || d.cfg.QUICReorder || d.cfg.QUICInitialSize > 0 {
+		uConn = quicshape.NewPacketConn(uConn, &quicshape.Config{
+			Split:       d.cfg.QUICSplit,
+			Reorder:     d.cfg.QUICReorder,
+			InitialSize: d.cfg.QUICInitialSize,
+		}, d.out)
+	}
+
 	udpAddr, err := net.ResolveUDPAddr("udp", addr)
 	if err != nil {
 		return nil, err
 	}
 
-	return quic.DialEarly(ctx, uConn, udpAddr, d.tlsConfig, cfg)
+	// The dialer's TLS configuration may be created for TCP connections when
+	// HTTP/3 is only attempted, see --http3-try.
+	tlsConfig := d.tlsConfigFor(addr)
+	tlsConfig.NextProtos = []string{http3.NextProtoH3}
+	if len(d.cfg.HTTP3ALPN) > 0 {
+		tlsConfig.NextProtos = d.cfg.HTTP3ALPN
+	}
+
+	timeout := d.cfg.TLSHandshakeTimeout
+	if timeout == 0 {
+		return quic.DialEarly(ctx, uConn, udpAddr, tlsConfig, cfg)
+	}
+
+	// The context is only used for the handshake.
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	c, err = quic.DialEarly(ctx, uConn, udpAddr, tlsConfig, cfg)
+	if err != nil && errors.Is(err, context.DeadlineExceeded) {
+		return nil, fmt.Errorf("%w after %s with %s", ErrHandshakeTimeout, timeout, addr)
+	}
+
+	return c, err
+}
+
+// tlsConfigFor returns the TLS configuration for a connection to addr.  The
+// server name is taken from addr unless it is overridden by --tls-servername
+// so that the same dialer can be used for requests to different hosts.  When
+// --front is used, the server name is the front domain, but the certificate
+// is still verified against the host from addr.
+func (d *clientDialer) tlsConfigFor(addr string) (tlsConfig *tls.Config) {
+	tlsConfig = d.tlsConfig.Clone()
+	if d.cfg.TLSServerName != "" {
+		return tlsConfig
+	}
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return tlsConfig
+	}
+
+	if d.cfg.Front == "" {
+		tlsConfig.ServerName = host
+
+		return tlsConfig
+	}
+
+	tlsConfig.ServerName = d.cfg.Front
+	if !tlsConfig.InsecureSkipVerify {
+		// The default verification would check the certificate against the
+		// front domain so replace it.
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyConnection = joinVerifiers(
+			newHostVerifier(host, tlsConfig.RootCAs),
+			tlsConfig.VerifyConnection,
+		)
+	}
+
+	return tlsConfig
+}
+
+// newHostVerifier returns a function for tls.Config.VerifyConnection that
+// verifies the server certificate against host.
+func newHostVerifier(
+	host string,
+	roots *x509.CertPool,
+) (f func(cs tls.ConnectionState) (err error)) {
+	return func(cs tls.ConnectionState) (err error) {
+		if len(cs.PeerCertificates) == 0 {
+			return errors.New("no server certificate")
+		}
+
+		opts := x509.VerifyOptions{
+			DNSName:       host,
+			Roots:         roots,
+			Intermediates: x509.NewCertPool(),
+		}
+		for _, cert := range cs.PeerCertificates[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+
+		_, err = cs.PeerCertificates[0].Verify(opts)
+
+		return err
+	}
+}
+
+// joinVerifiers returns a function for tls.Config.VerifyConnection that calls
+// fs in order until one of them fails.  Nil functions are skipped.
+func joinVerifiers(
+	fs ...func(cs tls.ConnectionState) (err error),
+) (f func(cs tls.ConnectionState) (err error)) {
+	return func(cs tls.ConnectionState) (err error) {
+		for _, verify := range fs {
+			if verify == nil {
+				continue
+			}
+
+			err = verify(cs)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+// trustAnchorsSource returns the description of the CA certificates the
+// server certificate is verified with.
+func trustAnchorsSource(cfg *config.Config) (s string) {
+	switch {
+	case cfg.RootCAs == nil:
+		return "system CA certificates"
+	case cfg.CANative:
+		return "--cacert/--capath and system CA certificates"
+	default:
+		return "--cacert/--capath only"
+	}
+}
+
+// joinPeerVerifiers returns a function for tls.Config.VerifyPeerCertificate
+// that calls fs in order until one of them fails.
+func joinPeerVerifiers(
+	fs []func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) (err error),
+) (f func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) (err error)) {
+	return func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) (err error) {
+		for _, verify := range fs {
+			err = verify(rawCerts, verifiedChains)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
 }
 
 // handshakeTLS attempts to establish a TLS connection.
-func (d *clientDialer) handshakeTLS(conn net.Conn) (tlsConn net.Conn, err error) {
-	tlsClient := tls.Client(conn, d.tlsConfig)
+func (d *clientDialer) handshakeTLS(conn net.Conn, tlsConfig *tls.Config) (tlsConn net.Conn, err error) {
+	tlsClient := tls.Client(conn, tlsConfig)
 	err = tlsClient.Handshake()
 	if err != nil {
 		return nil, err
@@ -124,39 +406,111 @@ func (d *clientDialer) handshakeTLS(conn net.Conn) (tlsConn net.Conn, err error)
 // handshakeCTLS attempts to establish a TLS connection using Cloudflare's fork
 // of crypto/tls.  This is necessary to enable some features missing from the
 // standard library like ECH or post-quantum cryptography.
-func (d *clientDialer) handshakeCTLS(conn net.Conn) (tlsConn net.Conn, err error) {
-	return cfcrypto.Handshake(conn, d.tlsConfig, d.resolver, d.cfg, d.out)
+func (d *clientDialer) handshakeCTLS(conn net.Conn, tlsConfig *tls.Config) (tlsConn net.Conn, err error) {
+	return cfcrypto.Handshake(conn, tlsConfig, d.resolver, d.cfg, d.out)
+}
+
+// createDirect creates the base dialer configured by cfg.
+func createDirect(
+	resolver *resolve.Resolver,
+	cfg *config.Config,
+	out *output.Output,
+) (d *dialer.Direct, err error) {
+	var sockOpts *dialer.SocketOptions
+	if cfg.IPTOS != 0 || cfg.IPTTL != 0 || cfg.TCPMSS != 0 || len(cfg.SockOpts) > 0 {
+		sockOpts = &dialer.SocketOptions{
+			TOS: cfg.IPTOS,
+			TTL: cfg.IPTTL,
+			MSS: cfg.TCPMSS,
+		}
+
+		for _, s := range cfg.SockOpts {
+			var o *dialer.RawSocketOption
+			o, err = dialer.ParseRawSocketOption(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid sockopt: %w", err)
+			}
+
+			sockOpts.Raw = append(sockOpts.Raw, o)
+		}
+	}
+
+	return dialer.NewDirect(resolver, sockOpts, cfg.MPTCP, out), nil
 }
 
 // createDialFunc creates dialFunc that implements all the logic configured by
-// cfg.
+// cfg on top of the base dialer d.  proxyDialer is used instead of d if not
+// nil.
 func createDialFunc(
-	resolver *resolve.Resolver,
+	d *dialer.Direct,
+	proxyDialer *proxy.FailoverDialer,
 	cfg *config.Config,
 	out *output.Output,
 ) (dial dialer.DialFunc, err error) {
-	d := dialer.NewDirect(resolver, out)
 	dial = d.Dial
 
-	if cfg.ProxyURL != nil {
-		var proxyDialer dialer.Dialer
-		proxyDialer, err = proxy.NewProxyDialer(cfg.ProxyURL, dial, out)
+	if proxyDialer != nil {
+		dial = proxyDialer.Dial
+	}
+
+	if len(cfg.ConnectTo) > 0 {
+		dial, err = connectto.CreateDialFunc(cfg.ConnectTo, dial, out)
 		if err != nil {
 			return nil, err
 		}
+	}
 
-		dial = proxyDialer.Dial
+	if len(cfg.HTTPMangle) > 0 {
+		dial, err = httpmangle.CreateDialFunc(cfg.HTTPMangle, dial, out)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	if len(cfg.ConnectTo) > 0 {
-		dial, err = connectto.CreateDialFunc(cfg.ConnectTo, dial, out)
+	// The fake data must be sent directly to the TCP connection so these
+	// wrappers go before the ones that split ClientHello.
+	if cfg.TLSFakeSNI != "" {
+		dial, err = splittls.CreateFakeHelloDialFunc(cfg.TLSFakeSNI, cfg.TLSFakeTTL, dial, out)
 		if err != nil {
 			return nil, err
 		}
 	}
 
+	if cfg.FakeSegmentTTL > 0 {
+		dial, err = splittls.CreateFakeSegmentDialFunc(cfg.FakeSegmentTTL, dial, out)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.WriteJitterMax > 0 {
+		dial = jitter.CreateDialFunc(cfg.WriteJitterMin, cfg.WriteJitterMax, dial, out)
+	}
+
+	// The front domain must be applied before --connect-to so that it's
+	// possible to redirect connections to it.
+	if cfg.Front != "" {
+		dial = connectto.CreateFrontDialFunc(cfg.Front, dial, out)
+	}
+
 	if cfg.TLSSplitChunkSize > 0 {
-		dial = splittls.CreateDialFunc(cfg.TLSSplitChunkSize, cfg.TLSSplitDelay, dial, out)
+		dial = splittls.CreateDialFunc(
+			cfg.TLSSplitChunkSize,
+			cfg.TLSSplitDelay,
+			cfg.TCPDisorder,
+			dial,
+			out,
+		)
+	}
+
+	if len(cfg.TLSSplitSNIOffsets) > 0 {
+		dial = splittls.CreateSNISplitDialFunc(cfg.TLSSplitSNIOffsets, cfg.TLSSplitSNIDelay, dial, out)
+	}
+
+	// Records must be split before the result is split into TCP segments so
+	// the wrapper goes on top.
+	if cfg.TLSRecordSplitSize > 0 {
+		dial = splittls.CreateRecordSplitDialFunc(cfg.TLSRecordSplitSize, dial, out)
 	}
 
 	return dial, nil
@@ -184,6 +538,32 @@ func createTLSConfig(cfg *config.Config, out *output.Output) (tlsConfig *tls.Con
 		tlsConfig.InsecureSkipVerify = true
 	}
 
+	tlsConfig.RootCAs = cfg.RootCAs
+	if !cfg.Insecure {
+		out.Debug("Trust anchors: %s", trustAnchorsSource(cfg))
+	}
+
+	var peerVerifiers []func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) (err error)
+	if len(cfg.PinnedPubKeys) > 0 {
+		peerVerifiers = append(peerVerifiers, newPinVerifier(cfg.PinnedPubKeys))
+	}
+
+	if len(cfg.CRLs) > 0 {
+		peerVerifiers = append(peerVerifiers, newCRLVerifier(cfg.CRLs))
+	}
+
+	if len(peerVerifiers) > 0 {
+		tlsConfig.VerifyPeerCertificate = joinPeerVerifiers(peerVerifiers)
+	}
+
+	if cfg.CertStatus {
+		tlsConfig.VerifyConnection = verifyCertStatus
+	}
+
+	if cfg.ClientCert != nil {
+		tlsConfig.Certificates = []tls.Certificate{*cfg.ClientCert}
+	}
+
 	if websocket.IsWebSocket(cfg.RequestURL) {
 		out.Debug("Forcing ALPN http/1.1 as this is a WebSocket request")
 
@@ -212,3 +592,28 @@ func createTLSConfig(cfg *config.Config, out *output.Output) (tlsConfig *tls.Con
 
 	return tlsConfig
 }
+
+// createProxyTLSConfig creates the TLS configuration for the connections to
+// the HTTPS proxies.  Unlike createTLSConfig, it only uses the --proxy-*
+// options.
+func createProxyTLSConfig(cfg *config.Config) (tlsConfig *tls.Config) {
+	tlsConfig = &tls.Config{
+		RootCAs:    cfg.ProxyRootCAs,
+		MinVersion: cfg.ProxyTLSMinVersion,
+		MaxVersion: cfg.ProxyTLSMaxVersion,
+	}
+
+	if len(cfg.ProxyTLSCiphers) > 0 {
+		tlsConfig.CipherSuites = cfg.ProxyTLSCiphers
+	}
+
+	if cfg.ProxyInsecure {
+		tlsConfig.InsecureSkipVerify = true
+	}
+
+	if cfg.ProxyClientCert != nil {
+		tlsConfig.Certificates = []tls.Certificate{*cfg.ProxyClientCert}
+	}
+
+	return tlsConfig
+}
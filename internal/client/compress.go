@@ -0,0 +1,93 @@
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// compress compresses data with the specified content encoding, see
+// --compress-request.
+func compress(data []byte, encoding string) (b []byte, err error) {
+	buf := &bytes.Buffer{}
+
+	w, err := newCompressWriter(buf, encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = w.Write(data)
+	if err == nil {
+		err = w.Close()
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("compressing request body with %s: %w", encoding, err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// newCompressWriter returns the writer that compresses the data written to w
+// with the specified content encoding.
+func newCompressWriter(w io.Writer, encoding string) (wc io.WriteCloser, err error) {
+	switch encoding {
+	case "gzip":
+		return gzip.NewWriter(w), nil
+	case "br":
+		return brotli.NewWriter(w), nil
+	case "zstd":
+		// zstd.NewWriter only returns an error for invalid options.
+		wc, _ = zstd.NewWriter(w)
+
+		return wc, nil
+	default:
+		return nil, fmt.Errorf("unsupported content encoding: %s", encoding)
+	}
+}
+
+// compressReader compresses the data of r on the fly while it's read so that
+// the streamed request body is not loaded to memory.  The data is compressed
+// in a separate goroutine that is started on the first Read.
+type compressReader struct {
+	r        io.Reader
+	pr       *io.PipeReader
+	encoding string
+}
+
+// type check
+var _ io.Reader = (*compressReader)(nil)
+
+// Read implements the io.Reader interface for *compressReader.
+func (c *compressReader) Read(p []byte) (n int, err error) {
+	if c.pr == nil {
+		var pw *io.PipeWriter
+		c.pr, pw = io.Pipe()
+
+		go c.compress(pw)
+	}
+
+	return c.pr.Read(p)
+}
+
+// compress writes the compressed data of c.r to pw and closes it with the
+// error if any.
+func (c *compressReader) compress(pw *io.PipeWriter) {
+	w, err := newCompressWriter(pw, c.encoding)
+	if err == nil {
+		_, err = io.Copy(w, c.r)
+		if err == nil {
+			err = w.Close()
+		}
+	}
+
+	if err != nil {
+		err = fmt.Errorf("compressing request body with %s: %w", c.encoding, err)
+	}
+
+	_ = pw.CloseWithError(err)
+}
@@ -0,0 +1,145 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"time"
+
+	"github.com/ameshkov/gocurl/internal/config"
+	"github.com/ameshkov/gocurl/internal/output"
+)
+
+// ConnectResult is the connection established by Connect and the information
+// about it.
+type ConnectResult struct {
+	// Conn is the established connection, it must be closed by the caller.  It
+	// is nil for QUIC connections as they are closed right after the
+	// handshake.
+	Conn net.Conn `json:"-"`
+
+	// TLS is the state of the TLS connection, it is nil for plain
+	// connections.
+	TLS *tls.ConnectionState `json:"-"`
+
+	// Timings are the durations of the connection phases, the total one ends
+	// when the connection is established.
+	Timings *output.Timings `json:"timings"`
+
+	// TLSVersion is the negotiated TLS version, e.g. "TLS 1.3".
+	TLSVersion string `json:"tls_version,omitempty"`
+
+	// ALPN is the negotiated application protocol.
+	ALPN string `json:"alpn,omitempty"`
+
+	// RemoteAddr is the address the connection was established to.
+	RemoteAddr string `json:"remote_addr"`
+
+	// Proto is the transport protocol of the connection: "tcp", "udp" or
+	// "quic".
+	Proto string `json:"proto"`
+}
+
+// Connect establishes a connection to the host of cfg.RequestURL using the
+// same dialing logic as the HTTP transport, i.e. it respects the proxy, DNS,
+// connect-to and the other connection-related options.  It is used in the raw
+// mode, see --connect-only, and for MQTT.  Depending on the URL scheme the
+// connection is:
+//
+//   - tcp, http, ws, mqtt: a plain TCP connection.
+//   - udp: a UDP "connection".
+//   - https, wss, mqtts: a TLS connection, it can use ECH.  With --http3 it
+//     is a QUIC connection that is closed after the handshake.
+func Connect(cfg *config.Config, out *output.Output) (r *ConnectResult, err error) {
+	d, err := newDialer(cfg, out)
+	if err != nil {
+		return nil, err
+	}
+
+	port := cfg.RequestURL.Port()
+	if port == "" {
+		port = defaultPort(cfg.RequestURL.Scheme)
+	}
+
+	addr := net.JoinHostPort(cfg.RequestURL.Hostname(), port)
+
+	r = &ConnectResult{
+		Timings: output.NewTimings(time.Now()),
+		Proto:   "tcp",
+	}
+	ctx := output.WithTimings(context.Background(), r.Timings)
+
+	switch scheme := cfg.RequestURL.Scheme; {
+	case cfg.ForceHTTP3:
+		r.Proto = "quic"
+		err = connectQUIC(ctx, d, r, addr)
+	case scheme == "tcp" || scheme == "udp":
+		r.Proto = scheme
+		r.Conn, err = d.DialContext(ctx, scheme, addr)
+	case scheme == "http" || scheme == "ws" || scheme == "mqtt":
+		r.Conn, err = d.DialContext(ctx, "tcp", addr)
+	default:
+		r.Conn, err = d.DialTLSContext(ctx, "tcp", addr)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	r.Timings.Done(output.PhaseTotal, time.Now())
+
+	if r.Conn != nil {
+		r.RemoteAddr = r.Conn.RemoteAddr().String()
+		if c, ok := r.Conn.(tlsConnectionStater); ok {
+			state := c.ConnectionState()
+			r.TLS = &state
+		}
+	}
+
+	if r.TLS != nil {
+		r.TLSVersion = tls.VersionName(r.TLS.Version)
+		r.ALPN = r.TLS.NegotiatedProtocol
+	}
+
+	return r, nil
+}
+
+// connectQUIC establishes the QUIC connection to addr, saves its information
+// to r, and closes it.
+func connectQUIC(ctx context.Context, d *clientDialer, r *ConnectResult, addr string) (err error) {
+	conn, err := d.dial("udp", addr)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+
+	d.connected(ctx, conn)
+
+	qConn, err := d.handshakeQUIC(ctx, conn, addr, newQUICConfig(d.cfg))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = qConn.CloseWithError(0, "") }()
+
+	appConnected(ctx)
+
+	state := qConn.ConnectionState().TLS
+	r.TLS = &state
+	r.RemoteAddr = qConn.RemoteAddr().String()
+
+	return nil
+}
+
+// defaultPort returns the default port for the URL scheme.
+func defaultPort(scheme string) (port string) {
+	switch scheme {
+	case "http", "ws":
+		return "80"
+	case "mqtt":
+		return "1883"
+	case "mqtts":
+		return "8883"
+	default:
+		return "443"
+	}
+}
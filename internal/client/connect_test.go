@@ -0,0 +1,97 @@
+package client_test
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/ameshkov/gocurl/internal/client"
+	"github.com/ameshkov/gocurl/internal/config"
+	"github.com/ameshkov/gocurl/internal/output"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnect(t *testing.T) {
+	var requests int
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		requests++
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	out, err := output.NewOutput("", false)
+	require.NoError(t, err)
+
+	cfg := &config.Config{
+		RequestURL: u,
+		Insecure:   true,
+	}
+
+	r, err := client.Connect(cfg, out)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = r.Conn.Close() })
+
+	require.Equal(t, u.Host, r.RemoteAddr)
+	require.Equal(t, "tcp", r.Proto)
+	require.Equal(t, "TLS 1.3", r.TLSVersion)
+	require.Equal(t, "h2", r.ALPN)
+	require.Positive(t, r.Timings.Duration(output.PhaseConnect))
+	require.GreaterOrEqual(
+		t,
+		r.Timings.Duration(output.PhaseAppConnect),
+		r.Timings.Duration(output.PhaseConnect),
+	)
+	require.GreaterOrEqual(
+		t,
+		r.Timings.Duration(output.PhaseTotal),
+		r.Timings.Duration(output.PhaseAppConnect),
+	)
+	require.Zero(t, requests)
+}
+
+func TestConnect_quic(t *testing.T) {
+	handler := http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {})
+
+	// Use the certificate generated by httptest for the HTTP/3 server.
+	tlsSrv := httptest.NewTLSServer(handler)
+	t.Cleanup(tlsSrv.Close)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	srv := &http3.Server{
+		Handler:   handler,
+		TLSConfig: &tls.Config{Certificates: tlsSrv.TLS.Certificates},
+	}
+	go func() { _ = srv.Serve(conn) }()
+	t.Cleanup(func() { _ = srv.Close() })
+
+	u, err := url.Parse("https://" + conn.LocalAddr().String())
+	require.NoError(t, err)
+
+	out, err := output.NewOutput("", false)
+	require.NoError(t, err)
+
+	cfg := &config.Config{
+		RequestURL: u,
+		Insecure:   true,
+		ForceHTTP3: true,
+	}
+
+	r, err := client.Connect(cfg, out)
+	require.NoError(t, err)
+
+	require.Nil(t, r.Conn)
+	require.Equal(t, "quic", r.Proto)
+	require.Equal(t, conn.LocalAddr().String(), r.RemoteAddr)
+	require.Equal(t, "h3", r.ALPN)
+	require.Positive(t, r.Timings.Duration(output.PhaseAppConnect))
+}
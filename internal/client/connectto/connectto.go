@@ -10,7 +10,8 @@ import (
 )
 
 // CreateDialFunc creates a dialer.DialFunc that overrides the remote endpoint
-// if the address matches what an entry in the connectTo map.
+// if the address matches what an entry in the connectTo map.  Keys and values
+// of connectTo may have empty host or port, see redirect.
 func CreateDialFunc(
 	connectTo map[string]string,
 	baseDial dialer.DialFunc,
@@ -19,7 +20,7 @@ func CreateDialFunc(
 	out.Debug("Some connections will be redirected due to --connect-to")
 
 	return func(network, addr string) (net.Conn, error) {
-		if v, ok := connectTo[addr]; ok {
+		if v, ok := redirect(connectTo, addr); ok {
 			out.Debug("Redirecting %s to %s", addr, v)
 			addr = v
 		}
@@ -27,3 +28,63 @@ func CreateDialFunc(
 		return baseDial(network, addr)
 	}, nil
 }
+
+// redirect returns the address addr must be redirected to according to
+// connectTo.  The most specific entry wins: "host:port", then "host:", then
+// ":port", then ":" that matches any address.  Empty host or port in the
+// entry value are replaced with the ones from addr.
+func redirect(connectTo map[string]string, addr string) (res string, ok bool) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", false
+	}
+
+	var v string
+	for _, k := range []string{host + ":" + port, host + ":", ":" + port, ":"} {
+		v, ok = connectTo[k]
+		if ok {
+			break
+		}
+	}
+
+	if !ok {
+		return "", false
+	}
+
+	newHost, newPort, err := net.SplitHostPort(v)
+	if err != nil {
+		return "", false
+	}
+
+	if newHost == "" {
+		newHost = host
+	}
+
+	if newPort == "" {
+		newPort = port
+	}
+
+	return net.JoinHostPort(newHost, newPort), true
+}
+
+// CreateFrontDialFunc creates a dialer.DialFunc that connects to the front
+// domain instead of the requested host keeping the port, see --front.
+func CreateFrontDialFunc(
+	front string,
+	baseDial dialer.DialFunc,
+	out *output.Output,
+) (f dialer.DialFunc) {
+	out.Debug("Connections will be made to the front domain %s due to --front", front)
+
+	return func(network, addr string) (net.Conn, error) {
+		_, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		frontAddr := net.JoinHostPort(front, port)
+		out.Debug("Redirecting %s to %s", addr, frontAddr)
+
+		return baseDial(network, frontAddr)
+	}
+}
@@ -0,0 +1,55 @@
+package connectto_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/ameshkov/gocurl/internal/client/connectto"
+	"github.com/ameshkov/gocurl/internal/output"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateDialFunc(t *testing.T) {
+	out, err := output.NewOutput("", false)
+	require.NoError(t, err)
+
+	var dialed string
+	baseDial := func(_, addr string) (conn net.Conn, err error) {
+		dialed = addr
+
+		return nil, nil
+	}
+
+	dial, err := connectto.CreateDialFunc(map[string]string{
+		"example.org:443": "127.0.0.1:8443",
+		"example.org:":    "127.0.0.2:",
+		":80":             ":8080",
+		":":               "127.0.0.3:",
+	}, baseDial, out)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		addr string
+		want string
+	}{{
+		addr: "example.org:443",
+		want: "127.0.0.1:8443",
+	}, {
+		addr: "example.org:80",
+		want: "127.0.0.2:80",
+	}, {
+		addr: "example.net:80",
+		want: "example.net:8080",
+	}, {
+		addr: "example.net:443",
+		want: "127.0.0.3:443",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.addr, func(t *testing.T) {
+			_, err = dial("tcp", tc.addr)
+			require.NoError(t, err)
+			require.Equal(t, tc.want, dialed)
+		})
+	}
+}
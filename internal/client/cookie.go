@@ -0,0 +1,102 @@
+package client
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/ameshkov/gocurl/internal/config"
+	"github.com/ameshkov/gocurl/internal/cookie"
+	"github.com/ameshkov/gocurl/internal/output"
+)
+
+// cookieTransport is a Transport that keeps the cookies during the run: the
+// cookies received in the responses are sent with the next requests that
+// match their domain, path and secure attributes, including the redirects and
+// the requests to other URLs.  The cookies are written to the cookie file if
+// --cookie-jar is used.
+type cookieTransport struct {
+	Transport
+
+	jar *cookie.Jar
+	out *output.Output
+
+	// mu serializes writing the cookie file by parallel transfers.
+	mu *sync.Mutex
+
+	// path is the path to the cookie file.  If empty, cookies are not
+	// written.
+	path string
+
+	// junkSession makes the session cookies not written to the cookie file,
+	// see --junk-session-cookies.
+	junkSession bool
+}
+
+// type check
+var _ Transport = (*cookieTransport)(nil)
+
+// needsCookieEngine returns true if cfg requires keeping the cookies during
+// the run, i.e. a cookie file is used or several requests are sent.
+func needsCookieEngine(cfg *config.Config) (ok bool) {
+	return cfg.CookieJar != "" || len(cfg.Cookies) > 0 || cfg.FollowRedirects || len(cfg.RequestURLs) > 1
+}
+
+// newCookieTransport wraps base with the cookie jar that initially contains
+// the cookies read with --cookie.
+func newCookieTransport(base Transport, cfg *config.Config, out *output.Output) (t *cookieTransport) {
+	return &cookieTransport{
+		Transport:   base,
+		jar:         cookie.NewJar(cfg.Cookies),
+		out:         out,
+		mu:          &sync.Mutex{},
+		path:        cfg.CookieJar,
+		junkSession: cfg.JunkSessionCookies,
+	}
+}
+
+// RoundTrip implements the http.RoundTripper interface for *cookieTransport.
+func (t *cookieTransport) RoundTrip(r *http.Request) (resp *http.Response, err error) {
+	if cookies := t.jar.Cookies(r.URL); len(cookies) > 0 {
+		// Don't modify the header of the caller, the redirects are made from
+		// it.
+		r = r.Clone(r.Context())
+		for _, c := range cookies {
+			r.AddCookie(c)
+		}
+	}
+
+	resp, err = t.Transport.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if cookies := resp.Cookies(); len(cookies) > 0 {
+		t.jar.SetCookies(r.URL, cookies)
+		t.save()
+	}
+
+	return resp, nil
+}
+
+// save writes the cookies to the cookie file if it's configured, errors are
+// logged.
+func (t *cookieTransport) save() {
+	if t.path == "" {
+		return
+	}
+
+	var cookies []*http.Cookie
+	for _, c := range t.jar.All() {
+		if !t.junkSession || !c.Expires.IsZero() {
+			cookies = append(cookies, c)
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	err := cookie.WriteFile(t.path, cookies)
+	if err != nil {
+		t.out.Info("Failed to write the cookie jar: %v", err)
+	}
+}
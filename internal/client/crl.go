@@ -0,0 +1,88 @@
+package client
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"fmt"
+)
+
+// ErrCertRevoked is returned when one of the server certificates is revoked
+// according to --crlfile.
+var ErrCertRevoked = errors.New("certificate revoked")
+
+// newCRLVerifier returns a function for tls.Config.VerifyPeerCertificate that
+// checks the server certificates against crls.  The signature of a list is
+// checked when its issuer is in the server certificate chain.
+func newCRLVerifier(
+	crls []*x509.RevocationList,
+) (f func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) (err error)) {
+	return func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) (err error) {
+		chain, err := peerChain(rawCerts, verifiedChains)
+		if err != nil {
+			return err
+		}
+
+		for i, cert := range chain {
+			var issuer *x509.Certificate
+			if i+1 < len(chain) {
+				issuer = chain[i+1]
+			}
+
+			err = checkCRLs(crls, cert, issuer)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+// peerChain returns the first verified chain or the certificates sent by the
+// server if the verification is disabled with -k.
+func peerChain(
+	rawCerts [][]byte,
+	verifiedChains [][]*x509.Certificate,
+) (chain []*x509.Certificate, err error) {
+	if len(verifiedChains) > 0 {
+		return verifiedChains[0], nil
+	}
+
+	for _, raw := range rawCerts {
+		var cert *x509.Certificate
+		cert, err = x509.ParseCertificate(raw)
+		if err != nil {
+			return nil, fmt.Errorf("parsing server certificate: %w", err)
+		}
+
+		chain = append(chain, cert)
+	}
+
+	return chain, nil
+}
+
+// checkCRLs returns an error if cert is revoked according to one of crls
+// issued by its issuer.  issuer is nil if it is unknown.
+func checkCRLs(crls []*x509.RevocationList, cert, issuer *x509.Certificate) (err error) {
+	for _, crl := range crls {
+		if !bytes.Equal(crl.RawIssuer, cert.RawIssuer) {
+			continue
+		}
+
+		if issuer != nil {
+			err = crl.CheckSignatureFrom(issuer)
+			if err != nil {
+				return fmt.Errorf("checking crl of %s: %w", cert.Issuer, err)
+			}
+		}
+
+		for _, e := range crl.RevokedCertificateEntries {
+			if e.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+				return fmt.Errorf("%w: %s at %s", ErrCertRevoked, cert.Subject, e.RevocationTime)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,230 @@
+package client
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ameshkov/gocurl/internal/config"
+)
+
+// dataBody returns the function that opens the body made of the --data parts
+// joined with "&" and its size.  The files are read while the request is
+// sent.  The size is -1 if any of the parts is read from stdin or another
+// pipe.
+func dataBody(parts []*config.DataPart) (open func() (r io.Reader), size int64, err error) {
+	opens := make([]func() (r io.Reader), 0, len(parts))
+	size = int64(len(parts) - 1)
+	for _, p := range parts {
+		var partOpen func() (r io.Reader)
+		var partSize int64
+		partOpen, partSize, err = dataPartBody(p)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		opens = append(opens, partOpen)
+		if partSize < 0 || size < 0 {
+			size = -1
+		} else {
+			size += partSize
+		}
+	}
+
+	open = func() (r io.Reader) {
+		readers := make([]io.Reader, 0, 2*len(opens))
+		for i, o := range opens {
+			if i > 0 {
+				readers = append(readers, strings.NewReader("&"))
+			}
+
+			readers = append(readers, o())
+		}
+
+		return io.MultiReader(readers...)
+	}
+
+	return open, size, nil
+}
+
+// dataPartBody returns the function that opens the data of the --data part p
+// and its size.
+func dataPartBody(p *config.DataPart) (open func() (r io.Reader), size int64, err error) {
+	if p.File == "" {
+		return bytesBody([]byte(p.Data)), int64(len(p.Data)), nil
+	}
+
+	if !p.URLEncode {
+		return dataFileBody(p.File, func(r io.Reader) (res io.Reader) {
+			return &newlineStripper{r: r}
+		})
+	}
+
+	openFile, size, err := dataFileBody(p.File, func(r io.Reader) (res io.Reader) {
+		return &urlEncoder{r: r}
+	})
+	if err != nil || p.Name == "" {
+		return openFile, size, err
+	}
+
+	prefix := []byte(p.Name + "=")
+	if size >= 0 {
+		size += int64(len(prefix))
+	}
+
+	return func() (r io.Reader) {
+		return io.MultiReader(bytes.NewReader(prefix), openFile())
+	}, size, nil
+}
+
+// dataFileBody returns the function that opens the --data file at path and
+// the size of its data transformed with wrap.  The regular file is read once
+// to count the size.  The data from stdin and other pipes can only be read
+// once and its size is -1, so it's sent with chunked encoding.
+func dataFileBody(
+	path string,
+	wrap func(r io.Reader) (res io.Reader),
+) (open func() (r io.Reader), size int64, err error) {
+	if path == config.StdinFile {
+		return func() (r io.Reader) { return wrap(os.Stdin) }, -1, nil
+	}
+
+	regular, err := isRegularFile(path)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	open = func() (r io.Reader) {
+		return wrap(&fileReader{path: path})
+	}
+
+	if !regular {
+		return open, -1, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() { _ = f.Close() }()
+
+	size, err = io.Copy(io.Discard, wrap(f))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return open, size, nil
+}
+
+// uploadFileBody returns the function that opens the --upload-file at path
+// and its size.  The data from stdin and other pipes can only be read once and
+// its size is -1, so it's sent with chunked encoding.
+func uploadFileBody(path string) (open func() (r io.Reader), size int64, err error) {
+	if path == config.StdinFile {
+		return func() (r io.Reader) { return os.Stdin }, -1, nil
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	size = fi.Size()
+	if !fi.Mode().IsRegular() {
+		size = -1
+	}
+
+	return func() (r io.Reader) { return &fileReader{path: path} }, size, nil
+}
+
+// isRegularFile returns true if the file at path is a regular one, i.e. not a
+// FIFO or a device, and its size is known.
+func isRegularFile(path string) (ok bool, err error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+
+	return fi.Mode().IsRegular(), nil
+}
+
+// newlineStripper removes CR and LF from the data of r like curl does for the
+// --data files.
+type newlineStripper struct {
+	r io.Reader
+}
+
+// type check
+var _ io.Reader = (*newlineStripper)(nil)
+
+// Read implements the io.Reader interface for *newlineStripper.
+func (s *newlineStripper) Read(p []byte) (n int, err error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	// Don't return zero bytes without an error if the whole chunk consists of
+	// newlines.
+	for n == 0 && err == nil {
+		n, err = s.r.Read(p)
+		n = stripNewlines(p[:n])
+	}
+
+	return n, err
+}
+
+// stripNewlines removes CR and LF from b in place and returns the new length.
+func stripNewlines(b []byte) (n int) {
+	if bytes.IndexAny(b, "\r\n") < 0 {
+		return len(b)
+	}
+
+	for _, c := range b {
+		if c != '\r' && c != '\n' {
+			b[n] = c
+			n++
+		}
+	}
+
+	return n
+}
+
+// urlEncoder URL-encodes the data of r like curl does for the
+// --data-urlencode files.
+type urlEncoder struct {
+	r io.Reader
+
+	// encoded is the encoded data that is not read yet.
+	encoded []byte
+
+	// err is the error of the last read from r.
+	err error
+}
+
+// type check
+var _ io.Reader = (*urlEncoder)(nil)
+
+// Read implements the io.Reader interface for *urlEncoder.
+func (e *urlEncoder) Read(p []byte) (n int, err error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	for len(e.encoded) == 0 {
+		if e.err != nil {
+			return 0, e.err
+		}
+
+		// Every byte is encoded with at most three bytes.
+		buf := make([]byte, len(p)/3+1)
+
+		n, e.err = e.r.Read(buf)
+		e.encoded = []byte(config.EscapeData(string(buf[:n])))
+	}
+
+	n = copy(p, e.encoded)
+	e.encoded = e.encoded[n:]
+
+	return n, nil
+}
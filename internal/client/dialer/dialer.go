@@ -23,3 +23,29 @@ type DialFunc func(network, addr string) (conn net.Conn, err error)
 func (f DialFunc) Dial(network, addr string) (conn net.Conn, err error) {
 	return f(network, addr)
 }
+
+// WrappedConn is implemented by the connections that wrap another connection
+// to modify the written data or the way it's written, e.g. to split it.  It
+// allows reaching the underlying TCP connection to change its socket options,
+// see TCPConn.
+type WrappedConn interface {
+	net.Conn
+
+	// Unwrap returns the wrapped connection.
+	Unwrap() (conn net.Conn)
+}
+
+// TCPConn returns the TCP connection that conn wraps, see WrappedConn.  TLS
+// connections are not unwrapped since the data written to them is encrypted.
+func TCPConn(conn net.Conn) (tcpConn *net.TCPConn, ok bool) {
+	for {
+		switch c := conn.(type) {
+		case *net.TCPConn:
+			return c, true
+		case WrappedConn:
+			conn = c.Unwrap()
+		default:
+			return nil, false
+		}
+	}
+}
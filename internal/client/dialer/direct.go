@@ -2,6 +2,8 @@ package dialer
 
 import (
 	"net"
+	"sync"
+	"time"
 
 	"github.com/ameshkov/gocurl/internal/output"
 	"github.com/ameshkov/gocurl/internal/resolve"
@@ -12,18 +14,77 @@ import (
 // it.
 type Direct struct {
 	resolver *resolve.Resolver
+	sockOpts *SocketOptions
 	out      *output.Output
+
+	// mptcpMu protects mptcpUsed.
+	mptcpMu *sync.Mutex
+
+	// mptcpUsed maps local addresses of the established TCP connections to
+	// whether MPTCP is actually used.  It is nil unless MPTCP is enabled.
+	mptcpUsed map[string]bool
+
+	// resolvedMu protects resolved.
+	resolvedMu *sync.Mutex
+
+	// resolved maps local addresses of the established connections to the
+	// time when the hostname was resolved, see ResolvedAt.
+	resolved map[string]time.Time
 }
 
 // type check
 var _ Dialer = (*Direct)(nil)
 
-// NewDirect creates a new instance of *Direct.
-func NewDirect(resolver *resolve.Resolver, out *output.Output) (d *Direct) {
-	return &Direct{
+// NewDirect creates a new instance of *Direct.  sockOpts are applied to every
+// socket if not nil.  If mptcp is true, Multipath TCP is requested for TCP
+// connections.
+func NewDirect(
+	resolver *resolve.Resolver,
+	sockOpts *SocketOptions,
+	mptcp bool,
+	out *output.Output,
+) (d *Direct) {
+	d = &Direct{
 		resolver: resolver,
+		sockOpts: sockOpts,
 		out:      out,
+		mptcpMu:  &sync.Mutex{},
+
+		resolvedMu: &sync.Mutex{},
+		resolved:   map[string]time.Time{},
+	}
+
+	if mptcp {
+		d.mptcpUsed = map[string]bool{}
 	}
+
+	return d
+}
+
+// MultipathTCP returns true if MPTCP is used by the TCP connection with the
+// same local address as conn.  ok is false if MPTCP was not requested or if
+// the connection was not established by d.
+func (d *Direct) MultipathTCP(conn net.Conn) (used, ok bool) {
+	d.mptcpMu.Lock()
+	defer d.mptcpMu.Unlock()
+
+	used, ok = d.mptcpUsed[conn.LocalAddr().String()]
+
+	return used, ok
+}
+
+// ResolvedAt returns the time when the hostname was resolved for the
+// connection with the same local address as conn and forgets it.  ok is false
+// if the connection was not established by d.
+func (d *Direct) ResolvedAt(conn net.Conn) (at time.Time, ok bool) {
+	d.resolvedMu.Lock()
+	defer d.resolvedMu.Unlock()
+
+	key := conn.LocalAddr().String()
+	at, ok = d.resolved[key]
+	delete(d.resolved, key)
+
+	return at, ok
 }
 
 // Dial implements Dialer for *Direct.
@@ -40,6 +101,8 @@ func (d *Direct) Dial(network, addr string) (conn net.Conn, err error) {
 		return nil, err
 	}
 
+	resolvedAt := time.Now()
+
 	ipAddr := ipAddrs[0]
 	connectAddr := net.JoinHostPort(ipAddr.String(), port)
 
@@ -47,14 +110,48 @@ func (d *Direct) Dial(network, addr string) (conn net.Conn, err error) {
 		d.out.Debug("Connecting to %s://%s", network, connectAddr)
 	}
 
-	conn, err = net.Dial(network, net.JoinHostPort(ipAddr.String(), port))
+	dialer := &net.Dialer{}
+	if d.sockOpts != nil {
+		dialer.Control = d.sockOpts.control
+	}
+
+	if d.mptcpUsed != nil {
+		dialer.SetMultipathTCP(true)
+	}
+
+	conn, err = dialer.Dial(network, connectAddr)
 	if err != nil {
 		return nil, err
 	}
 
+	d.resolvedMu.Lock()
+	d.resolved[conn.LocalAddr().String()] = resolvedAt
+	d.resolvedMu.Unlock()
+
+	if tcpConn, ok := conn.(*net.TCPConn); ok && d.mptcpUsed != nil {
+		d.trackMultipathTCP(tcpConn)
+	}
+
 	if _, ok := conn.(*net.UDPConn); ok {
 		return &udpConn{Conn: conn}, nil
 	}
 
 	return conn, nil
 }
+
+// trackMultipathTCP checks if MPTCP is used by conn and saves the result.
+func (d *Direct) trackMultipathTCP(conn *net.TCPConn) {
+	used, err := conn.MultipathTCP()
+	if err != nil {
+		d.out.Debug("Failed to check if MPTCP is used: %v", err)
+
+		return
+	}
+
+	d.out.Debug("MPTCP is used: %t", used)
+
+	d.mptcpMu.Lock()
+	defer d.mptcpMu.Unlock()
+
+	d.mptcpUsed[conn.LocalAddr().String()] = used
+}
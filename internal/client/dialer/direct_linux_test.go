@@ -0,0 +1,51 @@
+//go:build linux
+
+package dialer_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/ameshkov/gocurl/internal/client/dialer"
+	"github.com/ameshkov/gocurl/internal/config"
+	"github.com/ameshkov/gocurl/internal/output"
+	"github.com/ameshkov/gocurl/internal/resolve"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestDirect_Dial_tcpMSS(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = l.Close() })
+
+	out, err := output.NewOutput("", false)
+	require.NoError(t, err)
+
+	r, err := resolve.NewResolver(&config.Config{}, out)
+	require.NoError(t, err)
+
+	const mss = 1000
+	d := dialer.NewDirect(r, &dialer.SocketOptions{MSS: mss}, false, out)
+
+	conn, err := d.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	rawConn, err := conn.(*net.TCPConn).SyscallConn()
+	require.NoError(t, err)
+
+	var got int
+	var sysErr error
+	err = rawConn.Control(func(fd uintptr) {
+		got, sysErr = unix.GetsockoptInt(int(fd), unix.IPPROTO_TCP, unix.TCP_MAXSEG)
+	})
+	require.NoError(t, err)
+	require.NoError(t, sysErr)
+
+	// The loopback MTU is much larger, so the MSS is limited by the option.
+	// The connected socket reports the effective MSS that doesn't include the
+	// TCP options, e.g. timestamps.
+	require.Positive(t, got)
+	require.LessOrEqual(t, got, mss)
+}
@@ -0,0 +1,45 @@
+package dialer_test
+
+import (
+	"net"
+	"runtime"
+	"testing"
+
+	"github.com/ameshkov/gocurl/internal/client/dialer"
+	"github.com/ameshkov/gocurl/internal/config"
+	"github.com/ameshkov/gocurl/internal/output"
+	"github.com/ameshkov/gocurl/internal/resolve"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/ipv4"
+)
+
+func TestDirect_Dial_socketOptions(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = l.Close() })
+
+	out, err := output.NewOutput("", false)
+	require.NoError(t, err)
+
+	r, err := resolve.NewResolver(&config.Config{}, out)
+	require.NoError(t, err)
+
+	d := dialer.NewDirect(r, &dialer.SocketOptions{TOS: 0x20, TTL: 42}, false, out)
+
+	conn, err := d.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	ttl, err := ipv4.NewConn(conn).TTL()
+	require.NoError(t, err)
+	require.Equal(t, 42, ttl)
+
+	if runtime.GOOS == "windows" {
+		// Windows ignores IP_TOS unless it's allowed by the system policy.
+		return
+	}
+
+	tos, err := ipv4.NewConn(conn).TOS()
+	require.NoError(t, err)
+	require.Equal(t, 0x20, tos)
+}
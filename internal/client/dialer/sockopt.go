@@ -0,0 +1,120 @@
+package dialer
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// SocketOptions are the IP-level options that are applied to the sockets
+// before connecting.
+type SocketOptions struct {
+	// TOS is the value of the IP TOS field (traffic class for IPv6).  Zero
+	// means that the system default is used.
+	TOS int
+
+	// TTL is the IP TTL (hop limit for IPv6).  Zero means that the system
+	// default is used.
+	TTL int
+
+	// MSS is the TCP maximum segment size.  It's only applied to TCP sockets.
+	// Zero means that the system default is used.
+	MSS int
+
+	// Raw is the list of arbitrary integer socket options, see --sockopt.
+	Raw []*RawSocketOption
+}
+
+// RawSocketOption is an arbitrary integer socket option.
+type RawSocketOption struct {
+	// Level is the option level, for instance, IPPROTO_TCP.
+	Level int
+
+	// Name is the option name, for instance, TCP_USER_TIMEOUT.
+	Name int
+
+	// Value is the option value.
+	Value int
+}
+
+// ParseRawSocketOption parses the socket option in the "level:name:value"
+// format.  Level and name can be either numbers or symbolic names of the
+// constants, for instance, "IPPROTO_TCP:TCP_USER_TIMEOUT:1000".  The list of
+// supported symbolic names depends on the platform.
+func ParseRawSocketOption(s string) (o *RawSocketOption, err error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid socket option format: %s", s)
+	}
+
+	o = &RawSocketOption{}
+
+	o.Level, err = parseSocketOptionConst(parts[0], socketOptionLevels)
+	if err != nil {
+		return nil, fmt.Errorf("invalid socket option level: %w", err)
+	}
+
+	o.Name, err = parseSocketOptionConst(parts[1], socketOptionNames)
+	if err != nil {
+		return nil, fmt.Errorf("invalid socket option name: %w", err)
+	}
+
+	o.Value, err = strconv.Atoi(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid socket option value: %w", err)
+	}
+
+	return o, nil
+}
+
+// parseSocketOptionConst parses s which is either a number or a name from
+// consts.
+func parseSocketOptionConst(s string, consts map[string]int) (v int, err error) {
+	if v, ok := consts[strings.ToUpper(s)]; ok {
+		return v, nil
+	}
+
+	v, err = strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("unknown constant %s", s)
+	}
+
+	return v, nil
+}
+
+// control is the function for net.Dialer.Control that applies the socket
+// options.
+func (o *SocketOptions) control(network, _ string, c syscall.RawConn) (err error) {
+	ipv6 := strings.HasSuffix(network, "6")
+
+	var sysErr error
+	tcp := strings.HasPrefix(network, "tcp")
+	err = c.Control(func(fd uintptr) {
+		sysErr = setSocketOptions(fd, ipv6, o)
+		if sysErr == nil && o.MSS != 0 && tcp {
+			sysErr = setTCPMSS(fd, o.MSS)
+		}
+
+		for _, raw := range o.Raw {
+			if sysErr != nil {
+				return
+			}
+
+			// TCP-level options make no sense for UDP sockets.
+			if raw.Level == socketOptionLevels["IPPROTO_TCP"] && !tcp {
+				continue
+			}
+
+			sysErr = setSocketOptionInt(fd, raw.Level, raw.Name, raw.Value)
+		}
+	})
+
+	err = errors.Join(err, sysErr)
+	if err != nil {
+		return fmt.Errorf("setting socket options: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,20 @@
+//go:build linux
+
+package dialer
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// platformSocketOptionNames are the symbolic names of Linux-specific socket
+// options.
+var platformSocketOptionNames = map[string]int{
+	"SO_MARK":          unix.SO_MARK,
+	"IP_FREEBIND":      unix.IP_FREEBIND,
+	"IP_TRANSPARENT":   unix.IP_TRANSPARENT,
+	"TCP_USER_TIMEOUT": unix.TCP_USER_TIMEOUT,
+	"TCP_QUICKACK":     unix.TCP_QUICKACK,
+	"TCP_KEEPIDLE":     unix.TCP_KEEPIDLE,
+	"TCP_KEEPINTVL":    unix.TCP_KEEPINTVL,
+	"TCP_KEEPCNT":      unix.TCP_KEEPCNT,
+}
@@ -0,0 +1,28 @@
+//go:build !unix && !windows
+
+package dialer
+
+import (
+	"errors"
+)
+
+// setSocketOptions is not supported on this platform.
+func setSocketOptions(_ uintptr, _ bool, _ *SocketOptions) (err error) {
+	return errors.New("socket options are not supported on this platform")
+}
+
+// setTCPMSS is not supported on this platform.
+func setTCPMSS(_ uintptr, _ int) (err error) {
+	return errors.New("tcp mss is not supported on this platform")
+}
+
+// setSocketOptionInt is not supported on this platform.
+func setSocketOptionInt(_ uintptr, _, _, _ int) (err error) {
+	return errors.New("socket options are not supported on this platform")
+}
+
+// socketOptionLevels are the symbolic names of socket option levels.
+var socketOptionLevels = map[string]int{}
+
+// socketOptionNames are the symbolic names of socket options.
+var socketOptionNames = map[string]int{}
@@ -0,0 +1,51 @@
+package dialer_test
+
+import (
+	"testing"
+
+	"github.com/ameshkov/gocurl/internal/client/dialer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRawSocketOption(t *testing.T) {
+	testCases := []struct {
+		name    string
+		in      string
+		want    *dialer.RawSocketOption
+		wantErr bool
+	}{{
+		name: "numeric",
+		in:   "6:18:1000",
+		want: &dialer.RawSocketOption{Level: 6, Name: 18, Value: 1000},
+	}, {
+		name: "symbolic",
+		in:   "ipproto_tcp:TCP_NODELAY:1",
+		want: &dialer.RawSocketOption{Level: 6, Name: 1, Value: 1},
+	}, {
+		name:    "unknown_name",
+		in:      "IPPROTO_TCP:TCP_UNKNOWN:1",
+		wantErr: true,
+	}, {
+		name:    "bad_format",
+		in:      "6:18",
+		wantErr: true,
+	}, {
+		name:    "bad_value",
+		in:      "6:18:abc",
+		wantErr: true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			o, err := dialer.ParseRawSocketOption(tc.in)
+			if tc.wantErr {
+				require.Error(t, err)
+
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tc.want, o)
+		})
+	}
+}
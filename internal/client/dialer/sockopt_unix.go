@@ -0,0 +1,72 @@
+//go:build unix
+
+package dialer
+
+import (
+	"maps"
+
+	"golang.org/x/sys/unix"
+)
+
+// setSocketOptions applies opts to the socket fd.
+func setSocketOptions(fd uintptr, ipv6 bool, opts *SocketOptions) (err error) {
+	level, tosOpt, ttlOpt := unix.IPPROTO_IP, unix.IP_TOS, unix.IP_TTL
+	if ipv6 {
+		level, tosOpt, ttlOpt = unix.IPPROTO_IPV6, unix.IPV6_TCLASS, unix.IPV6_UNICAST_HOPS
+	}
+
+	if opts.TOS != 0 {
+		err = unix.SetsockoptInt(int(fd), level, tosOpt, opts.TOS)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.TTL != 0 {
+		err = unix.SetsockoptInt(int(fd), level, ttlOpt, opts.TTL)
+	}
+
+	return err
+}
+
+// setTCPMSS sets the TCP maximum segment size of the socket fd.
+func setTCPMSS(fd uintptr, mss int) (err error) {
+	return unix.SetsockoptInt(int(fd), unix.IPPROTO_TCP, unix.TCP_MAXSEG, mss)
+}
+
+// setSocketOptionInt sets an arbitrary integer socket option.
+func setSocketOptionInt(fd uintptr, level, name, value int) (err error) {
+	return unix.SetsockoptInt(int(fd), level, name, value)
+}
+
+// socketOptionLevels are the symbolic names of socket option levels.
+var socketOptionLevels = map[string]int{
+	"SOL_SOCKET":   unix.SOL_SOCKET,
+	"IPPROTO_IP":   unix.IPPROTO_IP,
+	"IPPROTO_IPV6": unix.IPPROTO_IPV6,
+	"IPPROTO_TCP":  unix.IPPROTO_TCP,
+	"IPPROTO_UDP":  unix.IPPROTO_UDP,
+}
+
+// socketOptionNames are the symbolic names of socket options.
+var socketOptionNames = mergeNames(map[string]int{
+	"SO_KEEPALIVE":      unix.SO_KEEPALIVE,
+	"SO_RCVBUF":         unix.SO_RCVBUF,
+	"SO_SNDBUF":         unix.SO_SNDBUF,
+	"SO_REUSEADDR":      unix.SO_REUSEADDR,
+	"IP_TOS":            unix.IP_TOS,
+	"IP_TTL":            unix.IP_TTL,
+	"IPV6_TCLASS":       unix.IPV6_TCLASS,
+	"IPV6_UNICAST_HOPS": unix.IPV6_UNICAST_HOPS,
+	"TCP_NODELAY":       unix.TCP_NODELAY,
+	"TCP_MAXSEG":        unix.TCP_MAXSEG,
+}, platformSocketOptionNames)
+
+// mergeNames returns a new map with the contents of both maps.
+func mergeNames(a, b map[string]int) (res map[string]int) {
+	res = make(map[string]int, len(a)+len(b))
+	maps.Copy(res, a)
+	maps.Copy(res, b)
+
+	return res
+}
@@ -0,0 +1,7 @@
+//go:build unix && !linux
+
+package dialer
+
+// platformSocketOptionNames are the symbolic names of platform-specific socket
+// options.
+var platformSocketOptionNames = map[string]int{}
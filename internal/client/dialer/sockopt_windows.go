@@ -0,0 +1,71 @@
+//go:build windows
+
+package dialer
+
+import (
+	"errors"
+
+	"golang.org/x/sys/windows"
+)
+
+// setSocketOptions applies opts to the socket fd.  Note, that Windows ignores
+// IP_TOS unless it's configured by the system policy.
+func setSocketOptions(fd uintptr, ipv6 bool, opts *SocketOptions) (err error) {
+	h := windows.Handle(fd)
+
+	if !ipv6 {
+		if opts.TOS != 0 {
+			err = windows.SetsockoptInt(h, windows.IPPROTO_IP, windows.IP_TOS, opts.TOS)
+			if err != nil {
+				return err
+			}
+		}
+
+		if opts.TTL != 0 {
+			err = windows.SetsockoptInt(h, windows.IPPROTO_IP, windows.IP_TTL, opts.TTL)
+		}
+
+		return err
+	}
+
+	if opts.TOS != 0 {
+		return errors.New("traffic class is not supported for ipv6 on windows")
+	}
+
+	if opts.TTL != 0 {
+		err = windows.SetsockoptInt(h, windows.IPPROTO_IPV6, windows.IPV6_UNICAST_HOPS, opts.TTL)
+	}
+
+	return err
+}
+
+// setTCPMSS sets the TCP maximum segment size of the socket fd.
+func setTCPMSS(fd uintptr, mss int) (err error) {
+	return windows.SetsockoptInt(windows.Handle(fd), windows.IPPROTO_TCP, windows.TCP_MAXSEG, mss)
+}
+
+// setSocketOptionInt sets an arbitrary integer socket option.
+func setSocketOptionInt(fd uintptr, level, name, value int) (err error) {
+	return windows.SetsockoptInt(windows.Handle(fd), level, name, value)
+}
+
+// socketOptionLevels are the symbolic names of socket option levels.
+var socketOptionLevels = map[string]int{
+	"SOL_SOCKET":   windows.SOL_SOCKET,
+	"IPPROTO_IP":   windows.IPPROTO_IP,
+	"IPPROTO_IPV6": windows.IPPROTO_IPV6,
+	"IPPROTO_TCP":  windows.IPPROTO_TCP,
+	"IPPROTO_UDP":  windows.IPPROTO_UDP,
+}
+
+// socketOptionNames are the symbolic names of socket options.
+var socketOptionNames = map[string]int{
+	"SO_KEEPALIVE":      windows.SO_KEEPALIVE,
+	"SO_RCVBUF":         windows.SO_RCVBUF,
+	"SO_SNDBUF":         windows.SO_SNDBUF,
+	"SO_REUSEADDR":      windows.SO_REUSEADDR,
+	"IP_TOS":            windows.IP_TOS,
+	"IP_TTL":            windows.IP_TTL,
+	"IPV6_UNICAST_HOPS": windows.IPV6_UNICAST_HOPS,
+	"TCP_NODELAY":       windows.TCP_NODELAY,
+}
@@ -0,0 +1,117 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ameshkov/gocurl/internal/output"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// h3TryHandshakeTimeout is the QUIC handshake timeout when HTTP/3 is only
+// attempted, see --http3-try.  It is shorter than the default one so that the
+// fallback does not take too long when UDP is blocked.
+const h3TryHandshakeTimeout = 3 * time.Second
+
+// h3FallbackTransport is a http.RoundTripper that attempts HTTP/3 first and
+// falls back to HTTP/2 or HTTP/1.1 if it fails.  Once HTTP/3 failed for a
+// host, it is not attempted for that host again.
+type h3FallbackTransport struct {
+	out *output.Output
+	h3  http.RoundTripper
+	h12 http.RoundTripper
+
+	// failedMu protects failed.
+	failedMu *sync.Mutex
+
+	// failed is the set of hosts for which HTTP/3 failed.
+	failed map[string]struct{}
+}
+
+// type check
+var _ http.RoundTripper = (*h3FallbackTransport)(nil)
+
+// createH3FallbackTransport creates a http.RoundTripper that attempts HTTP/3
+// first and falls back to HTTP/2 or HTTP/1.1.
+func createH3FallbackTransport(d *clientDialer, out *output.Output) (rt http.RoundTripper, err error) {
+	h12, err := createH12Transport(d)
+	if err != nil {
+		return nil, err
+	}
+
+	quicConfig := newQUICConfig(d.cfg)
+	quicConfig.HandshakeIdleTimeout = h3TryHandshakeTimeout
+
+	return &h3FallbackTransport{
+		out: out,
+		h3: &http3.RoundTripper{
+			DisableCompression:     true,
+			Dial:                   d.DialQUIC,
+			MaxResponseHeaderBytes: d.cfg.MaxHeaderSize,
+			QuicConfig:             quicConfig,
+		},
+		h12:      h12,
+		failedMu: &sync.Mutex{},
+		failed:   map[string]struct{}{},
+	}, nil
+}
+
+// RoundTrip implements the http.RoundTripper interface for
+// *h3FallbackTransport.
+func (t *h3FallbackTransport) RoundTrip(r *http.Request) (resp *http.Response, err error) {
+	if r.URL.Scheme != "https" || t.isFailed(r.URL.Host) {
+		return t.h12.RoundTrip(r)
+	}
+
+	// Make sure the request body can be sent again.
+	if r.Body != nil && r.GetBody == nil {
+		return nil, fmt.Errorf("cannot attempt http3 with a request body that cannot be re-sent")
+	}
+
+	t.out.Debug("Attempting HTTP/3 for %s", r.URL.Host)
+
+	resp, err = t.h3.RoundTrip(r)
+	if err == nil {
+		t.out.Debug("HTTP/3 succeeded for %s", r.URL.Host)
+
+		return resp, nil
+	}
+
+	t.out.Debug("HTTP/3 failed for %s, falling back to HTTP/2 or HTTP/1.1: %v", r.URL.Host, err)
+	t.setFailed(r.URL.Host)
+
+	if r.GetBody != nil {
+		r = r.Clone(r.Context())
+		r.Body, err = r.GetBody()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err = t.h12.RoundTrip(r)
+	if err == nil {
+		t.out.Debug("Fell back to %s for %s", resp.Proto, r.URL.Host)
+	}
+
+	return resp, err
+}
+
+// isFailed returns true if HTTP/3 already failed for host.
+func (t *h3FallbackTransport) isFailed(host string) (ok bool) {
+	t.failedMu.Lock()
+	defer t.failedMu.Unlock()
+
+	_, ok = t.failed[host]
+
+	return ok
+}
+
+// setFailed remembers that HTTP/3 failed for host.
+func (t *h3FallbackTransport) setFailed(host string) {
+	t.failedMu.Lock()
+	defer t.failedMu.Unlock()
+
+	t.failed[host] = struct{}{}
+}
@@ -0,0 +1,185 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ameshkov/gocurl/internal/config"
+)
+
+// quoteEscaper escapes the quoted parameters of Content-Disposition.
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// multipartBody is the multipart/form-data body, see --form.  The files are
+// read when the body is sent so that large files are not loaded to memory.
+type multipartBody struct {
+	// contentType is the content type of the body with the boundary.
+	contentType string
+
+	// parts are the consecutive parts of the body.
+	parts []bodyPart
+
+	// size is the total size of the body.  It is -1 if one of the files is
+	// a pipe.
+	size int64
+}
+
+// bodyPart is either the data or the file at path.
+type bodyPart struct {
+	data []byte
+	path string
+}
+
+// newMultipartBody returns the multipart/form-data body with fields.  The
+// sizes of the files are taken when the body is created.
+func newMultipartBody(fields []*config.FormField) (b *multipartBody, err error) {
+	buf := &bytes.Buffer{}
+	w := multipart.NewWriter(buf)
+	b = &multipartBody{contentType: w.FormDataContentType()}
+
+	for _, f := range fields {
+		err = b.addField(w, buf, f)
+		if err != nil {
+			return nil, fmt.Errorf("form field %q: %w", f.Name, err)
+		}
+	}
+
+	err = w.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	b.addData(buf)
+
+	return b, nil
+}
+
+// addField writes the part of the field f to w.  The file of f is added
+// separately, and buf, which w writes to, is flushed to the body before.
+func (b *multipartBody) addField(w *multipart.Writer, buf *bytes.Buffer, f *config.FormField) (err error) {
+	h := formFieldHeader(f)
+	pw, err := w.CreatePart(h)
+	if err != nil {
+		return err
+	}
+
+	if f.File == "" {
+		_, err = io.WriteString(pw, f.Value)
+
+		return err
+	}
+
+	fi, err := os.Stat(f.File)
+	if err != nil {
+		return err
+	}
+
+	b.addData(buf)
+	b.parts = append(b.parts, bodyPart{path: f.File})
+	b.addSize(fi.Size())
+	if !fi.Mode().IsRegular() {
+		// The size of the data from the pipe is unknown until it's read.
+		b.size = -1
+	}
+
+	return nil
+}
+
+// addData moves the data written to buf to the body.
+func (b *multipartBody) addData(buf *bytes.Buffer) {
+	if buf.Len() == 0 {
+		return
+	}
+
+	b.parts = append(b.parts, bodyPart{data: bytes.Clone(buf.Bytes())})
+	b.addSize(int64(buf.Len()))
+	buf.Reset()
+}
+
+// addSize adds n to the size of the body unless it's unknown.
+func (b *multipartBody) addSize(n int64) {
+	if b.size >= 0 {
+		b.size += n
+	}
+}
+
+// reader returns the new reader of the body.
+func (b *multipartBody) reader() (r io.Reader) {
+	readers := make([]io.Reader, 0, len(b.parts))
+	for _, p := range b.parts {
+		if p.path != "" {
+			readers = append(readers, &fileReader{path: p.path})
+		} else {
+			readers = append(readers, bytes.NewReader(p.data))
+		}
+	}
+
+	return io.MultiReader(readers...)
+}
+
+// formFieldHeader returns the header of the part of the field f.  Like in
+// curl, the content type of files is guessed from the extension unless it's
+// specified explicitly.
+func formFieldHeader(f *config.FormField) (h textproto.MIMEHeader) {
+	h = textproto.MIMEHeader{}
+
+	disposition := fmt.Sprintf(`form-data; name="%s"`, quoteEscaper.Replace(f.Name))
+	filename := f.Filename
+	if filename == "" && f.File != "" {
+		filename = filepath.Base(f.File)
+	}
+
+	if filename != "" {
+		disposition += fmt.Sprintf(`; filename="%s"`, quoteEscaper.Replace(filename))
+	}
+
+	h.Set("Content-Disposition", disposition)
+
+	contentType := f.ContentType
+	if contentType == "" && f.File != "" {
+		contentType = mime.TypeByExtension(filepath.Ext(f.File))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+	}
+
+	if contentType != "" {
+		h.Set("Content-Type", contentType)
+	}
+
+	return h
+}
+
+// fileReader is the reader of the file that is opened on the first Read and
+// closed once it's read.
+type fileReader struct {
+	f    *os.File
+	path string
+}
+
+// type check
+var _ io.Reader = (*fileReader)(nil)
+
+// Read implements the io.Reader interface for *fileReader.
+func (r *fileReader) Read(p []byte) (n int, err error) {
+	if r.f == nil {
+		r.f, err = os.Open(r.path)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n, err = r.f.Read(p)
+	if err != nil {
+		_ = r.f.Close()
+	}
+
+	return n, err
+}
@@ -0,0 +1,201 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"net"
+	"sync"
+
+	"github.com/ameshkov/gocurl/internal/output"
+)
+
+// maxRecordedHeaderSize is the maximum size of the HTTP/1.x response header
+// that is recorded to preserve the wire order of the header fields.  Larger
+// headers are not recorded.
+const maxRecordedHeaderSize = 1 << 20
+
+// dialContextFunc is the signature of the dial functions of http.Transport.
+type dialContextFunc func(ctx context.Context, network, addr string) (conn net.Conn, err error)
+
+// withHeaderRecording wraps dial so that the HTTP/1.x connections it returns
+// record the raw response header.  net/http parses the header into a map so
+// this is the only way to preserve the wire order of the header fields.
+// HTTP/2 and HTTP/3 responses are not recorded, their header fields are
+// sorted by name, see output.HeaderOrderAlphabetical.
+func withHeaderRecording(dial dialContextFunc) (f dialContextFunc) {
+	return func(ctx context.Context, network, addr string) (conn net.Conn, err error) {
+		conn, err = dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		return newRecordingConn(conn), nil
+	}
+}
+
+// headerRecorder is implemented by the connections that record the raw
+// response header.
+type headerRecorder interface {
+	// startRecording starts recording the next response header.
+	startRecording()
+
+	// recordedHeader returns the header fields of the last recorded response
+	// header or nil if it wasn't recorded.
+	recordedHeader() (fields []*output.HeaderField)
+}
+
+// recordingConn is a net.Conn that records the raw HTTP/1.x response header.
+type recordingConn struct {
+	net.Conn
+
+	// mu protects the fields below.
+	mu        *sync.Mutex
+	buf       []byte
+	header    []byte
+	recording bool
+}
+
+// type check
+var _ headerRecorder = (*recordingConn)(nil)
+
+// recordingTLSConn is a recordingConn over a TLS connection.
+type recordingTLSConn struct {
+	*recordingConn
+
+	stater tlsConnectionStater
+}
+
+// tlsConnectionStater is implemented by the TLS connections of both crypto/tls
+// and its Cloudflare fork.
+type tlsConnectionStater interface {
+	ConnectionState() tls.ConnectionState
+}
+
+// ConnectionState returns the state of the underlying TLS connection.
+func (c *recordingTLSConn) ConnectionState() (state tls.ConnectionState) {
+	return c.stater.ConnectionState()
+}
+
+// newRecordingConn wraps conn so that it records the response header.  HTTP/2
+// connections are returned as is.
+func newRecordingConn(conn net.Conn) (c net.Conn) {
+	rc := &recordingConn{
+		Conn: conn,
+		mu:   &sync.Mutex{},
+	}
+
+	stater, ok := conn.(tlsConnectionStater)
+	if !ok {
+		return rc
+	}
+
+	if stater.ConnectionState().NegotiatedProtocol == "h2" {
+		// net/http needs *tls.Conn to upgrade to HTTP/2.
+		return conn
+	}
+
+	return &recordingTLSConn{
+		recordingConn: rc,
+		stater:        stater,
+	}
+}
+
+// startRecording implements the headerRecorder interface for *recordingConn.
+func (c *recordingConn) startRecording() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.buf = c.buf[:0]
+	c.header = nil
+	c.recording = true
+}
+
+// recordedHeader implements the headerRecorder interface for *recordingConn.
+func (c *recordingConn) recordedHeader() (fields []*output.HeaderField) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.header == nil {
+		return nil
+	}
+
+	return parseRawHeader(c.header)
+}
+
+// Read implements the net.Conn interface for *recordingConn.
+func (c *recordingConn) Read(b []byte) (n int, err error) {
+	n, err = c.Conn.Read(b)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.recording && n > 0 {
+		c.record(b[:n])
+	}
+
+	return n, err
+}
+
+// record appends data to the buffer and stops recording once the complete
+// final response header is received, see isInterimHeader.  c.mu must be
+// locked.
+func (c *recordingConn) record(data []byte) {
+	c.buf = append(c.buf, data...)
+
+	for {
+		idx := bytes.Index(c.buf, []byte("\r\n\r\n"))
+		if idx < 0 {
+			if len(c.buf) > maxRecordedHeaderSize {
+				c.buf = nil
+				c.recording = false
+			}
+
+			return
+		}
+
+		block := c.buf[:idx]
+		c.buf = c.buf[idx+4:]
+		if isInterimHeader(block) {
+			// Informational response, the final one follows.
+			continue
+		}
+
+		c.header = append([]byte(nil), block...)
+		c.buf = c.buf[:0]
+		c.recording = false
+
+		return
+	}
+}
+
+// isInterimHeader returns true if block is the header of an informational
+// (1xx) response that is followed by another response header.  101 Switching
+// Protocols is the final one as the connection switches to another protocol
+// right after it.
+func isInterimHeader(block []byte) (ok bool) {
+	if !bytes.HasPrefix(block, []byte("HTTP/1.1 1")) && !bytes.HasPrefix(block, []byte("HTTP/1.0 1")) {
+		return false
+	}
+
+	return !bytes.HasPrefix(block[len("HTTP/1.x "):], []byte("101"))
+}
+
+// parseRawHeader parses the raw HTTP/1.x response header without the status
+// line.  Obsolete line folding is not supported, such lines are skipped.
+func parseRawHeader(raw []byte) (fields []*output.HeaderField) {
+	lines := bytes.Split(raw, []byte("\r\n"))
+	for _, line := range lines[1:] {
+		name, value, ok := bytes.Cut(line, []byte(":"))
+		if !ok {
+			continue
+		}
+
+		fields = append(fields, &output.HeaderField{
+			Name:  string(name),
+			Value: string(bytes.TrimSpace(value)),
+		})
+	}
+
+	return fields
+}
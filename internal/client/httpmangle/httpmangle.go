@@ -0,0 +1,183 @@
+// Package httpmangle implements the --http-mangle logic that modifies plain
+// HTTP requests in order to test how DPI systems filter HTTP by keywords.
+package httpmangle
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/ameshkov/gocurl/internal/client/dialer"
+	"github.com/ameshkov/gocurl/internal/output"
+)
+
+// Mode is a way to modify the HTTP request.
+type Mode string
+
+// Mode values.
+const (
+	// ModeHostCase mixes the case of the Host header name and value.
+	ModeHostCase Mode = "host-case"
+
+	// ModeSpace inserts an extra space in the request line after the method.
+	ModeSpace Mode = "space"
+
+	// ModeSplit splits the request in two writes in the middle of the Host
+	// header value.
+	ModeSplit Mode = "split"
+)
+
+// CreateDialFunc creates a dialFunc that modifies the first plain HTTP request
+// sent over the connection according to modes.  Returns an error if there are
+// unknown modes.
+func CreateDialFunc(
+	modes []string,
+	baseDial dialer.DialFunc,
+	out *output.Output,
+) (f dialer.DialFunc, err error) {
+	out.Debug("Mangling HTTP requests is enabled. Modes are %v", modes)
+
+	m := map[Mode]bool{}
+	for _, s := range modes {
+		switch mode := Mode(s); mode {
+		case ModeHostCase, ModeSpace, ModeSplit:
+			m[mode] = true
+		default:
+			return nil, fmt.Errorf("unknown http-mangle mode: %s", s)
+		}
+	}
+
+	return func(network, addr string) (conn net.Conn, err error) {
+		conn, err = baseDial(network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		return &mangleConn{
+			Conn:  conn,
+			modes: m,
+			out:   out,
+		}, nil
+	}, nil
+}
+
+// mangleConn is the implementation of net.Conn which only purpose is to wait
+// for the first HTTP request and modify it.
+type mangleConn struct {
+	net.Conn
+
+	// out is required for debug-level logging.
+	out *output.Output
+
+	// modes is the set of enabled modes.
+	modes map[Mode]bool
+
+	// done is set to true when the first write has been processed.
+	done bool
+}
+
+// type check
+var _ dialer.WrappedConn = (*mangleConn)(nil)
+
+// Unwrap implements the dialer.WrappedConn interface for *mangleConn.
+func (c *mangleConn) Unwrap() (conn net.Conn) {
+	return c.Conn
+}
+
+// Write implements net.Conn for *mangleConn.  Its purpose is to find the first
+// HTTP request and modify it.
+func (c *mangleConn) Write(b []byte) (n int, err error) {
+	if c.done {
+		return c.Conn.Write(b)
+	}
+
+	c.done = true
+
+	headEnd := bytes.Index(b, []byte("\r\n\r\n"))
+	if headEnd < 0 || !isHTTPRequest(b) {
+		return c.Conn.Write(b)
+	}
+
+	head, splitPos := mangle(string(b[:headEnd]), c.modes)
+	c.out.Debug("Found HTTP request, mangled it:\n%s", head)
+
+	req := append([]byte(head), b[headEnd:]...)
+	chunks := [][]byte{req}
+	if splitPos > 0 {
+		chunks = [][]byte{req[:splitPos], req[splitPos:]}
+	}
+
+	for _, chunk := range chunks {
+		_, err = c.Conn.Write(chunk)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(b), nil
+}
+
+// isHTTPRequest returns true if b starts with an HTTP request line.
+func isHTTPRequest(b []byte) (ok bool) {
+	line, _, _ := bytes.Cut(b, []byte("\r\n"))
+
+	return bytes.HasSuffix(line, []byte(" HTTP/1.1")) || bytes.HasSuffix(line, []byte(" HTTP/1.0"))
+}
+
+// mangle modifies the request head (request line and headers without the
+// final empty line) according to modes.  If ModeSplit is enabled, splitPos is
+// the position where the result must be split.
+func mangle(head string, modes map[Mode]bool) (res string, splitPos int) {
+	if modes[ModeSpace] {
+		head = strings.Replace(head, " ", "  ", 1)
+	}
+
+	hostStart, hostEnd := findHost(head)
+	if modes[ModeHostCase] && hostStart > 0 {
+		head = head[:hostStart-len("Host: ")] +
+			"hOsT: " +
+			mixCase(head[hostStart:hostEnd]) +
+			head[hostEnd:]
+	}
+
+	if !modes[ModeSplit] {
+		return head, 0
+	}
+
+	if hostStart > 0 {
+		return head, hostStart + (hostEnd-hostStart)/2
+	}
+
+	// There is no Host header, split the request line then.
+	return head, strings.Index(head, " ") + 1
+}
+
+// findHost returns the position of the Host header value in head or zeros if
+// there is no such header.
+func findHost(head string) (start, end int) {
+	idx := strings.Index(strings.ToLower(head), "\r\nhost: ")
+	if idx < 0 {
+		return 0, 0
+	}
+
+	start = idx + len("\r\nhost: ")
+	end = strings.Index(head[start:], "\r\n")
+	if end < 0 {
+		return start, len(head)
+	}
+
+	return start, start + end
+}
+
+// mixCase returns s with letters in alternating case.
+func mixCase(s string) (res string) {
+	b := []byte(s)
+	for i := 1; i < len(b); i += 2 {
+		if b[i] >= 'a' && b[i] <= 'z' {
+			b[i] -= 'a' - 'A'
+		}
+	}
+
+	return string(b)
+}
@@ -0,0 +1,108 @@
+package httpmangle_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/ameshkov/gocurl/internal/client/httpmangle"
+	"github.com/ameshkov/gocurl/internal/output"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingConn is a net.Conn that records everything written to it.
+type recordingConn struct {
+	net.Conn
+
+	writes []string
+}
+
+// Write implements net.Conn for *recordingConn.
+func (c *recordingConn) Write(b []byte) (n int, err error) {
+	c.writes = append(c.writes, string(b))
+
+	return len(b), nil
+}
+
+func TestCreateDialFunc(t *testing.T) {
+	const req = "GET /path HTTP/1.1\r\nHost: example.org\r\nUser-Agent: test\r\n\r\n"
+
+	testCases := []struct {
+		name   string
+		modes  []string
+		in     string
+		writes []string
+	}{{
+		name:   "host_case",
+		modes:  []string{"host-case"},
+		in:     req,
+		writes: []string{"GET /path HTTP/1.1\r\nhOsT: eXaMpLe.oRg\r\nUser-Agent: test\r\n\r\n"},
+	}, {
+		name:   "space",
+		modes:  []string{"space"},
+		in:     req,
+		writes: []string{"GET  /path HTTP/1.1\r\nHost: example.org\r\nUser-Agent: test\r\n\r\n"},
+	}, {
+		name:  "split",
+		modes: []string{"split"},
+		in:    req,
+		writes: []string{
+			"GET /path HTTP/1.1\r\nHost: examp",
+			"le.org\r\nUser-Agent: test\r\n\r\n",
+		},
+	}, {
+		name:  "split_no_host",
+		modes: []string{"split"},
+		in:    "GET /path HTTP/1.0\r\n\r\n",
+		writes: []string{
+			"GET ",
+			"/path HTTP/1.0\r\n\r\n",
+		},
+	}, {
+		name:  "all",
+		modes: []string{"host-case", "space", "split"},
+		in:    req,
+		writes: []string{
+			"GET  /path HTTP/1.1\r\nhOsT: eXaMp",
+			"Le.oRg\r\nUser-Agent: test\r\n\r\n",
+		},
+	}, {
+		name:   "not_http",
+		modes:  []string{"host-case", "space", "split"},
+		in:     "\x16\x03\x01 binary data\r\n\r\n",
+		writes: []string{"\x16\x03\x01 binary data\r\n\r\n"},
+	}}
+
+	out, err := output.NewOutput("", false)
+	require.NoError(t, err)
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rc := &recordingConn{}
+			dial, err := httpmangle.CreateDialFunc(tc.modes, func(_, _ string) (net.Conn, error) {
+				return rc, nil
+			}, out)
+			require.NoError(t, err)
+
+			conn, err := dial("tcp", "example.org:80")
+			require.NoError(t, err)
+
+			n, err := conn.Write([]byte(tc.in))
+			require.NoError(t, err)
+			require.Equal(t, len(tc.in), n)
+
+			// Only the first request is modified.
+			_, err = conn.Write([]byte(req))
+			require.NoError(t, err)
+
+			require.Equal(t, append(tc.writes, req), rc.writes)
+		})
+	}
+}
+
+func TestCreateDialFunc_unknownMode(t *testing.T) {
+	out, err := output.NewOutput("", false)
+	require.NoError(t, err)
+
+	_, err = httpmangle.CreateDialFunc([]string{"unknown"}, nil, out)
+	require.ErrorContains(t, err, "unknown http-mangle mode")
+}
@@ -0,0 +1,221 @@
+// Package httpsig implements signing requests with HTTP Message Signatures,
+// see RFC 9421.
+package httpsig
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Algorithms, see RFC 9421, section 3.3.
+const (
+	AlgHMACSHA256      = "hmac-sha256"
+	AlgEd25519         = "ed25519"
+	AlgECDSAP256SHA256 = "ecdsa-p256-sha256"
+	AlgRSAPSSSHA512    = "rsa-pss-sha512"
+	AlgRSAV15SHA256    = "rsa-v1_5-sha256"
+)
+
+// Params are the parameters of the signature.
+type Params struct {
+	// Created is the creation time of the signature.
+	Created time.Time
+
+	// Key is the signing key, either []byte for hmac-sha256 or the
+	// crypto.Signer of the corresponding type.
+	Key any
+
+	// Algorithm is the signature algorithm, see Alg constants.
+	Algorithm string
+
+	// KeyID is the identifier of the key.  It's omitted if empty.
+	KeyID string
+
+	// Label is the label of the signature in the Signature-Input and
+	// Signature header fields.
+	Label string
+
+	// Components are the identifiers of the covered components, e.g.
+	// "@method" or "content-type".
+	Components []string
+}
+
+// Sign signs req with body and adds the Signature-Input and Signature header
+// fields to it.  The Content-Digest header field is added if it is covered but
+// is not set, see RFC 9530.
+func Sign(req *http.Request, body []byte, p *Params) (err error) {
+	for _, c := range p.Components {
+		if c == "content-digest" && req.Header.Get("Content-Digest") == "" {
+			sum := sha256.Sum256(body)
+			req.Header.Set("Content-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(sum[:])+":")
+		}
+	}
+
+	base, sigParams, err := signatureBase(req, p)
+	if err != nil {
+		return err
+	}
+
+	sig, err := sign([]byte(base), p.Key, p.Algorithm)
+	if err != nil {
+		return fmt.Errorf("signing with %s: %w", p.Algorithm, err)
+	}
+
+	req.Header.Set("Signature-Input", p.Label+"="+sigParams)
+	req.Header.Set("Signature", p.Label+"=:"+base64.StdEncoding.EncodeToString(sig)+":")
+
+	return nil
+}
+
+// signatureBase returns the signature base of req and the serialized
+// signature parameters, see RFC 9421, section 2.5.
+func signatureBase(req *http.Request, p *Params) (base, sigParams string, err error) {
+	b := &strings.Builder{}
+	ids := make([]string, 0, len(p.Components))
+	for _, c := range p.Components {
+		var v string
+		v, err = componentValue(req, c)
+		if err != nil {
+			return "", "", err
+		}
+
+		id := strconv.Quote(c)
+		ids = append(ids, id)
+		_, _ = fmt.Fprintf(b, "%s: %s\n", id, v)
+	}
+
+	sigParams = "(" + strings.Join(ids, " ") + ");created=" + strconv.FormatInt(p.Created.Unix(), 10)
+	if p.KeyID != "" {
+		sigParams += ";keyid=" + strconv.Quote(p.KeyID)
+	}
+
+	_, _ = fmt.Fprintf(b, "\"@signature-params\": %s", sigParams)
+
+	return b.String(), sigParams, nil
+}
+
+// componentValue returns the value of the component c of req, see RFC 9421,
+// sections 2.1 and 2.2.
+func componentValue(req *http.Request, c string) (v string, err error) {
+	switch c {
+	case "@method":
+		return req.Method, nil
+	case "@target-uri":
+		return req.URL.String(), nil
+	case "@authority":
+		return strings.ToLower(authority(req)), nil
+	case "@scheme":
+		return strings.ToLower(req.URL.Scheme), nil
+	case "@request-target":
+		return req.URL.RequestURI(), nil
+	case "@path":
+		if v = req.URL.EscapedPath(); v == "" {
+			return "/", nil
+		}
+
+		return v, nil
+	case "@query":
+		return "?" + req.URL.RawQuery, nil
+	}
+
+	if strings.HasPrefix(c, "@") {
+		return "", fmt.Errorf("unsupported derived component %q", c)
+	}
+
+	// These fields are not in the header of the outgoing request.
+	switch strings.ToLower(c) {
+	case "host":
+		return authority(req), nil
+	case "content-length":
+		if req.Header.Get("Content-Length") == "" && req.ContentLength > 0 {
+			return strconv.FormatInt(req.ContentLength, 10), nil
+		}
+	}
+
+	values := req.Header.Values(c)
+	if len(values) == 0 {
+		return "", fmt.Errorf("covered header field %q is not set", c)
+	}
+
+	for i, val := range values {
+		values[i] = strings.TrimSpace(val)
+	}
+
+	return strings.Join(values, ", "), nil
+}
+
+// authority returns the host of req as it is sent.
+func authority(req *http.Request) (host string) {
+	if req.Host != "" {
+		return req.Host
+	}
+
+	return req.URL.Host
+}
+
+// sign signs base with key using alg.
+func sign(base []byte, key any, alg string) (sig []byte, err error) {
+	switch k := key.(type) {
+	case []byte:
+		if alg != AlgHMACSHA256 {
+			break
+		}
+
+		mac := hmac.New(sha256.New, k)
+		_, _ = mac.Write(base)
+
+		return mac.Sum(nil), nil
+	case ed25519.PrivateKey:
+		if alg == AlgEd25519 {
+			return ed25519.Sign(k, base), nil
+		}
+	case *ecdsa.PrivateKey:
+		if alg == AlgECDSAP256SHA256 && k.Curve == elliptic.P256() {
+			return signECDSA(k, base)
+		}
+	case *rsa.PrivateKey:
+		switch alg {
+		case AlgRSAPSSSHA512:
+			sum := sha512.Sum512(base)
+
+			return rsa.SignPSS(rand.Reader, k, crypto.SHA512, sum[:], &rsa.PSSOptions{
+				SaltLength: sha512.Size,
+			})
+		case AlgRSAV15SHA256:
+			sum := sha256.Sum256(base)
+
+			return rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, sum[:])
+		}
+	}
+
+	return nil, fmt.Errorf("key of type %T cannot be used", key)
+}
+
+// signECDSA signs base with the P-256 key k.  The signature is the
+// concatenation of r and s, see RFC 9421, section 3.3.4.
+func signECDSA(k *ecdsa.PrivateKey, base []byte) (sig []byte, err error) {
+	sum := sha256.Sum256(base)
+	r, s, err := ecdsa.Sign(rand.Reader, k, sum[:])
+	if err != nil {
+		return nil, err
+	}
+
+	sig = make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+
+	return sig, nil
+}
@@ -0,0 +1,77 @@
+// Package jitter implements the --write-jitter logic that inserts random delays
+// between writes to the connection.
+package jitter
+
+import (
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/ameshkov/gocurl/internal/client/dialer"
+	"github.com/ameshkov/gocurl/internal/output"
+)
+
+// CreateDialFunc creates a dialFunc that waits for a random duration between
+// minDelay and maxDelay milliseconds before every write to a TCP connection
+// except for the first one.
+func CreateDialFunc(
+	minDelay int,
+	maxDelay int,
+	baseDial dialer.DialFunc,
+	out *output.Output,
+) (f dialer.DialFunc) {
+	out.Debug("Write jitter is enabled. Delay is between %d and %d ms", minDelay, maxDelay)
+
+	return func(network, addr string) (conn net.Conn, err error) {
+		conn, err = baseDial(network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		// UDP connections are used by QUIC which requires a PacketConn.
+		if strings.HasPrefix(network, "udp") {
+			return conn, nil
+		}
+
+		return &jitterConn{
+			Conn:     conn,
+			minDelay: minDelay,
+			maxDelay: maxDelay,
+		}, nil
+	}
+}
+
+// jitterConn is the implementation of net.Conn that waits for a random
+// duration before writes.
+type jitterConn struct {
+	net.Conn
+
+	// minDelay is the minimum delay in milliseconds.
+	minDelay int
+
+	// maxDelay is the maximum delay in milliseconds.
+	maxDelay int
+
+	// writeCnt is the number of Write calls.
+	writeCnt int
+}
+
+// type check
+var _ dialer.WrappedConn = (*jitterConn)(nil)
+
+// Unwrap implements the dialer.WrappedConn interface for *jitterConn.
+func (c *jitterConn) Unwrap() (conn net.Conn) {
+	return c.Conn
+}
+
+// Write implements net.Conn for *jitterConn.
+func (c *jitterConn) Write(b []byte) (n int, err error) {
+	c.writeCnt++
+	if c.writeCnt > 1 {
+		delay := c.minDelay + rand.Intn(c.maxDelay-c.minDelay+1)
+		time.Sleep(time.Duration(delay) * time.Millisecond)
+	}
+
+	return c.Conn.Write(b)
+}
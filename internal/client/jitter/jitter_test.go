@@ -0,0 +1,121 @@
+package jitter_test
+
+import (
+	"crypto/tls"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ameshkov/gocurl/internal/client/jitter"
+	"github.com/ameshkov/gocurl/internal/client/splittls"
+	"github.com/ameshkov/gocurl/internal/output"
+	"github.com/stretchr/testify/require"
+)
+
+// timedWrite is a write recorded by timingConn.
+type timedWrite struct {
+	data []byte
+	at   time.Time
+}
+
+// timingConn is a net.Conn that records everything written to it along with
+// the time of the write.
+type timingConn struct {
+	net.Conn
+
+	writes []timedWrite
+}
+
+// Write implements net.Conn for *timingConn.
+func (c *timingConn) Write(b []byte) (n int, err error) {
+	c.writes = append(c.writes, timedWrite{
+		data: append([]byte{}, b...),
+		at:   time.Now(),
+	})
+
+	return len(b), nil
+}
+
+// requireDelays checks that the writes recorded by tc are delayed by minDelay
+// to maxDelay from each other.
+func requireDelays(t *testing.T, tc *timingConn, minDelay, maxDelay time.Duration) {
+	t.Helper()
+
+	// Leave some room for the scheduler.
+	const slack = 100 * time.Millisecond
+
+	for i := 1; i < len(tc.writes); i++ {
+		gap := tc.writes[i].at.Sub(tc.writes[i-1].at)
+		require.GreaterOrEqual(t, gap, minDelay, "write %d", i)
+		require.LessOrEqual(t, gap, maxDelay+slack, "write %d", i)
+	}
+}
+
+func TestCreateDialFunc(t *testing.T) {
+	out, err := output.NewOutput("", false)
+	require.NoError(t, err)
+
+	tc := &timingConn{}
+	dial := jitter.CreateDialFunc(20, 40, func(_, _ string) (net.Conn, error) {
+		return tc, nil
+	}, out)
+
+	conn, err := dial("tcp", "example.org:443")
+	require.NoError(t, err)
+
+	for _, s := range []string{"first", "second", "third"} {
+		_, err = conn.Write([]byte(s))
+		require.NoError(t, err)
+	}
+
+	// Every write is passed through as is.
+	require.Len(t, tc.writes, 3)
+	require.Equal(t, "first", string(tc.writes[0].data))
+	require.Equal(t, "second", string(tc.writes[1].data))
+	require.Equal(t, "third", string(tc.writes[2].data))
+
+	requireDelays(t, tc, 20*time.Millisecond, 40*time.Millisecond)
+}
+
+func TestCreateDialFunc_splitHello(t *testing.T) {
+	out, err := output.NewOutput("", false)
+	require.NoError(t, err)
+
+	client, server := net.Pipe()
+	t.Cleanup(func() { _ = client.Close() })
+	_ = server.Close()
+
+	tc := &timingConn{Conn: client}
+	jitterDial := jitter.CreateDialFunc(20, 40, func(_, _ string) (net.Conn, error) {
+		return tc, nil
+	}, out)
+	dial := splittls.CreateDialFunc(10, 0, false, jitterDial, out)
+
+	conn, err := dial("tcp", "example.org:443")
+	require.NoError(t, err)
+
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: "example.org"})
+	require.Error(t, tlsConn.Handshake())
+
+	// ClientHello is split into two writes and the second one is delayed.
+	require.Len(t, tc.writes, 2)
+	require.Len(t, tc.writes[0].data, 10)
+	require.Equal(t, byte(0x16), tc.writes[0].data[0])
+
+	requireDelays(t, tc, 20*time.Millisecond, 40*time.Millisecond)
+}
+
+func TestCreateDialFunc_udp(t *testing.T) {
+	out, err := output.NewOutput("", false)
+	require.NoError(t, err)
+
+	tc := &timingConn{}
+	dial := jitter.CreateDialFunc(20, 40, func(_, _ string) (net.Conn, error) {
+		return tc, nil
+	}, out)
+
+	// UDP connections are not wrapped as QUIC requires a PacketConn.
+	conn, err := dial("udp", "example.org:443")
+	require.NoError(t, err)
+	require.Same(t, tc, conn)
+}
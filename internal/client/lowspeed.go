@@ -0,0 +1,155 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrTooSlow is returned when the transfer speed stays below --speed-limit
+// for --speed-time.
+var ErrTooSlow = errors.New("transfer too slow")
+
+// speedMonitor cancels the request if less than limit bytes of the response
+// body per second are received during period, see --speed-limit.  The time
+// before the response header is received counts as zero speed.
+type speedMonitor struct {
+	// cancel cancels the request context.
+	cancel context.CancelFunc
+
+	// stopCh is closed when the monitor is stopped.
+	stopCh chan struct{}
+
+	// stopOnce makes sure that stopCh is closed once.
+	stopOnce *sync.Once
+
+	// read is the number of the response body bytes read so far.
+	read *atomic.Int64
+
+	// aborted is true if the request was canceled by the monitor.
+	aborted *atomic.Bool
+
+	// limit is the minimum speed in bytes per second.
+	limit int64
+
+	// period is the duration during which the speed may stay below limit.
+	period time.Duration
+}
+
+// withSpeedMonitor returns the request that is canceled by the returned
+// monitor if the transfer is too slow.  The monitor is started right away.
+func withSpeedMonitor(
+	r *http.Request,
+	limit int64,
+	period time.Duration,
+) (req *http.Request, m *speedMonitor) {
+	ctx, cancel := context.WithCancel(r.Context())
+	m = &speedMonitor{
+		cancel:   cancel,
+		stopCh:   make(chan struct{}),
+		stopOnce: &sync.Once{},
+		read:     &atomic.Int64{},
+		aborted:  &atomic.Bool{},
+		limit:    limit,
+		period:   period,
+	}
+
+	go m.run()
+
+	return r.WithContext(ctx), m
+}
+
+// run measures the speed every second, or every period if it's shorter, until
+// the monitor is stopped or the request is canceled.
+func (m *speedMonitor) run() {
+	interval := min(time.Second, m.period)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last int64
+	var slowFor time.Duration
+	for {
+		select {
+		case <-m.stopCh:
+			return
+		case <-ticker.C:
+			// Go on.
+		}
+
+		n := m.read.Load()
+		speed := float64(n-last) / interval.Seconds()
+		last = n
+
+		if speed >= float64(m.limit) {
+			slowFor = 0
+
+			continue
+		}
+
+		slowFor += interval
+		if slowFor >= m.period {
+			m.aborted.Store(true)
+			m.cancel()
+
+			return
+		}
+	}
+}
+
+// stop stops the monitor.  It's safe to call it several times.
+func (m *speedMonitor) stop() {
+	m.stopOnce.Do(func() { close(m.stopCh) })
+}
+
+// wrapErr returns err annotated with ErrTooSlow if the request was canceled
+// by the monitor.
+func (m *speedMonitor) wrapErr(err error) (res error) {
+	if err == nil || !m.aborted.Load() {
+		return err
+	}
+
+	return fmt.Errorf(
+		"%w: less than %d bytes per second during %s: %w",
+		ErrTooSlow,
+		m.limit,
+		m.period,
+		err,
+	)
+}
+
+// speedMonitorBody is the response body that counts the bytes read for
+// speedMonitor.
+type speedMonitorBody struct {
+	body io.ReadCloser
+	m    *speedMonitor
+}
+
+// type check
+var _ io.ReadCloser = (*speedMonitorBody)(nil)
+
+// Read implements the io.Reader interface for *speedMonitorBody.
+func (b *speedMonitorBody) Read(p []byte) (n int, err error) {
+	n, err = b.body.Read(p)
+	b.m.read.Add(int64(n))
+
+	if errors.Is(err, io.EOF) {
+		// The body is received, there is nothing to monitor.
+		b.m.stop()
+	}
+
+	return n, b.m.wrapErr(err)
+}
+
+// Close implements the io.Closer interface for *speedMonitorBody.
+func (b *speedMonitorBody) Close() (err error) {
+	b.m.stop()
+	err = b.body.Close()
+	b.m.cancel()
+
+	return err
+}
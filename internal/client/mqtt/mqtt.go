@@ -0,0 +1,313 @@
+// Package mqtt implements a minimal MQTT 3.1.1 client that supports publishing
+// and subscribing with QoS 0, similar to what curl supports for mqtt:// URLs.
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ameshkov/gocurl/internal/output"
+)
+
+// Packet types, see section 2.2.1 of the MQTT 3.1.1 specification.
+const (
+	packetConnect    byte = 1
+	packetConnAck    byte = 2
+	packetPublish    byte = 3
+	packetSubscribe  byte = 8
+	packetSubAck     byte = 9
+	packetPingReq    byte = 12
+	packetPingResp   byte = 13
+	packetDisconnect byte = 14
+)
+
+// keepAlive is the keep alive interval sent to the broker.  The client sends
+// PINGREQ twice as often to make sure the broker does not close the
+// connection while waiting for messages.
+const keepAlive = 60 * time.Second
+
+// maxRemainingLength is the maximum value of the remaining length field.
+const maxRemainingLength = 268435455
+
+// Message is a message received from the broker.
+type Message struct {
+	// Topic is the name of the topic the message was published to.
+	Topic string
+
+	// Payload is the application message.
+	Payload []byte
+}
+
+// Client is a minimal MQTT client working over an established connection.
+type Client struct {
+	conn net.Conn
+	r    *bufio.Reader
+	out  *output.Output
+
+	// writeMu protects conn from concurrent writes by the keep alive loop.
+	writeMu *sync.Mutex
+
+	// done is closed when the client is closed.
+	done chan struct{}
+}
+
+// NewClient creates a new *Client that uses conn to communicate with the
+// broker.
+func NewClient(conn net.Conn, out *output.Output) (c *Client) {
+	return &Client{
+		conn:    conn,
+		r:       bufio.NewReader(conn),
+		out:     out,
+		writeMu: &sync.Mutex{},
+		done:    make(chan struct{}),
+	}
+}
+
+// Connect sends CONNECT and waits for CONNACK.  username and password are
+// optional.
+func (c *Client) Connect(clientID, username, password string) (err error) {
+	var flags byte = 0x02 // Clean session.
+
+	var payload []byte
+	payload = appendString(payload, clientID)
+	if username != "" {
+		flags |= 0x80
+		payload = appendString(payload, username)
+	}
+
+	if password != "" {
+		flags |= 0x40
+		payload = appendString(payload, password)
+	}
+
+	var b []byte
+	b = appendString(b, "MQTT")
+	b = append(b, 4, flags)
+	b = binary.BigEndian.AppendUint16(b, uint16(keepAlive/time.Second))
+	b = append(b, payload...)
+
+	c.out.Debug("Sending MQTT CONNECT with client ID %s", clientID)
+
+	err = c.writePacket(packetConnect<<4, b)
+	if err != nil {
+		return err
+	}
+
+	typ, body, err := c.readPacket()
+	if err != nil {
+		return err
+	}
+
+	if typ>>4 != packetConnAck || len(body) != 2 {
+		return fmt.Errorf("unexpected packet type %d instead of CONNACK", typ>>4)
+	}
+
+	if code := body[1]; code != 0 {
+		return fmt.Errorf("connection refused by the broker with code %d", code)
+	}
+
+	return nil
+}
+
+// Publish publishes payload to topic with QoS 0.
+func (c *Client) Publish(topic string, payload []byte) (err error) {
+	c.out.Debug("Publishing %d bytes to MQTT topic %s", len(payload), topic)
+
+	b := appendString(nil, topic)
+	b = append(b, payload...)
+
+	return c.writePacket(packetPublish<<4, b)
+}
+
+// Subscribe subscribes to topic with QoS 0 and waits for SUBACK.  It also
+// starts sending PINGREQ periodically so that the connection is kept alive
+// until the client is closed.
+func (c *Client) Subscribe(topic string) (err error) {
+	c.out.Debug("Subscribing to MQTT topic %s", topic)
+
+	// Packet identifier is always 1 since there's only one subscription.
+	b := binary.BigEndian.AppendUint16(nil, 1)
+	b = appendString(b, topic)
+	b = append(b, 0)
+
+	// SUBSCRIBE fixed header flags must be 0010.
+	err = c.writePacket(packetSubscribe<<4|0x02, b)
+	if err != nil {
+		return err
+	}
+
+	typ, body, err := c.readPacket()
+	if err != nil {
+		return err
+	}
+
+	if typ>>4 != packetSubAck || len(body) != 3 {
+		return fmt.Errorf("unexpected packet type %d instead of SUBACK", typ>>4)
+	}
+
+	if body[2] == 0x80 {
+		return fmt.Errorf("subscription to %s rejected by the broker", topic)
+	}
+
+	go c.keepAliveLoop()
+
+	return nil
+}
+
+// ReadMessage reads the next message published to the subscribed topic.
+func (c *Client) ReadMessage() (msg *Message, err error) {
+	for {
+		var typ byte
+		var body []byte
+		typ, body, err = c.readPacket()
+		if err != nil {
+			return nil, err
+		}
+
+		switch typ >> 4 {
+		case packetPublish:
+			return parsePublish(typ, body)
+		case packetPingResp:
+			// Response to our keep alive, ignore it.
+		default:
+			c.out.Debug("Ignoring MQTT packet of type %d", typ>>4)
+		}
+	}
+}
+
+// Close sends DISCONNECT and closes the connection.
+func (c *Client) Close() (err error) {
+	close(c.done)
+
+	_ = c.writePacket(packetDisconnect<<4, nil)
+
+	return c.conn.Close()
+}
+
+// keepAliveLoop sends PINGREQ periodically until the client is closed.
+func (c *Client) keepAliveLoop() {
+	ticker := time.NewTicker(keepAlive / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			err := c.writePacket(packetPingReq<<4, nil)
+			if err != nil {
+				c.out.Debug("Failed to send MQTT PINGREQ: %v", err)
+
+				return
+			}
+		}
+	}
+}
+
+// writePacket writes the packet with the fixed header byte hdr and the
+// specified body.
+func (c *Client) writePacket(hdr byte, body []byte) (err error) {
+	if len(body) > maxRemainingLength {
+		return fmt.Errorf("packet too large: %d", len(body))
+	}
+
+	b := []byte{hdr}
+	for l := len(body); ; {
+		d := byte(l % 128)
+		l /= 128
+		if l > 0 {
+			d |= 0x80
+		}
+
+		b = append(b, d)
+		if l == 0 {
+			break
+		}
+	}
+
+	b = append(b, body...)
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	_, err = c.conn.Write(b)
+
+	return err
+}
+
+// readPacket reads the next packet and returns its fixed header byte and
+// body.
+func (c *Client) readPacket() (hdr byte, body []byte, err error) {
+	hdr, err = c.r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	l, mul := 0, 1
+	for i := 0; ; i++ {
+		if i == 4 {
+			return 0, nil, fmt.Errorf("malformed remaining length")
+		}
+
+		var d byte
+		d, err = c.r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		l += int(d&0x7f) * mul
+		mul *= 128
+		if d&0x80 == 0 {
+			break
+		}
+	}
+
+	body = make([]byte, l)
+	_, err = io.ReadFull(c.r, body)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return hdr, body, nil
+}
+
+// parsePublish parses the body of the PUBLISH packet.
+func parsePublish(hdr byte, body []byte) (msg *Message, err error) {
+	if len(body) < 2 {
+		return nil, fmt.Errorf("malformed PUBLISH packet")
+	}
+
+	topicLen := int(binary.BigEndian.Uint16(body))
+	body = body[2:]
+	if len(body) < topicLen {
+		return nil, fmt.Errorf("malformed PUBLISH packet")
+	}
+
+	msg = &Message{Topic: string(body[:topicLen])}
+	body = body[topicLen:]
+
+	// Skip the packet identifier which is only present when QoS > 0.
+	if qos := (hdr >> 1) & 0x03; qos > 0 {
+		if len(body) < 2 {
+			return nil, fmt.Errorf("malformed PUBLISH packet")
+		}
+
+		body = body[2:]
+	}
+
+	msg.Payload = body
+
+	return msg, nil
+}
+
+// appendString appends a length-prefixed UTF-8 string to b.
+func appendString(b []byte, s string) (res []byte) {
+	res = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+
+	return append(res, s...)
+}
@@ -0,0 +1,73 @@
+package mqtt_test
+
+import (
+	"io"
+	"net"
+	"testing"
+
+	"github.com/ameshkov/gocurl/internal/client/mqtt"
+	"github.com/ameshkov/gocurl/internal/output"
+	"github.com/stretchr/testify/require"
+)
+
+// readPacket reads a packet with a single-byte remaining length from conn.
+// It returns zero hdr if the packet cannot be read.
+func readPacket(conn net.Conn) (hdr byte, body []byte) {
+	b := make([]byte, 2)
+	_, err := io.ReadFull(conn, b)
+	if err != nil {
+		return 0, nil
+	}
+
+	body = make([]byte, b[1])
+	_, err = io.ReadFull(conn, body)
+	if err != nil {
+		return 0, nil
+	}
+
+	return b[0], body
+}
+
+func TestClient(t *testing.T) {
+	clientConn, brokerConn := net.Pipe()
+	t.Cleanup(func() { _ = brokerConn.Close() })
+
+	go func() {
+		hdr, body := readPacket(brokerConn)
+		if hdr != 0x10 || len(body) < 6 || string(body[2:6]) != "MQTT" {
+			return
+		}
+		_, _ = brokerConn.Write([]byte{0x20, 2, 0, 0})
+
+		hdr, _ = readPacket(brokerConn)
+		if hdr != 0x30 {
+			return
+		}
+
+		hdr, _ = readPacket(brokerConn)
+		if hdr != 0x82 {
+			return
+		}
+		_, _ = brokerConn.Write([]byte{0x90, 3, 0, 1, 0})
+
+		// PUBLISH with QoS 1 to make sure the packet identifier is skipped.
+		_, _ = brokerConn.Write([]byte{0x32, 10, 0, 3, 'a', '/', 'b', 0, 1, 'h', 'e', 'y'})
+	}()
+
+	out, err := output.NewOutput("", false)
+	require.NoError(t, err)
+
+	c := mqtt.NewClient(clientConn, out)
+
+	require.NoError(t, c.Connect("test", "user", "pass"))
+	require.NoError(t, c.Publish("a/b", []byte("test")))
+	require.NoError(t, c.Subscribe("a/b"))
+
+	msg, err := c.ReadMessage()
+	require.NoError(t, err)
+	require.Equal(t, "a/b", msg.Topic)
+	require.Equal(t, []byte("hey"), msg.Payload)
+
+	go func() { _, _ = io.Copy(io.Discard, brokerConn) }()
+	require.NoError(t, c.Close())
+}
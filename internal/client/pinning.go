@@ -0,0 +1,40 @@
+package client
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"fmt"
+)
+
+// ErrPinnedPubKey is returned when none of the server certificates has the
+// public key pinned with --pinnedpubkey.
+var ErrPinnedPubKey = errors.New("public key does not match pinnedpubkey")
+
+// newPinVerifier returns a function for tls.Config.VerifyPeerCertificate that
+// checks that one of the server certificates has a public key with one of the
+// SHA-256 hashes from pins.  It is called even if the verification is
+// disabled with -k so the pinned key is always checked.
+func newPinVerifier(
+	pins [][]byte,
+) (f func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) (err error)) {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) (err error) {
+		for _, raw := range rawCerts {
+			var cert *x509.Certificate
+			cert, err = x509.ParseCertificate(raw)
+			if err != nil {
+				return fmt.Errorf("parsing server certificate: %w", err)
+			}
+
+			sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+			for _, pin := range pins {
+				if bytes.Equal(sum[:], pin) {
+					return nil
+				}
+			}
+		}
+
+		return ErrPinnedPubKey
+	}
+}
@@ -0,0 +1,63 @@
+package client
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/ameshkov/gocurl/internal/config"
+)
+
+// ProbeResult is the result of a single request sent by Probe.
+type ProbeResult struct {
+	// Response is the received response.  Its body is already read and
+	// closed.  It is nil if the request failed.
+	Response *http.Response
+
+	// Err is the error that occurred when sending the request or reading the
+	// response body.
+	Err error
+
+	// BodySize is the number of response body bytes that were read.
+	BodySize int64
+
+	// Duration is the time passed since the request was sent until the
+	// response body was read or the request failed.
+	Duration time.Duration
+}
+
+// Probe creates a new request from cfg, sends it using rt and reads the
+// response body discarding it.  It is used by the modes that repeat the
+// request many times and only need the statistics, not the response body.
+func Probe(cfg *config.Config, rt http.RoundTripper) (r *ProbeResult) {
+	r = &ProbeResult{}
+
+	req, err := NewRequest(cfg)
+	if err != nil {
+		r.Err = err
+
+		return r
+	}
+
+	start := time.Now()
+	defer func() {
+		r.Duration = time.Since(start)
+	}()
+
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		r.Err = err
+
+		return r
+	}
+	defer func(body io.ReadCloser) {
+		_ = body.Close()
+	}(resp.Body)
+
+	r.Response = resp
+	if req.Method != http.MethodHead {
+		r.BodySize, r.Err = io.Copy(io.Discard, resp.Body)
+	}
+
+	return r
+}
@@ -0,0 +1,129 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+
+	"github.com/ameshkov/gocurl/internal/client/dialer"
+	"github.com/ameshkov/gocurl/internal/output"
+)
+
+// Direct is the name that is reported by FailoverDialer.ProxyFor when the
+// connection was established without a proxy.
+const Direct = "direct"
+
+// FailoverDialer implements dialer.Dialer and opens connections through the
+// first proxy from the list that works.  If all the proxies fail, it can
+// connect directly.
+type FailoverDialer struct {
+	out     *output.Output
+	proxies []*Dialer
+	direct  dialer.DialFunc
+
+	// names are the redacted URLs of proxies.
+	names []string
+
+	// usedMu protects used.
+	usedMu *sync.Mutex
+
+	// used maps local addresses of the established connections to the names
+	// of the proxies they were established through.
+	used map[string]string
+}
+
+// type check
+var _ dialer.Dialer = (*FailoverDialer)(nil)
+
+// NewFailoverDialer creates a new instance of *FailoverDialer that tries
+// proxyURLs in order with conf.  forward is used to connect to the proxies.
+// If direct is true, forward is also used to connect to the target directly
+// when all the proxies failed.
+func NewFailoverDialer(
+	proxyURLs []*url.URL,
+	conf *Config,
+	forward dialer.DialFunc,
+	direct bool,
+	out *output.Output,
+) (d *FailoverDialer, err error) {
+	d = &FailoverDialer{
+		out:    out,
+		usedMu: &sync.Mutex{},
+		used:   map[string]string{},
+	}
+
+	for _, u := range proxyURLs {
+		var p *Dialer
+		p, err = NewProxyDialer(u, conf, forward, out)
+		if err != nil {
+			return nil, err
+		}
+
+		d.proxies = append(d.proxies, p)
+		d.names = append(d.names, u.Redacted())
+	}
+
+	if direct {
+		d.direct = forward
+	}
+
+	return d, nil
+}
+
+// Dial implements the dialer.Dialer interface for *FailoverDialer.
+func (d *FailoverDialer) Dial(network, addr string) (conn net.Conn, err error) {
+	var errs []error
+	for i, p := range d.proxies {
+		conn, err = p.Dial(network, addr)
+		if err == nil {
+			d.out.Debug("Connected to %s through proxy %s", addr, d.names[i])
+
+			return d.setUsed(conn, d.names[i]), nil
+		}
+
+		if len(d.proxies) == 1 && d.direct == nil {
+			// Keep the original error when there is nothing to fall back to.
+			return nil, err
+		}
+
+		d.out.Debug("Failed to connect through proxy %s: %v", d.names[i], err)
+		errs = append(errs, fmt.Errorf("proxy %s: %w", d.names[i], err))
+	}
+
+	if d.direct != nil {
+		d.out.Debug("All proxies failed, connecting to %s directly", addr)
+
+		conn, err = d.direct(network, addr)
+		if err == nil {
+			return d.setUsed(conn, Direct), nil
+		}
+
+		errs = append(errs, fmt.Errorf("direct: %w", err))
+	}
+
+	return nil, errors.Join(errs...)
+}
+
+// ProxyFor returns the redacted URL of the proxy the connection with the same
+// local address as conn was established through, or Direct.  ok is false if
+// the connection was not established by d.
+func (d *FailoverDialer) ProxyFor(conn net.Conn) (proxy string, ok bool) {
+	d.usedMu.Lock()
+	defer d.usedMu.Unlock()
+
+	proxy, ok = d.used[conn.LocalAddr().String()]
+
+	return proxy, ok
+}
+
+// setUsed remembers that conn was established through proxy and returns conn.
+func (d *FailoverDialer) setUsed(conn net.Conn, proxy string) (c net.Conn) {
+	d.usedMu.Lock()
+	defer d.usedMu.Unlock()
+
+	d.used[conn.LocalAddr().String()] = proxy
+
+	return conn
+}
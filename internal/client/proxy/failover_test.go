@@ -0,0 +1,111 @@
+package proxy_test
+
+import (
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ameshkov/gocurl/internal/client/proxy"
+	"github.com/ameshkov/gocurl/internal/output"
+	"github.com/stretchr/testify/require"
+	"github.com/txthinking/socks5"
+)
+
+// freeAddr returns a local address that nothing listens on.
+func freeAddr(t *testing.T) (addr string) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	addr = l.Addr().String()
+	require.NoError(t, l.Close())
+
+	return addr
+}
+
+// newSOCKS5Server starts a SOCKS5 proxy and returns its address.
+func newSOCKS5Server(t *testing.T) (addr string) {
+	t.Helper()
+
+	addr = freeAddr(t)
+	srv, err := socks5.NewClassicServer(addr, "127.0.0.1", "", "", 0, 0)
+	require.NoError(t, err)
+
+	go func() { _ = srv.ListenAndServe(nil) }()
+	t.Cleanup(func() { _ = srv.Shutdown() })
+
+	require.Eventually(t, func() (ok bool) {
+		conn, dErr := net.Dial("tcp", addr)
+		if dErr == nil {
+			_ = conn.Close()
+		}
+
+		return dErr == nil
+	}, time.Second, 10*time.Millisecond)
+
+	return addr
+}
+
+func TestFailoverDialer_Dial(t *testing.T) {
+	target, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = target.Close() })
+
+	go func() {
+		for {
+			conn, aErr := target.Accept()
+			if aErr != nil {
+				return
+			}
+
+			_ = conn.Close()
+		}
+	}()
+
+	socksAddr := newSOCKS5Server(t)
+
+	out, err := output.NewOutput("", false)
+	require.NoError(t, err)
+
+	dead := &url.URL{Scheme: "socks5", Host: freeAddr(t)}
+	alive := &url.URL{Scheme: "socks5", Host: socksAddr}
+
+	testCases := []struct {
+		name      string
+		proxies   []*url.URL
+		direct    bool
+		wantProxy string
+	}{{
+		name:      "second_proxy",
+		proxies:   []*url.URL{dead, alive},
+		wantProxy: alive.String(),
+	}, {
+		name:      "direct",
+		proxies:   []*url.URL{dead},
+		direct:    true,
+		wantProxy: proxy.Direct,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			d, dErr := proxy.NewFailoverDialer(tc.proxies, &proxy.Config{}, (&net.Dialer{}).Dial, tc.direct, out)
+			require.NoError(t, dErr)
+
+			conn, dErr := d.Dial("tcp", target.Addr().String())
+			require.NoError(t, dErr)
+			t.Cleanup(func() { _ = conn.Close() })
+
+			p, ok := d.ProxyFor(conn)
+			require.True(t, ok)
+			require.Equal(t, tc.wantProxy, p)
+		})
+	}
+
+	d, err := proxy.NewFailoverDialer([]*url.URL{dead, dead}, &proxy.Config{}, (&net.Dialer{}).Dial, false, out)
+	require.NoError(t, err)
+
+	_, err = d.Dial("tcp", target.Addr().String())
+	require.Error(t, err)
+}
@@ -0,0 +1,299 @@
+package proxy
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ameshkov/gocurl/internal/client/auth"
+	"github.com/ameshkov/gocurl/internal/client/dialer"
+	"github.com/ameshkov/gocurl/internal/output"
+	"golang.org/x/net/proxy"
+)
+
+// maxAuthAttempts is the maximum number of CONNECT requests sent to answer
+// the challenges of the proxy.  NTLM requires three of them.
+const maxAuthAttempts = 3
+
+// maxChallengeBodyDrain is the maximum number of bytes of the 407 response
+// body that are read so that the connection could be reused.
+const maxChallengeBodyDrain = 64 << 10
+
+// httpDialer is a proxy.Dialer that opens tunnels through an HTTP or HTTPS
+// proxy with CONNECT requests and answers its authentication challenges.
+type httpDialer struct {
+	forward proxy.Dialer
+	out     *output.Output
+
+	// user are the credentials for the proxy, nil if there are none.
+	user *url.Userinfo
+
+	// tlsConfig is the configuration of the TLS connection to an HTTPS proxy,
+	// it is nil for HTTP proxies.
+	tlsConfig *tls.Config
+
+	// addr is the address of the proxy.
+	addr string
+
+	// authScheme is the authentication scheme, see Config.AuthScheme.
+	authScheme string
+}
+
+// type check
+var _ proxy.Dialer = (*httpDialer)(nil)
+
+// createHTTPProxyDialer creates a proxy.Dialer that connects to the HTTP or
+// HTTPS proxy from u using forward.  The credentials from conf have priority
+// over the ones from u.
+func createHTTPProxyDialer(
+	u *url.URL,
+	conf *Config,
+	forward proxy.Dialer,
+	out *output.Output,
+) (d *httpDialer) {
+	d = &httpDialer{
+		forward:    forward,
+		out:        out,
+		user:       u.User,
+		authScheme: conf.AuthScheme,
+	}
+
+	if conf.User != nil {
+		d.user = conf.User
+	}
+
+	port := u.Port()
+	if u.Scheme == "https" {
+		d.tlsConfig = &tls.Config{}
+		if conf.TLSConfig != nil {
+			d.tlsConfig = conf.TLSConfig.Clone()
+		}
+
+		d.tlsConfig.ServerName = u.Hostname()
+		if port == "" {
+			port = "443"
+		}
+	} else if port == "" {
+		// The default port of curl.
+		port = "1080"
+	}
+
+	d.addr = net.JoinHostPort(u.Hostname(), port)
+
+	return d
+}
+
+// Dial implements the proxy.Dialer interface for *httpDialer.
+func (d *httpDialer) Dial(network, addr string) (conn net.Conn, err error) {
+	if !strings.HasPrefix(network, "tcp") {
+		return nil, fmt.Errorf("http proxy does not support %s", network)
+	}
+
+	conn, err = d.dialProxy()
+	if err != nil {
+		return nil, err
+	}
+
+	authorization := ""
+	if d.user != nil && d.authScheme == "" {
+		authorization = basicAuthorization(d.user)
+	}
+
+	for i := 0; ; i++ {
+		var resp *http.Response
+		var br *bufio.Reader
+		resp, br, err = d.connect(conn, addr, authorization)
+		if err != nil {
+			_ = conn.Close()
+
+			return nil, err
+		}
+
+		if resp.StatusCode/100 == 2 {
+			return newBufferedConn(conn, br), nil
+		}
+
+		if resp.StatusCode != http.StatusProxyAuthRequired || d.user == nil || i == maxAuthAttempts-1 {
+			_ = conn.Close()
+
+			return nil, fmt.Errorf("proxy CONNECT to %s: %s", addr, resp.Status)
+		}
+
+		authorization, err = d.answer(resp, addr, authorization)
+		if err != nil {
+			_ = conn.Close()
+
+			return nil, err
+		}
+
+		if resp.Close {
+			// The proxy closes the connection after the challenge, continue
+			// on a new one.
+			_ = conn.Close()
+
+			conn, err = d.dialProxy()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// dialProxy opens a connection to the proxy.
+func (d *httpDialer) dialProxy() (conn net.Conn, err error) {
+	conn, err = d.forward.Dial("tcp", d.addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.tlsConfig == nil {
+		return conn, nil
+	}
+
+	tlsConn := tls.Client(conn, d.tlsConfig)
+	err = tlsConn.Handshake()
+	if err != nil {
+		_ = conn.Close()
+
+		return nil, fmt.Errorf("tls handshake with proxy: %w", err)
+	}
+
+	return tlsConn, nil
+}
+
+// connect sends the CONNECT request for addr with the Proxy-Authorization
+// header if authorization is not empty.  The body of the response is read so
+// that the connection could be reused.
+func (d *httpDialer) connect(
+	conn net.Conn,
+	addr string,
+	authorization string,
+) (resp *http.Response, br *bufio.Reader, err error) {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: http.Header{},
+	}
+
+	if authorization != "" {
+		req.Header.Set("Proxy-Authorization", authorization)
+	}
+
+	d.out.Debug("Sending CONNECT %s to proxy %s", addr, d.addr)
+
+	err = req.Write(conn)
+	if err != nil {
+		return nil, nil, fmt.Errorf("sending CONNECT to proxy: %w", err)
+	}
+
+	br = bufio.NewReader(conn)
+	resp, err = http.ReadResponse(br, req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading CONNECT response from proxy: %w", err)
+	}
+
+	d.out.Debug("Proxy responded with %s", resp.Status)
+
+	if resp.StatusCode/100 != 2 {
+		_, _ = io.CopyN(io.Discard, resp.Body, maxChallengeBodyDrain)
+		_ = resp.Body.Close()
+	}
+
+	return resp, br, nil
+}
+
+// answer returns the Proxy-Authorization header value that answers the
+// challenge of resp according to the authentication scheme.  prev is the
+// previous value, it is used to continue the NTLM handshake.
+func (d *httpDialer) answer(resp *http.Response, addr, prev string) (authorization string, err error) {
+	challenges := resp.Header.Values("Proxy-Authenticate")
+	password, _ := d.user.Password()
+
+	if challenge, ok, _ := auth.ParseNTLM(challenges); ok && strings.HasPrefix(prev, "NTLM ") {
+		if len(challenge) == 0 {
+			return "", fmt.Errorf("proxy rejected ntlm negotiate message")
+		}
+
+		d.out.Debug("Answering the NTLM challenge of the proxy")
+
+		return auth.NTLMAuthenticate(challenge, d.user.Username(), password)
+	}
+
+	if prev != "" {
+		return "", fmt.Errorf("proxy rejected credentials: %s", resp.Status)
+	}
+
+	switch d.authScheme {
+	case "digest", "anyauth":
+		digest, ok, parseErr := auth.ParseDigest(challenges)
+		if ok && parseErr == nil {
+			d.out.Debug("Answering the Digest challenge of the proxy, realm %q", digest.Realm)
+
+			return digest.Authorize(http.MethodConnect, addr, d.user.Username(), password, nil)
+		}
+	}
+
+	switch d.authScheme {
+	case "ntlm", "anyauth":
+		if _, ok, _ := auth.ParseNTLM(challenges); ok {
+			d.out.Debug("Starting the NTLM handshake with the proxy")
+
+			return auth.NTLMNegotiate(), nil
+		}
+	}
+
+	if d.authScheme == "anyauth" && auth.HasBasic(challenges) {
+		d.out.Debug("Answering the Basic challenge of the proxy")
+
+		return basicAuthorization(d.user), nil
+	}
+
+	return "", fmt.Errorf("cannot answer proxy challenge %q", challenges)
+}
+
+// basicAuthorization returns the value of the Basic authorization header for
+// user.
+func basicAuthorization(user *url.Userinfo) (authorization string) {
+	password, _ := user.Password()
+	credentials := user.Username() + ":" + password
+
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(credentials))
+}
+
+// bufferedConn is a net.Conn that first returns the data that was buffered
+// when the CONNECT response was read.
+type bufferedConn struct {
+	net.Conn
+
+	r *bufio.Reader
+}
+
+// newBufferedConn returns conn as is if br has nothing buffered, otherwise it
+// wraps conn so that the buffered data is not lost.
+func newBufferedConn(conn net.Conn, br *bufio.Reader) (c net.Conn) {
+	if br.Buffered() == 0 {
+		return conn
+	}
+
+	return &bufferedConn{Conn: conn, r: br}
+}
+
+// type check
+var _ dialer.WrappedConn = (*bufferedConn)(nil)
+
+// Unwrap implements the dialer.WrappedConn interface for *bufferedConn.
+func (c *bufferedConn) Unwrap() (conn net.Conn) {
+	return c.Conn
+}
+
+// Read implements the net.Conn interface for *bufferedConn.
+func (c *bufferedConn) Read(b []byte) (n int, err error) {
+	return c.r.Read(b)
+}
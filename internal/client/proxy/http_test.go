@@ -0,0 +1,344 @@
+package proxy_test
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ameshkov/gocurl/internal/client/proxy"
+	"github.com/ameshkov/gocurl/internal/output"
+	"github.com/stretchr/testify/require"
+)
+
+// ntlmChallenge is the NTLM challenge message from MS-NLMP, section 4.2.4.3,
+// with a zero version.
+const ntlmChallenge = "4e544c4d53535000020000000c000c0038000000338a82e2" +
+	"0123456789abcdef00000000000000002400240044000000" +
+	"0000000000000000530065007200760065007200" +
+	"02000c0044006f006d00610069006e0001000c005300650072007600650072000000000000000000"
+
+// proxyAuthFunc checks the Proxy-Authorization header of the CONNECT request
+// and returns the challenge to send with 407 or an empty string to open the
+// tunnel.
+type proxyAuthFunc func(authorization string) (challenge string)
+
+// newTestProxy starts an HTTP proxy that authenticates the CONNECT requests
+// with check and returns its address.  If tlsConf is not nil, it is an HTTPS
+// proxy.
+func newTestProxy(t *testing.T, check proxyAuthFunc, tlsConf *tls.Config) (addr string) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = l.Close() })
+
+	if tlsConf != nil {
+		l = tls.NewListener(l, tlsConf)
+	}
+
+	go func() {
+		for {
+			conn, aErr := l.Accept()
+			if aErr != nil {
+				return
+			}
+
+			go serveTestProxy(conn, check)
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+// serveTestProxy serves the CONNECT requests from conn.
+func serveTestProxy(conn net.Conn, check proxyAuthFunc) {
+	defer func() { _ = conn.Close() }()
+
+	br := bufio.NewReader(conn)
+	for {
+		req, err := http.ReadRequest(br)
+		if err != nil || req.Method != http.MethodConnect {
+			return
+		}
+
+		challenge := check(req.Header.Get("Proxy-Authorization"))
+		if challenge != "" {
+			_, _ = io.WriteString(conn, "HTTP/1.1 407 Proxy Authentication Required\r\n"+
+				"Proxy-Authenticate: "+challenge+"\r\n"+
+				"Content-Length: 4\r\n\r\ndeny")
+
+			continue
+		}
+
+		target, err := net.Dial("tcp", req.Host)
+		if err != nil {
+			return
+		}
+		defer func() { _ = target.Close() }()
+
+		_, _ = io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+
+		go func() { _, _ = io.Copy(target, br) }()
+		_, _ = io.Copy(conn, target)
+
+		return
+	}
+}
+
+func TestHTTPDialer(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("test"))
+	}))
+	t.Cleanup(target.Close)
+
+	targetAddr := target.Listener.Addr().String()
+	basic := "Basic " + base64.StdEncoding.EncodeToString([]byte("user:pass"))
+
+	ntlmMsg, err := hex.DecodeString(ntlmChallenge)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		check   proxyAuthFunc
+		conf    *proxy.Config
+		name    string
+		user    *url.Userinfo
+		wantErr string
+	}{{
+		check: func(authorization string) (challenge string) {
+			return ""
+		},
+		conf: &proxy.Config{},
+		name: "no_auth",
+	}, {
+		check: func(authorization string) (challenge string) {
+			if authorization == basic {
+				return ""
+			}
+
+			return `Basic realm="proxy"`
+		},
+		conf: &proxy.Config{},
+		name: "basic_url",
+		user: url.UserPassword("user", "pass"),
+	}, {
+		check: func(authorization string) (challenge string) {
+			if authorization == basic {
+				return ""
+			}
+
+			return `Basic realm="proxy"`
+		},
+		conf: &proxy.Config{User: url.UserPassword("user", "pass")},
+		name: "basic_proxy_user",
+		user: url.UserPassword("other", "wrong"),
+	}, {
+		check: func(authorization string) (challenge string) {
+			if authorization == basic {
+				return ""
+			}
+
+			return `Basic realm="proxy"`
+		},
+		conf:    &proxy.Config{},
+		name:    "no_credentials",
+		wantErr: "407 Proxy Authentication Required",
+	}, {
+		check: func(authorization string) (challenge string) {
+			if strings.HasPrefix(authorization, "Digest ") &&
+				strings.Contains(authorization, `username="user"`) &&
+				strings.Contains(authorization, `uri="`+targetAddr+`"`) {
+				return ""
+			}
+
+			return `Digest realm="proxy", nonce="abc", qop="auth"`
+		},
+		conf: &proxy.Config{User: url.UserPassword("user", "pass"), AuthScheme: "digest"},
+		name: "digest",
+	}, {
+		check: func(authorization string) (challenge string) {
+			if strings.HasPrefix(authorization, "Digest ") {
+				return ""
+			}
+
+			return `Basic realm="proxy", Digest realm="proxy", nonce="abc"`
+		},
+		conf: &proxy.Config{User: url.UserPassword("user", "pass"), AuthScheme: "anyauth"},
+		name: "anyauth",
+	}, {
+		check: func(authorization string) (challenge string) {
+			b, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(authorization, "NTLM "))
+			switch {
+			case len(b) > 8 && b[8] == 1:
+				return "NTLM " + base64.StdEncoding.EncodeToString(ntlmMsg)
+			case len(b) > 8 && b[8] == 3:
+				return ""
+			default:
+				return "NTLM"
+			}
+		},
+		conf: &proxy.Config{User: url.UserPassword(`DOMAIN\user`, "pass"), AuthScheme: "ntlm"},
+		name: "ntlm",
+	}}
+
+	out, err := output.NewOutput("", false)
+	require.NoError(t, err)
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			u := &url.URL{Scheme: "http", User: tc.user, Host: newTestProxy(t, tc.check, nil)}
+
+			d, dErr := proxy.NewProxyDialer(u, tc.conf, &net.Dialer{}, out)
+			require.NoError(t, dErr)
+
+			conn, dErr := d.Dial("tcp", targetAddr)
+			if tc.wantErr != "" {
+				require.ErrorContains(t, dErr, tc.wantErr)
+
+				return
+			}
+
+			require.NoError(t, dErr)
+			t.Cleanup(func() { _ = conn.Close() })
+
+			_, dErr = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: "+targetAddr+"\r\nConnection: close\r\n\r\n")
+			require.NoError(t, dErr)
+
+			resp, dErr := http.ReadResponse(bufio.NewReader(conn), nil)
+			require.NoError(t, dErr)
+
+			body, dErr := io.ReadAll(resp.Body)
+			require.NoError(t, dErr)
+			require.Equal(t, "test", string(body))
+		})
+	}
+}
+
+func TestHTTPDialer_https(t *testing.T) {
+	target, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = target.Close() })
+
+	// The server of the proxy only provides its TLS configuration.
+	srv := httptest.NewUnstartedServer(nil)
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	noAuth := func(_ string) (challenge string) { return "" }
+	proxyAddr := newTestProxy(t, noAuth, srv.TLS)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+
+	// Reuse the certificate of the proxy as the client one.
+	clientCert := srv.TLS.Certificates[0]
+
+	out, err := output.NewOutput("", false)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		tlsConfig *tls.Config
+		name      string
+		wantErr   string
+	}{{
+		tlsConfig: &tls.Config{RootCAs: roots, Certificates: []tls.Certificate{clientCert}},
+		name:      "success",
+		wantErr:   "",
+	}, {
+		tlsConfig: &tls.Config{InsecureSkipVerify: true, Certificates: []tls.Certificate{clientCert}},
+		name:      "insecure",
+		wantErr:   "",
+	}, {
+		tlsConfig: nil,
+		name:      "unknown_authority",
+		wantErr:   "certificate signed by unknown authority",
+	}, {
+		tlsConfig: &tls.Config{RootCAs: roots},
+		name:      "no_client_cert",
+		wantErr:   "certificate required",
+	}, {
+		tlsConfig: &tls.Config{
+			RootCAs:      roots,
+			Certificates: []tls.Certificate{clientCert},
+			MaxVersion:   tls.VersionTLS12,
+			CipherSuites: []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256},
+		},
+		name:    "tls12_cipher",
+		wantErr: "",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			u := &url.URL{Scheme: "https", Host: proxyAddr}
+			conf := &proxy.Config{TLSConfig: tc.tlsConfig}
+
+			d, dErr := proxy.NewProxyDialer(u, conf, &net.Dialer{}, out)
+			require.NoError(t, dErr)
+
+			conn, dErr := d.Dial("tcp", target.Addr().String())
+			if tc.wantErr != "" {
+				require.ErrorContains(t, dErr, tc.wantErr)
+
+				return
+			}
+
+			require.NoError(t, dErr)
+			require.NoError(t, conn.Close())
+		})
+	}
+}
+
+func TestHTTPDialer_preproxy(t *testing.T) {
+	target, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = target.Close() })
+
+	noAuth := func(_ string) (challenge string) { return "" }
+	httpProxy := &url.URL{Scheme: "http", Host: newTestProxy(t, noAuth, nil)}
+
+	out, err := output.NewOutput("", false)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		preproxy *url.URL
+		name     string
+		wantErr  bool
+	}{{
+		preproxy: &url.URL{Scheme: "socks5", Host: newSOCKS5Server(t)},
+		name:     "success",
+		wantErr:  false,
+	}, {
+		preproxy: &url.URL{Scheme: "socks5", Host: freeAddr(t)},
+		name:     "dead_preproxy",
+		wantErr:  true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pre, dErr := proxy.NewProxyDialer(tc.preproxy, &proxy.Config{}, &net.Dialer{}, out)
+			require.NoError(t, dErr)
+
+			d, dErr := proxy.NewProxyDialer(httpProxy, &proxy.Config{}, pre, out)
+			require.NoError(t, dErr)
+
+			conn, dErr := d.Dial("tcp", target.Addr().String())
+			if tc.wantErr {
+				require.Error(t, dErr)
+
+				return
+			}
+
+			require.NoError(t, dErr)
+			require.NoError(t, conn.Close())
+		})
+	}
+}
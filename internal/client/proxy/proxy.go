@@ -3,6 +3,7 @@
 package proxy
 
 import (
+	"crypto/tls"
 	"net"
 	"net/url"
 
@@ -11,6 +12,22 @@ import (
 	"golang.org/x/net/proxy"
 )
 
+// Config is the configuration of the proxy connections.
+type Config struct {
+	// User are the credentials for the HTTP and HTTPS proxies, see
+	// --proxy-user.  If nil, the ones from the proxy URL are used.
+	User *url.Userinfo
+
+	// AuthScheme is the authentication scheme for the HTTP and HTTPS proxies:
+	// "digest", "ntlm", "anyauth" or empty for Basic.
+	AuthScheme string
+
+	// TLSConfig is the configuration of the TLS connections to the HTTPS
+	// proxies.  The server name is set from the proxy URL.  If nil, the
+	// default configuration is used.
+	TLSConfig *tls.Config
+}
+
 // Dialer implements dialer.Dialer interface and opens connections through the
 // specified proxy.
 type Dialer struct {
@@ -22,9 +39,14 @@ type Dialer struct {
 var _ dialer.Dialer = (*Dialer)(nil)
 
 // NewProxyDialer creates a new instance of *ProxyDialer.
-func NewProxyDialer(proxyURL *url.URL, forward dialer.Dialer, out *output.Output) (d *Dialer, err error) {
+func NewProxyDialer(
+	proxyURL *url.URL,
+	conf *Config,
+	forward dialer.Dialer,
+	out *output.Output,
+) (d *Dialer, err error) {
 	d = &Dialer{out: out}
-	d.proxyDialer, err = createProxyDialer(proxyURL, forward)
+	d.proxyDialer, err = createProxyDialer(proxyURL, conf, forward, out)
 	if err != nil {
 		return nil, err
 	}
@@ -47,10 +69,17 @@ func (d *Dialer) Dial(network, addr string) (conn net.Conn, err error) {
 }
 
 // createProxyDialer creates a proxy dialer from the specified URL.
-func createProxyDialer(proxyURL *url.URL, f proxy.Dialer) (d proxy.Dialer, err error) {
+func createProxyDialer(
+	proxyURL *url.URL,
+	conf *Config,
+	f proxy.Dialer,
+	out *output.Output,
+) (d proxy.Dialer, err error) {
 	switch proxyURL.Scheme {
 	case "socks5", "socks5h":
 		return createSOCKS5ProxyDialer(proxyURL)
+	case "http", "https":
+		return createHTTPProxyDialer(proxyURL, conf, f, out), nil
 	default:
 		return proxy.FromURL(proxyURL, f)
 	}
@@ -4,6 +4,7 @@ import (
 	"net"
 	"net/url"
 
+	"github.com/ameshkov/gocurl/internal/client/dialer"
 	"github.com/txthinking/socks5"
 	"golang.org/x/net/proxy"
 )
@@ -29,6 +30,19 @@ type socksConn struct {
 // type check
 var _ net.PacketConn = (*socksConn)(nil)
 
+// type check
+var _ dialer.WrappedConn = (*socksConn)(nil)
+
+// Unwrap implements the dialer.WrappedConn interface for *socksConn.  It
+// returns the connection to the proxy the data is written to.
+func (s *socksConn) Unwrap() (conn net.Conn) {
+	if s.UDPConn != nil {
+		return s.UDPConn
+	}
+
+	return s.TCPConn
+}
+
 // ReadFrom implements net.PacketConn for *socksConn.
 func (s *socksConn) ReadFrom(p []byte) (n int, addr net.Addr, err error) {
 	n, err = s.Read(p)
@@ -0,0 +1,342 @@
+package quicshape
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Frame types that may be found in Initial packets, see RFC 9000, Section
+// 17.2.2.
+const (
+	framePadding         = 0x00
+	framePing            = 0x01
+	frameAck             = 0x02
+	frameAckECN          = 0x03
+	frameCrypto          = 0x06
+	frameConnectionClose = 0x1c
+)
+
+// cryptoFrame is a QUIC CRYPTO frame.
+type cryptoFrame struct {
+	offset uint64
+	data   []byte
+}
+
+// appendTo appends the encoded frame to b.
+func (f *cryptoFrame) appendTo(b []byte) (res []byte) {
+	b = append(b, frameCrypto)
+	b = appendMinVarint(b, f.offset)
+	b = appendMinVarint(b, uint64(len(f.data)))
+
+	return append(b, f.data...)
+}
+
+// parseCryptoFrames parses the Initial packet payload and returns CRYPTO
+// frames found in it.  ok is false if the payload contains other frames except
+// for PADDING, PING, and CRYPTO since it's not a packet with ClientHello then.
+func parseCryptoFrames(payload []byte) (frames []*cryptoFrame, hasPing, ok bool) {
+	for pos := 0; pos < len(payload); {
+		switch payload[pos] {
+		case framePadding:
+			pos++
+		case framePing:
+			hasPing = true
+			pos++
+		case frameCrypto:
+			var f *cryptoFrame
+			f, pos, ok = parseCryptoFrame(payload, pos)
+			if !ok {
+				return nil, false, false
+			}
+
+			frames = append(frames, f)
+		default:
+			return nil, false, false
+		}
+	}
+
+	return frames, hasPing, true
+}
+
+// parseCryptoFrame parses the CRYPTO frame at the offset pos of payload.  next
+// is the offset of the next frame.
+func parseCryptoFrame(payload []byte, pos int) (f *cryptoFrame, next int, ok bool) {
+	offset, n, ok := parseVarint(payload, pos+1)
+	if !ok {
+		return nil, 0, false
+	}
+
+	length, m, ok := parseVarint(payload, pos+1+n)
+	if !ok {
+		return nil, 0, false
+	}
+
+	start := pos + 1 + n + m
+	if start+int(length) > len(payload) {
+		return nil, 0, false
+	}
+
+	return &cryptoFrame{
+		offset: offset,
+		data:   payload[start : start+int(length)],
+	}, start + int(length), true
+}
+
+// splitCryptoFrames splits the data of frames into the specified number of
+// parts of the same size.  Every part is a separate frame.
+func splitCryptoFrames(frames []*cryptoFrame, parts int) (res []*cryptoFrame) {
+	total := 0
+	for _, f := range frames {
+		total += len(f.data)
+	}
+
+	chunkSize := max((total+parts-1)/parts, 1)
+	for _, f := range frames {
+		for off := 0; off < len(f.data); off += chunkSize {
+			end := min(off+chunkSize, len(f.data))
+			res = append(res, &cryptoFrame{
+				offset: f.offset + uint64(off),
+				data:   f.data[off:end],
+			})
+		}
+	}
+
+	return res
+}
+
+// ackRange is a range of acknowledged packet numbers, both ends are
+// inclusive.
+type ackRange struct {
+	smallest uint64
+	largest  uint64
+}
+
+// ackFrame is a QUIC ACK frame.
+type ackFrame struct {
+	// ranges are the acknowledged ranges in the descending order.
+	ranges []ackRange
+
+	// ecn is the encoded ECN counts of the ACK_ECN frame.
+	ecn []byte
+
+	// delay is the encoded ACK delay.
+	delay uint64
+}
+
+// contains returns true if pn is acknowledged by f.
+func (f *ackFrame) contains(pn uint64) (ok bool) {
+	for _, r := range f.ranges {
+		if pn >= r.smallest && pn <= r.largest {
+			return true
+		}
+	}
+
+	return false
+}
+
+// appendTo appends the encoded frame to b.
+func (f *ackFrame) appendTo(b []byte) (res []byte) {
+	typ := byte(frameAck)
+	if f.ecn != nil {
+		typ = frameAckECN
+	}
+
+	b = append(b, typ)
+	b = appendMinVarint(b, f.ranges[0].largest)
+	b = appendMinVarint(b, f.delay)
+	b = appendMinVarint(b, uint64(len(f.ranges)-1))
+	b = appendMinVarint(b, f.ranges[0].largest-f.ranges[0].smallest)
+
+	for i := 1; i < len(f.ranges); i++ {
+		gap := f.ranges[i-1].smallest - f.ranges[i].largest - 2
+		b = appendMinVarint(b, gap)
+		b = appendMinVarint(b, f.ranges[i].largest-f.ranges[i].smallest)
+	}
+
+	return append(b, f.ecn...)
+}
+
+// parseAckFrame parses the ACK frame at the offset pos of payload, see RFC
+// 9000, Section 19.3.  next is the offset of the next frame.
+func parseAckFrame(payload []byte, pos int) (f *ackFrame, next int, err error) {
+	typ := payload[pos]
+	pos++
+
+	var fields [4]uint64
+	for i := range fields {
+		var n int
+		var ok bool
+		fields[i], n, ok = parseVarint(payload, pos)
+		if !ok {
+			return nil, 0, fmt.Errorf("bad ack frame")
+		}
+		pos += n
+	}
+
+	largest, delay, rangeCount, firstRange := fields[0], fields[1], fields[2], fields[3]
+	if firstRange > largest {
+		return nil, 0, fmt.Errorf("bad first ack range %d for largest %d", firstRange, largest)
+	}
+
+	f = &ackFrame{
+		ranges: []ackRange{{smallest: largest - firstRange, largest: largest}},
+		delay:  delay,
+	}
+
+	for i := uint64(0); i < rangeCount; i++ {
+		gap, n, ok := parseVarint(payload, pos)
+		if !ok {
+			return nil, 0, fmt.Errorf("bad ack range gap")
+		}
+		pos += n
+
+		length, m, ok := parseVarint(payload, pos)
+		if !ok {
+			return nil, 0, fmt.Errorf("bad ack range length")
+		}
+		pos += m
+
+		prev := f.ranges[len(f.ranges)-1].smallest
+		if gap+2+length > prev {
+			return nil, 0, fmt.Errorf("ack range is out of bounds")
+		}
+
+		rangeLargest := prev - gap - 2
+		f.ranges = append(f.ranges, ackRange{smallest: rangeLargest - length, largest: rangeLargest})
+	}
+
+	if typ == frameAckECN {
+		start := pos
+		for i := 0; i < 3; i++ {
+			_, n, ok := parseVarint(payload, pos)
+			if !ok {
+				return nil, 0, fmt.Errorf("bad ecn counts")
+			}
+			pos += n
+		}
+
+		f.ecn = payload[start:pos]
+	}
+
+	return f, pos, nil
+}
+
+// mapAckFrame converts f that acknowledges the packet numbers sent on the wire
+// into the frame that acknowledges the packet numbers of the QUIC stack, see
+// packetConn.wireToOrig.  A packet is acknowledged only if all the packets it
+// was split into are acknowledged.  res is nil if no packets are
+// acknowledged.
+func mapAckFrame(f *ackFrame, wireToOrig map[uint64]uint64) (res *ackFrame) {
+	acked := map[uint64]bool{}
+	for wire, orig := range wireToOrig {
+		isAcked, seen := acked[orig]
+		if !seen || isAcked {
+			acked[orig] = f.contains(wire)
+		}
+	}
+
+	var pns []uint64
+	for pn, isAcked := range acked {
+		if isAcked {
+			pns = append(pns, pn)
+		}
+	}
+
+	if len(pns) == 0 {
+		return nil
+	}
+
+	slices.Sort(pns)
+	slices.Reverse(pns)
+
+	res = &ackFrame{
+		ecn:   f.ecn,
+		delay: f.delay,
+	}
+
+	for _, pn := range pns {
+		last := len(res.ranges) - 1
+		if last >= 0 && res.ranges[last].smallest == pn+1 {
+			res.ranges[last].smallest = pn
+
+			continue
+		}
+
+		res.ranges = append(res.ranges, ackRange{smallest: pn, largest: pn})
+	}
+
+	return res
+}
+
+// mapAckFrames rewrites ACK frames in the server's Initial packet payload
+// using mapAckFrame.  The result has the same size as payload, the freed
+// space is filled with PADDING frames.
+func mapAckFrames(payload []byte, wireToOrig map[uint64]uint64) (res []byte, err error) {
+	res = make([]byte, 0, len(payload))
+
+	for pos := 0; pos < len(payload); {
+		start := pos
+
+		switch payload[pos] {
+		case framePadding, framePing:
+			pos++
+		case frameCrypto:
+			var ok bool
+			_, pos, ok = parseCryptoFrame(payload, pos)
+			if !ok {
+				return nil, fmt.Errorf("bad crypto frame")
+			}
+		case frameConnectionClose:
+			pos, err = skipConnectionClose(payload, pos)
+			if err != nil {
+				return nil, err
+			}
+		case frameAck, frameAckECN:
+			var f *ackFrame
+			f, pos, err = parseAckFrame(payload, pos)
+			if err != nil {
+				return nil, err
+			}
+
+			if mapped := mapAckFrame(f, wireToOrig); mapped != nil {
+				res = mapped.appendTo(res)
+			}
+
+			continue
+		default:
+			return nil, fmt.Errorf("unexpected frame type 0x%x", payload[pos])
+		}
+
+		res = append(res, payload[start:pos]...)
+	}
+
+	if len(res) > len(payload) {
+		return nil, fmt.Errorf("rewritten payload size %d exceeds %d", len(res), len(payload))
+	}
+
+	return append(res, make([]byte, len(payload)-len(res))...), nil
+}
+
+// skipConnectionClose returns the offset of the frame that follows the
+// CONNECTION_CLOSE frame at the offset pos of payload.
+func skipConnectionClose(payload []byte, pos int) (next int, err error) {
+	pos++
+
+	// Error code, frame type, and reason phrase length.
+	var reasonLen uint64
+	for i := 0; i < 3; i++ {
+		v, n, ok := parseVarint(payload, pos)
+		if !ok {
+			return 0, fmt.Errorf("bad connection close frame")
+		}
+		pos += n
+		reasonLen = v
+	}
+
+	pos += int(reasonLen)
+	if pos > len(payload) {
+		return 0, fmt.Errorf("bad connection close reason")
+	}
+
+	return pos, nil
+}
@@ -0,0 +1,422 @@
+package quicshape
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"slices"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// QUIC versions which Initial packets can be shaped.
+const (
+	// quicVersion1 is the QUIC version 1 (RFC 9000).
+	quicVersion1 = 0x00000001
+
+	// quicVersion2 is the QUIC version 2 (RFC 9369).
+	quicVersion2 = 0x6b3343cf
+)
+
+// versionParams are the version-specific parameters of Initial packets.
+type versionParams struct {
+	// salt is used to derive the Initial secrets.
+	salt []byte
+
+	// keyLabel, ivLabel, and hpLabel are the HKDF labels of the packet
+	// protection keys.
+	keyLabel string
+	ivLabel  string
+	hpLabel  string
+
+	// initialType and retryType are the long header packet types of Initial
+	// and Retry packets.
+	initialType byte
+	retryType   byte
+}
+
+// versions are the parameters of the supported QUIC versions, see RFC 9001,
+// Section 5.2, and RFC 9369, Section 3.3.
+var versions = map[uint32]*versionParams{
+	quicVersion1: {
+		salt: []byte{
+			0x38, 0x76, 0x2c, 0xf7, 0xf5, 0x59, 0x34, 0xb3, 0x4d, 0x17,
+			0x9a, 0xe6, 0xa4, 0xc8, 0x0c, 0xad, 0xcc, 0xbb, 0x7f, 0x0a,
+		},
+		keyLabel:    "quic key",
+		ivLabel:     "quic iv",
+		hpLabel:     "quic hp",
+		initialType: 0x00,
+		retryType:   0x03,
+	},
+	quicVersion2: {
+		salt: []byte{
+			0x0d, 0xed, 0xe3, 0xde, 0xf7, 0x00, 0xa6, 0xdb, 0x81, 0x93,
+			0x81, 0xbe, 0x6e, 0x26, 0x9d, 0xcb, 0xf9, 0xbd, 0x2e, 0xd9,
+		},
+		keyLabel:    "quicv2 key",
+		ivLabel:     "quicv2 iv",
+		hpLabel:     "quicv2 hp",
+		initialType: 0x01,
+		retryType:   0x00,
+	},
+}
+
+// packetHeader contains the positions of the long header packet fields.
+type packetHeader struct {
+	// dcid is the destination connection ID.
+	dcid []byte
+
+	// version is the QUIC version of the packet.
+	version uint32
+
+	// initial is true for Initial packets.
+	initial bool
+
+	// lengthOffset is the offset of the length field.
+	lengthOffset int
+
+	// lengthLen is the size of the length field.
+	lengthLen int
+
+	// pnOffset is the offset of the packet number.
+	pnOffset int
+
+	// end is the offset of the packet end.
+	end int
+}
+
+// parseLongHeader parses the long header of the QUIC packet at the beginning
+// of b.  hdr is nil if the packet has a short header, has no length field
+// (Version Negotiation and Retry), or is malformed.  err is not nil if the
+// QUIC version is not supported.
+func parseLongHeader(b []byte) (hdr *packetHeader, err error) {
+	// Long header form bit must be set.
+	if len(b) < 7 || b[0]&0x80 == 0 {
+		return nil, nil
+	}
+
+	hdr = &packetHeader{
+		version: binary.BigEndian.Uint32(b[1:5]),
+	}
+
+	// Version Negotiation packets have no length.
+	if hdr.version == 0 {
+		return nil, nil
+	}
+
+	params, ok := versions[hdr.version]
+	if !ok {
+		return nil, fmt.Errorf("unsupported quic version 0x%x", hdr.version)
+	}
+
+	typ := (b[0] >> 4) & 0x03
+	if typ == params.retryType {
+		return nil, nil
+	}
+
+	pos := 5
+	dcidLen := int(b[pos])
+	pos++
+	if pos+dcidLen >= len(b) {
+		return nil, nil
+	}
+	hdr.dcid = b[pos : pos+dcidLen]
+	pos += dcidLen
+
+	scidLen := int(b[pos])
+	pos += 1 + scidLen
+
+	hdr.initial = typ == params.initialType
+	if hdr.initial {
+		tokenLen, n, tokenOK := parseVarint(b, pos)
+		if !tokenOK {
+			return nil, nil
+		}
+		pos += n + int(tokenLen)
+	}
+
+	hdr.lengthOffset = pos
+	length, n, ok := parseVarint(b, pos)
+	if !ok {
+		return nil, nil
+	}
+
+	hdr.lengthLen = n
+	hdr.pnOffset = pos + n
+	hdr.end = hdr.pnOffset + int(length)
+
+	// The header protection sample starts 4 bytes after the packet number
+	// offset and is 16 bytes long.
+	if hdr.end > len(b) || hdr.pnOffset+4+16 > hdr.end {
+		return nil, nil
+	}
+
+	return hdr, nil
+}
+
+// initialPacket is the decrypted Initial packet.
+type initialPacket struct {
+	// prefix is the unprotected header up to the length field.  The packet
+	// number length bits of the first byte are kept.
+	prefix []byte
+
+	// payload is the decrypted payload.
+	payload []byte
+
+	// pn is the full packet number.
+	pn uint64
+
+	// pnLen is the size of the encoded packet number.
+	pnLen int
+
+	// lengthLen is the size of the length field.
+	lengthLen int
+}
+
+// openInitial removes the protection of the Initial packet with the header
+// hdr at the beginning of b.  largestPN is the largest packet number received
+// in the same direction so far or -1.
+func openInitial(b []byte, hdr *packetHeader, k *initialKeys, largestPN int64) (p *initialPacket, err error) {
+	header := slices.Clone(b[:hdr.pnOffset+4])
+	mask := k.headerMask(b[hdr.pnOffset+4 : hdr.pnOffset+4+16])
+	header[0] ^= mask[0] & 0x0f
+	pnLen := int(header[0]&0x03) + 1
+	header = header[:hdr.pnOffset+pnLen]
+
+	var truncated uint64
+	for i := 0; i < pnLen; i++ {
+		header[hdr.pnOffset+i] ^= mask[1+i]
+		truncated = truncated<<8 | uint64(header[hdr.pnOffset+i])
+	}
+
+	pn := decodePacketNumber(largestPN, truncated, pnLen)
+	payload, err := k.aead.Open(nil, k.nonce(pn), b[hdr.pnOffset+pnLen:hdr.end], header)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting initial packet: %w", err)
+	}
+
+	return &initialPacket{
+		prefix:    header[:hdr.lengthOffset],
+		payload:   payload,
+		pn:        pn,
+		pnLen:     pnLen,
+		lengthLen: hdr.lengthLen,
+	}, nil
+}
+
+// sealInitial protects the Initial packet p with k and appends it to b.  The
+// packet number is encoded with the same length as in the original packet.
+func sealInitial(b []byte, p *initialPacket, k *initialKeys) (res []byte, err error) {
+	start := len(b)
+	b = append(b, p.prefix...)
+
+	length := uint64(p.pnLen + len(p.payload) + k.aead.Overhead())
+	b, err = appendVarint(b, length, p.lengthLen)
+	if err != nil {
+		return nil, fmt.Errorf("encoding packet length: %w", err)
+	}
+
+	pnOffset := len(b) - start
+	for i := p.pnLen - 1; i >= 0; i-- {
+		b = append(b, byte(p.pn>>(8*i)))
+	}
+
+	header := b[start:]
+	res = k.aead.Seal(b, k.nonce(p.pn), p.payload, header)
+
+	pkt := res[start:]
+	if pnOffset+4+16 > len(pkt) {
+		return nil, fmt.Errorf("packet of %d bytes is too short for header protection", len(pkt))
+	}
+
+	mask := k.headerMask(pkt[pnOffset+4 : pnOffset+4+16])
+	pkt[0] ^= mask[0] & 0x0f
+	for i := 0; i < p.pnLen; i++ {
+		pkt[pnOffset+i] ^= mask[1+i]
+	}
+
+	return res, nil
+}
+
+// packetLen returns the size of p once it's protected with k.
+func (p *initialPacket) packetLen(k *initialKeys) (n int) {
+	return len(p.prefix) + p.lengthLen + p.pnLen + len(p.payload) + k.aead.Overhead()
+}
+
+// decodePacketNumber decodes the packet number truncated to pnLen bytes, see
+// RFC 9000, Appendix A.3.
+func decodePacketNumber(largestPN int64, truncated uint64, pnLen int) (pn uint64) {
+	expected := largestPN + 1
+	win := int64(1) << (pnLen * 8)
+	hwin := win / 2
+	candidate := (expected &^ (win - 1)) | int64(truncated)
+
+	switch {
+	case candidate <= expected-hwin && candidate < (1<<62)-win:
+		return uint64(candidate + win)
+	case candidate > expected+hwin && candidate >= win:
+		return uint64(candidate - win)
+	default:
+		return uint64(candidate)
+	}
+}
+
+// parseVarint parses a QUIC variable-length integer at the offset pos of b.
+// n is the size of the encoded value.
+func parseVarint(b []byte, pos int) (v uint64, n int, ok bool) {
+	if pos >= len(b) {
+		return 0, 0, false
+	}
+
+	n = 1 << (b[pos] >> 6)
+	if pos+n > len(b) {
+		return 0, 0, false
+	}
+
+	v = uint64(b[pos] & 0x3f)
+	for i := 1; i < n; i++ {
+		v = v<<8 | uint64(b[pos+i])
+	}
+
+	return v, n, true
+}
+
+// appendVarint appends v encoded as a QUIC variable-length integer of size n
+// to b.
+func appendVarint(b []byte, v uint64, n int) (res []byte, err error) {
+	if v >= 1<<(8*n-2) {
+		return nil, fmt.Errorf("value %d does not fit %d bytes", v, n)
+	}
+
+	// The two most significant bits encode the size: 0 for 1 byte, 1 for 2
+	// bytes, 2 for 4 bytes, and 3 for 8 bytes.
+	prefix := byte(0)
+	for size := n; size > 1; size >>= 1 {
+		prefix++
+	}
+
+	start := len(b)
+	for i := n - 1; i >= 0; i-- {
+		b = append(b, byte(v>>(8*i)))
+	}
+	b[start] |= prefix << 6
+
+	return b, nil
+}
+
+// appendMinVarint appends v encoded as a QUIC variable-length integer of the
+// minimum size.
+func appendMinVarint(b []byte, v uint64) (res []byte) {
+	for _, n := range []int{1, 2, 4} {
+		if v < 1<<(8*n-2) {
+			res, _ = appendVarint(b, v, n)
+
+			return res
+		}
+	}
+
+	res, _ = appendVarint(b, v, 8)
+
+	return res
+}
+
+// initialKeys are the keys that protect Initial packets in one direction.
+type initialKeys struct {
+	aead cipher.AEAD
+	hp   cipher.Block
+	iv   []byte
+}
+
+// newInitialKeys derives the Initial keys of the client or of the server from
+// the destination connection ID of the client's first Initial packet.
+func newInitialKeys(dcid []byte, version uint32, server bool) (k *initialKeys, err error) {
+	key, iv, hpKey, err := initialKeyMaterial(dcid, version, server)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	hp, err := aes.NewCipher(hpKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &initialKeys{
+		aead: aead,
+		hp:   hp,
+		iv:   iv,
+	}, nil
+}
+
+// initialKeyMaterial derives the packet protection key, IV, and header
+// protection key, see RFC 9001, Section 5.2.
+func initialKeyMaterial(dcid []byte, version uint32, server bool) (key, iv, hp []byte, err error) {
+	params, ok := versions[version]
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("unsupported quic version 0x%x", version)
+	}
+
+	label := "client in"
+	if server {
+		label = "server in"
+	}
+
+	initialSecret := hkdf.Extract(sha256.New, dcid, params.salt)
+	secret := hkdfExpandLabel(initialSecret, label, sha256.Size)
+
+	key = hkdfExpandLabel(secret, params.keyLabel, 16)
+	iv = hkdfExpandLabel(secret, params.ivLabel, 12)
+	hp = hkdfExpandLabel(secret, params.hpLabel, 16)
+
+	return key, iv, hp, nil
+}
+
+// nonce returns the AEAD nonce for the packet number pn.
+func (k *initialKeys) nonce(pn uint64) (nonce []byte) {
+	nonce = slices.Clone(k.iv)
+	for i := 0; i < 8; i++ {
+		nonce[len(nonce)-1-i] ^= byte(pn >> (8 * i))
+	}
+
+	return nonce
+}
+
+// headerMask returns the header protection mask for the sample.
+func (k *initialKeys) headerMask(sample []byte) (mask []byte) {
+	mask = make([]byte, aes.BlockSize)
+	k.hp.Encrypt(mask, sample)
+
+	return mask
+}
+
+// hkdfExpandLabel implements HKDF-Expand-Label from RFC 8446, Section 7.1,
+// with an empty context.
+func hkdfExpandLabel(secret []byte, label string, length int) (out []byte) {
+	fullLabel := "tls13 " + label
+
+	info := binary.BigEndian.AppendUint16(nil, uint16(length))
+	info = append(info, byte(len(fullLabel)))
+	info = append(info, fullLabel...)
+	info = append(info, 0)
+
+	out = make([]byte, length)
+	_, err := io.ReadFull(hkdf.Expand(sha256.New, secret, info), out)
+	if err != nil {
+		panic(err)
+	}
+
+	return out
+}
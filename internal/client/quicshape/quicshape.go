@@ -0,0 +1,354 @@
+// Package quicshape implements QUIC Initial packet shaping (--quic-split,
+// --quic-reorder, --quic-initial-size) that is the QUIC counterpart of the
+// ClientHello splitting features for TCP.
+//
+// Initial packets are protected with the keys derived from the destination
+// connection ID which is sent in clear so anyone (including DPI systems) is
+// able to decrypt them.  The packet conn implemented here decrypts the
+// client's Initial packets, splits ClientHello into several Initial packets
+// sent in separate datagrams, and encrypts them back so that the QUIC stack is
+// not aware of the changes.
+//
+// Every extra packet takes a packet number so the packet numbers of the
+// client's Initial packets on the wire are shifted, and the ACK frames in the
+// server's Initial packets are converted back to the packet numbers of the
+// QUIC stack.
+package quicshape
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"sync"
+
+	"github.com/ameshkov/gocurl/internal/output"
+)
+
+// Config is the configuration of the Initial packets shaping.
+type Config struct {
+	// Split is the number of Initial packets ClientHello is split into.
+	// Values less than 2 mean no splitting.
+	Split int
+
+	// Reorder makes the Initial packets with ClientHello parts to be sent in
+	// the reversed order.
+	Reorder bool
+
+	// InitialSize is the minimum size of UDP datagrams that carry Initial
+	// packets with ClientHello.  If the datagram is smaller, the Initial
+	// packet is padded.
+	InitialSize int
+}
+
+// NewPacketConn wraps conn so that the client's Initial packets written to it
+// are shaped according to cfg.  QUIC v1 and v2 are supported, WriteTo returns
+// an error if an Initial packet cannot be shaped.
+func NewPacketConn(conn net.PacketConn, cfg *Config, out *output.Output) (c net.PacketConn) {
+	out.Debug(
+		"Shaping QUIC Initial packets is enabled. Split is %d, reorder is %t, initial size is %d",
+		cfg.Split,
+		cfg.Reorder,
+		cfg.InitialSize,
+	)
+
+	return &packetConn{
+		PacketConn:      conn,
+		cfg:             cfg,
+		out:             out,
+		mu:              &sync.Mutex{},
+		wireToOrig:      map[uint64]uint64{},
+		largestPN:       -1,
+		serverLargestPN: -1,
+	}
+}
+
+// packetConn is the implementation of net.PacketConn that shapes the client's
+// Initial packets.
+type packetConn struct {
+	net.PacketConn
+
+	// cfg is the shaping configuration.
+	cfg *Config
+
+	// out is required for debug-level logging.
+	out *output.Output
+
+	// mu protects the fields below since quic-go reads and writes packets in
+	// different goroutines.
+	mu *sync.Mutex
+
+	// keys and serverKeys are the Initial keys of the client and of the
+	// server.  They're derived from the destination connection ID of the
+	// first Initial packet and stay the same even when the connection ID is
+	// changed by the server.
+	keys       *initialKeys
+	serverKeys *initialKeys
+
+	// version is the QUIC version the keys are derived for.
+	version uint32
+
+	// wireToOrig maps the packet numbers of the client's Initial packets sent
+	// on the wire to the packet numbers assigned by the QUIC stack.
+	wireToOrig map[uint64]uint64
+
+	// shift is the difference between the next packet number on the wire and
+	// the packet number assigned by the QUIC stack.
+	shift uint64
+
+	// largestPN is the largest packet number of the client's Initial packets
+	// assigned by the QUIC stack or -1.
+	largestPN int64
+
+	// serverLargestPN is the largest packet number of the server's Initial
+	// packets or -1.
+	serverLargestPN int64
+}
+
+// type check
+var _ net.PacketConn = (*packetConn)(nil)
+
+// WriteTo implements net.PacketConn for *packetConn.
+func (c *packetConn) WriteTo(b []byte, addr net.Addr) (n int, err error) {
+	c.mu.Lock()
+	datagrams, err := c.shapeDatagram(b)
+	c.mu.Unlock()
+	if err != nil {
+		return 0, fmt.Errorf("shaping quic initial packet: %w", err)
+	}
+
+	for _, d := range datagrams {
+		_, err = c.PacketConn.WriteTo(d, addr)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(b), nil
+}
+
+// ReadFrom implements net.PacketConn for *packetConn.
+func (c *packetConn) ReadFrom(b []byte) (n int, addr net.Addr, err error) {
+	n, addr, err = c.PacketConn.ReadFrom(b)
+	if err != nil {
+		return n, addr, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Nothing to convert unless the packet numbers were shifted.
+	if c.shift == 0 || c.serverKeys == nil {
+		return n, addr, nil
+	}
+
+	err = c.mapServerDatagram(b[:n])
+	if err != nil {
+		// The packet is left as is, quic-go will drop it and the server will
+		// retransmit the data.
+		c.out.Debug("Failed to convert ACK frames in QUIC Initial packet: %v", err)
+	}
+
+	return n, addr, nil
+}
+
+// shapeDatagram shapes the client's Initial packet at the beginning of the
+// datagram b and returns the datagrams that should be sent instead of b.
+func (c *packetConn) shapeDatagram(b []byte) (datagrams [][]byte, err error) {
+	hdr, err := parseLongHeader(b)
+	if err != nil {
+		return nil, err
+	} else if hdr == nil || !hdr.initial {
+		return [][]byte{b}, nil
+	}
+
+	p, err := c.openClientInitial(b, hdr)
+	if err != nil {
+		return nil, err
+	}
+
+	c.largestPN = max(c.largestPN, int64(p.pn))
+	rest := b[hdr.end:]
+
+	frames, hasPing, ok := parseCryptoFrames(p.payload)
+	if !ok || len(frames) == 0 {
+		// It's not a packet with ClientHello, only shift its packet number.
+		if c.shift == 0 {
+			c.wireToOrig[p.pn] = p.pn
+
+			return [][]byte{b}, nil
+		}
+
+		return c.resealInitial(p, rest)
+	}
+
+	return c.splitInitial(p, frames, hasPing, max(len(b), c.cfg.InitialSize), rest)
+}
+
+// openClientInitial decrypts the client's Initial packet.  It derives the keys
+// when the first packet is sent and when the connection ID is changed after
+// the server sends a Retry packet.
+func (c *packetConn) openClientInitial(b []byte, hdr *packetHeader) (p *initialPacket, err error) {
+	if c.keys != nil && c.version == hdr.version {
+		p, err = openInitial(b, hdr, c.keys, c.largestPN)
+		if err == nil {
+			return p, nil
+		}
+	}
+
+	k, err := newInitialKeys(hdr.dcid, hdr.version, false)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err = openInitial(b, hdr, k, c.largestPN)
+	if err != nil {
+		return nil, err
+	}
+
+	c.serverKeys, err = newInitialKeys(hdr.dcid, hdr.version, true)
+	if err != nil {
+		return nil, err
+	}
+
+	c.keys, c.version = k, hdr.version
+
+	return p, nil
+}
+
+// resealInitial encrypts p with the next packet number on the wire and
+// prepends it to rest.
+func (c *packetConn) resealInitial(p *initialPacket, rest []byte) (datagrams [][]byte, err error) {
+	orig := p.pn
+	p.pn += c.shift
+	c.wireToOrig[p.pn] = orig
+
+	d, err := sealInitial(nil, p, c.keys)
+	if err != nil {
+		return nil, err
+	}
+
+	return [][]byte{append(d, rest...)}, nil
+}
+
+// splitInitial splits the CRYPTO frames of p into several Initial packets each
+// of which is sent in a separate datagram of the specified size.  rest is the
+// part of the original datagram that follows the packet, it is appended to
+// the last datagram.
+func (c *packetConn) splitInitial(
+	p *initialPacket,
+	frames []*cryptoFrame,
+	hasPing bool,
+	size int,
+	rest []byte,
+) (datagrams [][]byte, err error) {
+	parts := []*cryptoFrame{}
+	if c.cfg.Split > 1 {
+		parts = splitCryptoFrames(frames, c.cfg.Split)
+	}
+
+	// Without splitting all the frames are sent in one packet.
+	packets := len(parts)
+	if packets == 0 {
+		packets = 1
+	}
+
+	orig := p.pn
+	for i := 0; i < packets; i++ {
+		var payload []byte
+		if len(parts) == 0 {
+			for _, f := range frames {
+				payload = f.appendTo(payload)
+			}
+		} else {
+			payload = parts[i].appendTo(payload)
+		}
+
+		if hasPing && i == 0 {
+			payload = append(payload, framePing)
+		}
+
+		pkt := &initialPacket{
+			prefix:    p.prefix,
+			payload:   payload,
+			pn:        orig + c.shift + uint64(i),
+			pnLen:     p.pnLen,
+			lengthLen: p.lengthLen,
+		}
+
+		target := size
+		if i == packets-1 {
+			target -= len(rest)
+		}
+
+		// PADDING frames are just zero bytes, put them first like quic-go
+		// does.
+		padding := target - pkt.packetLen(c.keys)
+		if padding < 0 {
+			return nil, fmt.Errorf("packet size %d exceeds datagram size %d", pkt.packetLen(c.keys), target)
+		}
+		pkt.payload = append(make([]byte, padding), payload...)
+
+		var d []byte
+		d, err = sealInitial(nil, pkt, c.keys)
+		if err != nil {
+			return nil, err
+		}
+
+		c.wireToOrig[pkt.pn] = orig
+		datagrams = append(datagrams, d)
+	}
+
+	c.shift += uint64(packets - 1)
+	datagrams[len(datagrams)-1] = append(datagrams[len(datagrams)-1], rest...)
+
+	if c.cfg.Reorder {
+		slices.Reverse(datagrams)
+	}
+
+	c.out.Debug("Split QUIC Initial packet %d into %d packets of %d bytes", orig, packets, size)
+
+	return datagrams, nil
+}
+
+// mapServerDatagram converts the ACK frames of the server's Initial packets in
+// the datagram b in place, see mapAckFrame.
+func (c *packetConn) mapServerDatagram(b []byte) (err error) {
+	// The datagram may contain several coalesced packets.
+	for pos := 0; pos < len(b); {
+		hdr, hdrErr := parseLongHeader(b[pos:])
+		if hdrErr != nil || hdr == nil {
+			return hdrErr
+		}
+
+		if hdr.initial {
+			err = c.mapServerInitial(b[pos:pos+hdr.end], hdr)
+			if err != nil {
+				return err
+			}
+		}
+
+		pos += hdr.end
+	}
+
+	return nil
+}
+
+// mapServerInitial converts the ACK frames of the server's Initial packet b
+// with the header hdr in place.
+func (c *packetConn) mapServerInitial(b []byte, hdr *packetHeader) (err error) {
+	p, err := openInitial(b, hdr, c.serverKeys, c.serverLargestPN)
+	if err != nil {
+		return err
+	}
+
+	c.serverLargestPN = max(c.serverLargestPN, int64(p.pn))
+
+	p.payload, err = mapAckFrames(p.payload, c.wireToOrig)
+	if err != nil {
+		return err
+	}
+
+	_, err = sealInitial(b[:0], p, c.serverKeys)
+
+	return err
+}
@@ -0,0 +1,383 @@
+package quicshape
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/ameshkov/gocurl/internal/output"
+	"github.com/stretchr/testify/require"
+)
+
+// decodeHex decodes s ignoring whitespaces.
+func decodeHex(t *testing.T, s string) (b []byte) {
+	t.Helper()
+
+	b, err := hex.DecodeString(strings.Join(strings.Fields(s), ""))
+	require.NoError(t, err)
+
+	return b
+}
+
+// testDCID is the destination connection ID from RFC 9001, Appendix A.
+const testDCID = "8394c8f03e515708"
+
+func TestNewInitialKeys(t *testing.T) {
+	// See RFC 9001, Appendix A.1, and RFC 9369, Appendix A.1.
+	testCases := []struct {
+		name    string
+		version uint32
+		server  bool
+		key     string
+		iv      string
+		hp      string
+	}{{
+		name:    "v1_client",
+		version: quicVersion1,
+		key:     "1f369613dd76d5467730efcbe3b1a22d",
+		iv:      "fa044b2f42a3fd3b46fb255c",
+		hp:      "9f50449e04a0e810283a1e9933adedd2",
+	}, {
+		name:    "v1_server",
+		version: quicVersion1,
+		server:  true,
+		key:     "cf3a5331653c364c88f0f379b6067e37",
+		iv:      "0ac1493ca1905853b0bba03e",
+		hp:      "c206b8d9b9f0f37644430b490eeaa314",
+	}, {
+		name:    "v2_client",
+		version: quicVersion2,
+		key:     "8b1a0bc121284290a29e0971b5cd045d",
+		iv:      "91f73e2351d8fa91660e909f",
+		hp:      "45b95e15235d6f45a6b19cbcb0294ba9",
+	}, {
+		name:    "v2_server",
+		version: quicVersion2,
+		server:  true,
+		key:     "82db637861d55e1d011f19ea71d5d2a7",
+		iv:      "dd13c276499c0249d3310652",
+		hp:      "edf6d05c83121201b436e16877593c3a",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			key, iv, hp, err := initialKeyMaterial(decodeHex(t, testDCID), tc.version, tc.server)
+			require.NoError(t, err)
+
+			require.Equal(t, tc.key, hex.EncodeToString(key))
+			require.Equal(t, tc.iv, hex.EncodeToString(iv))
+			require.Equal(t, tc.hp, hex.EncodeToString(hp))
+		})
+	}
+}
+
+func TestOpenInitial(t *testing.T) {
+	// The server's Initial packet from RFC 9001, Appendix A.3.
+	packet := decodeHex(t, `
+		cf000000010008f067a5502a4262b5004075c0d95a482cd0991cd25b0aac406a
+		5816b6394100f37a1c69797554780bb38cc5a99f5ede4cf73c3ec2493a1839b3
+		dbcba3f6ea46c5b7684df3548e7ddeb9c3bf9c73cc3f3bded74b562bfb19fb84
+		022f8ef4cdd93795d77d06edbb7aaf2f58891850abbdca3d20398c276456cbc4
+		2158407dd074ee`)
+	payload := decodeHex(t, `
+		02000000000600405a020000560303eefce7f7b37ba1d1632e96677825ddf7
+		3988cfc79825df566dc5430b9a045a1200130100002e00330024001d00209d3c
+		940d89690b84d08a60993c144eca684d1081287c834d5311bcf32bb9da1a002b
+		00020304`)
+
+	k, err := newInitialKeys(decodeHex(t, testDCID), quicVersion1, true)
+	require.NoError(t, err)
+
+	hdr, err := parseLongHeader(packet)
+	require.NoError(t, err)
+	require.NotNil(t, hdr)
+	require.True(t, hdr.initial)
+	require.Equal(t, len(packet), hdr.end)
+
+	p, err := openInitial(packet, hdr, k, -1)
+	require.NoError(t, err)
+
+	require.Equal(t, uint64(1), p.pn)
+	require.Equal(t, 2, p.pnLen)
+	require.Equal(t, "c1000000010008f067a5502a4262b500", hex.EncodeToString(p.prefix))
+	require.Equal(t, payload, p.payload)
+
+	// Protecting the packet again must produce the same bytes.
+	sealed, err := sealInitial(nil, p, k)
+	require.NoError(t, err)
+	require.Equal(t, packet, sealed)
+
+	// The payload contains an ACK frame and a CRYPTO frame with ServerHello.
+	f, next, err := parseAckFrame(p.payload, 0)
+	require.NoError(t, err)
+	require.Equal(t, []ackRange{{smallest: 0, largest: 0}}, f.ranges)
+
+	cf, _, ok := parseCryptoFrame(p.payload, next)
+	require.True(t, ok)
+	require.Equal(t, uint64(0), cf.offset)
+	require.Len(t, cf.data, 90)
+}
+
+func TestHeaderProtection(t *testing.T) {
+	// The header protection of the client's Initial packet from RFC 9001,
+	// Appendix A.2.
+	k, err := newInitialKeys(decodeHex(t, testDCID), quicVersion1, false)
+	require.NoError(t, err)
+
+	mask := k.headerMask(decodeHex(t, "d1b1c98dd7689fb8ec11d242b123dc9b"))
+	require.Equal(t, "437b9aec36", hex.EncodeToString(mask[:5]))
+}
+
+func TestVarint(t *testing.T) {
+	// See RFC 9000, Appendix A.1.
+	testCases := []struct {
+		in   string
+		want uint64
+		min  bool
+	}{{
+		in:   "c2197c5eff14e88c",
+		want: 151288809941952652,
+		min:  true,
+	}, {
+		in:   "9d7f3e7d",
+		want: 494878333,
+		min:  true,
+	}, {
+		in:   "7bbd",
+		want: 15293,
+		min:  true,
+	}, {
+		in:   "25",
+		want: 37,
+		min:  true,
+	}, {
+		in:   "4025",
+		want: 37,
+		min:  false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.in, func(t *testing.T) {
+			b := decodeHex(t, tc.in)
+
+			v, n, ok := parseVarint(b, 0)
+			require.True(t, ok)
+			require.Equal(t, tc.want, v)
+			require.Equal(t, len(b), n)
+
+			if tc.min {
+				require.Equal(t, b, appendMinVarint(nil, v))
+			}
+
+			enc, err := appendVarint(nil, v, n)
+			require.NoError(t, err)
+			require.Equal(t, b, enc)
+		})
+	}
+
+	_, err := appendVarint(nil, 64, 1)
+	require.Error(t, err)
+
+	_, _, ok := parseVarint(decodeHex(t, "9d7f"), 0)
+	require.False(t, ok)
+}
+
+func TestDecodePacketNumber(t *testing.T) {
+	// See RFC 9000, Appendix A.3.
+	require.Equal(t, uint64(0xa82f9b32), decodePacketNumber(0xa82f30ea, 0x9b32, 2))
+	require.Equal(t, uint64(0), decodePacketNumber(-1, 0, 1))
+	require.Equal(t, uint64(256), decodePacketNumber(255, 0, 1))
+}
+
+// recordingPacketConn is a net.PacketConn that records the written datagrams
+// and returns the queued ones from ReadFrom.
+type recordingPacketConn struct {
+	net.PacketConn
+
+	written [][]byte
+	toRead  [][]byte
+}
+
+// WriteTo implements net.PacketConn for *recordingPacketConn.
+func (c *recordingPacketConn) WriteTo(b []byte, _ net.Addr) (n int, err error) {
+	c.written = append(c.written, bytes.Clone(b))
+
+	return len(b), nil
+}
+
+// ReadFrom implements net.PacketConn for *recordingPacketConn.
+func (c *recordingPacketConn) ReadFrom(b []byte) (n int, addr net.Addr, err error) {
+	n = copy(b, c.toRead[0])
+	c.toRead = c.toRead[1:]
+
+	return n, nil, nil
+}
+
+// newTestInitial returns a protected Initial packet padded to size with the
+// specified frames.
+func newTestInitial(
+	t *testing.T,
+	version uint32,
+	server bool,
+	pn uint64,
+	frames []byte,
+	size int,
+) (b []byte) {
+	t.Helper()
+
+	k, err := newInitialKeys(decodeHex(t, testDCID), version, server)
+	require.NoError(t, err)
+
+	// Long header with the packet type, 2-byte packet number, version, DCID,
+	// empty SCID, and empty token.
+	prefix := []byte{0xc1 | versions[version].initialType<<4}
+	prefix = binary.BigEndian.AppendUint32(prefix, version)
+	prefix = append(prefix, 8)
+	prefix = append(prefix, decodeHex(t, testDCID)...)
+	prefix = append(prefix, 0, 0)
+
+	p := &initialPacket{
+		prefix:    prefix,
+		pn:        pn,
+		pnLen:     2,
+		lengthLen: 2,
+	}
+	p.payload = append(make([]byte, size-p.packetLen(k)-len(frames)), frames...)
+
+	b, err = sealInitial(nil, p, k)
+	require.NoError(t, err)
+
+	return b
+}
+
+// openTestInitial decrypts the Initial packet b.
+func openTestInitial(t *testing.T, b []byte, server bool) (p *initialPacket) {
+	t.Helper()
+
+	hdr, err := parseLongHeader(b)
+	require.NoError(t, err)
+	require.NotNil(t, hdr)
+
+	k, err := newInitialKeys(hdr.dcid, hdr.version, server)
+	require.NoError(t, err)
+
+	p, err = openInitial(b, hdr, k, -1)
+	require.NoError(t, err)
+
+	return p
+}
+
+func TestPacketConn_split(t *testing.T) {
+	out, err := output.NewOutput("", false)
+	require.NoError(t, err)
+
+	for _, version := range []uint32{quicVersion1, quicVersion2} {
+		rc := &recordingPacketConn{}
+		c := NewPacketConn(rc, &Config{Split: 3, Reorder: true, InitialSize: 1300}, out)
+
+		hello := bytes.Repeat([]byte{0x01}, 300)
+		crypto := (&cryptoFrame{offset: 0, data: hello}).appendTo(nil)
+		initial := newTestInitial(t, version, false, 0, crypto, 1200)
+
+		n, err := c.WriteTo(initial, nil)
+		require.NoError(t, err)
+		require.Equal(t, len(initial), n)
+
+		// ClientHello is split into three packets with separate packet
+		// numbers which are sent in the reversed order.
+		require.Len(t, rc.written, 3)
+
+		var data []byte
+		for i, d := range rc.written {
+			require.Len(t, d, 1300)
+
+			p := openTestInitial(t, d, false)
+			require.Equal(t, uint64(2-i), p.pn)
+
+			frames, _, ok := parseCryptoFrames(p.payload)
+			require.True(t, ok)
+			require.Len(t, frames, 1)
+			require.Equal(t, uint64(100*(2-i)), frames[0].offset)
+			require.Len(t, frames[0].data, 100)
+
+			data = append(frames[0].data, data...)
+		}
+		require.Equal(t, hello, data)
+
+		// The next packet of the QUIC stack gets the next packet number on
+		// the wire.
+		ack := []byte{frameAck, 0, 0, 0, 0}
+		_, err = c.WriteTo(newTestInitial(t, version, false, 1, ack, 1200), nil)
+		require.NoError(t, err)
+		require.Len(t, rc.written, 4)
+		require.Equal(t, uint64(3), openTestInitial(t, rc.written[3], false).pn)
+
+		// The server acknowledges the packets on the wire, the QUIC stack
+		// must see its own packet numbers.  Packet 0 is only acknowledged
+		// when all its parts are.
+		testCases := []struct {
+			name  string
+			ack   *ackFrame
+			want  []ackRange
+			empty bool
+		}{{
+			name: "all",
+			ack:  &ackFrame{ranges: []ackRange{{smallest: 0, largest: 3}}},
+			want: []ackRange{{smallest: 0, largest: 1}},
+		}, {
+			name: "partial",
+			ack:  &ackFrame{ranges: []ackRange{{smallest: 3, largest: 3}, {smallest: 0, largest: 1}}},
+			want: []ackRange{{smallest: 1, largest: 1}},
+		}, {
+			name:  "none",
+			ack:   &ackFrame{ranges: []ackRange{{smallest: 1, largest: 2}}},
+			empty: true,
+		}}
+
+		for _, tc := range testCases {
+			serverInitial := newTestInitial(t, version, true, 0, tc.ack.appendTo(nil), 1200)
+			rc.toRead = append(rc.toRead, serverInitial)
+
+			b := make([]byte, 1500)
+			n, _, err = c.ReadFrom(b)
+			require.NoError(t, err)
+			require.Equal(t, len(serverInitial), n)
+
+			p := openTestInitial(t, b[:n], true)
+
+			// Skip the PADDING frames added by newTestInitial.
+			payload := bytes.TrimLeft(p.payload, "\x00")
+			if tc.empty {
+				require.Empty(t, payload, tc.name)
+
+				continue
+			}
+
+			f, _, err := parseAckFrame(payload, 0)
+			require.NoError(t, err, tc.name)
+			require.Equal(t, tc.want, f.ranges, tc.name)
+		}
+	}
+}
+
+func TestPacketConn_errors(t *testing.T) {
+	out, err := output.NewOutput("", false)
+	require.NoError(t, err)
+
+	c := NewPacketConn(&recordingPacketConn{}, &Config{Split: 2}, out)
+
+	// Unknown QUIC version.
+	initial := newTestInitial(t, quicVersion1, false, 0, []byte{framePing}, 1200)
+	initial[1] = 0xff
+	_, err = c.WriteTo(initial, nil)
+	require.ErrorContains(t, err, "unsupported quic version")
+
+	// Corrupted packet.
+	initial = newTestInitial(t, quicVersion1, false, 0, []byte{framePing}, 1200)
+	initial[len(initial)-1] ^= 0xff
+	_, err = c.WriteTo(initial, nil)
+	require.ErrorContains(t, err, "decrypting initial packet")
+}
@@ -0,0 +1,90 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// ErrReadTimeout is returned when no data of the response body is received
+// within --read-timeout.
+var ErrReadTimeout = errors.New("read timeout")
+
+// withReadTimeout returns the request that can be canceled by the body of its
+// response, see readTimeoutBody.
+func withReadTimeout(r *http.Request) (req *http.Request, cancel context.CancelFunc) {
+	ctx, cancel := context.WithCancel(r.Context())
+
+	return r.WithContext(ctx), cancel
+}
+
+// readTimeoutBody is the response body that cancels the request if no data is
+// received within timeout since the response header or the last read, see
+// --read-timeout.
+type readTimeoutBody struct {
+	body io.ReadCloser
+
+	// cancel cancels the request context.
+	cancel context.CancelFunc
+
+	// timer cancels the request when the timeout expires.
+	timer *time.Timer
+
+	// timedOut is true if the request was canceled by the timer.
+	timedOut *atomic.Bool
+
+	// timeout is the maximum duration of waiting for the body data.
+	timeout time.Duration
+}
+
+// type check
+var _ io.ReadCloser = (*readTimeoutBody)(nil)
+
+// newReadTimeoutBody returns body that cancels the request with cancel if no
+// data is received within timeout.
+func newReadTimeoutBody(
+	body io.ReadCloser,
+	cancel context.CancelFunc,
+	timeout time.Duration,
+) (b *readTimeoutBody) {
+	b = &readTimeoutBody{
+		body:     body,
+		cancel:   cancel,
+		timedOut: &atomic.Bool{},
+		timeout:  timeout,
+	}
+
+	b.timer = time.AfterFunc(timeout, func() {
+		b.timedOut.Store(true)
+		cancel()
+	})
+
+	return b
+}
+
+// Read implements the io.Reader interface for *readTimeoutBody.
+func (b *readTimeoutBody) Read(p []byte) (n int, err error) {
+	n, err = b.body.Read(p)
+	if b.timedOut.Load() {
+		return n, fmt.Errorf("%w after %s: %w", ErrReadTimeout, b.timeout, err)
+	}
+
+	if n > 0 {
+		b.timer.Reset(b.timeout)
+	}
+
+	return n, err
+}
+
+// Close implements the io.Closer interface for *readTimeoutBody.
+func (b *readTimeoutBody) Close() (err error) {
+	b.timer.Stop()
+	err = b.body.Close()
+	b.cancel()
+
+	return err
+}
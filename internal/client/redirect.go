@@ -0,0 +1,213 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ameshkov/gocurl/internal/config"
+	"github.com/ameshkov/gocurl/internal/output"
+)
+
+// maxRedirectBodyDrain is the maximum number of bytes of the redirect response
+// body that are read so that the connection could be reused.
+const maxRedirectBodyDrain = 64 << 10
+
+// ErrTooManyRedirects is returned when the number of redirects exceeds
+// --max-redirs.
+var ErrTooManyRedirects = errors.New("too many redirects")
+
+// redirectTransport is a Transport that follows redirects, see --location.
+// Every request of the chain goes through the base transport so the whole
+// dialer chain (proxy, --connect-to, ECH, etc) is applied to it.
+type redirectTransport struct {
+	Transport
+
+	out *output.Output
+
+	// keepPost is the set of redirect status codes after which POST is not
+	// changed to GET.
+	keepPost map[int]struct{}
+
+	// maxRedirects is the maximum number of redirects to follow.  Negative
+	// value means no limit.
+	maxRedirects int
+
+	// trusted is true if the credentials are sent to other origins.
+	trusted bool
+}
+
+// type check
+var _ Transport = (*redirectTransport)(nil)
+
+// newRedirectTransport wraps base so that it follows redirects as configured
+// by cfg.
+func newRedirectTransport(base Transport, cfg *config.Config, out *output.Output) (t *redirectTransport) {
+	return &redirectTransport{
+		Transport:    base,
+		out:          out,
+		keepPost:     cfg.RedirectKeepPost,
+		maxRedirects: cfg.MaxRedirects,
+		trusted:      cfg.LocationTrusted,
+	}
+}
+
+// RoundTrip implements the http.RoundTripper interface for
+// *redirectTransport.  The followed redirects are attached to the request of
+// the final response, see output.WithRedirects.
+func (t *redirectTransport) RoundTrip(r *http.Request) (resp *http.Response, err error) {
+	// The inner transports may add header fields, e.g. cookies, to the
+	// request so keep the original ones.
+	header := r.Header.Clone()
+	origURL := r.URL
+
+	var redirects []*output.Redirect
+	for {
+		resp, err = t.Transport.RoundTrip(r)
+		if err != nil {
+			return nil, err
+		}
+
+		loc, ok := redirectLocation(resp)
+		if !ok {
+			break
+		}
+
+		if t.maxRedirects >= 0 && len(redirects) >= t.maxRedirects {
+			_ = resp.Body.Close()
+
+			return nil, fmt.Errorf("%w: maximum (%d) followed", ErrTooManyRedirects, t.maxRedirects)
+		}
+
+		redirects = append(redirects, &output.Redirect{
+			URL:        r.URL.String(),
+			Location:   loc.String(),
+			StatusCode: resp.StatusCode,
+			Response:   resp,
+		})
+
+		t.out.Debug("Following redirect %d %s to %s", resp.StatusCode, r.URL, loc)
+
+		// Read the rest of the body so that the connection can be reused.
+		_, _ = io.CopyN(io.Discard, resp.Body, maxRedirectBodyDrain)
+		_ = resp.Body.Close()
+
+		r, err = t.redirectRequest(r, header, origURL, resp.StatusCode, loc)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(redirects) > 0 && resp.Request != nil {
+		resp.Request = resp.Request.WithContext(output.WithRedirects(resp.Request.Context(), redirects))
+	}
+
+	return resp, nil
+}
+
+// redirectLocation returns the URL resp redirects to.  ok is false if resp is
+// not a redirect that can be followed.
+func redirectLocation(resp *http.Response) (loc *url.URL, ok bool) {
+	switch resp.StatusCode {
+	case
+		http.StatusMovedPermanently,
+		http.StatusFound,
+		http.StatusSeeOther,
+		http.StatusTemporaryRedirect,
+		http.StatusPermanentRedirect:
+		// Go on.
+	default:
+		return nil, false
+	}
+
+	loc, err := resp.Location()
+	if err != nil {
+		return nil, false
+	}
+
+	return loc, loc.Scheme == "http" || loc.Scheme == "https"
+}
+
+// redirectRequest creates the request to loc that follows the redirect with
+// statusCode received for prev.  header and origURL are the original header
+// and URL of the first request of the chain.  Like curl, POST is changed to
+// GET after 301, 302 and 303 unless t.keepPost says otherwise, and the
+// credentials are only sent to the scheme, host and port of origURL unless
+// t.trusted is set.
+func (t *redirectTransport) redirectRequest(
+	prev *http.Request,
+	header http.Header,
+	origURL *url.URL,
+	statusCode int,
+	loc *url.URL,
+) (r *http.Request, err error) {
+	r = prev.Clone(prev.Context())
+	r.URL = loc
+	r.Host = ""
+	r.Header = header.Clone()
+
+	if !strings.EqualFold(loc.Hostname(), origURL.Hostname()) {
+		r.Header.Del("Host")
+	}
+
+	if !t.trusted && !sameOrigin(loc, origURL) {
+		r.Header.Del("Authorization")
+		r.Header.Del("Cookie")
+		r = r.WithContext(withoutCredentials(r.Context()))
+	}
+
+	switch {
+	case t.changesToGET(prev.Method, statusCode):
+		r.Method = http.MethodGet
+		r.Body, r.GetBody, r.ContentLength = nil, nil, 0
+		r.Header.Del("Content-Type")
+		r.Header.Del("Content-Encoding")
+	case prev.GetBody != nil:
+		r.Body, err = prev.GetBody()
+		if err != nil {
+			return nil, fmt.Errorf("re-sending request body: %w", err)
+		}
+	case prev.Body != nil && prev.Body != http.NoBody:
+		return nil, fmt.Errorf("cannot follow redirect %d with a request body that cannot be re-sent", statusCode)
+	}
+
+	return r, nil
+}
+
+// sameOrigin returns true if a and b have the same scheme, host and port.  The
+// port defaults to the one of the scheme so that https://example.org and
+// https://example.org:443 are the same.
+func sameOrigin(a, b *url.URL) (ok bool) {
+	portA, portB := a.Port(), b.Port()
+	if portA == "" {
+		portA = defaultPort(a.Scheme)
+	}
+
+	if portB == "" {
+		portB = defaultPort(b.Scheme)
+	}
+
+	return a.Scheme == b.Scheme && strings.EqualFold(a.Hostname(), b.Hostname()) && portA == portB
+}
+
+// changesToGET returns true if the request with method must be changed to GET
+// when following the redirect with statusCode.
+func (t *redirectTransport) changesToGET(method string, statusCode int) (ok bool) {
+	switch statusCode {
+	case http.StatusMovedPermanently, http.StatusFound:
+		// Go on.
+	case http.StatusSeeOther:
+		if method != http.MethodPost {
+			return method != http.MethodGet && method != http.MethodHead
+		}
+	default:
+		return false
+	}
+
+	_, keepPost := t.keepPost[statusCode]
+
+	return method == http.MethodPost && !keepPost
+}
@@ -5,25 +5,34 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 
 	"github.com/ameshkov/gocurl/internal/client/websocket"
 	"github.com/ameshkov/gocurl/internal/config"
+	"github.com/ameshkov/gocurl/internal/ratelimit"
 	"github.com/ameshkov/gocurl/internal/version"
 )
 
 // NewRequest creates a new *http.Request based on *cmd.Options.
 func NewRequest(cfg *config.Config) (req *http.Request, err error) {
-	var bodyStream io.Reader
+	var open func() (r io.Reader)
+	var size int64
+	var contentType string
 
 	// Do not add body for WebSocket requests as in this case --data is handled
 	// differently, and it is sent after the handshake.
 	if !websocket.IsWebSocket(cfg.RequestURL) {
-		bodyStream, err = createBody(cfg)
+		open, size, contentType, err = requestBody(cfg)
 		if err != nil {
 			return nil, err
 		}
 	}
 
+	var bodyStream io.Reader
+	if open != nil {
+		bodyStream = createBody(open(), cfg)
+	}
+
 	method := getMethod(cfg)
 
 	req, err = http.NewRequest(method, cfg.RequestURL.String(), bodyStream)
@@ -31,33 +40,193 @@ func NewRequest(cfg *config.Config) (req *http.Request, err error) {
 		return nil, err
 	}
 
+	if bodyStream != nil {
+		// The body reader is wrapped so http.NewRequest is not able to
+		// figure out its length and the body can't be re-sent on redirect.
+		req.ContentLength = size
+	}
+
+	if bodyStream != nil && size >= 0 {
+		req.GetBody = func() (rc io.ReadCloser, err error) {
+			return io.NopCloser(createBody(open(), cfg)), nil
+		}
+	}
+
 	req.Header.Set("User-Agent", fmt.Sprintf("gocurl/%s", version.Version()))
-	addBodyHeaders(req, cfg)
+	addBodyHeaders(req, cfg, contentType)
 	addHeaders(req, cfg)
+	addExpectContinue(req, cfg)
+	addRange(req, cfg)
+	addCookies(req, cfg)
+	addUserCredentials(req, cfg)
+	addURLCredentials(req, cfg)
 
 	if ur := websocket.UpgradeWebSocket(req); ur != nil {
 		req = ur
 	}
 
-	return req, err
+	// The body is in memory unless it's streamed, see streamsBody.
+	var body []byte
+	if open != nil && !streamsBody(cfg) {
+		body, _ = io.ReadAll(open())
+	}
+
+	err = signRequest(req, cfg, body)
+	if err != nil {
+		return nil, err
+	}
+
+	err = signAWSv4(req, cfg, body)
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
 }
 
-// createBody creates body stream if it's required by the command-line
-// arguments.
-func createBody(cfg *config.Config) (body io.Reader, err error) {
-	if cfg.Data == "" {
-		return nil, nil
+// requestBody returns the function that opens the request body, its size and
+// its content type if it's required by the command-line arguments.  The size
+// is -1 if it's unknown, i.e. the data is streamed from stdin.  The body is
+// read to memory unless it's streamed, see streamsBody.
+func requestBody(cfg *config.Config) (open func() (r io.Reader), size int64, contentType string, err error) {
+	switch {
+	case cfg.Form != nil:
+		var form *multipartBody
+		form, err = newMultipartBody(cfg.Form)
+		if err != nil {
+			return nil, 0, "", err
+		}
+
+		open, size, contentType = form.reader, form.size, form.contentType
+	case cfg.UploadFile != "":
+		open, size, err = uploadFileBody(cfg.UploadFile)
+		if err != nil {
+			return nil, 0, "", err
+		}
+	case cfg.HasData():
+		open, size, err = dataBody(cfg.Data)
+		if err != nil {
+			return nil, 0, "", err
+		}
+
+		contentType = formURLEncoded
+	default:
+		return nil, 0, "", nil
 	}
 
-	return bytes.NewBufferString(cfg.Data), nil
+	if streamsBody(cfg) {
+		if cfg.CompressRequest != "" {
+			// The size of the compressed data is unknown until it's read.
+			open, size = compressedBody(open, cfg.CompressRequest), -1
+		}
+
+		return open, size, contentType, nil
+	}
+
+	body, err := io.ReadAll(open())
+	if err != nil {
+		return nil, 0, "", fmt.Errorf("reading request body: %w", err)
+	}
+
+	if cfg.CompressRequest != "" {
+		body, err = compress(body, cfg.CompressRequest)
+		if err != nil {
+			return nil, 0, "", err
+		}
+	}
+
+	return bytesBody(body), int64(len(body)), contentType, nil
+}
+
+// formURLEncoded is the content type of the --data body.
+const formURLEncoded = "application/x-www-form-urlencoded"
+
+// bytesBody returns the function that opens the body b.
+func bytesBody(b []byte) (open func() (r io.Reader)) {
+	return func() (r io.Reader) { return bytes.NewReader(b) }
+}
+
+// compressedBody returns the function that opens the body from open and
+// compresses it on the fly with the specified encoding.
+func compressedBody(open func() (r io.Reader), encoding string) (compressedOpen func() (r io.Reader)) {
+	return func() (r io.Reader) {
+		return &compressReader{r: open(), encoding: encoding}
+	}
+}
+
+// streamsBody returns true if the --form files, the --data files or the
+// --upload-file are read, and compressed if needed, while the request is sent.
+// Otherwise, the body is read to memory as its hash is signed.
+func streamsBody(cfg *config.Config) (ok bool) {
+	if cfg.SignAlgorithm != "" || cfg.AWSSigV4 != nil {
+		return false
+	}
+
+	return cfg.Form != nil || cfg.HasDataFiles() || cfg.UploadFile != ""
+}
+
+// createBody creates the stream of the request body from r.
+func createBody(r io.Reader, cfg *config.Config) (res io.Reader) {
+	if cfg.LimitRateUpload > 0 {
+		return ratelimit.NewReader(r, cfg.LimitRateUpload)
+	}
+
+	return r
 }
 
 // addBodyHeaders adds necessary HTTP headers if it's required by the
 // command-line arguments. For instance, -d/--data requires adding the
-// Content-Type: application/x-www-form-urlencoded header.
-func addBodyHeaders(req *http.Request, cfg *config.Config) {
-	if cfg.Data != "" && !websocket.IsWebSocket(cfg.RequestURL) {
-		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+// Content-Type: application/x-www-form-urlencoded header.  contentType is the
+// content type of the request body, it is empty if there is no body or the
+// body is the --upload-file.
+func addBodyHeaders(req *http.Request, cfg *config.Config, contentType string) {
+	if contentType != "" {
+		req.Header.Add("Content-Type", contentType)
+	}
+
+	if req.Body != nil && cfg.CompressRequest != "" {
+		req.Header.Set("Content-Encoding", cfg.CompressRequest)
+	}
+}
+
+// expectContinueThreshold is the body size starting from which Expect:
+// 100-continue is sent, it is the same as in curl.
+const expectContinueThreshold = 1 << 20
+
+// addExpectContinue adds Expect: 100-continue to the request with a body that
+// is larger than expectContinueThreshold or of unknown size so that the body
+// is not sent if the server rejects the request.  Like in curl, the empty
+// Expect header from --header disables it.
+func addExpectContinue(req *http.Request, cfg *config.Config) {
+	if v, ok := req.Header["Expect"]; ok {
+		if len(v) == 1 && strings.TrimSpace(v[0]) == "" {
+			req.Header.Del("Expect")
+		}
+
+		return
+	}
+
+	if req.Body == nil || cfg.ForceHTTP2 || cfg.ForceHTTP3 || cfg.TryHTTP3 {
+		// The body of HTTP/2-only and HTTP/3 requests is sent right away.
+		return
+	}
+
+	if req.ContentLength < 0 || req.ContentLength > expectContinueThreshold {
+		req.Header.Set("Expect", "100-continue")
+	}
+}
+
+// addRange adds the Range header for --range or --continue-at unless it's
+// already set with --header.
+func addRange(req *http.Request, cfg *config.Config) {
+	if req.Header.Get("Range") != "" {
+		return
+	}
+
+	if cfg.Range != "" {
+		req.Header.Set("Range", "bytes="+cfg.Range)
+	} else if cfg.ContinueAt > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", cfg.ContinueAt))
 	}
 }
 
@@ -69,3 +238,50 @@ func addHeaders(req *http.Request, cfg *config.Config) {
 		}
 	}
 }
+
+// addCookies adds the cookies from --cookie to req.  The cookies from the
+// cookie file are added by the transport when they match the request URL, see
+// cookieTransport.
+func addCookies(req *http.Request, cfg *config.Config) {
+	if cfg.Cookie != "" {
+		req.Header.Add("Cookie", cfg.Cookie)
+	}
+}
+
+// addUserCredentials uses the credentials from --user for Basic
+// authentication unless the Authorization header was specified explicitly or
+// the credentials are used by another scheme, see basicAuth.
+func addUserCredentials(req *http.Request, cfg *config.Config) {
+	if cfg.User == nil || !basicAuth(cfg) || req.Header.Get("Authorization") != "" {
+		return
+	}
+
+	password, _ := cfg.User.Password()
+	req.SetBasicAuth(cfg.User.Username(), password)
+}
+
+// basicAuth returns true if the credentials are sent using Basic
+// authentication, i.e. they are not used by --digest, --ntlm or --aws-sigv4.
+func basicAuth(cfg *config.Config) (ok bool) {
+	return cfg.AuthScheme == "" && cfg.AWSSigV4 == nil
+}
+
+// addURLCredentials strips the user:password@ part from the request URL so
+// that it is never sent to the server and uses it for Basic authentication
+// unless the Authorization header was specified explicitly or the credentials
+// are used by another scheme, see basicAuth.
+func addURLCredentials(req *http.Request, cfg *config.Config) {
+	u := req.URL.User
+	if u == nil {
+		return
+	}
+
+	req.URL.User = nil
+
+	if !basicAuth(cfg) || req.Header.Get("Authorization") != "" {
+		return
+	}
+
+	password, _ := u.Password()
+	req.SetBasicAuth(u.Username(), password)
+}
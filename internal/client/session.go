@@ -0,0 +1,80 @@
+package client
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/ameshkov/gocurl/internal/output"
+	"github.com/ameshkov/gocurl/internal/session"
+)
+
+// sessionTransport is a Transport that sends the cookies of the session,
+// saves the received cookies and Alt-Svc entries, and then saves the session
+// file, see --session.
+type sessionTransport struct {
+	Transport
+
+	s   *session.Session
+	jar http.CookieJar
+	out *output.Output
+}
+
+// type check
+var _ Transport = (*sessionTransport)(nil)
+
+// newSessionTransport wraps base with the session s.
+func newSessionTransport(base Transport, s *session.Session, out *output.Output) (t *sessionTransport) {
+	return &sessionTransport{
+		Transport: base,
+		s:         s,
+		jar:       s.Jar(),
+		out:       out,
+	}
+}
+
+// RoundTrip implements the http.RoundTripper interface for *sessionTransport.
+func (t *sessionTransport) RoundTrip(r *http.Request) (resp *http.Response, err error) {
+	for _, c := range t.jar.Cookies(r.URL) {
+		r.AddCookie(c)
+	}
+
+	resp, err = t.Transport.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+
+	t.jar.SetCookies(r.URL, resp.Cookies())
+	t.s.SetAltSvc(resp)
+
+	// TLS 1.3 session tickets may arrive after the response header so the
+	// session is saved once the body is closed.
+	resp.Body = &savingBody{
+		ReadCloser: resp.Body,
+		t:          t,
+	}
+
+	return resp, nil
+}
+
+// save saves the session file, errors are logged.
+func (t *sessionTransport) save() {
+	err := t.s.Save()
+	if err != nil {
+		t.out.Info("Failed to save the session: %v", err)
+	}
+}
+
+// savingBody is the response body that saves the session when closed.
+type savingBody struct {
+	io.ReadCloser
+
+	t *sessionTransport
+}
+
+// Close implements the io.Closer interface for *savingBody.
+func (b *savingBody) Close() (err error) {
+	err = b.ReadCloser.Close()
+	b.t.save()
+
+	return err
+}
@@ -0,0 +1,95 @@
+package client
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ameshkov/gocurl/internal/client/httpsig"
+	"github.com/ameshkov/gocurl/internal/config"
+)
+
+// signRequest adds the HMAC signature of req to the configured header, see
+// --sign.  The signed string consists of cfg.SignFields joined with newlines.
+// For --sign-format rfc9421 req is signed with HTTP Message Signatures
+// instead.
+func signRequest(req *http.Request, cfg *config.Config, body []byte) (err error) {
+	if cfg.SignAlgorithm == "" {
+		return nil
+	}
+
+	if cfg.SignFormat == config.SignFormatRFC9421 {
+		return signHTTPMessage(req, cfg, body)
+	}
+
+	parts := make([]string, 0, len(cfg.SignFields))
+	for _, f := range cfg.SignFields {
+		parts = append(parts, signField(req, f, body))
+	}
+
+	newHash := sha256.New
+	if cfg.SignAlgorithm == "hmac-sha512" {
+		newHash = sha512.New
+	}
+
+	mac := hmac.New(newHash, []byte(cfg.SignKey))
+	_, _ = mac.Write([]byte(strings.Join(parts, "\n")))
+
+	req.Header.Set(cfg.SignHeader, hex.EncodeToString(mac.Sum(nil)))
+
+	return nil
+}
+
+// signHTTPMessage adds the Signature-Input and Signature headers to req, see
+// RFC 9421.  The covered components are cfg.SignFields.
+func signHTTPMessage(req *http.Request, cfg *config.Config, body []byte) (err error) {
+	var key any = cfg.SignPrivateKey
+	if cfg.SignPrivateKey == nil {
+		key = []byte(cfg.SignKey)
+	}
+
+	err = httpsig.Sign(req, body, &httpsig.Params{
+		Created:    time.Now(),
+		Key:        key,
+		Algorithm:  cfg.SignAlgorithm,
+		KeyID:      cfg.SignKeyID,
+		Label:      cfg.SignHeader,
+		Components: cfg.SignFields,
+	})
+	if err != nil {
+		return fmt.Errorf("sign: %w", err)
+	}
+
+	return nil
+}
+
+// signField returns the value of the signed field f of req with body.
+func signField(req *http.Request, f string, body []byte) (v string) {
+	switch f {
+	case "method":
+		return req.Method
+	case "path":
+		return req.URL.RequestURI()
+	case "host":
+		return req.Host
+	case "date":
+		// The server needs the date to verify the signature.
+		if req.Header.Get("Date") == "" {
+			req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+		}
+
+		return strings.TrimSpace(req.Header.Get("Date"))
+	case "body-sha256":
+		sum := sha256.Sum256(body)
+
+		return hex.EncodeToString(sum[:])
+	default:
+		// The values are trimmed when they are sent.
+		return strings.TrimSpace(req.Header.Get(strings.TrimPrefix(f, "header:")))
+	}
+}
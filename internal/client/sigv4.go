@@ -0,0 +1,190 @@
+package client
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ameshkov/gocurl/internal/config"
+)
+
+// sigV4TimeFormat is the format of the request timestamp.
+const sigV4TimeFormat = "20060102T150405Z"
+
+// signAWSv4 signs req with body using AWS Signature Version 4, see
+// --aws-sigv4.  The timestamp is taken from the X-<Provider2>-Date header if
+// it's already set.  Like in curl, the request is not signed if the
+// Authorization header is specified explicitly.
+func signAWSv4(req *http.Request, cfg *config.Config, body []byte) (err error) {
+	s := cfg.AWSSigV4
+	if s == nil || req.Header.Get("Authorization") != "" {
+		return nil
+	}
+
+	region, service := s.Region, s.Service
+	if region == "" || service == "" {
+		// Like curl, take them from service.region.amazonaws.com.
+		labels := strings.Split(req.URL.Hostname(), ".")
+		if len(labels) < 3 {
+			return fmt.Errorf("aws-sigv4: cannot get region and service from host %q", req.URL.Hostname())
+		}
+
+		service = valueOr(service, labels[0])
+		region = valueOr(region, labels[1])
+	}
+
+	p1Upper := strings.ToUpper(s.Provider1)
+	dateHeader := "X-" + strings.ToUpper(s.Provider2[:1]) + s.Provider2[1:] + "-Date"
+
+	date := strings.TrimSpace(req.Header.Get(dateHeader))
+	if date == "" {
+		date = time.Now().UTC().Format(sigV4TimeFormat)
+		req.Header.Set(dateHeader, date)
+	}
+
+	payloadHash := sha256Hex(body)
+	if service == "s3" {
+		req.Header.Set("X-"+s.Provider2+"-Content-Sha256", payloadHash)
+	}
+
+	headers, signedHeaders := canonicalHeaders(req)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalURI(req.URL),
+		canonicalQuery(req.URL),
+		headers,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	algorithm := p1Upper + "4-HMAC-SHA256"
+	terminator := s.Provider1 + "4_request"
+	day := date[:min(len(date), 8)]
+	scope := strings.Join([]string{day, region, service, terminator}, "/")
+	stringToSign := strings.Join([]string{algorithm, date, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	secret, _ := cfg.User.Password()
+	key := []byte(p1Upper + "4" + secret)
+	for _, part := range []string{day, region, service, terminator} {
+		key = hmacSHA256(key, part)
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		algorithm,
+		cfg.User.Username(),
+		scope,
+		signedHeaders,
+		hex.EncodeToString(hmacSHA256(key, stringToSign)),
+	))
+
+	return nil
+}
+
+// canonicalHeaders returns the canonical headers of req and the list of their
+// names.  All headers except User-Agent and Authorization are signed.
+func canonicalHeaders(req *http.Request) (headers, signedHeaders string) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	values := map[string]string{"host": host}
+	for name, vals := range req.Header {
+		name = strings.ToLower(name)
+		if name == "user-agent" || name == "authorization" || name == "host" {
+			continue
+		}
+
+		trimmed := make([]string, 0, len(vals))
+		for _, v := range vals {
+			trimmed = append(trimmed, strings.Join(strings.Fields(v), " "))
+		}
+
+		values[name] = strings.Join(trimmed, ",")
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	b := &strings.Builder{}
+	for _, name := range names {
+		_, _ = fmt.Fprintf(b, "%s:%s\n", name, values[name])
+	}
+
+	return b.String(), strings.Join(names, ";")
+}
+
+// canonicalURI returns the escaped path of u.
+func canonicalURI(u *url.URL) (uri string) {
+	if uri = u.EscapedPath(); uri == "" {
+		return "/"
+	}
+
+	return uri
+}
+
+// canonicalQuery returns the query of u with the parameters sorted by name and
+// value and escaped as required by AWS.
+func canonicalQuery(u *url.URL) (query string) {
+	var params [][2]string
+	for name, vals := range u.Query() {
+		for _, v := range vals {
+			params = append(params, [2]string{awsEscape(name), awsEscape(v)})
+		}
+	}
+
+	slices.SortFunc(params, func(a, b [2]string) (res int) {
+		if res = strings.Compare(a[0], b[0]); res != 0 {
+			return res
+		}
+
+		return strings.Compare(a[1], b[1])
+	})
+
+	pairs := make([]string, 0, len(params))
+	for _, p := range params {
+		pairs = append(pairs, p[0]+"="+p[1])
+	}
+
+	return strings.Join(pairs, "&")
+}
+
+// awsEscape escapes everything except the unreserved characters of RFC 3986.
+func awsEscape(s string) (escaped string) {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+// sha256Hex returns the hex-encoded SHA-256 of b.
+func sha256Hex(b []byte) (s string) {
+	sum := sha256.Sum256(b)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data with key.
+func hmacSHA256(key []byte, data string) (sum []byte) {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write([]byte(data))
+
+	return mac.Sum(nil)
+}
+
+// valueOr returns v if it's not empty and def otherwise.
+func valueOr(v, def string) (res string) {
+	if v != "" {
+		return v
+	}
+
+	return def
+}
@@ -0,0 +1,174 @@
+package splittls
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/ameshkov/gocurl/internal/client/dialer"
+	"github.com/ameshkov/gocurl/internal/output"
+)
+
+// CreateFakeHelloDialFunc creates a dialFunc that sends a decoy ClientHello
+// with the server name fakeSNI before the real one.  The decoy is sent with
+// the specified TTL (hop limit for IPv6) so that it's seen by DPI systems
+// along the way, but doesn't reach the server.
+//
+// The decoy occupies the same TCP sequence numbers as the beginning of the
+// real ClientHello, and when the packet is retransmitted it carries the real
+// data.  This is only supported on Linux.
+func CreateFakeHelloDialFunc(
+	fakeSNI string,
+	ttl int,
+	baseDial dialer.DialFunc,
+	out *output.Output,
+) (f dialer.DialFunc, err error) {
+	if !fakeHelloSupported {
+		return nil, errors.New("fake ClientHello is not supported on this platform")
+	}
+
+	fakeHello, err := clientHello(fakeSNI)
+	if err != nil {
+		return nil, fmt.Errorf("generating fake ClientHello: %w", err)
+	}
+
+	out.Debug("Sending fake ClientHello is enabled. Fake SNI is %s, TTL is %d", fakeSNI, ttl)
+
+	return func(network, addr string) (conn net.Conn, err error) {
+		conn, err = baseDial(network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		return &fakeHelloConn{
+			Conn:      conn,
+			fakeHello: fakeHello,
+			ttl:       ttl,
+			out:       out,
+		}, nil
+	}, nil
+}
+
+// CreateFakeSegmentDialFunc creates a dialFunc that sends a segment with random
+// data before the real ClientHello.  Like with CreateFakeHelloDialFunc, the
+// segment is sent with the specified TTL so that it doesn't reach the server.
+// This is only supported on Linux.
+func CreateFakeSegmentDialFunc(
+	ttl int,
+	baseDial dialer.DialFunc,
+	out *output.Output,
+) (f dialer.DialFunc, err error) {
+	if !fakeHelloSupported {
+		return nil, errors.New("fake segment is not supported on this platform")
+	}
+
+	out.Debug("Sending fake segment is enabled. TTL is %d", ttl)
+
+	return func(network, addr string) (conn net.Conn, err error) {
+		conn, err = baseDial(network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		return &fakeHelloConn{
+			Conn: conn,
+			ttl:  ttl,
+			out:  out,
+		}, nil
+	}, nil
+}
+
+// fakeHelloConn is the implementation of net.Conn which only purpose is to
+// wait for the ClientHello packet and send a decoy before it.
+type fakeHelloConn struct {
+	net.Conn
+
+	// out is required for debug-level logging.
+	out *output.Output
+
+	// fakeHello is the TLS record with the decoy ClientHello.  If nil, random
+	// data is used as the decoy.
+	fakeHello []byte
+
+	// ttl is the TTL of the packet with the decoy.
+	ttl int
+
+	// writeCnt is the number of Write calls.
+	writeCnt int
+
+	// fakeDone is set to true when the decoy has been sent.
+	fakeDone bool
+}
+
+// type check
+var _ dialer.WrappedConn = (*fakeHelloConn)(nil)
+
+// Unwrap implements the dialer.WrappedConn interface for *fakeHelloConn.
+func (c *fakeHelloConn) Unwrap() (conn net.Conn) {
+	return c.Conn
+}
+
+// Write implements net.Conn for *fakeHelloConn.  Its purpose is to wait until
+// the first TLS packet (ClientHello) and send the decoy in place of its
+// beginning.
+func (c *fakeHelloConn) Write(b []byte) (n int, err error) {
+	c.writeCnt++
+
+	// See splitTLSConn.splitDone for why it's 5.
+	if c.fakeDone || c.writeCnt > 5 || !isClientHelloRecord(b) {
+		return c.Conn.Write(b)
+	}
+
+	c.fakeDone = true
+
+	fake := c.fakeHello
+	if fake == nil {
+		fake = make([]byte, len(b))
+		_, _ = rand.Read(fake)
+	}
+
+	// The decoy cannot be longer than the real data it's replaced with.
+	l := min(len(fake), len(b))
+	c.out.Debug("Found ClientHello, sending %d bytes of fake data first", l)
+
+	err = sendFake(c.Conn, fake[:l], b[:l], c.ttl)
+	if err != nil {
+		return 0, fmt.Errorf("sending fake data: %w", err)
+	}
+
+	n, err = c.Conn.Write(b[l:])
+
+	return n + l, err
+}
+
+// errCaptured is returned by captureConn to stop the handshake after
+// ClientHello has been captured.
+var errCaptured = errors.New("captured")
+
+// captureConn is a net.Conn that captures the first written packet and fails
+// afterward.
+type captureConn struct {
+	net.Conn
+
+	b []byte
+}
+
+// Write implements net.Conn for *captureConn.
+func (c *captureConn) Write(b []byte) (n int, err error) {
+	c.b = append([]byte{}, b...)
+
+	return 0, errCaptured
+}
+
+// clientHello returns the TLS record with ClientHello for serverName.
+func clientHello(serverName string) (b []byte, err error) {
+	c := &captureConn{}
+	err = tls.Client(c, &tls.Config{ServerName: serverName}).Handshake()
+	if !errors.Is(err, errCaptured) {
+		return nil, fmt.Errorf("unexpected handshake result: %w", err)
+	}
+
+	return c.b, nil
+}
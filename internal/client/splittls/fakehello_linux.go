@@ -0,0 +1,112 @@
+//go:build linux
+
+package splittls
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/ameshkov/gocurl/internal/client/dialer"
+	"golang.org/x/sys/unix"
+)
+
+// fakeHelloSupported is true since Linux supports all the required syscalls.
+const fakeHelloSupported = true
+
+// fakeSendDelay is the time to wait after the decoy is passed to the kernel
+// and before it's replaced with the real data.
+const fakeSendDelay = 50 * time.Millisecond
+
+// sendFake sends fake with the specified ttl over conn so that the TCP
+// retransmission of the packet carries data instead.  fake and data must have
+// the same length.
+//
+// The decoy is written to an anonymous memory page which is gifted to the
+// kernel with vmsplice and then spliced to the socket, i.e. the socket buffer
+// refers the page itself and not a copy.  Once the decoy is sent, the page
+// content is replaced with the real data and the original TTL is restored so
+// when the decoy is lost, the retransmitted packet contains the real data.
+//
+// conn may wrap the TCP connection, see dialer.WrappedConn.  The decoy is
+// written to the TCP connection directly.
+func sendFake(conn net.Conn, fake, data []byte, ttl int) (err error) {
+	tcpConn, ok := dialer.TCPConn(conn)
+	if !ok {
+		return fmt.Errorf("%T is not a TCP connection", conn)
+	}
+
+	rc, err := tcpConn.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	level, opt := unix.IPPROTO_IP, unix.IP_TTL
+	if addr, isTCP := tcpConn.RemoteAddr().(*net.TCPAddr); isTCP && addr.IP.To4() == nil {
+		level, opt = unix.IPPROTO_IPV6, unix.IPV6_UNICAST_HOPS
+	}
+
+	mem, err := unix.Mmap(-1, 0, len(fake), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_PRIVATE|unix.MAP_ANONYMOUS)
+	if err != nil {
+		return fmt.Errorf("mmap: %w", err)
+	}
+	defer func() { err = errors.Join(err, unix.Munmap(mem)) }()
+
+	copy(mem, fake)
+
+	var p [2]int
+	err = unix.Pipe2(p[:], unix.O_CLOEXEC)
+	if err != nil {
+		return fmt.Errorf("pipe: %w", err)
+	}
+	defer func() { _, _ = unix.Close(p[0]), unix.Close(p[1]) }()
+
+	iov := []unix.Iovec{{Base: &mem[0]}}
+	iov[0].SetLen(len(mem))
+	_, err = unix.Vmsplice(p[1], iov, unix.SPLICE_F_GIFT)
+	if err != nil {
+		return fmt.Errorf("vmsplice: %w", err)
+	}
+
+	var origTTL int
+	var sysErr error
+	err = rc.Control(func(fd uintptr) {
+		origTTL, sysErr = unix.GetsockoptInt(int(fd), level, opt)
+		if sysErr == nil {
+			sysErr = unix.SetsockoptInt(int(fd), level, opt, ttl)
+		}
+	})
+	if err = errors.Join(err, sysErr); err != nil {
+		return fmt.Errorf("setting ttl: %w", err)
+	}
+
+	sent := 0
+	err = rc.Write(func(fd uintptr) (done bool) {
+		// The type of n is int64 or int depending on the architecture.
+		n, spliceErr := unix.Splice(p[0], nil, int(fd), nil, len(fake)-sent, 0)
+		if errors.Is(spliceErr, unix.EAGAIN) {
+			return false
+		}
+
+		sysErr = spliceErr
+		sent += int(n)
+
+		return sysErr != nil || sent == len(fake)
+	})
+	if err = errors.Join(err, sysErr); err != nil {
+		return fmt.Errorf("splice: %w", err)
+	}
+
+	time.Sleep(fakeSendDelay)
+	copy(mem, data)
+
+	err = rc.Control(func(fd uintptr) {
+		sysErr = unix.SetsockoptInt(int(fd), level, opt, origTTL)
+	})
+	if err = errors.Join(err, sysErr); err != nil {
+		return fmt.Errorf("restoring ttl: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,159 @@
+//go:build linux
+
+package splittls_test
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/ameshkov/gocurl/internal/client/jitter"
+	"github.com/ameshkov/gocurl/internal/client/splittls"
+	"github.com/ameshkov/gocurl/internal/output"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/ipv4"
+)
+
+func TestCreateFakeHelloDialFunc(t *testing.T) {
+	out, err := output.NewOutput("", false)
+	require.NoError(t, err)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = l.Close() })
+
+	received := make(chan []byte, 1)
+	go readClientHello(l, received)
+
+	var tcpConn net.Conn
+	baseDial := func(network, addr string) (conn net.Conn, err error) {
+		tcpConn, err = net.Dial(network, addr)
+
+		return tcpConn, err
+	}
+
+	// The TCP connection must be found under other wrappers.
+	dial, err := splittls.CreateFakeHelloDialFunc("fake.org", 8, jitter.CreateDialFunc(0, 0, baseDial, out), out)
+	require.NoError(t, err)
+
+	conn, err := dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	ttl, err := ipv4.NewConn(tcpConn).TTL()
+	require.NoError(t, err)
+
+	// The server closes the connection after ClientHello.
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: "www.real-example.org"})
+	require.Error(t, tlsConn.Handshake())
+
+	// Routers are not decrementing the TTL on the loopback interface so the
+	// decoy reaches the server.  It is a complete ClientHello record as it's
+	// shorter than the real one.
+	record, ok := <-received
+	require.True(t, ok)
+	require.Equal(t, byte(0x16), record[0])
+	require.Equal(t, byte(0x01), record[5])
+	require.Contains(t, string(record), "fake.org")
+	require.NotContains(t, string(record), "www.real-example.org")
+
+	// The TTL is restored after the decoy is sent.
+	restored, err := ipv4.NewConn(tcpConn).TTL()
+	require.NoError(t, err)
+	require.Equal(t, ttl, restored)
+}
+
+func TestCreateFakeSegmentDialFunc(t *testing.T) {
+	out, err := output.NewOutput("", false)
+	require.NoError(t, err)
+
+	// Capture a real ClientHello record.
+	client, server := net.Pipe()
+	t.Cleanup(func() { _ = client.Close() })
+	_ = server.Close()
+
+	rc := &recordingConn{Conn: client}
+	require.Error(t, tls.Client(rc, &tls.Config{ServerName: "example.org"}).Handshake())
+	require.NotEmpty(t, rc.writes)
+
+	hello := rc.writes[0]
+	const after = "after"
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = l.Close() })
+
+	received := make(chan []byte, 1)
+	go func() {
+		defer close(received)
+
+		conn, aErr := l.Accept()
+		if aErr != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+
+		b := make([]byte, len(hello)+len(after))
+		_, aErr = io.ReadFull(conn, b)
+		if aErr == nil {
+			received <- b
+		}
+	}()
+
+	var tcpConn net.Conn
+	baseDial := func(network, addr string) (conn net.Conn, err error) {
+		tcpConn, err = net.Dial(network, addr)
+
+		return tcpConn, err
+	}
+
+	dial, err := splittls.CreateFakeSegmentDialFunc(8, jitter.CreateDialFunc(0, 0, baseDial, out), out)
+	require.NoError(t, err)
+
+	conn, err := dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	ttl, err := ipv4.NewConn(tcpConn).TTL()
+	require.NoError(t, err)
+
+	n, err := conn.Write(hello)
+	require.NoError(t, err)
+	require.Equal(t, len(hello), n)
+
+	_, err = conn.Write([]byte(after))
+	require.NoError(t, err)
+
+	// The fake segment reaches the server on the loopback interface.  It
+	// takes the place of ClientHello, which is only left for the
+	// retransmission, and goes before the data written afterward.
+	b, ok := <-received
+	require.True(t, ok)
+	require.NotEqual(t, hello, b[:len(hello)])
+	require.Equal(t, after, string(b[len(hello):]))
+
+	restored, err := ipv4.NewConn(tcpConn).TTL()
+	require.NoError(t, err)
+	require.Equal(t, ttl, restored)
+}
+
+func TestCreateFakeHelloDialFunc_notTCP(t *testing.T) {
+	out, err := output.NewOutput("", false)
+	require.NoError(t, err)
+
+	client, server := net.Pipe()
+	t.Cleanup(func() { _ = client.Close() })
+	t.Cleanup(func() { _ = server.Close() })
+
+	dial, err := splittls.CreateFakeHelloDialFunc("fake.org", 8, func(_, _ string) (net.Conn, error) {
+		return client, nil
+	}, out)
+	require.NoError(t, err)
+
+	conn, err := dial("tcp", "example.org:443")
+	require.NoError(t, err)
+
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: "example.org"})
+	require.ErrorContains(t, tlsConn.Handshake(), "is not a TCP connection")
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package splittls
+
+import (
+	"errors"
+	"net"
+)
+
+// fakeHelloSupported is false since sending a fake ClientHello relies on
+// Linux-specific syscalls.
+const fakeHelloSupported = false
+
+// sendFake is not supported on this platform.
+func sendFake(_ net.Conn, _, _ []byte, _ int) (err error) {
+	return errors.New("not supported")
+}
@@ -0,0 +1,118 @@
+package splittls
+
+import (
+	"encoding/binary"
+	"net"
+
+	"github.com/ameshkov/gocurl/internal/client/dialer"
+	"github.com/ameshkov/gocurl/internal/output"
+)
+
+// recordHeaderLen is the length of the TLS record header: content type (1
+// byte), protocol version (2 bytes), and length (2 bytes).
+const recordHeaderLen = 5
+
+// CreateRecordSplitDialFunc creates a dialFunc that splits the TLS ClientHello
+// into several TLS records, each of them carries at most recordSize bytes of
+// the handshake message.  Unlike CreateDialFunc this changes the TLS framing
+// and not just the TCP segmentation so it may help with DPI systems that
+// reassemble TCP streams, but not TLS records.
+func CreateRecordSplitDialFunc(
+	recordSize int,
+	baseDial dialer.DialFunc,
+	out *output.Output,
+) (f dialer.DialFunc) {
+	out.Debug("Splitting TLS ClientHello into records is enabled. Record size is %d", recordSize)
+
+	return func(network, addr string) (conn net.Conn, err error) {
+		conn, err = baseDial(network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		return &recordSplitConn{
+			Conn:       conn,
+			recordSize: recordSize,
+			out:        out,
+		}, nil
+	}
+}
+
+// recordSplitConn is the implementation of net.Conn which only purpose is to
+// wait for the ClientHello record and split it into several records.
+type recordSplitConn struct {
+	net.Conn
+
+	// out is required for debug-level logging.
+	out *output.Output
+
+	// recordSize is the maximum size of the records payload.
+	recordSize int
+
+	// writeCnt is the number of Write calls.
+	writeCnt int
+
+	// splitDone is set to true when ClientHello has been split.
+	splitDone bool
+}
+
+// type check
+var _ dialer.WrappedConn = (*recordSplitConn)(nil)
+
+// Unwrap implements the dialer.WrappedConn interface for *recordSplitConn.
+func (c *recordSplitConn) Unwrap() (conn net.Conn) {
+	return c.Conn
+}
+
+// Write implements net.Conn for *recordSplitConn.  Its purpose is to wait
+// until the first TLS record (ClientHello) and then split it into several
+// records that are written at once.
+func (c *recordSplitConn) Write(b []byte) (n int, err error) {
+	c.writeCnt++
+
+	// See splitTLSConn.splitDone for why it's 5.
+	if c.splitDone || c.writeCnt > 5 || !isClientHelloRecord(b) {
+		return c.Conn.Write(b)
+	}
+
+	recordLen := int(binary.BigEndian.Uint16(b[3:recordHeaderLen]))
+	if len(b) < recordHeaderLen+recordLen {
+		// The record is incomplete, i.e. it was already split by someone
+		// else, don't touch it.
+		return c.Conn.Write(b)
+	}
+
+	c.splitDone = true
+
+	payload := b[recordHeaderLen : recordHeaderLen+recordLen]
+	rest := b[recordHeaderLen+recordLen:]
+
+	c.out.Debug(
+		"Found ClientHello, splitting it into %d records",
+		(recordLen+c.recordSize-1)/c.recordSize,
+	)
+
+	split := splitRecord(b[:3], payload, c.recordSize)
+
+	_, err = c.Conn.Write(append(split, rest...))
+	if err != nil {
+		return 0, err
+	}
+
+	return len(b), nil
+}
+
+// splitRecord returns a sequence of TLS records with the header hdr (content
+// type and version) that carry payload in chunks of at most size bytes.
+func splitRecord(hdr, payload []byte, size int) (b []byte) {
+	for len(payload) > 0 {
+		chunk := payload[:min(size, len(payload))]
+		payload = payload[len(chunk):]
+
+		b = append(b, hdr...)
+		b = binary.BigEndian.AppendUint16(b, uint16(len(chunk)))
+		b = append(b, chunk...)
+	}
+
+	return b
+}
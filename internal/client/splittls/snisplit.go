@@ -0,0 +1,193 @@
+package splittls
+
+import (
+	"encoding/binary"
+	"net"
+	"time"
+
+	"github.com/ameshkov/gocurl/internal/client/dialer"
+	"github.com/ameshkov/gocurl/internal/output"
+)
+
+// CreateSNISplitDialFunc creates a dialFunc that splits the TLS ClientHello
+// right inside the server name (SNI).  offsets are the split points relative to
+// the beginning of the server name, delay is the time in milliseconds to wait
+// before sending each next part.
+func CreateSNISplitDialFunc(
+	offsets []int,
+	delay int,
+	baseDial dialer.DialFunc,
+	out *output.Output,
+) (f dialer.DialFunc) {
+	out.Debug("Splitting TLS ClientHello at SNI is enabled. Offsets are %v, delay is %d", offsets, delay)
+
+	return func(network, addr string) (conn net.Conn, err error) {
+		conn, err = baseDial(network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		return &sniSplitConn{
+			Conn:    conn,
+			offsets: offsets,
+			delay:   delay,
+			out:     out,
+		}, nil
+	}
+}
+
+// sniSplitConn is the implementation of net.Conn which only purpose is to wait
+// for the ClientHello packet and split it inside the server name.
+type sniSplitConn struct {
+	net.Conn
+
+	// out is required for debug-level logging.
+	out *output.Output
+
+	// offsets are the split points relative to the server name start.
+	offsets []int
+
+	// delay is time to wait in milliseconds before sending the next part.
+	delay int
+
+	// writeCnt is the number of Write calls.
+	writeCnt int
+
+	// splitDone is set to true when ClientHello has been split.
+	splitDone bool
+}
+
+// type check
+var _ dialer.WrappedConn = (*sniSplitConn)(nil)
+
+// Unwrap implements the dialer.WrappedConn interface for *sniSplitConn.
+func (c *sniSplitConn) Unwrap() (conn net.Conn) {
+	return c.Conn
+}
+
+// Write implements net.Conn for *sniSplitConn.  Its purpose is to wait until
+// the first TLS packet (ClientHello) and then split it at the server name.
+func (c *sniSplitConn) Write(b []byte) (n int, err error) {
+	c.writeCnt++
+
+	// See splitTLSConn.splitDone for why it's 5.
+	if c.splitDone || c.writeCnt > 5 || !isClientHelloRecord(b) {
+		return c.Conn.Write(b)
+	}
+
+	c.splitDone = true
+
+	start, end, ok := findServerName(b)
+	if !ok {
+		c.out.Debug("Found ClientHello, but could not find the server name in it")
+
+		return c.Conn.Write(b)
+	}
+
+	c.out.Debug("Found ClientHello, splitting it at the server name %q", b[start:end])
+
+	var chunks [][]byte
+	prev := 0
+	for _, off := range c.offsets {
+		pos := start + off
+		if pos <= prev || pos >= end {
+			continue
+		}
+
+		chunks = append(chunks, b[prev:pos])
+		prev = pos
+	}
+	chunks = append(chunks, b[prev:])
+
+	for i, chunk := range chunks {
+		var l int
+		l, err = c.Conn.Write(chunk)
+		if err != nil {
+			return n, err
+		}
+
+		n = n + l
+
+		if c.delay > 0 && i < len(chunks)-1 {
+			time.Sleep(time.Duration(c.delay) * time.Millisecond)
+		}
+	}
+
+	return n, err
+}
+
+// findServerName looks for the server_name extension in the TLS record with
+// ClientHello and returns the position of the host name in b.  ok is false if
+// the record is malformed or there's no server name in it.
+func findServerName(b []byte) (start, end int, ok bool) {
+	p := &parser{b: b, ok: true}
+
+	// Skip the record header, the handshake header, the version and the
+	// random.
+	p.skip(recordHeaderLen + 4 + 2 + 32)
+
+	// Skip the session ID, cipher suites, and compression methods.
+	p.skip(p.readLen(1))
+	p.skip(p.readLen(2))
+	p.skip(p.readLen(1))
+
+	extEnd := p.readLen(2) + p.pos
+	for p.ok && p.pos < extEnd {
+		extType := p.readLen(2)
+		extLen := p.readLen(2)
+		if extType != 0 {
+			p.skip(extLen)
+
+			continue
+		}
+
+		// server_name extension: the list length, the name type (0 is
+		// host_name), and the name length.
+		p.skip(2)
+		if nameType := p.readLen(1); nameType != 0 {
+			return 0, 0, false
+		}
+
+		nameLen := p.readLen(2)
+		start = p.pos
+		p.skip(nameLen)
+
+		return start, p.pos, p.ok
+	}
+
+	return 0, 0, false
+}
+
+// parser is a helper for reading TLS structures.  Once an out of bounds read
+// happens, ok is set to false and all further reads return zeros.
+type parser struct {
+	b   []byte
+	pos int
+	ok  bool
+}
+
+// skip skips n bytes.
+func (p *parser) skip(n int) {
+	if !p.ok || p.pos+n > len(p.b) {
+		p.ok = false
+
+		return
+	}
+
+	p.pos += n
+}
+
+// readLen reads a big-endian integer of the specified size (1 or 2 bytes).
+func (p *parser) readLen(size int) (l int) {
+	pos := p.pos
+	p.skip(size)
+	if !p.ok {
+		return 0
+	}
+
+	if size == 1 {
+		return int(p.b[pos])
+	}
+
+	return int(binary.BigEndian.Uint16(p.b[pos:]))
+}
@@ -0,0 +1,53 @@
+package splittls_test
+
+import (
+	"crypto/tls"
+	"net"
+	"testing"
+
+	"github.com/ameshkov/gocurl/internal/client/splittls"
+	"github.com/ameshkov/gocurl/internal/output"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingConn is a net.Conn that records everything written to it.
+type recordingConn struct {
+	net.Conn
+
+	writes [][]byte
+}
+
+// Write implements net.Conn for *recordingConn.
+func (c *recordingConn) Write(b []byte) (n int, err error) {
+	c.writes = append(c.writes, append([]byte{}, b...))
+
+	return len(b), nil
+}
+
+func TestCreateSNISplitDialFunc(t *testing.T) {
+	out, err := output.NewOutput("", false)
+	require.NoError(t, err)
+
+	client, server := net.Pipe()
+	t.Cleanup(func() { _ = client.Close() })
+
+	// Close the server side so that the handshake fails right after
+	// ClientHello is sent.
+	_ = server.Close()
+
+	rc := &recordingConn{Conn: client}
+	dial := splittls.CreateSNISplitDialFunc([]int{1, 4}, 0, func(_, _ string) (net.Conn, error) {
+		return rc, nil
+	}, out)
+
+	conn, err := dial("tcp", "example.org:443")
+	require.NoError(t, err)
+
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: "example.org"})
+	require.Error(t, tlsConn.Handshake())
+
+	require.Len(t, rc.writes, 3)
+	require.Equal(t, byte('e'), rc.writes[0][len(rc.writes[0])-1])
+	require.Equal(t, "xam", string(rc.writes[1]))
+	require.Equal(t, "ple.org", string(rc.writes[2][:7]))
+}
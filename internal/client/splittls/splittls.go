@@ -3,6 +3,7 @@
 package splittls
 
 import (
+	"fmt"
 	"net"
 	"time"
 
@@ -11,17 +12,20 @@ import (
 )
 
 // CreateDialFunc creates a dialFunc that splits the TLS ClientHello in two
-// parts.
+// parts.  If disorder is true, the second part is delivered to the server
+// before the first one.
 func CreateDialFunc(
 	firstChunkSize int,
 	delay int,
+	disorder bool,
 	baseDial dialer.DialFunc,
 	out *output.Output,
 ) (f dialer.DialFunc) {
 	out.Debug(
-		"Splitting TLS ClientHello is enabled. First chunk size is %d, delay is %d",
+		"Splitting TLS ClientHello is enabled. First chunk size is %d, delay is %d, disorder is %t",
 		firstChunkSize,
 		delay,
+		disorder,
 	)
 
 	return func(network, addr string) (conn net.Conn, err error) {
@@ -35,6 +39,7 @@ func CreateDialFunc(
 			baseConn:       conn,
 			firstChunkSize: firstChunkSize,
 			delay:          delay,
+			disorder:       disorder,
 			out:            out,
 		}, nil
 	}
@@ -54,6 +59,11 @@ type splitTLSConn struct {
 	// delay is time to wait in milliseconds before sending the second part.
 	delay int
 
+	// disorder makes the first chunk to be sent with TTL 1 so that it's
+	// dropped on the way and the server receives it only after the second one
+	// when the first chunk is retransmitted.
+	disorder bool
+
 	// out is required for debug-level logging.
 	out *output.Output
 
@@ -68,11 +78,26 @@ type splitTLSConn struct {
 }
 
 // type check
-var _ net.Conn = (*splitTLSConn)(nil)
+var _ dialer.WrappedConn = (*splitTLSConn)(nil)
+
+// Unwrap implements the dialer.WrappedConn interface for *splitTLSConn.
+func (c *splitTLSConn) Unwrap() (conn net.Conn) {
+	return c.baseConn
+}
 
 // isClientHello checks if the packet is ClientHello.
 func (c *splitTLSConn) isClientHello(b []byte) (ok bool) {
-	if c.writeCnt > 5 || c.splitDone || len(b) < 6 {
+	if c.writeCnt > 5 || c.splitDone {
+		return false
+	}
+
+	return isClientHelloRecord(b)
+}
+
+// isClientHelloRecord checks if b starts with a TLS record that contains
+// ClientHello.
+func isClientHelloRecord(b []byte) (ok bool) {
+	if len(b) < 6 {
 		return false
 	}
 
@@ -109,7 +134,11 @@ func (c *splitTLSConn) Write(b []byte) (n int, err error) {
 
 		for i, chunk := range chunks {
 			var l int
-			l, err = c.baseConn.Write(chunk)
+			if c.disorder && i == 0 {
+				l, err = c.writeDropped(chunk)
+			} else {
+				l, err = c.baseConn.Write(chunk)
+			}
 			if err != nil {
 				return n, err
 			}
@@ -126,3 +155,27 @@ func (c *splitTLSConn) Write(b []byte) (n int, err error) {
 
 	return c.baseConn.Write(b)
 }
+
+// disorderTTL is the TTL of the packet that must not reach the server.
+const disorderTTL = 1
+
+// writeDropped writes b with TTL set to disorderTTL so that the packet is
+// dropped, and the kernel has to retransmit it later.
+func (c *splitTLSConn) writeDropped(b []byte) (n int, err error) {
+	prevTTL, err := setTTL(c.baseConn, disorderTTL)
+	if err != nil {
+		return 0, fmt.Errorf("setting ttl: %w", err)
+	}
+
+	n, err = c.baseConn.Write(b)
+	if err != nil {
+		return n, err
+	}
+
+	_, err = setTTL(c.baseConn, prevTTL)
+	if err != nil {
+		return n, fmt.Errorf("restoring ttl: %w", err)
+	}
+
+	return n, nil
+}
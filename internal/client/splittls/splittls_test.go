@@ -0,0 +1,134 @@
+package splittls_test
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/ameshkov/gocurl/internal/client/jitter"
+	"github.com/ameshkov/gocurl/internal/client/splittls"
+	"github.com/ameshkov/gocurl/internal/output"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/ipv4"
+)
+
+func TestCreateDialFunc(t *testing.T) {
+	out, err := output.NewOutput("", false)
+	require.NoError(t, err)
+
+	client, server := net.Pipe()
+	t.Cleanup(func() { _ = client.Close() })
+	_ = server.Close()
+
+	rc := &recordingConn{Conn: client}
+	dial := splittls.CreateDialFunc(10, 0, false, func(_, _ string) (net.Conn, error) {
+		return rc, nil
+	}, out)
+
+	conn, err := dial("tcp", "example.org:443")
+	require.NoError(t, err)
+
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: "example.org"})
+	require.Error(t, tlsConn.Handshake())
+
+	require.Len(t, rc.writes, 2)
+	require.Len(t, rc.writes[0], 10)
+	require.Equal(t, byte(0x16), rc.writes[0][0])
+}
+
+// readClientHello reads the TLS record with ClientHello from the first
+// connection accepted by l and sends it to ch.
+func readClientHello(l net.Listener, ch chan<- []byte) {
+	conn, err := l.Accept()
+	if err != nil {
+		close(ch)
+
+		return
+	}
+	defer func() { _ = conn.Close() }()
+
+	header := make([]byte, 5)
+	_, err = io.ReadFull(conn, header)
+	if err != nil {
+		close(ch)
+
+		return
+	}
+
+	record := make([]byte, 5+int(binary.BigEndian.Uint16(header[3:])))
+	copy(record, header)
+	_, err = io.ReadFull(conn, record[5:])
+	if err != nil {
+		close(ch)
+
+		return
+	}
+
+	ch <- record
+}
+
+func TestCreateDialFunc_disorder(t *testing.T) {
+	out, err := output.NewOutput("", false)
+	require.NoError(t, err)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = l.Close() })
+
+	received := make(chan []byte, 1)
+	go readClientHello(l, received)
+
+	var tcpConn net.Conn
+	baseDial := func(network, addr string) (conn net.Conn, err error) {
+		tcpConn, err = net.Dial(network, addr)
+
+		return tcpConn, err
+	}
+
+	// The TCP connection must be found under other wrappers.
+	dial := splittls.CreateDialFunc(10, 0, true, jitter.CreateDialFunc(0, 0, baseDial, out), out)
+
+	conn, err := dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	ttl, err := ipv4.NewConn(tcpConn).TTL()
+	require.NoError(t, err)
+
+	// The server closes the connection after ClientHello.
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: "example.org"})
+	require.Error(t, tlsConn.Handshake())
+
+	// The dropped part is retransmitted, so the server receives the whole
+	// ClientHello.
+	record, ok := <-received
+	require.True(t, ok)
+	require.Equal(t, byte(0x16), record[0])
+	require.Equal(t, byte(0x01), record[5])
+
+	// The TTL is restored after the first part is sent.
+	restored, err := ipv4.NewConn(tcpConn).TTL()
+	require.NoError(t, err)
+	require.Equal(t, ttl, restored)
+}
+
+func TestCreateDialFunc_disorderNotTCP(t *testing.T) {
+	out, err := output.NewOutput("", false)
+	require.NoError(t, err)
+
+	client, server := net.Pipe()
+	t.Cleanup(func() { _ = client.Close() })
+	t.Cleanup(func() { _ = server.Close() })
+
+	dial := splittls.CreateDialFunc(10, 0, true, func(_, _ string) (net.Conn, error) {
+		return client, nil
+	}, out)
+
+	conn, err := dial("tcp", "example.org:443")
+	require.NoError(t, err)
+
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: "example.org"})
+	require.ErrorContains(t, tlsConn.Handshake(), "is not a TCP connection")
+}
@@ -0,0 +1,40 @@
+package splittls
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/ameshkov/gocurl/internal/client/dialer"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// setTTL sets the TTL (or the hop limit for IPv6) of the packets sent over the
+// TCP connection conn and returns the previous value.  conn may wrap the TCP
+// connection, see dialer.WrappedConn.
+func setTTL(conn net.Conn, ttl int) (prev int, err error) {
+	tcpConn, ok := dialer.TCPConn(conn)
+	if !ok {
+		return 0, fmt.Errorf("%T is not a TCP connection", conn)
+	}
+
+	conn = tcpConn
+
+	if addr, ok := conn.RemoteAddr().(*net.TCPAddr); ok && addr.IP.To4() == nil {
+		c := ipv6.NewConn(conn)
+		prev, err = c.HopLimit()
+		if err != nil {
+			return 0, err
+		}
+
+		return prev, c.SetHopLimit(ttl)
+	}
+
+	c := ipv4.NewConn(conn)
+	prev, err = c.TTL()
+	if err != nil {
+		return 0, err
+	}
+
+	return prev, c.SetTTL(ttl)
+}
@@ -3,37 +3,87 @@ package client
 
 import (
 	"context"
-	"crypto/tls"
+	"errors"
+	"fmt"
+	"math"
 	"net"
 	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/ameshkov/gocurl/internal/client/proxy"
 	"github.com/ameshkov/gocurl/internal/config"
 	"github.com/ameshkov/gocurl/internal/output"
+	"github.com/ameshkov/gocurl/internal/session"
+	"github.com/quic-go/quic-go"
 	"github.com/quic-go/quic-go/http3"
 	"golang.org/x/net/http2"
 )
 
 // Transport is the interface that's used for sending/receiving HTTP requests.
+// Connections are kept alive and reused by the subsequent requests to the same
+// origin.  The connection that was used by a request is attached to its
+// response, see ResponseConn.
 type Transport interface {
 	http.RoundTripper
-
-	// Conn returns the last established connection using this transport.
-	Conn() (conn net.Conn)
 }
 
 // transport is a wrapper over regular http.RoundTripper that is used to add
 // additional logic on top of RoundTrip.
 type transport struct {
 	d    *clientDialer
+	out  *output.Output
 	base http.RoundTripper
+
+	// file is used for file:// URLs, they don't require any connection.
+	file http.RoundTripper
 }
 
 // type check
 var _ Transport = (*transport)(nil)
 
-// Conn returns the last established connection using this transport.
-func (t *transport) Conn() (conn net.Conn) {
-	return t.d.conn
+// connKey is the context key for the connection that was used by the
+// request.
+type connKey struct{}
+
+// ResponseConn returns the connection that was used to receive resp.  It is
+// nil if the connection is not known, e.g. for HTTP/3, cached, and file://
+// responses.  Several requests may run in parallel over the same transport, so
+// the connection is attached to every response instead of being kept in the
+// transport.
+func ResponseConn(resp *http.Response) (conn net.Conn) {
+	if resp == nil || resp.Request == nil {
+		return nil
+	}
+
+	conn, _ = resp.Request.Context().Value(connKey{}).(net.Conn)
+
+	return conn
+}
+
+// ErrHeaderTooLarge is returned when the response header is larger than
+// allowed by --max-header-size.
+var ErrHeaderTooLarge = errors.New("response header exceeds max-header-size")
+
+// isHeaderTooLarge returns true if err is caused by the response header size
+// limit of any of the underlying transports.  They don't have exported errors
+// for this so the error messages are checked.
+func isHeaderTooLarge(err error) (ok bool) {
+	// HTTP/2 HPACK decoder rejects a single header field that is larger than
+	// the limit with COMPRESSION_ERROR.
+	var connErr http2.ConnectionError
+	if errors.As(err, &connErr) && http2.ErrCode(connErr) == http2.ErrCodeCompression {
+		return true
+	}
+
+	msg := err.Error()
+
+	return strings.Contains(msg, "server response headers exceeded") ||
+		strings.Contains(msg, "header list larger than advertised limit") ||
+		strings.Contains(msg, "HEADERS frame too large")
 }
 
 // RoundTrip implements the http.RoundTripper interface for *transport.
@@ -41,39 +91,296 @@ func (t *transport) Conn() (conn net.Conn) {
 // TODO(ameshkov): dial explicitly here and then check negotiation proto.
 // This approach will make it easier to handle protocols negotiation.
 func (t *transport) RoundTrip(r *http.Request) (resp *http.Response, err error) {
+	if r.URL.Scheme == "file" {
+		return t.roundTripFile(r)
+	}
+
+	// Track the connection that is actually used by the request as it can be
+	// an existing connection and not the last dialed one.  It is only written
+	// by the goroutine of RoundTrip.
+	var conn net.Conn
+	var recorder headerRecorder
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				t.out.Debug("Re-using existing connection to %s", info.Conn.RemoteAddr())
+			}
+
+			if rec, ok := info.Conn.(headerRecorder); ok {
+				recorder = rec
+				rec.startRecording()
+			}
+
+			conn = info.Conn
+		},
+		Got100Continue: func() {
+			t.out.Debug("Received 100 Continue, sending the request body")
+		},
+	}
+
+	if timeout := t.d.cfg.ResponseHeaderTimeout; timeout > 0 {
+		var ht *headerTimer
+		r, ht = t.withHeaderTimeout(r, trace, timeout)
+		defer func() {
+			if ht.stop() && err != nil {
+				err = fmt.Errorf("%w after %s: %w", ErrResponseHeaderTimeout, timeout, err)
+			}
+		}()
+	}
+
+	var cancelRead context.CancelFunc
+	if t.d.cfg.ReadTimeout > 0 {
+		r, cancelRead = withReadTimeout(r)
+	}
+
+	var sm *speedMonitor
+	if t.d.cfg.SpeedLimit > 0 {
+		r, sm = withSpeedMonitor(r, t.d.cfg.SpeedLimit, t.d.cfg.SpeedTime)
+	}
+
+	r = r.WithContext(httptrace.WithClientTrace(r.Context(), trace))
+
 	resp, err = t.base.RoundTrip(r)
 	if err != nil {
+		if cancelRead != nil {
+			cancelRead()
+		}
+
+		if sm != nil {
+			sm.stop()
+			sm.cancel()
+			err = sm.wrapErr(err)
+		}
+
+		if t.d.cfg.MaxHeaderSize > 0 && isHeaderTooLarge(err) {
+			err = fmt.Errorf("%w: %w", ErrHeaderTooLarge, err)
+		}
+
 		return nil, err
 	}
 
+	if cancelRead != nil {
+		resp.Body = newReadTimeoutBody(resp.Body, cancelRead, t.d.cfg.ReadTimeout)
+	}
+
+	if sm != nil {
+		resp.Body = &speedMonitorBody{body: resp.Body, m: sm}
+	}
+
 	// Make sure that resp.TLS field is set regardless of what protocol was
 	// used.  This is important for ECH-enabled connections as crypto/tls is
 	// not used there and the regular http.Transport will not set the TLS field.
-	type tlsConnectionStater interface {
-		ConnectionState() tls.ConnectionState
-	}
-	if c, ok := t.d.conn.(tlsConnectionStater); ok {
+	if c, ok := conn.(tlsConnectionStater); ok {
 		state := c.ConnectionState()
 		resp.TLS = &state
 	}
 
+	if conn != nil && resp.Request != nil {
+		info := &output.ConnInfo{
+			RemoteAddr: conn.RemoteAddr(),
+			LocalAddr:  conn.LocalAddr(),
+		}
+		if used, ok := t.d.direct.MultipathTCP(conn); ok {
+			info.MPTCP = &used
+		}
+
+		if t.d.proxy != nil {
+			info.Proxy, _ = t.d.proxy.ProxyFor(conn)
+			info.ProxyUsed = info.Proxy != "" && info.Proxy != proxy.Direct
+		}
+
+		if recorder != nil {
+			info.Header = recorder.recordedHeader()
+		}
+
+		ctx := output.WithConnInfo(resp.Request.Context(), info)
+		resp.Request = resp.Request.WithContext(context.WithValue(ctx, connKey{}, conn))
+	}
+
 	return resp, err
 }
 
+// ErrResponseHeaderTimeout is returned when the response header is not
+// received within --response-header-timeout.
+var ErrResponseHeaderTimeout = errors.New("response header timeout")
+
+// headerTimer cancels the request if the response header is not received in
+// time, see --response-header-timeout.
+type headerTimer struct {
+	// mu protects timer, stopped, and timedOut.
+	mu *sync.Mutex
+
+	// cancel cancels the request context.
+	cancel context.CancelFunc
+
+	// timer is the started timer, it is nil until start is called.
+	timer *time.Timer
+
+	// timeout is the maximum duration of waiting for the response header.
+	timeout time.Duration
+
+	// stopped is true if the response header or an error is received.
+	stopped bool
+
+	// timedOut is true if the request was canceled by the timer.
+	timedOut bool
+}
+
+// withHeaderTimeout returns the request that is canceled if the response
+// header is not received within timeout after the request is sent.  trace is
+// modified to start the timer once the request is written.  HTTP/3 transports
+// don't report it so for them the timer is started right away.
+func (t *transport) withHeaderTimeout(
+	r *http.Request,
+	trace *httptrace.ClientTrace,
+	timeout time.Duration,
+) (req *http.Request, ht *headerTimer) {
+	ctx, cancel := context.WithCancel(r.Context())
+	ht = &headerTimer{
+		mu:      &sync.Mutex{},
+		cancel:  cancel,
+		timeout: timeout,
+	}
+
+	trace.WroteRequest = func(_ httptrace.WroteRequestInfo) { ht.start() }
+	if t.d.cfg.ForceHTTP3 || t.d.cfg.TryHTTP3 {
+		ht.start()
+	}
+
+	return r.WithContext(ctx), ht
+}
+
+// start starts the timer unless it is already started or stopped.
+func (ht *headerTimer) start() {
+	ht.mu.Lock()
+	defer ht.mu.Unlock()
+
+	if ht.stopped || ht.timer != nil {
+		return
+	}
+
+	ht.timer = time.AfterFunc(ht.timeout, func() {
+		ht.mu.Lock()
+		defer ht.mu.Unlock()
+
+		if !ht.stopped {
+			ht.timedOut = true
+			ht.cancel()
+		}
+	})
+}
+
+// stop stops the timer and returns true if the request was canceled by it.
+// The request context is left as is when the header is received in time since
+// the response body is read using it.
+func (ht *headerTimer) stop() (timedOut bool) {
+	ht.mu.Lock()
+	defer ht.mu.Unlock()
+
+	ht.stopped = true
+	if ht.timer != nil {
+		ht.timer.Stop()
+	}
+
+	return ht.timedOut
+}
+
+// roundTripFile reads the local file specified by the file:// URL in r.
+func (t *transport) roundTripFile(r *http.Request) (resp *http.Response, err error) {
+	t.out.Debug("Reading local file %s", r.URL.Path)
+
+	resp, err = t.file.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// http.NewFileTransport only sets the Content-Length header, but the
+	// field is used to decide whether the response has a body.
+	if resp.ContentLength < 0 {
+		resp.ContentLength, _ = strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+	}
+
+	return resp, nil
+}
+
 // NewTransport creates a new http.RoundTripper that will be used for making
 // the request.
 func NewTransport(cfg *config.Config, out *output.Output) (rt Transport, err error) {
+	var sess *session.Session
+	if cfg.SessionFile != "" {
+		sess, err = session.Load(cfg.SessionFile)
+		if err != nil {
+			return nil, err
+		}
+
+		cfg = withSessionAltSvc(cfg, sess, out)
+	}
+
 	d, err := newDialer(cfg, out)
 	if err != nil {
 		return nil, err
 	}
 
-	bt, err := createHTTPTransport(d, cfg)
+	if sess != nil {
+		d.tlsConfig.ClientSessionCache = sess.TLSSessionCache()
+	}
+
+	bt, err := createHTTPTransport(d, cfg, out)
 	if err != nil {
 		return nil, err
 	}
 
-	return &transport{d: d, base: bt}, nil
+	rt = &transport{
+		d:    d,
+		out:  out,
+		base: bt,
+		file: http.NewFileTransport(http.Dir("/")),
+	}
+
+	if cfg.CacheDir != "" {
+		rt, err = newCacheTransport(rt, cfg.CacheDir, out)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if sess != nil {
+		rt = newSessionTransport(rt, sess, out)
+	}
+
+	if needsCookieEngine(cfg) {
+		rt = newCookieTransport(rt, cfg, out)
+	}
+
+	// Authentication goes under redirects so that every request of the chain
+	// answers its own challenge.
+	if cfg.AuthScheme != "" {
+		rt = newAuthTransport(rt, cfg, out)
+	}
+
+	// Redirects go on top so that every request of the chain is cached and
+	// uses the session.
+	if cfg.FollowRedirects {
+		rt = newRedirectTransport(rt, cfg, out)
+	}
+
+	return rt, nil
+}
+
+// withSessionAltSvc returns cfg that attempts HTTP/3 first if the request
+// origin advertised it in the Alt-Svc header saved in the session.  cfg is
+// returned as is if the protocol is forced.
+func withSessionAltSvc(cfg *config.Config, sess *session.Session, out *output.Output) (res *config.Config) {
+	if cfg.ForceHTTP11 || cfg.ForceHTTP2 || cfg.ForceHTTP3 || cfg.TryHTTP3 || !sess.HTTP3(cfg.RequestURL) {
+		return cfg
+	}
+
+	out.Debug("Attempting HTTP/3 as %s advertised it in Alt-Svc", cfg.RequestURL.Host)
+
+	res = cfg.WithURL(cfg.RequestURL)
+	res.TryHTTP3 = true
+
+	return res
 }
 
 // createHTTPTransport creates http.RoundTripper that will be used by the
@@ -82,13 +389,18 @@ func NewTransport(cfg *config.Config, out *output.Output) (rt Transport, err err
 func createHTTPTransport(
 	d *clientDialer,
 	cfg *config.Config,
+	out *output.Output,
 ) (rt http.RoundTripper, err error) {
 	if cfg.ForceHTTP3 {
 		return createH3Transport(d)
 	}
 
+	if cfg.TryHTTP3 {
+		return createH3FallbackTransport(d, out)
+	}
+
 	if cfg.ForceHTTP2 {
-		return createH2Transport(d)
+		return createH2Transport(d, out)
 	}
 
 	return createH12Transport(d)
@@ -97,15 +409,68 @@ func createHTTPTransport(
 // createH3Transport creates a http.RoundTripper to be used in HTTP/3 client.
 func createH3Transport(d *clientDialer) (rt http.RoundTripper, err error) {
 	return &http3.RoundTripper{
-		DisableCompression: true,
-		Dial:               d.DialQUIC,
+		DisableCompression:     true,
+		Dial:                   d.DialQUIC,
+		MaxResponseHeaderBytes: d.cfg.MaxHeaderSize,
+		QuicConfig:             newQUICConfig(d.cfg),
 	}, nil
 }
 
+// newQUICConfig creates the configuration of QUIC connections, see
+// --quic-idle-timeout, --quic-keepalive, --quic-stream-window,
+// --quic-conn-window, and --quic-version.
+func newQUICConfig(cfg *config.Config) (c *quic.Config) {
+	c = &quic.Config{
+		MaxIdleTimeout:                 cfg.QUICIdleTimeout,
+		KeepAlivePeriod:                cfg.QUICKeepAlive,
+		InitialStreamReceiveWindow:     cfg.QUICStreamWindow,
+		InitialConnectionReceiveWindow: cfg.QUICConnWindow,
+	}
+
+	if cfg.QUICVersion != 0 {
+		c.Versions = []quic.Version{quic.Version(cfg.QUICVersion)}
+	}
+
+	return c
+}
+
 // h2Transport is a http.RoundTripper implementation that forcibly use
-// http2.Transport.
+// http2.Transport.  It keeps the established connections and reuses them for
+// the subsequent requests to the same address.
 type h2Transport struct {
-	d *clientDialer
+	d   *clientDialer
+	out *output.Output
+	tr  *http2.Transport
+
+	// connsMu protects conns and dials.  It's never held while dialing so
+	// that a slow handshake doesn't block connections to other hosts.
+	connsMu *sync.Mutex
+
+	// conns is a map of the "host:port" address to the HTTP/2 connection.
+	conns map[string]*h2Conn
+
+	// dials is a map of the "host:port" address to the connection that is
+	// being established to it.
+	dials map[string]*h2Dial
+}
+
+// h2Conn is an established HTTP/2 connection.
+type h2Conn struct {
+	clientConn *http2.ClientConn
+	conn       net.Conn
+}
+
+// h2Dial is an HTTP/2 connection that is being established.  Concurrent
+// requests to the same address wait for it instead of dialing again.
+type h2Dial struct {
+	// done is closed when the dial is finished.
+	done chan struct{}
+
+	// c is the established connection, it's nil if err is not nil.
+	c *h2Conn
+
+	// err is the error of the dial.
+	err error
 }
 
 // type check
@@ -124,50 +489,140 @@ func (t *h2Transport) RoundTrip(r *http.Request) (resp *http.Response, err error
 	}
 
 	addr := net.JoinHostPort(r.URL.Hostname(), port)
-	conn, err := t.d.DialTLSContext(context.Background(), "tcp", addr)
+	c, reused, err := t.clientConn(r.Context(), addr)
+	if err != nil {
+		return nil, err
+	}
+
+	// http2.ClientConn doesn't report the connection unlike http2.Transport.
+	if trace := httptrace.ContextClientTrace(r.Context()); trace != nil && trace.GotConn != nil {
+		trace.GotConn(httptrace.GotConnInfo{Conn: c.conn, Reused: reused})
+	}
+
+	return c.clientConn.RoundTrip(r)
+}
+
+// clientConn returns an existing HTTP/2 connection to addr if it can take new
+// requests or establishes a new one using ctx.  If the connection to addr is
+// already being established, it waits for it.
+func (t *h2Transport) clientConn(ctx context.Context, addr string) (c *h2Conn, reused bool, err error) {
+	t.connsMu.Lock()
+	if c, ok := t.conns[addr]; ok && c.clientConn.CanTakeNewRequest() {
+		t.connsMu.Unlock()
+
+		return c, true, nil
+	}
+
+	d, inFlight := t.dials[addr]
+	if !inFlight {
+		d = &h2Dial{done: make(chan struct{})}
+		t.dials[addr] = d
+	}
+	t.connsMu.Unlock()
+
+	if inFlight {
+		select {
+		case <-d.done:
+			if d.err != nil {
+				return nil, false, d.err
+			}
+
+			return d.c, true, nil
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		}
+	}
+
+	d.c, d.err = t.dial(ctx, addr)
+
+	t.connsMu.Lock()
+	delete(t.dials, addr)
+	if d.err == nil {
+		t.conns[addr] = d.c
+	}
+	t.connsMu.Unlock()
+
+	close(d.done)
+
+	return d.c, false, d.err
+}
+
+// dial establishes a new HTTP/2 connection to addr.
+func (t *h2Transport) dial(ctx context.Context, addr string) (c *h2Conn, err error) {
+	conn, err := t.d.DialTLSContext(ctx, "tcp", addr)
 	if err != nil {
 		return nil, err
 	}
 
-	tr := &http2.Transport{DisableCompression: true}
-	clientConn, err := tr.NewClientConn(conn)
+	clientConn, err := t.tr.NewClientConn(conn)
 	if err != nil {
+		_ = conn.Close()
+
 		return nil, err
 	}
 
-	return clientConn.RoundTrip(r)
+	return &h2Conn{
+		clientConn: clientConn,
+		conn:       conn,
+	}, nil
 }
 
 // createH2Transport creates a http.RoundTripper to be used specifically with
 // HTTP/2.  This option is required when using --ech option as in this case
 // we don't use *tls.Conn and it does not work well with the regular transport.
-func createH2Transport(d *clientDialer) (rt http.RoundTripper, err error) {
-	return &h2Transport{d: d}, nil
+func createH2Transport(d *clientDialer, out *output.Output) (rt http.RoundTripper, err error) {
+	return &h2Transport{
+		d:   d,
+		out: out,
+		tr: &http2.Transport{
+			DisableCompression: true,
+			MaxHeaderListSize:  maxHeaderListSize(d.cfg),
+		},
+		connsMu: &sync.Mutex{},
+		conns:   map[string]*h2Conn{},
+		dials:   map[string]*h2Dial{},
+	}, nil
 }
 
 // createH12Transport creates a http.RoundTripper to be used in HTTP/1.1 or
 // HTTP/2 client.
 func createH12Transport(d *clientDialer) (rt http.RoundTripper, err error) {
 	tr := &http.Transport{
-		DisableCompression: true,
-		DisableKeepAlives:  true,
-		DialContext:        d.DialContext,
-		DialTLSContext:     d.DialTLSContext,
+		DisableCompression:     true,
+		DialContext:            withHeaderRecording(d.DialContext),
+		DialTLSContext:         withHeaderRecording(d.DialTLSContext),
+		MaxResponseHeaderBytes: d.cfg.MaxHeaderSize,
+		ExpectContinueTimeout:  d.cfg.Expect100Timeout,
 	}
 
 	// Enable HTTP/2 support explicitly.
-	_ = http2.ConfigureTransport(tr)
+	t2, err := http2.ConfigureTransports(tr)
+	if err == nil {
+		t2.MaxHeaderListSize = maxHeaderListSize(d.cfg)
+	}
 
 	return tr, nil
 }
 
+// maxHeaderListSize returns the HTTP/2 SETTINGS_MAX_HEADER_LIST_SIZE value for
+// --max-header-size.  Zero means the default value.
+func maxHeaderListSize(cfg *config.Config) (size uint32) {
+	if cfg.MaxHeaderSize > math.MaxUint32 {
+		return math.MaxUint32 - 1
+	}
+
+	return uint32(cfg.MaxHeaderSize)
+}
+
 // getMethod returns HTTP method depending on the arguments.
 func getMethod(cfg *config.Config) (method string) {
 	if cfg.Method != "" {
 		method = cfg.Method
 	} else if cfg.Head {
 		method = http.MethodHead
-	} else if cfg.Data != "" {
+	} else if cfg.UploadFile != "" {
+		method = http.MethodPut
+	} else if cfg.HasData() || cfg.Form != nil {
 		method = http.MethodPost
 	} else {
 		method = http.MethodGet
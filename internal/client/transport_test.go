@@ -0,0 +1,1685 @@
+package client_test
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ameshkov/gocurl/internal/client"
+	"github.com/ameshkov/gocurl/internal/config"
+	"github.com/ameshkov/gocurl/internal/output"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestTransport_connectionReuse(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("test"))
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	out, err := output.NewOutput("", false)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name      string
+		cfg       *config.Config
+		wantProto string
+	}{{
+		name:      "default",
+		cfg:       &config.Config{RequestURL: u, Insecure: true},
+		wantProto: "HTTP/2.0",
+	}, {
+		name:      "http1.1",
+		cfg:       &config.Config{RequestURL: u, Insecure: true, ForceHTTP11: true},
+		wantProto: "HTTP/1.1",
+	}, {
+		name:      "http2",
+		cfg:       &config.Config{RequestURL: u, Insecure: true, ForceHTTP2: true},
+		wantProto: "HTTP/2.0",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			transport, err := client.NewTransport(tc.cfg, out)
+			require.NoError(t, err)
+
+			r := client.Probe(tc.cfg, transport)
+			require.NoError(t, r.Err)
+			require.Equal(t, tc.wantProto, r.Response.Proto)
+			require.NotNil(t, r.Response.TLS)
+
+			conn := client.ResponseConn(r.Response)
+			require.NotNil(t, conn)
+
+			r = client.Probe(tc.cfg, transport)
+			require.NoError(t, r.Err)
+			require.Same(t, conn, client.ResponseConn(r.Response))
+		})
+	}
+}
+
+func TestTransport_http2ConcurrentDials(t *testing.T) {
+	var connsMu sync.Mutex
+	conns := 0
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("test"))
+	}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			connsMu.Lock()
+			defer connsMu.Unlock()
+
+			conns++
+		}
+	}
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	// The slow server accepts connections, but never completes the TLS
+	// handshake.
+	slow, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = slow.Close() })
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, aErr := slow.Accept()
+		if aErr == nil {
+			accepted <- conn
+		}
+	}()
+
+	out, err := output.NewOutput("", false)
+	require.NoError(t, err)
+
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	cfg := &config.Config{RequestURL: u, Insecure: true, ForceHTTP2: true}
+	transport, err := client.NewTransport(cfg, out)
+	require.NoError(t, err)
+
+	slowDone := make(chan error, 1)
+	go func() {
+		req, _ := http.NewRequest(http.MethodGet, "https://"+slow.Addr().String(), nil)
+		_, rtErr := transport.RoundTrip(req)
+		slowDone <- rtErr
+	}()
+
+	// Wait until the slow request is in the middle of the TLS handshake.
+	slowConn := <-accepted
+	t.Cleanup(func() { _ = slowConn.Close() })
+
+	// Requests to another host are not blocked by the slow handshake, and
+	// the parallel requests to the same host share one connection.
+	var wg sync.WaitGroup
+	errs := make(chan error, 5)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+			resp, rtErr := transport.RoundTrip(req)
+			if rtErr == nil {
+				_ = resp.Body.Close()
+			}
+
+			errs <- rtErr
+		}()
+	}
+
+	fastDone := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(fastDone)
+	}()
+
+	select {
+	case <-fastDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("requests are blocked by the slow handshake")
+	}
+	close(errs)
+
+	for rtErr := range errs {
+		require.NoError(t, rtErr)
+	}
+
+	connsMu.Lock()
+	require.Equal(t, 1, conns)
+	connsMu.Unlock()
+
+	// The slow request is still in progress.
+	select {
+	case rtErr := <-slowDone:
+		t.Fatalf("slow request finished: %v", rtErr)
+	default:
+	}
+
+	_ = slowConn.Close()
+	require.Error(t, <-slowDone)
+}
+
+func TestTransport_tlsRecordSplit(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("test"))
+	}))
+	t.Cleanup(srv.Close)
+
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	out, err := output.NewOutput("", false)
+	require.NoError(t, err)
+
+	cfg := &config.Config{
+		RequestURL:         u,
+		Insecure:           true,
+		TLSRecordSplitSize: 16,
+		TLSSplitChunkSize:  3,
+	}
+
+	transport, err := client.NewTransport(cfg, out)
+	require.NoError(t, err)
+
+	r := client.Probe(cfg, transport)
+	require.NoError(t, r.Err)
+	require.Equal(t, http.StatusOK, r.Response.StatusCode)
+	require.Equal(t, int64(4), r.BodySize)
+}
+
+func TestTransport_caCert(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("test"))
+	}))
+	t.Cleanup(srv.Close)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	require.NoError(t, os.WriteFile(caFile, caPEM, 0o600))
+
+	out, err := output.NewOutput("", false)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name string
+		args []string
+	}{{
+		name: "crypto_tls",
+		args: nil,
+	}, {
+		// The post-quantum experiment makes the handshake with cfcrypto.
+		name: "cfcrypto",
+		args: []string{"--experiment", "pq"},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := config.ParseConfig(append(tc.args, srv.URL))
+			require.NoError(t, err)
+
+			transport, err := client.NewTransport(cfg, out)
+			require.NoError(t, err)
+
+			r := client.Probe(cfg, transport)
+			require.Error(t, r.Err)
+
+			cfg, err = config.ParseConfig(append(tc.args, "--cacert", caFile, srv.URL))
+			require.NoError(t, err)
+
+			transport, err = client.NewTransport(cfg, out)
+			require.NoError(t, err)
+
+			r = client.Probe(cfg, transport)
+			require.NoError(t, r.Err)
+			require.Equal(t, http.StatusOK, r.Response.StatusCode)
+		})
+	}
+}
+
+// readRequestHead accepts a connection from l, sends the request head read
+// from it to ch, and responds with a short response.
+func readRequestHead(l net.Listener, ch chan<- string) {
+	defer close(ch)
+
+	conn, err := l.Accept()
+	if err != nil {
+		return
+	}
+	defer func() { _ = conn.Close() }()
+
+	var head []byte
+	buf := make([]byte, 1024)
+	for !bytes.Contains(head, []byte("\r\n\r\n")) {
+		n, readErr := conn.Read(buf)
+		if readErr != nil {
+			return
+		}
+
+		head = append(head, buf[:n]...)
+	}
+
+	ch <- string(head)
+
+	_, _ = conn.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 4\r\nConnection: close\r\n\r\ntest"))
+}
+
+func TestTransport_httpMangle(t *testing.T) {
+	testCases := []struct {
+		name        string
+		mode        string
+		wantLine    string
+		wantHost    string
+		notWantHost string
+	}{{
+		name:        "host_case",
+		mode:        "host-case",
+		wantLine:    "GET /path HTTP/1.1\r\n",
+		wantHost:    "\r\nhOsT: eXaMpLe.oRg\r\n",
+		notWantHost: "Host: example.org",
+	}, {
+		name:     "space",
+		mode:     "space",
+		wantLine: "GET  /path HTTP/1.1\r\n",
+		wantHost: "\r\nHost: example.org\r\n",
+	}, {
+		name:     "split",
+		mode:     "split",
+		wantLine: "GET /path HTTP/1.1\r\n",
+		wantHost: "\r\nHost: example.org\r\n",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			t.Cleanup(func() { _ = l.Close() })
+
+			heads := make(chan string, 1)
+			go readRequestHead(l, heads)
+
+			cfg, err := config.ParseConfig([]string{
+				"--http-mangle", tc.mode,
+				"--connect-to", "example.org:80:" + l.Addr().String(),
+				"http://example.org/path",
+			})
+			require.NoError(t, err)
+
+			out, err := output.NewOutput("", false)
+			require.NoError(t, err)
+
+			transport, err := client.NewTransport(cfg, out)
+			require.NoError(t, err)
+
+			r := client.Probe(cfg, transport)
+			require.NoError(t, r.Err)
+			require.Equal(t, http.StatusOK, r.Response.StatusCode)
+
+			head, ok := <-heads
+			require.True(t, ok)
+			require.True(t, strings.HasPrefix(head, tc.wantLine), head)
+			require.Contains(t, head, tc.wantHost)
+			if tc.notWantHost != "" {
+				require.NotContains(t, head, tc.notWantHost)
+			}
+		})
+	}
+}
+
+// datagramSizesConn is a net.PacketConn that records the sizes of the first
+// received datagrams.
+type datagramSizesConn struct {
+	net.PacketConn
+
+	mu    *sync.Mutex
+	sizes []int
+}
+
+// ReadFrom implements net.PacketConn for *datagramSizesConn.
+func (c *datagramSizesConn) ReadFrom(b []byte) (n int, addr net.Addr, err error) {
+	n, addr, err = c.PacketConn.ReadFrom(b)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err == nil && len(c.sizes) < 3 {
+		c.sizes = append(c.sizes, n)
+	}
+
+	return n, addr, err
+}
+
+func TestTransport_quicShaping(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("test"))
+	})
+
+	// Use the certificate generated by httptest for the HTTP/3 server.
+	tlsSrv := httptest.NewTLSServer(handler)
+	t.Cleanup(tlsSrv.Close)
+
+	for _, version := range []string{"v1", "v2"} {
+		t.Run(version, func(t *testing.T) {
+			conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+			require.NoError(t, err)
+
+			sizesConn := &datagramSizesConn{PacketConn: conn, mu: &sync.Mutex{}}
+			srv := &http3.Server{
+				Handler:   handler,
+				TLSConfig: &tls.Config{Certificates: tlsSrv.TLS.Certificates},
+				QuicConfig: &quic.Config{
+					Versions: []quic.Version{quic.Version1, quic.Version2},
+				},
+			}
+			go func() { _ = srv.Serve(sizesConn) }()
+			t.Cleanup(func() { _ = srv.Close() })
+
+			cfg, err := config.ParseConfig([]string{
+				"--http3",
+				"--insecure",
+				"--quic-version", version,
+				"--quic-split", "3",
+				"--quic-reorder",
+				"--quic-initial-size", "1400",
+				"https://" + conn.LocalAddr().String(),
+			})
+			require.NoError(t, err)
+
+			out, err := output.NewOutput("", false)
+			require.NoError(t, err)
+
+			transport, err := client.NewTransport(cfg, out)
+			require.NoError(t, err)
+
+			r := client.Probe(cfg, transport)
+			require.NoError(t, r.Err)
+			require.Equal(t, "HTTP/3.0", r.Response.Proto)
+			require.Equal(t, int64(4), r.BodySize)
+
+			// ClientHello is sent in three separate padded datagrams.
+			sizesConn.mu.Lock()
+			defer sizesConn.mu.Unlock()
+
+			require.Equal(t, []int{1400, 1400, 1400}, sizesConn.sizes)
+		})
+	}
+}
+
+func TestTransport_quicVersion(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("test"))
+	})
+
+	// Use the certificate generated by httptest for the HTTP/3 server.
+	tlsSrv := httptest.NewTLSServer(handler)
+	t.Cleanup(tlsSrv.Close)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	// The server only supports QUIC v2.
+	srv := &http3.Server{
+		Handler:    handler,
+		TLSConfig:  &tls.Config{Certificates: tlsSrv.TLS.Certificates},
+		QuicConfig: &quic.Config{Versions: []quic.Version{quic.Version2}},
+	}
+	go func() { _ = srv.Serve(conn) }()
+	t.Cleanup(func() { _ = srv.Close() })
+
+	u, err := url.Parse("https://" + conn.LocalAddr().String())
+	require.NoError(t, err)
+
+	out, err := output.NewOutput("", false)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name    string
+		version string
+		wantErr bool
+	}{{
+		name:    "v2",
+		version: "v2",
+		wantErr: false,
+	}, {
+		name:    "v1",
+		version: "v1",
+		wantErr: true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, cfgErr := config.ParseConfig([]string{
+				"-k",
+				"--http3",
+				"--max-time=2s",
+				"--quic-version=" + tc.version,
+				u.String(),
+			})
+			require.NoError(t, cfgErr)
+
+			transport, trErr := client.NewTransport(cfg, out)
+			require.NoError(t, trErr)
+
+			r := client.Probe(cfg, transport)
+			if tc.wantErr {
+				require.Error(t, r.Err)
+
+				return
+			}
+
+			require.NoError(t, r.Err)
+			require.Equal(t, "HTTP/3.0", r.Response.Proto)
+		})
+	}
+}
+
+func TestTransport_pinnedPubKey(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("test"))
+	})
+
+	tlsSrv := httptest.NewTLSServer(handler)
+	t.Cleanup(tlsSrv.Close)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	h3Srv := &http3.Server{
+		Handler:   handler,
+		TLSConfig: &tls.Config{Certificates: tlsSrv.TLS.Certificates},
+	}
+	go func() { _ = h3Srv.Serve(conn) }()
+	t.Cleanup(func() { _ = h3Srv.Close() })
+
+	sum := sha256.Sum256(tlsSrv.Certificate().RawSubjectPublicKeyInfo)
+	pin := "sha256//" + base64.StdEncoding.EncodeToString(sum[:])
+	otherPin := "sha256//" + base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))
+
+	out, err := output.NewOutput("", false)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		wantErr error
+		name    string
+		url     string
+		args    []string
+	}{{
+		wantErr: nil,
+		name:    "match",
+		url:     tlsSrv.URL,
+		args:    []string{"--pinnedpubkey", otherPin + ";" + pin},
+	}, {
+		wantErr: client.ErrPinnedPubKey,
+		name:    "mismatch",
+		url:     tlsSrv.URL,
+		args:    []string{"--pinnedpubkey", otherPin},
+	}, {
+		wantErr: client.ErrPinnedPubKey,
+		name:    "mismatch_cfcrypto",
+		url:     tlsSrv.URL,
+		args:    []string{"--pinnedpubkey", otherPin, "--experiment", "pq"},
+	}, {
+		wantErr: nil,
+		name:    "match_http3",
+		url:     "https://" + conn.LocalAddr().String(),
+		args:    []string{"--pinnedpubkey", pin, "--http3"},
+	}, {
+		wantErr: client.ErrPinnedPubKey,
+		name:    "mismatch_http3",
+		url:     "https://" + conn.LocalAddr().String(),
+		args:    []string{"--pinnedpubkey", otherPin, "--http3"},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := config.ParseConfig(append(tc.args, "-k", tc.url))
+			require.NoError(t, err)
+
+			transport, err := client.NewTransport(cfg, out)
+			require.NoError(t, err)
+
+			r := client.Probe(cfg, transport)
+			if tc.wantErr != nil {
+				require.ErrorIs(t, r.Err, tc.wantErr)
+
+				return
+			}
+
+			require.NoError(t, r.Err)
+			require.Equal(t, http.StatusOK, r.Response.StatusCode)
+		})
+	}
+}
+
+func TestTransport_certStatus(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("test"))
+	}))
+	t.Cleanup(srv.Close)
+
+	// The httptest certificate is self-signed so it signs its own OCSP
+	// responses.
+	cert := srv.Certificate()
+	signer := srv.TLS.Certificates[0].PrivateKey.(crypto.Signer)
+	newStaple := func(status int) (b []byte) {
+		b, err := ocsp.CreateResponse(cert, cert, ocsp.Response{
+			Status:       status,
+			SerialNumber: cert.SerialNumber,
+			ThisUpdate:   time.Now().Add(-time.Hour),
+			NextUpdate:   time.Now().Add(time.Hour),
+			RevokedAt:    time.Now().Add(-time.Minute),
+		}, signer)
+		require.NoError(t, err)
+
+		return b
+	}
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	require.NoError(t, os.WriteFile(caFile, caPEM, 0o600))
+
+	out, err := output.NewOutput("", false)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name    string
+		staple  []byte
+		args    []string
+		wantErr string
+	}{{
+		name:   "good",
+		staple: newStaple(ocsp.Good),
+		args:   []string{"--cacert", caFile},
+	}, {
+		name:   "good_insecure",
+		staple: newStaple(ocsp.Good),
+		args:   []string{"-k"},
+	}, {
+		name:   "good_cfcrypto",
+		staple: newStaple(ocsp.Good),
+		args:   []string{"--cacert", caFile, "--experiment", "pq"},
+	}, {
+		name:    "revoked",
+		staple:  newStaple(ocsp.Revoked),
+		args:    []string{"--cacert", caFile},
+		wantErr: "certificate revoked",
+	}, {
+		name:    "revoked_cfcrypto",
+		staple:  newStaple(ocsp.Revoked),
+		args:    []string{"--cacert", caFile, "--experiment", "pq"},
+		wantErr: "certificate revoked",
+	}, {
+		name:    "no_staple",
+		staple:  nil,
+		args:    []string{"--cacert", caFile},
+		wantErr: "no stapled ocsp response",
+	}, {
+		name:    "invalid",
+		staple:  []byte("invalid"),
+		args:    []string{"--cacert", caFile},
+		wantErr: "parsing ocsp response",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv.TLS.Certificates[0].OCSPStaple = tc.staple
+
+			cfg, err := config.ParseConfig(append(tc.args, "--cert-status", srv.URL))
+			require.NoError(t, err)
+
+			transport, err := client.NewTransport(cfg, out)
+			require.NoError(t, err)
+
+			r := client.Probe(cfg, transport)
+			if tc.wantErr != "" {
+				require.ErrorIs(t, r.Err, client.ErrCertStatus)
+				require.ErrorContains(t, r.Err, tc.wantErr)
+
+				return
+			}
+
+			require.NoError(t, r.Err)
+			require.Equal(t, http.StatusOK, r.Response.StatusCode)
+			require.Equal(t, tc.staple, r.Response.TLS.OCSPResponse)
+		})
+	}
+}
+
+func TestTransport_crl(t *testing.T) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, caKey.Public(), caKey)
+	require.NoError(t, err)
+
+	ca, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	leafTmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTmpl, ca, leafKey.Public(), caKey)
+	require.NoError(t, err)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("test"))
+	}))
+	srv.TLS = &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{leafDER}, PrivateKey: leafKey}},
+	}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}), 0o600))
+
+	writeCRL := func(name string, serials ...int64) (path string) {
+		tmpl := &x509.RevocationList{
+			Number:     big.NewInt(1),
+			ThisUpdate: time.Now().Add(-time.Hour),
+			NextUpdate: time.Now().Add(time.Hour),
+		}
+		for _, serial := range serials {
+			tmpl.RevokedCertificateEntries = append(tmpl.RevokedCertificateEntries, x509.RevocationListEntry{
+				SerialNumber:   big.NewInt(serial),
+				RevocationTime: time.Now().Add(-time.Minute),
+			})
+		}
+
+		der, crlErr := x509.CreateRevocationList(rand.Reader, tmpl, ca, caKey)
+		require.NoError(t, crlErr)
+
+		path = filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der}), 0o600))
+
+		return path
+	}
+
+	out, err := output.NewOutput("", false)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		wantErr error
+		name    string
+		args    []string
+	}{{
+		wantErr: nil,
+		name:    "not_revoked",
+		args:    []string{"--cacert", caFile, "--crlfile", writeCRL("other.pem", 3)},
+	}, {
+		wantErr: client.ErrCertRevoked,
+		name:    "revoked",
+		args:    []string{"--cacert", caFile, "--crlfile", writeCRL("revoked.pem", 2)},
+	}, {
+		wantErr: client.ErrCertRevoked,
+		name:    "revoked_insecure",
+		args:    []string{"-k", "--crlfile", writeCRL("revoked.pem", 2)},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := config.ParseConfig(append(tc.args, srv.URL))
+			require.NoError(t, err)
+
+			transport, err := client.NewTransport(cfg, out)
+			require.NoError(t, err)
+
+			r := client.Probe(cfg, transport)
+			if tc.wantErr != nil {
+				require.ErrorIs(t, r.Err, tc.wantErr)
+
+				return
+			}
+
+			require.NoError(t, r.Err)
+			require.Equal(t, http.StatusOK, r.Response.StatusCode)
+		})
+	}
+}
+
+func TestTransport_front(t *testing.T) {
+	var gotHost string
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHost = r.Host
+		_, _ = w.Write([]byte("test"))
+	}))
+
+	var gotServerName string
+	srv.TLS = &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (c *tls.Config, err error) {
+			gotServerName = hello.ServerName
+
+			return nil, nil
+		},
+	}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	_, port, err := net.SplitHostPort(srv.Listener.Addr().String())
+	require.NoError(t, err)
+
+	u, err := url.Parse("https://example.org:" + port)
+	require.NoError(t, err)
+
+	out, err := output.NewOutput("", false)
+	require.NoError(t, err)
+
+	cfg := &config.Config{
+		RequestURL: u,
+		Insecure:   true,
+		Front:      "front.example",
+		ConnectTo: map[string]string{
+			"front.example:" + port: srv.Listener.Addr().String(),
+		},
+	}
+
+	transport, err := client.NewTransport(cfg, out)
+	require.NoError(t, err)
+
+	r := client.Probe(cfg, transport)
+	require.NoError(t, r.Err)
+	require.Equal(t, "front.example", gotServerName)
+	require.Equal(t, u.Host, gotHost)
+}
+
+func TestTransport_file(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.txt")
+	err := os.WriteFile(path, []byte("test"), 0o600)
+	require.NoError(t, err)
+
+	out, err := output.NewOutput("", false)
+	require.NoError(t, err)
+
+	cfg := &config.Config{
+		RequestURL: &url.URL{Scheme: "file", Path: filepath.ToSlash(path)},
+	}
+
+	transport, err := client.NewTransport(cfg, out)
+	require.NoError(t, err)
+
+	r := client.Probe(cfg, transport)
+	require.NoError(t, r.Err)
+	require.Equal(t, http.StatusOK, r.Response.StatusCode)
+	require.Equal(t, int64(4), r.Response.ContentLength)
+	require.Equal(t, int64(4), r.BodySize)
+}
+
+func TestTransport_http3TryFallback(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("test"))
+	}))
+	t.Cleanup(srv.Close)
+
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	out, err := output.NewOutput("", false)
+	require.NoError(t, err)
+
+	// There is no HTTP/3 server so the transport must fall back.
+	cfg := &config.Config{
+		RequestURL: u,
+		Insecure:   true,
+		TryHTTP3:   true,
+	}
+
+	transport, err := client.NewTransport(cfg, out)
+	require.NoError(t, err)
+
+	r := client.Probe(cfg, transport)
+	require.NoError(t, r.Err)
+	require.Equal(t, http.StatusOK, r.Response.StatusCode)
+	require.Equal(t, 1, r.Response.ProtoMajor)
+}
+
+func TestTransport_maxHeaderSize(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("X-Big", strings.Repeat("a", 4096))
+		_, _ = w.Write([]byte("test"))
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	out, err := output.NewOutput("", false)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name string
+		cfg  *config.Config
+	}{{
+		name: "http1.1",
+		cfg:  &config.Config{ForceHTTP11: true},
+	}, {
+		name: "http2",
+		cfg:  &config.Config{ForceHTTP2: true},
+	}, {
+		name: "default",
+		cfg:  &config.Config{},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := tc.cfg
+			cfg.RequestURL = u
+			cfg.Insecure = true
+			cfg.MaxHeaderSize = 1024
+
+			transport, tErr := client.NewTransport(cfg, out)
+			require.NoError(t, tErr)
+
+			r := client.Probe(cfg, transport)
+			require.ErrorIs(t, r.Err, client.ErrHeaderTooLarge)
+		})
+	}
+}
+
+func TestTransport_headerOrder(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = l.Close() })
+
+	go func() {
+		conn, aErr := l.Accept()
+		if aErr != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+
+		_, _ = conn.Read(make([]byte, 4096))
+		_, _ = conn.Write([]byte("HTTP/1.1 200 OK\r\n" +
+			"x-b: 1\r\n" +
+			"X-A: 2\r\n" +
+			"x-b: 3\r\n" +
+			"Content-Length: 0\r\n" +
+			"\r\n"))
+	}()
+
+	path := filepath.Join(t.TempDir(), "out.json")
+	out, err := output.NewOutput(path, false)
+	require.NoError(t, err)
+
+	cfg := &config.Config{
+		RequestURL: &url.URL{Scheme: "http", Host: l.Addr().String()},
+		OutputJSON: true,
+	}
+
+	transport, err := client.NewTransport(cfg, out)
+	require.NoError(t, err)
+
+	r := client.Probe(cfg, transport)
+	require.NoError(t, r.Err)
+
+	out.Write(r.Response, nil, cfg)
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	var data struct {
+		HeadersOrder string                `json:"headers_order"`
+		Headers      []*output.HeaderField `json:"headers"`
+	}
+	require.NoError(t, json.Unmarshal(b, &data))
+	require.Equal(t, output.HeaderOrderWire, data.HeadersOrder)
+	require.Equal(t, []*output.HeaderField{
+		{Name: "x-b", Value: "1"},
+		{Name: "X-A", Value: "2"},
+		{Name: "x-b", Value: "3"},
+		{Name: "Content-Length", Value: "0"},
+	}, data.Headers)
+}
+
+func TestTransport_headerOrderSwitchingProtocols(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = l.Close() })
+
+	go func() {
+		conn, aErr := l.Accept()
+		if aErr != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+
+		// 101 is the final header block, the data of the new protocol
+		// follows it.
+		_, _ = conn.Read(make([]byte, 4096))
+		_, _ = conn.Write([]byte("HTTP/1.1 101 Switching Protocols\r\n" +
+			"Upgrade: test\r\n" +
+			"Connection: Upgrade\r\n" +
+			"X-B: 1\r\n" +
+			"\r\n" +
+			"data"))
+	}()
+
+	path := filepath.Join(t.TempDir(), "out.json")
+	out, err := output.NewOutput(path, false)
+	require.NoError(t, err)
+
+	cfg := &config.Config{
+		RequestURL: &url.URL{Scheme: "http", Host: l.Addr().String()},
+		OutputJSON: true,
+	}
+
+	transport, err := client.NewTransport(cfg, out)
+	require.NoError(t, err)
+
+	r := client.Probe(cfg, transport)
+	require.NoError(t, r.Err)
+	require.Equal(t, http.StatusSwitchingProtocols, r.Response.StatusCode)
+
+	out.Write(r.Response, nil, cfg)
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	var data struct {
+		HeadersOrder string                `json:"headers_order"`
+		Headers      []*output.HeaderField `json:"headers"`
+	}
+	require.NoError(t, json.Unmarshal(b, &data))
+	require.Equal(t, output.HeaderOrderWire, data.HeadersOrder)
+	require.Equal(t, []*output.HeaderField{
+		{Name: "Upgrade", Value: "test"},
+		{Name: "Connection", Value: "Upgrade"},
+		{Name: "X-B", Value: "1"},
+	}, data.Headers)
+}
+
+func TestTransport_headerOrderHTTP2(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("X-B", "1")
+		w.Header().Set("X-A", "2")
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "out.json")
+	out, err := output.NewOutput(path, false)
+	require.NoError(t, err)
+
+	cfg := &config.Config{
+		RequestURL: u,
+		Insecure:   true,
+		OutputJSON: true,
+	}
+
+	transport, err := client.NewTransport(cfg, out)
+	require.NoError(t, err)
+
+	r := client.Probe(cfg, transport)
+	require.NoError(t, r.Err)
+	require.Equal(t, "HTTP/2.0", r.Response.Proto)
+
+	out.Write(r.Response, nil, cfg)
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	// The wire order of HTTP/2 header fields is not known.
+	var data struct {
+		HeadersOrder string                `json:"headers_order"`
+		Headers      []*output.HeaderField `json:"headers"`
+	}
+	require.NoError(t, json.Unmarshal(b, &data))
+	require.Equal(t, output.HeaderOrderAlphabetical, data.HeadersOrder)
+
+	var names []string
+	for _, f := range data.Headers {
+		names = append(names, f.Name)
+	}
+	require.True(t, slices.IsSorted(names))
+}
+
+func TestTransport_clientCert(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.TLS.PeerCertificates[0].Subject.Organization[0]))
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	out, err := output.NewOutput("", false)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		experiments map[config.Experiment]string
+		name        string
+	}{{
+		experiments: nil,
+		name:        "crypto_tls",
+	}, {
+		// The post-quantum experiment makes the handshake with cfcrypto.
+		experiments: map[config.Experiment]string{config.ExpPostQuantum: ""},
+		name:        "cfcrypto",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Use the server certificate as the client one, the server does
+			// not verify it anyway.
+			cfg := &config.Config{
+				RequestURL:  u,
+				Insecure:    true,
+				ClientCert:  &srv.TLS.Certificates[0],
+				Experiments: tc.experiments,
+			}
+
+			transport, err := client.NewTransport(cfg, out)
+			require.NoError(t, err)
+
+			r := client.Probe(cfg, transport)
+			require.NoError(t, r.Err)
+			require.Equal(t, http.StatusOK, r.Response.StatusCode)
+		})
+	}
+}
+
+func TestTransport_phaseTimeouts(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/body" {
+			// Send the header right away, but stall the body.
+			_, _ = w.Write([]byte("te"))
+			w.(http.Flusher).Flush()
+		}
+
+		time.Sleep(500 * time.Millisecond)
+		_, _ = w.Write([]byte("test"))
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	// The listener accepts connections, but never responds to ClientHello.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = l.Close() })
+
+	silentURL, err := url.Parse("https://" + l.Addr().String())
+	require.NoError(t, err)
+
+	bodyURL := u.JoinPath("body")
+
+	out, err := output.NewOutput("", false)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name    string
+		cfg     *config.Config
+		wantErr error
+	}{{
+		name:    "header_http1.1",
+		cfg:     &config.Config{RequestURL: u, ForceHTTP11: true, ResponseHeaderTimeout: 100 * time.Millisecond},
+		wantErr: client.ErrResponseHeaderTimeout,
+	}, {
+		name:    "header_http2",
+		cfg:     &config.Config{RequestURL: u, ForceHTTP2: true, ResponseHeaderTimeout: 100 * time.Millisecond},
+		wantErr: client.ErrResponseHeaderTimeout,
+	}, {
+		name:    "header_in_time",
+		cfg:     &config.Config{RequestURL: u, ResponseHeaderTimeout: 5 * time.Second},
+		wantErr: nil,
+	}, {
+		name:    "handshake",
+		cfg:     &config.Config{RequestURL: silentURL, TLSHandshakeTimeout: 100 * time.Millisecond},
+		wantErr: client.ErrHandshakeTimeout,
+	}, {
+		name:    "read_http1.1",
+		cfg:     &config.Config{RequestURL: bodyURL, ForceHTTP11: true, ReadTimeout: 100 * time.Millisecond},
+		wantErr: client.ErrReadTimeout,
+	}, {
+		name:    "read_http2",
+		cfg:     &config.Config{RequestURL: bodyURL, ForceHTTP2: true, ReadTimeout: 100 * time.Millisecond},
+		wantErr: client.ErrReadTimeout,
+	}, {
+		name:    "read_in_time",
+		cfg:     &config.Config{RequestURL: bodyURL, ReadTimeout: 5 * time.Second},
+		wantErr: nil,
+	}, {
+		name:    "speed_header",
+		cfg:     &config.Config{RequestURL: u, SpeedLimit: 1, SpeedTime: 200 * time.Millisecond},
+		wantErr: client.ErrTooSlow,
+	}, {
+		name:    "speed_body",
+		cfg:     &config.Config{RequestURL: bodyURL, SpeedLimit: 100, SpeedTime: 200 * time.Millisecond},
+		wantErr: client.ErrTooSlow,
+	}, {
+		name:    "speed_ok",
+		cfg:     &config.Config{RequestURL: bodyURL, SpeedLimit: 1, SpeedTime: 5 * time.Second},
+		wantErr: nil,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.cfg.Insecure = true
+
+			transport, tErr := client.NewTransport(tc.cfg, out)
+			require.NoError(t, tErr)
+
+			r := client.Probe(tc.cfg, transport)
+			if tc.wantErr == nil {
+				require.NoError(t, r.Err)
+			} else {
+				require.ErrorIs(t, r.Err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestTransport_redirects(t *testing.T) {
+	var srvURL string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/post":
+			http.Redirect(w, r, "/temp", http.StatusFound)
+		case "/temp":
+			// Redirect to another host name of the same server.
+			http.Redirect(w, r, strings.Replace(srvURL, "127.0.0.1", "redirect.test", 1)+"/final", http.StatusTemporaryRedirect)
+		case "/final":
+			_, _ = w.Write([]byte(r.Method + " " + r.Header.Get("Authorization")))
+		default:
+			http.Redirect(w, r, r.URL.Path, http.StatusFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	srvURL = srv.URL
+
+	out, err := output.NewOutput("", false)
+	require.NoError(t, err)
+
+	u, err := url.Parse(srv.URL + "/post")
+	require.NoError(t, err)
+
+	cfg := &config.Config{
+		RequestURL:      u,
+		Data:            []*config.DataPart{{Data: "a=b"}},
+		Headers:         http.Header{"Authorization": []string{"Bearer secret"}},
+		Hosts:           map[string][]net.IP{"redirect.test": {net.IPv4(127, 0, 0, 1)}},
+		FollowRedirects: true,
+		MaxRedirects:    5,
+	}
+
+	transport, err := client.NewTransport(cfg, out)
+	require.NoError(t, err)
+
+	req, err := client.NewRequest(cfg)
+	require.NoError(t, err)
+
+	resp, err := transport.RoundTrip(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = resp.Body.Close() })
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	// POST is changed to GET after 302 and the credentials are not sent to
+	// another host.
+	require.Equal(t, "GET ", string(body))
+	require.Equal(t, "redirect.test", resp.Request.URL.Hostname())
+
+	// See --post302 and --location-trusted.
+	trustedCfg := cfg.WithURL(u)
+	trustedCfg.RedirectKeepPost = map[int]struct{}{http.StatusFound: {}}
+	trustedCfg.LocationTrusted = true
+
+	trustedTransport, err := client.NewTransport(trustedCfg, out)
+	require.NoError(t, err)
+
+	req, err = client.NewRequest(trustedCfg)
+	require.NoError(t, err)
+
+	resp, err = trustedTransport.RoundTrip(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = resp.Body.Close() })
+
+	body, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, "POST Bearer secret", string(body))
+
+	cfg = cfg.WithURL(u.JoinPath("../loop"))
+	cfg.Data = nil
+
+	req, err = client.NewRequest(cfg)
+	require.NoError(t, err)
+
+	_, err = transport.RoundTrip(req)
+	require.ErrorIs(t, err, client.ErrTooManyRedirects)
+}
+
+func TestTransport_redirectsOrigin(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/self" {
+			http.Redirect(w, r, "/final", http.StatusFound)
+
+			return
+		}
+
+		_, _ = w.Write([]byte(r.Header.Get("Authorization") + ";" + r.Header.Get("Cookie")))
+	}))
+	t.Cleanup(target.Close)
+
+	redirect := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL+"/final", http.StatusFound)
+	})
+
+	// Both servers listen on 127.0.0.1 so only the scheme and the port of
+	// the redirect location differ.
+	tlsSrv := httptest.NewTLSServer(redirect)
+	t.Cleanup(tlsSrv.Close)
+
+	plainSrv := httptest.NewServer(redirect)
+	t.Cleanup(plainSrv.Close)
+
+	out, err := output.NewOutput("", false)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name    string
+		url     string
+		want    string
+		trusted bool
+	}{{
+		name:    "scheme_and_port",
+		url:     tlsSrv.URL,
+		want:    ";",
+		trusted: false,
+	}, {
+		name:    "port",
+		url:     plainSrv.URL,
+		want:    ";",
+		trusted: false,
+	}, {
+		name:    "same_origin",
+		url:     target.URL + "/self",
+		want:    "Bearer secret;a=b",
+		trusted: false,
+	}, {
+		name:    "trusted",
+		url:     tlsSrv.URL,
+		want:    "Bearer secret;a=b",
+		trusted: true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			u, pErr := url.Parse(tc.url)
+			require.NoError(t, pErr)
+
+			cfg := &config.Config{
+				RequestURL: u,
+				Headers: http.Header{
+					"Authorization": []string{"Bearer secret"},
+					"Cookie":        []string{"a=b"},
+				},
+				Insecure:        true,
+				FollowRedirects: true,
+				LocationTrusted: tc.trusted,
+				MaxRedirects:    5,
+			}
+
+			transport, tErr := client.NewTransport(cfg, out)
+			require.NoError(t, tErr)
+
+			req, rErr := client.NewRequest(cfg)
+			require.NoError(t, rErr)
+
+			resp, rtErr := transport.RoundTrip(req)
+			require.NoError(t, rtErr)
+			t.Cleanup(func() { _ = resp.Body.Close() })
+
+			body, bErr := io.ReadAll(resp.Body)
+			require.NoError(t, bErr)
+			require.Equal(t, tc.want, string(body))
+		})
+	}
+}
+
+func TestTransport_digest(t *testing.T) {
+	const nonce = "test-nonce"
+
+	sha := func(s string) (h string) {
+		sum := sha256.Sum256([]byte(s))
+
+		return hex.EncodeToString(sum[:])
+	}
+
+	paramRe := regexp.MustCompile(`(\w+)="?([^",]*)"?`)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		params := map[string]string{}
+		for _, m := range paramRe.FindAllStringSubmatch(r.Header.Get("Authorization"), -1) {
+			params[m[1]] = m[2]
+		}
+
+		ha1 := sha("user:test:pass")
+		ha2 := sha(r.Method + ":" + r.URL.RequestURI())
+		want := sha(ha1 + ":" + nonce + ":" + params["nc"] + ":" + params["cnonce"] + ":auth:" + ha2)
+		if params["response"] != want {
+			w.Header().Set("WWW-Authenticate", `Digest realm="test", qop="auth", nonce="`+nonce+`", algorithm=SHA-256`)
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(append([]byte(r.Method+" "), body...))
+	}))
+	t.Cleanup(srv.Close)
+
+	out, err := output.NewOutput("", false)
+	require.NoError(t, err)
+
+	u, err := url.Parse(srv.URL + "/auth?q=1")
+	require.NoError(t, err)
+
+	cfg := &config.Config{
+		RequestURL: u,
+		Data:       []*config.DataPart{{Data: "a=b"}},
+		User:       url.UserPassword("user", "pass"),
+		AuthScheme: "digest",
+	}
+
+	transport, err := client.NewTransport(cfg, out)
+	require.NoError(t, err)
+
+	req, err := client.NewRequest(cfg)
+	require.NoError(t, err)
+
+	// Basic credentials are never sent.
+	require.Empty(t, req.Header.Get("Authorization"))
+
+	resp, err := transport.RoundTrip(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = resp.Body.Close() })
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "POST a=b", string(body))
+
+	cfg.User = url.UserPassword("user", "wrong")
+	transport, err = client.NewTransport(cfg, out)
+	require.NoError(t, err)
+
+	req, err = client.NewRequest(cfg)
+	require.NoError(t, err)
+
+	resp, err = transport.RoundTrip(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = resp.Body.Close() })
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestTransport_anyAuth(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scheme, _, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+		if scheme != "" {
+			_, _ = w.Write([]byte(scheme))
+
+			return
+		}
+
+		w.Header().Add("WWW-Authenticate", `Basic realm="test"`)
+		if r.URL.Path == "/digest" {
+			w.Header().Add("WWW-Authenticate", `Digest realm="test", qop="auth", nonce="nonce"`)
+		}
+
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	t.Cleanup(srv.Close)
+
+	out, err := output.NewOutput("", false)
+	require.NoError(t, err)
+
+	for path, want := range map[string]string{"/digest": "Digest", "/basic": "Basic"} {
+		var cfg *config.Config
+		cfg, err = config.ParseConfig([]string{"--anyauth", "-u", "user:pass", srv.URL + path})
+		require.NoError(t, err)
+
+		var transport client.Transport
+		transport, err = client.NewTransport(cfg, out)
+		require.NoError(t, err)
+
+		var req *http.Request
+		req, err = client.NewRequest(cfg)
+		require.NoError(t, err)
+
+		// The credentials are not sent until the challenge is received.
+		require.Empty(t, req.Header.Get("Authorization"))
+
+		var resp *http.Response
+		resp, err = transport.RoundTrip(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = resp.Body.Close() })
+
+		var body []byte
+		body, err = io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Equal(t, want, string(body), path)
+	}
+}
+
+func TestTransport_cookies(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "id", Value: "1", Path: "/"})
+			http.SetCookie(w, &http.Cookie{Name: "keep", Value: "2", Path: "/", MaxAge: 3600})
+			http.Redirect(w, r, "/home", http.StatusFound)
+
+			return
+		}
+
+		_, _ = w.Write([]byte(r.Header.Get("Cookie")))
+	}))
+	t.Cleanup(srv.Close)
+
+	out, err := output.NewOutput("", false)
+	require.NoError(t, err)
+
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	inPath, outPath := filepath.Join(dir, "in.txt"), filepath.Join(dir, "out.txt")
+	err = os.WriteFile(inPath, []byte(u.Hostname()+"\tFALSE\t/\tFALSE\t0\tpre\t0\n"), 0o600)
+	require.NoError(t, err)
+
+	roundTrip := func(args ...string) (body string) {
+		cfg, cErr := config.ParseConfig(args)
+		require.NoError(t, cErr)
+
+		transport, cErr := client.NewTransport(cfg, out)
+		require.NoError(t, cErr)
+
+		req, cErr := client.NewRequest(cfg)
+		require.NoError(t, cErr)
+
+		resp, cErr := transport.RoundTrip(req)
+		require.NoError(t, cErr)
+		t.Cleanup(func() { _ = resp.Body.Close() })
+
+		b, cErr := io.ReadAll(resp.Body)
+		require.NoError(t, cErr)
+
+		return string(b)
+	}
+
+	// The cookies set by the redirect are sent to its target.
+	body := roundTrip("-L", "-b", inPath, "-c", outPath, "-j", srv.URL+"/login")
+	require.Equal(t, "pre=0; id=1; keep=2", body)
+
+	// Session cookies are not written with --junk-session-cookies.
+	body = roundTrip("-b", outPath, srv.URL+"/home")
+	require.Equal(t, "keep=2", body)
+}
+
+func TestTransport_ntlm(t *testing.T) {
+	// The challenge message from MS-NLMP, section 4.2.4.3.
+	challenge, err := hex.DecodeString(
+		"4e544c4d53535000020000000c000c0038000000338a82e2" +
+			"0123456789abcdef00000000000000002400240044000000" +
+			"0000000000000000530065007200760065007200" +
+			"02000c0044006f006d00610069006e0001000c005300650072007600650072000000000000000000",
+	)
+	require.NoError(t, err)
+
+	var handshakeAddr string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		msg, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(r.Header.Get("Authorization"), "NTLM "))
+		switch {
+		case len(msg) < 12:
+			w.Header().Set("WWW-Authenticate", "NTLM")
+			w.WriteHeader(http.StatusUnauthorized)
+		case msg[8] == 1:
+			handshakeAddr = r.RemoteAddr
+			w.Header().Set("WWW-Authenticate", "NTLM "+base64.StdEncoding.EncodeToString(challenge))
+			w.WriteHeader(http.StatusUnauthorized)
+		case msg[8] == 3 && r.RemoteAddr == handshakeAddr:
+			_, _ = w.Write(append([]byte(r.Proto+" "), body...))
+		default:
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	out, err := output.NewOutput("", false)
+	require.NoError(t, err)
+
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	cfg := &config.Config{
+		RequestURL:  u,
+		Data:        []*config.DataPart{{Data: "a=b"}},
+		User:        url.UserPassword(`Domain\User`, "Password"),
+		AuthScheme:  "ntlm",
+		ForceHTTP11: true,
+	}
+
+	transport, err := client.NewTransport(cfg, out)
+	require.NoError(t, err)
+
+	req, err := client.NewRequest(cfg)
+	require.NoError(t, err)
+
+	resp, err := transport.RoundTrip(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = resp.Body.Close() })
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "HTTP/1.1 a=b", string(body))
+}
+
+func TestTransport_timings(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("test"))
+	})
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	tlsSrv := httptest.NewTLSServer(handler)
+	t.Cleanup(tlsSrv.Close)
+
+	out, err := output.NewOutput("", false)
+	require.NoError(t, err)
+
+	for _, srvURL := range []string{srv.URL, tlsSrv.URL} {
+		cfg, err := config.ParseConfig([]string{"-k", srvURL})
+		require.NoError(t, err)
+
+		transport, err := client.NewTransport(cfg, out)
+		require.NoError(t, err)
+
+		req, err := client.NewRequest(cfg)
+		require.NoError(t, err)
+
+		timings := output.NewTimings(time.Now())
+		req = req.WithContext(output.WithTimings(req.Context(), timings))
+
+		resp, err := transport.RoundTrip(req)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+
+		nameLookup := timings.Duration(output.PhaseNameLookup)
+		connect := timings.Duration(output.PhaseConnect)
+		appConnect := timings.Duration(output.PhaseAppConnect)
+
+		require.Positive(t, nameLookup)
+		require.GreaterOrEqual(t, connect, nameLookup)
+
+		if srvURL == srv.URL {
+			require.Zero(t, appConnect)
+		} else {
+			require.GreaterOrEqual(t, appConnect, connect)
+		}
+	}
+}
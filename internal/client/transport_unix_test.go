@@ -0,0 +1,83 @@
+//go:build unix
+
+package client_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/ameshkov/gocurl/internal/client"
+	"github.com/ameshkov/gocurl/internal/config"
+	"github.com/ameshkov/gocurl/internal/output"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransport_chunkedPipe(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		_, _ = fmt.Fprintf(w, "%v %d %s", r.TransferEncoding, r.ContentLength, b)
+	}))
+	t.Cleanup(srv.Close)
+
+	out, err := output.NewOutput("", false)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name   string
+		flag   string
+		prefix string
+		want   string
+	}{{
+		name: "upload_file",
+		flag: "-T",
+		want: "[chunked] -1 line 1\nline 2\n",
+	}, {
+		name:   "data_file",
+		flag:   "-d",
+		prefix: "@",
+		want:   "[chunked] -1 line 1line 2",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "pipe")
+			require.NoError(t, syscall.Mkfifo(path, 0o600))
+
+			go func() {
+				// Opening the pipe for writing blocks until it's opened for
+				// reading when the body is sent.
+				f, wErr := os.OpenFile(path, os.O_WRONLY, 0)
+				if wErr != nil {
+					return
+				}
+
+				_, _ = f.WriteString("line 1\nline 2\n")
+				_ = f.Close()
+			}()
+
+			cfg, err := config.ParseConfig([]string{tc.flag, tc.prefix + path, srv.URL + "/"})
+			require.NoError(t, err)
+
+			transport, err := client.NewTransport(cfg, out)
+			require.NoError(t, err)
+
+			req, err := client.NewRequest(cfg)
+			require.NoError(t, err)
+			require.Equal(t, int64(-1), req.ContentLength)
+
+			resp, err := transport.RoundTrip(req)
+			require.NoError(t, err)
+			t.Cleanup(func() { _ = resp.Body.Close() })
+
+			b, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			require.Equal(t, tc.want, string(b))
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/ameshkov/gocurl/internal/output"
+	"golang.org/x/net/html/charset"
+)
+
+// sniffLen is the number of bytes of an HTML body that are checked for the
+// <meta> tag with the charset, see the HTML encoding sniffing algorithm.
+const sniffLen = 1024
+
+// convertCharset returns a reader that converts the text body of resp to
+// UTF-8, see --charset-convert.  The charset is taken from the Content-Type
+// header or, for HTML documents, from the <meta> tags.  If the body is not a
+// text, is compressed, or is already UTF-8, body is returned as is.
+func convertCharset(resp *http.Response, body io.Reader, out *output.Output) (r io.Reader) {
+	contentType := resp.Header.Get("Content-Type")
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || !isText(mediaType) {
+		return body
+	}
+
+	if enc := resp.Header.Get("Content-Encoding"); enc != "" && enc != "identity" {
+		out.Debug("Not converting the charset of the body encoded with %s", enc)
+
+		return body
+	}
+
+	label := params["charset"]
+	if label == "" && mediaType == "text/html" {
+		br := bufio.NewReaderSize(body, sniffLen)
+		body = br
+
+		// Peek returns an error when the body is shorter, the data is still
+		// valid in this case.
+		b, _ := br.Peek(sniffLen)
+		var certain bool
+		_, label, certain = charset.DetermineEncoding(b, contentType)
+
+		// DetermineEncoding falls back to windows-1252 when nothing is
+		// declared, but gocurl only relies on the declared charset.
+		if !certain && !bytes.Contains(bytes.ToLower(b), []byte("charset")) {
+			label = ""
+		}
+	}
+
+	if label == "" {
+		return body
+	}
+
+	_, name := charset.Lookup(label)
+	switch name {
+	case "":
+		out.Debug("Unknown charset %q, not converting the body", label)
+
+		return body
+	case "utf-8":
+		return body
+	}
+
+	r, err = charset.NewReaderLabel(name, body)
+	if err != nil {
+		out.Debug("Failed to convert the body from %s: %v", name, err)
+
+		return body
+	}
+
+	out.Debug("Converting the body from %s to utf-8", name)
+
+	return r
+}
+
+// isText returns true if mediaType is a textual media type.
+func isText(mediaType string) (ok bool) {
+	switch mediaType {
+	case "application/json", "application/javascript", "application/xml":
+		return true
+	default:
+		return strings.HasPrefix(mediaType, "text/") ||
+			strings.HasSuffix(mediaType, "+xml") ||
+			strings.HasSuffix(mediaType, "+json")
+	}
+}
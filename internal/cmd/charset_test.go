@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ameshkov/gocurl/internal/output"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertCharset(t *testing.T) {
+	out, err := output.NewOutput("", false)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name        string
+		contentType string
+		body        string
+		want        string
+	}{{
+		name:        "latin1_header",
+		contentType: "text/plain; charset=ISO-8859-1",
+		body:        "caf\xe9",
+		want:        "café",
+	}, {
+		name:        "gbk_header",
+		contentType: "application/json; charset=gbk",
+		body:        "\"\xc4\xe3\xba\xc3\"",
+		want:        "\"你好\"",
+	}, {
+		name:        "cp1251_meta",
+		contentType: "text/html",
+		body:        `<meta charset="windows-1251"><p>` + "\xcf\xf0\xe8\xe2\xe5\xf2",
+		want:        `<meta charset="windows-1251"><p>Привет`,
+	}, {
+		name:        "html_undeclared",
+		contentType: "text/html",
+		body:        "<p>caf\xe9",
+		want:        "<p>caf\xe9",
+	}, {
+		name:        "utf8",
+		contentType: "text/plain; charset=utf-8",
+		body:        "café",
+		want:        "café",
+	}, {
+		name:        "binary",
+		contentType: "image/png; charset=iso-8859-1",
+		body:        "\x89PNG\xe9",
+		want:        "\x89PNG\xe9",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := &http.Response{Header: http.Header{"Content-Type": {tc.contentType}}}
+
+			b, readErr := io.ReadAll(convertCharset(resp, strings.NewReader(tc.body), out))
+			require.NoError(t, readErr)
+			require.Equal(t, tc.want, string(b))
+		})
+	}
+}
@@ -2,18 +2,18 @@
 package cmd
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
-	"io"
-	"net/http"
 	"os"
+	"path/filepath"
 
+	"github.com/ameshkov/gocurl/internal/bench"
 	"github.com/ameshkov/gocurl/internal/client"
-	"github.com/ameshkov/gocurl/internal/client/websocket"
+	"github.com/ameshkov/gocurl/internal/compare"
 	"github.com/ameshkov/gocurl/internal/config"
 	"github.com/ameshkov/gocurl/internal/output"
 	"github.com/ameshkov/gocurl/internal/version"
+	"github.com/ameshkov/gocurl/internal/watch"
 	goFlags "github.com/jessevdk/go-flags"
 )
 
@@ -25,7 +25,33 @@ func Main() {
 		os.Exit(0)
 	}
 
-	cfg, err := config.ParseConfig()
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		// "gocurl config ..." is a special command that does not make any
+		// requests, see runConfig.
+		os.Exit(runConfig(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] == "tls" {
+		// "gocurl tls [OPTIONS] host:port" is a shortcut for --connect-only.
+		args = append([]string{"--connect-only"}, args[1:]...)
+	}
+
+	if len(args) > 2 && args[0] == "diff" {
+		// "gocurl diff [OPTIONS] URL1 URL2" is a shortcut for --compare-with,
+		// the URLs must be the last arguments.
+		last := len(args) - 1
+		args = append(append([]string{}, args[1:last]...), "--compare-with", args[last])
+	}
+
+	// "gocurl shell [OPTIONS] <URL>" starts the interactive session, see
+	// runShell.
+	shell := len(args) > 0 && args[0] == "shell"
+	if shell {
+		args = args[1:]
+	}
+
+	cfg, err := config.ParseConfig(args)
 	var flagErr *goFlags.Error
 	if errors.As(err, &flagErr) && flagErr.Type == goFlags.ErrHelp {
 		// This is a special case when we exit process here as we received
@@ -36,84 +62,125 @@ func Main() {
 	if err != nil {
 		_, _ = os.Stderr.WriteString(fmt.Sprintf("Failed to parse args: %v", err))
 
-		os.Exit(1)
+		os.Exit(exitCodeUsage)
+	}
+
+	err = cfg.LoadWriteOut()
+	if err != nil {
+		_, _ = os.Stderr.WriteString(fmt.Sprintf("Failed to parse args: %v", err))
+
+		os.Exit(exitCodeUsage)
+	}
+
+	if cfg.CreateDirs && cfg.OutputPath != "" {
+		err = os.MkdirAll(filepath.Dir(cfg.OutputPath), 0o755)
+		if err != nil {
+			_, _ = os.Stderr.WriteString(fmt.Sprintf("Failed to create output directory: %v", err))
+
+			os.Exit(1)
+		}
+	}
+
+	newOutput := output.NewOutput
+	if cfg.ContinueAt > 0 {
+		newOutput = output.NewAppendOutput
 	}
 
-	out, err := output.NewOutput(cfg.OutputPath, cfg.Verbose)
+	out, err := newOutput(cfg.OutputPath, cfg.Verbose)
 	if err != nil {
 		panic(err)
 	}
 
 	out.Debug("Starting gocurl %s with arguments:\n%s", version.Version(), cfg.RawOptions)
 
-	transport, err := client.NewTransport(cfg, out)
-	if err != nil {
-		out.Info("Failed to create HTTP transport: %v", err)
+	if cfg.MetricsFile != "" {
+		err = out.OpenMetricsFile(cfg.MetricsFile)
+		if err != nil {
+			out.Info("%v", err)
 
-		os.Exit(1)
+			os.Exit(1)
+		}
 	}
 
-	req, err := client.NewRequest(cfg)
+	if cfg.DumpHeader != "" {
+		err = out.OpenDumpHeaderFile(cfg.DumpHeader)
+		if err != nil {
+			out.Info("%v", err)
 
-	if err != nil {
-		out.Info("Failed to create request: %v", err)
+			os.Exit(1)
+		}
+	}
 
+	if cfg.User != nil {
+		cfg.User, err = promptPassword(cfg.User, os.Stdin, os.Stderr)
+		if err != nil {
+			out.Info("%v", err)
+
+			os.Exit(1)
+		}
+	}
+
+	if u := cfg.RequestURL; u.User != nil && cfg.User == nil && u.Scheme != "mqtt" && u.Scheme != "mqtts" {
+		out.Info("Warning: using credentials from the URL for Basic authentication")
+	}
+
+	if shell {
+		os.Exit(runShell(cfg, out, os.Stdin, os.Stderr))
+	}
+
+	if cfg.GenerateGoFile != "" && generateGo(cfg, out) != nil {
 		os.Exit(1)
 	}
 
-	// This is a strange thing, but for the sake of logging WITH the request
-	// body it is easier to create a second request.
-	//
-	// TODO(ameshkov): refactor this.
-	cloneReq, _ := client.NewRequest(cfg)
-	out.DebugRequest(cloneReq)
+	if cfg.ConnectOnly {
+		// Raw mode, only establish the connection, no HTTP requests are
+		// made.
+		os.Exit(errorExitCode(connect(cfg, out)))
+	}
+
+	if cfg.RequestURL.Scheme == "mqtt" || cfg.RequestURL.Scheme == "mqtts" {
+		// MQTT is not HTTP-based, it uses its own client.
+		os.Exit(errorExitCode(transferMQTT(cfg, out)))
+	}
 
-	resp, err := transport.RoundTrip(req)
+	transport, err := client.NewTransport(cfg, out)
 	if err != nil {
-		out.Info("Failed to make request: %v", err)
+		out.Info("Failed to create HTTP transport: %v", err)
 
-		os.Exit(1)
+		os.Exit(errorExitCode(err))
 	}
 
-	defer func(body io.ReadCloser) {
-		_ = body.Close()
-	}(resp.Body)
-
-	// Response body is only written when we're sure that it is there.
-	var responseBody io.Reader
-	if resp.ProtoMajor >= 2 ||
-		resp.ContentLength > 0 ||
-		len(resp.TransferEncoding) > 0 ||
-		resp.Header.Get("Connection") == "close" {
-		responseBody = resp.Body
-	}
-	if req.Method == http.MethodHead {
-		responseBody = nil
-	}
-
-	out.DebugResponse(resp)
-
-	// WebSocket is processed differently. If request body is supplied with the
-	// "data" command-line argument, it is sent as a text frame, and then it
-	// waits until the response comes from the server.
-	if websocket.IsWebSocketResponse(resp) {
-		wsConn := websocket.NewWebSocket(transport.Conn(), out)
-		defer func() {
-			_ = wsConn.Close()
-		}()
-
-		if cfg.Data != "" {
-			_, wsErr := wsConn.Write([]byte(cfg.Data))
-			if wsErr == nil {
-				var b []byte
-				b, wsErr = io.ReadAll(wsConn)
-				if wsErr == nil {
-					responseBody = io.NopCloser(bytes.NewReader(b))
-				}
-			}
+	if cfg.CompareURL != nil {
+		// Comparison mode, print the differences instead of the response.
+		r := compare.Run(cfg, transport, out)
+		r.Write(out, cfg.OutputJSON)
+		if err = r.Err(); err != nil {
+			os.Exit(errorExitCode(err))
+		} else if !r.Equal {
+			os.Exit(exitCodeFailure)
 		}
+
+		os.Exit(0)
+	}
+
+	if cfg.Repeat > 0 {
+		// Benchmark mode, print the statistics instead of the response.
+		stats := bench.Run(cfg, transport, out)
+		stats.Write(out, cfg.OutputJSON)
+
+		os.Exit(errorExitCode(stats.Err))
+	}
+
+	if cfg.Interval > 0 {
+		// Watch mode, print a status line per attempt.
+		os.Exit(errorExitCode(watch.Run(cfg, transport, out)))
+	}
+
+	if len(cfg.RequestURLs) > 1 {
+		// Several URLs were specified, see --url-file.
+		os.Exit(errorExitCode(transferAll(cfg, transport, out)))
 	}
 
-	// Write the response contents to the output.
-	out.Write(resp, responseBody, cfg)
+	err = transfer(cfg, transport, out, retryFunc(cfg, out))
+	os.Exit(errorExitCode(err))
 }
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ameshkov/gocurl/internal/config"
+	goFlags "github.com/jessevdk/go-flags"
+)
+
+// runConfig implements the "gocurl config <check|dump> [OPTIONS]" command.
+// It parses and validates the command-line arguments without making any
+// request.  "check" only reports whether the configuration is valid, "dump"
+// also writes the resolved configuration in JSON format to stdout.  Returns
+// the exit code for the process.
+func runConfig(args []string, stdout, stderr io.Writer) (exitCode int) {
+	if len(args) == 0 || (args[0] != "check" && args[0] != "dump") {
+		_, _ = io.WriteString(stderr, "Usage: gocurl config <check|dump> [OPTIONS] <URL>\n")
+
+		return 1
+	}
+
+	cfg, err := config.ParseConfig(args[1:])
+	if err != nil {
+		var flagErr *goFlags.Error
+		if errors.As(err, &flagErr) {
+			// go-flags has already printed the error or the help message.
+			if flagErr.Type == goFlags.ErrHelp {
+				return 0
+			}
+
+			return 1
+		}
+
+		_, _ = fmt.Fprintf(stderr, "Invalid configuration: %v\n", err)
+
+		return 1
+	}
+
+	if args[0] == "check" {
+		_, _ = io.WriteString(stdout, "Configuration is valid\n")
+
+		return 0
+	}
+
+	b, err := cfg.Dump()
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "Failed to serialize configuration: %v\n", err)
+
+		return 1
+	}
+
+	_, _ = stdout.Write(append(b, '\n'))
+
+	return 0
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunConfig(t *testing.T) {
+	testCases := []struct {
+		name         string
+		args         []string
+		wantExitCode int
+		wantStdout   string
+		wantStderr   string
+	}{{
+		name:         "check_valid",
+		args:         []string{"check", "https://example.org/"},
+		wantExitCode: 0,
+		wantStdout:   "Configuration is valid",
+	}, {
+		name:         "dump_valid",
+		args:         []string{"dump", "-d", "password=secret", "https://example.org/"},
+		wantExitCode: 0,
+		wantStdout:   `"Data": "[redacted]"`,
+	}, {
+		name:         "no_subcommand",
+		args:         nil,
+		wantExitCode: 1,
+		wantStderr:   "Usage: gocurl config",
+	}, {
+		name:         "bad_subcommand",
+		args:         []string{"print", "https://example.org/"},
+		wantExitCode: 1,
+		wantStderr:   "Usage: gocurl config",
+	}, {
+		name:         "invalid_arguments",
+		args:         []string{"check", "--tls-max", "1.0", "https://example.org/"},
+		wantExitCode: 1,
+		wantStderr:   "Invalid configuration: unsupported tls-max value: 1.0",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stdout := &bytes.Buffer{}
+			stderr := &bytes.Buffer{}
+
+			exitCode := runConfig(tc.args, stdout, stderr)
+			require.Equal(t, tc.wantExitCode, exitCode)
+			require.Contains(t, stdout.String(), tc.wantStdout)
+			require.Contains(t, stderr.String(), tc.wantStderr)
+		})
+	}
+}
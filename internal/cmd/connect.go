@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+
+	"github.com/ameshkov/gocurl/internal/client"
+	"github.com/ameshkov/gocurl/internal/config"
+	"github.com/ameshkov/gocurl/internal/output"
+)
+
+// connect implements the raw mode, see --connect-only.  It establishes the
+// connection, prints the TLS information if it is a TLS connection and the
+// timings, and then bridges stdin/stdout to the connection until the server
+// closes it.  With --json-output, the information is written to the output
+// instead and the connection is closed.  Errors are logged and returned.
+func connect(cfg *config.Config, out *output.Output) (err error) {
+	r, err := client.Connect(cfg, out)
+	if err != nil {
+		out.Info("Failed to connect to %s: %v", cfg.RequestURL.Host, err)
+
+		return err
+	}
+
+	if r.TLS != nil {
+		out.InfoTLS(r.TLS)
+	}
+
+	conn := r.Conn
+	if cfg.OutputJSON || conn == nil {
+		if conn != nil {
+			_ = conn.Close()
+		}
+
+		writeConnectResult(r, out, cfg.OutputJSON)
+
+		return nil
+	}
+	defer func() { _ = conn.Close() }()
+
+	out.Info("\n----\nConnected to %s\nTimings: %s", conn.RemoteAddr(), r.Timings)
+
+	go func() {
+		_, _ = io.Copy(conn, os.Stdin)
+
+		// Signal the server that there will be no more data, but keep
+		// reading the response.
+		if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+			_ = cw.CloseWrite()
+		}
+	}()
+
+	_, err = io.Copy(writerFunc(out.WriteRaw), conn)
+	if err != nil && !errors.Is(err, net.ErrClosed) {
+		out.Info("Failed to read from %s: %v", conn.RemoteAddr(), err)
+
+		return err
+	}
+
+	return nil
+}
+
+// writeConnectResult writes the information about the connection that is not
+// bridged to the output.
+func writeConnectResult(r *client.ConnectResult, out *output.Output, outputJSON bool) {
+	if !outputJSON {
+		out.WriteRaw([]byte(fmt.Sprintf("Connected to %s (%s)\nTimings: %s\n", r.RemoteAddr, r.Proto, r.Timings)))
+
+		return
+	}
+
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+
+	out.WriteRaw(b)
+}
+
+// writerFunc is an io.Writer that passes the data to a function.
+type writerFunc func(b []byte)
+
+// type check
+var _ io.Writer = writerFunc(nil)
+
+// Write implements the io.Writer interface for writerFunc.
+func (f writerFunc) Write(b []byte) (n int, err error) {
+	f(b)
+
+	return len(b), nil
+}
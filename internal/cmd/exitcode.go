@@ -0,0 +1,173 @@
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+
+	"github.com/ameshkov/gocurl/internal/client"
+	"github.com/ameshkov/gocurl/internal/output"
+	"github.com/ameshkov/gocurl/internal/resolve"
+)
+
+// Exit codes of the failed transfers.  They are the same as curl's ones so
+// that gocurl could replace it in scripts.
+const (
+	// exitCodeFailure is the exit code of the errors that don't have a more
+	// specific one.
+	exitCodeFailure = 1
+
+	// exitCodeUsage is the exit code when the command-line arguments are
+	// invalid, CURLE_FAILED_INIT.
+	exitCodeUsage = 2
+
+	// exitCodeResolve is the exit code when the hostname could not be
+	// resolved, CURLE_COULDNT_RESOLVE_HOST.
+	exitCodeResolve = 6
+
+	// exitCodeConnect is the exit code when the connection could not be
+	// established, CURLE_COULDNT_CONNECT.
+	exitCodeConnect = 7
+
+	// exitCodePartialFile is the exit code when the connection was closed
+	// before the whole response was received, CURLE_PARTIAL_FILE.
+	exitCodePartialFile = 18
+
+	// exitCodeHTTPError is the exit code when the response status is an error
+	// and --fail is used, CURLE_HTTP_RETURNED_ERROR.
+	exitCodeHTTPError = 22
+
+	// exitCodeWrite is the exit code when the received data could not be
+	// written, CURLE_WRITE_ERROR.
+	exitCodeWrite = 23
+
+	// exitCodeTimeout is the exit code when any of the timeouts expired or the
+	// transfer is slower than --speed-limit, CURLE_OPERATION_TIMEDOUT.
+	exitCodeTimeout = 28
+
+	// exitCodeRange is the exit code when the download cannot be resumed, see
+	// --continue-at, CURLE_RANGE_ERROR.
+	exitCodeRange = 33
+
+	// exitCodeTLS is the exit code when the TLS handshake failed,
+	// CURLE_SSL_CONNECT_ERROR.
+	exitCodeTLS = 35
+
+	// exitCodeTooManyRedirects is the exit code when --max-redirs is
+	// exceeded, CURLE_TOO_MANY_REDIRECTS.
+	exitCodeTooManyRedirects = 47
+
+	// exitCodeVerify is the exit code when the server certificate could not
+	// be verified, CURLE_PEER_FAILED_VERIFICATION.
+	exitCodeVerify = 60
+
+	// exitCodePinnedPubKey is the exit code when the server public key does
+	// not match --pinnedpubkey, CURLE_SSL_PINNEDPUBKEYNOTMATCH.
+	exitCodePinnedPubKey = 90
+
+	// exitCodeCertStatus is the exit code when --cert-status is used and the
+	// stapled OCSP response is missing or bad, CURLE_SSL_INVALIDCERTSTATUS.
+	exitCodeCertStatus = 91
+
+	// exitCodeTooLarge is the exit code when the response header exceeds
+	// --max-header-size, CURLE_TOO_LARGE.
+	exitCodeTooLarge = 100
+)
+
+// errorExitCode returns the exit code for the error of the transfer.  The
+// order matters as the errors may wrap each other, e.g. a timeout is also a
+// net.Error of the dial.
+func errorExitCode(err error) (code int) {
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, client.ErrHeaderTooLarge):
+		return exitCodeTooLarge
+	case errors.Is(err, errHTTPStatus):
+		return exitCodeHTTPError
+	case errors.Is(err, errResume):
+		return exitCodeRange
+	case errors.Is(err, output.ErrWrite):
+		return exitCodeWrite
+	case isTimeout(err):
+		return exitCodeTimeout
+	case errors.Is(err, client.ErrTooManyRedirects):
+		return exitCodeTooManyRedirects
+	case errors.Is(err, client.ErrPinnedPubKey):
+		return exitCodePinnedPubKey
+	case errors.Is(err, client.ErrCertStatus):
+		return exitCodeCertStatus
+	case output.IsVerifyError(err), errors.Is(err, client.ErrCertRevoked):
+		return exitCodeVerify
+	case isTLSError(err):
+		return exitCodeTLS
+	case isResolveError(err):
+		return exitCodeResolve
+	case isConnectError(err):
+		return exitCodeConnect
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return exitCodePartialFile
+	default:
+		return exitCodeFailure
+	}
+}
+
+// isTimeout returns true if err is caused by any of the timeouts or by a too
+// slow transfer.
+func isTimeout(err error) (ok bool) {
+	if errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, client.ErrTooSlow) ||
+		errors.Is(err, client.ErrReadTimeout) ||
+		errors.Is(err, client.ErrResponseHeaderTimeout) ||
+		errors.Is(err, client.ErrHandshakeTimeout) ||
+		errors.Is(err, resolve.ErrTimeout) {
+		return true
+	}
+
+	var netErr net.Error
+
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// isTLSError returns true if err is caused by a failed TLS handshake.  The
+// handshakes made with the fork of crypto/tls return its own error types so
+// the error message is checked as well.
+func isTLSError(err error) (ok bool) {
+	var alertErr tls.AlertError
+	var recordErr tls.RecordHeaderError
+	if errors.As(err, &alertErr) || errors.As(err, &recordErr) {
+		return true
+	}
+
+	return strings.Contains(err.Error(), "tls: ")
+}
+
+// isResolveError returns true if the hostname could not be resolved.  The
+// resolver of gocurl returns resolve.ErrEmptyResponse for all the failed
+// lookups.
+func isResolveError(err error) (ok bool) {
+	if errors.Is(err, resolve.ErrEmptyResponse) {
+		return true
+	}
+
+	var dnsErr *net.DNSError
+
+	return errors.As(err, &dnsErr)
+}
+
+// isConnectError returns true if the connection could not be established.
+func isConnectError(err error) (ok bool) {
+	if errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EHOSTUNREACH) ||
+		errors.Is(err, syscall.ENETUNREACH) {
+		return true
+	}
+
+	var opErr *net.OpError
+
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/ameshkov/gocurl/internal/client"
+	"github.com/ameshkov/gocurl/internal/output"
+	"github.com/ameshkov/gocurl/internal/resolve"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorExitCode(t *testing.T) {
+	dialErr := func(err error) (res error) {
+		return fmt.Errorf("request: %w", &net.OpError{Op: "dial", Net: "tcp", Err: err})
+	}
+
+	testCases := []struct {
+		name string
+		err  error
+		want int
+	}{{
+		name: "nil",
+		err:  nil,
+		want: 0,
+	}, {
+		name: "other",
+		err:  errors.New("test"),
+		want: exitCodeFailure,
+	}, {
+		name: "resolve",
+		err:  dialErr(&net.DNSError{Err: "no such host", Name: "example.invalid"}),
+		want: exitCodeResolve,
+	}, {
+		name: "resolve_empty",
+		err:  dialErr(errors.Join(resolve.ErrEmptyResponse, errors.New("NXDOMAIN"))),
+		want: exitCodeResolve,
+	}, {
+		name: "resolve_timeout",
+		err:  fmt.Errorf("resolving example.org: %w after 1s", resolve.ErrTimeout),
+		want: exitCodeTimeout,
+	}, {
+		name: "connect",
+		err:  dialErr(syscall.ECONNREFUSED),
+		want: exitCodeConnect,
+	}, {
+		name: "connect_timeout",
+		err:  dialErr(context.DeadlineExceeded),
+		want: exitCodeTimeout,
+	}, {
+		name: "too_slow",
+		err:  fmt.Errorf("%w: test", client.ErrTooSlow),
+		want: exitCodeTimeout,
+	}, {
+		name: "tls",
+		err:  fmt.Errorf("handshake: %w", tls.AlertError(40)),
+		want: exitCodeTLS,
+	}, {
+		name: "verify",
+		err:  &tls.CertificateVerificationError{Err: x509.UnknownAuthorityError{}},
+		want: exitCodeVerify,
+	}, {
+		name: "pinned_pub_key",
+		err:  fmt.Errorf("handshake: %w", client.ErrPinnedPubKey),
+		want: exitCodePinnedPubKey,
+	}, {
+		name: "cert_status",
+		err:  fmt.Errorf("handshake: %w: no stapled ocsp response", client.ErrCertStatus),
+		want: exitCodeCertStatus,
+	}, {
+		name: "cert_revoked",
+		err:  fmt.Errorf("handshake: %w: CN=example.org", client.ErrCertRevoked),
+		want: exitCodeVerify,
+	}, {
+		name: "http",
+		err:  fmt.Errorf("%w: 404 Not Found", errHTTPStatus),
+		want: exitCodeHTTPError,
+	}, {
+		name: "resume",
+		err:  fmt.Errorf("%w from 5: server doesn't support byte ranges", errResume),
+		want: exitCodeRange,
+	}, {
+		name: "write",
+		err:  fmt.Errorf("%w: %w", output.ErrWrite, syscall.ENOSPC),
+		want: exitCodeWrite,
+	}, {
+		name: "partial",
+		err:  io.ErrUnexpectedEOF,
+		want: exitCodePartialFile,
+	}, {
+		name: "redirects",
+		err:  fmt.Errorf("%w: maximum (1) followed", client.ErrTooManyRedirects),
+		want: exitCodeTooManyRedirects,
+	}, {
+		name: "too_large",
+		err:  fmt.Errorf("%w: test", client.ErrHeaderTooLarge),
+		want: exitCodeTooLarge,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.want, errorExitCode(tc.err))
+		})
+	}
+}
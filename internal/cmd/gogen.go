@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ameshkov/gocurl/internal/config"
+	"github.com/ameshkov/gocurl/internal/gogen"
+	"github.com/ameshkov/gocurl/internal/output"
+)
+
+// generateGo implements --generate-go.  It writes the Go program that makes
+// the same request to cfg.GenerateGoFile.  Errors are logged and returned.
+func generateGo(cfg *config.Config, out *output.Output) (err error) {
+	src, err := gogen.Generate(cfg)
+	if err == nil {
+		if cfg.GenerateGoFile == "-" {
+			_, err = os.Stdout.Write(src)
+		} else {
+			err = os.WriteFile(cfg.GenerateGoFile, src, 0o644)
+		}
+	}
+
+	if err != nil {
+		err = fmt.Errorf("generating go code: %w", err)
+		out.Info("%v", err)
+
+		return err
+	}
+
+	out.Debug("Go code is written to %s", cfg.GenerateGoFile)
+
+	return nil
+}
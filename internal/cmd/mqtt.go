@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/ameshkov/gocurl/internal/client"
+	"github.com/ameshkov/gocurl/internal/client/mqtt"
+	"github.com/ameshkov/gocurl/internal/config"
+	"github.com/ameshkov/gocurl/internal/output"
+)
+
+// transferMQTT implements mqtt:// and mqtts:// URLs.  The topic is taken from
+// the URL path.  If --data is specified, it is published to the topic,
+// otherwise gocurl subscribes to the topic and writes the received messages to
+// the output, one per line.  Errors are logged and returned.
+func transferMQTT(cfg *config.Config, out *output.Output) (err error) {
+	r, err := client.Connect(cfg, out)
+	if err != nil {
+		out.Info("Failed to connect to %s: %v", cfg.RequestURL.Host, err)
+
+		return err
+	}
+
+	c := mqtt.NewClient(r.Conn, out)
+	defer func() { _ = c.Close() }()
+
+	var username, password string
+	if u := cfg.RequestURL.User; u != nil {
+		username = u.Username()
+		password, _ = u.Password()
+	}
+
+	err = c.Connect(newMQTTClientID(), username, password)
+	if err != nil {
+		out.Info("Failed to connect to MQTT broker %s: %v", cfg.RequestURL.Host, err)
+
+		return err
+	}
+
+	topic := strings.TrimPrefix(cfg.RequestURL.Path, "/")
+	if cfg.HasData() {
+		var data []byte
+		data, err = cfg.ReadData()
+		if err == nil {
+			err = c.Publish(topic, data)
+		}
+
+		if err != nil {
+			out.Info("Failed to publish to %s: %v", topic, err)
+		}
+
+		return err
+	}
+
+	err = c.Subscribe(topic)
+	if err != nil {
+		out.Info("Failed to subscribe to %s: %v", topic, err)
+
+		return err
+	}
+
+	for {
+		var msg *mqtt.Message
+		msg, err = c.ReadMessage()
+		if err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+
+			out.Info("Failed to read MQTT message: %v", err)
+
+			return err
+		}
+
+		out.Debug("Received MQTT message of len=%d on topic %s", len(msg.Payload), msg.Topic)
+		out.WriteRaw(append(msg.Payload, '\n'))
+	}
+}
+
+// newMQTTClientID returns a random MQTT client identifier.
+func newMQTTClientID() (id string) {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+
+	return "gocurl-" + hex.EncodeToString(b)
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// promptPassword asks for the password of the user from --user if it was not
+// specified.  The password is read from the terminal without echoing it or
+// as the first line of stdin if it is not a terminal.
+func promptPassword(user *url.Userinfo, in *os.File, w io.Writer) (res *url.Userinfo, err error) {
+	if _, ok := user.Password(); ok {
+		return user, nil
+	}
+
+	_, _ = fmt.Fprintf(w, "Enter host password for user '%s':", user.Username())
+	defer func() { _, _ = fmt.Fprintln(w) }()
+
+	var password string
+	if fd := int(in.Fd()); term.IsTerminal(fd) {
+		var b []byte
+		b, err = term.ReadPassword(fd)
+		password = string(b)
+	} else {
+		password, err = bufio.NewReader(in).ReadString('\n')
+		if err == io.EOF && password != "" {
+			err = nil
+		}
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("reading password: %w", err)
+	}
+
+	return url.UserPassword(user.Username(), strings.TrimRight(password, "\r\n")), nil
+}
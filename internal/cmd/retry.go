@@ -0,0 +1,236 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/ameshkov/gocurl/internal/client"
+	"github.com/ameshkov/gocurl/internal/config"
+	"github.com/ameshkov/gocurl/internal/output"
+)
+
+const (
+	// initialRetryDelay is the delay before the first retry, it is doubled
+	// for every next retry unless --retry-delay is set.
+	initialRetryDelay = 1 * time.Second
+
+	// maxRetryDelay is the maximum delay between the retries, it is the same
+	// as in curl.
+	maxRetryDelay = 10 * time.Minute
+)
+
+// retrier decides whether the request should be retried, see --retry.
+type retrier struct {
+	out *output.Output
+	cfg *config.Config
+
+	// start is the time of the first attempt.
+	start time.Time
+
+	// delay is the delay before the next retry.
+	delay time.Duration
+
+	// left is the number of retries left.
+	left int
+}
+
+// newRetrier returns a new *retrier for cfg.  It returns nil if --retry is
+// not set.
+func newRetrier(cfg *config.Config, out *output.Output) (r *retrier) {
+	if cfg.Retry == 0 {
+		return nil
+	}
+
+	delay := cfg.RetryDelay
+	if delay == 0 {
+		delay = initialRetryDelay
+	}
+
+	return &retrier{
+		out:   out,
+		cfg:   cfg,
+		start: time.Now(),
+		delay: delay,
+		left:  cfg.Retry,
+	}
+}
+
+// retryFunc returns the retry function for transfer or nil if --retry is not
+// set.
+func retryFunc(
+	cfg *config.Config,
+	out *output.Output,
+) (retry func(ctx context.Context, resp *http.Response, err error) (ok bool)) {
+	r := newRetrier(cfg, out)
+	if r == nil {
+		return nil
+	}
+
+	return r.retry
+}
+
+// retry returns true if the attempt that ended with resp or err should be
+// retried.  In this case it logs the problem and waits before returning.  The
+// delay is limited by the deadline of ctx and false is returned if ctx is
+// done while waiting, see --max-time.
+func (r *retrier) retry(ctx context.Context, resp *http.Response, err error) (ok bool) {
+	if r.left == 0 {
+		return false
+	}
+
+	problem := r.problem(resp, err)
+	if problem == "" {
+		return false
+	}
+
+	delay := r.nextDelay(resp)
+	if r.cfg.RetryMaxTime > 0 && time.Since(r.start)+delay > r.cfg.RetryMaxTime {
+		return false
+	}
+
+	if deadline, hasDeadline := ctx.Deadline(); hasDeadline {
+		delay = max(min(delay, time.Until(deadline)), 0)
+	}
+
+	r.left--
+	r.out.Info(
+		"Warning: %s, will retry in %s, %d retries left",
+		problem,
+		delay,
+		r.left,
+	)
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// problem returns the description of the transient error of the attempt or
+// an empty string if it should not be retried.
+func (r *retrier) problem(resp *http.Response, err error) (problem string) {
+	if err != nil {
+		if r.cfg.RetryAllErrors ||
+			isTransientError(err) ||
+			r.cfg.RetryConnRefused && errors.Is(err, syscall.ECONNREFUSED) {
+			return fmt.Sprintf("request failed: %v", err)
+		}
+
+		return ""
+	}
+
+	if (r.cfg.RetryAllErrors && resp.StatusCode >= http.StatusBadRequest) || isTransientStatus(resp.StatusCode) {
+		return fmt.Sprintf("got %s", resp.Status)
+	}
+
+	return ""
+}
+
+// nextDelay returns the delay before the next retry and doubles the delay of
+// the following one unless it's fixed.  Retry-After of resp has priority.
+func (r *retrier) nextDelay(resp *http.Response) (delay time.Duration) {
+	if resp != nil {
+		if d, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+			return d
+		}
+	}
+
+	delay = r.delay
+	if r.cfg.RetryDelay == 0 {
+		r.delay = min(r.delay*2, maxRetryDelay)
+	}
+
+	return delay
+}
+
+// retryAfter parses the value of the Retry-After header which is either the
+// number of seconds or the HTTP date.
+func retryAfter(v string) (d time.Duration, ok bool) {
+	if v == "" {
+		return 0, false
+	}
+
+	if sec, err := strconv.ParseUint(v, 10, 32); err == nil {
+		return min(time.Duration(sec)*time.Second, maxRetryDelay), true
+	}
+
+	t, err := http.ParseTime(v)
+	if err != nil {
+		return 0, false
+	}
+
+	return min(max(time.Until(t), 0), maxRetryDelay), true
+}
+
+// isTransientError returns true if err is a timeout, a too slow transfer or a
+// temporary DNS failure.
+func isTransientError(err error) (ok bool) {
+	if errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, client.ErrResponseHeaderTimeout) ||
+		errors.Is(err, client.ErrTooSlow) {
+		return true
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTemporary || dnsErr.IsTimeout
+	}
+
+	var netErr net.Error
+
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// isTransientStatus returns true if the response with the status code should
+// be retried, the codes are the same as in curl.
+func isTransientStatus(code int) (ok bool) {
+	switch code {
+	case
+		http.StatusRequestTimeout,
+		http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// saveStdin saves the request body from stdin to a temporary file so that it
+// can be sent again when the request is retried.  Returns the copy of cfg that
+// reads the body from the file and the function that removes it.
+func saveStdin(cfg *config.Config) (res *config.Config, cleanup func(), err error) {
+	f, err := os.CreateTemp("", "gocurl-stdin-*")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cleanup = func() {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+	}
+
+	_, err = io.Copy(f, os.Stdin)
+	if err != nil {
+		cleanup()
+
+		return nil, nil, err
+	}
+
+	return cfg.WithStdinFile(f.Name()), cleanup, nil
+}
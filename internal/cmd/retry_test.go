@@ -0,0 +1,208 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ameshkov/gocurl/internal/client"
+	"github.com/ameshkov/gocurl/internal/config"
+	"github.com/ameshkov/gocurl/internal/output"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransfer_retry(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := hits.Add(1)
+		switch {
+		case r.URL.Path == "/fail":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case r.URL.Path == "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case n < 3:
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			_, _ = w.Write([]byte("ok"))
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	testCases := []struct {
+		name     string
+		path     string
+		args     []string
+		wantHits int32
+	}{{
+		name:     "success",
+		path:     "/",
+		args:     []string{"--retry", "3"},
+		wantHits: 3,
+	}, {
+		name:     "exhausted",
+		path:     "/fail",
+		args:     []string{"--retry", "2"},
+		wantHits: 3,
+	}, {
+		name:     "not_transient",
+		path:     "/missing",
+		args:     []string{"--retry", "2"},
+		wantHits: 1,
+	}, {
+		name:     "all_errors",
+		path:     "/missing",
+		args:     []string{"--retry", "2", "--retry-all-errors"},
+		wantHits: 3,
+	}, {
+		name:     "max_time",
+		path:     "/fail",
+		args:     []string{"--retry", "2", "--retry-max-time", "1ms"},
+		wantHits: 1,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			hits.Store(0)
+
+			args := append(tc.args, "--retry-delay", "10ms", srv.URL+tc.path)
+			cfg, err := config.ParseConfig(args)
+			require.NoError(t, err)
+
+			out, err := output.NewOutput(filepath.Join(t.TempDir(), "out"), false)
+			require.NoError(t, err)
+
+			transport, err := client.NewTransport(cfg, out)
+			require.NoError(t, err)
+
+			err = transfer(cfg, transport, out, retryFunc(cfg, out))
+			require.NoError(t, err)
+			require.Equal(t, tc.wantHits, hits.Load())
+		})
+	}
+}
+
+func TestTransfer_retryConnRefused(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	u := srv.URL
+	srv.Close()
+
+	out, err := output.NewOutput(filepath.Join(t.TempDir(), "out"), false)
+	require.NoError(t, err)
+
+	for _, connRefused := range []bool{false, true} {
+		args := []string{"--retry", "2", "--retry-delay", "1ms", u}
+		if connRefused {
+			args = append(args, "--retry-connrefused")
+		}
+
+		cfg, pErr := config.ParseConfig(args)
+		require.NoError(t, pErr)
+
+		transport, pErr := client.NewTransport(cfg, out)
+		require.NoError(t, pErr)
+
+		attempts := 0
+		retry := retryFunc(cfg, out)
+		err = transfer(cfg, transport, out, func(ctx context.Context, resp *http.Response, err error) (ok bool) {
+			attempts++
+
+			return retry(ctx, resp, err)
+		})
+		require.Error(t, err)
+
+		if connRefused {
+			require.Equal(t, 3, attempts)
+		} else {
+			require.Equal(t, 1, attempts)
+		}
+	}
+}
+
+func TestTransfer_retryMaxTime(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(srv.Close)
+
+	out, err := output.NewOutput(filepath.Join(t.TempDir(), "out"), false)
+	require.NoError(t, err)
+
+	cfg, err := config.ParseConfig([]string{"--retry", "3", "--max-time", "200ms", srv.URL})
+	require.NoError(t, err)
+
+	transport, err := client.NewTransport(cfg, out)
+	require.NoError(t, err)
+
+	// The delay from Retry-After is limited by --max-time.
+	start := time.Now()
+	err = transfer(cfg, transport, out, retryFunc(cfg, out))
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.ErrorContains(t, err, "operation timed out after 200ms")
+	require.Less(t, time.Since(start), 2*time.Second)
+	require.LessOrEqual(t, hits.Load(), int32(2))
+}
+
+func TestTransfer_retryStdinBody(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// HTTP/1.x handlers must read the whole body before writing.
+		b, _ := io.ReadAll(r.Body)
+		if hits.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+
+			return
+		}
+
+		_, _ = w.Write(b)
+	}))
+	t.Cleanup(srv.Close)
+
+	for _, args := range [][]string{{"-d", "@-"}, {"-T", "-"}} {
+		t.Run(args[0], func(t *testing.T) {
+			hits.Store(0)
+			setStdin(t, "a=1")
+
+			path := filepath.Join(t.TempDir(), "out")
+			out, err := output.NewOutput(path, false)
+			require.NoError(t, err)
+
+			args = append(args, "-X", http.MethodPost, "--retry", "1", "--retry-delay", "1ms", srv.URL)
+			cfg, err := config.ParseConfig(args)
+			require.NoError(t, err)
+
+			transport, err := client.NewTransport(cfg, out)
+			require.NoError(t, err)
+
+			err = transfer(cfg, transport, out, retryFunc(cfg, out))
+			require.NoError(t, err)
+			require.Equal(t, int32(2), hits.Load())
+
+			// The retry sends the same body.
+			b, err := os.ReadFile(path)
+			require.NoError(t, err)
+			require.Equal(t, "a=1", string(b))
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	d, ok := retryAfter("5")
+	require.True(t, ok)
+	require.Equal(t, 5*time.Second, d)
+
+	d, ok = retryAfter(time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat))
+	require.True(t, ok)
+	require.Zero(t, d)
+
+	_, ok = retryAfter("soon")
+	require.False(t, ok)
+}
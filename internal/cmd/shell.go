@@ -0,0 +1,277 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ameshkov/gocurl/internal/client"
+	"github.com/ameshkov/gocurl/internal/config"
+	"github.com/ameshkov/gocurl/internal/output"
+)
+
+// shellPrompt is the prompt that is written before reading every command.
+const shellPrompt = "gocurl> "
+
+// shellHelp is the help message of the interactive shell.
+const shellHelp = `Commands:
+  [METHOD] <URL> [data]  sends a request, URL may be relative to the base URL
+  header <name>: <value> adds a header to every request
+  header -<name>         removes the header
+  headers                lists the headers
+  history                lists the entered commands
+  !<N>                   repeats the command number N from the history
+  help                   prints this message
+  exit                   exits the shell
+`
+
+// shell is the interactive session, see runShell.
+type shell struct {
+	cfg       *config.Config
+	transport client.Transport
+	out       *output.Output
+
+	// w is where the prompt, the status lines, and the command output are
+	// written.
+	w io.Writer
+
+	// headers are added to every request.
+	headers http.Header
+
+	// history is the list of the entered commands.
+	history []string
+}
+
+// runShell implements the "gocurl shell [OPTIONS] <URL>" command.  It reads
+// commands from in until EOF or "exit" and sends the requests using the same
+// transport and cookie jar so that the connections and cookies are reused.
+// The request URLs are resolved relative to cfg.RequestURL.  Prompts and
+// status lines are written to w, response bodies are written to out.  Returns
+// the exit code for the process.
+func runShell(cfg *config.Config, out *output.Output, in io.Reader, w io.Writer) (exitCode int) {
+	err := validateShell(cfg)
+	if err != nil {
+		out.Info("%v", err)
+
+		return 1
+	}
+
+	transport, err := client.NewTransport(cfg, out)
+	if err != nil {
+		out.Info("Failed to create HTTP transport: %v", err)
+
+		return 1
+	}
+
+	// The cookies are kept by the transport itself if --session is used.
+	var jar http.CookieJar
+	if cfg.SessionFile == "" {
+		// cookiejar.New never returns an error when options are nil.
+		jar, _ = cookiejar.New(nil)
+	}
+
+	s := &shell{
+		cfg: cfg,
+		transport: &sessionTransport{
+			Transport: transport,
+			jar:       jar,
+			w:         w,
+		},
+		out:     out,
+		w:       w,
+		headers: cfg.Headers.Clone(),
+	}
+
+	if s.headers == nil {
+		s.headers = http.Header{}
+	}
+
+	s.run(bufio.NewScanner(in))
+
+	return 0
+}
+
+// validateShell returns an error if cfg cannot be used with the shell.
+func validateShell(cfg *config.Config) (err error) {
+	switch {
+	case cfg.ConnectOnly:
+		return fmt.Errorf("shell cannot be used with --connect-only")
+	case len(cfg.RequestURLs) > 1:
+		return fmt.Errorf("shell cannot be used with several URLs")
+	case cfg.Repeat > 0, cfg.Interval > 0:
+		return fmt.Errorf("shell cannot be used with --repeat or --interval")
+	case cfg.RequestURL.Scheme == "mqtt", cfg.RequestURL.Scheme == "mqtts":
+		return fmt.Errorf("shell cannot be used with %s URLs", cfg.RequestURL.Scheme)
+	default:
+		return nil
+	}
+}
+
+// run reads and executes commands until EOF or "exit".
+func (s *shell) run(scanner *bufio.Scanner) {
+	s.printf("Base URL is %s, type \"help\" for the list of commands.\n", s.cfg.RequestURL)
+
+	for s.printf(shellPrompt); scanner.Scan(); s.printf(shellPrompt) {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "!") {
+			var ok bool
+			line, ok = s.fromHistory(line[1:])
+			if !ok {
+				continue
+			}
+
+			s.printf("%s\n", line)
+		}
+
+		if line == "exit" || line == "quit" {
+			return
+		}
+
+		if line != "history" {
+			s.history = append(s.history, line)
+		}
+
+		s.exec(line)
+	}
+}
+
+// exec executes a single command.
+func (s *shell) exec(line string) {
+	cmd, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+
+	switch cmd {
+	case "help":
+		s.printf("%s", shellHelp)
+	case "history":
+		for i, l := range s.history {
+			s.printf("%5d  %s\n", i+1, l)
+		}
+	case "headers":
+		_ = s.headers.Write(s.w)
+	case "header":
+		s.setHeader(arg)
+	default:
+		s.request(line)
+	}
+}
+
+// fromHistory returns the command number n from the history.
+func (s *shell) fromHistory(n string) (line string, ok bool) {
+	i, err := strconv.Atoi(n)
+	if err != nil || i < 1 || i > len(s.history) {
+		s.printf("No such command in history: %s\n", n)
+
+		return "", false
+	}
+
+	return s.history[i-1], true
+}
+
+// setHeader adds or removes the header, see shellHelp.
+func (s *shell) setHeader(arg string) {
+	if name, ok := strings.CutPrefix(arg, "-"); ok {
+		s.headers.Del(name)
+
+		return
+	}
+
+	name, value, ok := strings.Cut(arg, ":")
+	if !ok || strings.TrimSpace(name) == "" {
+		s.printf("Invalid header: %q, must be \"name: value\"\n", arg)
+
+		return
+	}
+
+	s.headers.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+}
+
+// request sends the request described by line, see parseShellRequest.
+func (s *shell) request(line string) {
+	method, target, data := parseShellRequest(line)
+
+	ref, err := url.Parse(target)
+	if err != nil {
+		s.printf("Invalid URL %q: %v\n", target, err)
+
+		return
+	}
+
+	cfg := s.cfg.WithURL(s.cfg.RequestURL.ResolveReference(ref))
+	cfg.RequestURLs = []*url.URL{cfg.RequestURL}
+	cfg.Method = method
+	cfg.Data = nil
+	if data != "" {
+		cfg.Data = []*config.DataPart{{Data: data}}
+	}
+	cfg.Headers = s.headers.Clone()
+
+	// The errors are already logged by transfer.
+	_ = transfer(cfg, s.transport, s.out, nil)
+
+	s.printf("\n")
+}
+
+// printf writes the formatted message to s.w.
+func (s *shell) printf(format string, args ...any) {
+	_, _ = fmt.Fprintf(s.w, format, args...)
+}
+
+// parseShellRequest parses the request command of the shell which is
+// "[METHOD] <URL> [data]".  The method is only recognized if it is in upper
+// case.
+func parseShellRequest(line string) (method, target, data string) {
+	first, rest, _ := strings.Cut(line, " ")
+	if first != "" && first == strings.ToUpper(first) && !strings.ContainsAny(first, "/:.") {
+		method = first
+		first, rest, _ = strings.Cut(strings.TrimSpace(rest), " ")
+	}
+
+	return method, first, strings.TrimSpace(rest)
+}
+
+// sessionTransport is a client.Transport that keeps cookies between the
+// requests of the shell and writes the status line of every response.  jar is
+// nil if the cookies are kept by the underlying transport, see --session.
+type sessionTransport struct {
+	client.Transport
+
+	jar http.CookieJar
+	w   io.Writer
+}
+
+// type check
+var _ client.Transport = (*sessionTransport)(nil)
+
+// RoundTrip implements the http.RoundTripper interface for *sessionTransport.
+func (t *sessionTransport) RoundTrip(r *http.Request) (resp *http.Response, err error) {
+	if t.jar != nil {
+		for _, c := range t.jar.Cookies(r.URL) {
+			r.AddCookie(c)
+		}
+	}
+
+	start := time.Now()
+	resp, err = t.Transport.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.jar != nil {
+		t.jar.SetCookies(r.URL, resp.Cookies())
+	}
+
+	_, _ = fmt.Fprintf(t.w, "%s %s (%s)\n", resp.Proto, resp.Status, time.Since(start).Round(time.Millisecond))
+
+	return resp, nil
+}
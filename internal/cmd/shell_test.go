@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ameshkov/gocurl/internal/config"
+	"github.com/ameshkov/gocurl/internal/output"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseShellRequest(t *testing.T) {
+	testCases := []struct {
+		line       string
+		wantMethod string
+		wantTarget string
+		wantData   string
+	}{{
+		line:       "/path",
+		wantTarget: "/path",
+	}, {
+		line:       "GET https://example.org/",
+		wantMethod: "GET",
+		wantTarget: "https://example.org/",
+	}, {
+		line:       "POST /api {\"a\": 1}",
+		wantMethod: "POST",
+		wantTarget: "/api",
+		wantData:   "{\"a\": 1}",
+	}, {
+		line:       "HTTP://EXAMPLE.ORG/",
+		wantTarget: "HTTP://EXAMPLE.ORG/",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.line, func(t *testing.T) {
+			method, target, data := parseShellRequest(tc.line)
+			require.Equal(t, tc.wantMethod, method)
+			require.Equal(t, tc.wantTarget, target)
+			require.Equal(t, tc.wantData, data)
+		})
+	}
+}
+
+func TestRunShell(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "secret"})
+
+			return
+		}
+
+		c, err := r.Cookie("session")
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		_, _ = w.Write([]byte(c.Value + " " + r.Header.Get("X-Test") + "\n"))
+	}))
+	t.Cleanup(srv.Close)
+
+	cfg, err := config.ParseConfig([]string{srv.URL + "/"})
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "out")
+	out, err := output.NewOutput(path, false)
+	require.NoError(t, err)
+
+	in := strings.NewReader("POST /login\nheader X-Test: value\n/check\nhistory\nexit\n")
+	w := &bytes.Buffer{}
+	require.Equal(t, 0, runShell(cfg, out, in, w))
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Contains(t, string(b), "secret value\n")
+	require.Contains(t, w.String(), "3  /check")
+}
@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/ameshkov/gocurl/internal/config"
+	"github.com/ameshkov/gocurl/internal/output"
+)
+
+// maxURLRetries is the maximum number of retries of a single URL so that one
+// misbehaving endpoint cannot use up the whole retry budget.
+const maxURLRetries = 3
+
+// summary is the summary of processing several URLs, see --url-file.  It is
+// written to stderr once all the transfers are finished.
+type summary struct {
+	// mu protects the fields below.
+	mu *sync.Mutex
+
+	Total     int `json:"total"`
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+
+	// Skipped is the number of URLs that were not processed because
+	// MaxFailures was reached.
+	Skipped int `json:"skipped"`
+
+	// MaxFailures is the number of failures after which the remaining URLs
+	// are skipped.  Zero means no limit.
+	MaxFailures int `json:"max_failures,omitempty"`
+
+	// Retries is the number of retries that were made.
+	Retries int `json:"retries"`
+
+	// RetryBudget is the total number of retries allowed.
+	RetryBudget int `json:"retry_budget"`
+
+	// RetryBudgetLeft is the number of retries that are still allowed.
+	RetryBudgetLeft int `json:"retry_budget_left"`
+
+	// err is the error of the last failed transfer.
+	err error
+}
+
+// newSummary creates a new *summary for processing total URLs.
+func newSummary(total, maxFailures, retryBudget int) (s *summary) {
+	return &summary{
+		mu:              &sync.Mutex{},
+		Total:           total,
+		MaxFailures:     maxFailures,
+		RetryBudget:     retryBudget,
+		RetryBudgetLeft: retryBudget,
+	}
+}
+
+// stopped returns true if the failures threshold is reached and the remaining
+// URLs must be skipped.
+func (s *summary) stopped() (ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.MaxFailures > 0 && s.Failed >= s.MaxFailures
+}
+
+// takeRetry takes a retry from the budget.  Returns false if the budget is
+// exhausted.
+func (s *summary) takeRetry() (ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.RetryBudgetLeft == 0 {
+		return false
+	}
+
+	s.RetryBudgetLeft--
+	s.Retries++
+
+	return true
+}
+
+// addResult records the result of a transfer, err is nil if it succeeded.
+func (s *summary) addResult(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err == nil {
+		s.Succeeded++
+	} else {
+		s.Failed++
+		s.err = err
+	}
+}
+
+// addSkipped records a skipped URL.
+func (s *summary) addSkipped() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Skipped++
+}
+
+// write writes the summary to stderr.  It is written in JSON format if
+// cfg.OutputJSON is set, otherwise it is only written in the verbose mode or
+// when some URLs were skipped.
+func (s *summary) write(cfg *config.Config, out *output.Output) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cfg.OutputJSON {
+		b, err := json.Marshal(s)
+		if err != nil {
+			panic(err)
+		}
+
+		out.Info("%s", b)
+
+		return
+	}
+
+	log := out.Debug
+	if s.Skipped > 0 {
+		log = out.Info
+	}
+
+	log(
+		"Processed %d URLs: %d succeeded, %d failed, %d skipped, %d retries (%d of %d left in the budget)",
+		s.Total,
+		s.Succeeded,
+		s.Failed,
+		s.Skipped,
+		s.Retries,
+		s.RetryBudgetLeft,
+		s.RetryBudget,
+	)
+}
@@ -0,0 +1,568 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/ameshkov/gocurl/internal/client"
+	"github.com/ameshkov/gocurl/internal/client/websocket"
+	"github.com/ameshkov/gocurl/internal/config"
+	"github.com/ameshkov/gocurl/internal/expect"
+	"github.com/ameshkov/gocurl/internal/output"
+	"github.com/ameshkov/gocurl/internal/ratelimit"
+	"github.com/ameshkov/gocurl/internal/spill"
+)
+
+// transfer makes the request to cfg.RequestURL using transport and writes the
+// response to out.  After every attempt, retry is called with the context of
+// the transfer and the response or the error of the attempt, and the request
+// is repeated if it returns true.  retry may be nil, see retryFunc.  Errors
+// are logged and returned.
+func transfer(
+	cfg *config.Config,
+	transport client.Transport,
+	out *output.Output,
+	retry func(ctx context.Context, resp *http.Response, err error) (ok bool),
+) (err error) {
+	// The deadline of --max-time covers all the attempts and reading the
+	// response body.
+	ctx := context.Background()
+	if cfg.MaxTime > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.MaxTime)
+		defer cancel()
+	}
+
+	if retry != nil && cfg.ReadsStdin() {
+		// Stdin can only be read once, so it's saved for the retries.
+		var cleanup func()
+		cfg, cleanup, err = saveStdin(cfg)
+		if err != nil {
+			out.Info("Failed to read request body from stdin: %v", err)
+
+			return err
+		}
+		defer cleanup()
+	}
+
+	// reqBody keeps the sent request body for --save-exchange as the body
+	// can only be read once.
+	var reqBody *bytes.Buffer
+	if cfg.SaveExchange != "" {
+		reqBody = &bytes.Buffer{}
+	}
+
+	var req *http.Request
+	var resp *http.Response
+	var attempt *output.Attempt
+	var attempts []*output.Attempt
+	for {
+		req, resp, attempt, err = roundTrip(ctx, cfg, transport, reqBody, out)
+		attempts = append(attempts, attempt)
+		if retry == nil || ctx.Err() != nil || !retry(ctx, resp, err) {
+			break
+		}
+
+		if err != nil {
+			out.Debug("Retrying request to %s after error: %v", cfg.RequestURL, err)
+		} else {
+			out.Debug("Retrying request to %s after response: %s", cfg.RequestURL, resp.Status)
+			_ = resp.Body.Close()
+		}
+	}
+
+	if err == nil && ctx.Err() != nil {
+		// The deadline was reached while waiting before the retry.
+		_ = resp.Body.Close()
+		resp, err = nil, ctx.Err()
+	}
+
+	err = maxTimeError(ctx, cfg, err)
+
+	m := newMetrics(cfg, req, attempt)
+	defer func() {
+		m.TotalDuration = time.Since(attempt.Start)
+		if attempt.Timings != nil {
+			attempt.Timings.Done(output.PhaseTotal, attempt.Start.Add(m.TotalDuration))
+			out.Debug("Timings: %s", attempt.Timings)
+		}
+		if err != nil {
+			m.Error = err.Error()
+		}
+
+		out.WriteMetrics(m)
+
+		if cfg.WriteOut != "" {
+			out.WriteOut(cfg.WriteOut, m, resp, err)
+		}
+	}()
+
+	var exchange *output.Exchange
+	if reqBody != nil && req != nil {
+		exchange = saveExchange(cfg, req, reqBody.Bytes(), attempt, out)
+	}
+
+	if exchange != nil {
+		defer func() {
+			exErr := exchange.Close(err)
+			if exErr != nil {
+				out.Info("Failed to save the exchange: %v", exErr)
+			}
+		}()
+	}
+
+	// The attempts are only interesting when the request could be retried.
+	if cfg.RetryBudget == 0 && cfg.Retry == 0 {
+		attempts = nil
+	}
+
+	if err != nil {
+		out.Info("Failed to make request to %s: %v", cfg.RequestURL, err)
+		out.DebugHTTP2Error(err)
+		out.WriteError(cfg.RequestURL, err, attempts, cfg)
+
+		return err
+	}
+
+	if attempts != nil && resp.Request != nil {
+		resp.Request = resp.Request.WithContext(output.WithAttempts(resp.Request.Context(), attempts))
+	}
+
+	start := attempt.Start
+
+	defer func(body io.ReadCloser) {
+		_ = body.Close()
+	}(resp.Body)
+
+	// Response body is only written when we're sure that it is there.
+	var responseBody io.Reader
+	if resp.ProtoMajor >= 2 ||
+		resp.ContentLength > 0 ||
+		len(resp.TransferEncoding) > 0 ||
+		resp.Header.Get("Connection") == "close" {
+		responseBody = resp.Body
+	}
+	if req.Method == http.MethodHead {
+		responseBody = nil
+	}
+
+	m.StatusCode, m.Proto = resp.StatusCode, resp.Proto
+	if responseBody != nil {
+		if cfg.LimitRate > 0 {
+			responseBody = ratelimit.NewReader(responseBody, cfg.LimitRate)
+		}
+
+		responseBody = &countingReader{r: responseBody, n: &m.DownloadSize}
+	}
+
+	if exchange != nil {
+		var exErr error
+		responseBody, exErr = exchange.SaveResponse(resp, responseBody)
+		if exErr != nil {
+			out.Info("Failed to save the exchange: %v", exErr)
+		}
+	}
+
+	out.DebugResponse(resp)
+	out.DumpHeader(resp)
+
+	if cfg.ContinueAt > 0 {
+		var complete bool
+		complete, err = checkResume(cfg, resp)
+		if err != nil {
+			out.Info("Failed to make request to %s: %v", cfg.RequestURL, err)
+
+			return err
+		} else if complete {
+			out.Debug("The file is already downloaded, nothing to resume")
+
+			return nil
+		}
+	}
+
+	failErr := httpError(cfg, resp)
+	if failErr != nil {
+		out.Info("Failed to make request to %s: %v", cfg.RequestURL, failErr)
+
+		if !cfg.FailWithBody {
+			return failErr
+		}
+	}
+
+	// WebSocket is processed differently. If request body is supplied with the
+	// "data" command-line argument, it is sent as a text frame, and then it
+	// waits until the response comes from the server.
+	if websocket.IsWebSocketResponse(resp) {
+		wsConn := websocket.NewWebSocket(client.ResponseConn(resp), out)
+		defer func() {
+			_ = wsConn.Close()
+		}()
+
+		if cfg.HasData() {
+			// The WebSocket response is buffered before writing it, see
+			// --max-memory.
+			buf := spill.New(cfg.MaxMemory)
+			defer func() { _ = buf.Close() }()
+
+			data, wsErr := cfg.ReadData()
+			if wsErr == nil {
+				_, wsErr = wsConn.Write(data)
+			}
+
+			if wsErr == nil {
+				_, wsErr = io.Copy(buf, wsConn)
+			}
+
+			if wsErr == nil {
+				responseBody, wsErr = buf.Reader()
+			}
+
+			if wsErr != nil {
+				out.Debug("Failed to read WebSocket response: %v", wsErr)
+			}
+		}
+	}
+
+	if cfg.CharsetConvert && responseBody != nil {
+		responseBody = convertCharset(resp, responseBody, out)
+	}
+
+	var failures []*expect.Failure
+	if cfg.HasExpectations() {
+		// The body is buffered since it needs to be fully read in order to
+		// check the assertions before writing it.
+		buf := spill.New(cfg.MaxMemory)
+		defer func() { _ = buf.Close() }()
+
+		responseBody, failures, err = checkExpectations(cfg, resp, responseBody, start, buf)
+		err = maxTimeError(ctx, cfg, err)
+		if err != nil {
+			out.Info("Failed to read response from %s: %v", cfg.RequestURL, err)
+
+			return err
+		}
+	}
+
+	// Write the response contents to the output.
+	err = maxTimeError(ctx, cfg, out.Write(resp, responseBody, cfg))
+	if err != nil {
+		out.Info("Failed to read response from %s: %v", cfg.RequestURL, err)
+
+		return err
+	}
+
+	if len(failures) > 0 {
+		expect.WriteReport(cfg, failures, out)
+
+		return fmt.Errorf("%d expectations failed", len(failures))
+	}
+
+	return failErr
+}
+
+// errResume is returned when the download cannot be resumed, see
+// --continue-at.
+var errResume = errors.New("cannot resume")
+
+// checkResume checks that resp can be appended to the output when the
+// download is resumed, see --continue-at.  Only the partial content can be
+// appended as anything else would corrupt the file.  Like in curl, 416 Range
+// Not Satisfiable means that the file is already complete.
+func checkResume(cfg *config.Config, resp *http.Response) (complete bool, err error) {
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		return false, nil
+	case http.StatusRequestedRangeNotSatisfiable:
+		return true, nil
+	case http.StatusOK:
+		return false, fmt.Errorf("%w from %d: server doesn't support byte ranges", errResume, cfg.ContinueAt)
+	default:
+		return false, fmt.Errorf("%w from %d: unexpected response %s", errResume, cfg.ContinueAt, resp.Status)
+	}
+}
+
+// errHTTPStatus is returned when the response status is an error and --fail
+// or --fail-with-body is used.
+var errHTTPStatus = errors.New("the requested URL returned error")
+
+// httpError returns the error if resp has an error status and cfg requires
+// the transfer to fail in this case, see --fail.
+func httpError(cfg *config.Config, resp *http.Response) (err error) {
+	if (!cfg.Fail && !cfg.FailWithBody) || resp.StatusCode < http.StatusBadRequest {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s", errHTTPStatus, resp.Status)
+}
+
+// roundTrip creates a new request from cfg with ctx and sends it using
+// transport.  If reqBody is not nil, the sent request body is written to it.
+// attempt is the information about this attempt, it is never nil.
+func roundTrip(
+	ctx context.Context,
+	cfg *config.Config,
+	transport client.Transport,
+	reqBody *bytes.Buffer,
+	out *output.Output,
+) (req *http.Request, resp *http.Response, attempt *output.Attempt, err error) {
+	attempt = &output.Attempt{Start: time.Now()}
+	defer func() {
+		attempt.Duration = time.Since(attempt.Start)
+		if err != nil {
+			attempt.Error = err.Error()
+
+			return
+		}
+
+		attempt.Proto = resp.Proto
+
+		// HTTP/3 connections are not reported by httptrace.  file:// URLs
+		// don't use any connection.
+		if conn := client.ResponseConn(resp); attempt.Target == "" && conn != nil && req.URL.Scheme != "file" {
+			attempt.Target = conn.RemoteAddr().String()
+		}
+	}()
+
+	req, err = client.NewRequest(cfg)
+	if err != nil {
+		return nil, nil, attempt, fmt.Errorf("creating request: %w", err)
+	}
+
+	req = req.WithContext(ctx)
+	out.DebugRequest(req)
+
+	if reqBody != nil {
+		reqBody.Reset()
+		if req.Body != nil {
+			req.Body = &recordingBody{ReadCloser: req.Body, buf: reqBody}
+		}
+	}
+
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			attempt.Target = info.Conn.RemoteAddr().String()
+			attempt.ConnectDuration = time.Since(attempt.Start)
+		},
+		GotFirstResponseByte: func() {
+			attempt.FirstByteDuration = time.Since(attempt.Start)
+			attempt.Timings.Done(output.PhaseStartTransfer, attempt.Start.Add(attempt.FirstByteDuration))
+		},
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+
+	attempt.Start = time.Now()
+	attempt.Timings = output.NewTimings(attempt.Start)
+	req = req.WithContext(output.WithTimings(req.Context(), attempt.Timings))
+
+	resp, err = transport.RoundTrip(req)
+	if err == nil && attempt.Timings.Duration(output.PhaseStartTransfer) == 0 {
+		// HTTP/3 transports don't report the first response byte.
+		attempt.Timings.Done(output.PhaseStartTransfer, time.Now())
+	}
+
+	return req, resp, attempt, err
+}
+
+// maxTimeError returns err annotated with --max-time if it was caused by the
+// deadline of ctx.
+func maxTimeError(ctx context.Context, cfg *config.Config, err error) (res error) {
+	if err == nil || !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return err
+	}
+
+	return fmt.Errorf("operation timed out after %s: %w", cfg.MaxTime, err)
+}
+
+// checkExpectations reads body into buf and checks the response against the
+// assertions configured in cfg, see --expect-status.  start is the time when
+// the request was sent.  Returns the reader for the buffered body.
+func checkExpectations(
+	cfg *config.Config,
+	resp *http.Response,
+	body io.Reader,
+	start time.Time,
+	buf *spill.Buffer,
+) (res io.Reader, failures []*expect.Failure, err error) {
+	if body != nil {
+		_, err = io.Copy(buf, body)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	duration := time.Since(start)
+
+	var bodyToCheck io.Reader
+	if body != nil {
+		bodyToCheck, err = buf.Reader()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	failures = expect.Check(cfg, resp, bodyToCheck, duration)
+
+	if body == nil {
+		return nil, failures, nil
+	}
+
+	res, err = buf.Reader()
+
+	return res, failures, err
+}
+
+// transferAll makes requests to every URL from cfg.RequestURLs one by one or
+// in parallel if cfg.Parallel is set.  All the URLs share the same transport
+// so that connections to the same origin are reused.  Besides --retry, failed
+// requests are retried while cfg.RetryBudget allows and no new transfers are
+// started once cfg.MaxFailures is reached.  Returns the error of the last
+// failed transfer or nil if all of them succeeded.
+func transferAll(cfg *config.Config, transport client.Transport, out *output.Output) (err error) {
+	workers := 1
+	if cfg.Parallel {
+		workers = cfg.ParallelMax
+	}
+
+	out.Debug("Processing %d URLs using %d workers", len(cfg.RequestURLs), workers)
+
+	urls := make(chan *config.Config, len(cfg.RequestURLs))
+	for i, u := range cfg.RequestURLs {
+		urlCfg := cfg.WithURL(u)
+		urlCfg.URLNumber = i + 1
+		urls <- urlCfg
+	}
+	close(urls)
+
+	s := newSummary(len(cfg.RequestURLs), cfg.MaxFailures, cfg.RetryBudget)
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for urlCfg := range urls {
+				if s.stopped() {
+					s.addSkipped()
+
+					continue
+				}
+
+				rt := newRetrier(urlCfg, out)
+				retries := 0
+				retry := func(ctx context.Context, resp *http.Response, err error) (ok bool) {
+					if rt != nil && rt.retry(ctx, resp, err) {
+						return true
+					}
+
+					if err == nil || retries >= maxURLRetries || !s.takeRetry() {
+						return false
+					}
+
+					retries++
+
+					return true
+				}
+
+				s.addResult(transfer(urlCfg, transport, out, retry))
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	s.write(cfg, out)
+
+	return s.err
+}
+
+// newMetrics creates the metrics record of the transfer to cfg.RequestURL,
+// see --metrics-file.  req may be nil if the request could not be created.
+func newMetrics(cfg *config.Config, req *http.Request, attempt *output.Attempt) (m *output.Metrics) {
+	m = &output.Metrics{
+		Time:              attempt.Start,
+		URL:               cfg.RequestURL.String(),
+		ConnectDuration:   attempt.ConnectDuration,
+		FirstByteDuration: attempt.FirstByteDuration,
+		Timings:           attempt.Timings,
+	}
+
+	if host, _, err := net.SplitHostPort(attempt.Target); err == nil {
+		m.RemoteIP = host
+	}
+
+	if req != nil && req.ContentLength > 0 {
+		m.UploadSize = req.ContentLength
+	}
+
+	return m
+}
+
+// saveExchange starts saving the transfer to cfg.SaveExchange, see
+// --save-exchange.  req is the sent request and body is its recorded body.
+// Returns nil if the exchange cannot be saved, the errors are logged.
+func saveExchange(
+	cfg *config.Config,
+	req *http.Request,
+	body []byte,
+	attempt *output.Attempt,
+	out *output.Output,
+) (e *output.Exchange) {
+	e, err := output.NewExchange(cfg.SaveExchange, req, body, attempt)
+	if err != nil {
+		out.Info("Failed to save the exchange: %v", err)
+
+		return nil
+	}
+
+	out.Debug("Saving the exchange to %s", e.Dir())
+
+	return e
+}
+
+// maxRecordedBody is the maximum size of the request body kept for
+// --save-exchange so that large uploads are not buffered in memory.
+const maxRecordedBody = 1 << 20
+
+// recordingBody is an io.ReadCloser that writes up to maxRecordedBody bytes of
+// the data read from the request body to buf.
+type recordingBody struct {
+	io.ReadCloser
+
+	buf *bytes.Buffer
+}
+
+// type check
+var _ io.ReadCloser = (*recordingBody)(nil)
+
+// Read implements the io.Reader interface for *recordingBody.
+func (b *recordingBody) Read(p []byte) (n int, err error) {
+	n, err = b.ReadCloser.Read(p)
+	if rest := maxRecordedBody - b.buf.Len(); rest > 0 {
+		_, _ = b.buf.Write(p[:min(n, rest)])
+	}
+
+	return n, err
+}
+
+// countingReader is an io.Reader that counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n *int64
+}
+
+// Read implements the io.Reader interface for *countingReader.
+func (c *countingReader) Read(p []byte) (n int, err error) {
+	n, err = c.r.Read(p)
+	*c.n += int64(n)
+
+	return n, err
+}
@@ -0,0 +1,380 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ameshkov/gocurl/internal/client"
+	"github.com/ameshkov/gocurl/internal/config"
+	"github.com/ameshkov/gocurl/internal/output"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransfer_maxTime(t *testing.T) {
+	unblock := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/body" {
+			// Send the header, but stall the body.
+			_, _ = w.Write([]byte("partial"))
+			w.(http.Flusher).Flush()
+		}
+
+		select {
+		case <-unblock:
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() { close(unblock) })
+
+	out, err := output.NewOutput(filepath.Join(t.TempDir(), "out"), false)
+	require.NoError(t, err)
+
+	for _, path := range []string{"/header", "/body"} {
+		cfg, pErr := config.ParseConfig([]string{"--max-time", "100ms", srv.URL + path})
+		require.NoError(t, pErr)
+
+		transport, pErr := client.NewTransport(cfg, out)
+		require.NoError(t, pErr)
+
+		start := time.Now()
+		err = transfer(cfg, transport, out, nil)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.ErrorContains(t, err, "operation timed out after 100ms")
+		require.Less(t, time.Since(start), 5*time.Second)
+	}
+}
+
+func TestTransfer_limitRate(t *testing.T) {
+	data := bytes.Repeat([]byte{'a'}, 1000)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write(data)
+	}))
+	t.Cleanup(srv.Close)
+
+	path := filepath.Join(t.TempDir(), "out")
+	out, err := output.NewOutput(path, false)
+	require.NoError(t, err)
+
+	cfg, err := config.ParseConfig([]string{"--limit-rate", "5000", srv.URL})
+	require.NoError(t, err)
+
+	transport, err := client.NewTransport(cfg, out)
+	require.NoError(t, err)
+
+	start := time.Now()
+	err = transfer(cfg, transport, out, nil)
+	require.NoError(t, err)
+
+	// 1000 bytes at 5000 bytes per second take at least 200ms.
+	require.GreaterOrEqual(t, time.Since(start), 190*time.Millisecond)
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, data, b)
+}
+
+func TestTransferAll_outputTemplate(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.URL.Path))
+	}))
+	t.Cleanup(srv.Close)
+
+	dir := t.TempDir()
+	urlFile := filepath.Join(dir, "urls.txt")
+	err := os.WriteFile(urlFile, []byte(srv.URL+"/a.txt\n"+srv.URL+"/b/c.txt\n"), 0o600)
+	require.NoError(t, err)
+
+	cfg, err := config.ParseConfig([]string{
+		"--url-file", urlFile,
+		"--output-dir", filepath.Join(dir, "out"),
+		"--create-dirs",
+		"-o", "{n}/{file}",
+	})
+	require.NoError(t, err)
+
+	out, err := output.NewOutput(cfg.OutputPath, false)
+	require.NoError(t, err)
+
+	transport, err := client.NewTransport(cfg, out)
+	require.NoError(t, err)
+
+	require.NoError(t, transferAll(cfg, transport, out))
+
+	b, err := os.ReadFile(filepath.Join(dir, "out", "1", "a.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "/a.txt", string(b))
+
+	b, err = os.ReadFile(filepath.Join(dir, "out", "2", "c.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "/b/c.txt", string(b))
+}
+
+func TestTransferAll_fail(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	dir := t.TempDir()
+	urlFile := filepath.Join(dir, "urls.txt")
+	err := os.WriteFile(urlFile, []byte(srv.URL+"/a\n"+srv.URL+"/missing\n"+srv.URL+"/b\n"), 0o600)
+	require.NoError(t, err)
+
+	cfg, err := config.ParseConfig([]string{"--url-file", urlFile, "-f", "-o", filepath.Join(dir, "out")})
+	require.NoError(t, err)
+
+	out, err := output.NewOutput(cfg.OutputPath, false)
+	require.NoError(t, err)
+
+	transport, err := client.NewTransport(cfg, out)
+	require.NoError(t, err)
+
+	err = transferAll(cfg, transport, out)
+	require.ErrorIs(t, err, errHTTPStatus)
+	require.Equal(t, exitCodeHTTPError, errorExitCode(err))
+}
+
+func TestTransfer_fail(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte("not found"))
+	}))
+	t.Cleanup(srv.Close)
+
+	testCases := []struct {
+		name     string
+		args     []string
+		wantErr  bool
+		wantBody string
+	}{{
+		name:     "none",
+		args:     nil,
+		wantErr:  false,
+		wantBody: "not found",
+	}, {
+		name:     "fail",
+		args:     []string{"-f"},
+		wantErr:  true,
+		wantBody: "",
+	}, {
+		name:     "fail_with_body",
+		args:     []string{"--fail-with-body"},
+		wantErr:  true,
+		wantBody: "not found",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := config.ParseConfig(append(tc.args, srv.URL))
+			require.NoError(t, err)
+
+			path := filepath.Join(t.TempDir(), "out")
+			out, err := output.NewOutput(path, false)
+			require.NoError(t, err)
+
+			transport, err := client.NewTransport(cfg, out)
+			require.NoError(t, err)
+
+			err = transfer(cfg, transport, out, nil)
+			if tc.wantErr {
+				require.ErrorIs(t, err, errHTTPStatus)
+				require.ErrorContains(t, err, "404 Not Found")
+			} else {
+				require.NoError(t, err)
+			}
+
+			b, err := os.ReadFile(path)
+			require.NoError(t, err)
+			require.Equal(t, tc.wantBody, string(b))
+		})
+	}
+}
+
+func TestTransfer_continueAt(t *testing.T) {
+	testCases := []struct {
+		name     string
+		status   int
+		wantErr  bool
+		wantFile string
+	}{{
+		name:     "partial",
+		status:   http.StatusPartialContent,
+		wantErr:  false,
+		wantFile: "hello, world",
+	}, {
+		name:     "complete",
+		status:   http.StatusRequestedRangeNotSatisfiable,
+		wantErr:  false,
+		wantFile: "hello",
+	}, {
+		name:     "no_ranges",
+		status:   http.StatusOK,
+		wantErr:  true,
+		wantFile: "hello",
+	}, {
+		name:     "not_found",
+		status:   http.StatusNotFound,
+		wantErr:  true,
+		wantFile: "hello",
+	}, {
+		name:     "server_error",
+		status:   http.StatusInternalServerError,
+		wantErr:  true,
+		wantFile: "hello",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(tc.status)
+				_, _ = w.Write([]byte(", world"))
+			}))
+			t.Cleanup(srv.Close)
+
+			path := filepath.Join(t.TempDir(), "out")
+			err := os.WriteFile(path, []byte("hello"), 0o600)
+			require.NoError(t, err)
+
+			cfg, err := config.ParseConfig([]string{"-C", "-", "-o", path, srv.URL})
+			require.NoError(t, err)
+
+			out, err := output.NewAppendOutput(cfg.OutputPath, false)
+			require.NoError(t, err)
+
+			transport, err := client.NewTransport(cfg, out)
+			require.NoError(t, err)
+
+			err = transfer(cfg, transport, out, nil)
+			if tc.wantErr {
+				require.ErrorIs(t, err, errResume)
+			} else {
+				require.NoError(t, err)
+			}
+
+			b, err := os.ReadFile(path)
+			require.NoError(t, err)
+			require.Equal(t, tc.wantFile, string(b))
+		})
+	}
+}
+
+// setStdin replaces os.Stdin with a pipe that contains data for the duration
+// of the test.
+func setStdin(t *testing.T, data string) {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+
+	go func() {
+		_, _ = w.WriteString(data)
+		_ = w.Close()
+	}()
+
+	stdin := os.Stdin
+	os.Stdin = r
+	t.Cleanup(func() {
+		os.Stdin = stdin
+		_ = r.Close()
+	})
+}
+
+func TestTransfer_stdinBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// HTTP/1.x handlers must read the whole body before writing.
+		b, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(b)
+	}))
+	t.Cleanup(srv.Close)
+
+	testCases := []struct {
+		name     string
+		args     []string
+		stdin    string
+		wantBody string
+	}{{
+		name:     "data",
+		args:     []string{"-d", "@-"},
+		stdin:    "a=1\n",
+		wantBody: "a=1",
+	}, {
+		name:     "upload_file",
+		args:     []string{"-T", "-"},
+		stdin:    "hi\n",
+		wantBody: "hi\n",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "out")
+
+			// The request is logged in verbose mode, it must not consume the
+			// body.
+			out, err := output.NewOutput(path, true)
+			require.NoError(t, err)
+
+			setStdin(t, tc.stdin)
+
+			cfg, err := config.ParseConfig(append(tc.args, srv.URL))
+			require.NoError(t, err)
+
+			transport, err := client.NewTransport(cfg, out)
+			require.NoError(t, err)
+
+			err = transfer(cfg, transport, out, nil)
+			require.NoError(t, err)
+
+			b, err := os.ReadFile(path)
+			require.NoError(t, err)
+			require.Equal(t, tc.wantBody, string(b))
+		})
+	}
+}
+
+func TestTransfer_limitRateUpload(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// HTTP/1.x handlers must read the whole body before writing.
+		b, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(b)
+	}))
+	t.Cleanup(srv.Close)
+
+	dir := t.TempDir()
+	data := bytes.Repeat([]byte{'a'}, 1000)
+	upload := filepath.Join(dir, "upload")
+	require.NoError(t, os.WriteFile(upload, data, 0o600))
+
+	path := filepath.Join(dir, "out")
+	out, err := output.NewOutput(path, true)
+	require.NoError(t, err)
+
+	cfg, err := config.ParseConfig([]string{"--limit-rate-upload", "1000", "-T", upload, srv.URL})
+	require.NoError(t, err)
+
+	transport, err := client.NewTransport(cfg, out)
+	require.NoError(t, err)
+
+	start := time.Now()
+	err = transfer(cfg, transport, out, nil)
+	require.NoError(t, err)
+
+	// 1000 bytes at 1000 bytes per second take a second, the body must only
+	// be read once.
+	elapsed := time.Since(start)
+	require.GreaterOrEqual(t, elapsed, 900*time.Millisecond)
+	require.Less(t, elapsed, 1800*time.Millisecond)
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, data, b)
+}
@@ -0,0 +1,145 @@
+package compare
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxDiffCells is the maximum number of cells in the table that is used to
+// find the longest common subsequence of lines.  Larger bodies are only
+// reported as different without the list of lines.
+const maxDiffCells = 16 * 1024 * 1024
+
+// BodyDiff is the difference between the response bodies.
+type BodyDiff struct {
+	// Lines are the lines that were removed from the first body or added to
+	// the second one.  It is empty if the bodies are equal, binary, or too
+	// large.
+	Lines []*LineDiff `json:"lines,omitempty"`
+
+	// SizeA is the size of the first body.
+	SizeA int `json:"size_a"`
+
+	// SizeB is the size of the second body.
+	SizeB int `json:"size_b"`
+
+	// Equal is true if the bodies are equal.
+	Equal bool `json:"equal"`
+
+	// Binary is true if any of the bodies is not a text.
+	Binary bool `json:"binary,omitempty"`
+}
+
+// LineDiff is a line that is only present in one of the bodies.
+type LineDiff struct {
+	// Op is "-" for the lines of the first body and "+" for the lines of the
+	// second one.
+	Op string `json:"op"`
+
+	// Text is the line without the line break.
+	Text string `json:"text"`
+
+	// Line is the 1-based line number in its body.
+	Line int `json:"line"`
+}
+
+// String implements the fmt.Stringer interface for *BodyDiff.
+func (d *BodyDiff) String() (s string) {
+	switch {
+	case d.Equal:
+		return fmt.Sprintf("identical, %d bytes", d.SizeA)
+	case d.Binary:
+		return fmt.Sprintf("binary bodies differ, %d and %d bytes", d.SizeA, d.SizeB)
+	case len(d.Lines) == 0:
+		return fmt.Sprintf("bodies differ, %d and %d bytes, too large to compare lines", d.SizeA, d.SizeB)
+	default:
+		return fmt.Sprintf("bodies differ, %d and %d bytes", d.SizeA, d.SizeB)
+	}
+}
+
+// diffBodies compares a and b line by line.
+func diffBodies(a, b []byte) (d *BodyDiff) {
+	d = &BodyDiff{
+		SizeA: len(a),
+		SizeB: len(b),
+		Equal: bytes.Equal(a, b),
+	}
+
+	if d.Equal {
+		return d
+	}
+
+	if !isText(a) || !isText(b) {
+		d.Binary = true
+
+		return d
+	}
+
+	linesA, linesB := splitLines(a), splitLines(b)
+	if (len(linesA)+1)*(len(linesB)+1) > maxDiffCells {
+		return d
+	}
+
+	d.Lines = diffLines(linesA, linesB)
+
+	return d
+}
+
+// diffLines returns the lines that are not in the longest common subsequence
+// of a and b.
+func diffLines(a, b []string) (diffs []*LineDiff) {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and
+	// b[j:].
+	lcs := make([][]int32, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(b)+1)
+	}
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			i, j = i+1, j+1
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			diffs = append(diffs, &LineDiff{Op: "-", Text: a[i], Line: i + 1})
+			i++
+		default:
+			diffs = append(diffs, &LineDiff{Op: "+", Text: b[j], Line: j + 1})
+			j++
+		}
+	}
+
+	return diffs
+}
+
+// splitLines splits the body into lines without the line breaks.
+func splitLines(body []byte) (lines []string) {
+	s := strings.TrimSuffix(string(body), "\n")
+	if s == "" {
+		return nil
+	}
+
+	lines = strings.Split(s, "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimSuffix(l, "\r")
+	}
+
+	return lines
+}
+
+// isText returns true if the body looks like a text.
+func isText(body []byte) (ok bool) {
+	return utf8.Valid(body) && bytes.IndexByte(body, 0) == -1
+}
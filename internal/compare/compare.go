@@ -0,0 +1,237 @@
+// Package compare implements the comparison mode (--compare-with and
+// "gocurl diff") that sends the same request to two URLs and reports the
+// differences between the responses.
+package compare
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/ameshkov/gocurl/internal/client"
+	"github.com/ameshkov/gocurl/internal/config"
+	"github.com/ameshkov/gocurl/internal/output"
+)
+
+// Response is the response received from one of the compared URLs.
+type Response struct {
+	// Header is the response header.
+	Header http.Header `json:"-"`
+
+	// URL is the request URL.
+	URL string `json:"url"`
+
+	// Err is the error that happened during the request, if any.
+	Err error `json:"-"`
+
+	// Error is the error that happened during the request, if any.
+	Error string `json:"error,omitempty"`
+
+	// Status is the status line of the response, e.g. "200 OK".
+	Status string `json:"status,omitempty"`
+
+	// Proto is the protocol of the response.
+	Proto string `json:"proto,omitempty"`
+
+	// Body is the response body.
+	Body []byte `json:"-"`
+
+	// StatusCode is the status code of the response.
+	StatusCode int `json:"status_code,omitempty"`
+}
+
+// Result is the result of the comparison.
+type Result struct {
+	// A is the response from the first URL.
+	A *Response `json:"a"`
+
+	// B is the response from the second URL.
+	B *Response `json:"b"`
+
+	// Body is the difference between the response bodies.
+	Body *BodyDiff `json:"body"`
+
+	// Headers are the header fields that differ, sorted by name.
+	Headers []*HeaderDiff `json:"headers,omitempty"`
+
+	// Equal is true if the responses have the same status, header fields,
+	// and body.
+	Equal bool `json:"equal"`
+}
+
+// HeaderDiff is a header field that has different values in the responses.
+type HeaderDiff struct {
+	// Name is the canonical name of the header field.
+	Name string `json:"name"`
+
+	// A are the values of the field in the first response.
+	A []string `json:"a"`
+
+	// B are the values of the field in the second response.
+	B []string `json:"b"`
+}
+
+// Run sends the request configured by cfg to cfg.RequestURL and to
+// cfg.CompareURL using the same transport and compares the responses.
+func Run(cfg *config.Config, transport client.Transport, out *output.Output) (r *Result) {
+	r = &Result{
+		A: fetch(cfg, transport, out),
+		B: fetch(cfg.WithURL(cfg.CompareURL), transport, out),
+	}
+
+	r.Headers = diffHeaders(r.A.Header, r.B.Header)
+	r.Body = diffBodies(r.A.Body, r.B.Body)
+	r.Equal = r.A.Error == "" && r.B.Error == "" &&
+		r.A.Status == r.B.Status &&
+		len(r.Headers) == 0 &&
+		r.Body.Equal
+
+	return r
+}
+
+// Err returns the error of the first failed request or nil if both requests
+// succeeded.
+func (r *Result) Err() (err error) {
+	if r.A.Err != nil {
+		return r.A.Err
+	}
+
+	return r.B.Err
+}
+
+// fetch sends the request configured by cfg and reads the response.  Errors
+// are logged and saved to the result.
+func fetch(cfg *config.Config, transport client.Transport, out *output.Output) (resp *Response) {
+	resp = &Response{
+		URL: cfg.RequestURL.String(),
+	}
+
+	err := fetchInto(resp, cfg, transport)
+	if err != nil {
+		out.Info("Failed to make request to %s: %v", cfg.RequestURL, err)
+		resp.Err, resp.Error = err, err.Error()
+	}
+
+	return resp
+}
+
+// fetchInto sends the request configured by cfg and saves the response to
+// resp.
+func fetchInto(resp *Response, cfg *config.Config, transport client.Transport) (err error) {
+	req, err := client.NewRequest(cfg)
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+
+	httpResp, err := transport.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = httpResp.Body.Close() }()
+
+	resp.StatusCode = httpResp.StatusCode
+	resp.Status = httpResp.Status
+	resp.Proto = httpResp.Proto
+	resp.Header = httpResp.Header
+
+	if req.Method != http.MethodHead {
+		resp.Body, err = io.ReadAll(httpResp.Body)
+	}
+
+	return err
+}
+
+// diffHeaders returns the header fields that have different values in a and
+// b.  The Date field is ignored since it almost always differs.
+func diffHeaders(a, b http.Header) (diffs []*HeaderDiff) {
+	var names []string
+	for name := range a {
+		names = append(names, name)
+	}
+
+	for name := range b {
+		if _, ok := a[name]; !ok {
+			names = append(names, name)
+		}
+	}
+
+	names = slices.DeleteFunc(names, func(name string) (ok bool) {
+		return name == "Date"
+	})
+
+	slices.Sort(names)
+
+	for _, name := range names {
+		if !slices.Equal(a[name], b[name]) {
+			diffs = append(diffs, &HeaderDiff{
+				Name: name,
+				A:    a[name],
+				B:    b[name],
+			})
+		}
+	}
+
+	return diffs
+}
+
+// Write writes the result to out as JSON or as the human-readable text.
+func (r *Result) Write(out *output.Output, outputJSON bool) {
+	if outputJSON {
+		b, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			panic(err)
+		}
+
+		out.WriteRaw(append(b, '\n'))
+
+		return
+	}
+
+	out.WriteRaw([]byte(r.String()))
+}
+
+// String implements the fmt.Stringer interface for *Result.
+func (r *Result) String() (str string) {
+	b := &strings.Builder{}
+
+	_, _ = fmt.Fprintf(b, "--- %s\n", responseSummary(r.A))
+	_, _ = fmt.Fprintf(b, "+++ %s\n", responseSummary(r.B))
+
+	if r.Equal {
+		_, _ = fmt.Fprintf(b, "\nResponses are identical\n")
+
+		return b.String()
+	}
+
+	if len(r.Headers) > 0 {
+		_, _ = fmt.Fprintf(b, "\nHeaders:\n")
+		for _, h := range r.Headers {
+			for _, v := range h.A {
+				_, _ = fmt.Fprintf(b, "-%s: %s\n", h.Name, v)
+			}
+
+			for _, v := range h.B {
+				_, _ = fmt.Fprintf(b, "+%s: %s\n", h.Name, v)
+			}
+		}
+	}
+
+	_, _ = fmt.Fprintf(b, "\nBody: %s\n", r.Body)
+	for _, l := range r.Body.Lines {
+		_, _ = fmt.Fprintf(b, "%s%d: %s\n", l.Op, l.Line, l.Text)
+	}
+
+	return b.String()
+}
+
+// responseSummary returns the one-line summary of resp.
+func responseSummary(resp *Response) (s string) {
+	if resp.Error != "" {
+		return fmt.Sprintf("%s (error: %s)", resp.URL, resp.Error)
+	}
+
+	return fmt.Sprintf("%s (%s %s)", resp.URL, resp.Proto, resp.Status)
+}
@@ -0,0 +1,57 @@
+package compare_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/ameshkov/gocurl/internal/client"
+	"github.com/ameshkov/gocurl/internal/compare"
+	"github.com/ameshkov/gocurl/internal/config"
+	"github.com/ameshkov/gocurl/internal/output"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Version", r.URL.Path)
+		_, _ = fmt.Fprintf(w, "a\n%s\nc\n", r.URL.Path)
+	}))
+	t.Cleanup(srv.Close)
+
+	u, err := url.Parse(srv.URL + "/v1")
+	require.NoError(t, err)
+
+	compareURL, err := url.Parse(srv.URL + "/v2")
+	require.NoError(t, err)
+
+	out, err := output.NewOutput("", false)
+	require.NoError(t, err)
+
+	cfg := &config.Config{
+		RequestURL: u,
+		CompareURL: compareURL,
+	}
+
+	transport, err := client.NewTransport(cfg, out)
+	require.NoError(t, err)
+
+	r := compare.Run(cfg, transport, out)
+	require.NoError(t, r.Err())
+	require.False(t, r.Equal)
+	require.Equal(t, []*compare.HeaderDiff{{
+		Name: "X-Version",
+		A:    []string{"/v1"},
+		B:    []string{"/v2"},
+	}}, r.Headers)
+	require.Equal(t, []*compare.LineDiff{
+		{Op: "-", Text: "/v1", Line: 2},
+		{Op: "+", Text: "/v2", Line: 2},
+	}, r.Body.Lines)
+
+	cfg.CompareURL = u
+	r = compare.Run(cfg, transport, out)
+	require.True(t, r.Equal)
+}
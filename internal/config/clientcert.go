@@ -0,0 +1,340 @@
+package config
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"os"
+	"strings"
+
+	"github.com/ameshkov/gocurl/internal/pkcs11"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/pkcs12"
+)
+
+// OIDs of the algorithms of the encrypted PKCS#8 private keys, see RFC 8018.
+var (
+	oidPBES2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidAES128CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+// SplitCertArg splits the value of --cert into the file name and the
+// password.  Like in curl, the password follows the first colon and the
+// colons of the file name are escaped with a backslash.
+func SplitCertArg(arg string) (file, password string) {
+	sb := &strings.Builder{}
+	for i := 0; i < len(arg); i++ {
+		switch c := arg[i]; {
+		case c == '\\' && i+1 < len(arg) && arg[i+1] == ':':
+			sb.WriteByte(':')
+			i++
+		case c == ':':
+			return sb.String(), arg[i+1:]
+		default:
+			sb.WriteByte(c)
+		}
+	}
+
+	return sb.String(), ""
+}
+
+// loadClientCert loads the client certificate and its private key.  certArg
+// is the value of --cert, the file is either PEM or PKCS#12, or it is
+// a PKCS#11 URI.  If keyFile is
+// empty, the key of a PEM certificate is read from the same file.  The
+// password from certArg or pass decrypts the PKCS#12 file or the private key.
+// Returns nil if certArg is empty.
+func loadClientCert(certArg, keyFile, pass string) (cert *tls.Certificate, err error) {
+	if certArg == "" {
+		if keyFile != "" {
+			return nil, fmt.Errorf("key requires cert")
+		}
+
+		return nil, nil
+	}
+
+	if pkcs11.IsURI(certArg) {
+		return loadPKCS11Cert(certArg, keyFile, pass)
+	} else if pkcs11.IsURI(keyFile) {
+		return nil, fmt.Errorf("pkcs11 key requires pkcs11 cert")
+	}
+
+	certFile, password := SplitCertArg(certArg)
+	if password == "" {
+		password = pass
+	}
+
+	certData, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading client certificate: %w", err)
+	}
+
+	if block, _ := pem.Decode(certData); block == nil {
+		// Not a PEM file, so it must be a binary PKCS#12 one.
+		if keyFile != "" {
+			return nil, fmt.Errorf("key can't be used with pkcs12 cert")
+		}
+
+		return loadPKCS12(certData, password)
+	}
+
+	keyData := certData
+	if keyFile != "" {
+		keyData, err = os.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate key: %w", err)
+		}
+	}
+
+	keyData, err = decryptKeyPEM(keyData, password)
+	if err != nil {
+		return nil, fmt.Errorf("loading client certificate key: %w", err)
+	}
+
+	c, err := tls.X509KeyPair(certData, keyData)
+	if err != nil {
+		return nil, fmt.Errorf("loading client certificate: %w", err)
+	}
+
+	return &c, nil
+}
+
+// loadPKCS11Cert loads the client certificate and its private key from the
+// PKCS#11 token.  keyArg, if set, selects the private key on the same token.
+// pass is the PIN unless the URI has one.
+func loadPKCS11Cert(certArg, keyArg, pass string) (cert *tls.Certificate, err error) {
+	certURI, err := pkcs11.ParseURI(certArg)
+	if err != nil {
+		return nil, err
+	}
+
+	if certURI.PIN == "" {
+		certURI.PIN = pass
+	}
+
+	keyURI := certURI
+	if keyArg != "" {
+		if !pkcs11.IsURI(keyArg) {
+			return nil, fmt.Errorf("key must be a pkcs11 uri when cert is one")
+		}
+
+		keyURI, err = pkcs11.ParseURI(keyArg)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cert, err = pkcs11.LoadCertificate(certURI, keyURI)
+	if err != nil {
+		return nil, fmt.Errorf("loading client certificate: %w", err)
+	}
+
+	return cert, nil
+}
+
+// loadPKCS12 decodes the certificate, its chain and the private key from the
+// PKCS#12 data.  Only the legacy encryption algorithms are supported, e.g.
+// the ones used by Windows or by "openssl pkcs12 -legacy".
+func loadPKCS12(data []byte, password string) (cert *tls.Certificate, err error) {
+	// There is no maintained PKCS#12 decoder, and the deprecated one is still
+	// good for the bundles issued by the corporate CAs.
+	//
+	// nolint:staticcheck
+	blocks, err := pkcs12.ToPEM(data, password)
+	if err != nil {
+		var notImplErr pkcs12.NotImplementedError
+		if errors.As(err, &notImplErr) {
+			return nil, fmt.Errorf(
+				"decoding pkcs12 client certificate: %w, re-export it with openssl pkcs12 -legacy",
+				err,
+			)
+		}
+
+		return nil, fmt.Errorf("decoding pkcs12 client certificate: %w", err)
+	}
+
+	buf := &bytes.Buffer{}
+	for _, b := range blocks {
+		// Drop the bag attributes, they are not needed.
+		_ = pem.Encode(buf, &pem.Block{Type: b.Type, Bytes: b.Bytes})
+	}
+
+	c, err := tls.X509KeyPair(buf.Bytes(), buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("loading pkcs12 client certificate: %w", err)
+	}
+
+	return &c, nil
+}
+
+// decryptKeyPEM returns data with the encrypted private keys replaced by the
+// decrypted ones.  Both the legacy encrypted PEM blocks and the encrypted
+// PKCS#8 keys are supported.  The other blocks are kept as is.
+func decryptKeyPEM(data []byte, password string) (res []byte, err error) {
+	buf := &bytes.Buffer{}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+
+		// nolint:staticcheck
+		legacy := x509.IsEncryptedPEMBlock(block)
+		if !legacy && block.Type != "ENCRYPTED PRIVATE KEY" {
+			_ = pem.Encode(buf, block)
+
+			continue
+		}
+
+		if password == "" {
+			return nil, errors.New("private key is encrypted, but no password is set")
+		}
+
+		var der []byte
+		typ := "PRIVATE KEY"
+		if legacy {
+			// The legacy encryption is insecure by design, but this is the
+			// format of the existing keys.
+			//
+			// nolint:staticcheck
+			der, err = x509.DecryptPEMBlock(block, []byte(password))
+			typ = block.Type
+		} else {
+			der, err = decryptPKCS8(block.Bytes, password)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		_ = pem.Encode(buf, &pem.Block{Type: typ, Bytes: der})
+	}
+
+	return buf.Bytes(), nil
+}
+
+// encryptedPrivateKeyInfo is the EncryptedPrivateKeyInfo structure of RFC
+// 5208.
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+// pbes2Params is the PBES2-params structure of RFC 8018.
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+// pbkdf2Params is the PBKDF2-params structure of RFC 8018.
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// decryptPKCS8 decrypts the DER-encoded encrypted PKCS#8 private key.  Only
+// PBES2 with PBKDF2 and AES-CBC is supported, this is what OpenSSL uses by
+// default.
+func decryptPKCS8(der []byte, password string) (key []byte, err error) {
+	var info encryptedPrivateKeyInfo
+	_, err = asn1.Unmarshal(der, &info)
+	if err != nil {
+		return nil, fmt.Errorf("parsing encrypted private key: %w", err)
+	}
+
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("unsupported key encryption %s", info.Algorithm.Algorithm)
+	}
+
+	var params pbes2Params
+	_, err = asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params)
+	if err != nil {
+		return nil, fmt.Errorf("parsing pbes2 parameters: %w", err)
+	}
+
+	block, err := pbes2Cipher(params, password)
+	if err != nil {
+		return nil, err
+	}
+
+	var iv []byte
+	_, err = asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv)
+	if err != nil {
+		return nil, fmt.Errorf("parsing iv: %w", err)
+	}
+
+	data := info.EncryptedData
+	if len(iv) != block.BlockSize() || len(data) == 0 || len(data)%block.BlockSize() != 0 {
+		return nil, errors.New("invalid encrypted private key")
+	}
+
+	key = make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(key, data)
+
+	// Remove the PKCS#7 padding, an invalid one most likely means a wrong
+	// password.
+	n := int(key[len(key)-1])
+	if n == 0 || n > block.BlockSize() || !bytes.Equal(key[len(key)-n:], bytes.Repeat([]byte{byte(n)}, n)) {
+		return nil, errors.New("decrypting private key: wrong password")
+	}
+
+	return key[:len(key)-n], nil
+}
+
+// pbes2Cipher returns the AES cipher with the key derived from password
+// according to params.
+func pbes2Cipher(params pbes2Params, password string) (block cipher.Block, err error) {
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, fmt.Errorf("unsupported key derivation %s", params.KeyDerivationFunc.Algorithm)
+	}
+
+	var kdf pbkdf2Params
+	_, err = asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf)
+	if err != nil {
+		return nil, fmt.Errorf("parsing pbkdf2 parameters: %w", err)
+	}
+
+	var h func() hash.Hash
+	switch prf := kdf.PRF.Algorithm; {
+	case len(prf) == 0, prf.Equal(oidHMACWithSHA1):
+		h = sha1.New
+	case prf.Equal(oidHMACWithSHA256):
+		h = sha256.New
+	default:
+		return nil, fmt.Errorf("unsupported pbkdf2 prf %s", prf)
+	}
+
+	var keyLen int
+	switch alg := params.EncryptionScheme.Algorithm; {
+	case alg.Equal(oidAES128CBC):
+		keyLen = 16
+	case alg.Equal(oidAES192CBC):
+		keyLen = 24
+	case alg.Equal(oidAES256CBC):
+		keyLen = 32
+	default:
+		return nil, fmt.Errorf("unsupported key cipher %s", alg)
+	}
+
+	key := pbkdf2.Key([]byte(password), kdf.Salt, kdf.IterationCount, keyLen, h)
+
+	return aes.NewCipher(key)
+}
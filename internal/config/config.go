@@ -2,25 +2,78 @@
 package config
 
 import (
+	"bufio"
+	"crypto"
+	"crypto/sha256"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/base64"
+	"encoding/pem"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/AdguardTeam/dnsproxy/upstream"
 	ctls "github.com/ameshkov/cfcrypto/tls"
+	"github.com/ameshkov/gocurl/internal/cookie"
 )
 
 // Config is a strictly-typed and validated configuration structure which is
 // created from Options (command-line arguments).
 type Config struct {
-	// RequestURL is the URL where the target request will be sent.
+	// RequestURL is the URL where the target request will be sent.  If several
+	// URLs were specified, it is the first one, see RequestURLs.
 	RequestURL *url.URL
 
+	// RequestURLs is the list of all URLs requests will be sent to.  It
+	// contains more than one URL when --url-file is used.
+	RequestURLs []*url.URL
+
+	// Parallel makes gocurl process RequestURLs in parallel.
+	Parallel bool
+
+	// ParallelMax is the maximum number of parallel transfers.
+	ParallelMax int
+
+	// MaxFailures is the number of failed transfers after which no new
+	// transfers are started.  Zero means that the number of failures is not
+	// limited.  --fail-fast sets it to 1.
+	MaxFailures int
+
+	// RetryBudget is the total number of retries of the failed requests
+	// shared by all RequestURLs.
+	RetryBudget int
+
+	// Retry is the number of retries of every request after transient errors,
+	// see --retry.  Zero means the request is not retried.
+	Retry int
+
+	// RetryDelay is the fixed delay between the retries.  Zero means the
+	// exponential backoff.
+	RetryDelay time.Duration
+
+	// RetryMaxTime is the maximum duration since the first attempt after
+	// which the request is not retried.  Zero means no limit.
+	RetryMaxTime time.Duration
+
+	// RetryAllErrors makes any error and any 4xx or 5xx response retried.
+	RetryAllErrors bool
+
+	// RetryConnRefused makes the refused connection a transient error.
+	RetryConnRefused bool
+
 	// Method is the HTTP method of the request.
 	Method string
 
@@ -28,8 +81,109 @@ type Config struct {
 	// headers will be written to the output.
 	Head bool
 
-	// Data specifies the data to be sent to the HTTP server.
-	Data string
+	// Fail is true if the transfer fails when the response status is 400 or
+	// greater, see --fail.
+	Fail bool
+
+	// FailWithBody is like Fail, but the response body is written, see
+	// --fail-with-body.
+	FailWithBody bool
+
+	// Range is the byte range set, e.g. "0-1023,-500", that is requested with
+	// the Range header, see --range.  If empty, the whole resource is
+	// requested.
+	Range string
+
+	// FollowRedirects makes the client follow redirects, see --location.
+	FollowRedirects bool
+
+	// MaxRedirects is the maximum number of redirects to follow.  Negative
+	// value means no limit.
+	MaxRedirects int
+
+	// RedirectKeepPost is the set of redirect status codes after which POST
+	// is not changed to GET, see --post301, --post302 and --post303.
+	RedirectKeepPost map[int]struct{}
+
+	// LocationTrusted makes the client send the credentials to other origins
+	// when following redirects, see --location-trusted.
+	LocationTrusted bool
+
+	// Data is the list of the parts of the data to be sent to the HTTP
+	// server, the --data and --data-urlencode values in the command-line
+	// order.  The parts are joined with "&".  It may contain credentials so it
+	// is redacted when the configuration is dumped.
+	Data []*DataPart `redact:"true"`
+
+	// Form is the list of the fields of the multipart/form-data body, see
+	// --form.  It may contain credentials as well.
+	Form []*FormField `redact:"true"`
+
+	// UploadFile is the path to the file that is sent as the body of the PUT
+	// request, see --upload-file and StdinFile.
+	UploadFile string
+
+	// CompressRequest is the encoding the request body is compressed with:
+	// "gzip", "br" or "zstd".  If empty, the body is not compressed.
+	CompressRequest string
+
+	// SignFormat is the format of the request signature, see
+	// --sign-format.
+	SignFormat SignFormat
+
+	// SignAlgorithm is the algorithm used to sign requests, "hmac-sha256" or
+	// "hmac-sha512" for SignFormatHMAC and one of the RFC 9421 algorithms for
+	// SignFormatRFC9421.  If empty, requests are not signed.
+	SignAlgorithm string
+
+	// SignKey is the HMAC key.
+	SignKey string `redact:"true"`
+
+	// SignPrivateKey is the private key of the asymmetric RFC 9421
+	// algorithms.
+	SignPrivateKey crypto.Signer `redact:"true"`
+
+	// SignHeader is the name of the header the signature is added to.  For
+	// SignFormatRFC9421 it is the label of the signature instead.
+	SignHeader string
+
+	// SignKeyID is the keyid parameter of the RFC 9421 signature, see
+	// --sign-keyid.
+	SignKeyID string
+
+	// SignFields is the list of fields that are joined with newlines into
+	// the signed string, see the --sign-fields description.  For
+	// SignFormatRFC9421 it is the list of the covered components.
+	SignFields []string
+
+	// Cookie is the value of the Cookie header from --cookie.
+	Cookie string `redact:"true"`
+
+	// Cookies are the cookies read from the cookie file from --cookie, see
+	// cookie.Parse.  Only the ones that match the request URL are sent.
+	Cookies []*http.Cookie `redact:"true"`
+
+	// CookieJar is the path to the cookie file the received cookies are
+	// written to, see --cookie-jar.
+	CookieJar string
+
+	// JunkSessionCookies makes the session cookies not written to CookieJar,
+	// see --junk-session-cookies.
+	JunkSessionCookies bool
+
+	// User is the user name and password for Basic authentication, see
+	// --user.  The password is not set if it must be prompted for.
+	User *url.Userinfo `redact:"true"`
+
+	// AuthScheme is the authentication scheme that answers the challenge of
+	// the server, "digest", "ntlm", "negotiate" or "anyauth" for the strongest
+	// one the server offers.  If empty, the credentials are sent using Basic
+	// authentication.
+	AuthScheme string
+
+	// AWSSigV4 is the configuration of AWS Signature Version 4 signing, see
+	// --aws-sigv4.  If nil, requests are not signed.
+	AWSSigV4 *AWSSigV4
 
 	// Headers is the HTTP headers that will be added to the request.
 	Headers http.Header
@@ -37,13 +191,82 @@ type Config struct {
 	// ProxyURL is a URL of a proxy to use with this connection.
 	ProxyURL *url.URL
 
+	// ProxyFallbackURLs are the proxies that are tried in order when the
+	// connection through ProxyURL fails.
+	ProxyFallbackURLs []*url.URL
+
+	// ProxyFallbackDirect makes gocurl connect directly when all the proxies
+	// failed.
+	ProxyFallbackDirect bool
+
+	// PreproxyURL is a URL of the SOCKS5 proxy that the connections to the
+	// proxies are established through.  It is nil if there is no pre-proxy.
+	PreproxyURL *url.URL
+
+	// ProxyUser are the credentials for the HTTP and HTTPS proxies from
+	// --proxy-user.  If nil, the ones from the proxy URL are used.
+	ProxyUser *url.Userinfo `redact:"true"`
+
+	// ProxyAuthScheme is the authentication scheme for the HTTP and HTTPS
+	// proxies: "digest", "ntlm", "anyauth" or empty for Basic.
+	ProxyAuthScheme string
+
+	// ProxyInsecure disables TLS verification of the HTTPS proxies.
+	ProxyInsecure bool
+
+	// ProxyClientCert is the client certificate for the HTTPS proxies.  It is
+	// nil if the client certificate is not used.
+	ProxyClientCert *tls.Certificate `redact:"true"`
+
+	// ProxyRootCAs are the CA certificates to verify the HTTPS proxies with.
+	// It is nil if the system ones are used.
+	ProxyRootCAs *x509.CertPool
+
+	// ProxyTLSMinVersion is a minimum supported TLS version for the HTTPS
+	// proxies.
+	ProxyTLSMinVersion uint16
+
+	// ProxyTLSMaxVersion is a maximum supported TLS version for the HTTPS
+	// proxies.
+	ProxyTLSMaxVersion uint16
+
+	// ProxyTLSCiphers is a list of ciphers for the HTTPS proxies.
+	ProxyTLSCiphers []uint16
+
 	// ConnectTo is a mapping of "host1:port1" to "host2:port2" pairs that
-	// allows retargeting the connection.
+	// allows retargeting the connection.  Like in curl, any of the fields can
+	// be empty: empty host1 or port1 match any host or port, empty host2 or
+	// port2 keep the original host or port.
 	ConnectTo map[string]string
 
 	// Insecure disables TLS verification of the connection.
 	Insecure bool
 
+	// ClientCert is the client certificate for mutual TLS.  It is nil if the
+	// client certificate is not used.
+	ClientCert *tls.Certificate `redact:"true"`
+
+	// RootCAs are the CA certificates to verify the server certificate with.
+	// It is nil if the system ones are used.
+	RootCAs *x509.CertPool
+
+	// CANative is true if the system CA certificates are used together with
+	// the ones from --cacert and --capath.
+	CANative bool
+
+	// PinnedPubKeys are the SHA-256 hashes of the public keys, one of which
+	// must be in the server certificate chain.  It is nil if the public key
+	// is not pinned.
+	PinnedPubKeys [][]byte
+
+	// CertStatus requires the server to staple the OCSP response with the good
+	// status of its certificate.
+	CertStatus bool
+
+	// CRLs are the certificate revocation lists to check the server
+	// certificate chain against.
+	CRLs []*x509.RevocationList
+
 	// TLSMinVersion is a minimum supported TLS version.
 	TLSMinVersion uint16
 
@@ -54,6 +277,11 @@ type Config struct {
 	// ClientHello.
 	TLSCiphers []uint16
 
+	// Front is the domain that is used for the TLS server name and as the
+	// connection target while the Host header and the certificate
+	// verification use the request URL host (domain fronting).
+	Front string
+
 	// TLSServerName allows to send a specified server name in the TLS
 	// ClientHello extension.
 	TLSServerName string
@@ -67,6 +295,14 @@ type Config struct {
 	// ForceHTTP2 forces using HTTP/3.
 	ForceHTTP3 bool
 
+	// TryHTTP3 makes gocurl attempt HTTP/3 first and fall back to HTTP/2 or
+	// HTTP/1.1 if it fails.
+	TryHTTP3 bool
+
+	// HTTP3ALPN is the list of ALPN identifiers offered for HTTP/3
+	// connections.  If empty, only "h3" is offered.
+	HTTP3ALPN []string
+
 	// ECH forces usage of Encrypted Client Hello for the request.  If other
 	// ECH-related fields are not specified, the ECH configuration will be
 	// received from the DNS settings.
@@ -81,6 +317,48 @@ type Config struct {
 	// the host name).
 	Resolve map[string][]net.IP
 
+	// Hosts is a map of host:ips pairs read from the hosts file, see
+	// --hosts-file.  Host names are in lower case without the trailing dot.
+	Hosts map[string][]net.IP
+
+	// MaxTime is the maximum duration of the whole operation including the
+	// retries, see --max-time.  Zero means no timeout.
+	MaxTime time.Duration
+
+	// DNSTimeout is the maximum duration of resolving a host name.  Zero
+	// means no timeout.
+	DNSTimeout time.Duration
+
+	// TLSHandshakeTimeout is the maximum duration of the TLS or QUIC
+	// handshake.  Zero means no timeout.
+	TLSHandshakeTimeout time.Duration
+
+	// ResponseHeaderTimeout is the maximum duration of waiting for the
+	// response header after the request is sent.  Zero means no timeout.
+	ResponseHeaderTimeout time.Duration
+
+	// ReadTimeout is the maximum duration of waiting for the next data of the
+	// response body.  Zero means no timeout.
+	ReadTimeout time.Duration
+
+	// SpeedLimit is the minimum speed of receiving the response in bytes per
+	// second, see --speed-limit.  Zero means that the speed is not checked.
+	SpeedLimit int64
+
+	// SpeedTime is the duration during which the speed may stay below
+	// SpeedLimit.
+	SpeedTime time.Duration
+
+	// Expect100Timeout is the maximum duration of waiting for the 100 Continue
+	// response to Expect: 100-continue before the body is sent anyway, see
+	// --expect100-timeout.
+	Expect100Timeout time.Duration
+
+	// ResolveHosts is a map of host:target pairs.  The target host name is
+	// resolved instead of the host, see --resolve.  '*' can be used instead
+	// of the host name.
+	ResolveHosts map[string]string
+
 	// IPv4 if configured forces usage of IP4 addresses only when doing DNS
 	// resolution.
 	IPv4 bool
@@ -101,13 +379,239 @@ type Config struct {
 	// chunk of ClientHello.
 	TLSSplitDelay int
 
+	// HTTPMangle is a list of ways to modify plain HTTP requests, see
+	// httpmangle.Mode.
+	HTTPMangle []string
+
+	// IPTOS is the value of the IP TOS field (traffic class for IPv6) of the
+	// outgoing packets.  Zero means that the system default is used.
+	IPTOS int
+
+	// IPTTL is the IP TTL (hop limit for IPv6) of the outgoing packets.  Zero
+	// means that the system default is used.
+	IPTTL int
+
+	// MPTCP requests Multipath TCP for the connections.
+	MPTCP bool
+
+	// TCPMSS is the TCP maximum segment size of the outgoing connections.
+	// Zero means that the system default is used.
+	TCPMSS int
+
+	// SockOpts is the list of arbitrary socket options in the
+	// "level:name:value" format.  They are parsed by the dialer since the
+	// symbolic names are platform-specific.
+	SockOpts []string
+
+	// WriteJitterMin is the minimum delay in milliseconds between writes to
+	// the connection.
+	WriteJitterMin int
+
+	// WriteJitterMax is the maximum delay in milliseconds between writes to
+	// the connection.  Zero means that there is no delay.
+	WriteJitterMax int
+
+	// TCPDisorder makes the first part of ClientHello split by
+	// --tls-split-hello to be delivered after the second one.
+	TCPDisorder bool
+
+	// TLSSplitSNIOffsets are the points relative to the beginning of the
+	// server name where ClientHello is split.
+	TLSSplitSNIOffsets []int
+
+	// TLSSplitSNIDelay is a delay in milliseconds before sending each next
+	// part of ClientHello split at the server name.
+	TLSSplitSNIDelay int
+
+	// TLSFakeSNI is the server name of the decoy ClientHello that is sent
+	// before the real one.  If empty, the decoy is not sent.
+	TLSFakeSNI string
+
+	// TLSFakeTTL is the TTL of the packet with the decoy ClientHello.
+	TLSFakeTTL int
+
+	// QUICSplit is the number of QUIC Initial packets ClientHello is split
+	// into.  Values less than 2 mean no splitting.
+	QUICSplit int
+
+	// QUICReorder makes the QUIC Initial packets with ClientHello parts to be
+	// sent in the reversed order.
+	QUICReorder bool
+
+	// QUICInitialSize is the minimum size of datagrams with QUIC Initial
+	// packets.
+	QUICInitialSize int
+
+	// QUICIdleTimeout is the idle timeout of QUIC connections.  Zero means
+	// the default timeout of quic-go.
+	QUICIdleTimeout time.Duration
+
+	// QUICKeepAlive is the period of QUIC keep-alive packets.  Zero means
+	// that they are not sent.
+	QUICKeepAlive time.Duration
+
+	// QUICStreamWindow is the initial flow-control limit of QUIC streams.
+	// Zero means the default limit of quic-go.
+	QUICStreamWindow uint64
+
+	// QUICConnWindow is the initial flow-control limit of QUIC connections.
+	// Zero means the default limit of quic-go.
+	QUICConnWindow uint64
+
+	// QUICVersion is the QUIC version number, see --quic-version.  Zero means
+	// the default version of quic-go.
+	QUICVersion uint32
+
+	// FakeSegmentTTL is the TTL of the fake segment sent before ClientHello,
+	// see ExpFakeTTL.  Zero means that the fake segment is not sent.
+	FakeSegmentTTL int
+
+	// TLSRecordSplitSize is the maximum size of the ClientHello data in a
+	// single TLS record.  If set, ClientHello is split into several records.
+	TLSRecordSplitSize int
+
 	// OutputJSON enables writing output in JSON format.
 	OutputJSON bool
 
+	// JSONHeadersMap makes the JSON output contain the response headers as a
+	// map instead of an ordered list of name/value pairs.
+	JSONHeadersMap bool
+
 	// OutputPath defines where to write the received data. If not set, the
 	// received data will be written to stdout.
 	OutputPath string
 
+	// RemoteName is true if the received data is written to the file named
+	// like the remote one, see --remote-name.
+	RemoteName bool
+
+	// RemoteHeaderName is true if the name of the file for RemoteName is
+	// taken from the Content-Disposition header, see --remote-header-name.
+	RemoteHeaderName bool
+
+	// OutputTemplate is the template of the path where the received data of
+	// every URL is written, see OutputFile.  If set, OutputPath is empty.
+	OutputTemplate string
+
+	// OutputDir is the directory of the output files, see --output-dir.  It
+	// is already applied to OutputPath.
+	OutputDir string
+
+	// CreateDirs is true if the missing directories of the output files
+	// must be created, see --create-dirs.
+	CreateDirs bool
+
+	// URLNumber is the 1-based number of RequestURL in RequestURLs.  It is
+	// used in OutputTemplate.
+	URLNumber int
+
+	// ContinueAt is the byte offset the download is resumed from, see
+	// --continue-at.  If positive, the rest of the resource is requested and
+	// appended to OutputPath.
+	ContinueAt int64
+
+	// MetricsFile is the path to the file where the metrics of every
+	// transfer are appended.  If empty, the metrics are not written.
+	MetricsFile string
+
+	// DumpHeader is the path to the file where the response headers are
+	// written, see --dump-header.  "-" means stdout.  If empty, the headers
+	// are not written.
+	DumpHeader string
+
+	// WriteOut is the format of the information about the transfer that is
+	// written to stdout after it's completed, see -w/--write-out.  If empty,
+	// nothing is written.
+	WriteOut string
+
+	// WriteOutFile is the path to the file the WriteOut format is read from,
+	// see StdinFile and LoadWriteOut.  If empty, WriteOut is used as is.
+	WriteOutFile string
+
+	// SaveExchange is the directory where every transfer is saved, see
+	// --save-exchange.  If empty, transfers are not saved.
+	SaveExchange string
+
+	// SessionFile is the path to the session file, see --session.  If empty,
+	// no state is kept between invocations.
+	SessionFile string
+
+	// GenerateGoFile is the path to the file where the Go code that makes the
+	// same request is written, see --generate-go.  "-" means stdout.
+	GenerateGoFile string
+
+	// Repeat is the number of times the request will be repeated in the
+	// benchmark mode.  Zero means that the benchmark mode is disabled.
+	Repeat int
+
+	// Concurrency is the number of workers that send requests concurrently in
+	// the benchmark mode.
+	Concurrency int
+
+	// Interval is the interval between attempts in the watch mode.  Zero
+	// means that the watch mode is disabled.
+	Interval time.Duration
+
+	// ConnectOnly enables the raw mode, in this mode gocurl only establishes
+	// the connection, prints its information and timings, and bridges
+	// stdin/stdout to it.  The URL scheme defines the connection type: https
+	// and wss for TLS (QUIC with --http3), http, ws, tcp and udp for plain
+	// connections.
+	ConnectOnly bool
+
+	// CompareURL is the URL the response from RequestURL is compared with,
+	// see --compare-with.  It is nil if the comparison mode is not used.
+	CompareURL *url.URL
+
+	// UntilStatus is the status code that stops the watch mode.  Zero means
+	// that any status code does not stop it.
+	UntilStatus int
+
+	// MaxIterations is the maximum number of attempts in the watch mode.  Zero
+	// means that the number of attempts is not limited.
+	MaxIterations int
+
+	// ExpectStatus is the expected response status code.  Zero means that
+	// the status code is not checked.
+	ExpectStatus int
+
+	// ExpectHeaders is the list of response headers whose values must match
+	// the regular expressions.
+	ExpectHeaders []*HeaderExpectation
+
+	// ExpectBodyRegexp is the regular expression the response body must
+	// match.  Nil means that the body is not checked.
+	ExpectBodyRegexp *regexp.Regexp
+
+	// ExpectMaxTime is the maximum duration of the request including reading
+	// the response body.  Zero means that the duration is not checked.
+	ExpectMaxTime time.Duration
+
+	// LimitRate is the maximum download speed in bytes per second, see
+	// --limit-rate.  Zero means that the speed is not limited.
+	LimitRate int64
+
+	// LimitRateUpload is the maximum upload speed in bytes per second.  Zero
+	// means that the speed is not limited.  --limit-rate sets it unless
+	// --limit-rate-upload is specified.
+	LimitRateUpload int64
+
+	// MaxHeaderSize is the maximum size of the response header in bytes.
+	// Zero means that the default limits of the transports are used.
+	MaxHeaderSize int64
+
+	// MaxMemory is the maximum number of bytes of a response body that are
+	// buffered in memory, the rest is spilled to a temporary file.  Zero
+	// means that the size is not limited.
+	MaxMemory int64
+
+	// CharsetConvert makes gocurl convert text response bodies to UTF-8.
+	CharsetConvert bool
+
+	// CacheDir is the directory of the HTTP cache.  If empty, the responses
+	// are not cached.
+	CacheDir string
+
 	// Experiments is a map where the key is Experiment and value is its
 	// optional configuration.
 	Experiments map[Experiment]string
@@ -119,6 +623,17 @@ type Config struct {
 	RawOptions *Options
 }
 
+// defaultParallelMax is the default maximum number of parallel transfers.
+const defaultParallelMax = 50
+
+// defaultMaxRedirects is the default maximum number of redirects to follow,
+// it is the same as in curl.
+const defaultMaxRedirects = 50
+
+// defaultExpect100Timeout is the default duration of waiting for the 100
+// Continue response, it is the same as in curl.
+const defaultExpect100Timeout = 1 * time.Second
+
 // Experiment is an enumeration of experimental features available for us via
 // the --experiment flag.
 type Experiment string
@@ -127,71 +642,259 @@ const (
 	// ExpNone is just an empty value, not an experiment.
 	ExpNone Experiment = ""
 
+	// ExpFakeTTL makes gocurl send a segment with random data and a low TTL
+	// before ClientHello.  The value is the TTL, defaultFakeTTL by default.
+	// Only supported on Linux.
+	ExpFakeTTL Experiment = "fake-ttl"
+
 	// ExpPostQuantum stands for post-quantum cryptography.  See the website for
 	// more details: https://pq.cloudflareresearch.com/.
 	ExpPostQuantum Experiment = "pq"
 )
 
+// SignFormat is the format of the request signature, see --sign-format.
+type SignFormat string
+
+// Supported SignFormat values.
+const (
+	// SignFormatHMAC is the hex-encoded HMAC of the fields from --sign-fields
+	// in a single header.
+	SignFormatHMAC SignFormat = "hmac"
+
+	// SignFormatRFC9421 is HTTP Message Signatures, see RFC 9421.
+	SignFormatRFC9421 SignFormat = "rfc9421"
+)
+
+// FormField is a field of the multipart/form-data body, see --form.
+type FormField struct {
+	// Name is the name of the field.
+	Name string
+
+	// Value is the value of the field.  It is empty if File is set.
+	Value string
+
+	// File is the path to the file that is uploaded as the value of the
+	// field.
+	File string
+
+	// ContentType is the content type of the part from the type attribute.
+	// If empty, it's guessed from the extension of File.
+	ContentType string
+
+	// Filename is the file name of the part from the filename attribute.  If
+	// empty, the base name of File is used.
+	Filename string
+}
+
+// AWSSigV4 is the configuration of AWS Signature Version 4 signing.
+type AWSSigV4 struct {
+	// Provider1 is used in the algorithm name and the credential scope, e.g.
+	// "aws" gives AWS4-HMAC-SHA256.
+	Provider1 string
+
+	// Provider2 is used in the names of the headers, e.g. "amz" gives
+	// X-Amz-Date.
+	Provider2 string
+
+	// Region is the region of the service.  If empty, it's taken from the
+	// host name.
+	Region string
+
+	// Service is the name of the service.  If empty, it's taken from the
+	// host name.
+	Service string
+}
+
+// HeaderExpectation is the expected value of a response header, see
+// --expect-header.
+type HeaderExpectation struct {
+	// Name is the name of the header.
+	Name string
+
+	// Regexp is the regular expression the header value must match.
+	Regexp *regexp.Regexp
+}
+
 // NewExperiment tries to create an Experiment from string.  Returns error if
 // the string is not a valid member of the enumeration.
 func NewExperiment(str string) (e Experiment, err error) {
 	switch str {
 	case string(ExpPostQuantum):
 		return ExpPostQuantum, nil
+	case string(ExpFakeTTL):
+		return ExpFakeTTL, nil
 	}
 
 	return ExpNone, fmt.Errorf("invalid experiment name: %s", str)
 }
 
-// ParseConfig parses and validates os.Args and returns the final *Config
-// object.
+// ParseConfig parses and validates the command-line arguments args (without
+// the program name) and returns the final *Config object.
 //
 // Disable gocyclo for ParseConfig as it's supposed to be a large function with
 // if conditions.
 //
 // nolint:gocyclo
-func ParseConfig() (cfg *Config, err error) {
-	opts, err := parseOptions()
+func ParseConfig(args []string) (cfg *Config, err error) {
+	opts, err := parseOptions(args)
 
 	if err != nil {
 		return nil, err
 	}
 
 	cfg = &Config{
-		Method:        opts.Method,
-		Head:          opts.Head,
-		Insecure:      opts.Insecure,
-		Data:          opts.Data,
-		OutputJSON:    opts.OutputJSON,
-		OutputPath:    opts.OutputPath,
-		Verbose:       opts.Verbose,
-		ForceHTTP11:   opts.HTTPv11,
-		ForceHTTP2:    opts.HTTPv2,
-		ForceHTTP3:    opts.HTTPv3,
-		ECH:           opts.ECH,
-		IPv4:          opts.IPv4,
-		IPv6:          opts.IPv6,
-		TLSServerName: opts.TLSServerName,
-		RawOptions:    opts,
+		Method:         opts.Method,
+		Head:           opts.Head,
+		Insecure:       opts.Insecure,
+		OutputJSON:     opts.OutputJSON,
+		JSONHeadersMap: opts.JSONHeadersMap,
+		OutputPath:     opts.OutputPath,
+		CacheDir:       opts.CacheDir,
+		MetricsFile:    opts.MetricsFile,
+		DumpHeader:     opts.DumpHeader,
+		SaveExchange:   opts.SaveExchange,
+		SessionFile:    opts.SessionFile,
+		GenerateGoFile: opts.GenerateGo,
+		CharsetConvert: opts.CharsetConvert,
+		Verbose:        opts.Verbose,
+		ForceHTTP11:    opts.HTTPv11,
+		ForceHTTP2:     opts.HTTPv2,
+		ForceHTTP3:     opts.HTTPv3 || opts.HTTPv3Only,
+		TryHTTP3:       opts.HTTPv3Try,
+		ECH:            opts.ECH,
+		Front:          opts.Front,
+		IPv4:           opts.IPv4,
+		IPv6:           opts.IPv6,
+		TLSServerName:  opts.TLSServerName,
+		RawOptions:     opts,
+	}
+
+	if opts.ConnectOnly && opts.URL != "" && !strings.Contains(opts.URL, "://") {
+		// Allow specifying host:port like in openssl s_client.
+		opts.URL = "https://" + opts.URL
 	}
 
-	cfg.RequestURL, err = url.Parse(opts.URL)
+	cfg.RequestURLs, err = parseRequestURLs(opts.URL, opts.URLFile)
 	if err != nil {
-		return nil, fmt.Errorf("invalid URL specified %s: %w", opts.URL, err)
+		return nil, err
 	}
 
-	if cfg.RequestURL.Scheme == "" {
-		// Use http scheme by default.
-		cfg.RequestURL.Scheme = "http"
+	cfg.RequestURL = cfg.RequestURLs[0]
+	cfg.URLNumber = 1
+
+	if opts.Fail && opts.FailWithBody {
+		return nil, fmt.Errorf("fail cannot be used together with fail-with-body")
+	}
+
+	cfg.Fail, cfg.FailWithBody = opts.Fail, opts.FailWithBody
+
+	if cfg.TryHTTP3 && (cfg.ForceHTTP11 || cfg.ForceHTTP2 || cfg.ForceHTTP3) {
+		return nil, fmt.Errorf("http3-try cannot be used together with http1.1, http2 or http3")
+	}
+
+	cfg.Data, err = parseData(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.Form, err = parseForm(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.HasData() && cfg.Form != nil {
+		return nil, fmt.Errorf("form cannot be used together with data")
+	}
+
+	err = parseUploadFile(cfg, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.Range, err = parseRange(string(opts.Range))
+	if err != nil {
+		return nil, fmt.Errorf("invalid range %q: %w", opts.Range, err)
+	}
+
+	cfg.RemoteName, cfg.RemoteHeaderName, err = parseRemoteName(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = parseOutput(cfg, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.ContinueAt, err = parseContinueAt(opts, cfg.OutputPath)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.WriteOut, cfg.WriteOutFile, err = parseWriteOut(opts.WriteOut)
+	if err != nil {
+		return nil, fmt.Errorf("invalid write-out: %w", err)
+	}
+
+	switch opts.CompressRequest {
+	case "", "gzip", "br", "zstd":
+		cfg.CompressRequest = opts.CompressRequest
+	default:
+		return nil, fmt.Errorf("invalid compress-request: %q, must be gzip, br or zstd", opts.CompressRequest)
+	}
+
+	err = parseSign(cfg, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = parseCookie(cfg, opts)
+	if err != nil {
+		return nil, err
 	}
 
-	if opts.ProxyURL != "" {
-		cfg.ProxyURL, err = url.Parse(opts.ProxyURL)
+	if opts.User != "" {
+		cfg.User, err = parseUser(opts.User)
 		if err != nil {
-			return nil, fmt.Errorf("invalid proxy URL specified %s: %w", opts.ProxyURL, err)
+			return nil, fmt.Errorf("invalid user: %w", err)
 		}
 	}
 
+	err = parseAuthScheme(cfg, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = parseAWSSigV4(cfg, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = parseLocation(cfg, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.Parallel, cfg.ParallelMax, err = parseParallel(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.MaxFailures, cfg.RetryBudget, err = parseFailureLimits(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = parseRetry(cfg, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = parseProxies(cfg, opts)
+	if err != nil {
+		return nil, err
+	}
+
 	if len(opts.ConnectTo) > 0 {
 		cfg.ConnectTo, err = parseConnectTo(opts.ConnectTo)
 		if err != nil {
@@ -200,12 +903,19 @@ func ParseConfig() (cfg *Config, err error) {
 	}
 
 	if len(opts.Resolve) > 0 {
-		cfg.Resolve, err = parseResolve(opts.Resolve)
+		cfg.Resolve, cfg.ResolveHosts, err = parseResolve(opts.Resolve)
 		if err != nil {
 			return nil, fmt.Errorf("invalid resolve specified %v: %w", opts.Resolve, err)
 		}
 	}
 
+	if opts.HostsFile != "" {
+		cfg.Hosts, err = readHostsFile(opts.HostsFile)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hosts-file %s: %w", opts.HostsFile, err)
+		}
+	}
+
 	if opts.DNSServers != "" {
 		cfg.DNSServers, err = parseDNSServers(opts.DNSServers)
 		if err != nil {
@@ -234,17 +944,9 @@ func ParseConfig() (cfg *Config, err error) {
 	}
 
 	if opts.TLSCiphers != "" {
-		cipherNames := strings.Split(opts.TLSCiphers, " ")
-		cfg.TLSCiphers = []uint16{}
-
-		for _, cipherName := range cipherNames {
-			cipher := getCipherSuiteByName(cipherName)
-
-			if cipher == 0 {
-				return nil, fmt.Errorf("cipher %s not found", cipherName)
-			}
-
-			cfg.TLSCiphers = append(cfg.TLSCiphers, cipher)
+		cfg.TLSCiphers, err = parseCiphers(opts.TLSCiphers)
+		if err != nil {
+			return nil, err
 		}
 	}
 
@@ -255,79 +957,1710 @@ func ParseConfig() (cfg *Config, err error) {
 		}
 	}
 
-	if opts.ECHConfig != "" {
-		cfg.ECHConfigs, err = unmarshalECHConfigs(opts.ECHConfig)
-		if err != nil {
-			return nil, fmt.Errorf("invalid echconfig: %w", err)
-		}
+	if opts.IPTOS < 0 || opts.IPTOS > 255 {
+		return nil, fmt.Errorf("ip-tos must be between 0 and 255: %d", opts.IPTOS)
+	}
+	cfg.IPTOS = opts.IPTOS
 
-		// --echconfig implicitly enables --ech as well.
-		cfg.ECH = true
+	if opts.IPTTL < 0 || opts.IPTTL > 255 {
+		return nil, fmt.Errorf("ip-ttl must be between 1 and 255: %d", opts.IPTTL)
 	}
+	cfg.IPTTL = opts.IPTTL
 
-	if len(opts.Experiments) > 0 {
-		cfg.Experiments, err = parseExperiments(opts.Experiments)
+	if opts.TCPMSS < 0 {
+		return nil, fmt.Errorf("invalid tcp-mss: %d", opts.TCPMSS)
+	}
+	cfg.TCPMSS = opts.TCPMSS
+	cfg.SockOpts = opts.SockOpts
+	cfg.MPTCP = opts.MPTCP
+
+	if opts.WriteJitter != "" {
+		cfg.WriteJitterMin, cfg.WriteJitterMax, err = parseWriteJitter(opts.WriteJitter)
 		if err != nil {
-			return nil, fmt.Errorf("invalid experiments %v: %w", opts.Experiments, err)
+			return nil, fmt.Errorf("invalid write-jitter: %w", err)
 		}
 	}
 
-	return cfg, nil
-}
+	if opts.TCPDisorder && opts.TLSSplitHello == "" {
+		return nil, fmt.Errorf("tcp-disorder can only be used with tls-split-hello")
+	}
 
-// getCipherSuiteByName tries to get the cipher suite by its name. Returns 0
-// if no matching cipher found.
-func getCipherSuiteByName(cipherName string) (cipher uint16) {
-	for _, c := range tls.CipherSuites() {
-		if c.Name == cipherName {
-			return c.ID
-		}
+	if opts.TCPDisorder && hasHTTPSProxy(cfg) {
+		// The TCP connection is hidden under the TLS one to the proxy.
+		return nil, fmt.Errorf("tcp-disorder cannot be used with an https proxy")
 	}
+	cfg.TCPDisorder = opts.TCPDisorder
+	cfg.HTTPMangle = opts.HTTPMangle
 
-	for _, c := range tls.InsecureCipherSuites() {
-		if c.Name == cipherName {
-			return c.ID
+	if opts.TLSSplitSNI != "" {
+		if opts.TLSSplitHello != "" {
+			return nil, fmt.Errorf("tls-split-sni cannot be used with tls-split-hello")
 		}
-	}
 
-	return 0
-}
+		cfg.TLSSplitSNIOffsets, cfg.TLSSplitSNIDelay, err = parseTLSSplitSNI(opts.TLSSplitSNI)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tls-split-sni: %w", err)
+		}
+	}
 
-// parseConnectTo creates a "connect-to" map from the string representation.
-func parseConnectTo(connectTo []string) (m map[string]string, err error) {
-	m = map[string]string{}
-	for _, ct := range connectTo {
-		parts := strings.SplitN(ct, ":", 4)
-		if len(parts) != 4 {
-			return nil, fmt.Errorf("invalid connect-to format %s, expected HOST1:PORT1:HOST2:PORT2", ct)
+	if opts.TLSFakeHello != "" {
+		cfg.TLSFakeSNI, cfg.TLSFakeTTL, err = parseTLSFakeHello(opts.TLSFakeHello)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tls-fake-hello: %w", err)
 		}
+	}
 
-		oldHost := parts[0] + ":" + parts[1]
-		newHost := parts[2] + ":" + parts[3]
-		m[oldHost] = newHost
+	cfg.QUICSplit, cfg.QUICReorder, cfg.QUICInitialSize, err = parseQUICShaping(opts)
+	if err != nil {
+		return nil, err
 	}
 
-	return m, nil
-}
+	err = parsePhaseTimeouts(cfg, opts)
+	if err != nil {
+		return nil, err
+	}
 
-// parseResolve creates a "resolve" map from the string representation.
-func parseResolve(resolve []string) (m map[string][]net.IP, err error) {
-	m = map[string][]net.IP{}
+	cfg.SpeedLimit, cfg.SpeedTime, err = parseSpeedLimit(opts)
+	if err != nil {
+		return nil, err
+	}
 
-	for _, r := range resolve {
+	cfg.QUICIdleTimeout, cfg.QUICKeepAlive, err = parseQUICTimeouts(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.QUICStreamWindow, cfg.QUICConnWindow, err = parseQUICWindows(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.QUICVersion, err = parseQUICVersion(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.HTTP3ALPN, err = parseHTTP3ALPN(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.TLSRecordSplit < 0 {
+		return nil, fmt.Errorf("invalid tls-record-split: %d", opts.TLSRecordSplit)
+	}
+	cfg.TLSRecordSplitSize = opts.TLSRecordSplit
+
+	cfg.ClientCert, err = loadClientCert(opts.Cert, opts.Key, opts.Pass)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.RootCAs, err = loadRootCAs(opts.CACert, opts.CAPath, opts.CANative)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.CANative = opts.CANative
+
+	cfg.PinnedPubKeys, err = parsePinnedPubKey(opts.PinnedPubKey)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.CertStatus = opts.CertStatus
+
+	cfg.CRLs, err = loadCRLs(opts.CRLFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.ECHConfig != "" {
+		cfg.ECHConfigs, err = unmarshalECHConfigs(opts.ECHConfig)
+		if err != nil {
+			return nil, fmt.Errorf("invalid echconfig: %w", err)
+		}
+
+		// --echconfig implicitly enables --ech as well.
+		cfg.ECH = true
+	}
+
+	cfg.Repeat, cfg.Concurrency, err = parseBenchmark(opts.Repeat, opts.Concurrency)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validateWatch(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.Interval = opts.Interval
+	cfg.UntilStatus = opts.UntilStatus
+	cfg.MaxIterations = opts.MaxIterations
+
+	err = parseExpectations(cfg, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.LimitRate != "" {
+		cfg.LimitRate, err = parseSize(opts.LimitRate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid limit-rate: %w", err)
+		}
+
+		cfg.LimitRateUpload = cfg.LimitRate
+	}
+
+	if opts.LimitRateUpload != "" {
+		cfg.LimitRateUpload, err = parseSize(opts.LimitRateUpload)
+		if err != nil {
+			return nil, fmt.Errorf("invalid limit-rate-upload: %w", err)
+		}
+	}
+
+	if opts.MaxHeaderSize != "" {
+		cfg.MaxHeaderSize, err = parseSize(opts.MaxHeaderSize)
+		if err != nil {
+			return nil, fmt.Errorf("invalid max-header-size: %w", err)
+		}
+	}
+
+	if opts.MaxMemory != "" {
+		cfg.MaxMemory, err = parseSize(opts.MaxMemory)
+		if err != nil {
+			return nil, fmt.Errorf("invalid max-memory: %w", err)
+		}
+	}
+
+	if len(opts.Experiments) > 0 {
+		cfg.Experiments, err = parseExperiments(opts.Experiments)
+		if err != nil {
+			return nil, fmt.Errorf("invalid experiments %v: %w", opts.Experiments, err)
+		}
+	}
+
+	cfg.FakeSegmentTTL, err = parseFakeTTL(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validateFront(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.ConnectOnly = opts.ConnectOnly
+	err = validateConnectOnly(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	err = parseCompareWith(cfg, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validateMQTT(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// parseFakeTTL returns the TTL of the fake segment if the fake-ttl experiment
+// is enabled.
+func parseFakeTTL(cfg *Config) (ttl int, err error) {
+	value, ok := cfg.Experiments[ExpFakeTTL]
+	if !ok {
+		return 0, nil
+	}
+
+	if runtime.GOOS != "linux" {
+		return 0, fmt.Errorf("experiment %s is only supported on linux", ExpFakeTTL)
+	}
+
+	if cfg.TLSFakeSNI != "" {
+		return 0, fmt.Errorf("experiment %s cannot be used together with tls-fake-hello", ExpFakeTTL)
+	}
+
+	if value == "" {
+		return defaultFakeTTL, nil
+	}
+
+	ttl, err = strconv.Atoi(value)
+	if err != nil || ttl < 1 || ttl > 255 {
+		return 0, fmt.Errorf("invalid %s ttl: %s", ExpFakeTTL, value)
+	}
+
+	return ttl, nil
+}
+
+// validateFront checks that --front is not used together with options it
+// conflicts with.
+func validateFront(cfg *Config) (err error) {
+	if cfg.Front == "" {
+		return nil
+	}
+
+	if cfg.TLSServerName != "" {
+		return fmt.Errorf("front cannot be used together with tls-servername")
+	}
+
+	// ECH and post-quantum handshakes don't support the custom certificate
+	// verification that --front relies on.
+	_, postQuantum := cfg.Experiments[ExpPostQuantum]
+	if cfg.ECH || postQuantum {
+		return fmt.Errorf("front cannot be used together with ech or post-quantum")
+	}
+
+	return nil
+}
+
+// WithURL returns a shallow copy of the configuration with RequestURL set to
+// u.  It is used when requests are sent to several URLs.
+func (c *Config) WithURL(u *url.URL) (clone *Config) {
+	clone = &Config{}
+	*clone = *c
+	clone.RequestURL = u
+
+	return clone
+}
+
+// OutputFile returns the path of the file for the received data of
+// RequestURL made from OutputTemplate.  The URL parts are sanitized so that
+// they can't point outside of the directory the template refers to.
+func (c *Config) OutputFile() (p string) {
+	u := c.RequestURL
+
+	// Cleaning the rooted path removes all the ".." segments.
+	urlPath := strings.TrimPrefix(path.Clean("/"+u.Path), "/")
+	if urlPath == "" {
+		urlPath = "index"
+	}
+
+	r := strings.NewReplacer(
+		"{host}", u.Hostname(),
+		"{port}", u.Port(),
+		"{path}", urlPath,
+		"{file}", path.Base(urlPath),
+		"{query}", strings.ReplaceAll(u.RawQuery, "/", "_"),
+		"{n}", strconv.Itoa(c.URLNumber),
+	)
+
+	p = filepath.FromSlash(r.Replace(c.OutputTemplate))
+	if c.OutputDir != "" && !filepath.IsAbs(p) {
+		p = filepath.Join(c.OutputDir, p)
+	}
+
+	return p
+}
+
+// HasData returns true if there is data to be sent, see Data.
+func (c *Config) HasData() (ok bool) {
+	return len(c.Data) > 0
+}
+
+// HasDataFiles returns true if any part of Data is read from a file.
+func (c *Config) HasDataFiles() (ok bool) {
+	for _, p := range c.Data {
+		if p.File != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ReadData returns the data to be sent, all parts of Data joined with "&".
+// The files are read to memory.
+func (c *Config) ReadData() (data []byte, err error) {
+	parts := make([]string, 0, len(c.Data))
+	for _, p := range c.Data {
+		var part string
+		part, err = p.read()
+		if err != nil {
+			return nil, fmt.Errorf("reading data: %w", err)
+		}
+
+		parts = append(parts, part)
+	}
+
+	return []byte(strings.Join(parts, "&")), nil
+}
+
+// ReadsStdin returns true if the request body is read from stdin, see
+// StdinFile.
+func (c *Config) ReadsStdin() (ok bool) {
+	if c.UploadFile == StdinFile {
+		return true
+	}
+
+	for _, p := range c.Data {
+		if p.File == StdinFile {
+			return true
+		}
+	}
+
+	return false
+}
+
+// WithStdinFile returns a copy of c where the request body parts that are
+// read from stdin are read from the file at path instead.
+func (c *Config) WithStdinFile(path string) (clone *Config) {
+	clone = &Config{}
+	*clone = *c
+
+	if clone.UploadFile == StdinFile {
+		clone.UploadFile = path
+	}
+
+	clone.Data = make([]*DataPart, 0, len(c.Data))
+	for _, p := range c.Data {
+		if p.File == StdinFile {
+			fileP := *p
+			fileP.File = path
+			p = &fileP
+		}
+
+		clone.Data = append(clone.Data, p)
+	}
+
+	return clone
+}
+
+// LoadWriteOut reads the WriteOut format from WriteOutFile if it's set.  It
+// is not done when the configuration is parsed so that the file, which may
+// be stdin, is only read when the format is actually needed.
+func (c *Config) LoadWriteOut() (err error) {
+	if c.WriteOutFile == "" {
+		return nil
+	}
+
+	var b []byte
+	if c.WriteOutFile == StdinFile {
+		b, err = io.ReadAll(os.Stdin)
+	} else {
+		b, err = os.ReadFile(c.WriteOutFile)
+	}
+
+	if err != nil {
+		return fmt.Errorf("reading write-out: %w", err)
+	}
+
+	c.WriteOut, c.WriteOutFile = string(b), ""
+
+	return nil
+}
+
+// HasExpectations returns true if any of the response assertions is
+// configured, see --expect-status and the other --expect-* options.
+func (c *Config) HasExpectations() (ok bool) {
+	return c.ExpectStatus != 0 ||
+		len(c.ExpectHeaders) > 0 ||
+		c.ExpectBodyRegexp != nil ||
+		c.ExpectMaxTime != 0
+}
+
+// JSONLines returns true if the output should be written in the JSON Lines
+// format, i.e. one JSON object per line.  This is the case when there are
+// several URLs and JSON output is enabled.
+func (c *Config) JSONLines() (ok bool) {
+	return c.OutputJSON && len(c.RequestURLs) > 1
+}
+
+// parseRequestURL parses the request URL and uses http scheme when it is not
+// specified.
+func parseRequestURL(str string) (u *url.URL, err error) {
+	u, err = url.Parse(str)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL specified %s: %w", str, err)
+	}
+
+	if u.Scheme == "" {
+		// Use http scheme by default.
+		u.Scheme = "http"
+	}
+
+	return u, nil
+}
+
+// parseRequestURLs parses the URL specified in the command-line arguments and
+// the URLs from the --url-file.  Empty lines and lines starting with '#' are
+// ignored in the file.
+func parseRequestURLs(urlStr, urlFile string) (urls []*url.URL, err error) {
+	if urlStr != "" {
+		var u *url.URL
+		u, err = parseRequestURL(urlStr)
+		if err != nil {
+			return nil, err
+		}
+
+		urls = append(urls, u)
+	}
+
+	if urlFile != "" {
+		var fileURLs []*url.URL
+		fileURLs, err = readURLFile(urlFile)
+		if err != nil {
+			return nil, fmt.Errorf("invalid url-file %s: %w", urlFile, err)
+		}
+
+		urls = append(urls, fileURLs...)
+	}
+
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("no URLs specified")
+	}
+
+	return urls, nil
+}
+
+// readURLFile reads URLs from the file or from stdin if path is "-".
+func readURLFile(path string) (urls []*url.URL, err error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		var f *os.File
+		f, err = os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = f.Close() }()
+
+		r = f
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var u *url.URL
+		u, err = parseRequestURL(line)
+		if err != nil {
+			return nil, err
+		}
+
+		urls = append(urls, u)
+	}
+
+	return urls, scanner.Err()
+}
+
+// StdinFile is the DataPart.File, UploadFile and WriteOutFile value that
+// means the data is read from stdin.
+const StdinFile = "-"
+
+// DataPart is a part of the request body made from a --data or
+// --data-urlencode value.  The files are not read when the configuration is
+// parsed, they are read when the request is sent.
+type DataPart struct {
+	// Data is the data of the part.  It is empty if File is set.
+	Data string
+
+	// Name is the name the URL-encoded content of File is prefixed with, see
+	// --data-urlencode.  It may be empty.
+	Name string
+
+	// File is the path to the file the data is read from, see StdinFile.
+	File string
+
+	// URLEncode is true if the content of File is URL-encoded.  Otherwise,
+	// the newlines are removed from it like in curl.
+	URLEncode bool
+}
+
+// read returns the data of the part, the file is read to memory.
+func (p *DataPart) read() (data string, err error) {
+	if p.File == "" {
+		return p.Data, nil
+	}
+
+	var b []byte
+	if p.File == StdinFile {
+		b, err = io.ReadAll(os.Stdin)
+	} else {
+		b, err = os.ReadFile(p.File)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	if !p.URLEncode {
+		return newlineRemover.Replace(string(b)), nil
+	}
+
+	data = EscapeData(string(b))
+	if p.Name != "" {
+		data = p.Name + "=" + data
+	}
+
+	return data, nil
+}
+
+// parseData returns the parts of the data from the --data and
+// --data-urlencode values in the command-line order.  Like in curl, the
+// values that start with "@" are read from the file or from stdin if the name
+// is "-".  Only the existence of the files is checked here.
+func parseData(opts *Options) (parts []*DataPart, err error) {
+	for _, v := range opts.Data.Values() {
+		option, part := "data", &DataPart{Data: v.Value}
+		if v.URLEncode {
+			option, part = "data-urlencode", parseDataURLEncode(v.Value)
+		} else if file, ok := strings.CutPrefix(v.Value, "@"); ok {
+			part = &DataPart{File: file}
+		}
+
+		if part.File != "" && part.File != StdinFile {
+			_, err = os.Stat(part.File)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s %q: %w", option, v.Value, err)
+			}
+		}
+
+		parts = append(parts, part)
+	}
+
+	return parts, nil
+}
+
+// newlineRemover removes the newlines from the --data files.
+var newlineRemover = strings.NewReplacer("\r", "", "\n", "")
+
+// parseUploadFile sets --upload-file to cfg.  Like in curl, the name of the
+// file is appended to the request URLs that have no file part, i.e. end with
+// "/".
+func parseUploadFile(cfg *Config, opts *Options) (err error) {
+	if opts.UploadFile == "" {
+		return nil
+	}
+
+	if cfg.HasData() || cfg.Form != nil {
+		return fmt.Errorf("upload-file cannot be used together with data or form")
+	}
+
+	cfg.UploadFile = opts.UploadFile
+	if cfg.UploadFile == StdinFile {
+		return nil
+	}
+
+	name := filepath.Base(cfg.UploadFile)
+	for _, u := range cfg.RequestURLs {
+		if u.Path == "" || strings.HasSuffix(u.Path, "/") {
+			u.Path = strings.TrimSuffix(u.Path, "/") + "/" + name
+			u.RawPath = ""
+		}
+	}
+
+	return nil
+}
+
+// parseRange validates the --range value which is a comma-separated list of
+// byte ranges in the curl format: "first-last", "first-" or "-suffix".
+func parseRange(s string) (r string, err error) {
+	if s == "" {
+		return "", nil
+	}
+
+	for _, part := range strings.Split(s, ",") {
+		first, last, ok := strings.Cut(strings.TrimSpace(part), "-")
+		if !ok || first == "" && last == "" {
+			return "", fmt.Errorf("expected first-last, first- or -suffix, got %q", part)
+		}
+
+		var from, to uint64
+		if first != "" {
+			from, err = strconv.ParseUint(first, 10, 64)
+			if err != nil {
+				return "", err
+			}
+		}
+
+		if last != "" {
+			to, err = strconv.ParseUint(last, 10, 64)
+			if err != nil {
+				return "", err
+			}
+		}
+
+		if first != "" && last != "" && to < from {
+			return "", fmt.Errorf("last byte %d is less than first byte %d", to, from)
+		}
+	}
+
+	return strings.ReplaceAll(s, " ", ""), nil
+}
+
+// parseContinueAt returns the offset for --continue-at.  Like in curl, "-"
+// means the size of the --output file, which is zero if it doesn't exist yet.
+func parseContinueAt(opts *Options, outputPath string) (offset int64, err error) {
+	switch {
+	case opts.ContinueAt == "":
+		return 0, nil
+	case opts.Range != "":
+		return 0, fmt.Errorf("continue-at cannot be used together with range")
+	case opts.ContinueAt != "-":
+		offset, err = strconv.ParseInt(opts.ContinueAt, 10, 64)
+		if err != nil || offset < 0 {
+			return 0, fmt.Errorf("invalid continue-at: %q", opts.ContinueAt)
+		}
+
+		return offset, nil
+	case outputPath == "":
+		return 0, fmt.Errorf("continue-at - requires output")
+	}
+
+	fi, err := os.Stat(outputPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("continue-at: %w", err)
+	}
+
+	return fi.Size(), nil
+}
+
+// outputPlaceholders are the placeholders of the --output template, see
+// Config.OutputFile.
+var outputPlaceholders = []string{"{host}", "{port}", "{path}", "{file}", "{query}", "{n}"}
+
+// parseOutput applies --output-dir and --create-dirs to cfg and detects the
+// --output template.
+func parseOutput(cfg *Config, opts *Options) (err error) {
+	cfg.OutputDir = opts.OutputDir
+	cfg.CreateDirs = opts.CreateDirs
+
+	if cfg.OutputPath == "" {
+		return nil
+	}
+
+	for _, p := range outputPlaceholders {
+		if strings.Contains(cfg.OutputPath, p) {
+			cfg.OutputTemplate, cfg.OutputPath = cfg.OutputPath, ""
+
+			break
+		}
+	}
+
+	if cfg.OutputTemplate != "" && opts.ContinueAt != "" {
+		return fmt.Errorf("continue-at cannot be used together with output template")
+	}
+
+	if cfg.OutputPath != "" && cfg.OutputDir != "" && !filepath.IsAbs(cfg.OutputPath) {
+		cfg.OutputPath = filepath.Join(cfg.OutputDir, cfg.OutputPath)
+	}
+
+	return nil
+}
+
+// parseRemoteName validates --remote-name and --remote-header-name.
+func parseRemoteName(opts *Options) (remoteName, remoteHeaderName bool, err error) {
+	switch {
+	case opts.RemoteHeaderName && !opts.RemoteName:
+		return false, false, fmt.Errorf("remote-header-name requires remote-name")
+	case opts.RemoteName && opts.OutputPath != "":
+		return false, false, fmt.Errorf("remote-name cannot be used together with output")
+	case opts.RemoteName && opts.ContinueAt != "":
+		// Only --output can be appended to.
+		return false, false, fmt.Errorf("remote-name cannot be used together with continue-at")
+	default:
+		return opts.RemoteName, opts.RemoteHeaderName, nil
+	}
+}
+
+// parseWriteOut returns the format of -w/--write-out.  If s starts with "@",
+// the format is read from the file later and its path is returned instead,
+// see Config.LoadWriteOut.
+func parseWriteOut(s string) (format, file string, err error) {
+	path, ok := strings.CutPrefix(s, "@")
+	if !ok {
+		return s, "", nil
+	}
+
+	if path != StdinFile {
+		_, err = os.Stat(path)
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	return "", path, nil
+}
+
+// parseForm parses the --form values which have the curl formats: name=value
+// or name=@file, optionally followed by the ;type= and ;filename= attributes.
+// The file name may be quoted to contain semicolons.
+func parseForm(opts *Options) (fields []*FormField, err error) {
+	for _, f := range opts.Form {
+		var field *FormField
+		field, err = parseFormField(f)
+		if err != nil {
+			return nil, fmt.Errorf("invalid form %q: %w", f, err)
+		}
+
+		fields = append(fields, field)
+	}
+
+	return fields, nil
+}
+
+// parseFormField parses a single --form value.
+func parseFormField(f string) (field *FormField, err error) {
+	name, value, ok := strings.Cut(f, "=")
+	if !ok || name == "" {
+		return nil, fmt.Errorf("must be name=value or name=@file")
+	}
+
+	field = &FormField{Name: name}
+
+	var attrs string
+	if file, isFile := strings.CutPrefix(value, "@"); isFile {
+		field.File, attrs, err = cutFormContent(file)
+		if err != nil {
+			return nil, err
+		} else if field.File == "" {
+			return nil, fmt.Errorf("empty file name")
+		}
+	} else {
+		field.Value, attrs, err = cutFormContent(value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, attr := range strings.Split(attrs, ";")[1:] {
+		k, v, _ := strings.Cut(attr, "=")
+		switch strings.ToLower(strings.TrimSpace(k)) {
+		case "type":
+			field.ContentType = strings.TrimSpace(v)
+		case "filename":
+			field.Filename = strings.Trim(strings.TrimSpace(v), `"`)
+		default:
+			return nil, fmt.Errorf("unsupported attribute %q", attr)
+		}
+	}
+
+	return field, nil
+}
+
+// cutFormContent splits the value or the file name of the --form value v from
+// its attributes.  attrs is either empty or starts with ";".
+func cutFormContent(v string) (content, attrs string, err error) {
+	if strings.HasPrefix(v, `"`) {
+		content, attrs, err = readQuoted(v)
+		if err != nil {
+			return "", "", err
+		} else if attrs != "" && !strings.HasPrefix(attrs, ";") {
+			return "", "", fmt.Errorf("unexpected %q after the quoted string", attrs)
+		}
+
+		return content, attrs, nil
+	}
+
+	lower := strings.ToLower(v)
+	end := len(v)
+	for _, attr := range []string{";type=", ";filename="} {
+		if i := strings.Index(lower, attr); i >= 0 && i < end {
+			end = i
+		}
+	}
+
+	return v[:end], v[end:], nil
+}
+
+// readQuoted reads the quoted string with backslash escapes from the start of
+// s.
+func readQuoted(s string) (value, rest string, err error) {
+	b := &strings.Builder{}
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				b.WriteByte(s[i])
+			}
+		case '"':
+			return b.String(), s[i+1:], nil
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return "", "", fmt.Errorf("unterminated quoted string")
+}
+
+// parseDataURLEncode parses the --data-urlencode value d which has one of
+// the curl formats: "content", "=content", "name=content", "@file", or
+// "name@file".  The content is URL-encoded right away, the file is encoded
+// when it's read.  The name is not encoded.
+func parseDataURLEncode(d string) (part *DataPart) {
+	name, content := "", d
+	if i := strings.IndexAny(d, "=@"); i >= 0 {
+		name, content = d[:i], d[i+1:]
+
+		if d[i] == '@' {
+			return &DataPart{Name: name, File: content, URLEncode: true}
+		}
+	}
+
+	data := EscapeData(content)
+	if name != "" {
+		data = name + "=" + data
+	}
+
+	return &DataPart{Data: data}
+}
+
+// EscapeData URL-encodes s like curl does for --data-urlencode.
+func EscapeData(s string) (escaped string) {
+	// curl encodes spaces as %20 and not as "+".
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+// defaultSignHeader is the default header for the request signature.
+const defaultSignHeader = "X-Signature"
+
+// defaultSignLabel is the default label of the RFC 9421 signature.
+const defaultSignLabel = "sig1"
+
+// defaultSignFields is the default list of the signed fields.
+const defaultSignFields = "method,path,date,body-sha256"
+
+// defaultSignComponents is the default list of the components covered by the
+// RFC 9421 signature.  Content-Digest is also covered if there is a body.
+const defaultSignComponents = "@method,@target-uri"
+
+// parseSign parses --sign, --sign-format, --sign-fields and --sign-keyid and
+// sets the corresponding cfg fields.
+func parseSign(cfg *Config, opts *Options) (err error) {
+	if opts.Sign == "" {
+		if opts.SignFields != "" || opts.SignFormat != "" || opts.SignKeyID != "" {
+			return fmt.Errorf("sign-fields, sign-format and sign-keyid require sign")
+		}
+
+		return nil
+	}
+
+	// Don't print the whole value in errors as it contains the key.
+	parts := strings.SplitN(opts.Sign, ":", 3)
+	if len(parts) < 2 || parts[1] == "" {
+		return fmt.Errorf("invalid sign value, must be algorithm:key[:header]")
+	}
+
+	switch f := SignFormat(opts.SignFormat); f {
+	case "", SignFormatHMAC:
+		if opts.SignKeyID != "" {
+			return fmt.Errorf("sign-keyid requires sign-format %s", SignFormatRFC9421)
+		}
+
+		cfg.SignFormat = SignFormatHMAC
+
+		return parseSignHMAC(cfg, parts, opts.SignFields)
+	case SignFormatRFC9421:
+		cfg.SignFormat = f
+		cfg.SignKeyID = opts.SignKeyID
+
+		return parseSignRFC9421(cfg, parts, opts.SignFields)
+	default:
+		return fmt.Errorf("invalid sign-format: %q, must be hmac or rfc9421", opts.SignFormat)
+	}
+}
+
+// parseSignHMAC parses the parts of --sign and --sign-fields for
+// SignFormatHMAC and sets the corresponding cfg fields.
+func parseSignHMAC(cfg *Config, parts []string, fields string) (err error) {
+	switch parts[0] {
+	case "hmac-sha256", "hmac-sha512":
+		cfg.SignAlgorithm = parts[0]
+	default:
+		return fmt.Errorf("unsupported sign algorithm: %s", parts[0])
+	}
+
+	cfg.SignKey = parts[1]
+	cfg.SignHeader = defaultSignHeader
+	if len(parts) == 3 && parts[2] != "" {
+		cfg.SignHeader = parts[2]
+	}
+
+	if fields == "" {
+		fields = defaultSignFields
+	}
+
+	for _, f := range strings.Split(fields, ",") {
+		f = strings.TrimSpace(f)
+		switch {
+		case f == "method", f == "path", f == "host", f == "date", f == "body-sha256":
+		case strings.HasPrefix(f, "header:") && len(f) > len("header:"):
+		default:
+			return fmt.Errorf("invalid sign field: %q", f)
+		}
+
+		cfg.SignFields = append(cfg.SignFields, f)
+	}
+
+	return nil
+}
+
+// parseSignRFC9421 parses the parts of --sign and --sign-fields for
+// SignFormatRFC9421 and sets the corresponding cfg fields.  The key is the
+// secret for hmac-sha256 and the path to the PEM private key otherwise.
+func parseSignRFC9421(cfg *Config, parts []string, fields string) (err error) {
+	cfg.SignAlgorithm = parts[0]
+	switch parts[0] {
+	case "hmac-sha256":
+		cfg.SignKey = parts[1]
+	case "ed25519", "ecdsa-p256-sha256", "rsa-pss-sha512", "rsa-v1_5-sha256":
+		cfg.SignPrivateKey, err = loadSignKey(parts[1])
+		if err != nil {
+			return fmt.Errorf("loading sign key: %w", err)
+		}
+	default:
+		return fmt.Errorf("unsupported sign algorithm: %s", parts[0])
+	}
+
+	cfg.SignHeader = defaultSignLabel
+	if len(parts) == 3 && parts[2] != "" {
+		cfg.SignHeader = parts[2]
+	}
+
+	if fields == "" {
+		fields = defaultSignComponents
+		if cfg.HasData() || cfg.Form != nil || cfg.UploadFile != "" {
+			fields += ",content-digest"
+		}
+	}
+
+	for _, c := range strings.Split(fields, ",") {
+		c = strings.ToLower(strings.TrimSpace(c))
+		if c == "" || strings.ContainsAny(c, "\"; ") {
+			return fmt.Errorf("invalid sign component: %q", c)
+		}
+
+		cfg.SignFields = append(cfg.SignFields, c)
+	}
+
+	return nil
+}
+
+// loadSignKey loads the PKCS #8, PKCS #1 or SEC 1 private key from the PEM
+// file.
+func loadSignKey(file string) (key crypto.Signer, err error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in %s", file)
+	}
+
+	var k any
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		k, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		k, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		k, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	key, ok := k.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported key type %T", k)
+	}
+
+	return key, nil
+}
+
+// parseProxies parses the proxies from all --proxy options, each of which can
+// be a comma-separated list, and --proxy-fallback and sets the corresponding
+// cfg fields.
+func parseProxies(cfg *Config, opts *Options) (err error) {
+	if opts.ProxyFallback != "" {
+		if opts.ProxyFallback != "direct" {
+			return fmt.Errorf("unsupported proxy-fallback value: %s", opts.ProxyFallback)
+		}
+
+		if len(opts.ProxyURL) == 0 {
+			return fmt.Errorf("proxy-fallback requires proxy")
+		}
+
+		cfg.ProxyFallbackDirect = true
+	}
+
+	if len(opts.ProxyURL) == 0 {
+		if opts.Preproxy != "" {
+			return fmt.Errorf("preproxy requires proxy")
+		}
+
+		return nil
+	}
+
+	err = parseProxyAuth(cfg, opts)
+	if err != nil {
+		return err
+	}
+
+	err = parseProxyTLS(cfg, opts)
+	if err != nil {
+		return err
+	}
+
+	for i, s := range strings.Split(strings.Join(opts.ProxyURL, ","), ",") {
+		var u *url.URL
+		u, err = url.Parse(strings.TrimSpace(s))
+		if err != nil {
+			return fmt.Errorf("invalid proxy URL specified %s: %w", s, err)
+		}
+
+		if i == 0 {
+			cfg.ProxyURL = u
+		} else {
+			cfg.ProxyFallbackURLs = append(cfg.ProxyFallbackURLs, u)
+		}
+	}
+
+	return parsePreproxy(cfg, opts)
+}
+
+// hasHTTPSProxy returns true if any of the proxies from cfg is an HTTPS one.
+func hasHTTPSProxy(cfg *Config) (ok bool) {
+	if cfg.ProxyURL == nil {
+		return false
+	}
+
+	for _, p := range append([]*url.URL{cfg.ProxyURL}, cfg.ProxyFallbackURLs...) {
+		if p.Scheme == "https" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parsePreproxy parses --preproxy and sets it to cfg.  The pre-proxy must be a
+// SOCKS5 one and the proxies must be HTTP or HTTPS ones as the SOCKS5 client
+// always connects to its proxy directly.
+func parsePreproxy(cfg *Config, opts *Options) (err error) {
+	if opts.Preproxy == "" {
+		return nil
+	}
+
+	u, err := url.Parse(opts.Preproxy)
+	if err != nil {
+		return fmt.Errorf("invalid preproxy URL specified %s: %w", opts.Preproxy, err)
+	}
+
+	if u.Scheme != "socks5" && u.Scheme != "socks5h" {
+		return fmt.Errorf("unsupported preproxy scheme: %s", u.Scheme)
+	}
+
+	for _, p := range append([]*url.URL{cfg.ProxyURL}, cfg.ProxyFallbackURLs...) {
+		if p.Scheme != "http" && p.Scheme != "https" {
+			return fmt.Errorf("preproxy requires http or https proxy, got %s", p.Scheme)
+		}
+	}
+
+	cfg.PreproxyURL = u
+
+	return nil
+}
+
+// parseProxyAuth parses --proxy-user and the proxy authentication schemes and
+// sets them to cfg.
+func parseProxyAuth(cfg *Config, opts *Options) (err error) {
+	if opts.ProxyUser != "" {
+		cfg.ProxyUser, err = parseUser(opts.ProxyUser)
+		if err != nil {
+			return fmt.Errorf("invalid proxy-user: %w", err)
+		}
+	}
+
+	var schemes []string
+	for scheme, ok := range map[string]bool{
+		"digest":  opts.ProxyDigest,
+		"ntlm":    opts.ProxyNTLM,
+		"anyauth": opts.ProxyAnyAuth,
+	} {
+		if ok {
+			schemes = append(schemes, scheme)
+		}
+	}
+
+	switch len(schemes) {
+	case 0:
+		return nil
+	case 1:
+		cfg.ProxyAuthScheme = schemes[0]
+
+		return nil
+	default:
+		slices.Sort(schemes)
+
+		return fmt.Errorf("proxy-%s cannot be used together", strings.Join(schemes, ", proxy-"))
+	}
+}
+
+// parseProxyTLS parses the TLS options of the HTTPS proxies and sets them to
+// cfg.  They don't depend on the TLS options of the request.
+func parseProxyTLS(cfg *Config, opts *Options) (err error) {
+	cfg.ProxyInsecure = opts.ProxyInsecure
+
+	cfg.ProxyClientCert, err = loadClientCert(opts.ProxyCert, opts.ProxyKey, opts.ProxyPass)
+	if err != nil {
+		return fmt.Errorf("proxy client certificate: %w", err)
+	}
+
+	cfg.ProxyRootCAs, err = loadRootCAs(opts.ProxyCACert, opts.ProxyCAPath, false)
+	if err != nil {
+		return fmt.Errorf("proxy ca certificates: %w", err)
+	}
+
+	if opts.ProxyTLSv12 {
+		cfg.ProxyTLSMinVersion = tls.VersionTLS12
+	}
+
+	if opts.ProxyTLSv13 {
+		cfg.ProxyTLSMinVersion = tls.VersionTLS13
+	}
+
+	switch opts.ProxyTLSMax {
+	case "":
+		// Go on.
+	case "1.2":
+		cfg.ProxyTLSMaxVersion = tls.VersionTLS12
+	case "1.3":
+		cfg.ProxyTLSMaxVersion = tls.VersionTLS13
+	default:
+		return fmt.Errorf("unsupported proxy-tls-max value: %s", opts.ProxyTLSMax)
+	}
+
+	if opts.ProxyCiphers != "" {
+		cfg.ProxyTLSCiphers, err = parseCiphers(opts.ProxyCiphers)
+		if err != nil {
+			return fmt.Errorf("invalid proxy-ciphers: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// loadRootCAs loads the CA certificates from the caFile PEM file and from the
+// files in the caPath directory.  If native is true, they are added to the
+// system ones.  Returns nil if the system CA certificates are used as is.
+func loadRootCAs(caFile, caPath string, native bool) (pool *x509.CertPool, err error) {
+	if caFile == "" && caPath == "" {
+		return nil, nil
+	}
+
+	pool = x509.NewCertPool()
+	if native {
+		// On Windows and macOS, this pool makes crypto/x509 use the platform
+		// verifier first and the added certificates after it.
+		pool, err = x509.SystemCertPool()
+		if err != nil {
+			return nil, fmt.Errorf("loading system ca certificates: %w", err)
+		}
+	}
+
+	if caFile != "" {
+		var b []byte
+		b, err = os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading cacert: %w", err)
+		}
+
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("no certificates found in cacert %s", caFile)
+		}
+	}
+
+	if caPath != "" {
+		err = loadCAPath(pool, caPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return pool, nil
+}
+
+// loadCAPath adds the certificates from the PEM files in dir to pool.  Like in
+// OpenSSL, the files may have any names, e.g. the hashed ones created by
+// c_rehash.  The files without certificates are skipped, but the directory
+// must contain at least one.
+func loadCAPath(pool *x509.CertPool, dir string) (err error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("reading capath: %w", err)
+	}
+
+	found := false
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+
+		// The hashed names are usually symlinks, os.ReadFile follows them and
+		// the pool skips the duplicates.
+		b, readErr := os.ReadFile(filepath.Join(dir, e.Name()))
+		if readErr != nil {
+			return fmt.Errorf("reading capath: %w", readErr)
+		}
+
+		if pool.AppendCertsFromPEM(b) {
+			found = true
+		}
+	}
+
+	if !found {
+		return fmt.Errorf("no certificates found in capath %s", dir)
+	}
+
+	return nil
+}
+
+// loadCRLs loads the certificate revocation lists from the PEM or DER file.
+// Returns nil if path is empty.
+func loadCRLs(path string) (crls []*x509.RevocationList, err error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading crlfile: %w", err)
+	}
+
+	if block, _ := pem.Decode(data); block == nil {
+		// Not a PEM file, so it must be a single DER-encoded list.
+		var crl *x509.RevocationList
+		crl, err = x509.ParseRevocationList(data)
+		if err != nil {
+			return nil, fmt.Errorf("parsing crlfile: %w", err)
+		}
+
+		return []*x509.RevocationList{crl}, nil
+	}
+
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+
+		if block.Type != "X509 CRL" {
+			continue
+		}
+
+		var crl *x509.RevocationList
+		crl, err = x509.ParseRevocationList(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parsing crlfile: %w", err)
+		}
+
+		crls = append(crls, crl)
+	}
+
+	if len(crls) == 0 {
+		return nil, fmt.Errorf("no crls found in crlfile %s", path)
+	}
+
+	return crls, nil
+}
+
+// pinnedPubKeyPrefix is the prefix of the public key hashes in
+// --pinnedpubkey.
+const pinnedPubKeyPrefix = "sha256//"
+
+// parsePinnedPubKey parses --pinnedpubkey and returns the SHA-256 hashes of
+// the pinned public keys.  Like in curl, s is either a list of the base64
+// hashes with the "sha256//" prefix separated by semicolons or the file with
+// the public key.  Returns nil if s is empty.
+func parsePinnedPubKey(s string) (pins [][]byte, err error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	if !strings.HasPrefix(s, pinnedPubKeyPrefix) {
+		var pin []byte
+		pin, err = readPubKeyHash(s)
+		if err != nil {
+			return nil, fmt.Errorf("reading pinnedpubkey: %w", err)
+		}
+
+		return [][]byte{pin}, nil
+	}
+
+	for _, h := range strings.Split(s, ";") {
+		b64, ok := strings.CutPrefix(strings.TrimSpace(h), pinnedPubKeyPrefix)
+		if !ok {
+			return nil, fmt.Errorf("invalid pinnedpubkey hash %q", h)
+		}
+
+		pin, decErr := base64.StdEncoding.DecodeString(b64)
+		if decErr != nil || len(pin) != sha256.Size {
+			return nil, fmt.Errorf("invalid pinnedpubkey hash %q", h)
+		}
+
+		pins = append(pins, pin)
+	}
+
+	return pins, nil
+}
+
+// readPubKeyHash reads the public key from the PEM or DER file and returns
+// the SHA-256 hash of its DER encoding.
+func readPubKeyHash(path string) (pin []byte, err error) {
+	der, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if block, _ := pem.Decode(der); block != nil {
+		der = block.Bytes
+	}
+
+	// Make sure that this is a public key and not some other file.
+	_, err = x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(der)
+
+	return sum[:], nil
+}
+
+// parseCookie parses --cookie, --cookie-jar and --junk-session-cookies and
+// sets either the cookies to send as is or the ones read from the cookie file
+// to cfg.
+func parseCookie(cfg *Config, opts *Options) (err error) {
+	cfg.CookieJar = opts.CookieJar
+	cfg.JunkSessionCookies = opts.JunkSessionCookies
+	if cfg.JunkSessionCookies && cfg.CookieJar == "" {
+		return fmt.Errorf("junk-session-cookies requires cookie-jar")
+	}
+
+	switch {
+	case opts.Cookie == "":
+		return nil
+	case strings.Contains(opts.Cookie, "="):
+		cfg.Cookie = opts.Cookie
+
+		return nil
+	}
+
+	cfg.Cookies, err = cookie.ReadFile(opts.Cookie)
+	if err != nil {
+		return fmt.Errorf("reading cookie file: %w", err)
+	}
+
+	return nil
+}
+
+// parseUser parses the user:password pair.  The password may be omitted.
+func parseUser(s string) (u *url.Userinfo, err error) {
+	name, password, hasPassword := strings.Cut(s, ":")
+	if name == "" {
+		return nil, fmt.Errorf("empty user name")
+	}
+
+	if !hasPassword {
+		return url.User(name), nil
+	}
+
+	return url.UserPassword(name, password), nil
+}
+
+// parseAuthScheme sets the authentication scheme to cfg, see --digest, --ntlm,
+// --negotiate and --anyauth.  All of them except Negotiate use the credentials
+// from the URL if --user is not specified.
+func parseAuthScheme(cfg *Config, opts *Options) (err error) {
+	var schemes []string
+	for scheme, ok := range map[string]bool{
+		"digest":    opts.Digest,
+		"ntlm":      opts.NTLM,
+		"negotiate": opts.Negotiate,
+		"anyauth":   opts.AnyAuth,
+	} {
+		if ok {
+			schemes = append(schemes, scheme)
+		}
+	}
+
+	switch len(schemes) {
+	case 0:
+		return nil
+	case 1:
+		cfg.AuthScheme = schemes[0]
+	default:
+		slices.Sort(schemes)
+
+		return fmt.Errorf("%s cannot be used together", strings.Join(schemes, ", "))
+	}
+
+	if cfg.AuthScheme == "ntlm" {
+		if cfg.ForceHTTP2 || cfg.ForceHTTP3 || cfg.TryHTTP3 {
+			return fmt.Errorf("ntlm requires http1.1")
+		}
+
+		// The handshake is bound to the connection, which can't be done
+		// with multiplexed HTTP/2 and HTTP/3 streams.
+		cfg.ForceHTTP11 = true
+	}
+
+	if cfg.AuthScheme == "negotiate" {
+		// The ticket is taken from the credential cache.
+		return nil
+	}
+
+	if cfg.User == nil {
+		cfg.User = cfg.RequestURL.User
+	}
+
+	if cfg.User == nil {
+		return fmt.Errorf("%s requires credentials in --user or in the URL", cfg.AuthScheme)
+	}
+
+	return nil
+}
+
+// parseAWSSigV4 parses --aws-sigv4 and sets it to cfg.  The keys are taken
+// from the credentials like in curl.
+func parseAWSSigV4(cfg *Config, opts *Options) (err error) {
+	if opts.AWSSigV4 == "" {
+		return nil
+	}
+
+	parts := strings.Split(opts.AWSSigV4, ":")
+	if len(parts) > 4 || parts[0] == "" {
+		return fmt.Errorf("invalid aws-sigv4 value, must be provider1[:provider2[:region[:service]]]")
+	}
+
+	parts = append(parts, make([]string, 4-len(parts))...)
+	for _, p := range parts[:2] {
+		if strings.ContainsFunc(p, func(r rune) (ok bool) {
+			return !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9')
+		}) {
+			return fmt.Errorf("invalid aws-sigv4 provider: %q", p)
+		}
+	}
+
+	if cfg.AuthScheme != "" {
+		return fmt.Errorf("aws-sigv4 cannot be used together with %s", cfg.AuthScheme)
+	}
+
+	if cfg.User == nil {
+		cfg.User = cfg.RequestURL.User
+	}
+
+	if cfg.User == nil {
+		return fmt.Errorf("aws-sigv4 requires the keys in --user or in the URL")
+	}
+
+	cfg.AWSSigV4 = &AWSSigV4{
+		Provider1: strings.ToLower(parts[0]),
+		Provider2: strings.ToLower(parts[1]),
+		Region:    parts[2],
+		Service:   parts[3],
+	}
+
+	if cfg.AWSSigV4.Provider2 == "" {
+		cfg.AWSSigV4.Provider2 = cfg.AWSSigV4.Provider1
+	}
+
+	return nil
+}
+
+// parseLocation validates the options that control following redirects, see
+// --location, and sets them to cfg.
+func parseLocation(cfg *Config, opts *Options) (err error) {
+	if opts.MaxRedirs < -1 {
+		return fmt.Errorf("invalid max-redirs value: %d", opts.MaxRedirs)
+	}
+
+	cfg.FollowRedirects = opts.Location || opts.LocationTrusted
+	cfg.LocationTrusted = opts.LocationTrusted
+
+	cfg.MaxRedirects = opts.MaxRedirs
+	if cfg.MaxRedirects == 0 {
+		cfg.MaxRedirects = defaultMaxRedirects
+	}
+
+	for code, keep := range map[int]bool{
+		http.StatusMovedPermanently: opts.Post301,
+		http.StatusFound:            opts.Post302,
+		http.StatusSeeOther:         opts.Post303,
+	} {
+		if !keep {
+			continue
+		}
+
+		if cfg.RedirectKeepPost == nil {
+			cfg.RedirectKeepPost = map[int]struct{}{}
+		}
+
+		cfg.RedirectKeepPost[code] = struct{}{}
+	}
+
+	return nil
+}
+
+// parseParallel validates --parallel and --parallel-max.
+func parseParallel(opts *Options) (parallel bool, parallelMax int, err error) {
+	if opts.ParallelMax < 0 {
+		return false, 0, fmt.Errorf("invalid parallel-max value: %d", opts.ParallelMax)
+	}
+
+	parallelMax = opts.ParallelMax
+	if parallelMax == 0 {
+		parallelMax = defaultParallelMax
+	}
+
+	return opts.Parallel, parallelMax, nil
+}
+
+// parseFailureLimits parses --fail-fast, --max-failures and --retry-budget
+// that are only used when several URLs are processed.
+func parseFailureLimits(opts *Options) (maxFailures, retryBudget int, err error) {
+	switch {
+	case opts.MaxFailures < 0:
+		return 0, 0, fmt.Errorf("invalid max-failures value: %d", opts.MaxFailures)
+	case opts.RetryBudget < 0:
+		return 0, 0, fmt.Errorf("invalid retry-budget value: %d", opts.RetryBudget)
+	case opts.FailFast && opts.MaxFailures != 0:
+		return 0, 0, fmt.Errorf("fail-fast cannot be used together with max-failures")
+	case opts.URLFile == "" && (opts.FailFast || opts.MaxFailures != 0 || opts.RetryBudget != 0):
+		return 0, 0, fmt.Errorf("fail-fast, max-failures and retry-budget can only be used with url-file")
+	}
+
+	maxFailures = opts.MaxFailures
+	if opts.FailFast {
+		maxFailures = 1
+	}
+
+	return maxFailures, opts.RetryBudget, nil
+}
+
+// parseRetry validates --retry and the related options and sets them to cfg.
+func parseRetry(cfg *Config, opts *Options) (err error) {
+	switch {
+	case opts.Retry < 0:
+		return fmt.Errorf("invalid retry value: %d", opts.Retry)
+	case opts.RetryDelay < 0:
+		return fmt.Errorf("invalid retry-delay: %s", opts.RetryDelay)
+	case opts.RetryMaxTime < 0:
+		return fmt.Errorf("invalid retry-max-time: %s", opts.RetryMaxTime)
+	case opts.Retry == 0 && (opts.RetryDelay != 0 ||
+		opts.RetryMaxTime != 0 ||
+		opts.RetryAllErrors ||
+		opts.RetryConnRefused):
+		return fmt.Errorf("retry-delay, retry-max-time, retry-all-errors and retry-connrefused require retry")
+	}
+
+	cfg.Retry = opts.Retry
+	cfg.RetryDelay = opts.RetryDelay
+	cfg.RetryMaxTime = opts.RetryMaxTime
+	cfg.RetryAllErrors = opts.RetryAllErrors
+	cfg.RetryConnRefused = opts.RetryConnRefused
+
+	return nil
+}
+
+// parseCiphers parses the space-separated list of cipher suite names.
+func parseCiphers(s string) (ciphers []uint16, err error) {
+	ciphers = []uint16{}
+	for _, cipherName := range strings.Split(s, " ") {
+		cipher := getCipherSuiteByName(cipherName)
+		if cipher == 0 {
+			return nil, fmt.Errorf("cipher %s not found", cipherName)
+		}
+
+		ciphers = append(ciphers, cipher)
+	}
+
+	return ciphers, nil
+}
+
+// getCipherSuiteByName tries to get the cipher suite by its name. Returns 0
+// if no matching cipher found.
+func getCipherSuiteByName(cipherName string) (cipher uint16) {
+	for _, c := range tls.CipherSuites() {
+		if c.Name == cipherName {
+			return c.ID
+		}
+	}
+
+	for _, c := range tls.InsecureCipherSuites() {
+		if c.Name == cipherName {
+			return c.ID
+		}
+	}
+
+	return 0
+}
+
+// parseConnectTo creates a "connect-to" map from the string representation.
+func parseConnectTo(connectTo []string) (m map[string]string, err error) {
+	m = map[string]string{}
+	for _, ct := range connectTo {
+		parts := strings.SplitN(ct, ":", 4)
+		if len(parts) != 4 {
+			return nil, fmt.Errorf("invalid connect-to format %s, expected HOST1:PORT1:HOST2:PORT2", ct)
+		}
+
+		if parts[2] == "" && parts[3] == "" {
+			return nil, fmt.Errorf("invalid connect-to %s, HOST2 and PORT2 cannot be both empty", ct)
+		}
+
+		oldHost := parts[0] + ":" + parts[1]
+		newHost := parts[2] + ":" + parts[3]
+		m[oldHost] = newHost
+	}
+
+	return m, nil
+}
+
+// parseResolve creates a "resolve" map from the string representation.  If
+// the address is a host name instead of a list of IP addresses, it is added to
+// the hosts map instead.
+func parseResolve(resolve []string) (m map[string][]net.IP, hosts map[string]string, err error) {
+	m = map[string][]net.IP{}
+	hosts = map[string]string{}
+
+	for _, r := range resolve {
 		parts := strings.SplitN(r, ":", 3)
 		if len(parts) != 3 {
-			return nil, fmt.Errorf("invalid resolve format %s, expected HOST:PORT:ADDRS", r)
+			return nil, nil, fmt.Errorf("invalid resolve format %s, expected HOST:PORT:ADDRS", r)
 		}
 
 		host := parts[0]
 		addrs := parts[2]
+
+		if isHostname(addrs) {
+			delete(m, host)
+			hosts[host] = addrs
+
+			continue
+		}
+
 		var ipAddresses []net.IP
 
 		for _, a := range strings.Split(addrs, ",") {
 			ipAddr := net.ParseIP(a)
 			if ipAddr == nil {
-				return nil, fmt.Errorf("invalid addr %s", a)
+				return nil, nil, fmt.Errorf("invalid addr %s", a)
 			}
 
 			// Trim zero bytes.
@@ -339,13 +2672,78 @@ func parseResolve(resolve []string) (m map[string][]net.IP, err error) {
 		}
 
 		if len(ipAddresses) == 0 {
-			return nil, fmt.Errorf("no addrs for %s", host)
+			return nil, nil, fmt.Errorf("no addrs for %s", host)
 		}
 
+		delete(hosts, host)
 		m[host] = ipAddresses
 	}
 
-	return m, nil
+	return m, hosts, nil
+}
+
+// readHostsFile reads the file in the /etc/hosts format: every line is an IP
+// address followed by the host names, "#" starts a comment.
+func readHostsFile(path string) (hosts map[string][]net.IP, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	hosts = map[string][]net.IP{}
+
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		ipAddr := net.ParseIP(fields[0])
+		if ipAddr == nil || len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: invalid hosts entry %q", lineNum, line)
+		}
+
+		// Trim zero bytes.
+		if ipAddr.To4() != nil {
+			ipAddr = ipAddr.To4()
+		}
+
+		for _, host := range fields[1:] {
+			host = strings.ToLower(strings.TrimSuffix(host, "."))
+			hosts[host] = append(hosts[host], ipAddr)
+		}
+	}
+
+	return hosts, scanner.Err()
+}
+
+// isHostname returns true if s looks like a host name and not like an IP
+// address or a list of them.
+func isHostname(s string) (ok bool) {
+	if s == "" || strings.Contains(s, ",") || net.ParseIP(s) != nil {
+		return false
+	}
+
+	for _, label := range strings.Split(strings.TrimSuffix(s, "."), ".") {
+		if label == "" {
+			return false
+		}
+
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return false
+			}
+		}
+	}
+
+	// Reject things like "1.2.3" that are invalid IP addresses rather than
+	// host names.
+	_, err := strconv.Atoi(strings.ReplaceAll(s, ".", ""))
+
+	return err != nil
 }
 
 // parseDNSServers parses --dns-servers command-line argument and returns the
@@ -403,6 +2801,267 @@ func parseTLSSplitHello(tlsSplitHello string) (chunkSize int, delay int, err err
 	return chunkSize, delay, nil
 }
 
+// parseWriteJitter parses --write-jitter, returns error if it's invalid.
+func parseWriteJitter(writeJitter string) (minDelay, maxDelay int, err error) {
+	minStr, maxStr, ok := strings.Cut(writeJitter, ":")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid format: %s", writeJitter)
+	}
+
+	minDelay, err = strconv.Atoi(minStr)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	maxDelay, err = strconv.Atoi(maxStr)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if minDelay < 0 || maxDelay <= 0 || minDelay > maxDelay {
+		return 0, 0, fmt.Errorf("invalid bounds: %s", writeJitter)
+	}
+
+	return minDelay, maxDelay, nil
+}
+
+// parseTLSSplitSNI parses --tls-split-sni, returns error if it's invalid.
+func parseTLSSplitSNI(tlsSplitSNI string) (offsets []int, delay int, err error) {
+	offsetsStr, delayStr, hasDelay := strings.Cut(tlsSplitSNI, ":")
+	if hasDelay {
+		delay, err = strconv.Atoi(delayStr)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid delay: %w", err)
+		}
+	}
+
+	prev := 0
+	for _, s := range strings.Split(offsetsStr, ",") {
+		var off int
+		off, err = strconv.Atoi(s)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid offset: %w", err)
+		}
+
+		if off <= prev {
+			return nil, 0, fmt.Errorf("offsets must be positive and ascending: %s", offsetsStr)
+		}
+
+		offsets = append(offsets, off)
+		prev = off
+	}
+
+	return offsets, delay, nil
+}
+
+// maxQUICInitialSize is the maximum size of a UDP datagram with QUIC Initial
+// packet.
+const maxQUICInitialSize = 16383
+
+// parseQUICShaping validates QUIC Initial packet shaping options.
+func parseQUICShaping(opts *Options) (split int, reorder bool, initialSize int, err error) {
+	if opts.QUICSplit == 0 && !opts.QUICReorder && opts.QUICInitialSize == 0 {
+		return 0, false, 0, nil
+	}
+
+	if !opts.HTTPv3 && !opts.HTTPv3Only && !opts.HTTPv3Try {
+		return 0, false, 0, fmt.Errorf("quic-split, quic-reorder, and quic-initial-size require http3")
+	}
+
+	if opts.QUICSplit < 0 {
+		return 0, false, 0, fmt.Errorf("invalid quic-split: %d", opts.QUICSplit)
+	}
+
+	if opts.QUICReorder && opts.QUICSplit < 2 {
+		return 0, false, 0, fmt.Errorf("quic-reorder requires quic-split of at least 2")
+	}
+
+	if opts.QUICInitialSize < 0 || opts.QUICInitialSize > maxQUICInitialSize {
+		return 0, false, 0, fmt.Errorf(
+			"quic-initial-size must be between 0 and %d: %d",
+			maxQUICInitialSize,
+			opts.QUICInitialSize,
+		)
+	}
+
+	return opts.QUICSplit, opts.QUICReorder, opts.QUICInitialSize, nil
+}
+
+// parsePhaseTimeouts validates --max-time, --dns-timeout,
+// --tls-handshake-timeout, --response-header-timeout, --read-timeout and
+// --expect100-timeout and sets them to cfg.
+func parsePhaseTimeouts(cfg *Config, opts *Options) (err error) {
+	switch {
+	case opts.MaxTime < 0:
+		return fmt.Errorf("invalid max-time: %s", opts.MaxTime)
+	case opts.DNSTimeout < 0:
+		return fmt.Errorf("invalid dns-timeout: %s", opts.DNSTimeout)
+	case opts.TLSHandshakeTimeout < 0:
+		return fmt.Errorf("invalid tls-handshake-timeout: %s", opts.TLSHandshakeTimeout)
+	case opts.ResponseHeaderTimeout < 0:
+		return fmt.Errorf("invalid response-header-timeout: %s", opts.ResponseHeaderTimeout)
+	case opts.ReadTimeout < 0:
+		return fmt.Errorf("invalid read-timeout: %s", opts.ReadTimeout)
+	case opts.Expect100Timeout < 0:
+		return fmt.Errorf("invalid expect100-timeout: %s", opts.Expect100Timeout)
+	}
+
+	cfg.MaxTime = opts.MaxTime
+	cfg.DNSTimeout = opts.DNSTimeout
+	cfg.TLSHandshakeTimeout = opts.TLSHandshakeTimeout
+	cfg.ResponseHeaderTimeout = opts.ResponseHeaderTimeout
+	cfg.ReadTimeout = opts.ReadTimeout
+
+	cfg.Expect100Timeout = opts.Expect100Timeout
+	if cfg.Expect100Timeout == 0 {
+		cfg.Expect100Timeout = defaultExpect100Timeout
+	}
+
+	return nil
+}
+
+// defaultSpeedTime is the default value of --speed-time, it is the same as in
+// curl.
+const defaultSpeedTime = 30 * time.Second
+
+// parseSpeedLimit parses --speed-limit and --speed-time.  Like in curl, if
+// only one of them is specified, the other one has the default value.
+func parseSpeedLimit(opts *Options) (limit int64, period time.Duration, err error) {
+	if opts.SpeedLimit == "" && opts.SpeedTime == 0 {
+		return 0, 0, nil
+	}
+
+	limit, period = 1, defaultSpeedTime
+	if opts.SpeedLimit != "" {
+		limit, err = parseSize(opts.SpeedLimit)
+		if err != nil || limit <= 0 {
+			return 0, 0, fmt.Errorf("invalid speed-limit: %q", opts.SpeedLimit)
+		}
+	}
+
+	if opts.SpeedTime < 0 {
+		return 0, 0, fmt.Errorf("invalid speed-time: %s", opts.SpeedTime)
+	} else if opts.SpeedTime > 0 {
+		period = opts.SpeedTime
+	}
+
+	return limit, period, nil
+}
+
+// parseQUICTimeouts validates --quic-idle-timeout and --quic-keepalive.
+func parseQUICTimeouts(opts *Options) (idleTimeout, keepAlive time.Duration, err error) {
+	if opts.QUICIdleTimeout == 0 && opts.QUICKeepAlive == 0 {
+		return 0, 0, nil
+	}
+
+	switch {
+	case !opts.HTTPv3 && !opts.HTTPv3Only && !opts.HTTPv3Try:
+		return 0, 0, fmt.Errorf("quic-idle-timeout and quic-keepalive require http3")
+	case opts.QUICIdleTimeout < 0:
+		return 0, 0, fmt.Errorf("invalid quic-idle-timeout: %s", opts.QUICIdleTimeout)
+	case opts.QUICKeepAlive < 0:
+		return 0, 0, fmt.Errorf("invalid quic-keepalive: %s", opts.QUICKeepAlive)
+	}
+
+	return opts.QUICIdleTimeout, opts.QUICKeepAlive, nil
+}
+
+// maxQUICWindow is the maximum value of a QUIC transport parameter, i.e. the
+// maximum value of a variable-length integer.
+const maxQUICWindow = 1<<62 - 1
+
+// parseQUICWindows validates --quic-stream-window and --quic-conn-window.
+func parseQUICWindows(opts *Options) (streamWindow, connWindow uint64, err error) {
+	if opts.QUICStreamWindow == 0 && opts.QUICConnWindow == 0 {
+		return 0, 0, nil
+	}
+
+	switch {
+	case !opts.HTTPv3 && !opts.HTTPv3Only && !opts.HTTPv3Try:
+		return 0, 0, fmt.Errorf("quic-stream-window and quic-conn-window require http3")
+	case opts.QUICStreamWindow > maxQUICWindow:
+		return 0, 0, fmt.Errorf("quic-stream-window must not exceed %d: %d", uint64(maxQUICWindow), opts.QUICStreamWindow)
+	case opts.QUICConnWindow > maxQUICWindow:
+		return 0, 0, fmt.Errorf("quic-conn-window must not exceed %d: %d", uint64(maxQUICWindow), opts.QUICConnWindow)
+	}
+
+	return opts.QUICStreamWindow, opts.QUICConnWindow, nil
+}
+
+// quicVersions are the QUIC versions supported by quic-go by their names in
+// --quic-version.
+var quicVersions = map[string]uint32{
+	// RFC 9000.
+	"v1": 0x1,
+	// RFC 9369.
+	"v2": 0x6b3343cf,
+}
+
+// parseQUICVersion parses --quic-version.
+func parseQUICVersion(opts *Options) (version uint32, err error) {
+	switch {
+	case opts.QUICVersion == "":
+		return 0, nil
+	case !opts.HTTPv3 && !opts.HTTPv3Only && !opts.HTTPv3Try:
+		return 0, fmt.Errorf("quic-version requires http3")
+	}
+
+	version, ok := quicVersions[opts.QUICVersion]
+	if !ok {
+		return 0, fmt.Errorf("invalid quic-version: %q", opts.QUICVersion)
+	}
+
+	return version, nil
+}
+
+// parseHTTP3ALPN parses --http3-alpn.
+func parseHTTP3ALPN(opts *Options) (protos []string, err error) {
+	if opts.HTTP3ALPN == "" {
+		return nil, nil
+	}
+
+	if !opts.HTTPv3 && !opts.HTTPv3Only && !opts.HTTPv3Try {
+		return nil, fmt.Errorf("http3-alpn requires http3")
+	}
+
+	for _, p := range strings.Split(opts.HTTP3ALPN, ",") {
+		p = strings.TrimSpace(p)
+		if !strings.HasPrefix(p, "h3") {
+			return nil, fmt.Errorf("invalid http3-alpn: %q is not an HTTP/3 identifier", p)
+		}
+
+		protos = append(protos, p)
+	}
+
+	return protos, nil
+}
+
+// defaultFakeTTL is the default TTL of the packet with the decoy ClientHello.
+const defaultFakeTTL = 8
+
+// parseTLSFakeHello parses --tls-fake-hello, returns error if it's invalid.
+func parseTLSFakeHello(tlsFakeHello string) (sni string, ttl int, err error) {
+	sni, ttlStr, hasTTL := strings.Cut(tlsFakeHello, ":")
+	if sni == "" {
+		return "", 0, fmt.Errorf("empty server name: %s", tlsFakeHello)
+	}
+
+	if !hasTTL {
+		return sni, defaultFakeTTL, nil
+	}
+
+	ttl, err = strconv.Atoi(ttlStr)
+	if err != nil {
+		return "", 0, err
+	}
+
+	if ttl < 1 || ttl > 255 {
+		return "", 0, fmt.Errorf("ttl must be between 1 and 255: %d", ttl)
+	}
+
+	return sni, ttl, nil
+}
+
 // unmarshalECHConfigs parses the base64-encoded ECH config.
 func unmarshalECHConfigs(echConfig string) (echConfigs []ctls.ECHConfig, err error) {
 	var b []byte
@@ -414,6 +3073,187 @@ func unmarshalECHConfigs(echConfig string) (echConfigs []ctls.ECHConfig, err err
 	return ctls.UnmarshalECHConfigs(b)
 }
 
+// parseBenchmark validates --repeat and --concurrency and returns the final
+// values for them.
+func parseBenchmark(repeat, concurrency int) (r, c int, err error) {
+	if repeat < 0 {
+		return 0, 0, fmt.Errorf("invalid repeat value: %d", repeat)
+	}
+
+	if concurrency < 0 {
+		return 0, 0, fmt.Errorf("invalid concurrency value: %d", concurrency)
+	}
+
+	if concurrency > 0 && repeat == 0 {
+		return 0, 0, fmt.Errorf("concurrency can only be used with repeat")
+	}
+
+	if concurrency == 0 {
+		concurrency = 1
+	}
+
+	return repeat, min(concurrency, max(repeat, 1)), nil
+}
+
+// validateWatch validates the watch mode options: --interval,
+// --until-status and --max-iterations.
+func validateWatch(opts *Options) (err error) {
+	switch {
+	case opts.Interval < 0:
+		return fmt.Errorf("invalid interval value: %s", opts.Interval)
+	case opts.MaxIterations < 0:
+		return fmt.Errorf("invalid max-iterations value: %d", opts.MaxIterations)
+	case opts.UntilStatus != 0 && (opts.UntilStatus < 100 || opts.UntilStatus > 999):
+		return fmt.Errorf("invalid until-status value: %d", opts.UntilStatus)
+	case opts.Interval == 0 && (opts.UntilStatus != 0 || opts.MaxIterations != 0):
+		return fmt.Errorf("until-status and max-iterations can only be used with interval")
+	case opts.Interval > 0 && opts.Repeat > 0:
+		return fmt.Errorf("interval cannot be used together with repeat")
+	case opts.URLFile != "" && (opts.Interval > 0 || opts.Repeat > 0):
+		return fmt.Errorf("url-file cannot be used together with interval or repeat")
+	}
+
+	return nil
+}
+
+// parseExpectations parses the response assertions options, see
+// --expect-status, --expect-header, --expect-body-regex and --expect-max-time.
+func parseExpectations(cfg *Config, opts *Options) (err error) {
+	if opts.ExpectStatus != 0 && (opts.ExpectStatus < 100 || opts.ExpectStatus > 999) {
+		return fmt.Errorf("invalid expect-status value: %d", opts.ExpectStatus)
+	}
+	cfg.ExpectStatus = opts.ExpectStatus
+
+	for _, h := range opts.ExpectHeaders {
+		name, expr, ok := strings.Cut(h, ":")
+		if !ok || name == "" {
+			return fmt.Errorf("invalid expect-header value: %s", h)
+		}
+
+		var re *regexp.Regexp
+		re, err = regexp.Compile(expr)
+		if err != nil {
+			return fmt.Errorf("invalid expect-header regex %s: %w", expr, err)
+		}
+
+		cfg.ExpectHeaders = append(cfg.ExpectHeaders, &HeaderExpectation{
+			Name:   name,
+			Regexp: re,
+		})
+	}
+
+	if opts.ExpectBodyRegex != "" {
+		cfg.ExpectBodyRegexp, err = regexp.Compile(opts.ExpectBodyRegex)
+		if err != nil {
+			return fmt.Errorf("invalid expect-body-regex: %w", err)
+		}
+	}
+
+	if opts.ExpectMaxTime < 0 {
+		return fmt.Errorf("invalid expect-max-time value: %s", opts.ExpectMaxTime)
+	}
+	cfg.ExpectMaxTime = opts.ExpectMaxTime
+
+	return nil
+}
+
+// validateConnectOnly validates the options that cannot be used in the raw
+// mode, see --connect-only.
+func validateConnectOnly(cfg *Config) (err error) {
+	if !cfg.ConnectOnly {
+		return nil
+	}
+
+	scheme := cfg.RequestURL.Scheme
+	switch {
+	case !slices.Contains([]string{"http", "https", "ws", "wss", "tcp", "udp"}, scheme):
+		return fmt.Errorf("connect-only requires http, https, tcp or udp URL, got %s", cfg.RequestURL)
+	case cfg.RequestURL.Port() == "" && (scheme == "tcp" || scheme == "udp"):
+		return fmt.Errorf("connect-only requires port for %s URL", scheme)
+	case cfg.ForceHTTP3 && scheme != "https":
+		return fmt.Errorf("connect-only with http3 requires https URL")
+	case len(cfg.RequestURLs) > 1 || cfg.Repeat > 0 || cfg.Interval > 0:
+		return fmt.Errorf("connect-only cannot be used together with url-file, repeat or interval")
+	}
+
+	return nil
+}
+
+// parseCompareWith parses and validates --compare-with.
+func parseCompareWith(cfg *Config, opts *Options) (err error) {
+	if opts.CompareWith == "" {
+		return nil
+	}
+
+	cfg.CompareURL, err = parseRequestURL(opts.CompareWith)
+	if err != nil {
+		return fmt.Errorf("invalid compare-with: %w", err)
+	}
+
+	for _, u := range []*url.URL{cfg.RequestURL, cfg.CompareURL} {
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("compare-with requires http or https URLs, got %s", u)
+		}
+	}
+
+	switch {
+	case cfg.ConnectOnly:
+		return fmt.Errorf("compare-with cannot be used together with connect-only")
+	case len(cfg.RequestURLs) > 1 || cfg.Repeat > 0 || cfg.Interval > 0:
+		return fmt.Errorf("compare-with cannot be used together with url-file, repeat or interval")
+	}
+
+	return nil
+}
+
+// validateMQTT validates the options for mqtt:// and mqtts:// URLs.
+func validateMQTT(cfg *Config) (err error) {
+	if cfg.RequestURL.Scheme != "mqtt" && cfg.RequestURL.Scheme != "mqtts" {
+		return nil
+	}
+
+	switch {
+	case strings.Trim(cfg.RequestURL.Path, "/") == "":
+		return fmt.Errorf("mqtt URL must specify the topic: %s", cfg.RequestURL)
+	case cfg.ForceHTTP3:
+		return fmt.Errorf("mqtt cannot be used together with http3")
+	case len(cfg.RequestURLs) > 1 || cfg.Repeat > 0 || cfg.Interval > 0:
+		return fmt.Errorf("mqtt cannot be used together with url-file, repeat or interval")
+	}
+
+	return nil
+}
+
+// parseSize parses the size in bytes.  Like curl, it supports k, m and g
+// suffixes (case-insensitive) that stand for kibibytes, mebibytes and
+// gibibytes.
+func parseSize(str string) (size int64, err error) {
+	multiplier := int64(1)
+	switch strings.ToLower(str[len(str)-1:]) {
+	case "k":
+		multiplier = 1 << 10
+	case "m":
+		multiplier = 1 << 20
+	case "g":
+		multiplier = 1 << 30
+	}
+
+	if multiplier > 1 {
+		str = str[:len(str)-1]
+	}
+
+	size, err = strconv.ParseInt(str, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	if size < 0 {
+		return 0, fmt.Errorf("negative size: %d", size)
+	}
+
+	return size * multiplier, nil
+}
+
 // parseExperiments parses the --experiment command-line arguments into a map.
 // Returns an error if the experiment name is invalid.
 func parseExperiments(exps []string) (expMap map[Experiment]string, err error) {
@@ -0,0 +1,176 @@
+package config
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"github.com/AdguardTeam/dnsproxy/upstream"
+)
+
+// redactedValue is the value that replaces secrets in the configuration dump.
+const redactedValue = "[redacted]"
+
+// sensitiveNameParts is the list of substrings that mark a header or a query
+// parameter name as the one that may contain credentials.  Names are compared
+// case-insensitively.
+var sensitiveNameParts = []string{
+	"auth",
+	"cookie",
+	"key",
+	"pass",
+	"secret",
+	"session",
+	"signature",
+	"token",
+}
+
+// Dump returns the JSON representation of the configuration.  Secrets are
+// redacted so that the result is safe to share:
+//
+//   - fields marked with the `redact:"true"` tag (for instance, Data);
+//   - passwords in the request and the proxy URLs;
+//   - values of headers and request URL query parameters whose names look
+//     like they carry credentials, see sensitiveNameParts.
+//
+// Note, that secrets that don't match these rules (for instance, a token that
+// is a part of the URL path) are written as is.
+func (c *Config) Dump() (b []byte, err error) {
+	m := map[string]any{}
+
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Name == "RawOptions" {
+			// Raw options may contain secrets and duplicate the rest anyway.
+			continue
+		}
+
+		fv := v.Field(i)
+		if f.Tag.Get("redact") == "true" && !fv.IsZero() {
+			m[f.Name] = redactedValue
+
+			continue
+		}
+
+		m[f.Name] = c.dumpField(f.Name, fv.Interface())
+	}
+
+	return json.MarshalIndent(m, "", "  ")
+}
+
+// dumpField converts the value of the configuration field name to something
+// that can be serialized to JSON in a human-readable way.
+func (c *Config) dumpField(name string, v any) (d any) {
+	switch name {
+	case "TLSMinVersion", "TLSMaxVersion":
+		if ver := v.(uint16); ver != 0 {
+			return tls.VersionName(ver)
+		}
+
+		return nil
+	case "TLSCiphers":
+		var names []string
+		for _, cipher := range v.([]uint16) {
+			names = append(names, tls.CipherSuiteName(cipher))
+		}
+
+		return names
+	case "ECHConfigs":
+		// Parsed ECH configurations cannot be serialized back so use the
+		// original base64-encoded value instead.
+		if c.RawOptions != nil && c.RawOptions.ECHConfig != "" {
+			return c.RawOptions.ECHConfig
+		}
+
+		return nil
+	}
+
+	return dumpValue(v)
+}
+
+// dumpValue converts the configuration field value to something that can be
+// serialized to JSON in a human-readable way.
+func dumpValue(v any) (d any) {
+	switch val := v.(type) {
+	case *url.URL:
+		if val == nil {
+			return nil
+		}
+
+		return redactURL(val)
+	case []*url.URL:
+		var urls []string
+		for _, u := range val {
+			urls = append(urls, redactURL(u))
+		}
+
+		return urls
+	case http.Header:
+		return redactHeaders(val)
+	case []upstream.Upstream:
+		var addrs []string
+		for _, u := range val {
+			addrs = append(addrs, u.Address())
+		}
+
+		return addrs
+	default:
+		return v
+	}
+}
+
+// isSensitiveName returns true if the header or the query parameter name may
+// contain credentials.
+func isSensitiveName(name string) (ok bool) {
+	name = strings.ToLower(name)
+	for _, part := range sensitiveNameParts {
+		if strings.Contains(name, part) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// redactURL returns the string representation of u with the password and
+// sensitive query parameters values replaced.
+func redactURL(u *url.URL) (s string) {
+	redacted := *u
+
+	q := redacted.Query()
+	changed := false
+	for name := range q {
+		if isSensitiveName(name) {
+			q[name] = []string{redactedValue}
+			changed = true
+		}
+	}
+
+	if changed {
+		redacted.RawQuery = q.Encode()
+	}
+
+	return redacted.Redacted()
+}
+
+// redactHeaders returns a copy of h with the values of sensitive headers
+// replaced.
+func redactHeaders(h http.Header) (redacted http.Header) {
+	if h == nil {
+		return nil
+	}
+
+	redacted = h.Clone()
+	for name := range redacted {
+		if isSensitiveName(name) {
+			redacted[name] = []string{redactedValue}
+		}
+	}
+
+	return redacted
+}
@@ -3,7 +3,7 @@ package config
 import (
 	"encoding/json"
 	"fmt"
-	"os"
+	"time"
 
 	goFlags "github.com/jessevdk/go-flags"
 )
@@ -14,30 +14,231 @@ type Options struct {
 	// last argument.
 	URL string `long:"url" description:"URL the request will be made to. Can be specified without any flags." value-name:"<URL>"`
 
+	// URLFile is a path to the file with the list of URLs, one URL per line.
+	// "-" means that the list is read from stdin.
+	URLFile string `long:"url-file" description:"Reads the list of URLs (one per line) from the file or from stdin if '-' is specified. All URLs use the same options." value-name:"<file|->"`
+
+	// Parallel makes gocurl process several URLs in parallel.
+	Parallel bool `short:"Z" long:"parallel" description:"Makes requests to several URLs (see --url-file) in parallel." optional:"yes" optional-value:"true"`
+
+	// ParallelMax is the maximum number of parallel transfers.
+	ParallelMax int `long:"parallel-max" description:"Maximum number of parallel transfers when --parallel is used. 50 by default." value-name:"<num>"`
+
+	// FailFast stops processing the URLs after the first failure.
+	FailFast bool `long:"fail-fast" description:"Stops starting new transfers after the first failed one when several URLs are processed (see --url-file)." optional:"yes" optional-value:"true"`
+
+	// MaxFailures stops processing the URLs after the specified number of
+	// failures.
+	MaxFailures int `long:"max-failures" description:"Stops starting new transfers after N failed ones when several URLs are processed (see --url-file)." value-name:"<N>"`
+
+	// RetryBudget is the total number of retries of the failed requests.
+	RetryBudget int `long:"retry-budget" description:"Total number of retries shared by all URLs (see --url-file). A request is retried if it failed before the response was received, at most 3 times per URL. With --json-output, every attempt is listed in the \"attempts\" field." value-name:"<N>"`
+
+	// Retry is the number of retries of the request after transient errors.
+	Retry int `long:"retry" description:"Retries the request up to N times after transient errors: timeouts, temporary DNS failures and 408, 429, 500, 502, 503 and 504 responses. Waits 1s before the first retry and doubles the delay every time (up to 10m), Retry-After is respected. Every retry is logged. The request body from stdin is saved to a temporary file to be sent again." value-name:"<N>"`
+
+	// RetryDelay is the fixed delay between the retries.
+	RetryDelay time.Duration `long:"retry-delay" description:"Waits the specified duration (e.g. 2s) between the retries instead of the exponential backoff. Requires --retry." value-name:"<duration>"`
+
+	// RetryMaxTime is the maximum time during which the request is retried.
+	RetryMaxTime time.Duration `long:"retry-max-time" description:"Doesn't retry after the specified duration (e.g. 1m) since the first attempt. Requires --retry." value-name:"<duration>"`
+
+	// RetryAllErrors makes gocurl retry after any error.
+	RetryAllErrors bool `long:"retry-all-errors" description:"Retries after any error and any 4xx or 5xx response. Requires --retry." optional:"yes" optional-value:"true"`
+
+	// RetryConnRefused makes gocurl retry after connection refused errors.
+	RetryConnRefused bool `long:"retry-connrefused" description:"Also considers the refused connection a transient error. Requires --retry." optional:"yes" optional-value:"true"`
+
 	// Method is the HTTP method to be used.
 	Method string `short:"X" long:"request" description:"HTTP method. GET by default." value-name:"<method>"`
 
-	// Data specifies the data to be sent to the HTTP server.
-	Data string `short:"d" long:"data" description:"Sends the specified data to the HTTP server using content type application/x-www-form-urlencoded." value-name:"<data>"`
+	// Data specifies the data to be sent to the HTTP server.  If specified
+	// multiple times, the values are joined with "&".
+	Data DataFlag `short:"d" long:"data" description:"Sends the specified data to the HTTP server using content type application/x-www-form-urlencoded. Can be specified multiple times, the values are joined with &. If the value starts with @, the data is read from the file or from stdin for @- and the newlines are removed. The files are read while the request is sent." value-name:"<data>"`
+
+	// DataURLEncode specifies the data that is URL-encoded before sending it
+	// to the HTTP server.
+	DataURLEncode DataFlag `long:"data-urlencode" description:"Like --data, but URL-encodes the data. The format is content, =content, name=content, @file or name@file like in curl. The values are joined with the --data ones in the command-line order. Can be specified multiple times." value-name:"<data>"`
+
+	// Form is the list of the multipart/form-data fields.
+	Form []string `short:"F" long:"form" description:"Sends the multipart/form-data body with the field. The value is name=value or name=@file to upload the file, which is streamed from disk. The ;type= and ;filename= attributes override the content type (guessed from the extension for files) and the file name, the file name may be quoted. Can be specified multiple times, cannot be used together with --data." value-name:"<name=value|name=@file>"`
+
+	// UploadFile is the file that is uploaded with PUT.
+	UploadFile string `short:"T" long:"upload-file" description:"Uploads the file with PUT (or the method from --request). The file is streamed with Content-Length set to its size, stdin (-) and named pipes are streamed with chunked encoding. The file name is appended to the URL if it ends with /." value-name:"<file|->"`
+
+	// CompressRequest is the encoding that is used to compress the request
+	// body.
+	CompressRequest string `long:"compress-request" description:"Compresses the request body (see --data, --form and --upload-file) with the specified encoding and sets the Content-Encoding header. Files are compressed on the fly and sent with chunked encoding. Can be gzip, br or zstd." value-name:"<encoding>"`
+
+	// Sign enables signing the request with HMAC.
+	Sign string `long:"sign" description:"Signs the request with HMAC and adds the hex-encoded signature to the header (X-Signature by default). Algorithm is hmac-sha256 or hmac-sha512. See --sign-fields for what is signed." value-name:"<algorithm:key[:header]>"`
+
+	// SignFields is the list of fields that make the signed string.
+	SignFields string `long:"sign-fields" description:"Comma-separated list of fields that are joined with newlines into the string signed by --sign: method, path (with query), host, date, body-sha256 (hex) or header:<name>. If date is used and there is no Date header, it is added. Default is method,path,date,body-sha256. With --sign-format rfc9421 it is the list of covered components, e.g. @method,@authority,@path,content-type. Default is @method,@target-uri and content-digest if there is a body." value-name:"<fields>"`
+
+	// SignFormat is the format of the request signature.
+	SignFormat string `long:"sign-format" description:"Format of the --sign signature: hmac (default) or rfc9421. rfc9421 adds the Signature-Input and Signature headers (HTTP Message Signatures). Its algorithm is hmac-sha256 (the key is the secret), ed25519, ecdsa-p256-sha256, rsa-pss-sha512 or rsa-v1_5-sha256 (the key is a PEM private key file) and the optional third part of --sign is the signature label (sig1 by default). Content-Digest is added if covered and not set." value-name:"<format>"`
+
+	// SignKeyID is the keyid parameter of the RFC 9421 signature.
+	SignKeyID string `long:"sign-keyid" description:"Key identifier that is added to the keyid parameter of the signature when --sign-format rfc9421 is used." value-name:"<id>"`
+
+	// AWSSigV4 enables AWS Signature Version 4 signing.
+	AWSSigV4 string `long:"aws-sigv4" description:"Signs the request with AWS Signature Version 4 using the access key and the secret key from --user (KEY:SECRET) like curl. Provider2 defaults to provider1, region and service are taken from the host name (service.region.amazonaws.com) if omitted. The payload hash header is added for s3." value-name:"<provider1[:provider2[:region[:service]]]>"`
 
 	// Headers is an array of HTTP headers (format is "header: value") to
 	// include in the request.
 	Headers []string `short:"H" long:"header" description:"Extra header to include in the request. Can be specified multiple times."`
 
-	// ProxyURL is a URL of a proxy to use with this connection.
-	ProxyURL string `short:"x" long:"proxy" description:"Use the specified proxy. The proxy string can be specified with a protocol:// prefix." value-name:"[protocol://username:password@]host[:port]"`
+	// User is the user name and password for Basic authentication.
+	User string `short:"u" long:"user" description:"User name and password for Basic authentication. If the password is omitted, it is prompted for. Has priority over the credentials in the URL, but not over the Authorization header." value-name:"<user[:password]>"`
+
+	// Digest enables HTTP Digest authentication.
+	Digest bool `long:"digest" description:"Uses HTTP Digest authentication with the credentials from --user or the URL. The request is sent without credentials first and re-sent with the answer to the Digest challenge of the server." optional:"yes" optional-value:"true"`
+
+	// NTLM enables NTLM authentication.
+	NTLM bool `long:"ntlm" description:"Uses NTLMv2 authentication with the credentials from --user or the URL, the user name may contain the domain (DOMAIN\\user). The handshake requires a persistent connection so HTTP/1.1 is used." optional:"yes" optional-value:"true"`
+
+	// Negotiate enables SPNEGO/Kerberos authentication.
+	Negotiate bool `long:"negotiate" description:"Uses SPNEGO (Kerberos) authentication with the ticket for the HTTP/<host> service acquired using the credential cache of kinit (KRB5CCNAME, FILE type only) and the configuration from KRB5_CONFIG or /etc/krb5.conf." optional:"yes" optional-value:"true"`
+
+	// AnyAuth enables choosing the authentication scheme by the challenge.
+	AnyAuth bool `long:"anyauth" description:"Sends the request without credentials first and answers the strongest of the challenges of the server that gocurl supports: Negotiate, Digest, NTLM (HTTP/1.1 only) or Basic. The credentials are taken from --user or the URL." optional:"yes" optional-value:"true"`
+
+	// Cookie is the cookies to send or the cookie file to read them from.
+	Cookie string `short:"b" long:"cookie" description:"Sends the cookies. If the value contains =, it is sent as is in the Cookie header (name=value; name2=value2), otherwise it is the path to the cookie file in the Netscape format (like the one curl writes) and the cookies that match the request URL are sent." value-name:"<data|file>"`
+
+	// CookieJar is the file the cookies are written to.
+	CookieJar string `short:"c" long:"cookie-jar" description:"Writes the cookies received in Set-Cookie headers and the ones read with --cookie to the file in the Netscape format so that later invocations could send them with --cookie. The file is updated after every response that sets cookies." value-name:"<file>"`
+
+	// JunkSessionCookies makes session cookies not saved.
+	JunkSessionCookies bool `short:"j" long:"junk-session-cookies" description:"Doesn't write session cookies (the ones without expiration time) to the --cookie-jar file." optional:"yes" optional-value:"true"`
+
+	// ProxyURL are the URLs of the proxies to use with this connection.
+	ProxyURL []string `short:"x" long:"proxy" description:"Use the specified proxy. The proxy string can be specified with a protocol:// prefix. Can be specified multiple times or as a comma-separated list, the proxies are tried in order until the connection succeeds." value-name:"[protocol://username:password@]host[:port]"`
+
+	// ProxyFallback defines what to do when all the proxies failed.
+	ProxyFallback string `long:"proxy-fallback" description:"Connects directly when all the proxies specified with --proxy failed. The only supported value is direct." value-name:"direct"`
+
+	// Preproxy is a URL of a SOCKS5 proxy to connect to the proxy through.
+	Preproxy string `long:"preproxy" description:"SOCKS5 proxy to connect to the HTTP or HTTPS proxy specified with --proxy through. The direct connections of --proxy-fallback also go through it." value-name:"[socks5://username:password@]host[:port]"`
+
+	// ProxyUser is the user name and password for the proxy.
+	ProxyUser string `short:"U" long:"proxy-user" description:"User name and password for the HTTP or HTTPS proxy, Basic authentication is used unless --proxy-digest, --proxy-ntlm or --proxy-anyauth is specified. Has priority over the credentials in the proxy URL." value-name:"<user:password>"`
+
+	// ProxyDigest enables HTTP Digest authentication with the proxy.
+	ProxyDigest bool `long:"proxy-digest" description:"Answers the Digest challenge of the HTTP or HTTPS proxy with the credentials from --proxy-user or the proxy URL." optional:"yes" optional-value:"true"`
+
+	// ProxyNTLM enables NTLM authentication with the proxy.
+	ProxyNTLM bool `long:"proxy-ntlm" description:"Performs the NTLMv2 handshake with the HTTP or HTTPS proxy using the credentials from --proxy-user or the proxy URL." optional:"yes" optional-value:"true"`
+
+	// ProxyAnyAuth enables choosing the proxy authentication scheme by the
+	// challenge.
+	ProxyAnyAuth bool `long:"proxy-anyauth" description:"Sends CONNECT to the HTTP or HTTPS proxy without credentials first and answers the strongest of its challenges that gocurl supports: Digest, NTLM or Basic." optional:"yes" optional-value:"true"`
+
+	// ProxyInsecure disables TLS verification of the HTTPS proxy.
+	ProxyInsecure bool `long:"proxy-insecure" description:"Disables TLS verification of the connection to the HTTPS proxy." optional:"yes" optional-value:"true"`
+
+	// ProxyCert is the client certificate for the HTTPS proxy.
+	ProxyCert string `long:"proxy-cert" description:"Client certificate file in PEM or PKCS#12 format for the HTTPS proxy, the same as --cert." value-name:"<file[:password]>"`
+
+	// ProxyKey is the private key of the client certificate for the HTTPS
+	// proxy.
+	ProxyKey string `long:"proxy-key" description:"Private key file of the client certificate for the HTTPS proxy (see --proxy-cert) in PEM format." value-name:"<file>"`
+
+	// ProxyPass is the password of the private key of the client certificate
+	// for the HTTPS proxy.
+	ProxyPass string `long:"proxy-pass" description:"Password of the encrypted private key (see --proxy-key) or of the PKCS#12 client certificate (see --proxy-cert) for the HTTPS proxy." value-name:"<password>"`
+
+	// ProxyCACert is the file with the CA certificates to verify the HTTPS
+	// proxy with.
+	ProxyCACert string `long:"proxy-cacert" description:"CA certificates file in PEM format to verify the HTTPS proxy certificate with instead of the system ones." value-name:"<file>"`
+
+	// ProxyCAPath is the directory with the CA certificates files to verify
+	// the HTTPS proxy with.
+	ProxyCAPath string `long:"proxy-capath" description:"Directory with CA certificates files in PEM format to verify the HTTPS proxy certificate with instead of the system ones. Can be combined with --proxy-cacert." value-name:"<dir>"`
+
+	// ProxyTLSv13 forces to use TLS v1.3 with the HTTPS proxy.
+	ProxyTLSv13 bool `long:"proxy-tlsv1.3" description:"Forces gocurl to use TLS v1.3 or newer with the HTTPS proxy." optional:"yes" optional-value:"true"`
+
+	// ProxyTLSv12 forces to use TLS v1.2 with the HTTPS proxy.
+	ProxyTLSv12 bool `long:"proxy-tlsv1.2" description:"Forces gocurl to use TLS v1.2 or newer with the HTTPS proxy." optional:"yes" optional-value:"true"`
+
+	// ProxyTLSMax specifies the maximum supported TLS version for the HTTPS
+	// proxy.
+	ProxyTLSMax string `long:"proxy-tls-max" description:"Maximum supported TLS version for the HTTPS proxy. Can be 1.2 or 1.3." value-name:"<VERSION>"`
+
+	// ProxyCiphers specifies which ciphers to use in the connection to the
+	// HTTPS proxy.
+	ProxyCiphers string `long:"proxy-ciphers" description:"Specifies which ciphers to use in the connection to the HTTPS proxy, the same as --ciphers." value-name:"<space-separated list of ciphers>"`
 
 	// ConnectTo allows to override the connection target, i.e. for a request
 	// to the given HOST1:PORT1 pair, connect to HOST2:PORT2 instead.
-	ConnectTo []string `long:"connect-to" description:"For a request to the given HOST1:PORT1 pair, connect to HOST2:PORT2 instead. Can be specified multiple times." value-name:"<HOST1:PORT1:HOST2:PORT2>"`
+	ConnectTo []string `long:"connect-to" description:"For a request to the given HOST1:PORT1 pair, connect to HOST2:PORT2 instead. Empty HOST1 or PORT1 match any host or port, empty HOST2 or PORT2 keep the original ones. Can be specified multiple times." value-name:"<HOST1:PORT1:HOST2:PORT2>"`
 
 	// Head signals that the tool should only fetch headers. If specified,
 	// headers will be written to the output.
 	Head bool `short:"I" long:"head" description:"Fetch the headers only." optional:"yes" optional-value:"true"`
 
+	// Fail makes gocurl fail on HTTP errors without writing the body.
+	Fail bool `short:"f" long:"fail" description:"Fails with exit code 22 if the response status is 400 or greater, the response body is not written." optional:"yes" optional-value:"true"`
+
+	// FailWithBody makes gocurl fail on HTTP errors after writing the body.
+	FailWithBody bool `long:"fail-with-body" description:"Like --fail, but the response body is written." optional:"yes" optional-value:"true"`
+
+	// Range is the byte range of the resource to request.
+	Range ByteRange `short:"r" long:"range" description:"Requests the byte range of the resource with the Range header, e.g. 0-1023, 500- or -500 for the last 500 bytes. Several ranges are separated by commas. Whether the server honored it (206 vs 200) is reported in the verbose and JSON output." value-name:"<range>"`
+
+	// Location makes gocurl follow redirects.
+	Location bool `short:"L" long:"location" description:"Follows redirects (3xx responses with the Location header). POST requests are changed to GET after 301, 302 and 303 like in curl (see --post301). Authorization and Cookie headers are only sent to the scheme, host and port of the original URL (see --location-trusted)." optional:"yes" optional-value:"true"`
+
+	// LocationTrusted makes gocurl send the credentials to other origins when
+	// following redirects.
+	LocationTrusted bool `long:"location-trusted" description:"Like --location, but also sends Authorization and Cookie headers when redirected to another scheme, host or port." optional:"yes" optional-value:"true"`
+
+	// MaxRedirs is the maximum number of redirects to follow.
+	MaxRedirs int `long:"max-redirs" description:"Maximum number of redirects to follow when --location is used. 50 by default, -1 means no limit." value-name:"<num>"`
+
+	// Post301 keeps POST after 301 redirects.
+	Post301 bool `long:"post301" description:"Does not change POST requests to GET when following 301 redirects." optional:"yes" optional-value:"true"`
+
+	// Post302 keeps POST after 302 redirects.
+	Post302 bool `long:"post302" description:"Does not change POST requests to GET when following 302 redirects." optional:"yes" optional-value:"true"`
+
+	// Post303 keeps POST after 303 redirects.
+	Post303 bool `long:"post303" description:"Does not change POST requests to GET when following 303 redirects." optional:"yes" optional-value:"true"`
+
 	// Insecure disables TLS verification of the connection.
 	Insecure bool `short:"k" long:"insecure" description:"Disables TLS verification of the connection." optional:"yes" optional-value:"true"`
 
+	// Cert is the client certificate for mutual TLS.
+	Cert string `short:"E" long:"cert" description:"Client certificate file in PEM or PKCS#12 format for mutual TLS. The password of the PKCS#12 file or of the private key can be added after a colon, colons in the file name are escaped with a backslash. If --key is not specified, the private key is read from the same file. It can also be a PKCS#11 URI (pkcs11:object=<label>?module-path=<module>) of a certificate on a token whose private key is used from the token, this requires gocurl built with cgo and -tags pkcs11." value-name:"<file[:password]|pkcs11:uri>"`
+
+	// Key is the private key of the client certificate.
+	Key string `long:"key" description:"Private key file of the client certificate (see --cert) in PEM format, it can be encrypted (see --pass). If --cert is a PKCS#11 URI, this is the PKCS#11 URI of the private key on the same token." value-name:"<file|pkcs11:uri>"`
+
+	// Pass is the password of the client certificate private key.
+	Pass string `long:"pass" description:"Password of the encrypted private key (see --key) or of the PKCS#12 client certificate (see --cert), or the PIN of the PKCS#11 token unless the URI has pin-value." value-name:"<password>"`
+
+	// CACert is the file with the CA certificates to verify the server with.
+	CACert string `long:"cacert" description:"CA certificates file in PEM format to verify the server certificate with instead of the system ones." value-name:"<file>"`
+
+	// CAPath is the directory with the CA certificates files.
+	CAPath string `long:"capath" description:"Directory with CA certificates files in PEM format (plain or OpenSSL hashed names) to verify the server certificate with instead of the system ones. Can be combined with --cacert." value-name:"<dir>"`
+
+	// CANative makes gocurl use the system CA certificates together with
+	// --cacert and --capath.
+	CANative bool `long:"ca-native" description:"Uses the CA certificates of the operating system (the Windows or macOS certificate store) together with --cacert and --capath. Without it, --cacert and --capath replace the system ones." optional:"yes" optional-value:"true"`
+
+	// PinnedPubKey is the public key or the hashes of the public keys that
+	// the server certificate must have.
+	PinnedPubKey string `long:"pinnedpubkey" description:"Public key file in PEM or DER format or a list of base64-encoded SHA-256 hashes of public keys (sha256//<hash>;sha256//<hash>) that the server certificate or one of its chain must match." value-name:"<file|hashes>"`
+
+	// CertStatus requires the server to staple a valid OCSP response.
+	CertStatus bool `long:"cert-status" description:"Requires the server to staple an OCSP response and fails if it is missing, invalid or the certificate is not good." optional:"yes" optional-value:"true"`
+
+	// CRLFile is the file with the certificate revocation lists.
+	CRLFile string `long:"crlfile" description:"Certificate revocation lists file in PEM or DER format. The connection fails if the server certificate or one of its chain is revoked." value-name:"<file>"`
+
 	// TLSv13 forces to use TLS v1.3.
 	TLSv13 bool `long:"tlsv1.3" description:"Forces gocurl to use TLS v1.3 or newer." optional:"yes" optional-value:"true"`
 
@@ -52,6 +253,10 @@ type Options struct {
 	// available ciphers.
 	TLSCiphers string `long:"ciphers" description:"Specifies which ciphers to use in the connection, see https://go.dev/src/crypto/tls/cipher_suites.go for the full list of available ciphers." value-name:"<space-separated list of ciphers>"`
 
+	// Front is the domain that is used for the TLS server name and as the
+	// connection target (domain fronting).
+	Front string `long:"front" description:"Domain fronting: connects to DOMAIN and sends it in TLS ClientHello, but keeps the Host header and verifies the certificate against the URL host." value-name:"<DOMAIN>"`
+
 	// TLSServerName allows to send a specified server name in the TLS
 	// ClientHello extension.
 	TLSServerName string `long:"tls-servername" description:"Specifies the server name that will be sent in TLS ClientHello" value-name:"<HOSTNAME>"`
@@ -65,6 +270,17 @@ type Options struct {
 	// HTTPv3 forces to use HTTP v3.
 	HTTPv3 bool `long:"http3" description:"Forces gocurl to use HTTP v3." optional:"yes" optional-value:"true"`
 
+	// HTTPv3Only is the same as HTTPv3.
+	HTTPv3Only bool `long:"http3-only" description:"Forces gocurl to use HTTP v3, the same as --http3." optional:"yes" optional-value:"true"`
+
+	// HTTPv3Try makes gocurl attempt HTTP v3 first and fall back to HTTP v2
+	// or HTTP v1.1 if it fails.
+	HTTPv3Try bool `long:"http3-try" description:"Attempts HTTP v3 first and falls back to HTTP v2 or HTTP v1.1 on timeout or negotiation failure." optional:"yes" optional-value:"true"`
+
+	// HTTP3ALPN is the comma-separated list of ALPN identifiers offered for
+	// HTTP/3 connections.
+	HTTP3ALPN string `long:"http3-alpn" description:"Comma-separated list of ALPN identifiers offered for HTTP/3 connections, e.g. h3-29,h3. h3 by default. The negotiated one is printed in the verbose mode. Requires --http3." value-name:"<list>"`
+
 	// ECH forces usage of Encrypted Client Hello for the request.  If other
 	// ECH-related fields are not specified, the ECH configuration will be
 	// received from the DNS settings.
@@ -90,7 +306,39 @@ type Options struct {
 
 	// Resolve allows to provide a custom address for a specific host and port
 	// pair. Supports '*' instead of the host name to cover all hosts.
-	Resolve []string `long:"resolve" description:"Provide a custom address for a specific host. port is ignored by gocurl. '*' can be used instead of the host name. Can be specified multiple times." value-name:"<[+]host:port:addr[,addr]...>"`
+	Resolve []string `long:"resolve" description:"Provide a custom address for a specific host. port is ignored by gocurl. '*' can be used instead of the host name. addr can also be a host name that is resolved instead of host. Can be specified multiple times." value-name:"<[+]host:port:addr[,addr]...>"`
+
+	// HostsFile is the path to the hosts-format file with custom addresses.
+	HostsFile string `long:"hosts-file" description:"Reads custom addresses of hosts from the file in the /etc/hosts format. Its entries have priority over DNS and wildcard --resolve, but not over --resolve for the same host." value-name:"<file>"`
+
+	// MaxTime is the maximum duration of the whole operation.
+	MaxTime time.Duration `short:"m" long:"max-time" description:"Fails if the whole operation takes longer than the specified duration (e.g. 30s): resolving the host name, connecting, the handshakes, sending the request and receiving the response body. Retries (see --retry) are included." value-name:"<duration>"`
+
+	// DNSTimeout is the maximum duration of resolving a host name.
+	DNSTimeout time.Duration `long:"dns-timeout" description:"Fails if resolving a host name takes longer than the specified duration (e.g. 2s)." value-name:"<duration>"`
+
+	// TLSHandshakeTimeout is the maximum duration of the TLS or QUIC
+	// handshake.
+	TLSHandshakeTimeout time.Duration `long:"tls-handshake-timeout" description:"Fails if the TLS or QUIC handshake takes longer than the specified duration (e.g. 5s)." value-name:"<duration>"`
+
+	// ResponseHeaderTimeout is the maximum duration of waiting for the
+	// response header.
+	ResponseHeaderTimeout time.Duration `long:"response-header-timeout" description:"Fails if the response header is not received within the specified duration (e.g. 10s) after the request is sent. For HTTP/3 the time is counted from the start of the request." value-name:"<duration>"`
+
+	// Expect100Timeout is the maximum duration of waiting for the 100 Continue
+	// response before sending the body anyway.
+	Expect100Timeout time.Duration `long:"expect100-timeout" description:"Maximum time to wait for the 100 Continue response before sending the body anyway (e.g. 2s). 1s by default. Expect: 100-continue is sent with bodies larger than 1 MiB or of unknown size, -H 'Expect:' disables it. Ignored with --http2 and --http3." value-name:"<duration>"`
+
+	// ReadTimeout is the maximum duration of waiting for the response body
+	// data.
+	ReadTimeout time.Duration `long:"read-timeout" description:"Fails if no data of the response body is received for the specified duration (e.g. 30s) since the response header or the previous data." value-name:"<duration>"`
+
+	// SpeedLimit is the minimum transfer speed.
+	SpeedLimit string `long:"speed-limit" description:"Aborts the transfer if it's slower than the specified speed in bytes per second for --speed-time (30s by default). The time until the response header is received counts as zero speed. Supports k, m and g suffixes." value-name:"<speed>"`
+
+	// SpeedTime is the duration during which the transfer may be slower than
+	// SpeedLimit.
+	SpeedTime time.Duration `long:"speed-time" description:"Aborts the transfer if it's slower than --speed-limit (1 byte per second by default) for the specified duration (e.g. 10s)." value-name:"<duration>"`
 
 	// TLSSplitHello is an option that allows splitting TLS ClientHello in two
 	// parts in order to avoid common DPI systems detecting TLS. CHUNKSIZE is
@@ -98,12 +346,187 @@ type Options struct {
 	// in milliseconds before sending the second part.
 	TLSSplitHello string `long:"tls-split-hello" description:"An option that allows splitting TLS ClientHello in two parts in order to avoid common DPI systems detecting TLS. CHUNKSIZE is the size of the first bytes before ClientHello is split, DELAY is delay in milliseconds before sending the second part." value-name:"<CHUNKSIZE:DELAY>"`
 
+	// IPTOS is the value of the IP TOS field (traffic class for IPv6).
+	IPTOS int `long:"ip-tos" description:"Sets the IP TOS field (traffic class for IPv6) of the outgoing packets, for instance, for DSCP marking." value-name:"<TOS>"`
+
+	// IPTTL is the IP TTL (hop limit for IPv6) of the outgoing packets.
+	IPTTL int `long:"ip-ttl" description:"Sets the IP TTL (hop limit for IPv6) of the outgoing packets." value-name:"<TTL>"`
+
+	// MPTCP requests Multipath TCP for the connections.
+	MPTCP bool `long:"mptcp" description:"Requests Multipath TCP for the connections. Whether it was actually used is reported in the verbose and JSON output." optional:"yes" optional-value:"true"`
+
+	// TCPMSS is the TCP maximum segment size of the outgoing connections.
+	TCPMSS int `long:"tcp-mss" description:"Sets the TCP maximum segment size (TCP_MAXSEG) of the outgoing connections." value-name:"<bytes>"`
+
+	// SockOpts is the list of arbitrary socket options that are set on the
+	// outgoing connections.
+	SockOpts []string `long:"sockopt" description:"Sets an arbitrary integer socket option on the outgoing connections. Level and name can be numbers or constant names, e.g. IPPROTO_TCP:TCP_USER_TIMEOUT:1000. Can be specified multiple times." value-name:"<level:name:value>"`
+
+	// WriteJitter is an option that inserts random delays between writes to
+	// the connection. MIN and MAX are the delay bounds in milliseconds.
+	WriteJitter string `long:"write-jitter" description:"Inserts a random delay between writes to the connection in order to test timing-based DPI heuristics. MIN and MAX are the delay bounds in milliseconds." value-name:"<MIN:MAX>"`
+
+	// TCPDisorder makes the server receive the second part of the split
+	// ClientHello before the first one.
+	TCPDisorder bool `long:"tcp-disorder" description:"Makes the server receive the second part of ClientHello split by --tls-split-hello before the first one. The first part is sent with TTL 1 so that it's dropped and retransmitted later." optional:"yes" optional-value:"true"`
+
+	// HTTPMangle is a list of ways to modify plain HTTP requests.
+	HTTPMangle []string `long:"http-mangle" description:"Modifies plain HTTP requests to test DPI systems that filter HTTP by keywords. MODE is one of: host-case (mix Host header case), space (extra space in the request line), split (split the request in the middle of the Host header). Can be specified multiple times." value-name:"<MODE>"`
+
+	// TLSSplitSNI is an option that allows splitting TLS ClientHello inside
+	// the server name. OFFSETS are the comma-separated split points relative to
+	// the beginning of the server name, DELAY is delay in milliseconds before
+	// sending each next part.
+	TLSSplitSNI string `long:"tls-split-sni" description:"An option that allows splitting TLS ClientHello right inside the server name (SNI) to avoid DPI systems matching it. OFFSETS are the comma-separated split points relative to the beginning of the server name, DELAY is optional delay in milliseconds before sending each next part." value-name:"<OFFSETS[:DELAY]>"`
+
+	// TLSFakeHello is an option that makes gocurl send a decoy ClientHello
+	// with a fake server name before the real one. TTL is the TTL of the
+	// packet with the decoy, it should be big enough to reach DPI, but not the
+	// server.
+	TLSFakeHello string `long:"tls-fake-hello" description:"An option that allows sending a decoy ClientHello with a fake server name before the real one (Linux only). SNI is the fake server name, TTL is the TTL of the packet with the decoy that should be low enough so that it does not reach the server (8 by default)." value-name:"<SNI[:TTL]>"`
+
+	// QUICSplit is the number of QUIC Initial packets ClientHello is split
+	// into.
+	QUICSplit int `long:"quic-split" description:"Splits ClientHello into N QUIC Initial packets each sent in a separate UDP datagram. Requires --http3." value-name:"<N>"`
+
+	// QUICReorder makes the QUIC Initial packets with ClientHello parts to be
+	// sent in the reversed order.
+	QUICReorder bool `long:"quic-reorder" description:"Sends the QUIC Initial packets with ClientHello parts in the reversed order. Requires --quic-split." optional:"yes" optional-value:"true"`
+
+	// QUICInitialSize is the minimum size of datagrams with QUIC Initial
+	// packets.
+	QUICInitialSize int `long:"quic-initial-size" description:"Pads UDP datagrams with QUIC Initial packets to at least SIZE bytes. Requires --http3." value-name:"<SIZE>"`
+
+	// QUICIdleTimeout is the idle timeout of QUIC connections.
+	QUICIdleTimeout time.Duration `long:"quic-idle-timeout" description:"Closes the QUIC connection when there is no network activity for the specified duration (e.g. 1m). 30s by default. Requires --http3." value-name:"<duration>"`
+
+	// QUICKeepAlive is the period of QUIC keep-alive packets.
+	QUICKeepAlive time.Duration `long:"quic-keepalive" description:"Sends QUIC keep-alive (PING) packets with the specified period (e.g. 15s) to keep the connection and NAT bindings alive. Disabled by default. Requires --http3." value-name:"<duration>"`
+
+	// QUICStreamWindow is the initial flow-control limit of QUIC streams.
+	QUICStreamWindow uint64 `long:"quic-stream-window" description:"Initial flow-control limit of QUIC streams in bytes (initial_max_stream_data_* transport parameters). Requires --http3." value-name:"<bytes>"`
+
+	// QUICConnWindow is the initial flow-control limit of QUIC connections.
+	QUICConnWindow uint64 `long:"quic-conn-window" description:"Initial flow-control limit of the QUIC connection in bytes (initial_max_data transport parameter). Requires --http3." value-name:"<bytes>"`
+
+	// QUICVersion is the QUIC version of HTTP/3 connections.
+	QUICVersion string `long:"quic-version" description:"QUIC version of HTTP/3 connections: v1 (RFC 9000, default) or v2 (RFC 9369). Requires --http3." value-name:"<v1|v2>"`
+
+	// TLSRecordSplit is an option that allows splitting TLS ClientHello into
+	// several TLS records. SIZE is the maximum size of the handshake data in
+	// each record.
+	TLSRecordSplit int `long:"tls-record-split" description:"An option that allows splitting TLS ClientHello into several TLS records (not just TCP segments like --tls-split-hello) to avoid DPI systems that reassemble TCP, but not TLS records. SIZE is the maximum size of each record payload." value-name:"<SIZE>"`
+
 	// OutputJSON enables writing output in JSON format.
 	OutputJSON bool `long:"json-output" description:"Makes gocurl write machine-readable output in JSON format." optional:"yes" optional-value:"true"`
 
+	// JSONHeadersMap makes gocurl write the response headers as a map in the
+	// JSON output like it used to.
+	JSONHeadersMap bool `long:"json-headers-map" description:"Writes the response headers as a map of names to lists of values in the JSON output instead of an ordered list of name/value pairs." optional:"yes" optional-value:"true"`
+
 	// OutputPath defines where to write the received data. If not set, gocurl
 	// will write everything to stdout.
-	OutputPath string `short:"o" long:"output" description:"Defines where to write the received data. If not set, gocurl will write everything to stdout." value-name:"<file>"`
+	OutputPath string `short:"o" long:"output" description:"Defines where to write the received data. If not set, gocurl will write everything to stdout. The path may be a template with {host}, {port}, {path}, {file} (the last path segment), {query} and {n} (the number of the URL) that are replaced for every URL, e.g. with --url-file." value-name:"<file>"`
+
+	// OutputDir is the directory where the output files are saved.
+	OutputDir string `long:"output-dir" description:"Saves the files of --output and --remote-name to the specified directory." value-name:"<dir>"`
+
+	// CreateDirs makes gocurl create the missing directories of the output
+	// files.
+	CreateDirs bool `long:"create-dirs" description:"Creates the missing directories of the --output and --remote-name files." optional:"yes" optional-value:"true"`
+
+	// RemoteName makes gocurl write the received data to a file named like
+	// the remote file.
+	RemoteName bool `short:"O" long:"remote-name" description:"Writes the received data to a file in the current directory named like the last segment of the URL path." optional:"yes" optional-value:"true"`
+
+	// RemoteHeaderName makes gocurl take the file name from the
+	// Content-Disposition header.
+	RemoteHeaderName bool `short:"J" long:"remote-header-name" description:"With --remote-name, takes the file name from the Content-Disposition response header if there is one. Only the base name is used and the existing files are not overwritten." optional:"yes" optional-value:"true"`
+
+	// ContinueAt is the offset to resume the download from.
+	ContinueAt string `short:"C" long:"continue-at" description:"Resumes the download from the specified byte offset: requests the rest of the resource with the Range header and appends it to --output. - takes the offset from the size of the --output file. Only a 206 response is appended, 416 means that the file is already complete and any other response fails." value-name:"<offset|->"`
+
+	// MetricsFile is the path to the file where the transfer metrics are
+	// appended.
+	MetricsFile string `long:"metrics-file" description:"Appends a record with the timings, sizes, status, protocol and remote IP of every transfer to the file. The format is CSV if the file has the .csv extension, otherwise JSON (one object per line)." value-name:"<path>"`
+
+	// DumpHeader is the path to the file where the response headers are
+	// written.
+	DumpHeader string `short:"D" long:"dump-header" description:"Writes the response headers to the file, including the headers of the followed redirects. Use - for stdout." value-name:"<path>"`
+
+	// WriteOut is the format of the information written to stdout after
+	// every transfer.
+	WriteOut string `short:"w" long:"write-out" description:"Writes the information about the transfer to stdout after it's completed. Supported variables are %{http_code}, %{time_namelookup}, %{time_connect}, %{time_appconnect}, %{time_starttransfer}, %{time_total}, %{remote_ip}, %{ssl_verify_result}, %{size_download}, %{size_upload} and %{url_effective}, \\n, \\r and \\t are replaced with the special characters. If the format starts with @, it's read from the file (@- for stdin)." value-name:"<format>"`
+
+	// SaveExchange is the directory where every request and response are
+	// saved.
+	SaveExchange string `long:"save-exchange" description:"Saves every transfer into a new timestamped directory inside the specified one: the request, the response headers and body, the server certificates and meta.json with the summary. Useful for bug reports." value-name:"<dir>"`
+
+	// SessionFile is the path to the file with the state shared by separate
+	// invocations.
+	SessionFile string `long:"session" description:"Loads cookies, Alt-Svc entries and TLS/QUIC session tickets from the file and saves the updated ones back so that separate invocations behave like one browser session. The file is created if it does not exist." value-name:"<file>"`
+
+	// GenerateGo is the path to the file where the Go code that makes the same
+	// request is written.
+	GenerateGo string `long:"generate-go" description:"Writes a standalone Go program that makes the same request using net/http to the file ('-' for stdout), similar to curl's --libcurl. Options that can't be reproduced are listed in a comment." value-name:"<file>"`
+
+	// Repeat is the number of times the request will be repeated.  When it is
+	// set, gocurl works in the benchmark mode, i.e. it prints the requests
+	// statistics instead of the response.
+	Repeat int `long:"repeat" description:"Repeats the request N times and prints the benchmark statistics (throughput, latency percentiles and errors) instead of the response." value-name:"<N>"`
+
+	// Concurrency is the number of workers that send requests concurrently in
+	// the benchmark mode.
+	Concurrency int `long:"concurrency" description:"Number of requests that are sent concurrently when --repeat is used. 1 by default." value-name:"<C>"`
+
+	// Interval enables the watch mode in which the request is repeated
+	// periodically with the specified interval.
+	Interval time.Duration `long:"interval" description:"Repeats the request periodically with the specified interval (e.g. 5s) and prints a status line per attempt." value-name:"<duration>"`
+
+	// CompareWith is the URL the response is compared with.
+	CompareWith string `long:"compare-with" description:"Sends the same request to this URL as well and prints the differences between the responses (status, headers and body) instead of the response. The Date header is ignored. Exits with 1 if the responses differ. \"gocurl diff [OPTIONS] URL1 URL2\" is a shortcut for this." value-name:"<URL>"`
+
+	// ConnectOnly makes gocurl only establish the connection and then bridge
+	// stdin/stdout to it.
+	ConnectOnly bool `long:"connect-only" description:"Only establishes the connection to the URL host including the TLS or QUIC (with --http3) handshake, prints its information and the timings of every step, and then bridges stdin/stdout to it. For https URLs it is a TLS connection (like openssl s_client), http://, tcp:// and udp:// URLs open plain connections (like netcat). With --json-output, the information is written as JSON and the connection is closed, useful for reachability monitoring. The URL can be specified as host:port." optional:"yes" optional-value:"true"`
+
+	// UntilStatus stops the watch mode once the response with this status code
+	// is received.
+	UntilStatus int `long:"until-status" description:"Stops repeating the request when a response with the specified status code is received. Requires --interval." value-name:"<code>"`
+
+	// MaxIterations limits the number of attempts in the watch mode.
+	MaxIterations int `long:"max-iterations" description:"Maximum number of attempts when --interval is used. Unlimited by default." value-name:"<N>"`
+
+	// ExpectStatus is the expected response status code.
+	ExpectStatus int `long:"expect-status" description:"Fails with a non-zero exit code if the response status code is not the specified one." value-name:"<code>"`
+
+	// ExpectHeaders is the list of expected response headers.
+	ExpectHeaders []string `long:"expect-header" description:"Fails with a non-zero exit code if the response header value does not match the regular expression. Can be specified multiple times." value-name:"<name:regex>"`
+
+	// ExpectBodyRegex is the regular expression the response body must match.
+	ExpectBodyRegex string `long:"expect-body-regex" description:"Fails with a non-zero exit code if the response body does not match the regular expression." value-name:"<regex>"`
+
+	// ExpectMaxTime is the maximum expected duration of the request.
+	ExpectMaxTime time.Duration `long:"expect-max-time" description:"Fails with a non-zero exit code if receiving the response takes longer than the specified duration (e.g. 500ms)." value-name:"<duration>"`
+
+	// LimitRate limits the download and upload speed.
+	LimitRate string `long:"limit-rate" description:"Maximum transfer speed in bytes per second like in curl, applies to both the response and the request body. Supports k, m and g suffixes, e.g. 500k." value-name:"<speed>"`
+
+	// LimitRateUpload limits the upload speed.
+	LimitRateUpload string `long:"limit-rate-upload" description:"Maximum upload speed in bytes per second, applies to the request body and overrides --limit-rate for it. Supports k, m and g suffixes." value-name:"<speed>"`
+
+	// MaxMemory limits the amount of memory used for buffering response
+	// bodies.
+	MaxMemory string `long:"max-memory" description:"Maximum size of the response body that is buffered in memory (for --json-output or WebSocket). The rest is spilled to a temporary file. Supports k, m and g suffixes. Unlimited by default." value-name:"<size>"`
+
+	// MaxHeaderSize limits the size of the response header.
+	MaxHeaderSize string `long:"max-header-size" description:"Maximum size of the response header, applies to all HTTP versions. Supports k, m and g suffixes." value-name:"<size>"`
+
+	// CharsetConvert enables converting text response bodies to UTF-8.
+	CharsetConvert bool `long:"charset-convert" description:"Converts text response bodies to UTF-8. The charset is taken from the Content-Type header or, for HTML documents, from the <meta> tags." optional:"yes" optional-value:"true"`
+
+	// CacheDir enables the HTTP cache stored in the specified directory.
+	CacheDir string `long:"cache-dir" description:"Enables the local HTTP cache (RFC 9111) stored in the specified directory. Fresh responses are served from the cache, stale ones are revalidated. The Cache-Status response header reports how the request was handled." value-name:"<dir>"`
 
 	// Experiments allows to enable experimental configuration options.
 	Experiments []string `long:"experiment" description:"Allows enabling experimental options. See the documentation for available options. Can be specified multiple times." value-name:"<name[:value]>"`
@@ -112,6 +535,75 @@ type Options struct {
 	Verbose bool `short:"v" long:"verbose" description:"Verbose output (optional)." optional:"yes" optional-value:"true"`
 }
 
+// ByteRange is the --range value.  It's validated when the config is parsed.
+type ByteRange string
+
+// type check
+var _ goFlags.ValueValidator = (*ByteRange)(nil)
+
+// IsValidValue implements the goFlags.ValueValidator interface for *ByteRange.
+// It allows the values that start with a dash, i.e. the suffix ranges like
+// -500, which are otherwise taken for options.
+func (r *ByteRange) IsValidValue(_ string) (err error) {
+	return nil
+}
+
+// DataValue is a single --data or --data-urlencode value.
+type DataValue struct {
+	// Value is the value as it was specified in the command line.
+	Value string
+
+	// URLEncode is true if the value is from --data-urlencode.
+	URLEncode bool
+}
+
+// DataFlag is the type of the --data and --data-urlencode options.  Both
+// options append their values to the same list so that the values are joined
+// in the command-line order like in curl.
+type DataFlag struct {
+	// values is the list shared by --data and --data-urlencode.
+	values *[]*DataValue
+
+	// urlEncode is true for --data-urlencode.
+	urlEncode bool
+}
+
+// type check
+var _ goFlags.Unmarshaler = (*DataFlag)(nil)
+
+// UnmarshalFlag implements the goFlags.Unmarshaler interface for *DataFlag.
+func (f *DataFlag) UnmarshalFlag(value string) (err error) {
+	*f.values = append(*f.values, &DataValue{Value: value, URLEncode: f.urlEncode})
+
+	return nil
+}
+
+// type check
+var _ json.Marshaler = DataFlag{}
+
+// MarshalJSON implements the json.Marshaler interface for DataFlag.  Only the
+// values of the option itself are written.
+func (f DataFlag) MarshalJSON() (b []byte, err error) {
+	var values []string
+	for _, v := range f.Values() {
+		if v.URLEncode == f.urlEncode {
+			values = append(values, v.Value)
+		}
+	}
+
+	return json.Marshal(values)
+}
+
+// Values returns the values of both --data and --data-urlencode in the
+// command-line order.
+func (f DataFlag) Values() (values []*DataValue) {
+	if f.values == nil {
+		return nil
+	}
+
+	return *f.values
+}
+
 // String implements fmt.Stringer interface for Options.
 func (o *Options) String() (s string) {
 	b, _ := json.MarshalIndent(o, "", "    ")
@@ -119,20 +611,27 @@ func (o *Options) String() (s string) {
 	return string(b)
 }
 
-// parseOptions parses os.Args and creates the Options struct.
-func parseOptions() (o *Options, err error) {
-	opts := &Options{}
+// parseOptions parses the command-line arguments args (without the program
+// name) and creates the Options struct.
+func parseOptions(args []string) (o *Options, err error) {
+	// --data and --data-urlencode share the list of values, see DataFlag.
+	var data []*DataValue
+	opts := &Options{
+		Data:          DataFlag{values: &data},
+		DataURLEncode: DataFlag{values: &data, urlEncode: true},
+	}
 	parser := goFlags.NewParser(opts, goFlags.Default|goFlags.IgnoreUnknown)
-	remainingArgs, err := parser.ParseArgs(os.Args[1:])
+	remainingArgs, err := parser.ParseArgs(args)
 	if err != nil {
 		return nil, err
 	}
 
-	if len(remainingArgs) != 1 && opts.URL == "" {
-		return nil, fmt.Errorf("URL not found in the arguments: %v", os.Args)
+	if len(remainingArgs) > 1 ||
+		(len(remainingArgs) == 0 && opts.URL == "" && opts.URLFile == "") {
+		return nil, fmt.Errorf("URL not found in the arguments: %v", args)
 	}
 
-	if opts.URL == "" {
+	if opts.URL == "" && len(remainingArgs) == 1 {
 		opts.URL = remainingArgs[0]
 	}
 
@@ -0,0 +1,159 @@
+package cookie
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Jar is the http.CookieJar that also keeps the list of its cookies in the
+// format returned by Parse so that they could be written to the cookie file,
+// see --cookie-jar.
+type Jar struct {
+	mu      *sync.Mutex
+	jar     *cookiejar.Jar
+	cookies []*http.Cookie
+}
+
+// type check
+var _ http.CookieJar = (*Jar)(nil)
+
+// NewJar returns the cookie jar with cookies in the format returned by Parse.
+// Expired cookies are not added.
+func NewJar(cookies []*http.Cookie) (j *Jar) {
+	// cookiejar.New never returns an error when options are nil.
+	jar, _ := cookiejar.New(nil)
+
+	j = &Jar{
+		mu:  &sync.Mutex{},
+		jar: jar,
+	}
+
+	now := time.Now()
+	for _, c := range cookies {
+		u := &url.URL{
+			Scheme: "http",
+			Host:   strings.TrimPrefix(c.Domain, "."),
+			Path:   c.Path,
+		}
+
+		if c.Secure {
+			u.Scheme = "https"
+		}
+
+		added := *c
+		if !strings.HasPrefix(c.Domain, ".") {
+			// The jar makes the cookies without domain host-only.
+			added.Domain = ""
+		}
+
+		j.jar.SetCookies(u, []*http.Cookie{&added})
+		j.add(c, isExpired(c, now))
+	}
+
+	return j
+}
+
+// SetCookies implements the http.CookieJar interface for *Jar.
+func (j *Jar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.jar.SetCookies(u, cookies)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now()
+	for _, c := range cookies {
+		saved, ok := fileCookie(u, c, now)
+		if ok {
+			j.add(saved, c.MaxAge < 0 || isExpired(saved, now))
+		}
+	}
+}
+
+// Cookies implements the http.CookieJar interface for *Jar.
+func (j *Jar) Cookies(u *url.URL) (cookies []*http.Cookie) {
+	return j.jar.Cookies(u)
+}
+
+// All returns the cookies of the jar that are not expired in the format
+// returned by Parse.
+func (j *Jar) All() (cookies []*http.Cookie) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now()
+	for _, c := range j.cookies {
+		if !isExpired(c, now) {
+			cookies = append(cookies, c)
+		}
+	}
+
+	return cookies
+}
+
+// add replaces the cookie with the same name, domain and path with c or
+// removes it if c is expired.  j.mu must be locked unless j is being created.
+func (j *Jar) add(c *http.Cookie, expired bool) {
+	cookies := j.cookies[:0]
+	for _, old := range j.cookies {
+		if old.Name != c.Name || old.Domain != c.Domain || old.Path != c.Path {
+			cookies = append(cookies, old)
+		}
+	}
+
+	if !expired {
+		cookies = append(cookies, c)
+	}
+
+	j.cookies = cookies
+}
+
+// fileCookie converts the cookie c set by the response from u to the format
+// returned by Parse.  ok is false if the domain of c doesn't match u, such
+// cookies are rejected by the jar.
+func fileCookie(u *url.URL, c *http.Cookie, now time.Time) (saved *http.Cookie, ok bool) {
+	host := strings.ToLower(u.Hostname())
+	domain := host
+	if c.Domain != "" {
+		d := strings.ToLower(strings.TrimPrefix(c.Domain, "."))
+		if host != d && !strings.HasSuffix(host, "."+d) {
+			return nil, false
+		}
+
+		domain = "." + d
+	}
+
+	p := c.Path
+	if !strings.HasPrefix(p, "/") {
+		// The default path, see RFC 6265, section 5.1.4.
+		p = path.Dir(u.EscapedPath())
+		if !strings.HasPrefix(p, "/") {
+			p = "/"
+		}
+	}
+
+	saved = &http.Cookie{
+		Name:     c.Name,
+		Value:    c.Value,
+		Domain:   domain,
+		Path:     p,
+		Expires:  c.Expires,
+		Secure:   c.Secure,
+		HttpOnly: c.HttpOnly,
+	}
+
+	if c.MaxAge > 0 {
+		saved.Expires = now.Add(time.Duration(c.MaxAge) * time.Second)
+	}
+
+	return saved, true
+}
+
+// isExpired returns true if the persistent cookie c is expired at now.
+func isExpired(c *http.Cookie, now time.Time) (ok bool) {
+	return !c.Expires.IsZero() && !c.Expires.After(now)
+}
@@ -0,0 +1,63 @@
+package cookie_test
+
+import (
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ameshkov/gocurl/internal/cookie"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJar(t *testing.T) {
+	jar := cookie.NewJar([]*http.Cookie{{
+		Name:   "old",
+		Value:  "1",
+		Domain: "example.org",
+		Path:   "/",
+	}})
+
+	u, err := url.Parse("https://www.example.org/api/v1")
+	require.NoError(t, err)
+
+	jar.SetCookies(u, []*http.Cookie{{
+		Name:   "domain",
+		Value:  "2",
+		Domain: "example.org",
+		MaxAge: 3600,
+	}, {
+		Name:     "host",
+		Value:    "3",
+		Secure:   true,
+		HttpOnly: true,
+	}, {
+		Name:   "foreign",
+		Value:  "4",
+		Domain: "other.org",
+	}})
+
+	cookies := jar.All()
+	require.Len(t, cookies, 3)
+
+	require.Equal(t, ".example.org", cookies[1].Domain)
+	require.Equal(t, "/api", cookies[1].Path)
+	require.WithinDuration(t, time.Now().Add(time.Hour), cookies[1].Expires, time.Minute)
+
+	require.Equal(t, "www.example.org", cookies[2].Domain)
+	require.True(t, cookies[2].HttpOnly)
+
+	path := filepath.Join(t.TempDir(), "cookies.txt")
+	err = cookie.WriteFile(path, cookies)
+	require.NoError(t, err)
+
+	read, err := cookie.ReadFile(path)
+	require.NoError(t, err)
+	require.Len(t, read, 3)
+	require.Equal(t, cookies[2], read[2])
+
+	// Max-Age below zero deletes the cookie.
+	jar.SetCookies(u, []*http.Cookie{{Name: "host", MaxAge: -1}})
+	require.Len(t, jar.All(), 2)
+}
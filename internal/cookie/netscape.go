@@ -0,0 +1,148 @@
+// Package cookie implements the cookie files in the Netscape format that curl
+// uses, see --cookie and --cookie-jar.
+package cookie
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// httpOnlyPrefix is the prefix of the domain of HttpOnly cookies.
+const httpOnlyPrefix = "#HttpOnly_"
+
+// fileHeader is written at the start of the cookie files.
+const fileHeader = "# Netscape HTTP Cookie File\n# This file was generated by gocurl.\n\n"
+
+// ReadFile reads the cookies from the Netscape cookie file at path, see Parse.
+func ReadFile(path string) (cookies []*http.Cookie, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	cookies, err = Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	return cookies, nil
+}
+
+// Parse parses the cookies in the Netscape format from r.  Every line
+// consists of seven tab-separated fields: domain, whether the subdomains are
+// included, path, secure, expiration time in Unix seconds (0 for session
+// cookies), name and value.  Comments and empty lines are skipped.
+//
+// The domain of the cookies that include subdomains starts with a dot, the
+// domain of host-only cookies does not.
+func Parse(r io.Reader) (cookies []*http.Cookie, err error) {
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimRight(s.Text(), "\r")
+
+		httpOnly := strings.HasPrefix(line, httpOnlyPrefix)
+		line = strings.TrimPrefix(line, httpOnlyPrefix)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var c *http.Cookie
+		c, err = parseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+
+		c.HttpOnly = httpOnly
+		cookies = append(cookies, c)
+	}
+
+	return cookies, s.Err()
+}
+
+// parseLine parses a single cookie line without the HttpOnly prefix.
+func parseLine(line string) (c *http.Cookie, err error) {
+	fields := strings.Split(line, "\t")
+	if len(fields) != 7 {
+		return nil, fmt.Errorf("expected 7 tab-separated fields, got %d", len(fields))
+	}
+
+	expires, err := strconv.ParseInt(fields[4], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expiration time: %w", err)
+	}
+
+	domain := strings.TrimPrefix(fields[0], ".")
+	if domain == "" {
+		return nil, fmt.Errorf("empty domain")
+	}
+
+	if strings.EqualFold(fields[1], "TRUE") {
+		domain = "." + domain
+	}
+
+	c = &http.Cookie{
+		Name:   fields[5],
+		Value:  fields[6],
+		Domain: domain,
+		Path:   fields[2],
+		Secure: strings.EqualFold(fields[3], "TRUE"),
+	}
+
+	if expires != 0 {
+		c.Expires = time.Unix(expires, 0)
+	}
+
+	return c, nil
+}
+
+// WriteFile writes cookies in the format returned by Parse to the Netscape
+// cookie file at path.
+func WriteFile(path string, cookies []*http.Cookie) (err error) {
+	b := &strings.Builder{}
+	b.WriteString(fileHeader)
+	for _, c := range cookies {
+		writeLine(b, c)
+	}
+
+	return os.WriteFile(path, []byte(b.String()), 0o600)
+}
+
+// writeLine writes the line of the cookie c to b.
+func writeLine(b *strings.Builder, c *http.Cookie) {
+	if c.HttpOnly {
+		b.WriteString(httpOnlyPrefix)
+	}
+
+	var expires int64
+	if !c.Expires.IsZero() {
+		expires = c.Expires.Unix()
+	}
+
+	_, _ = fmt.Fprintf(
+		b,
+		"%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+		c.Domain,
+		boolField(strings.HasPrefix(c.Domain, ".")),
+		c.Path,
+		boolField(c.Secure),
+		expires,
+		c.Name,
+		c.Value,
+	)
+}
+
+// boolField returns the representation of v in the cookie file.
+func boolField(v bool) (s string) {
+	if v {
+		return "TRUE"
+	}
+
+	return "FALSE"
+}
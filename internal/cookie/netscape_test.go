@@ -0,0 +1,58 @@
+package cookie_test
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ameshkov/gocurl/internal/cookie"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	const data = "# Netscape HTTP Cookie File\n" +
+		"\n" +
+		".example.org\tTRUE\t/\tFALSE\t0\tsession\t1\n" +
+		"#HttpOnly_example.org\tFALSE\t/api\tTRUE\t4102444800\ttoken\tabc\n" +
+		"example.org\tFALSE\t/\tFALSE\t1\texpired\t1\n"
+
+	cookies, err := cookie.Parse(strings.NewReader(data))
+	require.NoError(t, err)
+	require.Len(t, cookies, 3)
+
+	require.Equal(t, &http.Cookie{
+		Name:   "session",
+		Value:  "1",
+		Domain: ".example.org",
+		Path:   "/",
+	}, cookies[0])
+
+	require.Equal(t, &http.Cookie{
+		Name:     "token",
+		Value:    "abc",
+		Domain:   "example.org",
+		Path:     "/api",
+		Expires:  time.Unix(4102444800, 0),
+		Secure:   true,
+		HttpOnly: true,
+	}, cookies[1])
+
+	jar := cookie.NewJar(cookies)
+
+	u, err := url.Parse("https://www.example.org/api/v1")
+	require.NoError(t, err)
+	require.Equal(t, []*http.Cookie{{Name: "session", Value: "1"}}, jar.Cookies(u))
+
+	u, err = url.Parse("https://example.org/api/v1")
+	require.NoError(t, err)
+	require.Len(t, jar.Cookies(u), 2)
+
+	u, err = url.Parse("http://example.org/api/v1")
+	require.NoError(t, err)
+	require.Len(t, jar.Cookies(u), 1)
+
+	_, err = cookie.Parse(strings.NewReader("example.org\tFALSE\t/\n"))
+	require.Error(t, err)
+}
@@ -0,0 +1,121 @@
+// Package expect implements the response assertions (--expect-status and the
+// other --expect-* options) that turn gocurl into a health-check tool.
+package expect
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ameshkov/gocurl/internal/config"
+	"github.com/ameshkov/gocurl/internal/output"
+)
+
+// Failure is a single failed assertion.
+type Failure struct {
+	// Check is the name of the failed check, for instance, "status" or
+	// "header:Content-Type".
+	Check string `json:"check"`
+
+	// Expected is the expected value.
+	Expected string `json:"expected"`
+
+	// Actual is the actual value.
+	Actual string `json:"actual"`
+}
+
+// String implements the fmt.Stringer interface for *Failure.
+func (f *Failure) String() (s string) {
+	return fmt.Sprintf("%s: expected %s, got %s", f.Check, f.Expected, f.Actual)
+}
+
+// Report is the failure report that is written when any of the assertions
+// failed.
+type Report struct {
+	URL      string     `json:"url"`
+	Failures []*Failure `json:"failures"`
+}
+
+// Check checks resp against the assertions configured in cfg.  body is the
+// response body, it is only read when cfg.ExpectBodyRegexp is set.  duration
+// is the time passed since the request was sent until the response body was
+// read.  Returns nil if all the assertions passed.
+func Check(
+	cfg *config.Config,
+	resp *http.Response,
+	body io.Reader,
+	duration time.Duration,
+) (failures []*Failure) {
+	if cfg.ExpectStatus != 0 && resp.StatusCode != cfg.ExpectStatus {
+		failures = append(failures, &Failure{
+			Check:    "status",
+			Expected: strconv.Itoa(cfg.ExpectStatus),
+			Actual:   strconv.Itoa(resp.StatusCode),
+		})
+	}
+
+	for _, h := range cfg.ExpectHeaders {
+		v, ok := resp.Header[http.CanonicalHeaderKey(h.Name)]
+		if ok && h.Regexp.MatchString(v[0]) {
+			continue
+		}
+
+		actual := "no header"
+		if ok {
+			actual = strconv.Quote(v[0])
+		}
+
+		failures = append(failures, &Failure{
+			Check:    "header:" + h.Name,
+			Expected: "match of " + strconv.Quote(h.Regexp.String()),
+			Actual:   actual,
+		})
+	}
+
+	if cfg.ExpectBodyRegexp != nil {
+		if body == nil || !cfg.ExpectBodyRegexp.MatchReader(bufio.NewReader(body)) {
+			failures = append(failures, &Failure{
+				Check:    "body",
+				Expected: "match of " + strconv.Quote(cfg.ExpectBodyRegexp.String()),
+				Actual:   "no match",
+			})
+		}
+	}
+
+	if cfg.ExpectMaxTime != 0 && duration > cfg.ExpectMaxTime {
+		failures = append(failures, &Failure{
+			Check:    "time",
+			Expected: "at most " + cfg.ExpectMaxTime.String(),
+			Actual:   duration.String(),
+		})
+	}
+
+	return failures
+}
+
+// WriteReport writes the report about failures to stderr.  If cfg.OutputJSON
+// is set, the report is a single JSON object, otherwise it is a line per
+// failure.
+func WriteReport(cfg *config.Config, failures []*Failure, out *output.Output) {
+	if cfg.OutputJSON {
+		b, err := json.Marshal(&Report{
+			URL:      cfg.RequestURL.String(),
+			Failures: failures,
+		})
+		if err != nil {
+			panic(err)
+		}
+
+		out.Info("%s", b)
+
+		return
+	}
+
+	for _, f := range failures {
+		out.Info("Expectation failed for %s: %s", cfg.RequestURL, f)
+	}
+}
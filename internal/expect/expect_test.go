@@ -0,0 +1,44 @@
+package expect_test
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ameshkov/gocurl/internal/config"
+	"github.com/ameshkov/gocurl/internal/expect"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheck(t *testing.T) {
+	cfg := &config.Config{
+		ExpectStatus: http.StatusOK,
+		ExpectHeaders: []*config.HeaderExpectation{{
+			Name:   "content-type",
+			Regexp: regexp.MustCompile("^text/"),
+		}},
+		ExpectBodyRegexp: regexp.MustCompile("ok"),
+		ExpectMaxTime:    time.Second,
+	}
+
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"text/plain"}},
+	}
+
+	failures := expect.Check(cfg, resp, strings.NewReader("status: ok"), time.Millisecond)
+	require.Empty(t, failures)
+
+	resp.StatusCode = http.StatusBadGateway
+	resp.Header = http.Header{}
+
+	failures = expect.Check(cfg, resp, strings.NewReader("error"), 2*time.Second)
+	require.Len(t, failures, 4)
+	require.Equal(t, "status", failures[0].Check)
+	require.Equal(t, "502", failures[0].Actual)
+	require.Equal(t, "header:content-type", failures[1].Check)
+	require.Equal(t, "body", failures[2].Check)
+	require.Equal(t, "time", failures[3].Check)
+}
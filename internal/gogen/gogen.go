@@ -0,0 +1,500 @@
+// Package gogen generates the Go code that makes the same request as the
+// gocurl invocation, see --generate-go.  It is similar to curl's --libcurl.
+package gogen
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"go/format"
+	"io"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/ameshkov/gocurl/internal/client"
+	"github.com/ameshkov/gocurl/internal/config"
+	"github.com/ameshkov/gocurl/internal/pkcs11"
+)
+
+// reproduced is the set of options that are reproduced by the generated code
+// or that don't change the request.  The other options are listed in the
+// comment of the generated code.
+var reproduced = map[string]struct{}{
+	"cert":                    {},
+	"ciphers":                 {},
+	"compress-request":        {},
+	"data":                    {},
+	"data-urlencode":          {},
+	"generate-go":             {},
+	"head":                    {},
+	"header":                  {},
+	"hosts-file":              {},
+	"http1.1":                 {},
+	"http2":                   {},
+	"http3":                   {},
+	"insecure":                {},
+	"ipv4":                    {},
+	"ipv6":                    {},
+	"key":                     {},
+	"max-header-size":         {},
+	"proxy":                   {},
+	"request":                 {},
+	"resolve":                 {},
+	"response-header-timeout": {},
+	"tls-handshake-timeout":   {},
+	"tls-max":                 {},
+	"tls-servername":          {},
+	"tlsv1.2":                 {},
+	"tlsv1.3":                 {},
+	"url":                     {},
+	"user":                    {},
+	"verbose":                 {},
+}
+
+// notReproducedHTTP3 is the set of options from reproduced that are not
+// reproduced when HTTP/3 is used since http3.RoundTripper doesn't support
+// them.
+var notReproducedHTTP3 = map[string]struct{}{
+	"hosts-file":              {},
+	"ipv4":                    {},
+	"ipv6":                    {},
+	"proxy":                   {},
+	"resolve":                 {},
+	"response-header-timeout": {},
+	"tls-handshake-timeout":   {},
+}
+
+// program is the data for programTmpl.
+type program struct {
+	// Method is the request method.
+	Method string
+
+	// URL is the request URL without the credentials.
+	URL string
+
+	// Body is the request body, it is nil if there is no body.
+	Body []byte
+
+	// Headers are the request header fields sorted by name.
+	Headers [][2]string
+
+	// Resolve maps host names to the IP addresses to connect to, see
+	// --resolve and --hosts-file.  "*" matches any host.
+	Resolve map[string]string
+
+	// Proxy is the proxy URL.
+	Proxy string
+
+	// ServerName is the TLS server name if it is overridden.
+	ServerName string
+
+	// MinVersion and MaxVersion are the names of crypto/tls constants of the
+	// TLS versions.
+	MinVersion string
+	MaxVersion string
+
+	// Ciphers are the names of crypto/tls constants of the cipher suites.
+	Ciphers []string
+
+	// CertFile and KeyFile are the client certificate and key files.
+	CertFile string
+	KeyFile  string
+
+	// Network is the network of the connections, e.g. "tcp4" for --ipv4.
+	Network string
+
+	// Unsupported are the options that are not reproduced.
+	Unsupported []string
+
+	// TLSHandshakeTimeout, ResponseHeaderTimeout are the timeouts as Go
+	// expressions, e.g. "5 * time.Second".
+	TLSHandshakeTimeout   string
+	ResponseHeaderTimeout string
+
+	// MaxHeaderSize is the maximum size of the response header.
+	MaxHeaderSize int64
+
+	// Insecure disables the certificate verification.
+	Insecure bool
+
+	// HTTP11, HTTP2, and HTTP3 force the protocol.
+	HTTP11 bool
+	HTTP2  bool
+	HTTP3  bool
+}
+
+// Generate returns the source code of a standalone Go program that makes the
+// request configured by cfg using net/http.  The options that can't be
+// reproduced with net/http are listed in a comment of the program.
+func Generate(cfg *config.Config) (src []byte, err error) {
+	if s := cfg.RequestURL.Scheme; s != "http" && s != "https" {
+		return nil, fmt.Errorf("unsupported scheme %q, only http and https are supported", s)
+	}
+
+	req, err := client.NewRequest(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+
+	p := &program{
+		Method:        req.Method,
+		URL:           req.URL.String(),
+		Headers:       headerLines(req.Header),
+		Resolve:       resolveMap(cfg),
+		ServerName:    cfg.TLSServerName,
+		MinVersion:    versionConst(cfg.TLSMinVersion),
+		MaxVersion:    versionConst(cfg.TLSMaxVersion),
+		MaxHeaderSize: cfg.MaxHeaderSize,
+		Insecure:      cfg.Insecure,
+		HTTP11:        cfg.ForceHTTP11,
+		HTTP2:         cfg.ForceHTTP2,
+		HTTP3:         cfg.ForceHTTP3,
+	}
+
+	if req.GetBody != nil {
+		var rc io.ReadCloser
+		rc, err = req.GetBody()
+		if err != nil {
+			return nil, fmt.Errorf("reading request body: %w", err)
+		}
+
+		p.Body, err = io.ReadAll(rc)
+		if err != nil {
+			return nil, fmt.Errorf("reading request body: %w", err)
+		}
+	}
+
+	if cfg.ProxyURL != nil {
+		p.Proxy = cfg.ProxyURL.String()
+	}
+
+	for _, c := range cfg.TLSCiphers {
+		p.Ciphers = append(p.Ciphers, "tls."+tls.CipherSuiteName(c))
+	}
+
+	p.TLSHandshakeTimeout = durationExpr(cfg.TLSHandshakeTimeout)
+	p.ResponseHeaderTimeout = durationExpr(cfg.ResponseHeaderTimeout)
+
+	switch {
+	case cfg.IPv4:
+		p.Network = "tcp4"
+	case cfg.IPv6:
+		p.Network = "tcp6"
+	}
+
+	if opts := cfg.RawOptions; opts != nil {
+		p.Unsupported = unsupportedOptions(opts, cfg.ForceHTTP3)
+
+		certFile, password := config.SplitCertArg(opts.Cert)
+		if pkcs11.IsURI(opts.Cert) {
+			p.Unsupported = append(p.Unsupported, "--cert with pkcs11 uri")
+		} else if password == "" && opts.Pass == "" {
+			p.CertFile, p.KeyFile = certFile, opts.Key
+			if p.CertFile != "" && p.KeyFile == "" {
+				// The key is in the same file.
+				p.KeyFile = p.CertFile
+			}
+		} else {
+			// tls.LoadX509KeyPair can't decrypt the keys.
+			p.Unsupported = append(p.Unsupported, "--cert with password")
+		}
+	}
+
+	if p.HTTP3 {
+		p.Resolve, p.Network, p.Proxy = nil, "", ""
+		p.TLSHandshakeTimeout, p.ResponseHeaderTimeout = "", ""
+	}
+
+	if len(cfg.ResolveHosts) > 0 {
+		p.Unsupported = append(p.Unsupported, "--resolve with host names")
+	}
+
+	buf := &bytes.Buffer{}
+	err = programTmpl.Execute(buf, p)
+	if err != nil {
+		return nil, fmt.Errorf("executing template: %w", err)
+	}
+
+	src, err = format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting generated code: %w", err)
+	}
+
+	return src, nil
+}
+
+// headerLines returns the header fields of h sorted by name.  Values are
+// trimmed the same way net/http does when it sends them.
+func headerLines(h http.Header) (lines [][2]string) {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		for _, v := range h[name] {
+			lines = append(lines, [2]string{name, strings.TrimSpace(v)})
+		}
+	}
+
+	return lines
+}
+
+// resolveMap returns the map of host names to the first of their IP
+// addresses configured by --resolve and --hosts-file.
+func resolveMap(cfg *config.Config) (m map[string]string) {
+	if len(cfg.Resolve) == 0 && len(cfg.Hosts) == 0 {
+		return nil
+	}
+
+	m = map[string]string{}
+	for host, addrs := range cfg.Hosts {
+		m[host] = addrs[0].String()
+	}
+
+	// --resolve has priority over the hosts file.
+	for host, addrs := range cfg.Resolve {
+		if len(addrs) > 0 {
+			m[host] = addrs[0].String()
+		}
+	}
+
+	return m
+}
+
+// versionConst returns the name of the crypto/tls constant of the TLS version
+// ver or an empty string if ver is zero.
+func versionConst(ver uint16) (name string) {
+	switch ver {
+	case 0:
+		return ""
+	case tls.VersionTLS12:
+		return "tls.VersionTLS12"
+	case tls.VersionTLS13:
+		return "tls.VersionTLS13"
+	default:
+		return fmt.Sprintf("0x%04x", ver)
+	}
+}
+
+// durationExpr returns the Go expression for d, e.g. "5 * time.Second", or an
+// empty string if d is zero.
+func durationExpr(d time.Duration) (expr string) {
+	switch {
+	case d == 0:
+		return ""
+	case d%time.Second == 0:
+		return fmt.Sprintf("%d * time.Second", d/time.Second)
+	case d%time.Millisecond == 0:
+		return fmt.Sprintf("%d * time.Millisecond", d/time.Millisecond)
+	default:
+		return fmt.Sprintf("time.Duration(%d)", d)
+	}
+}
+
+// unsupportedOptions returns the names of the options set in opts that are
+// not reproduced by the generated code.  http3 is true if the code uses
+// HTTP/3.
+func unsupportedOptions(opts *config.Options, http3 bool) (names []string) {
+	v := reflect.ValueOf(opts).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Tag.Get("long")
+		if name == "" || v.Field(i).IsZero() {
+			continue
+		}
+
+		_, ok := reproduced[name]
+		if _, notH3 := notReproducedHTTP3[name]; !ok || (http3 && notH3) {
+			names = append(names, "--"+name)
+		}
+	}
+
+	return names
+}
+
+// programTmpl is the template of the generated program.
+var programTmpl = template.Must(template.New("program").Funcs(template.FuncMap{
+	"quote": func(v any) (s string) { return fmt.Sprintf("%q", v) },
+	"join":  strings.Join,
+}).Parse(`// Code generated by gocurl --generate-go.
+//
+// This program makes the same request as the gocurl invocation using net/http.
+{{- if .Unsupported }}
+//
+// The following options are not reproduced: {{ join .Unsupported ", " }}.
+{{- end }}
+package main
+
+import (
+{{- if or .Resolve .Network }}
+	"context"
+{{- end }}
+	"crypto/tls"
+	"io"
+	"log"
+{{- if or .Resolve .Network }}
+	"net"
+{{- end }}
+	"net/http"
+{{- if .Proxy }}
+	"net/url"
+{{- end }}
+	"os"
+{{- if .Body }}
+	"strings"
+{{- end }}
+{{- if or .TLSHandshakeTimeout .ResponseHeaderTimeout }}
+	"time"
+{{- end }}
+{{- if .HTTP3 }}
+
+	"github.com/quic-go/quic-go/http3"
+{{- end }}
+)
+
+func main() {
+	tlsConfig := &tls.Config{
+{{- if .ServerName }}
+		ServerName: {{ quote .ServerName }},
+{{- end }}
+{{- if .MinVersion }}
+		MinVersion: {{ .MinVersion }},
+{{- end }}
+{{- if .MaxVersion }}
+		MaxVersion: {{ .MaxVersion }},
+{{- end }}
+{{- if .Ciphers }}
+		CipherSuites: []uint16{ {{- join .Ciphers ", " -}} },
+{{- end }}
+{{- if .Insecure }}
+		InsecureSkipVerify: true,
+{{- end }}
+	}
+{{- if .CertFile }}
+
+	cert, err := tls.LoadX509KeyPair({{ quote .CertFile }}, {{ quote .KeyFile }})
+	if err != nil {
+		log.Fatal(err)
+	}
+	tlsConfig.Certificates = []tls.Certificate{cert}
+{{- end }}
+{{- if .HTTP3 }}
+
+	transport := &http3.RoundTripper{
+		TLSClientConfig:        tlsConfig,
+		DisableCompression:     true,
+{{- if .MaxHeaderSize }}
+		MaxResponseHeaderBytes: {{ .MaxHeaderSize }},
+{{- end }}
+	}
+	defer func() { _ = transport.Close() }()
+{{- else }}
+
+	transport := &http.Transport{
+		TLSClientConfig:    tlsConfig,
+		DisableCompression: true,
+{{- if not .HTTP11 }}
+		ForceAttemptHTTP2:  true,
+{{- end }}
+{{- if .MaxHeaderSize }}
+		MaxResponseHeaderBytes: {{ .MaxHeaderSize }},
+{{- end }}
+{{- if .TLSHandshakeTimeout }}
+		TLSHandshakeTimeout: {{ .TLSHandshakeTimeout }},
+{{- end }}
+{{- if .ResponseHeaderTimeout }}
+		ResponseHeaderTimeout: {{ .ResponseHeaderTimeout }},
+{{- end }}
+	}
+{{- if .HTTP11 }}
+	tlsConfig.NextProtos = []string{"http/1.1"}
+	transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+{{- else if .HTTP2 }}
+	tlsConfig.NextProtos = []string{"h2"}
+{{- end }}
+{{- if .Proxy }}
+
+	proxyURL, err := url.Parse({{ quote .Proxy }})
+	if err != nil {
+		log.Fatal(err)
+	}
+	transport.Proxy = http.ProxyURL(proxyURL)
+{{- end }}
+{{- if or .Resolve .Network }}
+
+{{- if .Resolve }}
+
+	// Custom addresses of the hosts, "*" matches any host.
+	resolve := map[string]string{
+{{- range $host, $ip := .Resolve }}
+		{{ quote $host }}: {{ quote $ip }},
+{{- end }}
+	}
+{{- end }}
+
+	dialer := &net.Dialer{}
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+{{- if .Network }}
+		network = {{ quote .Network }}
+{{- end }}
+{{- if .Resolve }}
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		ip, ok := resolve[host]
+		if !ok {
+			ip, ok = resolve["*"]
+		}
+
+		if ok {
+			addr = net.JoinHostPort(ip, port)
+		}
+{{- end }}
+
+		return dialer.DialContext(ctx, network, addr)
+	}
+{{- end }}
+{{- end }}
+
+	httpClient := &http.Client{
+		Transport: transport,
+		// Like gocurl, don't follow redirects.
+		CheckRedirect: func(_ *http.Request, _ []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+{{ if .Body }}
+	body := strings.NewReader({{ quote (printf "%s" .Body) }})
+	req, err := http.NewRequest({{ quote .Method }}, {{ quote .URL }}, body)
+{{- else }}
+	req, err := http.NewRequest({{ quote .Method }}, {{ quote .URL }}, nil)
+{{- end }}
+	if err != nil {
+		log.Fatal(err)
+	}
+{{- range .Headers }}
+	req.Header.Add({{ quote (index . 0) }}, {{ quote (index . 1) }})
+{{- end }}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	log.Printf("%s %s", resp.Proto, resp.Status)
+
+	_, err = io.Copy(os.Stdout, resp.Body)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+`))
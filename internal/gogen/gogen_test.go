@@ -0,0 +1,46 @@
+package gogen_test
+
+import (
+	"go/parser"
+	"go/token"
+	"testing"
+
+	"github.com/ameshkov/gocurl/internal/config"
+	"github.com/ameshkov/gocurl/internal/gogen"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerate(t *testing.T) {
+	cfg, err := config.ParseConfig([]string{
+		"-k",
+		"-X", "PUT",
+		"-d", "a=b",
+		"-H", "X-Test: 1",
+		"--resolve", "example.org:443:127.0.0.1",
+		"--response-header-timeout", "1500ms",
+		"--tls-split-hello", "5:50",
+		"https://example.org/path",
+	})
+	require.NoError(t, err)
+
+	src, err := gogen.Generate(cfg)
+	require.NoError(t, err)
+
+	_, err = parser.ParseFile(token.NewFileSet(), "main.go", src, parser.AllErrors)
+	require.NoError(t, err)
+
+	code := string(src)
+	require.Contains(t, code, `http.NewRequest("PUT", "https://example.org/path", body)`)
+	require.Contains(t, code, `strings.NewReader("a=b")`)
+	require.Contains(t, code, `req.Header.Add("X-Test", "1")`)
+	require.Contains(t, code, `"example.org": "127.0.0.1",`)
+	require.Contains(t, code, `ResponseHeaderTimeout: 1500 * time.Millisecond,`)
+	require.Contains(t, code, `InsecureSkipVerify: true,`)
+	require.Contains(t, code, `The following options are not reproduced: --tls-split-hello.`)
+
+	cfg, err = config.ParseConfig([]string{"mqtt://example.org/topic"})
+	require.NoError(t, err)
+
+	_, err = gogen.Generate(cfg)
+	require.Error(t, err)
+}
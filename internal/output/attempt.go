@@ -0,0 +1,57 @@
+package output
+
+import (
+	"context"
+	"time"
+)
+
+// Attempt is the information about a single attempt to make the request.  It
+// is written to the JSON output when retries are enabled, see --retry-budget.
+type Attempt struct {
+	// Target is the address of the server the request was sent to.  It is
+	// empty if the connection was not established.
+	Target string `json:"target,omitempty"`
+
+	// Proto is the protocol of the response.  It is empty if the attempt
+	// failed.
+	Proto string `json:"proto,omitempty"`
+
+	// Error is the error that happened during the attempt, if any.
+	Error string `json:"error,omitempty"`
+
+	// Start is the time when the request was sent.
+	Start time.Time `json:"start"`
+
+	// Duration is the time passed until the response headers were received
+	// or the attempt failed.
+	Duration time.Duration `json:"duration_ns"`
+
+	// ConnectDuration is the time passed until the connection was
+	// established or taken from the pool.  It is zero if the connection was
+	// not established.
+	ConnectDuration time.Duration `json:"connect_ns,omitempty"`
+
+	// FirstByteDuration is the time passed until the first byte of the
+	// response was received.  It is zero if the response was not received.
+	FirstByteDuration time.Duration `json:"first_byte_ns,omitempty"`
+
+	// Timings are the durations of the transfer phases.  It is nil if the
+	// request was not sent.
+	Timings *Timings `json:"timings,omitempty"`
+}
+
+// attemptsKey is the context key for the list of attempts.
+type attemptsKey struct{}
+
+// WithAttempts returns a copy of ctx with attempts attached to it.  The
+// attempts are written to the JSON output along with the response.
+func WithAttempts(ctx context.Context, attempts []*Attempt) (res context.Context) {
+	return context.WithValue(ctx, attemptsKey{}, attempts)
+}
+
+// attemptsFromContext returns the attempts attached to ctx or nil.
+func attemptsFromContext(ctx context.Context) (attempts []*Attempt) {
+	attempts, _ = ctx.Value(attemptsKey{}).([]*Attempt)
+
+	return attempts
+}
@@ -0,0 +1,61 @@
+package output_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ameshkov/gocurl/internal/config"
+	"github.com/ameshkov/gocurl/internal/output"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutput_Write_attempts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.json")
+
+	out, err := output.NewOutput(path, false)
+	require.NoError(t, err)
+
+	u := &url.URL{Scheme: "https", Host: "example.org"}
+	cfg := &config.Config{OutputJSON: true, RequestURLs: []*url.URL{u, u}}
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	attempts := []*output.Attempt{{
+		Error:    "connection refused",
+		Start:    start,
+		Duration: time.Millisecond,
+	}, {
+		Target:   "192.0.2.1:443",
+		Proto:    "HTTP/2.0",
+		Start:    start.Add(time.Second),
+		Duration: time.Millisecond,
+	}}
+
+	req, err := http.NewRequestWithContext(
+		output.WithAttempts(context.Background(), attempts),
+		http.MethodGet,
+		u.String(),
+		nil,
+	)
+	require.NoError(t, err)
+
+	out.Write(&http.Response{StatusCode: http.StatusOK, Request: req}, nil, cfg)
+	out.WriteError(u, errors.New("timeout"), attempts[:1], cfg)
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = f.Close() })
+
+	dec := json.NewDecoder(f)
+	for _, want := range [][]*output.Attempt{attempts, attempts[:1]} {
+		var data output.ResponseData
+		require.NoError(t, dec.Decode(&data))
+		require.Equal(t, want, data.Attempts)
+	}
+}
@@ -0,0 +1,124 @@
+package output
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"slices"
+)
+
+// ConnInfo is the information about the connection that was used for the
+// request which is not available in *http.Response.
+type ConnInfo struct {
+	// MPTCP is true if Multipath TCP was used by the connection.  It is nil
+	// if MPTCP was not requested.
+	MPTCP *bool
+
+	// Proxy is the redacted URL of the proxy the connection was established
+	// through or "direct" if all the proxies failed.  It is empty if no proxy
+	// was configured.
+	Proxy string
+
+	// ProxyUsed is true if the connection was established through a proxy.
+	ProxyUsed bool
+
+	// RemoteAddr is the remote address of the connection.  It is the address
+	// of the proxy if the connection was established through one.
+	RemoteAddr net.Addr
+
+	// LocalAddr is the local address of the connection.
+	LocalAddr net.Addr
+
+	// Header is the response header fields in the wire order.  It is nil if
+	// the order is not known, i.e. for HTTP/2 and HTTP/3 responses, then the
+	// fields are sorted by name.
+	Header []*HeaderField
+}
+
+// connInfoKey is the context key for *ConnInfo.
+type connInfoKey struct{}
+
+// WithConnInfo returns a copy of ctx with info attached to it.  The transport
+// attaches it to the request of the response so that it could be written to
+// the output.
+func WithConnInfo(ctx context.Context, info *ConnInfo) (res context.Context) {
+	return context.WithValue(ctx, connInfoKey{}, info)
+}
+
+// connInfoFromContext returns *ConnInfo attached to ctx or nil.
+func connInfoFromContext(ctx context.Context) (info *ConnInfo) {
+	info, _ = ctx.Value(connInfoKey{}).(*ConnInfo)
+
+	return info
+}
+
+// HeaderField is a single response header field.
+type HeaderField struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Header orders of the response header fields in the output.
+const (
+	// HeaderOrderWire means that the header fields are in the order they
+	// were received.  It is only known for HTTP/1.x responses.
+	HeaderOrderWire = "wire"
+
+	// HeaderOrderAlphabetical means that the header fields are sorted by
+	// name as the wire order is not known, e.g. for HTTP/2 and HTTP/3
+	// responses which are decoded by net/http and quic-go into a map.
+	HeaderOrderAlphabetical = "alphabetical"
+)
+
+// headerFields returns the header fields of resp in the wire order if it was
+// recorded in info.  Otherwise, the fields are sorted by name, which is always
+// the case for HTTP/2 and HTTP/3.  order is either HeaderOrderWire or
+// HeaderOrderAlphabetical.
+func headerFields(resp *http.Response, info *ConnInfo) (fields []*HeaderField, order string) {
+	if info != nil && info.Header != nil {
+		return info.Header, HeaderOrderWire
+	}
+
+	names := make([]string, 0, len(resp.Header))
+	for name := range resp.Header {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	fields = []*HeaderField{}
+	for _, name := range names {
+		for _, v := range resp.Header[name] {
+			fields = append(fields, &HeaderField{Name: name, Value: v})
+		}
+	}
+
+	return fields, HeaderOrderAlphabetical
+}
+
+// ipFamily returns "ipv4" or "ipv6" depending on the IP address of addr or an
+// empty string if addr is not an IP address, e.g. a Unix socket.
+func ipFamily(addr net.Addr) (family string) {
+	var ip net.IP
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		ip = a.IP
+	case *net.UDPAddr:
+		ip = a.IP
+	default:
+		host, _, err := net.SplitHostPort(addr.String())
+		if err != nil {
+			return ""
+		}
+
+		ip = net.ParseIP(host)
+	}
+
+	switch {
+	case ip == nil:
+		return ""
+	case ip.To4() != nil:
+		return "ipv4"
+	default:
+		return "ipv6"
+	}
+}
@@ -0,0 +1,71 @@
+package output
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// OpenDumpHeaderFile creates the file at path where the response headers are
+// written, see DumpHeader.  "-" means stdout.
+func (o *Output) OpenDumpHeaderFile(path string) (err error) {
+	if path == "-" {
+		o.headerFile = os.Stdout
+
+		return nil
+	}
+
+	o.headerFile, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("opening dump-header file: %w", err)
+	}
+
+	return nil
+}
+
+// DumpHeader writes the status line and the header of resp to the file opened
+// with OpenDumpHeaderFile.  The redirect responses that were followed before
+// resp are written first.  It does nothing if the file was not opened.
+func (o *Output) DumpHeader(resp *http.Response) {
+	if o.headerFile == nil {
+		return
+	}
+
+	sb := &strings.Builder{}
+	if resp.Request != nil {
+		for _, r := range redirectsFromContext(resp.Request.Context()) {
+			if r.Response != nil {
+				writeHeaderBlock(sb, r.Response)
+			}
+		}
+	}
+
+	writeHeaderBlock(sb, resp)
+
+	o.writeMu.Lock()
+	defer o.writeMu.Unlock()
+
+	_, err := o.headerFile.WriteString(sb.String())
+	if err != nil {
+		o.Info("Failed to dump the response header: %v", err)
+	}
+}
+
+// writeHeaderBlock writes the status line and the header fields of resp in the
+// wire order if known followed by an empty line like they were received.  The
+// fields of HTTP/2 and HTTP/3 responses are sorted by name.
+func writeHeaderBlock(sb *strings.Builder, resp *http.Response) {
+	var info *ConnInfo
+	if resp.Request != nil {
+		info = connInfoFromContext(resp.Request.Context())
+	}
+
+	_, _ = fmt.Fprintf(sb, "%s %s\r\n", resp.Proto, resp.Status)
+	fields, _ := headerFields(resp, info)
+	for _, f := range fields {
+		_, _ = fmt.Fprintf(sb, "%s: %s\r\n", f.Name, f.Value)
+	}
+
+	sb.WriteString("\r\n")
+}
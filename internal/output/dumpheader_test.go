@@ -0,0 +1,57 @@
+package output_test
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ameshkov/gocurl/internal/output"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutput_DumpHeader(t *testing.T) {
+	redirect := &http.Response{
+		Proto:  "HTTP/1.1",
+		Status: "302 Found",
+		Header: http.Header{"Location": {"/final"}},
+	}
+
+	ctx := output.WithRedirects(context.Background(), []*output.Redirect{{
+		URL:        "http://example.org/",
+		Location:   "http://example.org/final",
+		StatusCode: http.StatusFound,
+		Response:   redirect,
+	}})
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://example.org/final", nil)
+	require.NoError(t, err)
+
+	resp := &http.Response{
+		Proto:  "HTTP/1.1",
+		Status: "200 OK",
+		Header: http.Header{
+			"Content-Type": {"text/plain"},
+			"Set-Cookie":   {"a=1", "b=2"},
+		},
+		Request: req,
+	}
+
+	path := filepath.Join(t.TempDir(), "headers")
+	out, err := output.NewOutput("", false)
+	require.NoError(t, err)
+	require.NoError(t, out.OpenDumpHeaderFile(path))
+
+	out.DumpHeader(resp)
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "HTTP/1.1 302 Found\r\n"+
+		"Location: /final\r\n"+
+		"\r\n"+
+		"HTTP/1.1 200 OK\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"Set-Cookie: a=1\r\n"+
+		"Set-Cookie: b=2\r\n"+
+		"\r\n", string(b))
+}
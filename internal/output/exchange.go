@@ -0,0 +1,183 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Exchange saves a single request and its response into a directory, see
+// --save-exchange.  The directory contains:
+//
+//   - request.txt: the request including its body.
+//   - response-headers.txt: the status line and the response headers.
+//   - body: the response body as it was received.
+//   - cert-N.pem: the certificates sent by the server.
+//   - meta.json: the summary of the transfer, see ExchangeMeta.
+type Exchange struct {
+	// body is the file where the response body is written, it is nil until
+	// the response is received.
+	body *os.File
+
+	// meta is written to meta.json when the exchange is closed.
+	meta *ExchangeMeta
+
+	// dir is the directory of the exchange.
+	dir string
+}
+
+// ExchangeMeta is the summary of the transfer saved to meta.json.
+type ExchangeMeta struct {
+	// Time is the time when the request was sent.
+	Time time.Time `json:"time"`
+
+	// URL is the request URL.
+	URL string `json:"url"`
+
+	// Method is the request method.
+	Method string `json:"method"`
+
+	// RemoteAddr is the address of the server, if the connection was
+	// established.
+	RemoteAddr string `json:"remote_addr,omitempty"`
+
+	// StatusCode is the response status code, zero if the request failed.
+	StatusCode int `json:"status_code,omitempty"`
+
+	// Proto is the protocol of the response.
+	Proto string `json:"proto,omitempty"`
+
+	// TLS is the information about the TLS connection.
+	TLS *TLSState `json:"tls,omitempty"`
+
+	// Error is the error that happened during the transfer, if any.
+	Error string `json:"error,omitempty"`
+
+	// Duration is the duration of the whole transfer.
+	Duration time.Duration `json:"duration_ns"`
+
+	// BodySize is the size of the saved response body.
+	BodySize int64 `json:"body_size"`
+}
+
+// NewExchange creates a new timestamped directory for the exchange in baseDir
+// and writes the head of req and body to it.  body is the request body that
+// was sent, req's own body is not read.  attempt is the information about the
+// request attempt.
+func NewExchange(
+	baseDir string,
+	req *http.Request,
+	body []byte,
+	attempt *Attempt,
+) (e *Exchange, err error) {
+	err = os.MkdirAll(baseDir, 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("creating exchange directory: %w", err)
+	}
+
+	host := strings.NewReplacer(":", "_", "[", "", "]", "").Replace(req.URL.Host)
+	pattern := attempt.Start.Format("20060102T150405") + "-" + host + "-*"
+
+	dir, err := os.MkdirTemp(baseDir, pattern)
+	if err != nil {
+		return nil, fmt.Errorf("creating exchange directory: %w", err)
+	}
+
+	e = &Exchange{
+		dir: dir,
+		meta: &ExchangeMeta{
+			Time:       attempt.Start,
+			URL:        req.URL.String(),
+			Method:     req.Method,
+			RemoteAddr: attempt.Target,
+		},
+	}
+
+	err = e.writeFile("request.txt", append([]byte(requestToString(req)), body...))
+	if err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// Dir returns the directory of the exchange.
+func (e *Exchange) Dir() (dir string) {
+	return e.dir
+}
+
+// SaveResponse writes the response headers and the server certificates and
+// returns the reader that saves the response body while it is read.  body
+// may be nil if the response has no body.
+func (e *Exchange) SaveResponse(resp *http.Response, body io.Reader) (r io.Reader, err error) {
+	e.meta.StatusCode, e.meta.Proto = resp.StatusCode, resp.Proto
+
+	err = e.writeFile("response-headers.txt", []byte(responseToString(resp)))
+	if err != nil {
+		return body, err
+	}
+
+	if resp.TLS != nil {
+		e.meta.TLS = stateToTLSState(resp.TLS)
+		for i, cert := range resp.TLS.PeerCertificates {
+			err = e.writeFile(fmt.Sprintf("cert-%d.pem", i+1), []byte(certToPEM(cert.Raw)))
+			if err != nil {
+				return body, err
+			}
+		}
+	}
+
+	if body == nil {
+		return nil, nil
+	}
+
+	e.body, err = os.Create(filepath.Join(e.dir, "body"))
+	if err != nil {
+		return body, fmt.Errorf("saving exchange: %w", err)
+	}
+
+	return io.TeeReader(body, e.body), nil
+}
+
+// Close writes meta.json and closes the body file.  transferErr is the error
+// of the transfer, if any.
+func (e *Exchange) Close(transferErr error) (err error) {
+	e.meta.Duration = time.Since(e.meta.Time)
+	if transferErr != nil {
+		e.meta.Error = transferErr.Error()
+	}
+
+	if e.body != nil {
+		if fi, statErr := e.body.Stat(); statErr == nil {
+			e.meta.BodySize = fi.Size()
+		}
+
+		err = e.body.Close()
+		if err != nil {
+			return fmt.Errorf("saving exchange: %w", err)
+		}
+	}
+
+	b, err := json.MarshalIndent(e.meta, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+
+	return e.writeFile("meta.json", append(b, '\n'))
+}
+
+// writeFile writes data to the file with the specified name in the exchange
+// directory.
+func (e *Exchange) writeFile(name string, data []byte) (err error) {
+	err = os.WriteFile(filepath.Join(e.dir, name), data, 0o644)
+	if err != nil {
+		return fmt.Errorf("saving exchange: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,112 @@
+package output_test
+
+import (
+	"crypto"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ameshkov/gocurl/internal/output"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestExchange(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("X-Test", "1")
+		_, _ = w.Write([]byte("response body"))
+	}))
+	t.Cleanup(srv.Close)
+
+	cert := srv.Certificate()
+	signer := srv.TLS.Certificates[0].PrivateKey.(crypto.Signer)
+	staple, err := ocsp.CreateResponse(cert, cert, ocsp.Response{
+		Status:       ocsp.Good,
+		SerialNumber: cert.SerialNumber,
+	}, signer)
+	require.NoError(t, err)
+
+	srv.TLS.Certificates[0].OCSPStaple = staple
+
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/path", strings.NewReader("request body"))
+	require.NoError(t, err)
+
+	resp, err := srv.Client().Get(srv.URL + "/path")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = resp.Body.Close() })
+
+	baseDir := t.TempDir()
+	attempt := &output.Attempt{Start: time.Now(), Target: srv.Listener.Addr().String()}
+
+	e, err := output.NewExchange(baseDir, req, []byte("request body"), attempt)
+	require.NoError(t, err)
+	require.Equal(t, baseDir, filepath.Dir(e.Dir()))
+
+	body, err := e.SaveResponse(resp, resp.Body)
+	require.NoError(t, err)
+
+	b, err := io.ReadAll(body)
+	require.NoError(t, err)
+	require.Equal(t, "response body", string(b))
+	require.NoError(t, e.Close(nil))
+
+	readFile := func(name string) (data string) {
+		b, err = os.ReadFile(filepath.Join(e.Dir(), name))
+		require.NoError(t, err)
+
+		return string(b)
+	}
+
+	require.Contains(t, readFile("request.txt"), "POST /path HTTP/1.1")
+	require.Contains(t, readFile("request.txt"), "request body")
+	require.Contains(t, readFile("response-headers.txt"), "X-Test: 1")
+	require.Equal(t, "response body", readFile("body"))
+	require.Contains(t, readFile("cert-1.pem"), "BEGIN CERTIFICATE")
+
+	meta := &output.ExchangeMeta{}
+	require.NoError(t, json.Unmarshal([]byte(readFile("meta.json")), meta))
+	require.Equal(t, http.MethodPost, meta.Method)
+	require.Equal(t, http.StatusOK, meta.StatusCode)
+	require.Equal(t, attempt.Target, meta.RemoteAddr)
+	require.Equal(t, int64(len("response body")), meta.BodySize)
+	require.NotNil(t, meta.TLS)
+	require.Equal(t, "good", meta.TLS.OCSPStatus)
+	require.Equal(t, []string{cert.Subject.String()}, meta.TLS.VerifiedChain)
+}
+
+// unreadableBody is a request body that fails the test if it's read.
+type unreadableBody struct {
+	t *testing.T
+}
+
+// Read implements the io.Reader interface for unreadableBody.
+func (b unreadableBody) Read(_ []byte) (n int, err error) {
+	b.t.Error("request body must not be read")
+
+	return 0, io.EOF
+}
+
+func TestExchange_streamedBody(t *testing.T) {
+	req, err := http.NewRequest(http.MethodPut, "http://example.org/upload", unreadableBody{t: t})
+	require.NoError(t, err)
+
+	req.ContentLength = -1
+
+	attempt := &output.Attempt{Start: time.Now()}
+	e, err := output.NewExchange(t.TempDir(), req, []byte("sent"), attempt)
+	require.NoError(t, err)
+	require.NoError(t, e.Close(nil))
+
+	b, err := os.ReadFile(filepath.Join(e.Dir(), "request.txt"))
+	require.NoError(t, err)
+
+	require.True(t, strings.HasPrefix(string(b), "PUT /upload HTTP/1.1\r\n"))
+	require.Contains(t, string(b), "Transfer-Encoding: chunked\r\n")
+	require.True(t, strings.HasSuffix(string(b), "\r\n\r\nsent"))
+}
@@ -0,0 +1,74 @@
+package output
+
+import (
+	"errors"
+
+	"golang.org/x/net/http2"
+)
+
+// HTTP2Error is the information about the HTTP/2 GOAWAY or RST_STREAM frame
+// that made the request fail.
+type HTTP2Error struct {
+	// Frame is the type of the frame, either "GOAWAY" or "RST_STREAM".
+	Frame string `json:"frame"`
+
+	// Code is the HTTP/2 error code, for instance, "ENHANCE_YOUR_CALM".
+	Code string `json:"code"`
+
+	// StreamID is the ID of the reset stream.  Only set for RST_STREAM.
+	StreamID uint32 `json:"stream_id,omitempty"`
+
+	// LastStreamID is the last stream processed by the server.  Only set for
+	// GOAWAY.
+	LastStreamID uint32 `json:"last_stream_id,omitempty"`
+
+	// DebugData is the opaque debug data sent by the server.  Only set for
+	// GOAWAY.
+	DebugData string `json:"debug_data,omitempty"`
+}
+
+// newHTTP2Error returns *HTTP2Error if err was caused by a GOAWAY or a
+// RST_STREAM frame sent by the server.  Otherwise, returns nil.
+func newHTTP2Error(err error) (h2Err *HTTP2Error) {
+	var goAwayErr http2.GoAwayError
+	if errors.As(err, &goAwayErr) {
+		return &HTTP2Error{
+			Frame:        "GOAWAY",
+			Code:         goAwayErr.ErrCode.String(),
+			LastStreamID: goAwayErr.LastStreamID,
+			DebugData:    goAwayErr.DebugData,
+		}
+	}
+
+	var streamErr http2.StreamError
+	if errors.As(err, &streamErr) {
+		return &HTTP2Error{
+			Frame:    "RST_STREAM",
+			Code:     streamErr.Code.String(),
+			StreamID: streamErr.StreamID,
+		}
+	}
+
+	return nil
+}
+
+// DebugHTTP2Error writes the details about the HTTP/2 GOAWAY or RST_STREAM
+// frame that caused err, if any.
+func (o *Output) DebugHTTP2Error(err error) {
+	h2Err := newHTTP2Error(err)
+	if h2Err == nil {
+		return
+	}
+
+	switch h2Err.Frame {
+	case "GOAWAY":
+		o.Debug(
+			"Server sent HTTP/2 GOAWAY: code=%s last_stream_id=%d debug_data=%q",
+			h2Err.Code,
+			h2Err.LastStreamID,
+			h2Err.DebugData,
+		)
+	default:
+		o.Debug("Server sent HTTP/2 RST_STREAM: code=%s stream_id=%d", h2Err.Code, h2Err.StreamID)
+	}
+}
@@ -0,0 +1,43 @@
+package output_test
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ameshkov/gocurl/internal/config"
+	"github.com/ameshkov/gocurl/internal/output"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+)
+
+func TestOutput_WriteError_http2(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.json")
+
+	out, err := output.NewOutput(path, false)
+	require.NoError(t, err)
+
+	u := &url.URL{Scheme: "https", Host: "example.org"}
+	cfg := &config.Config{OutputJSON: true, RequestURLs: []*url.URL{u, u}}
+
+	reqErr := http2.GoAwayError{
+		LastStreamID: 3,
+		ErrCode:      http2.ErrCodeEnhanceYourCalm,
+		DebugData:    "too many requests",
+	}
+	out.WriteError(u, reqErr, nil, cfg)
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	var data output.ResponseData
+	require.NoError(t, json.Unmarshal(b, &data))
+	require.Equal(t, &output.HTTP2Error{
+		Frame:        "GOAWAY",
+		Code:         "ENHANCE_YOUR_CALM",
+		LastStreamID: 3,
+		DebugData:    "too many requests",
+	}, data.HTTP2Error)
+}
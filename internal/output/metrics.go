@@ -0,0 +1,151 @@
+package output
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Metrics is the record about a single transfer that is appended to the
+// metrics file, see --metrics-file.
+type Metrics struct {
+	// Time is the time when the request was sent.
+	Time time.Time `json:"time"`
+
+	// URL is the request URL.
+	URL string `json:"url"`
+
+	// StatusCode is the response status code.  It is zero if the request
+	// failed.
+	StatusCode int `json:"status_code,omitempty"`
+
+	// Proto is the protocol of the response.
+	Proto string `json:"proto,omitempty"`
+
+	// RemoteIP is the IP address of the server.  It is empty if the
+	// connection was not established.
+	RemoteIP string `json:"remote_ip,omitempty"`
+
+	// Error is the error that happened during the transfer, if any.
+	Error string `json:"error,omitempty"`
+
+	// ConnectDuration is the time passed until the connection was
+	// established or taken from the pool.
+	ConnectDuration time.Duration `json:"connect_ns"`
+
+	// FirstByteDuration is the time passed until the first byte of the
+	// response was received.
+	FirstByteDuration time.Duration `json:"first_byte_ns"`
+
+	// TotalDuration is the time passed until the response body was written.
+	TotalDuration time.Duration `json:"total_ns"`
+
+	// UploadSize is the size of the request body.
+	UploadSize int64 `json:"size_upload"`
+
+	// DownloadSize is the size of the response body.
+	DownloadSize int64 `json:"size_download"`
+
+	// Timings are the durations of the transfer phases.  They are only
+	// written in the JSON format.  It is nil if the request was not sent.
+	Timings *Timings `json:"timings,omitempty"`
+}
+
+// metricsCSVHeader is the header of the metrics file in the CSV format.  The
+// columns have the same names as the JSON fields of Metrics.
+var metricsCSVHeader = []string{
+	"time",
+	"url",
+	"status_code",
+	"proto",
+	"remote_ip",
+	"error",
+	"connect_ns",
+	"first_byte_ns",
+	"total_ns",
+	"size_upload",
+	"size_download",
+}
+
+// csvRecord returns m as a CSV record, see metricsCSVHeader.
+func (m *Metrics) csvRecord() (record []string) {
+	return []string{
+		m.Time.Format(time.RFC3339Nano),
+		m.URL,
+		strconv.Itoa(m.StatusCode),
+		m.Proto,
+		m.RemoteIP,
+		m.Error,
+		strconv.FormatInt(int64(m.ConnectDuration), 10),
+		strconv.FormatInt(int64(m.FirstByteDuration), 10),
+		strconv.FormatInt(int64(m.TotalDuration), 10),
+		strconv.FormatInt(m.UploadSize, 10),
+		strconv.FormatInt(m.DownloadSize, 10),
+	}
+}
+
+// OpenMetricsFile opens the file at path for appending metrics records, see
+// WriteMetrics.  If the file has the .csv extension, the records are written
+// in the CSV format, otherwise as JSON, one object per line.
+func (o *Output) OpenMetricsFile(path string) (err error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("opening metrics file: %w", err)
+	}
+
+	o.metricsFile = f
+	o.metricsCSV = strings.EqualFold(filepath.Ext(path), ".csv")
+
+	fi, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("opening metrics file: %w", err)
+	}
+
+	if o.metricsCSV && fi.Size() == 0 {
+		return o.writeMetricsCSV(metricsCSVHeader)
+	}
+
+	return nil
+}
+
+// WriteMetrics appends m to the metrics file.  It does nothing if the file
+// was not opened with OpenMetricsFile.
+func (o *Output) WriteMetrics(m *Metrics) {
+	if o.metricsFile == nil {
+		return
+	}
+
+	var err error
+	if o.metricsCSV {
+		err = o.writeMetricsCSV(m.csvRecord())
+	} else {
+		var b []byte
+		b, err = json.Marshal(m)
+		if err == nil {
+			o.metricsMu.Lock()
+			_, err = o.metricsFile.Write(append(b, '\n'))
+			o.metricsMu.Unlock()
+		}
+	}
+
+	if err != nil {
+		o.Info("Failed to write metrics: %v", err)
+	}
+}
+
+// writeMetricsCSV writes a single CSV record to the metrics file.
+func (o *Output) writeMetricsCSV(record []string) (err error) {
+	o.metricsMu.Lock()
+	defer o.metricsMu.Unlock()
+
+	w := csv.NewWriter(o.metricsFile)
+	_ = w.Write(record)
+	w.Flush()
+
+	return w.Error()
+}
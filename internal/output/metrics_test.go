@@ -0,0 +1,67 @@
+package output_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ameshkov/gocurl/internal/output"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutput_WriteMetrics(t *testing.T) {
+	m := &output.Metrics{
+		Time:          time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		URL:           "https://example.org/",
+		StatusCode:    200,
+		Proto:         "HTTP/2.0",
+		RemoteIP:      "192.0.2.1",
+		TotalDuration: time.Second,
+		DownloadSize:  10,
+	}
+
+	dir := t.TempDir()
+
+	t.Run("csv", func(t *testing.T) {
+		path := filepath.Join(dir, "metrics.csv")
+
+		// The header is only written to a new file.
+		for i := 0; i < 2; i++ {
+			out, err := output.NewOutput("", false)
+			require.NoError(t, err)
+			require.NoError(t, out.OpenMetricsFile(path))
+
+			out.WriteMetrics(m)
+		}
+
+		b, err := os.ReadFile(path)
+		require.NoError(t, err)
+
+		record := "2024-01-01T00:00:00Z,https://example.org/,200,HTTP/2.0,192.0.2.1,,0,0,1000000000,0,10\n"
+		require.Equal(t, "time,url,status_code,proto,remote_ip,error,connect_ns,"+
+			"first_byte_ns,total_ns,size_upload,size_download\n"+record+record, string(b))
+	})
+
+	t.Run("json", func(t *testing.T) {
+		path := filepath.Join(dir, "metrics.jsonl")
+
+		out, err := output.NewOutput("", false)
+		require.NoError(t, err)
+		require.NoError(t, out.OpenMetricsFile(path))
+
+		out.WriteMetrics(m)
+
+		b, err := os.ReadFile(path)
+		require.NoError(t, err)
+
+		lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+		require.Len(t, lines, 1)
+
+		got := &output.Metrics{}
+		require.NoError(t, json.Unmarshal([]byte(lines[0]), got))
+		require.Equal(t, m, got)
+	})
+}
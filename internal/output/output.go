@@ -8,22 +8,46 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ameshkov/gocurl/internal/config"
+	"github.com/ameshkov/gocurl/internal/spill"
+	"golang.org/x/crypto/ocsp"
 )
 
 // Output is responsible for all the output, be it logging or writing received
 // data.
 type Output struct {
+	// writeMu makes sure that the received data of parallel transfers is not
+	// mixed up in the output.
+	writeMu *sync.Mutex
+
 	receivedDataFile *os.File
 	logFile          *os.File
 	verbose          bool
+
+	// metricsMu protects metricsFile from concurrent writes.
+	metricsMu *sync.Mutex
+
+	// metricsFile is the file where the transfer metrics are appended, see
+	// OpenMetricsFile.  It is nil if the metrics are not written.
+	metricsFile *os.File
+
+	// metricsCSV is true if the metrics are written in the CSV format.
+	metricsCSV bool
+
+	// headerFile is the file where the response headers are written, see
+	// OpenDumpHeaderFile.  It is nil if the headers are not written.
+	headerFile *os.File
 }
 
 // NewOutput creates a new instance of Output. path is an optional path to the
@@ -31,42 +55,154 @@ type Output struct {
 // information will be written to stdout. verbose defines whether we need to
 // write extended information.
 func NewOutput(path string, verbose bool) (o *Output, err error) {
+	return newOutput(path, verbose, os.O_TRUNC)
+}
+
+// NewAppendOutput is like NewOutput, but the received data is appended to the
+// file at path instead of overwriting it, see --continue-at.
+func NewAppendOutput(path string, verbose bool) (o *Output, err error) {
+	return newOutput(path, verbose, os.O_APPEND)
+}
+
+// newOutput creates a new instance of Output.  flag is either os.O_TRUNC or
+// os.O_APPEND and is used when the file at path is opened.
+func newOutput(path string, verbose bool, flag int) (o *Output, err error) {
 	o = &Output{
+		writeMu:          &sync.Mutex{},
+		metricsMu:        &sync.Mutex{},
 		verbose:          verbose,
 		logFile:          os.Stderr,
 		receivedDataFile: os.Stdout,
 	}
 
 	if path != "" {
-		o.receivedDataFile, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0o644)
+		o.receivedDataFile, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|flag, 0o644)
 	}
 
 	return o, err
 }
 
-// Write writes received data to the output path (or stdout if not specified).
-func (o *Output) Write(resp *http.Response, responseBody io.Reader, cfg *config.Config) {
-	var err error
+// Write writes received data to the output path (or stdout if not specified)
+// or to the file named like the remote one, see --remote-name.  It returns the
+// error if the response body could not be read or written.
+func (o *Output) Write(resp *http.Response, responseBody io.Reader, cfg *config.Config) (err error) {
+	if cfg.RemoteName {
+		return o.writeRemoteName(resp, responseBody, cfg)
+	} else if cfg.OutputTemplate != "" {
+		return o.writeFile(cfg.OutputFile(), os.O_TRUNC, resp, responseBody, cfg)
+	}
 
-	if cfg.OutputJSON {
-		var b []byte
-		b, err = responseToJSON(resp, responseBody)
+	o.writeMu.Lock()
+	defer o.writeMu.Unlock()
+
+	return writeResponse(o.receivedDataFile, resp, responseBody, cfg)
+}
+
+// writeFile writes the received data to the file at path that is created for
+// this transfer so the writes don't need to be serialized.  flag is either
+// os.O_TRUNC or os.O_EXCL.  The missing directories are created if
+// cfg.CreateDirs is set.
+func (o *Output) writeFile(
+	path string,
+	flag int,
+	resp *http.Response,
+	responseBody io.Reader,
+	cfg *config.Config,
+) (err error) {
+	if cfg.CreateDirs {
+		err = os.MkdirAll(filepath.Dir(path), 0o755)
 		if err != nil {
-			panic(err)
+			return fmt.Errorf("%w: creating directory of %s: %w", ErrWrite, path, err)
 		}
+	}
+
+	o.Debug("Saving the received data to %s", path)
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|flag, 0o644)
+	if err != nil {
+		return fmt.Errorf("%w: creating %s: %w", ErrWrite, path, err)
+	}
+
+	err = writeResponse(f, resp, responseBody, cfg)
+
+	return errors.Join(err, f.Close())
+}
+
+// ErrWrite is returned by Write when the received data could not be written
+// as opposed to the errors of reading the response.
+var ErrWrite = errors.New("writing output")
+
+// errWriter wraps the errors of w with ErrWrite.
+type errWriter struct {
+	w io.Writer
+}
+
+// type check
+var _ io.Writer = errWriter{}
 
-		_, err = o.receivedDataFile.Write(b)
+// Write implements the io.Writer interface for errWriter.
+func (ew errWriter) Write(p []byte) (n int, err error) {
+	n, err = ew.w.Write(p)
+	if err != nil {
+		err = fmt.Errorf("%w: %w", ErrWrite, err)
+	}
+
+	return n, err
+}
+
+// writeResponse writes the received data to w.
+func writeResponse(w io.Writer, resp *http.Response, responseBody io.Reader, cfg *config.Config) (err error) {
+	w = errWriter{w: w}
+
+	if cfg.OutputJSON {
+		err = writeResponseJSON(w, resp, responseBody, cfg)
 	} else if responseBody == nil {
-		_, err = o.receivedDataFile.WriteString(responseToString(resp))
+		_, err = io.WriteString(w, responseToString(resp))
 	} else {
-		_, err = io.Copy(o.receivedDataFile, responseBody)
+		_, err = io.Copy(w, responseBody)
 	}
 
+	return err
+}
+
+// WriteRaw writes b as is to the output path (or stdout if not specified).
+func (o *Output) WriteRaw(b []byte) {
+	o.writeMu.Lock()
+	defer o.writeMu.Unlock()
+
+	_, err := o.receivedDataFile.Write(b)
 	if err != nil {
 		panic(err)
 	}
 }
 
+// WriteError writes the information about the failed request to u to the
+// output.  It only does that in the JSON Lines mode so that the output
+// contains a line for every URL, otherwise the error is only logged.
+// attempts is the optional list of the failed attempts.
+func (o *Output) WriteError(
+	u *url.URL,
+	reqErr error,
+	attempts []*Attempt,
+	cfg *config.Config,
+) {
+	if !cfg.JSONLines() {
+		return
+	}
+
+	b, err := json.Marshal(&ResponseData{
+		URL:        u.String(),
+		Error:      reqErr.Error(),
+		HTTP2Error: newHTTP2Error(reqErr),
+		Attempts:   attempts,
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	o.WriteRaw(append(b, '\n'))
+}
+
 // Info writes INFO-level log to stderr.
 func (o *Output) Info(format string, args ...any) {
 	msg := fmt.Sprintf(format, args...)
@@ -94,6 +230,10 @@ func (o *Output) Debug(format string, args ...any) {
 //
 // TODO(ameshkov): instead of this, log the actual data sent to tls.Conn.
 func (o *Output) DebugRequest(req *http.Request) {
+	if !o.verbose {
+		return
+	}
+
 	o.Debug("Request:\n%s", requestToString(req))
 }
 
@@ -102,45 +242,133 @@ func (o *Output) DebugRequest(req *http.Request) {
 // TODO(ameshkov): instead of this, log the actual data received from tls.Conn.
 func (o *Output) DebugResponse(resp *http.Response) {
 	if resp.TLS != nil {
-		s := stateToTLSState(resp.TLS)
-		o.Debug("\n----\nTLS:")
-
-		o.Debug("Server name: %s", s.ServerName)
-		o.Debug("Version: %s", s.Version)
-		o.Debug("Cipher: %s", s.CipherSuite)
-		if s.NegotiatedProtocol != "" {
-			o.Debug("Negotiated protocol: %s", s.NegotiatedProtocol)
-		}
+		writeTLSState(o.Debug, resp.TLS)
+	}
+
+	o.Debug("Response:\n----\n%s", responseToString(resp))
+
+	honored := rangeHonored(resp)
+	switch {
+	case honored == nil:
+		// Go on.
+	case *honored:
+		o.Debug("The server honored the range: %s", resp.Status)
+	default:
+		o.Debug("The server ignored the range: %s", resp.Status)
+	}
+}
+
+// rangeHonored returns whether the server responded with 206 Partial Content
+// to the request with the Range header, see --range.  It returns nil if the
+// request had no Range header.
+func rangeHonored(resp *http.Response) (honored *bool) {
+	if resp.Request == nil || resp.Request.Header.Get("Range") == "" {
+		return nil
+	}
+
+	ok := resp.StatusCode == http.StatusPartialContent
+
+	return &ok
+}
+
+// InfoTLS writes information about the TLS connection to stderr regardless of
+// the verbose flag.
+func (o *Output) InfoTLS(state *tls.ConnectionState) {
+	writeTLSState(o.Info, state)
+}
+
+// writeTLSState writes information about the TLS connection using log.
+func writeTLSState(log func(format string, args ...any), state *tls.ConnectionState) {
+	s := stateToTLSState(state)
+	log("\n----\nTLS:")
+
+	log("Server name: %s", s.ServerName)
+	log("Version: %s", s.Version)
+	log("Cipher: %s", s.CipherSuite)
+	if s.NegotiatedProtocol != "" {
+		log("Negotiated protocol: %s", s.NegotiatedProtocol)
+	}
+	if s.OCSPStatus != "" {
+		log("OCSP status: %s", s.OCSPStatus)
+	}
 
-		o.Debug("\n----\nCertificates:")
-		for i, certInfo := range s.Certificates {
-			o.Debug("Certificate №%d:\n", i+1)
-			o.Debug("Subject: %s", certInfo.Subject)
-			o.Debug("Issuer: %s", certInfo.Issuer)
-			o.Debug("Not before: %s", certInfo.NotBefore)
-			o.Debug("Not after: %s", certInfo.NotAfter)
-			if len(certInfo.DNSNames) > 0 {
-				o.Debug("DNS names:\n%s", strings.Join(certInfo.DNSNames, "\n"))
-			}
-			if len(certInfo.IPAddresses) > 0 {
-				o.Debug("IP addresses:\n%s", strings.Join(certInfo.IPAddresses, "\n"))
-			}
-			o.Debug("Raw certificate:")
-			o.Debug(certInfo.Raw)
+	log("\n----\nCertificates:")
+	for i, certInfo := range s.Certificates {
+		log("Certificate №%d:\n", i+1)
+		log("Subject: %s", certInfo.Subject)
+		log("Issuer: %s", certInfo.Issuer)
+		log("Not before: %s", certInfo.NotBefore)
+		log("Not after: %s", certInfo.NotAfter)
+		if len(certInfo.DNSNames) > 0 {
+			log("DNS names:\n%s", strings.Join(certInfo.DNSNames, "\n"))
 		}
+		if len(certInfo.IPAddresses) > 0 {
+			log("IP addresses:\n%s", strings.Join(certInfo.IPAddresses, "\n"))
+		}
+		log("Raw certificate:")
+		log(certInfo.Raw)
 	}
 
-	o.Debug("Response:\n----\n%s", responseToString(resp))
+	if n := len(s.VerifiedChain); n > 0 {
+		log("\n----\nVerified chain:")
+		for _, subject := range s.VerifiedChain[:n-1] {
+			log("%s", subject)
+		}
+		log("Trust anchor: %s", s.VerifiedChain[n-1])
+	}
 }
 
-// requestToString converts HTTP request to a string.
+// requestToString converts the head of the HTTP request to a string.  The body
+// is never read since it may be streamed from a file or stdin, which can only
+// be read once.
 func requestToString(req *http.Request) (str string) {
 	cloneReq := req.Clone(context.Background())
+	if cloneReq.Body != nil && cloneReq.Body != http.NoBody {
+		// Keep the framing headers, but don't touch the real body.
+		cloneReq.Body, cloneReq.GetBody = io.NopCloser(zeroReader{}), nil
+	}
 
-	b := &bytes.Buffer{}
-	_ = cloneReq.Write(b)
+	w := &headWriter{}
+	_ = cloneReq.Write(w)
 
-	return b.String()
+	return w.buf.String()
+}
+
+// errHeadWritten is returned by headWriter when the message head is written.
+var errHeadWritten = errors.New("message head written")
+
+// headWriter is an io.Writer that keeps the head of an HTTP message and fails
+// after it so that the body is not written.
+type headWriter struct {
+	buf bytes.Buffer
+}
+
+// type check
+var _ io.Writer = (*headWriter)(nil)
+
+// Write implements the io.Writer interface for *headWriter.
+func (w *headWriter) Write(p []byte) (n int, err error) {
+	_, _ = w.buf.Write(p)
+	if i := bytes.Index(w.buf.Bytes(), []byte("\r\n\r\n")); i >= 0 {
+		w.buf.Truncate(i + len("\r\n\r\n"))
+
+		return 0, errHeadWritten
+	}
+
+	return len(p), nil
+}
+
+// zeroReader is an io.Reader of endless zero bytes.
+type zeroReader struct{}
+
+// type check
+var _ io.Reader = zeroReader{}
+
+// Read implements the io.Reader interface for zeroReader.
+func (zeroReader) Read(p []byte) (n int, err error) {
+	clear(p)
+
+	return len(p), nil
 }
 
 // responseToString converts HTTP response to a string.
@@ -182,17 +410,44 @@ type TLSState struct {
 	Version            string           `json:"version"`
 	CipherSuite        string           `json:"cipher_suite"`
 	NegotiatedProtocol string           `json:"negotiated_protocol"`
+	OCSPStatus         string           `json:"ocsp_status,omitempty"`
 	Certificates       []TLSCertificate `json:"certificates"`
+
+	// VerifiedChain are the subjects of the certificates of the chain built
+	// during the verification, the last one is the trust anchor.  It is empty
+	// if the verification is disabled.
+	VerifiedChain []string `json:"verified_chain,omitempty"`
 }
 
 // ResponseData is a helper object for serializing response data to JSON.
 type ResponseData struct {
-	StatusCode int                 `json:"status_code"`
-	Status     string              `json:"status"`
-	Proto      string              `json:"proto"`
-	TLS        *TLSState           `json:"tls"`
-	Headers    map[string][]string `json:"headers"`
-	BodyBase64 string              `json:"body_base64"`
+	URL        string      `json:"url,omitempty"`
+	Error      string      `json:"error,omitempty"`
+	StatusCode int         `json:"status_code"`
+	Status     string      `json:"status"`
+	Proto      string      `json:"proto"`
+	MPTCP      *bool       `json:"mptcp,omitempty"`
+	Proxy      string      `json:"proxy,omitempty"`
+	ProxyUsed  bool        `json:"proxy_used"`
+	RemoteAddr string      `json:"remote_addr,omitempty"`
+	LocalAddr  string      `json:"local_addr,omitempty"`
+	IPFamily   string      `json:"ip_family,omitempty"`
+	RangeOK    *bool       `json:"range_honored,omitempty"`
+	HTTP2Error *HTTP2Error `json:"http2_error,omitempty"`
+	Attempts   []*Attempt  `json:"attempts,omitempty"`
+	Redirects  []*Redirect `json:"redirects,omitempty"`
+	Timings    *Timings    `json:"timings,omitempty"`
+	TLS        *TLSState   `json:"tls"`
+
+	// Headers is either []*HeaderField or map[string][]string if
+	// --json-headers-map is used.
+	Headers any `json:"headers"`
+
+	// HeadersOrder is the order of Headers, either HeaderOrderWire or
+	// HeaderOrderAlphabetical.  It is empty if --json-headers-map is used.
+	HeadersOrder string `json:"headers_order,omitempty"`
+
+	BodyBase64 string `json:"body_base64"`
 }
 
 // stateToTLSState converts tls.ConnectionState to TLSState.
@@ -202,6 +457,7 @@ func stateToTLSState(state *tls.ConnectionState) (s *TLSState) {
 		Version:            tls.VersionName(state.Version),
 		CipherSuite:        tls.CipherSuiteName(state.CipherSuite),
 		NegotiatedProtocol: state.NegotiatedProtocol,
+		OCSPStatus:         ocspStatus(state.OCSPResponse),
 	}
 
 	for _, cert := range state.PeerCertificates {
@@ -218,31 +474,156 @@ func stateToTLSState(state *tls.ConnectionState) (s *TLSState) {
 		s.Certificates = append(s.Certificates, certInfo)
 	}
 
+	if len(state.VerifiedChains) > 0 {
+		for _, cert := range state.VerifiedChains[0] {
+			s.VerifiedChain = append(s.VerifiedChain, cert.Subject.String())
+		}
+	}
+
 	return s
 }
 
-// responseToJSON transforms response data to JSON format.
-func responseToJSON(resp *http.Response, responseBody io.Reader) (b []byte, err error) {
-	body, err := io.ReadAll(responseBody)
+// ocspStatus returns the status from the stapled OCSP response: "good",
+// "revoked", "unknown" or "invalid" if it can't be parsed.  It returns an
+// empty string if there is no response.  The signature is not checked here,
+// see --cert-status.
+func ocspStatus(b []byte) (status string) {
+	if len(b) == 0 {
+		return ""
+	}
+
+	resp, err := ocsp.ParseResponse(b, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+		return "invalid"
+	}
+
+	switch resp.Status {
+	case ocsp.Good:
+		return "good"
+	case ocsp.Revoked:
+		return "revoked"
+	default:
+		return "unknown"
+	}
+}
+
+// bodyPlaceholder is the placeholder for the body_base64 field value which is
+// replaced with the actual body when the JSON output is written.  This way the
+// body is not required to be fully loaded into memory.
+const bodyPlaceholder = "__GOCURL_BODY_BASE64__"
+
+// writeResponseJSON writes response data to w in JSON format.  If
+// cfg.JSONLines() is true, the result is a single line terminated by a line
+// break.  The response body is buffered, the buffer is limited by
+// cfg.MaxMemory and the rest is spilled to a temporary file.
+func writeResponseJSON(
+	w io.Writer,
+	resp *http.Response,
+	responseBody io.Reader,
+	cfg *config.Config,
+) (err error) {
+	// Read the body first so that errors are reported before anything is
+	// written.
+	buf := spill.New(cfg.MaxMemory)
+	defer func() { _ = buf.Close() }()
+
+	if responseBody != nil {
+		_, err = io.Copy(buf, responseBody)
+		if err != nil {
+			return fmt.Errorf("failed to read response body: %w", err)
+		}
 	}
 
 	data := ResponseData{
 		StatusCode: resp.StatusCode,
 		Status:     resp.Status,
 		Proto:      resp.Proto,
-		Headers:    resp.Header,
-		BodyBase64: base64.StdEncoding.EncodeToString(body),
+		BodyBase64: bodyPlaceholder,
+	}
+
+	var info *ConnInfo
+	if resp.Request != nil {
+		info = connInfoFromContext(resp.Request.Context())
+	}
+
+	if cfg.JSONHeadersMap {
+		data.Headers = resp.Header
+	} else {
+		data.Headers, data.HeadersOrder = headerFields(resp, info)
 	}
 
 	if resp.TLS != nil {
 		data.TLS = stateToTLSState(resp.TLS)
 	}
 
-	b, err = json.MarshalIndent(data, "", "  ")
+	data.RangeOK = rangeHonored(resp)
+
+	if resp.Request != nil {
+		data.URL = resp.Request.URL.String()
+		data.Attempts = attemptsFromContext(resp.Request.Context())
+		data.Redirects = redirectsFromContext(resp.Request.Context())
+
+		// The body is already read so the total time is known.
+		data.Timings = TimingsFromContext(resp.Request.Context())
+		if data.Timings != nil {
+			data.Timings.Done(PhaseTotal, time.Now())
+		}
+	}
+
+	if info != nil {
+		data.MPTCP = info.MPTCP
+		data.Proxy = info.Proxy
+		data.ProxyUsed = info.ProxyUsed
+
+		if info.RemoteAddr != nil {
+			data.RemoteAddr = info.RemoteAddr.String()
+			data.IPFamily = ipFamily(info.RemoteAddr)
+		}
+
+		if info.LocalAddr != nil {
+			data.LocalAddr = info.LocalAddr.String()
+		}
+	}
+
+	var b []byte
+	if cfg.JSONLines() {
+		b, err = json.Marshal(data)
+		b = append(b, '\n')
+	} else {
+		b, err = json.MarshalIndent(data, "", "  ")
+	}
+	if err != nil {
+		return err
+	}
+
+	// body_base64 is the last field so look for the last occurrence of the
+	// placeholder.
+	idx := bytes.LastIndex(b, []byte(bodyPlaceholder))
+
+	body, err := buf.Reader()
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(b[:idx])
+	if err != nil {
+		return err
+	}
+
+	enc := base64.NewEncoder(base64.StdEncoding, w)
+	_, err = io.Copy(enc, body)
+	if err != nil {
+		return err
+	}
+
+	err = enc.Close()
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(b[idx+len(bodyPlaceholder):])
 
-	return b, err
+	return err
 }
 
 // certToPEM serializes certificate bytes to PEM format.
@@ -0,0 +1,127 @@
+package output_test
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ameshkov/gocurl/internal/config"
+	"github.com/ameshkov/gocurl/internal/output"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutput_Write_connInfo(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.json")
+	out, err := output.NewOutput(path, false)
+	require.NoError(t, err)
+
+	u, err := url.Parse("http://example.org/")
+	require.NoError(t, err)
+
+	req := &http.Request{URL: u}
+	req = req.WithContext(output.WithConnInfo(req.Context(), &output.ConnInfo{
+		Proxy:      "socks5://proxy.example:1080",
+		ProxyUsed:  true,
+		RemoteAddr: &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 1080},
+		LocalAddr:  &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 54321},
+	}))
+
+	resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Request: req}
+	out.Write(resp, nil, &config.Config{OutputJSON: true})
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	var data output.ResponseData
+	err = json.Unmarshal(b, &data)
+	require.NoError(t, err)
+
+	require.True(t, data.ProxyUsed)
+	require.Equal(t, "[2001:db8::1]:1080", data.RemoteAddr)
+	require.Equal(t, "[2001:db8::2]:54321", data.LocalAddr)
+	require.Equal(t, "ipv6", data.IPFamily)
+}
+
+func TestOutput_Write_range(t *testing.T) {
+	u, err := url.Parse("http://example.org/")
+	require.NoError(t, err)
+
+	testCases := []struct {
+		want   *bool
+		name   string
+		header string
+		status int
+	}{{
+		want:   ptr(true),
+		name:   "honored",
+		header: "bytes=0-1023",
+		status: http.StatusPartialContent,
+	}, {
+		want:   ptr(false),
+		name:   "ignored",
+		header: "bytes=0-1023",
+		status: http.StatusOK,
+	}, {
+		want:   nil,
+		name:   "no_range",
+		header: "",
+		status: http.StatusOK,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "out.json")
+			out, oErr := output.NewOutput(path, false)
+			require.NoError(t, oErr)
+
+			req := &http.Request{URL: u, Header: http.Header{}}
+			if tc.header != "" {
+				req.Header.Set("Range", tc.header)
+			}
+
+			resp := &http.Response{StatusCode: tc.status, Header: http.Header{}, Request: req}
+			out.Write(resp, nil, &config.Config{OutputJSON: true})
+
+			b, oErr := os.ReadFile(path)
+			require.NoError(t, oErr)
+
+			var data output.ResponseData
+			require.NoError(t, json.Unmarshal(b, &data))
+			require.Equal(t, tc.want, data.RangeOK)
+		})
+	}
+}
+
+// ptr returns the pointer to v.
+func ptr[T any](v T) (p *T) {
+	return &v
+}
+
+func TestNewAppendOutput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.txt")
+	err := os.WriteFile(path, []byte("first\nsecond\n"), 0o600)
+	require.NoError(t, err)
+
+	out, err := output.NewAppendOutput(path, false)
+	require.NoError(t, err)
+
+	out.WriteRaw([]byte("third\n"))
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "first\nsecond\nthird\n", string(b))
+
+	// NewOutput overwrites the file.
+	out, err = output.NewOutput(path, false)
+	require.NoError(t, err)
+
+	out.WriteRaw([]byte("new\n"))
+
+	b, err = os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "new\n", string(b))
+}
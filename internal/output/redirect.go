@@ -0,0 +1,38 @@
+package output
+
+import (
+	"context"
+	"net/http"
+)
+
+// Redirect is a redirect response that was followed, see -L/--location.
+type Redirect struct {
+	// URL is the URL of the request that received the redirect.
+	URL string `json:"url"`
+
+	// Location is the URL the request was redirected to.
+	Location string `json:"location"`
+
+	// StatusCode is the status code of the redirect response.
+	StatusCode int `json:"status_code"`
+
+	// Response is the redirect response, its body is already closed.  It is
+	// used to write the header, see --dump-header.
+	Response *http.Response `json:"-"`
+}
+
+// redirectsKey is the context key for the list of redirects.
+type redirectsKey struct{}
+
+// WithRedirects returns a copy of ctx with redirects attached to it.  The
+// redirects are written to the JSON output along with the final response.
+func WithRedirects(ctx context.Context, redirects []*Redirect) (res context.Context) {
+	return context.WithValue(ctx, redirectsKey{}, redirects)
+}
+
+// redirectsFromContext returns the redirects attached to ctx or nil.
+func redirectsFromContext(ctx context.Context) (redirects []*Redirect) {
+	redirects, _ = ctx.Value(redirectsKey{}).([]*Redirect)
+
+	return redirects
+}
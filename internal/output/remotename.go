@@ -0,0 +1,79 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ameshkov/gocurl/internal/config"
+)
+
+// writeRemoteName writes the received data to the file named like the remote
+// one in cfg.OutputDir or the current directory, see --remote-name.
+func (o *Output) writeRemoteName(resp *http.Response, responseBody io.Reader, cfg *config.Config) (err error) {
+	name, fromHeader, err := remoteFileName(resp, cfg)
+	if err != nil {
+		return err
+	}
+
+	flag := os.O_TRUNC
+	if fromHeader {
+		// Like curl, don't let the server overwrite the existing files.
+		flag = os.O_EXCL
+	}
+
+	return o.writeFile(filepath.Join(cfg.OutputDir, name), flag, resp, responseBody, cfg)
+}
+
+// remoteFileName returns the name of the file for the response to
+// cfg.RequestURL.  If cfg.RemoteHeaderName is set, the name from the
+// Content-Disposition header has priority, fromHeader is true in this case.
+func remoteFileName(resp *http.Response, cfg *config.Config) (name string, fromHeader bool, err error) {
+	if cfg.RemoteHeaderName {
+		name = safeFileName(contentDispositionName(resp.Header.Get("Content-Disposition")))
+		if name != "" {
+			return name, true, nil
+		}
+	}
+
+	name = safeFileName(cfg.RequestURL.Path)
+	if name == "" {
+		return "", false, fmt.Errorf("remote file name has no length: %s", cfg.RequestURL)
+	}
+
+	return name, false, nil
+}
+
+// contentDispositionName returns the file name from the value of the
+// Content-Disposition header or an empty string if there is none.
+func contentDispositionName(v string) (name string) {
+	if v == "" {
+		return ""
+	}
+
+	_, params, err := mime.ParseMediaType(v)
+	if err != nil {
+		return ""
+	}
+
+	return params["filename"]
+}
+
+// safeFileName returns the last segment of the path p so that the file could
+// only be created in the current directory.  It returns an empty string if
+// there is no safe name.
+func safeFileName(p string) (name string) {
+	if i := strings.LastIndexAny(p, `/\`); i >= 0 {
+		p = p[i+1:]
+	}
+
+	if p == "." || p == ".." || strings.ContainsRune(p, 0) {
+		return ""
+	}
+
+	return p
+}
@@ -0,0 +1,117 @@
+package output_test
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ameshkov/gocurl/internal/config"
+	"github.com/ameshkov/gocurl/internal/output"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutput_Write_remoteName(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+
+	require.NoError(t, os.WriteFile("existing.txt", []byte("old"), 0o600))
+
+	testCases := []struct {
+		name        string
+		url         string
+		disposition string
+		headerName  bool
+		wantFile    string
+		wantErr     string
+	}{{
+		name:     "url",
+		url:      "https://example.org/dir/file.txt?query",
+		wantFile: "file.txt",
+	}, {
+		name:        "url_ignores_header",
+		url:         "https://example.org/url.txt",
+		disposition: `attachment; filename="header.txt"`,
+		wantFile:    "url.txt",
+	}, {
+		name:        "header",
+		url:         "https://example.org/download",
+		disposition: `attachment; filename="header.txt"`,
+		headerName:  true,
+		wantFile:    "header.txt",
+	}, {
+		name:        "header_traversal",
+		url:         "https://example.org/download",
+		disposition: `attachment; filename="../../etc/evil.txt"`,
+		headerName:  true,
+		wantFile:    "evil.txt",
+	}, {
+		name:        "header_encoded",
+		url:         "https://example.org/download",
+		disposition: `attachment; filename*=UTF-8''na%C3%AFve.txt`,
+		headerName:  true,
+		wantFile:    "naïve.txt",
+	}, {
+		name:       "header_missing",
+		url:        "https://example.org/fallback.txt",
+		headerName: true,
+		wantFile:   "fallback.txt",
+	}, {
+		name:        "header_existing",
+		url:         "https://example.org/download",
+		disposition: `attachment; filename="existing.txt"`,
+		headerName:  true,
+		wantErr:     "file exists",
+	}, {
+		name:    "no_name",
+		url:     "https://example.org/",
+		wantErr: "remote file name has no length",
+	}, {
+		name:    "dot_dot",
+		url:     "https://example.org/a/..%2F..",
+		wantErr: "remote file name has no length",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			args := []string{"-O", tc.url}
+			if tc.headerName {
+				args = append(args, "-J")
+			}
+
+			cfg, err := config.ParseConfig(args)
+			require.NoError(t, err)
+
+			out, err := output.NewOutput("", false)
+			require.NoError(t, err)
+
+			resp := &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{},
+			}
+			if tc.disposition != "" {
+				resp.Header.Set("Content-Disposition", tc.disposition)
+			}
+
+			err = out.Write(resp, strings.NewReader(tc.name), cfg)
+			if tc.wantErr != "" {
+				require.ErrorContains(t, err, tc.wantErr)
+
+				return
+			}
+
+			require.NoError(t, err)
+
+			b, err := os.ReadFile(tc.wantFile)
+			require.NoError(t, err)
+			require.Equal(t, tc.name, string(b))
+		})
+	}
+
+	b, err := os.ReadFile("existing.txt")
+	require.NoError(t, err)
+	require.Equal(t, "old", string(b))
+}
@@ -0,0 +1,143 @@
+package output
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Phase is a phase of the transfer, see Timings.
+type Phase uint8
+
+// Phase values.  The names are the same as curl's time_* variables.
+const (
+	// PhaseNameLookup ends when the hostname is resolved.
+	PhaseNameLookup Phase = iota
+
+	// PhaseConnect ends when the TCP connection is established or the UDP
+	// socket for QUIC is opened.
+	PhaseConnect
+
+	// PhaseAppConnect ends when the TLS or QUIC handshake is completed.
+	PhaseAppConnect
+
+	// PhaseStartTransfer ends when the first byte of the response is
+	// received.
+	PhaseStartTransfer
+
+	// PhaseTotal ends when the whole response is received.
+	PhaseTotal
+
+	// phaseCount is the number of phases.
+	phaseCount
+)
+
+// phaseNames are the names of the phases used in the output.
+var phaseNames = [phaseCount]string{
+	PhaseNameLookup:    "namelookup",
+	PhaseConnect:       "connect",
+	PhaseAppConnect:    "appconnect",
+	PhaseStartTransfer: "starttransfer",
+	PhaseTotal:         "total",
+}
+
+// Timings are the durations of the transfer phases counted from the start of
+// the request like in curl.  A phase is zero if it didn't happen, e.g. when an
+// existing connection was reused or TLS was not used.  It is safe for
+// concurrent use.
+type Timings struct {
+	// mu protects phases.
+	mu *sync.Mutex
+
+	// start is the time when the request was sent.
+	start time.Time
+
+	// phases are the durations of the completed phases.
+	phases [phaseCount]time.Duration
+}
+
+// NewTimings returns new *Timings of the request sent at start.
+func NewTimings(start time.Time) (t *Timings) {
+	return &Timings{
+		mu:    &sync.Mutex{},
+		start: start,
+	}
+}
+
+// Done records that the phase p was completed at the specified time.
+func (t *Timings) Done(p Phase, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.phases[p] = at.Sub(t.start)
+}
+
+// Duration returns the duration of the phase p since the start of the
+// request.
+func (t *Timings) Duration(p Phase) (d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.phases[p]
+}
+
+// type check
+var _ fmt.Stringer = (*Timings)(nil)
+
+// String implements the fmt.Stringer interface for *Timings.
+func (t *Timings) String() (s string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for p, d := range t.phases {
+		if p > 0 {
+			s += " "
+		}
+
+		s += fmt.Sprintf("%s=%s", phaseNames[p], d)
+	}
+
+	return s
+}
+
+// type check
+var _ json.Marshaler = (*Timings)(nil)
+
+// MarshalJSON implements the json.Marshaler interface for *Timings.  The
+// phases are written in nanoseconds like the other durations.
+func (t *Timings) MarshalJSON() (b []byte, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return json.Marshal(struct {
+		NameLookup    time.Duration `json:"namelookup_ns"`
+		Connect       time.Duration `json:"connect_ns"`
+		AppConnect    time.Duration `json:"appconnect_ns"`
+		StartTransfer time.Duration `json:"starttransfer_ns"`
+		Total         time.Duration `json:"total_ns"`
+	}{
+		NameLookup:    t.phases[PhaseNameLookup],
+		Connect:       t.phases[PhaseConnect],
+		AppConnect:    t.phases[PhaseAppConnect],
+		StartTransfer: t.phases[PhaseStartTransfer],
+		Total:         t.phases[PhaseTotal],
+	})
+}
+
+// timingsKey is the context key for *Timings.
+type timingsKey struct{}
+
+// WithTimings returns a copy of ctx with t attached to it.  The dialer records
+// the connection phases to it.
+func WithTimings(ctx context.Context, t *Timings) (res context.Context) {
+	return context.WithValue(ctx, timingsKey{}, t)
+}
+
+// TimingsFromContext returns *Timings attached to ctx or nil.
+func TimingsFromContext(ctx context.Context) (t *Timings) {
+	t, _ = ctx.Value(timingsKey{}).(*Timings)
+
+	return t
+}
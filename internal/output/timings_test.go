@@ -0,0 +1,37 @@
+package output_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/ameshkov/gocurl/internal/output"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimings(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	timings := output.NewTimings(start)
+	timings.Done(output.PhaseNameLookup, start.Add(time.Millisecond))
+	timings.Done(output.PhaseConnect, start.Add(2*time.Millisecond))
+	timings.Done(output.PhaseStartTransfer, start.Add(5*time.Millisecond))
+	timings.Done(output.PhaseTotal, start.Add(7*time.Millisecond))
+
+	require.Equal(t, 2*time.Millisecond, timings.Duration(output.PhaseConnect))
+	require.Zero(t, timings.Duration(output.PhaseAppConnect))
+	require.Equal(
+		t,
+		"namelookup=1ms connect=2ms appconnect=0s starttransfer=5ms total=7ms",
+		timings.String(),
+	)
+
+	b, err := json.Marshal(timings)
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"namelookup_ns": 1000000,
+		"connect_ns": 2000000,
+		"appconnect_ns": 0,
+		"starttransfer_ns": 5000000,
+		"total_ns": 7000000
+	}`, string(b))
+}
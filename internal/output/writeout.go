@@ -0,0 +1,160 @@
+package output
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WriteOut writes the information about the transfer to stdout formatted
+// according to format, see -w/--write-out.  m is the metrics of the transfer,
+// resp is its final response or nil if reqErr happened.  Unknown variables
+// are logged and written as is.
+func (o *Output) WriteOut(format string, m *Metrics, resp *http.Response, reqErr error) {
+	s, err := FormatWriteOut(format, m, resp, reqErr)
+	if err != nil {
+		o.Info("Warning: invalid write-out: %v", err)
+	}
+
+	o.writeMu.Lock()
+	defer o.writeMu.Unlock()
+
+	// Like in curl, the information is written to stdout even if the
+	// response body is written to a file.
+	_, err = os.Stdout.WriteString(s)
+	if err != nil {
+		o.Info("Failed to write the write-out: %v", err)
+	}
+}
+
+// FormatWriteOut replaces the %{variable} placeholders and the \n, \r and \t
+// escape sequences in format with their values, "%%" is replaced with "%".
+// The variables are named after curl's ones.  err is returned for unknown
+// variables, they are kept in s as is.
+func FormatWriteOut(format string, m *Metrics, resp *http.Response, reqErr error) (s string, err error) {
+	sb := &strings.Builder{}
+	var errs []error
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		next := byte(0)
+		if i+1 < len(format) {
+			next = format[i+1]
+		}
+
+		switch {
+		case c == '%' && next == '%':
+			sb.WriteByte('%')
+			i++
+		case c == '%' && next == '{':
+			end := strings.IndexByte(format[i:], '}')
+			if end < 0 {
+				sb.WriteString(format[i:])
+				errs = append(errs, fmt.Errorf("unterminated variable at %d", i))
+
+				return sb.String(), errors.Join(errs...)
+			}
+
+			name := format[i+2 : i+end]
+			v, ok := writeOutVar(name, m, resp, reqErr)
+			if !ok {
+				v = format[i : i+end+1]
+				errs = append(errs, fmt.Errorf("unknown variable %q", name))
+			}
+
+			sb.WriteString(v)
+			i += end
+		case c == '\\' && next == 'n':
+			sb.WriteByte('\n')
+			i++
+		case c == '\\' && next == 'r':
+			sb.WriteByte('\r')
+			i++
+		case c == '\\' && next == 't':
+			sb.WriteByte('\t')
+			i++
+		default:
+			sb.WriteByte(c)
+		}
+	}
+
+	return sb.String(), errors.Join(errs...)
+}
+
+// writeOutVar returns the value of the -w/--write-out variable with the
+// specified name.  ok is false if the variable is unknown.
+func writeOutVar(name string, m *Metrics, resp *http.Response, reqErr error) (v string, ok bool) {
+	switch name {
+	case "http_code", "response_code":
+		// curl writes 000 if there was no response.
+		return fmt.Sprintf("%03d", m.StatusCode), true
+	case "time_total":
+		return formatSeconds(m.TotalDuration), true
+	case "time_namelookup":
+		return formatPhase(m.Timings, PhaseNameLookup), true
+	case "time_connect":
+		return formatPhase(m.Timings, PhaseConnect), true
+	case "time_appconnect":
+		return formatPhase(m.Timings, PhaseAppConnect), true
+	case "time_starttransfer":
+		return formatPhase(m.Timings, PhaseStartTransfer), true
+	case "remote_ip":
+		return m.RemoteIP, true
+	case "ssl_verify_result":
+		if IsVerifyError(reqErr) {
+			return "1", true
+		}
+
+		return "0", true
+	case "size_download":
+		return strconv.FormatInt(m.DownloadSize, 10), true
+	case "size_upload":
+		return strconv.FormatInt(m.UploadSize, 10), true
+	case "url_effective":
+		if resp != nil && resp.Request != nil && resp.Request.URL != nil {
+			return resp.Request.URL.String(), true
+		}
+
+		return m.URL, true
+	default:
+		return "", false
+	}
+}
+
+// formatSeconds returns d in seconds with microsecond precision like curl.
+func formatSeconds(d time.Duration) (s string) {
+	return strconv.FormatFloat(d.Seconds(), 'f', 6, 64)
+}
+
+// formatPhase returns the duration of the phase p from t in seconds.  t may
+// be nil if the request was not sent.
+func formatPhase(t *Timings, p Phase) (s string) {
+	if t == nil {
+		return formatSeconds(0)
+	}
+
+	return formatSeconds(t.Duration(p))
+}
+
+// IsVerifyError returns true if err is caused by the failed verification of
+// the server certificate.  It's also used to choose the exit code.
+func IsVerifyError(err error) (ok bool) {
+	if err == nil {
+		return false
+	}
+
+	var verifyErr *tls.CertificateVerificationError
+	var hostnameErr x509.HostnameError
+	var authorityErr x509.UnknownAuthorityError
+	var invalidErr x509.CertificateInvalidError
+
+	return errors.As(err, &verifyErr) ||
+		errors.As(err, &hostnameErr) ||
+		errors.As(err, &authorityErr) ||
+		errors.As(err, &invalidErr)
+}
@@ -0,0 +1,96 @@
+package output_test
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ameshkov/gocurl/internal/output"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatWriteOut(t *testing.T) {
+	m := &output.Metrics{
+		URL:           "https://example.org/",
+		StatusCode:    200,
+		RemoteIP:      "192.0.2.1",
+		TotalDuration: 1500 * time.Millisecond,
+		UploadSize:    5,
+		DownloadSize:  10,
+	}
+
+	resp := &http.Response{
+		Request: &http.Request{URL: &url.URL{Scheme: "https", Host: "example.org", Path: "/final"}},
+	}
+
+	start := time.Now()
+	timings := output.NewTimings(start)
+	timings.Done(output.PhaseNameLookup, start.Add(time.Millisecond))
+	timings.Done(output.PhaseConnect, start.Add(2*time.Millisecond))
+	timings.Done(output.PhaseStartTransfer, start.Add(5*time.Millisecond))
+
+	verifyErr := fmt.Errorf("tls handshake: %w", x509.UnknownAuthorityError{})
+
+	testCases := []struct {
+		name    string
+		format  string
+		metrics *output.Metrics
+		resp    *http.Response
+		reqErr  error
+		want    string
+		wantErr string
+	}{{
+		name: "all",
+		format: "%{http_code} %{time_total} %{remote_ip} %{ssl_verify_result} " +
+			"%{size_download} %{size_upload} %{url_effective}\\n",
+		metrics: m,
+		resp:    resp,
+		want:    "200 1.500000 192.0.2.1 0 10 5 https://example.org/final\n",
+	}, {
+		name:   "timings",
+		format: "%{time_namelookup} %{time_connect} %{time_appconnect} %{time_starttransfer}",
+		metrics: &output.Metrics{
+			Timings: timings,
+		},
+		want: "0.001000 0.002000 0.000000 0.005000",
+	}, {
+		name:    "failed",
+		format:  "%{http_code}\\t%{ssl_verify_result}\\t%{url_effective}",
+		metrics: &output.Metrics{URL: "https://example.org/"},
+		reqErr:  verifyErr,
+		want:    "000\t1\thttps://example.org/",
+	}, {
+		name:    "escapes",
+		format:  "100%% \\r\\x %",
+		metrics: m,
+		want:    "100% \r\\x %",
+	}, {
+		name:    "unknown",
+		format:  "%{http_code} %{unknown}",
+		metrics: m,
+		want:    "200 %{unknown}",
+		wantErr: `unknown variable "unknown"`,
+	}, {
+		name:    "unterminated",
+		format:  "%{http_code} %{http_code",
+		metrics: m,
+		want:    "200 %{http_code",
+		wantErr: "unterminated variable at 13",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s, err := output.FormatWriteOut(tc.format, tc.metrics, tc.resp, tc.reqErr)
+			if tc.wantErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, tc.wantErr)
+			}
+
+			require.Equal(t, tc.want, s)
+		})
+	}
+}
@@ -0,0 +1,157 @@
+/*
+ * The subset of the PKCS#11 v2.40 API that gocurl uses.  The types follow the
+ * OASIS headers, the function list keeps its order up to C_Sign and omits the
+ * rest since only a pointer to it is used.
+ */
+#ifndef GOCURL_CRYPTOKI_H
+#define GOCURL_CRYPTOKI_H
+
+#ifdef _WIN32
+#pragma pack(push, cryptoki, 1)
+#endif
+
+typedef unsigned char CK_BYTE;
+typedef unsigned char CK_BBOOL;
+typedef unsigned char CK_UTF8CHAR;
+typedef unsigned long CK_ULONG;
+typedef CK_ULONG CK_RV;
+typedef CK_ULONG CK_FLAGS;
+typedef CK_ULONG CK_SLOT_ID;
+typedef CK_ULONG CK_SESSION_HANDLE;
+typedef CK_ULONG CK_OBJECT_HANDLE;
+typedef CK_ULONG CK_OBJECT_CLASS;
+typedef CK_ULONG CK_USER_TYPE;
+typedef CK_ULONG CK_ATTRIBUTE_TYPE;
+typedef CK_ULONG CK_MECHANISM_TYPE;
+
+#define CKR_OK                          0x000UL
+#define CKR_GENERAL_ERROR               0x005UL
+#define CKR_ARGUMENTS_BAD               0x007UL
+#define CKR_FUNCTION_NOT_SUPPORTED      0x054UL
+#define CKR_USER_ALREADY_LOGGED_IN      0x100UL
+#define CKR_CRYPTOKI_ALREADY_INITIALIZED 0x191UL
+
+#define CKF_LOGIN_REQUIRED  0x004UL
+#define CKF_OS_LOCKING_OK   0x002UL
+#define CKF_SERIAL_SESSION  0x004UL
+
+#define CKU_USER 1UL
+
+#define CKA_CLASS 0x000UL
+#define CKA_LABEL 0x003UL
+#define CKA_VALUE 0x011UL
+#define CKA_ID    0x102UL
+
+#define CKO_CERTIFICATE 1UL
+#define CKO_PRIVATE_KEY 3UL
+
+typedef struct CK_VERSION {
+	CK_BYTE major;
+	CK_BYTE minor;
+} CK_VERSION;
+
+typedef struct CK_TOKEN_INFO {
+	CK_UTF8CHAR label[32];
+	CK_UTF8CHAR manufacturerID[32];
+	CK_UTF8CHAR model[16];
+	CK_BYTE serialNumber[16];
+	CK_FLAGS flags;
+	CK_ULONG ulMaxSessionCount;
+	CK_ULONG ulSessionCount;
+	CK_ULONG ulMaxRwSessionCount;
+	CK_ULONG ulRwSessionCount;
+	CK_ULONG ulMaxPinLen;
+	CK_ULONG ulMinPinLen;
+	CK_ULONG ulTotalPublicMemory;
+	CK_ULONG ulFreePublicMemory;
+	CK_ULONG ulTotalPrivateMemory;
+	CK_ULONG ulFreePrivateMemory;
+	CK_VERSION hardwareVersion;
+	CK_VERSION firmwareVersion;
+	CK_UTF8CHAR utcTime[16];
+} CK_TOKEN_INFO;
+
+typedef struct CK_ATTRIBUTE {
+	CK_ATTRIBUTE_TYPE type;
+	void *pValue;
+	CK_ULONG ulValueLen;
+} CK_ATTRIBUTE;
+
+typedef struct CK_MECHANISM {
+	CK_MECHANISM_TYPE mechanism;
+	void *pParameter;
+	CK_ULONG ulParameterLen;
+} CK_MECHANISM;
+
+typedef struct CK_RSA_PKCS_PSS_PARAMS {
+	CK_MECHANISM_TYPE hashAlg;
+	CK_ULONG mgf;
+	CK_ULONG sLen;
+} CK_RSA_PKCS_PSS_PARAMS;
+
+typedef struct CK_C_INITIALIZE_ARGS {
+	void *CreateMutex;
+	void *DestroyMutex;
+	void *LockMutex;
+	void *UnlockMutex;
+	CK_FLAGS flags;
+	void *pReserved;
+} CK_C_INITIALIZE_ARGS;
+
+typedef struct CK_FUNCTION_LIST CK_FUNCTION_LIST;
+
+typedef CK_RV (*CK_C_GetFunctionList)(CK_FUNCTION_LIST **ppFunctionList);
+
+struct CK_FUNCTION_LIST {
+	CK_VERSION version;
+	CK_RV (*C_Initialize)(void *pInitArgs);
+	CK_RV (*C_Finalize)(void *pReserved);
+	void *C_GetInfo;
+	CK_C_GetFunctionList C_GetFunctionList;
+	CK_RV (*C_GetSlotList)(CK_BBOOL tokenPresent, CK_SLOT_ID *pSlotList, CK_ULONG *pulCount);
+	void *C_GetSlotInfo;
+	CK_RV (*C_GetTokenInfo)(CK_SLOT_ID slotID, CK_TOKEN_INFO *pInfo);
+	void *C_GetMechanismList;
+	void *C_GetMechanismInfo;
+	void *C_InitToken;
+	void *C_InitPIN;
+	void *C_SetPIN;
+	CK_RV (*C_OpenSession)(CK_SLOT_ID slotID, CK_FLAGS flags, void *pApplication, void *Notify, CK_SESSION_HANDLE *phSession);
+	CK_RV (*C_CloseSession)(CK_SESSION_HANDLE hSession);
+	void *C_CloseAllSessions;
+	void *C_GetSessionInfo;
+	void *C_GetOperationState;
+	void *C_SetOperationState;
+	CK_RV (*C_Login)(CK_SESSION_HANDLE hSession, CK_USER_TYPE userType, CK_UTF8CHAR *pPin, CK_ULONG ulPinLen);
+	void *C_Logout;
+	void *C_CreateObject;
+	void *C_CopyObject;
+	void *C_DestroyObject;
+	void *C_GetObjectSize;
+	CK_RV (*C_GetAttributeValue)(CK_SESSION_HANDLE hSession, CK_OBJECT_HANDLE hObject, CK_ATTRIBUTE *pTemplate, CK_ULONG ulCount);
+	void *C_SetAttributeValue;
+	CK_RV (*C_FindObjectsInit)(CK_SESSION_HANDLE hSession, CK_ATTRIBUTE *pTemplate, CK_ULONG ulCount);
+	CK_RV (*C_FindObjects)(CK_SESSION_HANDLE hSession, CK_OBJECT_HANDLE *phObject, CK_ULONG ulMaxObjectCount, CK_ULONG *pulObjectCount);
+	CK_RV (*C_FindObjectsFinal)(CK_SESSION_HANDLE hSession);
+	void *C_EncryptInit;
+	void *C_Encrypt;
+	void *C_EncryptUpdate;
+	void *C_EncryptFinal;
+	void *C_DecryptInit;
+	void *C_Decrypt;
+	void *C_DecryptUpdate;
+	void *C_DecryptFinal;
+	void *C_DigestInit;
+	void *C_Digest;
+	void *C_DigestUpdate;
+	void *C_DigestKey;
+	void *C_DigestFinal;
+	CK_RV (*C_SignInit)(CK_SESSION_HANDLE hSession, CK_MECHANISM *pMechanism, CK_OBJECT_HANDLE hKey);
+	CK_RV (*C_Sign)(CK_SESSION_HANDLE hSession, CK_BYTE *pData, CK_ULONG ulDataLen, CK_BYTE *pSignature, CK_ULONG *pulSignatureLen);
+};
+
+#ifdef _WIN32
+#pragma pack(pop, cryptoki)
+#endif
+
+#endif
@@ -0,0 +1,519 @@
+//go:build cgo && pkcs11
+
+package pkcs11
+
+/*
+#cgo linux LDFLAGS: -ldl
+#include <stdlib.h>
+#include <string.h>
+#include "cryptoki.h"
+
+#ifdef _WIN32
+#include <windows.h>
+
+static void *p11_dlopen(const char *path) { return (void *)LoadLibraryA(path); }
+static void *p11_dlsym(void *h, const char *name) { return (void *)GetProcAddress((HMODULE)h, name); }
+static const char *p11_dlerror(void) { return "LoadLibrary failed"; }
+#else
+#include <dlfcn.h>
+
+static void *p11_dlopen(const char *path) { return dlopen(path, RTLD_NOW | RTLD_LOCAL); }
+static void *p11_dlsym(void *h, const char *name) { return dlsym(h, name); }
+static const char *p11_dlerror(void) { return dlerror(); }
+#endif
+
+// cgo can't call C function pointers, so every function of the list has its
+// wrapper.
+
+static CK_RV p11_get_function_list(void *fn, CK_FUNCTION_LIST **list) {
+	return ((CK_C_GetFunctionList)fn)(list);
+}
+
+static CK_RV p11_initialize(CK_FUNCTION_LIST *f) {
+	// Go calls the module from many threads, so let it use the native locks.
+	CK_C_INITIALIZE_ARGS args;
+	memset(&args, 0, sizeof(args));
+	args.flags = CKF_OS_LOCKING_OK;
+
+	CK_RV rv = f->C_Initialize(&args);
+	if (rv == CKR_CRYPTOKI_ALREADY_INITIALIZED) {
+		return CKR_OK;
+	}
+
+	return rv;
+}
+
+static CK_RV p11_get_slot_list(CK_FUNCTION_LIST *f, CK_SLOT_ID *slots, CK_ULONG *n) {
+	return f->C_GetSlotList(1, slots, n);
+}
+
+static CK_RV p11_get_token_info(CK_FUNCTION_LIST *f, CK_SLOT_ID slot, CK_TOKEN_INFO *info) {
+	return f->C_GetTokenInfo(slot, info);
+}
+
+static CK_RV p11_open_session(CK_FUNCTION_LIST *f, CK_SLOT_ID slot, CK_SESSION_HANDLE *s) {
+	return f->C_OpenSession(slot, CKF_SERIAL_SESSION, NULL, NULL, s);
+}
+
+static CK_RV p11_close_session(CK_FUNCTION_LIST *f, CK_SESSION_HANDLE s) {
+	return f->C_CloseSession(s);
+}
+
+static CK_RV p11_login(CK_FUNCTION_LIST *f, CK_SESSION_HANDLE s, CK_UTF8CHAR *pin, CK_ULONG pinLen) {
+	CK_RV rv = f->C_Login(s, CKU_USER, pin, pinLen);
+	if (rv == CKR_USER_ALREADY_LOGGED_IN) {
+		return CKR_OK;
+	}
+
+	return rv;
+}
+
+// p11_find finds the first object of the class with the label and the id.
+// Empty label and id match any.  count is zero if there is no such object.
+static CK_RV p11_find(
+	CK_FUNCTION_LIST *f,
+	CK_SESSION_HANDLE s,
+	CK_OBJECT_CLASS cls,
+	CK_UTF8CHAR *label,
+	CK_ULONG labelLen,
+	CK_BYTE *id,
+	CK_ULONG idLen,
+	CK_OBJECT_HANDLE *obj,
+	CK_ULONG *count
+) {
+	CK_ATTRIBUTE tmpl[3];
+	CK_ULONG n = 0;
+
+	tmpl[n].type = CKA_CLASS;
+	tmpl[n].pValue = &cls;
+	tmpl[n].ulValueLen = sizeof(cls);
+	n++;
+
+	if (labelLen > 0) {
+		tmpl[n].type = CKA_LABEL;
+		tmpl[n].pValue = label;
+		tmpl[n].ulValueLen = labelLen;
+		n++;
+	}
+
+	if (idLen > 0) {
+		tmpl[n].type = CKA_ID;
+		tmpl[n].pValue = id;
+		tmpl[n].ulValueLen = idLen;
+		n++;
+	}
+
+	CK_RV rv = f->C_FindObjectsInit(s, tmpl, n);
+	if (rv != CKR_OK) {
+		return rv;
+	}
+
+	rv = f->C_FindObjects(s, obj, 1, count);
+	CK_RV finalRV = f->C_FindObjectsFinal(s);
+	if (rv != CKR_OK) {
+		return rv;
+	}
+
+	return finalRV;
+}
+
+// p11_get_attr reads the value of the attribute into buf.  If buf is NULL, it
+// only sets len to the length of the value.
+static CK_RV p11_get_attr(
+	CK_FUNCTION_LIST *f,
+	CK_SESSION_HANDLE s,
+	CK_OBJECT_HANDLE obj,
+	CK_ATTRIBUTE_TYPE typ,
+	void *buf,
+	CK_ULONG *len
+) {
+	CK_ATTRIBUTE attr;
+	attr.type = typ;
+	attr.pValue = buf;
+	attr.ulValueLen = *len;
+
+	CK_RV rv = f->C_GetAttributeValue(s, obj, &attr, 1);
+	*len = attr.ulValueLen;
+
+	return rv;
+}
+
+// p11_sign signs the data and allocates the signature, which the caller must
+// free.
+static CK_RV p11_sign(
+	CK_FUNCTION_LIST *f,
+	CK_SESSION_HANDLE s,
+	CK_MECHANISM_TYPE mechType,
+	CK_RSA_PKCS_PSS_PARAMS *pss,
+	CK_OBJECT_HANDLE key,
+	CK_BYTE *data,
+	CK_ULONG dataLen,
+	CK_BYTE **sig,
+	CK_ULONG *sigLen
+) {
+	CK_MECHANISM mech;
+	mech.mechanism = mechType;
+	mech.pParameter = pss;
+	mech.ulParameterLen = pss == NULL ? 0 : sizeof(*pss);
+
+	CK_RV rv = f->C_SignInit(s, &mech, key);
+	if (rv != CKR_OK) {
+		return rv;
+	}
+
+	// Query the length first.  It doesn't end the operation.
+	*sigLen = 0;
+	rv = f->C_Sign(s, data, dataLen, NULL, sigLen);
+	if (rv != CKR_OK) {
+		return rv;
+	}
+
+	*sig = malloc(*sigLen);
+	if (*sig == NULL) {
+		return CKR_GENERAL_ERROR;
+	}
+
+	rv = f->C_Sign(s, data, dataLen, *sig, sigLen);
+	if (rv != CKR_OK) {
+		free(*sig);
+		*sig = NULL;
+	}
+
+	return rv;
+}
+*/
+import "C"
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"sync"
+	"unsafe"
+)
+
+// ckrNames are the names of the return values that are likely to be caused
+// by a misconfiguration.
+var ckrNames = map[C.CK_RV]string{
+	0x005: "CKR_GENERAL_ERROR",
+	0x007: "CKR_ARGUMENTS_BAD",
+	0x030: "CKR_DEVICE_ERROR",
+	0x054: "CKR_FUNCTION_NOT_SUPPORTED",
+	0x063: "CKR_KEY_TYPE_INCONSISTENT",
+	0x070: "CKR_MECHANISM_INVALID",
+	0x071: "CKR_MECHANISM_PARAM_INVALID",
+	0x0a0: "CKR_PIN_INCORRECT",
+	0x0a2: "CKR_PIN_LEN_RANGE",
+	0x0a4: "CKR_PIN_LOCKED",
+	0x0e0: "CKR_TOKEN_NOT_PRESENT",
+	0x101: "CKR_USER_NOT_LOGGED_IN",
+}
+
+// rvError returns an error for the return value of the function or nil if it
+// is CKR_OK.
+func rvError(function string, rv C.CK_RV) (err error) {
+	if rv == C.CKR_OK {
+		return nil
+	}
+
+	if name, ok := ckrNames[rv]; ok {
+		return fmt.Errorf("pkcs11: %s: %s", function, name)
+	}
+
+	return fmt.Errorf("pkcs11: %s: 0x%x", function, uint64(rv))
+}
+
+// modules are the function lists of the loaded modules by their paths.  The
+// modules are never unloaded since the signers use them until exit.
+var (
+	modulesMu sync.Mutex
+	modules   = map[string]*C.CK_FUNCTION_LIST{}
+)
+
+// loadModule loads and initializes the module or returns the one that is
+// already loaded.
+func loadModule(path string) (f *C.CK_FUNCTION_LIST, err error) {
+	modulesMu.Lock()
+	defer modulesMu.Unlock()
+
+	if f = modules[path]; f != nil {
+		return f, nil
+	}
+
+	cPath := C.CString(path)
+	defer C.free(unsafe.Pointer(cPath))
+
+	h := C.p11_dlopen(cPath)
+	if h == nil {
+		return nil, fmt.Errorf("pkcs11: loading %s: %s", path, C.GoString(C.p11_dlerror()))
+	}
+
+	cName := C.CString("C_GetFunctionList")
+	defer C.free(unsafe.Pointer(cName))
+
+	fn := C.p11_dlsym(h, cName)
+	if fn == nil {
+		return nil, fmt.Errorf("pkcs11: %s has no C_GetFunctionList", path)
+	}
+
+	err = rvError("C_GetFunctionList", C.p11_get_function_list(fn, &f))
+	if err != nil {
+		return nil, err
+	}
+
+	err = rvError("C_Initialize", C.p11_initialize(f))
+	if err != nil {
+		return nil, err
+	}
+
+	modules[path] = f
+
+	return f, nil
+}
+
+// cgoToken is the token that signs with the private key in the session.
+type cgoToken struct {
+	// mu serializes the signing since a session can only run one operation
+	// at a time.
+	mu      sync.Mutex
+	f       *C.CK_FUNCTION_LIST
+	session C.CK_SESSION_HANDLE
+	key     C.CK_OBJECT_HANDLE
+}
+
+// type check
+var _ token = (*cgoToken)(nil)
+
+// sign implements the token interface for *cgoToken.
+func (t *cgoToken) sign(mech uint, pss *pssParams, data []byte) (sig []byte, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var cPSS *C.CK_RSA_PKCS_PSS_PARAMS
+	if pss != nil {
+		cPSS = &C.CK_RSA_PKCS_PSS_PARAMS{
+			hashAlg: C.CK_MECHANISM_TYPE(pss.hashAlg),
+			mgf:     C.CK_ULONG(pss.mgf),
+			sLen:    C.CK_ULONG(pss.saltLen),
+		}
+	}
+
+	var cSig *C.CK_BYTE
+	var sigLen C.CK_ULONG
+	rv := C.p11_sign(
+		t.f,
+		t.session,
+		C.CK_MECHANISM_TYPE(mech),
+		cPSS,
+		t.key,
+		(*C.CK_BYTE)(unsafe.Pointer(unsafe.SliceData(data))),
+		C.CK_ULONG(len(data)),
+		&cSig,
+		&sigLen,
+	)
+	err = rvError("C_Sign", rv)
+	if err != nil {
+		return nil, err
+	}
+
+	defer C.free(unsafe.Pointer(cSig))
+
+	return C.GoBytes(unsafe.Pointer(cSig), C.int(sigLen)), nil
+}
+
+// LoadCertificate loads the certificate and its private key from the PKCS#11
+// token.  certURI selects the module, the token, and the certificate, and its
+// PIN is used to log in.  keyURI selects the private key on the same token by
+// its object and id.  If it has neither, the key with the CKA_ID of the
+// certificate is used.
+func LoadCertificate(certURI, keyURI *URI) (cert *tls.Certificate, err error) {
+	if certURI.ModulePath == "" {
+		return nil, fmt.Errorf("pkcs11 uri requires module-path")
+	}
+
+	f, err := loadModule(certURI.ModulePath)
+	if err != nil {
+		return nil, err
+	}
+
+	slot, info, err := findSlot(f, certURI)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &cgoToken{f: f}
+	err = rvError("C_OpenSession", C.p11_open_session(f, slot, &t.session))
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = C.p11_close_session(f, t.session)
+		}
+	}()
+
+	if info.flags&C.CKF_LOGIN_REQUIRED != 0 {
+		err = t.login(certURI.PIN)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	certObj, err := t.find(C.CKO_CERTIFICATE, certURI.Object, certURI.ID)
+	if err != nil {
+		return nil, fmt.Errorf("finding certificate: %w", err)
+	}
+
+	der, err := t.attr(certObj, C.CKA_VALUE)
+	if err != nil {
+		return nil, fmt.Errorf("reading certificate: %w", err)
+	}
+
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("parsing certificate: %w", err)
+	}
+
+	switch leaf.PublicKey.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+		// Go on.
+	default:
+		return nil, fmt.Errorf("unsupported pkcs11 key type %T", leaf.PublicKey)
+	}
+
+	keyObject, keyID := keyURI.Object, keyURI.ID
+	if keyObject == "" && len(keyID) == 0 {
+		keyID, err = t.attr(certObj, C.CKA_ID)
+		if err != nil {
+			return nil, fmt.Errorf("reading certificate id: %w", err)
+		}
+	}
+
+	t.key, err = t.find(C.CKO_PRIVATE_KEY, keyObject, keyID)
+	if err != nil {
+		return nil, fmt.Errorf("finding private key: %w", err)
+	}
+
+	return &tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  &Signer{token: t, pub: leaf.PublicKey},
+		Leaf:        leaf,
+	}, nil
+}
+
+// findSlot returns the first slot with a token that matches u.
+func findSlot(f *C.CK_FUNCTION_LIST, u *URI) (slot C.CK_SLOT_ID, info *C.CK_TOKEN_INFO, err error) {
+	var n C.CK_ULONG
+	err = rvError("C_GetSlotList", C.p11_get_slot_list(f, nil, &n))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if n == 0 {
+		return 0, nil, fmt.Errorf("pkcs11: no tokens")
+	}
+
+	slots := make([]C.CK_SLOT_ID, n)
+	err = rvError("C_GetSlotList", C.p11_get_slot_list(f, &slots[0], &n))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	for _, s := range slots[:n] {
+		if u.HasSlotID && uint(s) != u.SlotID {
+			continue
+		}
+
+		info = &C.CK_TOKEN_INFO{}
+		err = rvError("C_GetTokenInfo", C.p11_get_token_info(f, s, info))
+		if err != nil {
+			return 0, nil, err
+		}
+
+		if matchField(u.Token, unsafe.Pointer(&info.label), len(info.label)) &&
+			matchField(u.Manufacturer, unsafe.Pointer(&info.manufacturerID), len(info.manufacturerID)) &&
+			matchField(u.Model, unsafe.Pointer(&info.model), len(info.model)) &&
+			matchField(u.Serial, unsafe.Pointer(&info.serialNumber), len(info.serialNumber)) {
+			return s, info, nil
+		}
+	}
+
+	return 0, nil, fmt.Errorf("pkcs11: no token matches the uri")
+}
+
+// matchField returns true if want is empty or equal to the blank-padded field
+// of CK_TOKEN_INFO of length n.
+func matchField(want string, field unsafe.Pointer, n int) (ok bool) {
+	if want == "" {
+		return true
+	}
+
+	b := C.GoBytes(field, C.int(n))
+
+	return string(bytes.TrimRight(b, " ")) == want
+}
+
+// login logs the user into the token.
+func (t *cgoToken) login(pin string) (err error) {
+	if pin == "" {
+		return fmt.Errorf("pkcs11 token requires a pin, set pin-value in the uri or use --pass")
+	}
+
+	p := []byte(pin)
+
+	return rvError("C_Login", C.p11_login(
+		t.f,
+		t.session,
+		(*C.CK_UTF8CHAR)(unsafe.Pointer(&p[0])),
+		C.CK_ULONG(len(p)),
+	))
+}
+
+// find returns the first object of the class with the label and the id.
+func (t *cgoToken) find(class C.CK_OBJECT_CLASS, label string, id []byte) (obj C.CK_OBJECT_HANDLE, err error) {
+	l := []byte(label)
+
+	var count C.CK_ULONG
+	rv := C.p11_find(
+		t.f,
+		t.session,
+		class,
+		(*C.CK_UTF8CHAR)(unsafe.Pointer(unsafe.SliceData(l))),
+		C.CK_ULONG(len(l)),
+		(*C.CK_BYTE)(unsafe.Pointer(unsafe.SliceData(id))),
+		C.CK_ULONG(len(id)),
+		&obj,
+		&count,
+	)
+	err = rvError("C_FindObjects", rv)
+	if err != nil {
+		return 0, err
+	}
+
+	if count == 0 {
+		return 0, fmt.Errorf("pkcs11: no object matches the uri")
+	}
+
+	return obj, nil
+}
+
+// attr returns the value of the attribute of the object.
+func (t *cgoToken) attr(obj C.CK_OBJECT_HANDLE, typ C.CK_ATTRIBUTE_TYPE) (val []byte, err error) {
+	var n C.CK_ULONG
+	err = rvError("C_GetAttributeValue", C.p11_get_attr(t.f, t.session, obj, typ, nil, &n))
+	if err != nil || n == 0 {
+		return nil, err
+	}
+
+	val = make([]byte, n)
+	err = rvError("C_GetAttributeValue", C.p11_get_attr(t.f, t.session, obj, typ, unsafe.Pointer(&val[0]), &n))
+	if err != nil {
+		return nil, err
+	}
+
+	return val[:n], nil
+}
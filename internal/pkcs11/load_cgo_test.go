@@ -0,0 +1,164 @@
+//go:build cgo && pkcs11
+
+package pkcs11_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ameshkov/gocurl/internal/pkcs11"
+	"github.com/stretchr/testify/require"
+)
+
+// newMockModule builds the mock module from testdata/mock.c with its
+// certificate and returns its path.
+func newMockModule(t *testing.T) (path string, leaf *x509.Certificate) {
+	t.Helper()
+
+	dir := t.TempDir()
+	path = filepath.Join(dir, "mock.so")
+	out, err := exec.Command("cc", "-shared", "-fPIC", "-I.", "-o", path, "testdata/mock.c").CombinedOutput()
+	if err != nil {
+		t.Skipf("building the mock module: %s: %s", err, out)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	certFile := filepath.Join(dir, "cert.der")
+	require.NoError(t, os.WriteFile(certFile, der, 0o600))
+	t.Setenv("GOCURL_PKCS11_MOCK_CERT", certFile)
+
+	leaf, err = x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return path, leaf
+}
+
+func TestLoadCertificate(t *testing.T) {
+	module, leaf := newMockModule(t)
+
+	testCases := []struct {
+		name    string
+		certURI string
+		keyURI  string
+		wantErr string
+	}{{
+		name:    "success",
+		certURI: "pkcs11:token=gocurl;object=client?pin-value=1234&module-path=" + module,
+		keyURI:  "",
+		wantErr: "",
+	}, {
+		name:    "key_by_cert_id",
+		certURI: "pkcs11:serial=0001?pin-value=1234&module-path=" + module,
+		keyURI:  "",
+		wantErr: "",
+	}, {
+		name:    "key_uri",
+		certURI: "pkcs11:object=client?pin-value=1234&module-path=" + module,
+		keyURI:  "pkcs11:id=%42",
+		wantErr: "",
+	}, {
+		name:    "no_module",
+		certURI: "pkcs11:object=client",
+		keyURI:  "",
+		wantErr: "pkcs11 uri requires module-path",
+	}, {
+		name:    "no_token",
+		certURI: "pkcs11:token=other?pin-value=1234&module-path=" + module,
+		keyURI:  "",
+		wantErr: "no token matches the uri",
+	}, {
+		name:    "no_cert",
+		certURI: "pkcs11:object=server?pin-value=1234&module-path=" + module,
+		keyURI:  "",
+		wantErr: "finding certificate: pkcs11: no object matches the uri",
+	}, {
+		name:    "no_key",
+		certURI: "pkcs11:object=client?pin-value=1234&module-path=" + module,
+		keyURI:  "pkcs11:id=%43",
+		wantErr: "finding private key: pkcs11: no object matches the uri",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			certURI, err := pkcs11.ParseURI(tc.certURI)
+			require.NoError(t, err)
+
+			keyURI := certURI
+			if tc.keyURI != "" {
+				keyURI, err = pkcs11.ParseURI(tc.keyURI)
+				require.NoError(t, err)
+			}
+
+			cert, err := pkcs11.LoadCertificate(certURI, keyURI)
+			if tc.wantErr != "" {
+				require.ErrorContains(t, err, tc.wantErr)
+
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, leaf.Raw, cert.Certificate[0])
+			require.Equal(t, leaf, cert.Leaf)
+
+			signer, ok := cert.PrivateKey.(crypto.Signer)
+			require.True(t, ok)
+			require.Equal(t, leaf.PublicKey, signer.Public())
+
+			// The mock prepends the mechanism, CKM_ECDSA, and zero to the
+			// data, so they are the first bytes of r.
+			digest := sha256.Sum256([]byte("test"))
+			sig, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+			require.NoError(t, err)
+
+			raw := append([]byte{0x41, 0x00}, digest[:]...)
+			want, err := asn1.Marshal(struct{ R, S *big.Int }{
+				R: new(big.Int).SetBytes(raw[:17]),
+				S: new(big.Int).SetBytes(raw[17:]),
+			})
+			require.NoError(t, err)
+			require.Equal(t, want, sig)
+		})
+	}
+}
+
+func TestLoadCertificate_pin(t *testing.T) {
+	module, _ := newMockModule(t)
+
+	u, err := pkcs11.ParseURI("pkcs11:object=client?module-path=" + module)
+	require.NoError(t, err)
+
+	// The mock keeps the login state, so the bad PINs go first.
+	_, err = pkcs11.LoadCertificate(u, u)
+	require.ErrorContains(t, err, "pkcs11 token requires a pin")
+
+	u.PIN = "0000"
+	_, err = pkcs11.LoadCertificate(u, u)
+	require.ErrorContains(t, err, "C_Login: CKR_PIN_INCORRECT")
+
+	u.PIN = "1234"
+	_, err = pkcs11.LoadCertificate(u, u)
+	require.NoError(t, err)
+}
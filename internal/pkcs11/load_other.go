@@ -0,0 +1,15 @@
+//go:build !cgo || !pkcs11
+
+package pkcs11
+
+import (
+	"crypto/tls"
+	"fmt"
+)
+
+// LoadCertificate loads the certificate and its private key from the PKCS#11
+// token.  This build can't load PKCS#11 modules, so it always returns an
+// error.
+func LoadCertificate(certURI, keyURI *URI) (cert *tls.Certificate, err error) {
+	return nil, fmt.Errorf("pkcs11 requires gocurl built with cgo and -tags pkcs11")
+}
@@ -0,0 +1,156 @@
+package pkcs11
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/asn1"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// Signing mechanisms and the MGF1 functions, see PKCS#11 Base Specification
+// v2.40.
+const (
+	ckmRSAPKCS    = 0x1
+	ckmRSAPKCSPSS = 0xd
+	ckmECDSA      = 0x1041
+	ckmSHA1       = 0x220
+	ckmSHA256     = 0x250
+	ckmSHA384     = 0x260
+	ckmSHA512     = 0x270
+
+	ckgMGF1SHA1   = 0x1
+	ckgMGF1SHA256 = 0x2
+	ckgMGF1SHA384 = 0x3
+	ckgMGF1SHA512 = 0x4
+)
+
+// pssParams are the parameters of CKM_RSA_PKCS_PSS, CK_RSA_PKCS_PSS_PARAMS.
+type pssParams struct {
+	hashAlg uint
+	mgf     uint
+	saltLen uint
+}
+
+// pssHashes maps the hashes supported by RSA-PSS to their mechanism and MGF1
+// function.
+var pssHashes = map[crypto.Hash][2]uint{
+	crypto.SHA1:   {ckmSHA1, ckgMGF1SHA1},
+	crypto.SHA256: {ckmSHA256, ckgMGF1SHA256},
+	crypto.SHA384: {ckmSHA384, ckgMGF1SHA384},
+	crypto.SHA512: {ckmSHA512, ckgMGF1SHA512},
+}
+
+// digestInfoPrefixes are the DER prefixes of the DigestInfo structures for
+// PKCS#1 v1.5 signatures, see RFC 8017, section 9.2.  CKM_RSA_PKCS only pads
+// the data, so the DigestInfo must be built here.
+var digestInfoPrefixes = map[crypto.Hash][]byte{
+	crypto.MD5SHA1: {},
+	crypto.SHA1: {
+		0x30, 0x21, 0x30, 0x09, 0x06, 0x05, 0x2b, 0x0e, 0x03, 0x02, 0x1a, 0x05,
+		0x00, 0x04, 0x14,
+	},
+	crypto.SHA224: {
+		0x30, 0x2d, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03,
+		0x04, 0x02, 0x04, 0x05, 0x00, 0x04, 0x1c,
+	},
+	crypto.SHA256: {
+		0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03,
+		0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20,
+	},
+	crypto.SHA384: {
+		0x30, 0x41, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03,
+		0x04, 0x02, 0x02, 0x05, 0x00, 0x04, 0x30,
+	},
+	crypto.SHA512: {
+		0x30, 0x51, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03,
+		0x04, 0x02, 0x03, 0x05, 0x00, 0x04, 0x40,
+	},
+}
+
+// token signs data with the private key on a PKCS#11 token.  pss is only set
+// for CKM_RSA_PKCS_PSS.
+type token interface {
+	sign(mech uint, pss *pssParams, data []byte) (sig []byte, err error)
+}
+
+// Signer is a crypto.Signer whose private key is on a PKCS#11 token.  Only RSA
+// and ECDSA keys are supported.
+type Signer struct {
+	token token
+	pub   crypto.PublicKey
+}
+
+// type check
+var _ crypto.Signer = (*Signer)(nil)
+
+// Public implements the crypto.Signer interface for *Signer.
+func (s *Signer) Public() (pub crypto.PublicKey) {
+	return s.pub
+}
+
+// Sign implements the crypto.Signer interface for *Signer.  The token uses its
+// own source of randomness, so rand is ignored.
+func (s *Signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) (sig []byte, err error) {
+	switch pub := s.pub.(type) {
+	case *rsa.PublicKey:
+		return s.signRSA(digest, opts)
+	case *ecdsa.PublicKey:
+		return s.signECDSA(digest)
+	default:
+		return nil, fmt.Errorf("unsupported pkcs11 key type %T", pub)
+	}
+}
+
+// signRSA signs the digest with either RSA-PSS or PKCS#1 v1.5.
+func (s *Signer) signRSA(digest []byte, opts crypto.SignerOpts) (sig []byte, err error) {
+	h := opts.HashFunc()
+	if pssOpts, ok := opts.(*rsa.PSSOptions); ok {
+		mechs, ok := pssHashes[h]
+		if !ok {
+			return nil, fmt.Errorf("unsupported rsa-pss hash %s", h)
+		}
+
+		saltLen := pssOpts.SaltLength
+		if saltLen == rsa.PSSSaltLengthEqualsHash || saltLen == rsa.PSSSaltLengthAuto {
+			// TLS 1.3 requires the salt to be as long as the hash.
+			saltLen = h.Size()
+		}
+
+		params := &pssParams{hashAlg: mechs[0], mgf: mechs[1], saltLen: uint(saltLen)}
+
+		return s.token.sign(ckmRSAPKCSPSS, params, digest)
+	}
+
+	prefix, ok := digestInfoPrefixes[h]
+	if !ok {
+		return nil, fmt.Errorf("unsupported rsa hash %s", h)
+	}
+
+	return s.token.sign(ckmRSAPKCS, nil, append(append([]byte{}, prefix...), digest...))
+}
+
+// signECDSA signs the digest with ECDSA and converts the signature from the
+// concatenated r and s that PKCS#11 returns into ASN.1 that TLS uses.
+func (s *Signer) signECDSA(digest []byte) (sig []byte, err error) {
+	raw, err := s.token.sign(ckmECDSA, nil, digest)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(raw) == 0 || len(raw)%2 != 0 {
+		return nil, fmt.Errorf("bad ecdsa signature length %d", len(raw))
+	}
+
+	n := len(raw) / 2
+	ecSig := struct {
+		R, S *big.Int
+	}{
+		R: new(big.Int).SetBytes(raw[:n]),
+		S: new(big.Int).SetBytes(raw[n:]),
+	}
+
+	return asn1.Marshal(ecSig)
+}
@@ -0,0 +1,117 @@
+package pkcs11
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testToken is a token that returns the data as the signature and records
+// the mechanism.
+type testToken struct {
+	pss  *pssParams
+	mech uint
+}
+
+// sign implements the token interface for *testToken.
+func (t *testToken) sign(mech uint, pss *pssParams, data []byte) (sig []byte, err error) {
+	t.mech, t.pss = mech, pss
+
+	return data, nil
+}
+
+func TestSigner(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	digest := sha256.Sum256([]byte("test"))
+
+	testCases := []struct {
+		pub      crypto.PublicKey
+		opts     crypto.SignerOpts
+		wantPSS  *pssParams
+		name     string
+		wantSig  []byte
+		wantMech uint
+	}{{
+		pub:      &rsaKey.PublicKey,
+		opts:     crypto.SHA256,
+		wantPSS:  nil,
+		name:     "rsa_pkcs1",
+		wantSig:  append(append([]byte{}, digestInfoPrefixes[crypto.SHA256]...), digest[:]...),
+		wantMech: ckmRSAPKCS,
+	}, {
+		pub:      &rsaKey.PublicKey,
+		opts:     &rsa.PSSOptions{Hash: crypto.SHA256, SaltLength: rsa.PSSSaltLengthEqualsHash},
+		wantPSS:  &pssParams{hashAlg: ckmSHA256, mgf: ckgMGF1SHA256, saltLen: 32},
+		name:     "rsa_pss",
+		wantSig:  digest[:],
+		wantMech: ckmRSAPKCSPSS,
+	}, {
+		pub:      &rsaKey.PublicKey,
+		opts:     &rsa.PSSOptions{Hash: crypto.SHA256, SaltLength: 20},
+		wantPSS:  &pssParams{hashAlg: ckmSHA256, mgf: ckgMGF1SHA256, saltLen: 20},
+		name:     "rsa_pss_salt",
+		wantSig:  digest[:],
+		wantMech: ckmRSAPKCSPSS,
+	}, {
+		pub:     &ecKey.PublicKey,
+		opts:    crypto.SHA256,
+		wantPSS: nil,
+		name:    "ecdsa",
+		wantSig: func() (sig []byte) {
+			sig, _ = asn1.Marshal(struct{ R, S *big.Int }{
+				R: new(big.Int).SetBytes(digest[:16]),
+				S: new(big.Int).SetBytes(digest[16:]),
+			})
+
+			return sig
+		}(),
+		wantMech: ckmECDSA,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tok := &testToken{}
+			s := &Signer{token: tok, pub: tc.pub}
+
+			sig, sErr := s.Sign(rand.Reader, digest[:], tc.opts)
+			require.NoError(t, sErr)
+			require.Equal(t, tc.wantSig, sig)
+			require.Equal(t, tc.wantMech, tok.mech)
+			require.Equal(t, tc.wantPSS, tok.pss)
+			require.Equal(t, tc.pub, s.Public())
+		})
+	}
+}
+
+func TestSigner_errors(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	s := &Signer{token: &testToken{}, pub: &rsaKey.PublicKey}
+	_, err = s.Sign(rand.Reader, make([]byte, 28), crypto.SHA3_224)
+	require.ErrorContains(t, err, "unsupported rsa hash")
+
+	_, err = s.Sign(rand.Reader, make([]byte, 28), &rsa.PSSOptions{Hash: crypto.SHA224})
+	require.ErrorContains(t, err, "unsupported rsa-pss hash")
+
+	// An odd length can't be split into r and s.
+	s = &Signer{token: &testToken{}, pub: &ecKey.PublicKey}
+	_, err = s.Sign(rand.Reader, make([]byte, 31), crypto.SHA256)
+	require.ErrorContains(t, err, "bad ecdsa signature length 31")
+}
@@ -0,0 +1,265 @@
+/*
+ * A mock PKCS#11 module for the tests.  It has one token "gocurl" with the PIN
+ * "1234", and a certificate and a private key with the label "client" and the
+ * id 0x42.  The certificate is read from the file in GOCURL_PKCS11_MOCK_CERT.
+ * The "signature" is the low byte of the mechanism, the low byte of the PSS
+ * hash mechanism or zero, and the signed data.
+ *
+ *	cc -shared -fPIC -I.. -o mock.so mock.c
+ */
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+
+#include "cryptoki.h"
+
+#define MOCK_SLOT 7
+#define MOCK_SESSION 1
+#define MOCK_CERT 10
+#define MOCK_KEY 20
+
+static unsigned char cert[8192];
+static CK_ULONG certLen;
+static int loggedIn;
+static CK_OBJECT_HANDLE found;
+static CK_MECHANISM_TYPE signMech;
+static CK_MECHANISM_TYPE signHash;
+static const unsigned char id[] = {0x42};
+
+static CK_RV mock_initialize(void *args) {
+	(void)args;
+
+	const char *path = getenv("GOCURL_PKCS11_MOCK_CERT");
+	FILE *f = path == NULL ? NULL : fopen(path, "rb");
+	if (f == NULL) {
+		return CKR_GENERAL_ERROR;
+	}
+
+	certLen = fread(cert, 1, sizeof(cert), f);
+	fclose(f);
+
+	return CKR_OK;
+}
+
+static CK_RV mock_finalize(void *reserved) {
+	(void)reserved;
+
+	return CKR_OK;
+}
+
+static CK_RV mock_get_slot_list(CK_BBOOL present, CK_SLOT_ID *slots, CK_ULONG *n) {
+	(void)present;
+
+	if (slots != NULL) {
+		if (*n < 1) {
+			return 0x150; // CKR_BUFFER_TOO_SMALL
+		}
+
+		slots[0] = MOCK_SLOT;
+	}
+
+	*n = 1;
+
+	return CKR_OK;
+}
+
+static void pad(CK_UTF8CHAR *dst, size_t n, const char *s) {
+	memset(dst, ' ', n);
+	memcpy(dst, s, strlen(s));
+}
+
+static CK_RV mock_get_token_info(CK_SLOT_ID slot, CK_TOKEN_INFO *info) {
+	if (slot != MOCK_SLOT) {
+		return 0x003; // CKR_SLOT_ID_INVALID
+	}
+
+	memset(info, 0, sizeof(*info));
+	pad(info->label, sizeof(info->label), "gocurl");
+	pad(info->manufacturerID, sizeof(info->manufacturerID), "mock");
+	pad(info->model, sizeof(info->model), "mock");
+	pad(info->serialNumber, sizeof(info->serialNumber), "0001");
+	info->flags = CKF_LOGIN_REQUIRED;
+
+	return CKR_OK;
+}
+
+static CK_RV mock_open_session(CK_SLOT_ID slot, CK_FLAGS flags, void *app, void *notify, CK_SESSION_HANDLE *s) {
+	(void)flags;
+	(void)app;
+	(void)notify;
+
+	if (slot != MOCK_SLOT) {
+		return 0x003; // CKR_SLOT_ID_INVALID
+	}
+
+	*s = MOCK_SESSION;
+
+	return CKR_OK;
+}
+
+static CK_RV mock_close_session(CK_SESSION_HANDLE s) {
+	(void)s;
+
+	return CKR_OK;
+}
+
+static CK_RV mock_login(CK_SESSION_HANDLE s, CK_USER_TYPE user, CK_UTF8CHAR *pin, CK_ULONG pinLen) {
+	(void)s;
+	(void)user;
+
+	if (loggedIn) {
+		return CKR_USER_ALREADY_LOGGED_IN;
+	}
+
+	if (pinLen != 4 || memcmp(pin, "1234", 4) != 0) {
+		return 0x0a0; // CKR_PIN_INCORRECT
+	}
+
+	loggedIn = 1;
+
+	return CKR_OK;
+}
+
+static CK_RV mock_get_attribute_value(CK_SESSION_HANDLE s, CK_OBJECT_HANDLE obj, CK_ATTRIBUTE *tmpl, CK_ULONG n) {
+	(void)s;
+
+	for (CK_ULONG i = 0; i < n; i++) {
+		const void *val;
+		CK_ULONG len;
+		if (tmpl[i].type == CKA_VALUE && obj == MOCK_CERT) {
+			val = cert;
+			len = certLen;
+		} else if (tmpl[i].type == CKA_ID) {
+			val = id;
+			len = sizeof(id);
+		} else {
+			return 0x012; // CKR_ATTRIBUTE_TYPE_INVALID
+		}
+
+		if (tmpl[i].pValue != NULL) {
+			if (tmpl[i].ulValueLen < len) {
+				return 0x150; // CKR_BUFFER_TOO_SMALL
+			}
+
+			memcpy(tmpl[i].pValue, val, len);
+		}
+
+		tmpl[i].ulValueLen = len;
+	}
+
+	return CKR_OK;
+}
+
+static CK_RV mock_find_objects_init(CK_SESSION_HANDLE s, CK_ATTRIBUTE *tmpl, CK_ULONG n) {
+	(void)s;
+
+	CK_OBJECT_CLASS cls = 0;
+	int match = 1;
+	for (CK_ULONG i = 0; i < n; i++) {
+		switch (tmpl[i].type) {
+		case CKA_CLASS:
+			cls = *(CK_OBJECT_CLASS *)tmpl[i].pValue;
+			break;
+		case CKA_LABEL:
+			match &= tmpl[i].ulValueLen == 6 && memcmp(tmpl[i].pValue, "client", 6) == 0;
+			break;
+		case CKA_ID:
+			match &= tmpl[i].ulValueLen == sizeof(id) && memcmp(tmpl[i].pValue, id, sizeof(id)) == 0;
+			break;
+		default:
+			match = 0;
+		}
+	}
+
+	found = 0;
+	if (match && cls == CKO_CERTIFICATE) {
+		found = MOCK_CERT;
+	} else if (match && cls == CKO_PRIVATE_KEY && loggedIn) {
+		found = MOCK_KEY;
+	}
+
+	return CKR_OK;
+}
+
+static CK_RV mock_find_objects(CK_SESSION_HANDLE s, CK_OBJECT_HANDLE *obj, CK_ULONG max, CK_ULONG *count) {
+	(void)s;
+
+	*count = 0;
+	if (found != 0 && max > 0) {
+		obj[0] = found;
+		*count = 1;
+		found = 0;
+	}
+
+	return CKR_OK;
+}
+
+static CK_RV mock_find_objects_final(CK_SESSION_HANDLE s) {
+	(void)s;
+
+	return CKR_OK;
+}
+
+static CK_RV mock_sign_init(CK_SESSION_HANDLE s, CK_MECHANISM *mech, CK_OBJECT_HANDLE key) {
+	(void)s;
+
+	if (key != MOCK_KEY) {
+		return 0x060; // CKR_KEY_HANDLE_INVALID
+	}
+
+	signMech = mech->mechanism;
+	signHash = 0;
+	if (mech->pParameter != NULL) {
+		if (mech->ulParameterLen != sizeof(CK_RSA_PKCS_PSS_PARAMS)) {
+			return 0x071; // CKR_MECHANISM_PARAM_INVALID
+		}
+
+		signHash = ((CK_RSA_PKCS_PSS_PARAMS *)mech->pParameter)->hashAlg;
+	}
+
+	return CKR_OK;
+}
+
+static CK_RV mock_sign(CK_SESSION_HANDLE s, CK_BYTE *data, CK_ULONG dataLen, CK_BYTE *sig, CK_ULONG *sigLen) {
+	(void)s;
+
+	CK_ULONG n = dataLen + 2;
+	if (sig != NULL) {
+		if (*sigLen < n) {
+			return 0x150; // CKR_BUFFER_TOO_SMALL
+		}
+
+		sig[0] = (CK_BYTE)signMech;
+		sig[1] = (CK_BYTE)signHash;
+		memcpy(sig + 2, data, dataLen);
+	}
+
+	*sigLen = n;
+
+	return CKR_OK;
+}
+
+static CK_FUNCTION_LIST functions;
+
+CK_RV C_GetFunctionList(CK_FUNCTION_LIST **list) {
+	functions.version.major = 2;
+	functions.version.minor = 40;
+	functions.C_Initialize = mock_initialize;
+	functions.C_Finalize = mock_finalize;
+	functions.C_GetFunctionList = C_GetFunctionList;
+	functions.C_GetSlotList = mock_get_slot_list;
+	functions.C_GetTokenInfo = mock_get_token_info;
+	functions.C_OpenSession = mock_open_session;
+	functions.C_CloseSession = mock_close_session;
+	functions.C_Login = mock_login;
+	functions.C_GetAttributeValue = mock_get_attribute_value;
+	functions.C_FindObjectsInit = mock_find_objects_init;
+	functions.C_FindObjects = mock_find_objects;
+	functions.C_FindObjectsFinal = mock_find_objects_final;
+	functions.C_SignInit = mock_sign_init;
+	functions.C_Sign = mock_sign;
+
+	*list = &functions;
+
+	return CKR_OK;
+}
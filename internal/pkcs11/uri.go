@@ -0,0 +1,225 @@
+// Package pkcs11 loads TLS client certificates whose private keys never leave
+// a PKCS#11 token, e.g. a smart card or an HSM (see --cert pkcs11:...).
+//
+// The module (shared library) of the token can only be loaded with cgo, so the
+// loader is only built with the pkcs11 build tag:
+//
+//	CGO_ENABLED=1 go build -tags pkcs11
+//
+// Parsing the URIs and formatting the signatures is pure Go and is always
+// built.
+package pkcs11
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Scheme is the prefix of the PKCS#11 URIs.
+const Scheme = "pkcs11:"
+
+// IsURI returns true if s is a PKCS#11 URI.
+func IsURI(s string) (ok bool) {
+	return strings.HasPrefix(s, Scheme)
+}
+
+// URI is a PKCS#11 URI, see RFC 7512.  Only the attributes that identify the
+// token and the objects on it are supported.
+type URI struct {
+	// ModulePath is the path to the PKCS#11 module of the token, the
+	// module-path query attribute.
+	ModulePath string
+
+	// Token is the label of the token.
+	Token string
+
+	// Manufacturer is the manufacturer ID of the token.
+	Manufacturer string
+
+	// Model is the model of the token.
+	Model string
+
+	// Serial is the serial number of the token.
+	Serial string
+
+	// Object is the label (CKA_LABEL) of the object.
+	Object string
+
+	// ID is the CKA_ID of the object.
+	ID []byte
+
+	// PIN is the user PIN of the token from either the pin-value or the
+	// pin-source query attribute.
+	PIN string
+
+	// SlotID is the ID of the slot, only used if HasSlotID is true.
+	SlotID uint
+
+	// HasSlotID is true if the URI has the slot-id attribute.
+	HasSlotID bool
+}
+
+// ParseURI parses a PKCS#11 URI.  Unlike in RFC 7512, unknown attributes are
+// an error instead of matching nothing, so that a typo doesn't result in
+// a confusing "not found" error.
+func ParseURI(s string) (u *URI, err error) {
+	if !IsURI(s) {
+		return nil, fmt.Errorf("pkcs11 uri must start with %q", Scheme)
+	}
+
+	path, query, _ := strings.Cut(strings.TrimPrefix(s, Scheme), "?")
+
+	u = &URI{}
+	seen := map[string]bool{}
+	for _, attr := range splitAttrs(path, ";") {
+		err = u.setPathAttr(attr, seen)
+		if err != nil {
+			return nil, fmt.Errorf("parsing pkcs11 uri: %w", err)
+		}
+	}
+
+	for _, attr := range splitAttrs(query, "&") {
+		err = u.setQueryAttr(attr, seen)
+		if err != nil {
+			return nil, fmt.Errorf("parsing pkcs11 uri: %w", err)
+		}
+	}
+
+	return u, nil
+}
+
+// splitAttrs splits the attributes of the path or of the query by sep and
+// skips the empty ones.
+func splitAttrs(s, sep string) (attrs []string) {
+	for _, a := range strings.Split(s, sep) {
+		if a != "" {
+			attrs = append(attrs, a)
+		}
+	}
+
+	return attrs
+}
+
+// parseAttr splits the attribute into its name and the percent-decoded value.
+// An attribute can only be used once.
+func parseAttr(attr string, seen map[string]bool) (name, value string, err error) {
+	name, value, ok := strings.Cut(attr, "=")
+	if !ok {
+		return "", "", fmt.Errorf("attribute %q has no value", attr)
+	}
+
+	if seen[name] {
+		return "", "", fmt.Errorf("duplicate attribute %q", name)
+	}
+
+	seen[name] = true
+
+	value, err = url.PathUnescape(value)
+	if err != nil {
+		return "", "", fmt.Errorf("attribute %q: %w", name, err)
+	}
+
+	return name, value, nil
+}
+
+// setPathAttr sets the field of u that corresponds to the path attribute.
+func (u *URI) setPathAttr(attr string, seen map[string]bool) (err error) {
+	name, value, err := parseAttr(attr, seen)
+	if err != nil {
+		return err
+	}
+
+	switch name {
+	case "token":
+		u.Token = value
+	case "manufacturer":
+		u.Manufacturer = value
+	case "model":
+		u.Model = value
+	case "serial":
+		u.Serial = value
+	case "object":
+		u.Object = value
+	case "id":
+		u.ID = []byte(value)
+	case "slot-id":
+		var id uint64
+		id, err = strconv.ParseUint(value, 10, 0)
+		if err != nil {
+			return fmt.Errorf("attribute %q: %w", name, err)
+		}
+
+		u.SlotID, u.HasSlotID = uint(id), true
+	case "type":
+		// The object class is determined by what is loaded, a certificate or
+		// a private key, so only validate it.
+		switch value {
+		case "cert", "private", "public", "secret-key", "data":
+			// Go on.
+		default:
+			return fmt.Errorf("unsupported object type %q", value)
+		}
+	case "library-manufacturer", "library-description", "library-version":
+		// There is only one module, so these are ignored.
+	default:
+		return fmt.Errorf("unsupported attribute %q", name)
+	}
+
+	return nil
+}
+
+// setQueryAttr sets the field of u that corresponds to the query attribute.
+func (u *URI) setQueryAttr(attr string, seen map[string]bool) (err error) {
+	name, value, err := parseAttr(attr, seen)
+	if err != nil {
+		return err
+	}
+
+	switch name {
+	case "module-path":
+		u.ModulePath = value
+	case "pin-value":
+		if seen["pin-source"] {
+			return fmt.Errorf("pin-value can't be used with pin-source")
+		}
+
+		u.PIN = value
+	case "pin-source":
+		if seen["pin-value"] {
+			return fmt.Errorf("pin-source can't be used with pin-value")
+		}
+
+		return u.readPIN(value)
+	default:
+		return fmt.Errorf("unsupported attribute %q", name)
+	}
+
+	return nil
+}
+
+// readPIN reads the PIN from the pin-source file, which is either a path or
+// a file: URI.  The trailing newline is dropped.
+func (u *URI) readPIN(source string) (err error) {
+	path := source
+	if strings.HasPrefix(source, "file:") {
+		var fileURL *url.URL
+		fileURL, err = url.Parse(source)
+		if err != nil {
+			return fmt.Errorf("pin-source: %w", err)
+		}
+
+		path = fileURL.Path
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("pin-source: %w", err)
+	}
+
+	u.PIN = strings.TrimRight(string(b), "\r\n")
+
+	return nil
+}
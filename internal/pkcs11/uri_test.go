@@ -0,0 +1,109 @@
+package pkcs11_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ameshkov/gocurl/internal/pkcs11"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseURI(t *testing.T) {
+	pinFile := filepath.Join(t.TempDir(), "pin")
+	require.NoError(t, os.WriteFile(pinFile, []byte("5678\n"), 0o600))
+
+	testCases := []struct {
+		want    *pkcs11.URI
+		name    string
+		uri     string
+		wantErr string
+	}{{
+		want: &pkcs11.URI{
+			ModulePath: "/usr/lib/softhsm/libsofthsm2.so",
+			Token:      "My Token",
+			Object:     "client",
+			ID:         []byte{0x01, 0xab},
+			PIN:        "1234",
+		},
+		name: "full",
+		uri: "pkcs11:token=My%20Token;object=client;id=%01%ab;type=cert" +
+			"?module-path=/usr/lib/softhsm/libsofthsm2.so&pin-value=1234",
+		wantErr: "",
+	}, {
+		want: &pkcs11.URI{
+			Manufacturer: "ACME",
+			Model:        "Key",
+			Serial:       "0001",
+			SlotID:       3,
+			HasSlotID:    true,
+		},
+		name:    "token_attributes",
+		uri:     "pkcs11:manufacturer=ACME;model=Key;serial=0001;slot-id=3;library-version=1",
+		wantErr: "",
+	}, {
+		want:    &pkcs11.URI{PIN: "5678"},
+		name:    "pin_source",
+		uri:     "pkcs11:?pin-source=file:" + pinFile,
+		wantErr: "",
+	}, {
+		want:    &pkcs11.URI{},
+		name:    "empty",
+		uri:     "pkcs11:",
+		wantErr: "",
+	}, {
+		want:    nil,
+		name:    "not_pkcs11",
+		uri:     "cert.pem",
+		wantErr: `pkcs11 uri must start with "pkcs11:"`,
+	}, {
+		want:    nil,
+		name:    "unknown_attribute",
+		uri:     "pkcs11:label=client",
+		wantErr: `unsupported attribute "label"`,
+	}, {
+		want:    nil,
+		name:    "duplicate_attribute",
+		uri:     "pkcs11:object=a;object=b",
+		wantErr: `duplicate attribute "object"`,
+	}, {
+		want:    nil,
+		name:    "no_value",
+		uri:     "pkcs11:object",
+		wantErr: `attribute "object" has no value`,
+	}, {
+		want:    nil,
+		name:    "bad_type",
+		uri:     "pkcs11:type=key",
+		wantErr: `unsupported object type "key"`,
+	}, {
+		want:    nil,
+		name:    "bad_slot_id",
+		uri:     "pkcs11:slot-id=x",
+		wantErr: `attribute "slot-id"`,
+	}, {
+		want:    nil,
+		name:    "bad_escape",
+		uri:     "pkcs11:id=%zz",
+		wantErr: `attribute "id"`,
+	}, {
+		want:    nil,
+		name:    "both_pins",
+		uri:     "pkcs11:?pin-value=1&pin-source=" + pinFile,
+		wantErr: "pin-source can't be used with pin-value",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			u, err := pkcs11.ParseURI(tc.uri)
+			if tc.wantErr != "" {
+				require.ErrorContains(t, err, tc.wantErr)
+
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tc.want, u)
+		})
+	}
+}
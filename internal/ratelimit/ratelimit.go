@@ -0,0 +1,54 @@
+// Package ratelimit implements helpers that limit the throughput of data
+// streams.
+package ratelimit
+
+import (
+	"io"
+	"time"
+)
+
+// Reader is an io.Reader that limits the rate at which the data is read from
+// the underlying reader.
+type Reader struct {
+	r     io.Reader
+	start time.Time
+	rate  int64
+	read  int64
+}
+
+// type check
+var _ io.Reader = (*Reader)(nil)
+
+// NewReader creates a new *Reader that reads from r at most rate bytes per
+// second.  rate must be positive.
+func NewReader(r io.Reader, rate int64) (rr *Reader) {
+	return &Reader{
+		r:    r,
+		rate: rate,
+	}
+}
+
+// Read implements the io.Reader interface for *Reader.
+func (r *Reader) Read(p []byte) (n int, err error) {
+	if r.start.IsZero() {
+		r.start = time.Now()
+	}
+
+	// Do not read more than the rate allows per 100ms so that the data is
+	// sent evenly.
+	chunk := max(r.rate/10, 1)
+	if int64(len(p)) > chunk {
+		p = p[:chunk]
+	}
+
+	n, err = r.r.Read(p)
+	r.read += int64(n)
+
+	// Sleep until the moment when the data that was read so far is allowed.
+	allowedAt := r.start.Add(time.Duration(r.read * int64(time.Second) / r.rate))
+	if d := time.Until(allowedAt); d > 0 {
+		time.Sleep(d)
+	}
+
+	return n, err
+}
@@ -0,0 +1,26 @@
+package ratelimit_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/ameshkov/gocurl/internal/ratelimit"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReader(t *testing.T) {
+	data := bytes.Repeat([]byte{'a'}, 1000)
+	r := ratelimit.NewReader(bytes.NewReader(data), 5000)
+
+	start := time.Now()
+	b, err := io.ReadAll(r)
+	elapsed := time.Since(start)
+
+	require.NoError(t, err)
+	require.Equal(t, data, b)
+
+	// 1000 bytes at 5000 bytes per second take at least 200ms.
+	require.GreaterOrEqual(t, elapsed, 190*time.Millisecond)
+}
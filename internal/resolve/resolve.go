@@ -4,6 +4,8 @@ package resolve
 import (
 	"fmt"
 	"net"
+	"strings"
+	"time"
 
 	"github.com/AdguardTeam/dnsproxy/upstream"
 	"github.com/AdguardTeam/golibs/errors"
@@ -23,6 +25,9 @@ const ErrNoResolvers = errors.Error("no resolvers")
 // ErrInvalidResolver means that the configured resolver is invalid.
 const ErrInvalidResolver = errors.Error("invalid resolver")
 
+// ErrTimeout means that resolving took longer than allowed by --dns-timeout.
+const ErrTimeout = errors.Error("dns timeout")
+
 // Resolver is a structure that is used whenever DNS resolution is required.
 //
 // TODO(ameshkov): Add --resolve parameter support.
@@ -55,8 +60,62 @@ func NewResolver(cfg *config.Config, out *output.Output) (r *Resolver, err error
 	}, nil
 }
 
-// LookupHost looks up all IP addresses of the hostname.
+// LookupHost looks up all IP addresses of the hostname.  If the hostname is
+// mapped to another host name by --resolve, that host name is resolved
+// instead.
 func (r *Resolver) LookupHost(hostname string) (ipAddresses []net.IP, err error) {
+	target := hostname
+	if t, ok := r.targetFromCfg(hostname); ok {
+		r.out.Debug("Resolving %s instead of %s due to --resolve", t, hostname)
+
+		// Targets are not followed recursively to avoid loops.
+		target = t
+	}
+
+	return withTimeout(r.cfg.DNSTimeout, hostname, func() (addrs []net.IP, lookupErr error) {
+		return r.lookupHost(target)
+	})
+}
+
+// withTimeout calls lookup and returns its result.  If timeout is not zero and
+// lookup takes longer, it returns ErrTimeout without waiting for lookup to
+// finish.
+func withTimeout[T any](
+	timeout time.Duration,
+	hostname string,
+	lookup func() (res T, err error),
+) (res T, err error) {
+	if timeout == 0 {
+		return lookup()
+	}
+
+	type result struct {
+		res T
+		err error
+	}
+
+	// The channel is buffered so that the goroutine does not leak when the
+	// timeout is reached.
+	resCh := make(chan result, 1)
+	go func() {
+		r, lookupErr := lookup()
+		resCh <- result{res: r, err: lookupErr}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case r := <-resCh:
+		return r.res, r.err
+	case <-timer.C:
+		return res, fmt.Errorf("resolving %s: %w after %s", hostname, ErrTimeout, timeout)
+	}
+}
+
+// lookupHost looks up all IP addresses of the hostname without checking
+// cfg.ResolveHosts.
+func (r *Resolver) lookupHost(hostname string) (ipAddresses []net.IP, err error) {
 	r.out.Debug("Resolving IP addresses of %s", hostname)
 
 	ip := net.ParseIP(hostname)
@@ -136,6 +195,14 @@ func (r *Resolver) LookupECHConfigs(hostname string) (echConfigs []ctls.ECHConfi
 		return r.cfg.ECHConfigs, nil
 	}
 
+	return withTimeout(r.cfg.DNSTimeout, hostname, func() (configs []ctls.ECHConfig, lookupErr error) {
+		return r.lookupECHConfigs(hostname)
+	})
+}
+
+// lookupECHConfigs looks up ECH configurations in the HTTPS records of
+// hostname.
+func (r *Resolver) lookupECHConfigs(hostname string) (echConfigs []ctls.ECHConfig, err error) {
 	m := newMsg(hostname, dns.TypeHTTPS)
 
 	var resp *dns.Msg
@@ -176,9 +243,10 @@ func (r *Resolver) LookupECHConfigs(hostname string) (echConfigs []ctls.ECHConfi
 }
 
 // lookupFromCfg checks if IP address for hostname are specified in the
-// configuration.
+// configuration.  --resolve for the host has priority over the hosts file,
+// which has priority over the --resolve wildcard.
 func (r *Resolver) lookupFromCfg(hostname string) (addrs []net.IP, ok bool) {
-	if len(r.cfg.Resolve) == 0 {
+	if len(r.cfg.Resolve) == 0 && len(r.cfg.Hosts) == 0 {
 		return nil, false
 	}
 
@@ -186,6 +254,10 @@ func (r *Resolver) lookupFromCfg(hostname string) (addrs []net.IP, ok bool) {
 		return addrs, ok
 	}
 
+	if addrs, ok = r.lookupHostsFile(hostname); ok {
+		return addrs, ok
+	}
+
 	if addrs, ok = r.cfg.Resolve["*"]; ok {
 		return addrs, ok
 	}
@@ -193,6 +265,37 @@ func (r *Resolver) lookupFromCfg(hostname string) (addrs []net.IP, ok bool) {
 	return nil, false
 }
 
+// lookupHostsFile returns the IP addresses of hostname from the hosts file,
+// see --hosts-file.
+func (r *Resolver) lookupHostsFile(hostname string) (addrs []net.IP, ok bool) {
+	addrs, ok = r.cfg.Hosts[strings.ToLower(strings.TrimSuffix(hostname, "."))]
+
+	return addrs, ok
+}
+
+// targetFromCfg checks if hostname is mapped to another host name in the
+// configuration.
+func (r *Resolver) targetFromCfg(hostname string) (target string, ok bool) {
+	if target, ok = r.cfg.ResolveHosts[hostname]; ok {
+		return target, ok
+	}
+
+	// Explicit IP addresses for the hostname have priority over the wildcard.
+	if _, ok = r.cfg.Resolve[hostname]; ok {
+		return "", false
+	}
+
+	if _, ok = r.lookupHostsFile(hostname); ok {
+		return "", false
+	}
+
+	if target, ok = r.cfg.ResolveHosts["*"]; ok && target != hostname {
+		return target, ok
+	}
+
+	return "", false
+}
+
 // dnsLookupAll sends the query m to each DNS resolver until it gets
 // a successful non-empty response.  If all attempts are unsuccessful, returns
 // an error.
@@ -124,3 +124,22 @@ func TestResolver_LookupECHConfigs_empty(t *testing.T) {
 	require.ErrorIs(t, err, resolve.ErrEmptyResponse)
 	require.Empty(t, echConfigs)
 }
+
+func TestResolver_LookupHost_preConfiguredHost(t *testing.T) {
+	out, err := output.NewOutput("", false)
+	require.NoError(t, err)
+
+	r, err := resolve.NewResolver(&config.Config{
+		Resolve: map[string][]net.IP{
+			"staging.example.org": {{127, 0, 0, 1}},
+		},
+		ResolveHosts: map[string]string{
+			"example.org": "staging.example.org",
+		},
+	}, out)
+	require.NoError(t, err)
+
+	addrs, err := r.LookupHost("example.org")
+	require.NoError(t, err)
+	require.Equal(t, []net.IP{{127, 0, 0, 1}}, addrs)
+}
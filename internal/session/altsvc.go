@@ -0,0 +1,129 @@
+package session
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultAltSvcMaxAge is the freshness lifetime of an alternative service
+// without the ma parameter, see RFC 7838, section 3.1.
+const defaultAltSvcMaxAge = 24 * time.Hour
+
+// altSvcEntry is an alternative service advertised by an origin.
+type altSvcEntry struct {
+	// Protocol is the ALPN protocol identifier of the alternative, e.g. "h3".
+	Protocol string `json:"protocol"`
+
+	// Authority is the host and port of the alternative, the host may be
+	// empty which means the same host as the origin.
+	Authority string `json:"authority"`
+
+	// Expires is the time when the alternative becomes stale.
+	Expires time.Time `json:"expires"`
+}
+
+// SetAltSvc saves the alternative services from the Alt-Svc header of resp,
+// see RFC 7838.  Only the first HTTP/3 alternative is saved.
+func (s *Session) SetAltSvc(resp *http.Response) {
+	v := resp.Header.Get("Alt-Svc")
+	if v == "" || resp.Request == nil {
+		return
+	}
+
+	origin := originOf(resp.Request.URL)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if strings.TrimSpace(v) == "clear" {
+		delete(s.data.AltSvc, origin)
+
+		return
+	}
+
+	e := parseAltSvc(v, time.Now())
+	if e == nil {
+		return
+	}
+
+	if s.data.AltSvc == nil {
+		s.data.AltSvc = map[string]*altSvcEntry{}
+	}
+
+	s.data.AltSvc[origin] = e
+}
+
+// HTTP3 returns true if the origin of u advertised HTTP/3 on the same host
+// and port and the advertisement is not stale.
+func (s *Session) HTTP3(u *url.URL) (ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := s.data.AltSvc[originOf(u)]
+	if e == nil || !e.Expires.After(time.Now()) {
+		return false
+	}
+
+	host, port, err := net.SplitHostPort(e.Authority)
+	if err != nil {
+		return false
+	}
+
+	return (host == "" || host == u.Hostname()) && port == portOf(u)
+}
+
+// parseAltSvc returns the first HTTP/3 alternative from the Alt-Svc header
+// value v.  now is the time when the response was received.
+func parseAltSvc(v string, now time.Time) (e *altSvcEntry) {
+	for _, alt := range strings.Split(v, ",") {
+		params := strings.Split(alt, ";")
+
+		proto, authority, ok := strings.Cut(strings.TrimSpace(params[0]), "=")
+		if !ok || proto != "h3" {
+			continue
+		}
+
+		e = &altSvcEntry{
+			Protocol:  proto,
+			Authority: strings.Trim(authority, `"`),
+			Expires:   now.Add(defaultAltSvcMaxAge),
+		}
+
+		for _, p := range params[1:] {
+			name, val, _ := strings.Cut(strings.TrimSpace(p), "=")
+			if name != "ma" {
+				continue
+			}
+
+			if ma, err := strconv.ParseInt(strings.Trim(val, `"`), 10, 64); err == nil && ma >= 0 {
+				e.Expires = now.Add(time.Duration(ma) * time.Second)
+			}
+		}
+
+		return e
+	}
+
+	return nil
+}
+
+// originOf returns the origin of u, e.g. "https://example.org:443".
+func originOf(u *url.URL) (origin string) {
+	return u.Scheme + "://" + net.JoinHostPort(u.Hostname(), portOf(u))
+}
+
+// portOf returns the port of u or the default port of its scheme.
+func portOf(u *url.URL) (port string) {
+	if port = u.Port(); port != "" {
+		return port
+	}
+
+	if u.Scheme == "http" || u.Scheme == "ws" {
+		return "80"
+	}
+
+	return "443"
+}
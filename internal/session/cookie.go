@@ -0,0 +1,112 @@
+package session
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// cookieEntry is a cookie saved in the session file.
+type cookieEntry struct {
+	// URL is the URL of the response that set the cookie.
+	URL string `json:"url"`
+
+	// Cookie is the cookie.  Max-Age is converted to Expires so that the
+	// cookie expires at the right time in later invocations.
+	Cookie *http.Cookie `json:"cookie"`
+}
+
+// sessionJar is the http.CookieJar that saves the cookies to the session.
+type sessionJar struct {
+	s *Session
+}
+
+// type check
+var _ http.CookieJar = (*sessionJar)(nil)
+
+// SetCookies implements the http.CookieJar interface for *sessionJar.
+func (j *sessionJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.s.jar.SetCookies(u, cookies)
+
+	j.s.mu.Lock()
+	defer j.s.mu.Unlock()
+
+	now := time.Now()
+	for _, c := range cookies {
+		j.s.addCookie(u, c, now)
+	}
+}
+
+// Cookies implements the http.CookieJar interface for *sessionJar.
+func (j *sessionJar) Cookies(u *url.URL) (cookies []*http.Cookie) {
+	return j.s.jar.Cookies(u)
+}
+
+// addCookie saves the cookie c set by the response from u.  It replaces the
+// saved cookie with the same name, domain and path.  s.mu must be locked.
+func (s *Session) addCookie(u *url.URL, c *http.Cookie, now time.Time) {
+	saved := *c
+	saved.Raw = ""
+	if saved.MaxAge > 0 {
+		saved.Expires = now.Add(time.Duration(saved.MaxAge) * time.Second)
+		saved.MaxAge = 0
+	}
+
+	e := &cookieEntry{
+		URL:    (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: u.Path}).String(),
+		Cookie: &saved,
+	}
+
+	expired := c.MaxAge < 0 || (!saved.Expires.IsZero() && !saved.Expires.After(now))
+
+	entries := s.data.Cookies[:0]
+	for _, old := range s.data.Cookies {
+		if !sameCookie(old, e) {
+			entries = append(entries, old)
+		}
+	}
+
+	if !expired {
+		entries = append(entries, e)
+	}
+
+	s.data.Cookies = entries
+}
+
+// loadCookies puts the saved cookies that are not expired into the jar.
+func (s *Session) loadCookies(now time.Time) {
+	entries := s.data.Cookies[:0]
+	for _, e := range s.data.Cookies {
+		u, err := url.Parse(e.URL)
+		if err != nil || e.Cookie == nil {
+			continue
+		}
+
+		if !e.Cookie.Expires.IsZero() && !e.Cookie.Expires.After(now) {
+			continue
+		}
+
+		s.jar.SetCookies(u, []*http.Cookie{e.Cookie})
+		entries = append(entries, e)
+	}
+
+	s.data.Cookies = entries
+}
+
+// sameCookie returns true if a and b are the same cookie, i.e. the newer one
+// replaces the older one.
+func sameCookie(a, b *cookieEntry) (ok bool) {
+	if a.Cookie.Name != b.Cookie.Name || a.Cookie.Domain != b.Cookie.Domain || a.Cookie.Path != b.Cookie.Path {
+		return false
+	}
+
+	if a.Cookie.Domain != "" {
+		return true
+	}
+
+	// Host-only cookies are only the same if they were set by the same host.
+	ua, errA := url.Parse(a.URL)
+	ub, errB := url.Parse(b.URL)
+
+	return errA == nil && errB == nil && ua.Hostname() == ub.Hostname()
+}
@@ -0,0 +1,112 @@
+// Package session implements the state that is shared by separate gocurl
+// invocations, see --session.  The state consists of cookies, Alt-Svc entries,
+// and TLS session tickets (also used for QUIC) and it is kept in a JSON file.
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Session is the state that is loaded from and saved to the session file.  It
+// is safe for concurrent use.
+type Session struct {
+	// mu protects data.
+	mu *sync.Mutex
+
+	// data is the persisted state.
+	data *fileData
+
+	// jar is the cookie jar with the cookies from data.
+	jar *cookiejar.Jar
+
+	// path is the path to the session file.
+	path string
+}
+
+// fileData is the content of the session file.
+type fileData struct {
+	// Cookies are the received cookies.
+	Cookies []*cookieEntry `json:"cookies,omitempty"`
+
+	// AltSvc maps origins to the alternative services they advertised.
+	AltSvc map[string]*altSvcEntry `json:"alt_svc,omitempty"`
+
+	// TLSSessions maps the session cache keys to the TLS sessions.
+	TLSSessions map[string]*tlsSessionEntry `json:"tls_sessions,omitempty"`
+}
+
+// Load reads the session from the file at path.  If the file does not exist,
+// the session is empty and the file is created on the first Save.
+func Load(path string) (s *Session, err error) {
+	// cookiejar.New never returns an error when options are nil.
+	jar, _ := cookiejar.New(nil)
+
+	s = &Session{
+		mu:   &sync.Mutex{},
+		data: &fileData{},
+		jar:  jar,
+		path: path,
+	}
+
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("reading session: %w", err)
+	}
+
+	err = json.Unmarshal(b, s.data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing session %s: %w", path, err)
+	}
+
+	s.loadCookies(time.Now())
+
+	return s, nil
+}
+
+// Save writes the session to its file.  The file is replaced atomically.
+func (s *Session) Save() (err error) {
+	s.mu.Lock()
+	b, err := json.MarshalIndent(s.data, "", "  ")
+	s.mu.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("encoding session: %w", err)
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp-")
+	if err != nil {
+		return fmt.Errorf("saving session: %w", err)
+	}
+
+	_, err = f.Write(append(b, '\n'))
+	if cErr := f.Close(); err == nil {
+		err = cErr
+	}
+
+	if err == nil {
+		err = os.Rename(f.Name(), s.path)
+	}
+
+	if err != nil {
+		_ = os.Remove(f.Name())
+
+		return fmt.Errorf("saving session: %w", err)
+	}
+
+	return nil
+}
+
+// Jar returns the cookie jar of the session.  The cookies set to it are
+// saved with the session.
+func (s *Session) Jar() (jar http.CookieJar) {
+	return &sessionJar{s: s}
+}
@@ -0,0 +1,77 @@
+package session_test
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"github.com/ameshkov/gocurl/internal/session"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSession(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := r.Cookie("id"); err != nil {
+			http.SetCookie(w, &http.Cookie{Name: "id", Value: "1", MaxAge: 3600})
+		}
+
+		_, port, _ := net.SplitHostPort(r.Host)
+		w.Header().Set("Alt-Svc", `h3=":`+port+`"; ma=3600, h3-29=":443"`)
+		_, _ = w.Write([]byte(r.Header.Get("Cookie")))
+	}))
+	t.Cleanup(srv.Close)
+
+	path := filepath.Join(t.TempDir(), "session.json")
+
+	// get sends the request in a new invocation, i.e. using a new session
+	// loaded from the file.
+	get := func() (resp *http.Response, body string) {
+		s, err := session.Load(path)
+		require.NoError(t, err)
+
+		c := &http.Client{
+			Jar: s.Jar(),
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{
+					InsecureSkipVerify: true,
+					ClientSessionCache: s.TLSSessionCache(),
+				},
+			},
+		}
+
+		resp, err = c.Get(srv.URL)
+		require.NoError(t, err)
+
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+
+		s.SetAltSvc(resp)
+		require.NoError(t, s.Save())
+
+		return resp, string(b)
+	}
+
+	resp, body := get()
+	require.False(t, resp.TLS.DidResume)
+	require.Empty(t, body)
+
+	resp, body = get()
+	require.True(t, resp.TLS.DidResume)
+	require.Equal(t, "id=1", body)
+
+	s, err := session.Load(path)
+	require.NoError(t, err)
+
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+	require.True(t, s.HTTP3(u))
+
+	u.Host = "example.org"
+	require.False(t, s.HTTP3(u))
+}
@@ -0,0 +1,98 @@
+package session
+
+import (
+	"crypto/tls"
+)
+
+// tlsSessionCacheSize is the maximum number of TLS sessions kept in the
+// session.
+const tlsSessionCacheSize = 64
+
+// tlsSessionEntry is a TLS session saved in the session file.
+type tlsSessionEntry struct {
+	// Ticket is the session ticket sent by the server.
+	Ticket []byte `json:"ticket"`
+
+	// State is the serialized tls.SessionState.
+	State []byte `json:"state"`
+}
+
+// TLSSessionCache returns the tls.ClientSessionCache that keeps the sessions
+// in the session so that they can be resumed by later invocations.  It is
+// used for both TLS and QUIC connections.
+func (s *Session) TLSSessionCache() (c tls.ClientSessionCache) {
+	return &tlsSessionCache{s: s}
+}
+
+// tlsSessionCache is the tls.ClientSessionCache that keeps the sessions in
+// the session file.
+type tlsSessionCache struct {
+	s *Session
+}
+
+// type check
+var _ tls.ClientSessionCache = (*tlsSessionCache)(nil)
+
+// Get implements the tls.ClientSessionCache interface for *tlsSessionCache.
+func (c *tlsSessionCache) Get(sessionKey string) (cs *tls.ClientSessionState, ok bool) {
+	c.s.mu.Lock()
+	e := c.s.data.TLSSessions[sessionKey]
+	c.s.mu.Unlock()
+
+	if e == nil {
+		return nil, false
+	}
+
+	state, err := tls.ParseSessionState(e.State)
+	if err != nil {
+		return nil, false
+	}
+
+	cs, err = tls.NewResumptionState(e.Ticket, state)
+	if err != nil {
+		return nil, false
+	}
+
+	return cs, true
+}
+
+// Put implements the tls.ClientSessionCache interface for *tlsSessionCache.
+func (c *tlsSessionCache) Put(sessionKey string, cs *tls.ClientSessionState) {
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+
+	if cs == nil {
+		delete(c.s.data.TLSSessions, sessionKey)
+
+		return
+	}
+
+	ticket, state, err := cs.ResumptionState()
+	if err != nil || state == nil {
+		return
+	}
+
+	b, err := state.Bytes()
+	if err != nil {
+		return
+	}
+
+	if c.s.data.TLSSessions == nil {
+		c.s.data.TLSSessions = map[string]*tlsSessionEntry{}
+	}
+
+	if _, ok := c.s.data.TLSSessions[sessionKey]; !ok && len(c.s.data.TLSSessions) >= tlsSessionCacheSize {
+		// Evict an arbitrary session, the order doesn't really matter for
+		// the command-line tool.
+		for k := range c.s.data.TLSSessions {
+			delete(c.s.data.TLSSessions, k)
+
+			break
+		}
+	}
+
+	c.s.data.TLSSessions[sessionKey] = &tlsSessionEntry{
+		Ticket: ticket,
+		State:  b,
+	}
+}
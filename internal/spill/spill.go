@@ -0,0 +1,109 @@
+// Package spill implements a buffer that keeps the data in memory until it
+// reaches the configured limit and then spills it to a temporary file.  It is
+// used whenever gocurl needs to buffer response bodies (see --max-memory).
+package spill
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Buffer is an io.Writer that keeps the written data in memory until its size
+// exceeds the limit.  After that, all the data is moved to a temporary file.
+// Once everything is written, the data can be read back using Reader.  Close
+// must be called to remove the temporary file.
+type Buffer struct {
+	mem   *bytes.Buffer
+	file  *os.File
+	limit int64
+	size  int64
+}
+
+// type check
+var _ io.WriteCloser = (*Buffer)(nil)
+
+// New creates a new *Buffer that keeps up to limit bytes in memory.  If limit
+// is zero or negative, the data is never spilled to disk.
+func New(limit int64) (b *Buffer) {
+	return &Buffer{
+		mem:   &bytes.Buffer{},
+		limit: limit,
+	}
+}
+
+// Write implements the io.Writer interface for *Buffer.
+func (b *Buffer) Write(p []byte) (n int, err error) {
+	if b.file == nil && b.limit > 0 && b.size+int64(len(p)) > b.limit {
+		err = b.spill()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if b.file != nil {
+		n, err = b.file.Write(p)
+	} else {
+		n, err = b.mem.Write(p)
+	}
+
+	b.size += int64(n)
+
+	return n, err
+}
+
+// spill moves the data from memory to a new temporary file.
+func (b *Buffer) spill() (err error) {
+	b.file, err = os.CreateTemp("", "gocurl-*")
+	if err != nil {
+		return fmt.Errorf("creating temporary file: %w", err)
+	}
+
+	_, err = b.mem.WriteTo(b.file)
+	b.mem = &bytes.Buffer{}
+
+	return err
+}
+
+// Len returns the number of bytes written to the buffer.
+func (b *Buffer) Len() (n int64) {
+	return b.size
+}
+
+// Spilled returns true if the data was moved to a temporary file.
+func (b *Buffer) Spilled() (ok bool) {
+	return b.file != nil
+}
+
+// Reader returns the reader for the data written to the buffer.  It must only
+// be called once all the data is written.
+func (b *Buffer) Reader() (r io.Reader, err error) {
+	if b.file == nil {
+		return bytes.NewReader(b.mem.Bytes()), nil
+	}
+
+	_, err = b.file.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.file, nil
+}
+
+// Close implements the io.Closer interface for *Buffer.  It removes the
+// temporary file if it was created.
+func (b *Buffer) Close() (err error) {
+	if b.file == nil {
+		return nil
+	}
+
+	name := b.file.Name()
+	err = b.file.Close()
+	rmErr := os.Remove(name)
+	if err == nil {
+		err = rmErr
+	}
+
+	return err
+}
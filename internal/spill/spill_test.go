@@ -0,0 +1,62 @@
+package spill_test
+
+import (
+	"io"
+	"os"
+	"testing"
+
+	"github.com/ameshkov/gocurl/internal/spill"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuffer(t *testing.T) {
+	testCases := []struct {
+		name        string
+		limit       int64
+		wantSpilled bool
+	}{{
+		name:        "unlimited",
+		limit:       0,
+		wantSpilled: false,
+	}, {
+		name:        "below_limit",
+		limit:       100,
+		wantSpilled: false,
+	}, {
+		name:        "above_limit",
+		limit:       5,
+		wantSpilled: true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			b := spill.New(tc.limit)
+
+			_, err := io.WriteString(b, "hello, ")
+			require.NoError(t, err)
+
+			_, err = io.WriteString(b, "world")
+			require.NoError(t, err)
+
+			require.Equal(t, int64(12), b.Len())
+			require.Equal(t, tc.wantSpilled, b.Spilled())
+
+			r, err := b.Reader()
+			require.NoError(t, err)
+
+			data, err := io.ReadAll(r)
+			require.NoError(t, err)
+			require.Equal(t, "hello, world", string(data))
+
+			var name string
+			if f, ok := r.(*os.File); ok {
+				name = f.Name()
+			}
+
+			require.NoError(t, b.Close())
+			if name != "" {
+				require.NoFileExists(t, name)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+// Package watch implements the watch mode (--interval) that repeats the
+// request periodically and prints a compact status line per attempt.
+package watch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ameshkov/gocurl/internal/client"
+	"github.com/ameshkov/gocurl/internal/config"
+	"github.com/ameshkov/gocurl/internal/output"
+)
+
+// ErrUntilStatus is returned by Run when the responses didn't have the
+// status from --until-status.
+var ErrUntilStatus = errors.New("until-status was not received")
+
+// Attempt is the information about a single attempt that is written to the
+// output in the JSON format (one JSON object per line).
+type Attempt struct {
+	Time       time.Time     `json:"time"`
+	Attempt    int           `json:"attempt"`
+	StatusCode int           `json:"status_code,omitempty"`
+	Status     string        `json:"status,omitempty"`
+	Proto      string        `json:"proto,omitempty"`
+	BodySize   int64         `json:"body_size"`
+	Duration   time.Duration `json:"duration_ns"`
+	Error      string        `json:"error,omitempty"`
+}
+
+// String implements the fmt.Stringer interface for *Attempt.
+func (a *Attempt) String() (s string) {
+	s = fmt.Sprintf("%s #%d ", a.Time.Format(time.RFC3339), a.Attempt)
+	if a.Error != "" {
+		return s + fmt.Sprintf("error: %s (%s)", a.Error, a.Duration)
+	}
+
+	return s + fmt.Sprintf("%s %s %d bytes %s", a.Proto, a.Status, a.BodySize, a.Duration)
+}
+
+// Run repeats the request with cfg.Interval between attempts until a response
+// with cfg.UntilStatus is received or until cfg.MaxIterations attempts were
+// made.  Returns nil if cfg.UntilStatus was received or if it's not set,
+// otherwise returns the error of the last attempt or ErrUntilStatus.
+func Run(cfg *config.Config, transport client.Transport, out *output.Output) (err error) {
+	out.Debug("Repeating the request every %s", cfg.Interval)
+
+	for i := 1; ; i++ {
+		a := &Attempt{
+			Time:    time.Now(),
+			Attempt: i,
+		}
+
+		r := client.Probe(cfg, transport)
+		a.Duration = r.Duration
+		a.BodySize = r.BodySize
+		if r.Response != nil {
+			a.StatusCode = r.Response.StatusCode
+			a.Status = r.Response.Status
+			a.Proto = r.Response.Proto
+		}
+		if r.Err != nil {
+			a.Error = r.Err.Error()
+		}
+
+		err = writeAttempt(a, out, cfg.OutputJSON)
+		if err != nil {
+			return fmt.Errorf("writing attempt: %w", err)
+		}
+
+		if cfg.UntilStatus != 0 && r.Err == nil && a.StatusCode == cfg.UntilStatus {
+			return nil
+		}
+
+		if cfg.MaxIterations > 0 && i >= cfg.MaxIterations {
+			return untilStatusError(cfg, r)
+		}
+
+		time.Sleep(cfg.Interval)
+	}
+}
+
+// untilStatusError returns the error of the watch that ended with r without
+// receiving cfg.UntilStatus or nil if it's not set.
+func untilStatusError(cfg *config.Config, r *client.ProbeResult) (err error) {
+	switch {
+	case cfg.UntilStatus == 0:
+		return nil
+	case r.Err != nil:
+		return r.Err
+	default:
+		return fmt.Errorf("%w: got %s", ErrUntilStatus, r.Response.Status)
+	}
+}
+
+// writeAttempt writes the status line of the attempt to out.
+func writeAttempt(a *Attempt, out *output.Output, outputJSON bool) (err error) {
+	if !outputJSON {
+		out.WriteRaw([]byte(a.String() + "\n"))
+
+		return nil
+	}
+
+	b, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+
+	out.WriteRaw(append(b, '\n'))
+
+	return nil
+}
@@ -0,0 +1,129 @@
+package watch_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ameshkov/gocurl/internal/client"
+	"github.com/ameshkov/gocurl/internal/config"
+	"github.com/ameshkov/gocurl/internal/output"
+	"github.com/ameshkov/gocurl/internal/watch"
+	"github.com/stretchr/testify/require"
+)
+
+// newServer creates a server that responds with 503 to the first failures
+// requests and with 200 to the rest of them.
+func newServer(t *testing.T, failures int32) (u *url.URL) {
+	t.Helper()
+
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if requests.Add(1) <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+
+			return
+		}
+
+		_, _ = w.Write([]byte("test"))
+	}))
+	t.Cleanup(srv.Close)
+
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	return u
+}
+
+// runWatch runs the watch mode with cfg and returns the attempts written to
+// the output.
+func runWatch(t *testing.T, cfg *config.Config) (attempts []*watch.Attempt, err error) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "out.jsonl")
+	out, err := output.NewOutput(path, false)
+	require.NoError(t, err)
+
+	transport, err := client.NewTransport(cfg, out)
+	require.NoError(t, err)
+
+	err = watch.Run(cfg, transport, out)
+
+	f, fErr := os.Open(path)
+	require.NoError(t, fErr)
+	t.Cleanup(func() { _ = f.Close() })
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		a := &watch.Attempt{}
+		require.NoError(t, json.Unmarshal(s.Bytes(), a))
+
+		attempts = append(attempts, a)
+	}
+	require.NoError(t, s.Err())
+
+	return attempts, err
+}
+
+func TestRun_untilStatus(t *testing.T) {
+	cfg := &config.Config{
+		RequestURL:  newServer(t, 2),
+		Interval:    time.Millisecond,
+		UntilStatus: http.StatusOK,
+		OutputJSON:  true,
+	}
+
+	attempts, err := runWatch(t, cfg)
+	require.NoError(t, err)
+
+	require.Len(t, attempts, 3)
+	require.Equal(t, http.StatusServiceUnavailable, attempts[0].StatusCode)
+	require.Equal(t, http.StatusServiceUnavailable, attempts[1].StatusCode)
+	require.Equal(t, http.StatusOK, attempts[2].StatusCode)
+	require.Equal(t, 3, attempts[2].Attempt)
+	require.Equal(t, int64(4), attempts[2].BodySize)
+}
+
+func TestRun_maxIterations(t *testing.T) {
+	testCases := []struct {
+		name        string
+		untilStatus int
+		wantErr     error
+	}{{
+		name:        "no_until_status",
+		untilStatus: 0,
+		wantErr:     nil,
+	}, {
+		name:        "until_status",
+		untilStatus: http.StatusOK,
+		wantErr:     watch.ErrUntilStatus,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &config.Config{
+				RequestURL:    newServer(t, 10),
+				Interval:      time.Millisecond,
+				UntilStatus:   tc.untilStatus,
+				MaxIterations: 3,
+				OutputJSON:    true,
+			}
+
+			attempts, err := runWatch(t, cfg)
+			require.ErrorIs(t, err, tc.wantErr)
+
+			require.Len(t, attempts, 3)
+			for i, a := range attempts {
+				require.Equal(t, i+1, a.Attempt)
+				require.Equal(t, http.StatusServiceUnavailable, a.StatusCode)
+			}
+		})
+	}
+}